@@ -18,6 +18,7 @@ package backends
 
 import (
 	"context"
+	"crypto/ecdsa"
 	"errors"
 	"fmt"
 	"math/big"
@@ -25,11 +26,13 @@ import (
 	"time"
 
 	"github.com/SecretBlockChain/go-secret"
+	"github.com/SecretBlockChain/go-secret/accounts"
 	"github.com/SecretBlockChain/go-secret/accounts/abi"
 	"github.com/SecretBlockChain/go-secret/accounts/abi/bind"
 	"github.com/SecretBlockChain/go-secret/common"
 	"github.com/SecretBlockChain/go-secret/common/hexutil"
 	"github.com/SecretBlockChain/go-secret/common/math"
+	"github.com/SecretBlockChain/go-secret/consensus/equality"
 	"github.com/SecretBlockChain/go-secret/consensus/ethash"
 	"github.com/SecretBlockChain/go-secret/core"
 	"github.com/SecretBlockChain/go-secret/core/bloombits"
@@ -37,6 +40,7 @@ import (
 	"github.com/SecretBlockChain/go-secret/core/state"
 	"github.com/SecretBlockChain/go-secret/core/types"
 	"github.com/SecretBlockChain/go-secret/core/vm"
+	"github.com/SecretBlockChain/go-secret/crypto"
 	"github.com/SecretBlockChain/go-secret/eth/filters"
 	"github.com/SecretBlockChain/go-secret/ethdb"
 	"github.com/SecretBlockChain/go-secret/event"
@@ -70,6 +74,9 @@ type SimulatedBackend struct {
 	events *filters.EventSystem // Event system for filtering log events live
 
 	config *params.ChainConfig
+
+	engine *equality.Equality // Equality engine sealing the blocks, nil for the ethash faker
+	sealer *ecdsa.PrivateKey  // Key of the single validator sealing the equality blocks
 }
 
 // NewSimulatedBackendWithDatabase creates a new binding backend based on the given database
@@ -95,9 +102,64 @@ func NewSimulatedBackend(alloc core.GenesisAlloc, gasLimit uint64) *SimulatedBac
 	return NewSimulatedBackendWithDatabase(rawdb.NewMemoryDatabase(), alloc, gasLimit)
 }
 
+// simulatedFutureDrift is the time the blocks of the equality backend may be
+// ahead of the local clock, AdjustTime moves the simulated clock ahead.
+const simulatedFutureDrift = 100 * 365 * 24 * time.Hour
+
+// NewEqualitySimulatedBackendWithDatabase creates a new binding backend based on
+// the given database and uses a simulated blockchain sealed by the equality
+// engine for testing purposes. The chain runs the development config, key is
+// the single validator sealing a block on every commit. The first block elects
+// the validators of the epoch, the candidates registering in it are elected.
+func NewEqualitySimulatedBackendWithDatabase(database ethdb.Database, key *ecdsa.PrivateKey, alloc core.GenesisAlloc, gasLimit uint64) *SimulatedBackend {
+	validator := crypto.PubkeyToAddress(key.PublicKey)
+	config := *params.AllEthashProtocolChanges
+	config.Ethash = nil
+	config.Equality = params.DeveloperEqualityConfig(validator)
+
+	headerExtra, err := equality.GenesisHeaderExtra(*config.Equality, database)
+	if err != nil {
+		panic(err)
+	}
+	extra, err := equality.EncodeHeaderExtra(nil, headerExtra)
+	if err != nil {
+		panic(err)
+	}
+	genesis := core.Genesis{Config: &config, GasLimit: gasLimit, Alloc: alloc, ExtraData: extra}
+	genesis.MustCommit(database)
+
+	engine := equality.New(config.Equality, database)
+	engine.Authorize(validator, func(account accounts.Account, mimeType string, data []byte) ([]byte, error) {
+		return crypto.Sign(crypto.Keccak256(data), key)
+	})
+	engine.SetAllowedFutureDrift(simulatedFutureDrift)
+	blockchain, _ := core.NewBlockChain(database, nil, genesis.Config, engine, vm.Config{}, nil, nil)
+
+	backend := &SimulatedBackend{
+		database:   database,
+		blockchain: blockchain,
+		config:     genesis.Config,
+		events:     filters.NewEventSystem(&filterBackend{database, blockchain}, false),
+		engine:     engine,
+		sealer:     key,
+	}
+	backend.rollback()
+	return backend
+}
+
+// NewEqualitySimulatedBackend creates a new binding backend using a simulated
+// blockchain sealed by the equality engine with key as its single validator
+// for testing purposes.
+func NewEqualitySimulatedBackend(key *ecdsa.PrivateKey, alloc core.GenesisAlloc, gasLimit uint64) *SimulatedBackend {
+	return NewEqualitySimulatedBackendWithDatabase(rawdb.NewMemoryDatabase(), key, alloc, gasLimit)
+}
+
 // Close terminates the underlying blockchain's update loop.
 func (b *SimulatedBackend) Close() error {
 	b.blockchain.Stop()
+	if b.engine != nil {
+		return b.engine.Close()
+	}
 	return nil
 }
 
@@ -122,10 +184,10 @@ func (b *SimulatedBackend) Rollback() {
 }
 
 func (b *SimulatedBackend) rollback() {
-	blocks, _ := core.GenerateChain(b.config, b.blockchain.CurrentBlock(), ethash.NewFaker(), b.database, 1, func(int, *core.BlockGen) {})
+	block := b.generateBlock(nil, 0)
 	stateDB, _ := b.blockchain.State()
 
-	b.pendingBlock = blocks[0]
+	b.pendingBlock = block
 	b.pendingState, _ = state.New(b.pendingBlock.Root(), stateDB.Database(), nil)
 }
 
@@ -566,15 +628,12 @@ func (b *SimulatedBackend) SendTransaction(ctx context.Context, tx *types.Transa
 		panic(fmt.Errorf("invalid transaction nonce: got %d, want %d", tx.Nonce(), nonce))
 	}
 
-	blocks, _ := core.GenerateChain(b.config, b.blockchain.CurrentBlock(), ethash.NewFaker(), b.database, 1, func(number int, block *core.BlockGen) {
-		for _, tx := range b.pendingBlock.Transactions() {
-			block.AddTxWithChain(b.blockchain, tx)
-		}
-		block.AddTxWithChain(b.blockchain, tx)
-	})
+	txs := append(types.Transactions{}, b.pendingBlock.Transactions()...)
+	txs = append(txs, tx)
+	block := b.generateBlock(txs, 0)
 	stateDB, _ := b.blockchain.State()
 
-	b.pendingBlock = blocks[0]
+	b.pendingBlock = block
 	b.pendingState, _ = state.New(b.pendingBlock.Root(), stateDB.Database(), nil)
 	return nil
 }
@@ -684,12 +743,10 @@ func (b *SimulatedBackend) AdjustTime(adjustment time.Duration) error {
 		return errors.New("Could not adjust time on non-empty block")
 	}
 
-	blocks, _ := core.GenerateChain(b.config, b.blockchain.CurrentBlock(), ethash.NewFaker(), b.database, 1, func(number int, block *core.BlockGen) {
-		block.OffsetTime(int64(adjustment.Seconds()))
-	})
+	block := b.generateBlock(nil, int64(adjustment.Seconds()))
 	stateDB, _ := b.blockchain.State()
 
-	b.pendingBlock = blocks[0]
+	b.pendingBlock = block
 	b.pendingState, _ = state.New(b.pendingBlock.Root(), stateDB.Database(), nil)
 
 	return nil
@@ -700,6 +757,82 @@ func (b *SimulatedBackend) Blockchain() *core.BlockChain {
 	return b.blockchain
 }
 
+// EqualityAPI returns the equality API over the underlying blockchain, nil if
+// the backend is not sealed by the equality engine.
+func (b *SimulatedBackend) EqualityAPI() *equality.API {
+	if b.engine == nil {
+		return nil
+	}
+	return b.engine.APIs(b.blockchain)[0].Service.(*equality.API)
+}
+
+// generateBlock creates the block following the current head with txs, its
+// timestamp moved ahead by offset seconds. The state of the block is written
+// to the database. It panics if a transaction cannot be executed.
+func (b *SimulatedBackend) generateBlock(txs []*types.Transaction, offset int64) *types.Block {
+	if b.engine == nil {
+		blocks, _ := core.GenerateChain(b.config, b.blockchain.CurrentBlock(), ethash.NewFaker(), b.database, 1, func(number int, block *core.BlockGen) {
+			for _, tx := range txs {
+				block.AddTxWithChain(b.blockchain, tx)
+			}
+			if offset != 0 {
+				block.OffsetTime(offset)
+			}
+		})
+		return blocks[0]
+	}
+
+	// The equality blocks are prepared, finalized and sealed by the engine
+	// as the miner does, the header extra needs the chain to be assembled
+	parent := b.blockchain.CurrentBlock()
+	header := &types.Header{
+		ParentHash: parent.Hash(),
+		Number:     new(big.Int).Add(parent.Number(), common.Big1),
+		GasLimit:   core.CalcGasLimit(parent, parent.GasLimit(), parent.GasLimit()),
+		Coinbase:   crypto.PubkeyToAddress(b.sealer.PublicKey),
+	}
+	if err := b.engine.Prepare(b.blockchain, header); err != nil {
+		panic(fmt.Errorf("failed to prepare block: %v", err))
+	}
+	header.Time += uint64(offset)
+
+	statedb, err := state.New(parent.Root(), state.NewDatabase(b.database), nil)
+	if err != nil {
+		panic(err)
+	}
+	gasPool := new(core.GasPool).AddGas(header.GasLimit)
+	receipts := make([]*types.Receipt, 0, len(txs))
+	for i, tx := range txs {
+		statedb.Prepare(tx.Hash(), common.Hash{}, i)
+		receipt, err := core.ApplyTransaction(b.config, b.blockchain, &header.Coinbase, gasPool, statedb, header, tx, &header.GasUsed, vm.Config{})
+		if err != nil {
+			panic(err)
+		}
+		receipts = append(receipts, receipt)
+	}
+	block, err := b.engine.FinalizeAndAssemble(b.blockchain, header, statedb, txs, nil, receipts)
+	if err != nil {
+		panic(fmt.Errorf("failed to assemble block: %v", err))
+	}
+
+	// Write state changes to db
+	root, err := statedb.Commit(b.config.IsEIP158(header.Number))
+	if err != nil {
+		panic(fmt.Sprintf("state write error: %v", err))
+	}
+	if err := statedb.Database().TrieDB().Commit(root, false, nil); err != nil {
+		panic(fmt.Sprintf("trie write error: %v", err))
+	}
+
+	sealed := block.Header()
+	sig, err := crypto.Sign(equality.SealHash(sealed).Bytes(), b.sealer)
+	if err != nil {
+		panic(err)
+	}
+	copy(sealed.Extra[len(sealed.Extra)-equality.ExtraSeal:], sig)
+	return block.WithSeal(sealed)
+}
+
 // callMsg implements core.Message to allow passing it as a transaction simulator.
 type callMsg struct {
 	ethereum.CallMsg
@@ -30,6 +30,7 @@ import (
 	"github.com/SecretBlockChain/go-secret/accounts/abi"
 	"github.com/SecretBlockChain/go-secret/accounts/abi/bind"
 	"github.com/SecretBlockChain/go-secret/common"
+	"github.com/SecretBlockChain/go-secret/consensus/equality"
 	"github.com/SecretBlockChain/go-secret/core"
 	"github.com/SecretBlockChain/go-secret/core/types"
 	"github.com/SecretBlockChain/go-secret/crypto"
@@ -1114,3 +1115,77 @@ func TestSimulatedBackend_CallContractRevert(t *testing.T) {
 		sim.Commit()
 	}
 }
+
+func TestEqualitySimulatedBackend(t *testing.T) {
+	testAddr := crypto.PubkeyToAddress(testKey.PublicKey)
+	validatorKey, _ := crypto.GenerateKey()
+	sim := NewEqualitySimulatedBackend(validatorKey, core.GenesisAlloc{testAddr: {Balance: big.NewInt(10000000000)}}, 10000000)
+	defer sim.Close()
+	bgCtx := context.Background()
+
+	// register the sender as a candidate through the system contract, past
+	// the first block electing the validators of the epoch
+	sim.Commit()
+	contract, err := equality.NewCandidateContract(equality.CandidateContractAddress, sim)
+	if err != nil {
+		t.Fatalf("could not bind candidate contract: %v", err)
+	}
+	opts := bind.NewKeyedTransactor(testKey)
+	opts.GasLimit = 100000
+	tx, err := contract.BecomeCandidate(opts)
+	if err != nil {
+		t.Fatalf("could not send candidate transaction: %v", err)
+	}
+	sim.Commit()
+
+	receipt, err := sim.TransactionReceipt(bgCtx, tx.Hash())
+	if err != nil {
+		t.Fatalf("could not get transaction receipt: %v", err)
+	}
+	if receipt.Status != types.ReceiptStatusSuccessful {
+		t.Errorf("candidate transaction failed")
+	}
+
+	// the committed block is sealed by the validator and carries its header extra
+	header, err := sim.HeaderByNumber(bgCtx, big.NewInt(2))
+	if err != nil {
+		t.Fatalf("could not get header at height 2: %v", err)
+	}
+	if signer, err := sim.Blockchain().Engine().Author(header); err != nil || signer != crypto.PubkeyToAddress(validatorKey.PublicKey) {
+		t.Errorf("block sealed by wrong signer: have %x, %v", signer, err)
+	}
+	headerExtra, err := equality.DecodeHeaderExtra(header)
+	if err != nil {
+		t.Fatalf("could not decode header extra: %v", err)
+	}
+	if headerExtra.Epoch != 1 || headerExtra.Root == (equality.Root{}) {
+		t.Errorf("invalid header extra: %+v", headerExtra)
+	}
+
+	// the candidate is read back through the equality API
+	candidates, err := sim.EqualityAPI().GetCandidates(nil, nil, nil)
+	if err != nil {
+		t.Fatalf("could not get candidates: %v", err)
+	}
+	found := false
+	for _, candidate := range candidates.Candidates {
+		if candidate.Address == testAddr {
+			found = true
+			if number := (*big.Int)(candidate.BlockNumber); number.Cmp(header.Number) != 0 {
+				t.Errorf("candidate registered at wrong block: have %v, want %v", number, header.Number)
+			}
+		}
+	}
+	if !found {
+		t.Errorf("candidate %x not registered", testAddr)
+	}
+
+	// empty blocks are committed and the clock adjusted as with ethash
+	if err = sim.AdjustTime(time.Hour); err != nil {
+		t.Fatalf("could not adjust time: %v", err)
+	}
+	sim.Commit()
+	if head := sim.Blockchain().CurrentHeader(); head.Number.Uint64() != 3 || head.Time < header.Time+3600 {
+		t.Errorf("adjusted block not committed: number %d, time %d", head.Number, head.Time)
+	}
+}
@@ -0,0 +1,230 @@
+// Copyright 2021 The go-ethereum Authors
+// This file is part of go-ethereum.
+//
+// go-ethereum is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// go-ethereum is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-ethereum. If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/SecretBlockChain/go-secret/cmd/utils"
+	"github.com/SecretBlockChain/go-secret/consensus/equality"
+	"github.com/SecretBlockChain/go-secret/core"
+	"gopkg.in/urfave/cli.v1"
+)
+
+var (
+	equalityBlockFlag = cli.Uint64Flag{
+		Name:  "block",
+		Usage: "Number of the block to dump the header extra of",
+	}
+	equalityHexFlag = cli.StringFlag{
+		Name:  "hex",
+		Usage: "Hex encoded header extra to dump, a whole header.Extra or its payload",
+	}
+	equalityFromFlag = cli.Uint64Flag{
+		Name:  "from",
+		Usage: "First block of the range to verify",
+		Value: 1,
+	}
+	equalityToFlag = cli.Uint64Flag{
+		Name:  "to",
+		Usage: "Last block of the range to verify, the head if unset",
+	}
+	equalityUptoFlag = cli.Uint64Flag{
+		Name:  "upto",
+		Usage: "Last block to repair the snapshot tries of, the head if unset",
+	}
+
+	equalityCommand = cli.Command{
+		Name:      "equality",
+		Usage:     "Inspect the proof-of-equality consensus data",
+		ArgsUsage: "",
+		Category:  "BLOCKCHAIN COMMANDS",
+		Description: `
+The equality commands decode and verify the consensus data the equality engine
+carries in the header extra of the blocks, reading the chain database without
+starting the node.`,
+		Subcommands: []cli.Command{
+			{
+				Name:      "dump-extra",
+				Usage:     "Print the decoded header extra of a block as json",
+				ArgsUsage: " ",
+				Action:    utils.MigrateFlags(dumpExtra),
+				Flags: []cli.Flag{
+					utils.DataDirFlag,
+					utils.AncientFlag,
+					utils.CacheFlag,
+					utils.LocalnetFlag,
+					utils.LegacyTestnetFlag,
+					utils.SyncModeFlag,
+					equalityBlockFlag,
+					equalityHexFlag,
+				},
+				Description: `
+    geth equality dump-extra --block 1024
+    geth equality dump-extra --hex 0x...
+
+decodes the header extra of the canonical block of the given number, or the
+given header.Extra, and prints it as json.`,
+			},
+			{
+				Name:      "verify-range",
+				Usage:     "Replay the header extras of a range of blocks and report the first root mismatch",
+				ArgsUsage: " ",
+				Action:    utils.MigrateFlags(verifyRange),
+				Flags: []cli.Flag{
+					utils.DataDirFlag,
+					utils.AncientFlag,
+					utils.CacheFlag,
+					utils.LocalnetFlag,
+					utils.LegacyTestnetFlag,
+					utils.SyncModeFlag,
+					equalityFromFlag,
+					equalityToFlag,
+				},
+				Description: `
+    geth equality verify-range --from 1 --to 28800
+
+replays the header extras of the canonical blocks in range onto the snapshot of
+the parent of the first one, and reports the first block whose trie roots
+differ from the replayed ones.`,
+			},
+			{
+				Name:      "repair",
+				Usage:     "Rebuild the snapshot tries from the header extras after a database corruption",
+				ArgsUsage: " ",
+				Action:    utils.MigrateFlags(repairTries),
+				Flags: []cli.Flag{
+					utils.DataDirFlag,
+					utils.AncientFlag,
+					utils.CacheFlag,
+					utils.LocalnetFlag,
+					utils.LegacyTestnetFlag,
+					utils.SyncModeFlag,
+					equalityUptoFlag,
+				},
+				Description: `
+    geth equality repair --upto 1000000
+
+rebuilds the snapshot tries of the canonical blocks up to the given one by
+replaying their header extras from the latest block whose tries are whole, from
+genesis if none is, and reports the first block whose trie roots differ from
+the rebuilt ones. An interrupted repair resumes from the last tries persisted.`,
+			},
+		},
+	}
+)
+
+func dumpExtra(ctx *cli.Context) error {
+	var dump *equality.ExtraDump
+	switch {
+	case ctx.IsSet(equalityHexFlag.Name):
+		extra, err := hex.DecodeString(strings.TrimPrefix(ctx.String(equalityHexFlag.Name), "0x"))
+		if err != nil {
+			utils.Fatalf("Invalid header extra hex: %v", err)
+		}
+		if dump, err = equality.DumpExtra(extra); err != nil {
+			utils.Fatalf("Failed to decode header extra: %v", err)
+		}
+
+	case ctx.IsSet(equalityBlockFlag.Name):
+		stack, _ := makeConfigNode(ctx)
+		defer stack.Close()
+
+		chain, chainDb := utils.MakeChain(ctx, stack, true)
+		defer chainDb.Close()
+
+		number := ctx.Uint64(equalityBlockFlag.Name)
+		header := chain.GetHeaderByNumber(number)
+		if header == nil {
+			utils.Fatalf("Block %d not found", number)
+		}
+		var err error
+		if dump, err = equalityEngine(chain).DumpHeaderExtra(header); err != nil {
+			utils.Fatalf("Failed to decode header extra: %v", err)
+		}
+
+	default:
+		utils.Fatalf("Either --%s or --%s is required", equalityBlockFlag.Name, equalityHexFlag.Name)
+	}
+
+	out, err := json.MarshalIndent(dump, "", "  ")
+	if err != nil {
+		return err
+	}
+	fmt.Println(string(out))
+	return nil
+}
+
+func verifyRange(ctx *cli.Context) error {
+	stack, _ := makeConfigNode(ctx)
+	defer stack.Close()
+
+	chain, chainDb := utils.MakeChain(ctx, stack, true)
+	defer chainDb.Close()
+
+	from, to := ctx.Uint64(equalityFromFlag.Name), chain.CurrentHeader().Number.Uint64()
+	if ctx.IsSet(equalityToFlag.Name) {
+		to = ctx.Uint64(equalityToFlag.Name)
+	}
+	mismatch, err := equalityEngine(chain).VerifyRange(chain, from, to)
+	if err != nil {
+		utils.Fatalf("Failed to verify blocks %d to %d: %v", from, to, err)
+	}
+	if mismatch != nil {
+		utils.Fatalf("Root mismatch at block %d (%s): %s", mismatch.Number, mismatch.Hash.Hex(), mismatch.Difference)
+	}
+	fmt.Printf("Verified the header extras of blocks %d to %d\n", from, to)
+	return nil
+}
+
+func repairTries(ctx *cli.Context) error {
+	stack, _ := makeConfigNode(ctx)
+	defer stack.Close()
+
+	chain, chainDb := utils.MakeChain(ctx, stack, false)
+	defer chainDb.Close()
+	defer chain.Stop()
+
+	upto := ctx.Uint64(equalityUptoFlag.Name)
+	if upto == 0 {
+		upto = chain.CurrentHeader().Number.Uint64()
+	}
+	equalityEngine(chain) // Fails unless the chain is sealed by the equality engine
+	if err := equality.Repair(chain, chainDb, upto); err != nil {
+		var mismatch *equality.RootMismatch
+		if errors.As(err, &mismatch) {
+			utils.Fatalf("Root mismatch at block %d (%s): %s", mismatch.Number, mismatch.Hash.Hex(), mismatch.Difference)
+		}
+		utils.Fatalf("Failed to repair the snapshot tries up to block %d: %v", upto, err)
+	}
+	fmt.Printf("Repaired the snapshot tries up to block %d\n", upto)
+	return nil
+}
+
+// equalityEngine returns the equality engine of chain, failing if the chain is
+// sealed by another one.
+func equalityEngine(chain *core.BlockChain) *equality.Equality {
+	engine, ok := chain.Engine().(*equality.Equality)
+	if !ok {
+		utils.Fatalf("The chain is not sealed by the equality engine")
+	}
+	return engine
+}
@@ -28,6 +28,7 @@ import (
 	"syscall"
 
 	"github.com/SecretBlockChain/go-secret/common"
+	"github.com/SecretBlockChain/go-secret/consensus/equality"
 	"github.com/SecretBlockChain/go-secret/core"
 	"github.com/SecretBlockChain/go-secret/core/rawdb"
 	"github.com/SecretBlockChain/go-secret/core/types"
@@ -128,6 +129,7 @@ func ImportChain(chain *core.BlockChain, fn string) error {
 	// Run actual the import.
 	blocks := make(types.Blocks, importBatchSize)
 	n := 0
+	var first uint64
 	for batch := 0; ; batch++ {
 		// Load a batch of RLP blocks.
 		if checkInterrupt() {
@@ -164,6 +166,16 @@ func ImportChain(chain *core.BlockChain, fn string) error {
 		if _, err := chain.InsertChain(missing); err != nil {
 			return fmt.Errorf("invalid block %d: %v", n, err)
 		}
+		if first == 0 {
+			first = missing[0].NumberU64()
+		}
+	}
+	// Persist the consensus data the equality engine keeps beside the blocks
+	head := chain.CurrentBlock().NumberU64()
+	if engine, ok := chain.Engine().(*equality.Equality); ok && first > 0 && first <= head {
+		if err := engine.RebuildIndexes(chain, first, head); err != nil {
+			return fmt.Errorf("failed to rebuild equality indexes: %v", err)
+		}
 	}
 	return nil
 }
@@ -201,6 +201,10 @@ var (
 		Name:  "whitelist",
 		Usage: "Comma separated block number-to-hash mappings to enforce (<number>=<hash>)",
 	}
+	EqualityCheckpointFlag = cli.StringFlag{
+		Name:  "equality.checkpoint",
+		Usage: "JSON file of a trusted equality checkpoint, the headers up to which aren't verified",
+	}
 	// Light server and client settings
 	LightServeFlag = cli.IntFlag{
 		Name:  "light.serve",
@@ -419,6 +423,10 @@ var (
 		Name:  "miner.noverify",
 		Usage: "Disable remote sealing verification",
 	}
+	MinerMaxClockSkewFlag = cli.DurationFlag{
+		Name:  "miner.maxclockskew",
+		Usage: "Skew of the local clock against the imported blocks beyond which sealing is refused (0 = only warn)",
+	}
 	// Account settings
 	UnlockedAccountFlag = cli.StringFlag{
 		Name:  "unlock",
@@ -453,6 +461,10 @@ var (
 		Usage: "Sets a cap on transaction fee (in ether) that can be sent via the RPC APIs (0 = no cap)",
 		Value: eth.DefaultConfig.RPCTxFeeCap,
 	}
+	RPCEqualityBlocksFlag = cli.BoolFlag{
+		Name:  "rpc.equalityblocks",
+		Usage: "Adds the decoded equality epoch and trie roots to the blocks returned by eth_getBlockByNumber/eth_getBlockByHash",
+	}
 	// Logging and debug settings
 	EthStatsURLFlag = cli.StringFlag{
 		Name:  "ethstats",
@@ -1366,6 +1378,9 @@ func setMiner(ctx *cli.Context, cfg *miner.Config) {
 	if ctx.GlobalIsSet(MinerNoVerfiyFlag.Name) {
 		cfg.Noverify = ctx.GlobalBool(MinerNoVerfiyFlag.Name)
 	}
+	if ctx.GlobalIsSet(MinerMaxClockSkewFlag.Name) {
+		cfg.MaxClockSkew = ctx.GlobalDuration(MinerMaxClockSkewFlag.Name)
+	}
 }
 
 func setWhitelist(ctx *cli.Context, cfg *eth.Config) {
@@ -1536,6 +1551,12 @@ func SetEthConfig(ctx *cli.Context, stack *node.Node, cfg *eth.Config) {
 	if ctx.GlobalIsSet(RPCGlobalTxFeeCapFlag.Name) {
 		cfg.RPCTxFeeCap = ctx.GlobalFloat64(RPCGlobalTxFeeCapFlag.Name)
 	}
+	if ctx.GlobalIsSet(RPCEqualityBlocksFlag.Name) {
+		cfg.RPCEqualityBlocks = ctx.GlobalBool(RPCEqualityBlocksFlag.Name)
+	}
+	if ctx.GlobalIsSet(EqualityCheckpointFlag.Name) {
+		cfg.EqualityCheckpoint = ctx.GlobalString(EqualityCheckpointFlag.Name)
+	}
 	if ctx.GlobalIsSet(DNSDiscoveryFlag.Name) {
 		urls := ctx.GlobalString(DNSDiscoveryFlag.Name)
 		if urls == "" {
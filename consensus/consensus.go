@@ -129,3 +129,12 @@ type PoW interface {
 	// Hashrate returns the current mining hashrate of a PoW consensus engine.
 	Hashrate() float64
 }
+
+// Finality is a consensus engine tracking the finalized block of a chain.
+type Finality interface {
+	Engine
+
+	// FinalizedHeader returns the header of the finalized block of the current
+	// head of chain, nil if unknown.
+	FinalizedHeader(chain ChainHeaderReader) *types.Header
+}
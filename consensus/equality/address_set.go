@@ -0,0 +1,92 @@
+package equality
+
+import (
+	"io"
+
+	"github.com/SecretBlockChain/go-secret/common"
+	"github.com/SecretBlockChain/go-secret/rlp"
+)
+
+// AddressSet is a set of addresses keeping the order they were added in. It
+// encodes to rlp as the slice of its addresses in that order.
+type AddressSet struct {
+	index     map[common.Address]int // Position of the addresses in the list
+	addresses []common.Address       // Addresses in insertion order
+}
+
+// NewAddressSet creates a set of the given addresses, the duplicates are kept
+// at their first position.
+func NewAddressSet(addresses ...common.Address) *AddressSet {
+	set := &AddressSet{
+		index:     make(map[common.Address]int, len(addresses)),
+		addresses: make([]common.Address, 0, len(addresses)),
+	}
+	for _, address := range addresses {
+		set.Add(address)
+	}
+	return set
+}
+
+// Add appends address to the set, it returns false if it is already in.
+func (set *AddressSet) Add(address common.Address) bool {
+	if set.index == nil {
+		set.index = make(map[common.Address]int)
+	}
+	if _, ok := set.index[address]; ok {
+		return false
+	}
+	set.index[address] = len(set.addresses)
+	set.addresses = append(set.addresses, address)
+	return true
+}
+
+// Remove removes address from the set keeping the order of the others, it
+// returns false if it is not in.
+func (set *AddressSet) Remove(address common.Address) bool {
+	idx, ok := set.index[address]
+	if !ok {
+		return false
+	}
+	delete(set.index, address)
+	copy(set.addresses[idx:], set.addresses[idx+1:])
+	set.addresses = set.addresses[:len(set.addresses)-1]
+	for ; idx < len(set.addresses); idx++ {
+		set.index[set.addresses[idx]] = idx
+	}
+	return true
+}
+
+// Contains returns whether address is in the set.
+func (set *AddressSet) Contains(address common.Address) bool {
+	_, ok := set.index[address]
+	return ok
+}
+
+// Len returns the number of addresses in the set.
+func (set *AddressSet) Len() int {
+	return len(set.addresses)
+}
+
+// Slice returns a copy of the addresses in insertion order, nil if the set is
+// empty.
+func (set *AddressSet) Slice() []common.Address {
+	if len(set.addresses) == 0 {
+		return nil
+	}
+	return append([]common.Address{}, set.addresses...)
+}
+
+// EncodeRLP implements rlp.Encoder, encoding the addresses as a slice.
+func (set *AddressSet) EncodeRLP(w io.Writer) error {
+	return rlp.Encode(w, set.addresses)
+}
+
+// DecodeRLP implements rlp.Decoder, decoding a slice of addresses.
+func (set *AddressSet) DecodeRLP(s *rlp.Stream) error {
+	var addresses []common.Address
+	if err := s.Decode(&addresses); err != nil {
+		return err
+	}
+	*set = *NewAddressSet(addresses...)
+	return nil
+}
@@ -0,0 +1,91 @@
+package equality
+
+import (
+	"testing"
+
+	"github.com/SecretBlockChain/go-secret/common"
+	"github.com/SecretBlockChain/go-secret/rlp"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAddressSet(t *testing.T) {
+	address1 := common.HexToAddress("0xcc7c8317b21e1cea6139700c3c46c21af998d14c")
+	address2 := common.HexToAddress("0x44d1ce0b7cb3588bca96151fe1bc05af38f91b6c")
+	address3 := common.HexToAddress("0x0d4ea9bd8ca6a1e1ad9d4c8d7f33d692bcccd8c7")
+
+	// Duplicates keep their first position
+	set := NewAddressSet(address1, address2, address1)
+	assert.Equal(t, 2, set.Len())
+	assert.Equal(t, []common.Address{address1, address2}, set.Slice())
+	assert.False(t, set.Add(address2))
+	assert.True(t, set.Add(address3))
+	assert.True(t, set.Contains(address3))
+
+	// Removing keeps the order of the others, adding again appends
+	assert.True(t, set.Remove(address1))
+	assert.False(t, set.Remove(address1))
+	assert.False(t, set.Contains(address1))
+	assert.Equal(t, []common.Address{address2, address3}, set.Slice())
+	assert.True(t, set.Remove(address3))
+	assert.True(t, set.Add(address1))
+	assert.True(t, set.Add(address3))
+	assert.Equal(t, []common.Address{address2, address1, address3}, set.Slice())
+
+	// Slices are copies, nil for empty sets
+	set.Slice()[0] = common.Address{}
+	assert.True(t, set.Contains(address2))
+	assert.Nil(t, NewAddressSet().Slice())
+	var zero AddressSet
+	assert.True(t, zero.Add(address1))
+	assert.Equal(t, []common.Address{address1}, zero.Slice())
+}
+
+func TestAddressSetRLP(t *testing.T) {
+	for _, addresses := range [][]common.Address{
+		nil,
+		{common.HexToAddress("0xcc7c8317b21e1cea6139700c3c46c21af998d14c")},
+		newTestHeaderExtra(1000).CurrentEpochValidators,
+	} {
+		// The set encodes byte identical to the slice of its addresses
+		set := NewAddressSet(addresses...)
+		want, err := rlp.EncodeToBytes(addresses)
+		assert.Nil(t, err)
+		data, err := rlp.EncodeToBytes(set)
+		assert.Nil(t, err)
+		assert.Equal(t, want, data)
+
+		var decoded AddressSet
+		assert.Nil(t, rlp.DecodeBytes(data, &decoded))
+		assert.Equal(t, set.Slice(), decoded.Slice())
+	}
+}
+
+// benchmarkBlockCandidates returns the candidates of a block of 1000
+// registrations and the addresses checked against them, half of them in.
+func benchmarkBlockCandidates() (candidates, checked []common.Address) {
+	addresses := newTestHeaderExtra(1500).CurrentEpochValidators
+	return addresses[:1000], addresses[500:]
+}
+
+func BenchmarkAddressesExist(b *testing.B) {
+	candidates, checked := benchmarkBlockCandidates()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for _, address := range checked {
+			addressesExist(candidates, address)
+		}
+	}
+}
+
+func BenchmarkAddressSetContains(b *testing.B) {
+	candidates, checked := benchmarkBlockCandidates()
+	set := NewAddressSet(candidates...)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for _, address := range checked {
+			set.Contains(address)
+		}
+	}
+}
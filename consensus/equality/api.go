@@ -1,19 +1,55 @@
 package equality
 
 import (
+	"errors"
+	"fmt"
 	"math/big"
+	"time"
 
 	"github.com/SecretBlockChain/go-secret/common"
+	"github.com/SecretBlockChain/go-secret/common/hexutil"
 	"github.com/SecretBlockChain/go-secret/common/math"
 	"github.com/SecretBlockChain/go-secret/consensus"
 	"github.com/SecretBlockChain/go-secret/core/types"
+	"github.com/SecretBlockChain/go-secret/params"
 	"github.com/SecretBlockChain/go-secret/rpc"
+	"github.com/SecretBlockChain/go-secret/trie"
 )
 
+// maxCandidatesPerPage is the max number of candidates returned by one call
+// of GetCandidates.
+const maxCandidatesPerPage = 1000
+
+// maxHeaderExtraRange is the max number of blocks whose header extras are
+// returned by one call of GetHeaderExtraRange.
+const maxHeaderExtraRange = 1024
+
+// maxValidatorStatsEpochs is the max number of epochs reported by one call of
+// GetValidatorStats.
+const maxValidatorStatsEpochs = 100
+
+// maxSealerScheduleBlocks is the max number of blocks scheduled by one call of
+// GetSealerSchedule.
+const maxSealerScheduleBlocks = 1024
+
 type rpcCandidate struct {
 	Address     common.Address        `json:"address"`
+	IsValidator bool                  `json:"isValidator"`
+	Exiting     bool                  `json:"exiting"`
 	Staked      *math.HexOrDecimal256 `json:"staked"`
 	BlockNumber *math.HexOrDecimal256 `json:"blockNumber"`
+	Eligible    *math.HexOrDecimal256 `json:"eligibleFrom"`
+	Metadata    hexutil.Bytes         `json:"metadata,omitempty"`
+	Evictable   bool                  `json:"evictable"`
+	Recipient   *common.Address       `json:"rewardRecipient,omitempty"`
+	Barred      bool                  `json:"barred,omitempty"`
+}
+
+type rpcCandidates struct {
+	BlockNumber       hexutil.Uint64        `json:"blockNumber"`
+	Candidates        []rpcCandidate        `json:"candidates"`
+	Next              *common.Address       `json:"next"`
+	EvictionThreshold *math.HexOrDecimal256 `json:"evictionThreshold,omitempty"`
 }
 
 type rpcValidator struct {
@@ -21,18 +57,177 @@ type rpcValidator struct {
 	CountMinted *big.Int       `json:"countMinted"`
 }
 
+type rpcValidators struct {
+	BlockNumber hexutil.Uint64 `json:"blockNumber"`
+	Epoch       hexutil.Uint64 `json:"epoch"`
+	Validators  []rpcValidator `json:"validators"`
+}
+
+type rpcEpochInfo struct {
+	BlockNumber       hexutil.Uint64   `json:"blockNumber"`
+	Epoch             hexutil.Uint64   `json:"epoch"`
+	EpochBlock        hexutil.Uint64   `json:"epochBlock"`
+	NextElectionBlock hexutil.Uint64   `json:"nextElectionBlock"`
+	Validators        []rpcValidator   `json:"validators"`
+	Candidates        []common.Address `json:"candidates"`
+}
+
+type rpcEpochStats struct {
+	Epoch      hexutil.Uint64        `json:"epoch"`
+	FirstBlock hexutil.Uint64        `json:"firstBlock"`
+	LastBlock  hexutil.Uint64        `json:"lastBlock"`
+	Inactive   bool                  `json:"inactive"`
+	Sealed     hexutil.Uint64        `json:"sealed"`
+	Expected   hexutil.Uint64        `json:"expected"`
+	KickedOut  bool                  `json:"kickedOut"`
+	Rewards    *math.HexOrDecimal256 `json:"rewards"`
+}
+
+type rpcValidatorStats struct {
+	Address  common.Address        `json:"address"`
+	Sealed   hexutil.Uint64        `json:"sealed"`
+	Expected hexutil.Uint64        `json:"expected"`
+	KickOuts hexutil.Uint64        `json:"kickOuts"`
+	Rewards  *math.HexOrDecimal256 `json:"rewards"`
+	Epochs   []rpcEpochStats       `json:"epochs"`
+}
+
+type rpcChainConfig struct {
+	BlockNumber hexutil.Uint64         `json:"blockNumber"`
+	Recorded    bool                   `json:"recorded"`
+	Config      params.EqualityConfig  `json:"config"`
+	Pending     *params.EqualityConfig `json:"pending,omitempty"`
+}
+
 type rpcCandidateInfo struct {
 	Address     common.Address        `json:"address"`
 	IsCandidate bool                  `json:"isCandidate"`
 	IsValidator bool                  `json:"isValidator"`
+	Exiting     bool                  `json:"exiting"`
 	Staked      *math.HexOrDecimal256 `json:"staked"`
 	BlockNumber *math.HexOrDecimal256 `json:"blockNumber"`
+	Metadata    hexutil.Bytes         `json:"metadata,omitempty"`
+	LockOut     hexutil.Uint64        `json:"lockOut"`
+	Recipient   *common.Address       `json:"rewardRecipient,omitempty"`
+}
+
+type rpcHeaderExtra struct {
+	Number      hexutil.Uint64   `json:"number"`
+	Hash        common.Hash      `json:"hash"`
+	HeaderExtra *HeaderExtraJSON `json:"headerExtra"`
+}
+
+type rpcEpochValidators struct {
+	Epoch       hexutil.Uint64   `json:"epoch"`
+	BlockNumber hexutil.Uint64   `json:"blockNumber"`
+	Hash        common.Hash      `json:"hash"`
+	Validators  []common.Address `json:"validators"`
+}
+
+type rpcElection struct {
+	Hash       common.Hash `json:"hash"`
+	Consistent bool        `json:"consistent"`
+	*electionTrail
+}
+
+type rpcKickOut struct {
+	Epoch       hexutil.Uint64 `json:"epoch"`
+	BlockNumber hexutil.Uint64 `json:"blockNumber"`
+	Hash        common.Hash    `json:"hash"`
+	Minted      hexutil.Uint64 `json:"minted"`
+	Scheduled   hexutil.Uint64 `json:"scheduled"`
+	MinMinted   hexutil.Uint64 `json:"minMinted"`
+}
+
+type rpcCheckpointSignature struct {
+	Number      hexutil.Uint64 `json:"number"`
+	Hash        common.Hash    `json:"hash"`
+	Signer      common.Address `json:"signer"`
+	Signature   hexutil.Bytes  `json:"signature"`
+	Transaction string         `json:"transaction"`
+}
+
+type rpcCheckpoint struct {
+	Number      hexutil.Uint64   `json:"number"`
+	Hash        common.Hash      `json:"hash"`
+	BlockNumber hexutil.Uint64   `json:"blockNumber"`
+	BlockHash   common.Hash      `json:"blockHash"`
+	Signers     []common.Address `json:"signers"`
+}
+
+type rpcFinalizedBlock struct {
+	Number hexutil.Uint64 `json:"number"`
+	Hash   common.Hash    `json:"hash"`
+}
+
+type rpcConsensusMismatch struct {
+	Source      string         `json:"source"`
+	Field       string         `json:"field"`
+	Ours        string         `json:"ours"`
+	Theirs      string         `json:"theirs"`
+	Count       hexutil.Uint64 `json:"count"`
+	FirstNumber hexutil.Uint64 `json:"firstNumber"`
+	LastNumber  hexutil.Uint64 `json:"lastNumber"`
+	LastHash    common.Hash    `json:"lastHash"`
+	FirstSeen   hexutil.Uint64 `json:"firstSeen"`
+	LastSeen    hexutil.Uint64 `json:"lastSeen"`
+}
+
+type rpcFaultField struct {
+	Field   string           `json:"field"`
+	Ours    string           `json:"ours,omitempty"`
+	Theirs  string           `json:"theirs,omitempty"`
+	Added   []common.Address `json:"added,omitempty"`
+	Removed []common.Address `json:"removed,omitempty"`
+}
+
+type rpcFault struct {
+	Sequence    hexutil.Uint64   `json:"sequence"`
+	BlockNumber hexutil.Uint64   `json:"blockNumber"`
+	Hash        common.Hash      `json:"hash"`
+	Rule        string           `json:"rule"`
+	Reason      string           `json:"reason,omitempty"`
+	Addresses   []common.Address `json:"addresses"`
+	Fields      []rpcFaultField  `json:"fields"`
+	Time        hexutil.Uint64   `json:"time"`
+}
+
+type rpcSealerSlot struct {
+	Number    hexutil.Uint64  `json:"number"`
+	Time      hexutil.Uint64  `json:"time"`
+	Validator *common.Address `json:"validator"`
+	Known     bool            `json:"known"`
+}
+
+type rpcSealerSchedule struct {
+	BlockNumber hexutil.Uint64  `json:"blockNumber"`
+	Slots       []rpcSealerSlot `json:"slots"`
+}
+
+type rpcTrieProof struct {
+	Address     common.Address `json:"address"`
+	BlockNumber hexutil.Uint64 `json:"blockNumber"`
+	Root        common.Hash    `json:"root"`
+	Key         hexutil.Bytes  `json:"key"`
+	Value       hexutil.Bytes  `json:"value"`
+	Proof       []string       `json:"proof"`
 }
 
 type rpcCandidatesCount struct {
 	CandidatesCount int `json:"candidatesCount"`
 }
 
+type rpcSnapshot struct {
+	Number          hexutil.Uint64                    `json:"number"`
+	Hash            common.Hash                       `json:"hash"`
+	Epoch           hexutil.Uint64                    `json:"epoch"`
+	EpochBlock      hexutil.Uint64                    `json:"epochBlock"`
+	Validators      []common.Address                  `json:"validators"`
+	Recents         map[hexutil.Uint64]common.Address `json:"recents"`
+	CandidatesCount int                               `json:"candidatesCount"`
+	Root            Root                              `json:"root"`
+}
+
 // API is a user facing RPC API to allow controlling the signer and voting
 // mechanisms of the proof-of-equality scheme.
 type API struct {
@@ -40,30 +235,70 @@ type API struct {
 	equality *Equality
 }
 
-// load a snapshot at specified block
-func (api *API) loadSnapshot(number *rpc.BlockNumber) (*Snapshot, HeaderExtra, error) {
+// header retrieves the header at specified block, latest if none requested.
+// The pending block is the one being mined, the latest one if not mining, the
+// finalized block the one of the current head.
+func (api *API) header(number *rpc.BlockNumber) (*types.Header, error) {
+	if number != nil && *number == rpc.PendingBlockNumber {
+		if header := api.equality.pendingHeader(); header != nil {
+			return header, nil
+		}
+	}
+
 	var header *types.Header
-	if number == nil || *number == rpc.LatestBlockNumber {
+	if number == nil || *number == rpc.LatestBlockNumber || *number == rpc.PendingBlockNumber {
 		header = api.chain.CurrentHeader()
-	} else {
+	} else if *number == rpc.FinalizedBlockNumber {
+		header = api.equality.FinalizedHeader(api.chain)
+	} else if *number >= 0 {
 		header = api.chain.GetHeaderByNumber(uint64(number.Int64()))
 	}
 	if header == nil {
-		return nil, HeaderExtra{}, errUnknownBlock
+		return nil, errUnknownBlock
+	}
+	return header, nil
+}
+
+// load a snapshot at specified block
+func (api *API) loadSnapshot(number *rpc.BlockNumber) (*Snapshot, HeaderExtra, error) {
+	header, err := api.header(number)
+	if err != nil {
+		return nil, HeaderExtra{}, err
 	}
+	return api.loadSnapshotAt(header)
+}
 
-	headerExtra, err := DecodeHeaderExtra(header)
+// load a snapshot at specified header
+func (api *API) loadSnapshotAt(header *types.Header) (*Snapshot, HeaderExtra, error) {
+	headerExtra, err := api.equality.DecodeHeaderExtraCached(header)
 	if err != nil {
 		return nil, HeaderExtra{}, err
 	}
 
-	snap, err := loadSnapshot(api.equality.db, headerExtra.Root)
+	snap, err := api.equality.snapshot(api.chain, header, nil)
 	return snap, headerExtra, err
 }
 
-// GetAddress retrieves the candidate information of the address
+// missingState annotates trie errors caused by missing nodes with the name
+// and root of the trie, other errors are returned as is
+func missingState(name string, root common.Hash, header *types.Header, err error) error {
+	var missing *trie.MissingNodeError
+	if !errors.As(err, &missing) {
+		return err
+	}
+	return fmt.Errorf("%w: %s trie %s at block %d, state may be pruned: %v",
+		errMissingState, name, root.Hex(), header.Number.Uint64(), err)
+}
+
+// GetAddress retrieves the candidate information of the address, lock out is
+// the number of upcoming blocks rejecting the registration of a kicked out
+// candidate
 func (api *API) GetAddress(address common.Address, number *rpc.BlockNumber) (rpcCandidateInfo, error) {
-	snap, _, err := api.loadSnapshot(number)
+	header, err := api.header(number)
+	if err != nil {
+		return rpcCandidateInfo{}, err
+	}
+	snap, _, err := api.loadSnapshotAt(header)
 	if err != nil {
 		return rpcCandidateInfo{}, err
 	}
@@ -75,10 +310,25 @@ func (api *API) GetAddress(address common.Address, number *rpc.BlockNumber) (rpc
 	}
 	if candidate != nil {
 		result.IsCandidate = true
+		result.Exiting = candidate.Exiting
 		staked := math.HexOrDecimal256(*candidate.Staked)
 		result.Staked = &staked
 		blockNumber := math.NewHexOrDecimal256(int64(candidate.BlockNumber))
 		result.BlockNumber = blockNumber
+		result.Metadata = candidate.Metadata
+		result.Recipient = candidate.RewardRecipient
+	} else if _, kicked, err := snap.GetKickOutBlock(address); err != nil {
+		return rpcCandidateInfo{}, err
+	} else if kicked {
+		config, err := snap.GetChainConfig()
+		if err != nil {
+			return rpcCandidateInfo{}, err
+		}
+		blocks, err := lockOut(config, snap, address, header.Number.Uint64()+1)
+		if err != nil {
+			return rpcCandidateInfo{}, err
+		}
+		result.LockOut = hexutil.Uint64(blocks)
 	}
 
 	validators, err := snap.GetValidators()
@@ -94,26 +344,67 @@ func (api *API) GetAddress(address common.Address, number *rpc.BlockNumber) (rpc
 	return result, nil
 }
 
-// GetCandidates retrieves the list of the candidates at specified block
-func (api *API) GetCandidates(number *rpc.BlockNumber) ([]rpcCandidate, error) {
-	snap, _, err := api.loadSnapshot(number)
+// GetCandidates retrieves the candidates at specified block ordered by address,
+// at most limit (capped at 1000) of them starting at the cursor address. The
+// next field of the result is the cursor of the following page
+func (api *API) GetCandidates(number *rpc.BlockNumber, cursor *common.Address, limit *int) (*rpcCandidates, error) {
+	header, err := api.header(number)
+	if err != nil {
+		return nil, err
+	}
+	snap, headerExtra, err := api.loadSnapshotAt(header)
 	if err != nil {
 		return nil, err
 	}
 
-	candidates, err := snap.GetCandidates()
+	var start common.Address
+	if cursor != nil {
+		start = *cursor
+	}
+	count := maxCandidatesPerPage
+	if limit != nil && *limit > 0 && *limit < count {
+		count = *limit
+	}
+	addresses, candidates, next, err := snap.GetCandidatesFrom(start, count)
+	if err != nil {
+		return nil, missingState("candidate", headerExtra.Root.CandidateHash, header, err)
+	}
+	// No validators are elected before the first epoch, only missing state fails
+	validators, err := snap.GetValidators()
+	var missing *trie.MissingNodeError
+	if errors.As(err, &missing) {
+		return nil, missingState("epoch", headerExtra.Root.EpochHash, header, err)
+	}
+
+	// At the max candidate count, a registration must exceed the deposit of
+	// the evictable candidate
+	config, err := api.equality.chainConfigByHash(headerExtra.Root.ConfigHash)
 	if err != nil {
 		return nil, err
 	}
+	evictable, staked, full, err := snap.evictableCandidate(config)
+	if err != nil {
+		return nil, missingState("candidate", headerExtra.Root.CandidateHash, header, err)
+	}
 
-	result := make([]rpcCandidate, 0, len(candidates))
-	for addr, candidate := range candidates {
-		c := rpcCandidate{Address: addr}
+	result := &rpcCandidates{
+		BlockNumber: hexutil.Uint64(header.Number.Uint64()),
+		Candidates:  make([]rpcCandidate, 0, len(candidates)),
+		Next:        next,
+	}
+	if full {
+		result.EvictionThreshold = (*math.HexOrDecimal256)(new(big.Int).Set(staked))
+	}
+	for idx, candidate := range candidates {
+		c := rpcCandidate{Address: addresses[idx], IsValidator: addressesExist(validators, addresses[idx]), Exiting: candidate.Exiting,
+			Metadata: candidate.Metadata, Evictable: full && addresses[idx] == evictable, Recipient: candidate.RewardRecipient,
+			Barred: candidateBarred(config, addresses[idx])}
 		staked := math.HexOrDecimal256(*candidate.Staked)
 		c.Staked = &staked
 		blockNumber := math.NewHexOrDecimal256(int64(candidate.BlockNumber))
 		c.BlockNumber = blockNumber
-		result = append(result, c)
+		c.Eligible = math.NewHexOrDecimal256(int64(eligibleFrom(config, candidate.BlockNumber)))
+		result.Candidates = append(result.Candidates, c)
 	}
 	return result, nil
 }
@@ -133,20 +424,85 @@ func (api *API) GetCandidatesCount(number *rpc.BlockNumber) (rpcCandidatesCount,
 	return rpcCandidatesCount{CandidatesCount:len(candidates)}, nil
 }
 
-// GetValidators retrieves the list of the validators at specified block
-func (api *API) GetValidators(number *rpc.BlockNumber) ([]rpcValidator, error) {
-	snap, headerExtra, err := api.loadSnapshot(number)
+// GetValidators retrieves the ordered list of the validators at specified block,
+// taken from the epoch transition header if the epoch trie is unavailable.
+// Blocks with indexed header extras are answered from the index
+func (api *API) GetValidators(number *rpc.BlockNumber) (*rpcValidators, error) {
+	header, err := api.header(number)
+	if err != nil {
+		return nil, err
+	}
+	if index := api.equality.headerExtraIndex(header); index != nil {
+		return api.indexedValidators(header, index)
+	}
+	headerExtra, err := api.equality.DecodeHeaderExtraCached(header)
 	if err != nil {
 		return nil, err
 	}
 
-	validators, err := snap.GetValidators()
+	result := &rpcValidators{
+		BlockNumber: hexutil.Uint64(header.Number.Uint64()),
+		Epoch:       hexutil.Uint64(headerExtra.Epoch),
+	}
+	var validators []common.Address
+	snap, err := api.equality.snapshot(api.chain, header, nil)
+	if err == nil {
+		validators, err = snap.GetValidators()
+	}
 	if err != nil {
+		validators, err = api.epochValidators(headerExtra)
+		if err != nil {
+			return nil, fmt.Errorf("%w: epoch trie %s at block %d, state may be pruned: %v",
+				errMissingState, headerExtra.Root.EpochHash.Hex(), header.Number.Uint64(), err)
+		}
+		result.Validators = make([]rpcValidator, 0, len(validators))
+		for _, validator := range validators {
+			result.Validators = append(result.Validators, rpcValidator{Address: validator})
+		}
+		return result, nil
+	}
+
+	if result.Validators, err = mintedValidators(snap, headerExtra.Epoch, validators); err != nil {
 		return nil, err
 	}
+	return result, nil
+}
+
+// indexedValidators retrieves the validators at an indexed block from the
+// index of its epoch transition, with the mint counts if its snapshot is
+// available
+func (api *API) indexedValidators(header *types.Header, index *headerExtraIndex) (*rpcValidators, error) {
+	result := &rpcValidators{
+		BlockNumber: hexutil.Uint64(header.Number.Uint64()),
+		Epoch:       hexutil.Uint64(index.Epoch),
+	}
+	if api.equality.snapshots.available(index.Root) {
+		snap := api.equality.snapshots.open(index.Root)
+		validators, err := snap.GetValidators()
+		if err == nil {
+			if result.Validators, err = mintedValidators(snap, index.Epoch, validators); err != nil {
+				return nil, err
+			}
+			return result, nil
+		}
+	}
+
+	epochIndex := readHeaderExtraIndex(api.equality.db, index.EpochBlock)
+	if epochIndex == nil || epochIndex.Epoch != index.Epoch || len(epochIndex.Validators) == 0 {
+		return nil, fmt.Errorf("%w: epoch trie %s at block %d, state may be pruned: %v",
+			errMissingState, index.Root.EpochHash.Hex(), header.Number.Uint64(), errUnknownBlock)
+	}
+	result.Validators = make([]rpcValidator, 0, len(epochIndex.Validators))
+	for _, validator := range epochIndex.Validators {
+		result.Validators = append(result.Validators, rpcValidator{Address: validator})
+	}
+	return result, nil
+}
 
+// mintedValidators pairs the validators with their mint counts of the epoch
+func mintedValidators(snap *Snapshot, epoch uint64, validators []common.Address) ([]rpcValidator, error) {
 	mapper := make(map[common.Address]*big.Int)
-	addresses, err := snap.CountMinted(headerExtra.Epoch)
+	addresses, err := snap.CountMinted(epoch)
 	if err != nil {
 		return nil, err
 	}
@@ -162,3 +518,747 @@ func (api *API) GetValidators(number *rpc.BlockNumber) ([]rpcValidator, error) {
 	}
 	return result, nil
 }
+
+// GetEpochInfo retrieves a summary of the epoch at specified block: its first
+// block, the block of the next election, the validators in the sealing order
+// of the following blocks with their mint counts so far, and the candidates
+// eligible for the next election, i.e. the ones not exiting
+func (api *API) GetEpochInfo(number *rpc.BlockNumber) (*rpcEpochInfo, error) {
+	header, err := api.header(number)
+	if err != nil {
+		return nil, err
+	}
+	snap, headerExtra, err := api.loadSnapshotAt(header)
+	if err != nil {
+		return nil, err
+	}
+	config, err := api.equality.chainConfig(header)
+	if err != nil {
+		return nil, err
+	}
+
+	// No validators are elected before the first epoch, only missing state fails
+	validators, err := snap.GetValidators()
+	var missing *trie.MissingNodeError
+	if errors.As(err, &missing) {
+		return nil, missingState("epoch", headerExtra.Root.EpochHash, header, err)
+	}
+	if config.IsShuffle(new(big.Int).Add(header.Number, common.Big1)) {
+		validators = shuffleValidators(validators, epochSeed(headerExtra))
+	}
+	counts, err := snap.MintCounts(headerExtra.Epoch)
+	if err != nil {
+		return nil, missingState("mint count", headerExtra.Root.MintCntHash, header, err)
+	}
+	candidates, err := snap.GetCandidates()
+	if err != nil {
+		return nil, missingState("candidate", headerExtra.Root.CandidateHash, header, err)
+	}
+	length, err := snap.GetEpochLength(config)
+	if err != nil {
+		return nil, missingState("config", headerExtra.Root.ConfigHash, header, err)
+	}
+
+	result := &rpcEpochInfo{
+		BlockNumber:       hexutil.Uint64(header.Number.Uint64()),
+		Epoch:             hexutil.Uint64(headerExtra.Epoch),
+		EpochBlock:        hexutil.Uint64(headerExtra.EpochBlock),
+		NextElectionBlock: hexutil.Uint64(headerExtra.EpochBlock + length),
+		Validators:        make([]rpcValidator, 0, len(validators)),
+		Candidates:        make([]common.Address, 0, len(candidates)),
+	}
+	for _, validator := range validators {
+		count := new(big.Int).SetUint64(counts[validator])
+		result.Validators = append(result.Validators, rpcValidator{Address: validator, CountMinted: count})
+	}
+	for address, candidate := range candidates {
+		if !candidate.Exiting {
+			result.Candidates = append(result.Candidates, address)
+		}
+	}
+	result.Candidates = addressesSort(result.Candidates)
+	return result, nil
+}
+
+// GetSnapshot retrieves the consensus state at specified block: the validators
+// in the sealing order of the following block, the signers of the recent
+// blocks none of which may seal it, the number of candidates, the epoch and
+// the trie roots of the snapshot
+func (api *API) GetSnapshot(number *rpc.BlockNumber) (*rpcSnapshot, error) {
+	header, err := api.header(number)
+	if err != nil {
+		return nil, err
+	}
+	return api.snapshotAt(header)
+}
+
+// GetSnapshotAtHash retrieves the consensus state at specified block hash
+func (api *API) GetSnapshotAtHash(hash common.Hash) (*rpcSnapshot, error) {
+	header := api.chain.GetHeaderByHash(hash)
+	if header == nil {
+		return nil, errUnknownBlock
+	}
+	return api.snapshotAt(header)
+}
+
+// snapshotAt retrieves the consensus state at specified header
+func (api *API) snapshotAt(header *types.Header) (*rpcSnapshot, error) {
+	snap, headerExtra, err := api.loadSnapshotAt(header)
+	if err != nil {
+		return nil, err
+	}
+	config, err := api.equality.chainConfig(header)
+	if err != nil {
+		return nil, err
+	}
+	validators, err := api.equality.sealingValidators(config, header)
+	if err != nil {
+		return nil, missingState("epoch", headerExtra.Root.EpochHash, header, err)
+	}
+	candidates, err := snap.GetCandidates()
+	if err != nil {
+		return nil, missingState("candidate", headerExtra.Root.CandidateHash, header, err)
+	}
+
+	// The recent blocks are walked back along the chain, as the verification does
+	recents := make(map[hexutil.Uint64]common.Address)
+	for parent, i := header, uint64(0); i < recentLimit(validators) && parent.Number.Uint64() > 0; i++ {
+		signer, err := api.equality.headerValidator(config, parent)
+		if err != nil {
+			return nil, err
+		}
+		recents[hexutil.Uint64(parent.Number.Uint64())] = signer
+		if i+1 == recentLimit(validators) {
+			break
+		}
+		if parent = api.chain.GetHeader(parent.ParentHash, parent.Number.Uint64()-1); parent == nil {
+			return nil, consensus.ErrUnknownAncestor
+		}
+	}
+
+	return &rpcSnapshot{
+		Number:          hexutil.Uint64(header.Number.Uint64()),
+		Hash:            header.Hash(),
+		Epoch:           hexutil.Uint64(headerExtra.Epoch),
+		EpochBlock:      hexutil.Uint64(headerExtra.EpochBlock),
+		Validators:      validators,
+		Recents:         recents,
+		CandidatesCount: len(candidates),
+		Root:            headerExtra.Root,
+	}, nil
+}
+
+// GetSealerSchedule retrieves the expected in turn sealers of the lookahead
+// blocks following the specified block and their estimated timestamps, a
+// period apart from the earliest timestamp of the first one, or from now if
+// later and the block is the latest. The sealers of the blocks following the
+// next epoch transition are unknown, they are elected there
+func (api *API) GetSealerSchedule(number *rpc.BlockNumber, lookahead uint64) (*rpcSealerSchedule, error) {
+	if lookahead == 0 {
+		return nil, fmt.Errorf("%w: lookahead of 0 blocks", errInvalidBlockRange)
+	}
+	if lookahead > maxSealerScheduleBlocks {
+		return nil, fmt.Errorf("%w: %d blocks requested, at most %d allowed", errBlockRangeTooLarge, lookahead, maxSealerScheduleBlocks)
+	}
+	header, err := api.header(number)
+	if err != nil {
+		return nil, err
+	}
+	var now uint64
+	if head := api.chain.CurrentHeader(); head != nil && head.Hash() == header.Hash() {
+		now = uint64(time.Now().Unix())
+	}
+	slots, err := api.equality.sealerSchedule(header, lookahead, now)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &rpcSealerSchedule{
+		BlockNumber: hexutil.Uint64(header.Number.Uint64()),
+		Slots:       make([]rpcSealerSlot, 0, len(slots)),
+	}
+	for _, slot := range slots {
+		entry := rpcSealerSlot{Number: hexutil.Uint64(slot.Number), Time: hexutil.Uint64(slot.Time), Known: slot.Known}
+		if slot.Known {
+			validator := slot.Validator
+			entry.Validator = &validator
+		}
+		result.Slots = append(result.Slots, entry)
+	}
+	return result, nil
+}
+
+// GetValidatorsByEpoch retrieves the validators elected for the epoch and its
+// transition block on the canonical chain, answered from the epoch index
+// which is brought up to the current head if the epoch is not indexed yet
+func (api *API) GetValidatorsByEpoch(epoch uint64) (*rpcEpochValidators, error) {
+	head := api.chain.CurrentHeader()
+	if head == nil {
+		return nil, errUnknownBlock
+	}
+	index, err := api.equality.epochValidators(api.chain, head, epoch)
+	if err != nil {
+		return nil, err
+	}
+	if index == nil {
+		return nil, fmt.Errorf("%w: epoch %d not reached", errInvalidEpochRange, epoch)
+	}
+	return &rpcEpochValidators{
+		Epoch:       hexutil.Uint64(epoch),
+		BlockNumber: hexutil.Uint64(index.Number),
+		Hash:        index.Hash,
+		Validators:  index.Validators,
+	}, nil
+}
+
+// ExplainElection re-runs the election of the transition block of the epoch on
+// the canonical chain and returns its decision trail: the candidates left after
+// the exiting ones, the mint counts of the previous validators with the
+// thresholds they are kicked out below, the kick out decisions, the seed and
+// the validators elected. The replay runs on a copy of the snapshot of the
+// parent block, consistent reports whether it elects the validators and kicks
+// out the candidates of the block
+func (api *DebugAPI) ExplainElection(epoch uint64) (*rpcElection, error) {
+	head := api.chain.CurrentHeader()
+	if head == nil {
+		return nil, errUnknownBlock
+	}
+	index, err := api.equality.epochValidators(api.chain, head, epoch)
+	if err != nil {
+		return nil, err
+	}
+	if index == nil {
+		return nil, fmt.Errorf("%w: epoch %d not reached", errInvalidEpochRange, epoch)
+	}
+	header := api.chain.GetHeader(index.Hash, index.Number)
+	if header == nil {
+		return nil, errUnknownBlock
+	}
+	trail, consistent, err := api.equality.replayElection(api.chain, header)
+	if err != nil {
+		return nil, err
+	}
+	return &rpcElection{Hash: header.Hash(), Consistent: consistent, electionTrail: trail}, nil
+}
+
+// GetKickOutHistory retrieves the kick outs of the validator in the epochs the
+// history is kept for on the canonical chain, the latest first and at most
+// limit of them if positive: the epoch and its transition block, the blocks
+// the validator minted in the previous epoch out of the ones it was scheduled
+// for and the threshold it fell below
+func (api *API) GetKickOutHistory(address common.Address, limit int) ([]rpcKickOut, error) {
+	head := api.chain.CurrentHeader()
+	if head == nil {
+		return nil, errUnknownBlock
+	}
+	histories, err := api.equality.kickOuts(api.chain, head, address, limit)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]rpcKickOut, 0, len(histories))
+	for _, history := range histories {
+		event := history.KickOuts[0]
+		result = append(result, rpcKickOut{
+			Epoch:       hexutil.Uint64(history.Epoch),
+			BlockNumber: hexutil.Uint64(history.Number),
+			Hash:        history.Hash,
+			Minted:      hexutil.Uint64(event.Minted),
+			Scheduled:   hexutil.Uint64(event.Scheduled),
+			MinMinted:   hexutil.Uint64(event.MinMinted),
+		})
+	}
+	return result, nil
+}
+
+// SignCheckpoint signs the specified block, the final block of an epoch, as
+// its checkpoint with the local validator. The transaction is the data of a
+// checkpoint transaction relaying the signature to the transition block of the
+// next epoch, which attests the checkpoint once signed by two thirds of the
+// validators. Signing with the validator key is restricted to the admin
+// namespace
+func (api *AdminAPI) SignCheckpoint(number rpc.BlockNumber) (*rpcCheckpointSignature, error) {
+	header, err := (&API{chain: api.chain, equality: api.equality}).header(&number)
+	if err != nil {
+		return nil, err
+	}
+	signer, signature, err := api.equality.SignCheckpoint(header)
+	if err != nil {
+		return nil, err
+	}
+	return &rpcCheckpointSignature{
+		Number:      hexutil.Uint64(header.Number.Uint64()),
+		Hash:        header.Hash(),
+		Signer:      signer,
+		Signature:   signature,
+		Transaction: "equality:1:event:checkpoint:" + hexutil.Encode(signature),
+	}, nil
+}
+
+// GenerateCheckpoint generates the trusted checkpoint of the specified block:
+// its hash, epoch, validators and snapshot tries. Loaded at startup, the
+// headers up to the checkpoint are trusted without verification
+func (api *AdminAPI) GenerateCheckpoint(number *rpc.BlockNumber) (*TrustedCheckpoint, error) {
+	header, err := (&API{chain: api.chain, equality: api.equality}).header(number)
+	if err != nil {
+		return nil, err
+	}
+	return api.equality.GenerateTrustedCheckpoint(header)
+}
+
+// GetFinalizedCheckpoint retrieves the latest checkpoint attested on the
+// canonical chain up to the specified block, the transition block carrying it
+// and the validators that signed it, nil if none. The blocks up to the
+// checkpoint are final
+func (api *API) GetFinalizedCheckpoint(number *rpc.BlockNumber) (*rpcCheckpoint, error) {
+	header, err := api.header(number)
+	if err != nil {
+		return nil, err
+	}
+	transition, checkpoint, err := api.equality.latestCheckpoint(api.chain, header)
+	if err != nil || checkpoint == nil {
+		return nil, err
+	}
+	signers, err := checkpoint.Signers()
+	if err != nil {
+		return nil, err
+	}
+	return &rpcCheckpoint{
+		Number:      hexutil.Uint64(checkpoint.Number),
+		Hash:        checkpoint.Hash,
+		BlockNumber: hexutil.Uint64(transition.Number.Uint64()),
+		BlockHash:   transition.Hash(),
+		Signers:     signers,
+	}, nil
+}
+
+// IsFinal reports whether the specified block of the canonical chain is final,
+// at or before the latest checkpoint attested up to the current head
+func (api *API) IsFinal(number rpc.BlockNumber) (bool, error) {
+	header, err := api.header(&number)
+	if err != nil {
+		return false, err
+	}
+	_, checkpoint, err := api.equality.latestCheckpoint(api.chain, api.chain.CurrentHeader())
+	if err != nil || checkpoint == nil {
+		return false, err
+	}
+	return header.Number.Uint64() <= checkpoint.Number, nil
+}
+
+// GetFinalizedBlock retrieves the finalized block of the current head, the
+// latest block more than two thirds of the validators of its epoch sealed
+// blocks on top of, the genesis block if none
+func (api *API) GetFinalizedBlock() (*rpcFinalizedBlock, error) {
+	head := api.chain.CurrentHeader()
+	if head == nil {
+		return nil, errUnknownBlock
+	}
+	finalized, err := api.equality.finalize(api.chain, head)
+	if err != nil {
+		return nil, err
+	}
+	return &rpcFinalizedBlock{Number: hexutil.Uint64(finalized.number), Hash: finalized.hash}, nil
+}
+
+// ConsensusMismatches retrieves the fields the blocks failing to import differ
+// from the locally computed values in, aggregated by field and values, the
+// most recently seen first: the check failing, the blocks counted, the first
+// and last of them and the unix times they were seen at
+func (api *AdminAPI) ConsensusMismatches() []rpcConsensusMismatch {
+	mismatches := api.equality.mismatches.recent()
+	result := make([]rpcConsensusMismatch, 0, len(mismatches))
+	for _, mismatch := range mismatches {
+		result = append(result, rpcConsensusMismatch{
+			Source:      mismatch.source,
+			Field:       mismatch.key.field,
+			Ours:        mismatch.key.ours,
+			Theirs:      mismatch.key.theirs,
+			Count:       hexutil.Uint64(mismatch.count),
+			FirstNumber: hexutil.Uint64(mismatch.first),
+			LastNumber:  hexutil.Uint64(mismatch.last),
+			LastHash:    mismatch.lastHash,
+			FirstSeen:   hexutil.Uint64(mismatch.firstSeen.Unix()),
+			LastSeen:    hexutil.Uint64(mismatch.lastSeen.Unix()),
+		})
+	}
+	return result
+}
+
+// GetFaults retrieves the fault records of the blocks failing the equality
+// verification, the latest first and at most limit of them if positive: the
+// block, the rule it violated, the addresses offending it, the fields it
+// differs from the locally computed values in and the unix time it was
+// recorded at
+func (api *AdminAPI) GetFaults(limit int) []rpcFault {
+	faults := api.equality.faults.faults(limit)
+	result := make([]rpcFault, 0, len(faults))
+	for _, fault := range faults {
+		fields := make([]rpcFaultField, 0, len(fault.Fields))
+		for _, field := range fault.Fields {
+			fields = append(fields, rpcFaultField(field))
+		}
+		addresses := fault.Addresses
+		if addresses == nil {
+			addresses = []common.Address{}
+		}
+		result = append(result, rpcFault{
+			Sequence:    hexutil.Uint64(fault.Sequence),
+			BlockNumber: hexutil.Uint64(fault.Number),
+			Hash:        fault.Hash,
+			Rule:        fault.Rule,
+			Reason:      fault.Reason,
+			Addresses:   addresses,
+			Fields:      fields,
+			Time:        hexutil.Uint64(fault.Time),
+		})
+	}
+	return result
+}
+
+// GetValidatorStats retrieves the performance of the validator in the epochs
+// from and to inclusive, at most 100 of them, in ascending order. An epoch
+// reports the blocks sealed by the validator as recorded in the mint count
+// trie, or the epoch index once compacted out of it, the blocks expected from
+// its share of the epoch, whether it was kicked out at the following transition
+// and the coinbase rewards of its blocks under the chain config in effect at
+// the start of the epoch. Epochs the address was not a validator of are
+// reported inactive with zeros.
+func (api *API) GetValidatorStats(address common.Address, from, to uint64) (*rpcValidatorStats, error) {
+	if from == 0 || from > to {
+		return nil, fmt.Errorf("%w: from epoch %d, to epoch %d", errInvalidEpochRange, from, to)
+	}
+	if count := to - from + 1; count > maxValidatorStatsEpochs {
+		return nil, fmt.Errorf("%w: %d epochs requested, at most %d allowed", errEpochRangeTooLarge, count, maxValidatorStatsEpochs)
+	}
+
+	head := api.chain.CurrentHeader()
+	if head == nil {
+		return nil, errUnknownBlock
+	}
+	last := head
+	lastExtra, err := api.equality.DecodeHeaderExtraCached(last)
+	if err != nil {
+		return nil, err
+	}
+	if to > lastExtra.Epoch {
+		return nil, fmt.Errorf("%w: epoch %d not reached, current epoch %d", errInvalidEpochRange, to, lastExtra.Epoch)
+	}
+	snap, err := api.equality.snapshot(api.chain, head, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &rpcValidatorStats{
+		Address: address,
+		Rewards: (*math.HexOrDecimal256)(new(big.Int)),
+		Epochs:  make([]rpcEpochStats, to-from+1),
+	}
+	// The epochs are walked back from the current one, the kick outs of an
+	// epoch are recorded by the transition of the next one
+	var kickOuts []common.Address
+	for {
+		epoch := lastExtra.Epoch
+		if lastExtra.EpochBlock == 0 || lastExtra.EpochBlock > last.Number.Uint64() {
+			return nil, errUnknownBlock
+		}
+		first := api.chain.GetHeaderByNumber(lastExtra.EpochBlock)
+		if first == nil {
+			return nil, errUnknownBlock
+		}
+		firstExtra, err := api.equality.DecodeHeaderExtraCached(first)
+		if err != nil {
+			return nil, err
+		}
+		parent := api.chain.GetHeader(first.ParentHash, first.Number.Uint64()-1)
+		if parent == nil {
+			return nil, errUnknownBlock
+		}
+
+		if epoch <= to {
+			stats := rpcEpochStats{
+				Epoch:      hexutil.Uint64(epoch),
+				FirstBlock: hexutil.Uint64(first.Number.Uint64()),
+				LastBlock:  hexutil.Uint64(last.Number.Uint64()),
+				Inactive:   !addressesExist(firstExtra.CurrentEpochValidators, address),
+				KickedOut:  addressesExist(kickOuts, address),
+				Rewards:    (*math.HexOrDecimal256)(new(big.Int)),
+			}
+			if !stats.Inactive {
+				config, err := api.equality.chainConfig(parent)
+				if err != nil {
+					return nil, err
+				}
+				minted, err := api.equality.mintedBlocks(api.chain, head, snap, epoch)
+				if err != nil {
+					return nil, missingState("mint count", snap.root.MintCntHash, head, err)
+				}
+				var numbers []uint64
+				for _, block := range minted {
+					if block.Validator == address {
+						numbers = append(numbers, block.Number)
+					}
+				}
+				blocks := last.Number.Uint64() - first.Number.Uint64() + 1
+				stats.Sealed = hexutil.Uint64(len(numbers))
+				stats.Expected = hexutil.Uint64(blocks / uint64(len(firstExtra.CurrentEpochValidators)))
+
+				rewards := (*big.Int)(stats.Rewards)
+				for _, number := range numbers {
+					if reward := blockReward(config, number); reward != nil && reward.Sign() > 0 {
+						base, _ := sealerReward(config, reward)
+						rewards.Add(rewards, base)
+					}
+				}
+			}
+			if stats.KickedOut {
+				result.KickOuts++
+			}
+			result.Sealed += stats.Sealed
+			result.Expected += stats.Expected
+			(*big.Int)(result.Rewards).Add((*big.Int)(result.Rewards), (*big.Int)(stats.Rewards))
+			result.Epochs[epoch-from] = stats
+		}
+
+		if epoch <= from {
+			return result, nil
+		}
+		kickOuts = firstExtra.CurrentBlockKickOutCandidates
+		if last = parent; last.Number.Uint64() == 0 {
+			return nil, errUnknownBlock
+		}
+		if lastExtra, err = api.equality.DecodeHeaderExtraCached(last); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// epochValidators retrieves the validators elected by the epoch transition
+// header of the epoch headerExtra belongs to
+func (api *API) epochValidators(headerExtra HeaderExtra) ([]common.Address, error) {
+	header := api.chain.GetHeaderByNumber(headerExtra.EpochBlock)
+	if header == nil {
+		return nil, errUnknownBlock
+	}
+
+	epochHeaderExtra, err := api.equality.DecodeHeaderExtraCached(header)
+	if err != nil {
+		return nil, err
+	}
+	if epochHeaderExtra.Epoch != headerExtra.Epoch || len(epochHeaderExtra.CurrentEpochValidators) == 0 {
+		return nil, errUnknownBlock
+	}
+	return epochHeaderExtra.CurrentEpochValidators, nil
+}
+
+// GetMintCount retrieves the number of blocks minted by each validator in the
+// epoch at specified block, the epoch of the block if none requested. A past
+// epoch compacted out of the snapshot is answered from the epoch index
+func (api *API) GetMintCount(number *rpc.BlockNumber, epoch *uint64) (map[common.Address]uint64, error) {
+	header, err := api.header(number)
+	if err != nil {
+		return nil, err
+	}
+	snap, headerExtra, err := api.loadSnapshotAt(header)
+	if err != nil {
+		return nil, err
+	}
+
+	if epoch == nil {
+		epoch = &headerExtra.Epoch
+	}
+	counts, err := snap.MintCounts(*epoch)
+	if err != nil {
+		return nil, missingState("mint count", headerExtra.Root.MintCntHash, header, err)
+	}
+	if len(counts) == 0 && *epoch < headerExtra.Epoch {
+		// The past epochs compacted out of the mint count trie are recorded
+		// along the epoch index
+		blocks, err := api.equality.mintedBlocks(api.chain, api.chain.CurrentHeader(), snap, *epoch)
+		if err != nil {
+			return nil, err
+		}
+		for _, block := range blocks {
+			counts[block.Validator]++
+		}
+	}
+	return counts, nil
+}
+
+// newTrieProof returns the rpc representation of a trie proof at header.
+func newTrieProof(address common.Address, header *types.Header, root common.Hash, key, value []byte, proof [][]byte) *rpcTrieProof {
+	result := &rpcTrieProof{
+		Address:     address,
+		BlockNumber: hexutil.Uint64(header.Number.Uint64()),
+		Root:        root,
+		Key:         key,
+		Value:       value,
+		Proof:       make([]string, 0, len(proof)),
+	}
+	for _, node := range proof {
+		result.Proof = append(result.Proof, hexutil.Encode(node))
+	}
+	return result
+}
+
+// GetCandidateProof retrieves the merkle proof of the candidate entry of the
+// address against the candidate trie root of specified block, the value being
+// the rlp encoded candidate. An address not being a candidate gets the proof
+// of its absence with an empty value
+func (api *API) GetCandidateProof(address common.Address, number *rpc.BlockNumber) (*rpcTrieProof, error) {
+	header, err := api.header(number)
+	if err != nil {
+		return nil, err
+	}
+	snap, headerExtra, err := api.loadSnapshotAt(header)
+	if err != nil {
+		return nil, err
+	}
+
+	key, value, proof, err := snap.ProveCandidate(address)
+	if err != nil {
+		return nil, missingState("candidate", headerExtra.Root.CandidateHash, header, err)
+	}
+	return newTrieProof(address, header, headerExtra.Root.CandidateHash, key, value, proof), nil
+}
+
+// GetMintCountProof retrieves the merkle proof of the mint count entry of
+// specified block against its mint count trie root, the value being the
+// address of the validator sealing the block. The proof verifies with the
+// address as value only if the address sealed the block
+func (api *API) GetMintCountProof(address common.Address, number *rpc.BlockNumber) (*rpcTrieProof, error) {
+	header, err := api.header(number)
+	if err != nil {
+		return nil, err
+	}
+	snap, headerExtra, err := api.loadSnapshotAt(header)
+	if err != nil {
+		return nil, err
+	}
+
+	key, value, proof, err := snap.ProveMintBlock(headerExtra.Epoch, header.Number.Uint64())
+	if err != nil {
+		return nil, missingState("mint count", headerExtra.Root.MintCntHash, header, err)
+	}
+	return newTrieProof(address, header, headerExtra.Root.MintCntHash, key, value, proof), nil
+}
+
+// GetConfig retrieves the chain config in effect for specified block, which is
+// the config recorded in the trie of its parent. The recorded field is false if
+// no config was ever recorded and the genesis config of the node applies, the
+// pending field holds the config scheduled to take effect at a later block
+func (api *API) GetConfig(number *rpc.BlockNumber) (*rpcChainConfig, error) {
+	var header *types.Header
+	pending := number != nil && *number == rpc.PendingBlockNumber
+	if pending {
+		header = api.equality.pendingHeader()
+	}
+	mined := header != nil
+	if !mined {
+		if pending {
+			number = nil
+		}
+		var err error
+		if header, err = api.header(number); err != nil {
+			return nil, err
+		}
+	}
+
+	// The pending block follows the current header if not mining
+	parent := header
+	blockNumber := header.Number.Uint64() + 1
+	if !pending || mined {
+		blockNumber = header.Number.Uint64()
+		parent = nil
+		if blockNumber > 0 {
+			if parent = api.chain.GetHeader(header.ParentHash, blockNumber-1); parent == nil {
+				return nil, errUnknownBlock
+			}
+		}
+	}
+
+	result := &rpcChainConfig{BlockNumber: hexutil.Uint64(blockNumber), Config: *api.equality.config}
+	if parent == nil || parent.Number.Uint64() == 0 {
+		return result, nil
+	}
+	headerExtra, err := api.equality.DecodeHeaderExtraCached(parent)
+	if err != nil {
+		return nil, err
+	}
+	if headerExtra.Root.ConfigHash == (common.Hash{}) {
+		return result, nil
+	}
+
+	snap := api.equality.snapshots.open(headerExtra.Root)
+	result.Config, err = snap.GetChainConfig()
+	if err != nil {
+		return nil, missingState("config", headerExtra.Root.ConfigHash, parent, err)
+	}
+	result.Recorded = true
+	if result.Pending, err = snap.GetPendingChainConfig(); err != nil {
+		return nil, missingState("config", headerExtra.Root.ConfigHash, parent, err)
+	}
+	return result, nil
+}
+
+// GetVanity retrieves the vanity of the headers prepared by the engine, nil
+// if the vanity of the miner extra data is kept
+func (api *API) GetVanity() hexutil.Bytes {
+	return api.equality.Vanity()
+}
+
+// GetHeaderExtra retrieves the decoded header extra at specified block
+func (api *API) GetHeaderExtra(number *rpc.BlockNumber) (*HeaderExtraJSON, error) {
+	header, err := api.header(number)
+	if err != nil {
+		return nil, err
+	}
+
+	headerExtra, err := api.equality.DecodeHeaderExtraCached(header)
+	if err != nil {
+		return nil, err
+	}
+	return headerExtra.JSON(), nil
+}
+
+// GetHeaderExtraRange retrieves the decoded header extras of the blocks from
+// and to inclusive, at most 1024 of them. The headers are walked back from the
+// last block, so the entries form a chain even if it is reorged meanwhile
+func (api *API) GetHeaderExtraRange(from, to rpc.BlockNumber) ([]rpcHeaderExtra, error) {
+	last, err := api.header(&to)
+	if err != nil {
+		return nil, err
+	}
+	first, err := api.header(&from)
+	if err != nil {
+		return nil, err
+	}
+
+	start, end := first.Number.Uint64(), last.Number.Uint64()
+	if start > end {
+		return nil, fmt.Errorf("%w: from block %d follows to block %d", errInvalidBlockRange, start, end)
+	}
+	if count := end - start + 1; count > maxHeaderExtraRange {
+		return nil, fmt.Errorf("%w: %d blocks requested, at most %d allowed", errBlockRangeTooLarge, count, maxHeaderExtraRange)
+	}
+
+	result := make([]rpcHeaderExtra, end-start+1)
+	for header := last; ; {
+		number := header.Number.Uint64()
+		headerExtra, err := api.equality.DecodeHeaderExtraCached(header)
+		if err != nil {
+			return nil, fmt.Errorf("block %d: %w", number, err)
+		}
+		result[number-start] = rpcHeaderExtra{
+			Number:      hexutil.Uint64(number),
+			Hash:        header.Hash(),
+			HeaderExtra: headerExtra.JSON(),
+		}
+		if number == start {
+			break
+		}
+		if header = api.chain.GetHeader(header.ParentHash, number-1); header == nil {
+			return nil, errUnknownBlock
+		}
+	}
+	return result, nil
+}
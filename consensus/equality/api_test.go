@@ -0,0 +1,692 @@
+package equality
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/SecretBlockChain/go-secret/common"
+	"github.com/SecretBlockChain/go-secret/common/hexutil"
+	"github.com/SecretBlockChain/go-secret/common/math"
+	"github.com/SecretBlockChain/go-secret/core/rawdb"
+	"github.com/SecretBlockChain/go-secret/core/types"
+	"github.com/SecretBlockChain/go-secret/crypto"
+	"github.com/SecretBlockChain/go-secret/ethdb"
+	"github.com/SecretBlockChain/go-secret/params"
+	"github.com/SecretBlockChain/go-secret/rpc"
+	"github.com/stretchr/testify/assert"
+)
+
+// testHeaderChain is an in-memory consensus.ChainHeaderReader.
+type testHeaderChain struct {
+	config  *params.ChainConfig
+	headers []*types.Header
+}
+
+func (chain *testHeaderChain) Config() *params.ChainConfig { return chain.config }
+
+func (chain *testHeaderChain) CurrentHeader() *types.Header {
+	if len(chain.headers) == 0 {
+		return nil
+	}
+	return chain.headers[len(chain.headers)-1]
+}
+
+func (chain *testHeaderChain) GetHeader(hash common.Hash, number uint64) *types.Header {
+	header := chain.GetHeaderByNumber(number)
+	if header == nil || header.Hash() != hash {
+		return nil
+	}
+	return header
+}
+
+func (chain *testHeaderChain) GetHeaderByNumber(number uint64) *types.Header {
+	if number >= uint64(len(chain.headers)) {
+		return nil
+	}
+	return chain.headers[number]
+}
+
+func (chain *testHeaderChain) GetHeaderByHash(hash common.Hash) *types.Header {
+	for _, header := range chain.headers {
+		if header.Hash() == hash {
+			return header
+		}
+	}
+	return nil
+}
+
+// newTestAPI returns an API over a header chain carrying the header extras,
+// one block per header extra starting at genesis.
+func newTestAPI(db ethdb.Database, headerExtras ...HeaderExtra) *API {
+	chain := &testHeaderChain{config: params.TestnetChainConfig}
+	for number, headerExtra := range headerExtras {
+		header := newTestHeader(uint64(number), headerExtra)
+		if number > 0 {
+			header.ParentHash = chain.headers[number-1].Hash()
+		}
+		chain.headers = append(chain.headers, header)
+	}
+	return &API{chain: chain, equality: New(params.TestnetEqualityConfig(), db)}
+}
+
+func TestGetHeaderExtra(t *testing.T) {
+	headerExtra := HeaderExtra{Epoch: 1, EpochBlock: 1}
+	api := newTestAPI(rawdb.NewMemoryDatabase(), headerExtra, headerExtra, headerExtra)
+
+	for _, number := range []rpc.BlockNumber{rpc.LatestBlockNumber, rpc.PendingBlockNumber, 2} {
+		result, err := api.GetHeaderExtra(&number)
+		assert.Nil(t, err)
+		assert.Equal(t, uint64(1), uint64(result.Epoch))
+	}
+	result, err := api.GetHeaderExtra(nil)
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(1), uint64(result.EpochBlock))
+
+	unknown := rpc.BlockNumber(3)
+	_, err = api.GetHeaderExtra(&unknown)
+	assert.Equal(t, errUnknownBlock, err)
+
+	var namespaces []string
+	for _, api := range api.equality.APIs(api.chain) {
+		namespaces = append(namespaces, api.Namespace)
+	}
+	assert.Contains(t, namespaces, "equality")
+}
+
+func TestGetValidators(t *testing.T) {
+	db := rawdb.NewMemoryDatabase()
+	validator1 := common.HexToAddress("0x44d1ce0b7cb3588bca96151fe1bc05af38f91b6c")
+	validator2 := common.HexToAddress("0xcc7c8317b21e1cea6139700c3c46c21af998d14c")
+
+	snap, err := newSnapshot(db)
+	assert.Nil(t, err)
+	assert.Nil(t, snap.SetValidators([]common.Address{validator2, validator1}))
+	assert.Nil(t, snap.MintBlock(1, 1, validator2))
+	root, err := snap.Root()
+	assert.Nil(t, err)
+	assert.Nil(t, snap.Commit(root))
+
+	// Block 2 references a pruned epoch trie
+	pruned := root
+	pruned.EpochHash = common.HexToHash("0x01")
+	api := newTestAPI(db,
+		HeaderExtra{},
+		HeaderExtra{Root: root, Epoch: 1, EpochBlock: 1, CurrentEpochValidators: []common.Address{validator2, validator1}},
+		HeaderExtra{Root: pruned, Epoch: 1, EpochBlock: 1},
+	)
+
+	number := rpc.BlockNumber(1)
+	result, err := api.GetValidators(&number)
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(1), uint64(result.BlockNumber))
+	assert.Equal(t, uint64(1), uint64(result.Epoch))
+	assert.Equal(t, []rpcValidator{
+		{Address: validator2, CountMinted: big.NewInt(1)},
+		{Address: validator1, CountMinted: big.NewInt(0)},
+	}, result.Validators)
+
+	// Falls back to the validators of the epoch transition header
+	result, err = api.GetValidators(nil)
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(2), uint64(result.BlockNumber))
+	assert.Equal(t, []rpcValidator{{Address: validator2}, {Address: validator1}}, result.Validators)
+
+	// Missing without an epoch transition header to fall back to
+	api.chain.(*testHeaderChain).headers[1] = newTestHeader(1, HeaderExtra{Root: root, Epoch: 1, EpochBlock: 1})
+	_, err = api.GetValidators(nil)
+	assert.True(t, errors.Is(err, errMissingState))
+	assert.Contains(t, err.Error(), pruned.EpochHash.Hex())
+}
+
+func TestGetCandidates(t *testing.T) {
+	db := rawdb.NewMemoryDatabase()
+	snap, err := newSnapshot(db)
+	assert.Nil(t, err)
+
+	candidates := make([]common.Address, 0)
+	for i := 0; i < 5; i++ {
+		candidate := common.BigToAddress(big.NewInt(int64(i + 1)))
+		_, err = snap.BecomeCandidate(candidate, 1, big.NewInt(int64(i)))
+		assert.Nil(t, err)
+		candidates = append(candidates, candidate)
+	}
+	assert.Nil(t, snap.SetValidators(candidates[3:]))
+	exiting, err := snap.ExitCandidate(candidates[4])
+	assert.Nil(t, err)
+	assert.True(t, exiting)
+	root, err := snap.Root()
+	assert.Nil(t, err)
+	assert.Nil(t, snap.Commit(root))
+
+	pruned := root
+	pruned.CandidateHash = common.HexToHash("0x01")
+	api := newTestAPI(db, HeaderExtra{}, HeaderExtra{Root: root, Epoch: 1, EpochBlock: 1}, HeaderExtra{Root: pruned, Epoch: 1, EpochBlock: 1})
+
+	// Walk the pages with the cursor
+	number := rpc.BlockNumber(1)
+	limit := 2
+	var cursor *common.Address
+	var pages [][]rpcCandidate
+	for {
+		result, err := api.GetCandidates(&number, cursor, &limit)
+		assert.Nil(t, err)
+		assert.Equal(t, uint64(1), uint64(result.BlockNumber))
+		pages = append(pages, result.Candidates)
+		if cursor = result.Next; cursor == nil {
+			break
+		}
+	}
+	assert.Equal(t, 3, len(pages))
+	var seen []common.Address
+	for _, page := range pages {
+		for _, candidate := range page {
+			seen = append(seen, candidate.Address)
+			assert.Equal(t, addressesExist(candidates[3:], candidate.Address), candidate.IsValidator)
+			assert.Equal(t, candidate.Address == candidates[4], candidate.Exiting)
+		}
+	}
+	assert.Equal(t, candidates, seen)
+
+	// Without a limit all candidates fit into a page
+	result, err := api.GetCandidates(&number, nil, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, 5, len(result.Candidates))
+	assert.Nil(t, result.Next)
+
+	_, err = api.GetCandidates(nil, nil, nil)
+	assert.True(t, errors.Is(err, errMissingState))
+	assert.Contains(t, err.Error(), pruned.CandidateHash.Hex())
+}
+
+func TestGetCandidatesReorg(t *testing.T) {
+	db := rawdb.NewMemoryDatabase()
+	engine := New(params.TestnetEqualityConfig(), db)
+	genesis := []*types.Header{{Number: big.NewInt(0)}}
+	ancestors := extendTestChain(t, engine, genesis, 2, 0)
+	branches := [][]*types.Header{
+		extendTestChain(t, engine, ancestors, 3, 1000),
+		extendTestChain(t, engine, ancestors, 3, 2000),
+	}
+
+	// Switching the head between the competing branches serves the candidates
+	// registered on the head's branch only
+	chain := &testHeaderChain{config: params.TestnetChainConfig}
+	api := &API{chain: chain, equality: engine}
+	for _, head := range []int{0, 1, 0} {
+		chain.headers = branches[head]
+		result, err := api.GetCandidates(nil, nil, nil)
+		assert.Nil(t, err)
+
+		var have []common.Address
+		for _, candidate := range result.Candidates {
+			have = append(have, candidate.Address)
+		}
+		var want []common.Address
+		for _, header := range branches[head][1:] {
+			want = append(want, header.Coinbase)
+		}
+		assert.Equal(t, want, have, "head %d", head)
+	}
+}
+
+func TestGetMintCount(t *testing.T) {
+	db := rawdb.NewMemoryDatabase()
+	validator1 := common.HexToAddress("0x44d1ce0b7cb3588bca96151fe1bc05af38f91b6c")
+	validator2 := common.HexToAddress("0xcc7c8317b21e1cea6139700c3c46c21af998d14c")
+
+	snap, err := newSnapshot(db)
+	assert.Nil(t, err)
+	headerExtras := []HeaderExtra{{}}
+	mint := func(epoch, epochBlock uint64, validator common.Address) {
+		assert.Nil(t, snap.MintBlock(epoch, uint64(len(headerExtras)), validator))
+		root, err := snap.Root()
+		assert.Nil(t, err)
+		assert.Nil(t, snap.Commit(root))
+		headerExtras = append(headerExtras, HeaderExtra{Root: root, Epoch: epoch, EpochBlock: epochBlock})
+	}
+	mint(1, 1, validator1)
+	mint(1, 1, validator2)
+	mint(1, 1, validator1)
+	mint(2, 4, validator2)
+	api := newTestAPI(db, headerExtras...)
+
+	number := rpc.BlockNumber(3)
+	counts, err := api.GetMintCount(&number, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, map[common.Address]uint64{validator1: 2, validator2: 1}, counts)
+
+	// Counts restart at the epoch boundary
+	counts, err = api.GetMintCount(nil, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, map[common.Address]uint64{validator2: 1}, counts)
+
+	epoch := uint64(1)
+	counts, err = api.GetMintCount(nil, &epoch)
+	assert.Nil(t, err)
+	assert.Equal(t, map[common.Address]uint64{validator1: 2, validator2: 1}, counts)
+
+	epoch = 3
+	counts, err = api.GetMintCount(nil, &epoch)
+	assert.Nil(t, err)
+	assert.Empty(t, counts)
+}
+
+func TestGetTrieProofs(t *testing.T) {
+	db := rawdb.NewMemoryDatabase()
+	validator1 := common.HexToAddress("0x44d1ce0b7cb3588bca96151fe1bc05af38f91b6c")
+	validator2 := common.HexToAddress("0xcc7c8317b21e1cea6139700c3c46c21af998d14c")
+
+	snap, err := newSnapshot(db)
+	assert.Nil(t, err)
+	_, err = snap.BecomeCandidate(validator1, 1, big.NewInt(1000))
+	assert.Nil(t, err)
+	headerExtras := []HeaderExtra{{}}
+	for _, validator := range []common.Address{validator1, validator2, validator1} {
+		assert.Nil(t, snap.MintBlock(1, uint64(len(headerExtras)), validator))
+		root, err := snap.Root()
+		assert.Nil(t, err)
+		assert.Nil(t, snap.Commit(root))
+		headerExtras = append(headerExtras, HeaderExtra{Root: root, Epoch: 1, EpochBlock: 1})
+	}
+	api := newTestAPI(db, headerExtras...)
+	decode := func(proof []string) [][]byte {
+		nodes := make([][]byte, 0, len(proof))
+		for _, node := range proof {
+			nodes = append(nodes, hexutil.MustDecode(node))
+		}
+		return nodes
+	}
+
+	// The proof of a candidate and the exclusion proof of a non candidate
+	number := rpc.BlockNumber(2)
+	result, err := api.GetCandidateProof(validator1, &number)
+	assert.Nil(t, err)
+	assert.Equal(t, hexutil.Uint64(2), result.BlockNumber)
+	assert.Equal(t, headerExtras[2].Root.CandidateHash, result.Root)
+	assert.NotEmpty(t, result.Value)
+	assert.True(t, VerifyEqualityProof(result.Root, result.Key, result.Value, decode(result.Proof)))
+
+	result, err = api.GetCandidateProof(validator2, &number)
+	assert.Nil(t, err)
+	assert.Empty(t, result.Value)
+	assert.True(t, VerifyEqualityProof(result.Root, result.Key, nil, decode(result.Proof)))
+
+	// The mint count entry of a block proves its validator only
+	result, err = api.GetMintCountProof(validator2, &number)
+	assert.Nil(t, err)
+	assert.Equal(t, headerExtras[2].Root.MintCntHash, result.Root)
+	assert.True(t, VerifyEqualityProof(result.Root, result.Key, validator2.Bytes(), decode(result.Proof)))
+	assert.False(t, VerifyEqualityProof(result.Root, result.Key, validator1.Bytes(), decode(result.Proof)))
+
+	result, err = api.GetMintCountProof(validator1, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, hexutil.Uint64(3), result.BlockNumber)
+	assert.True(t, VerifyEqualityProof(result.Root, result.Key, validator1.Bytes(), decode(result.Proof)))
+
+	// The genesis block minted nothing
+	number = rpc.BlockNumber(0)
+	result, err = api.GetMintCountProof(validator1, &number)
+	assert.Nil(t, err)
+	assert.Empty(t, result.Value)
+	assert.True(t, VerifyEqualityProof(result.Root, result.Key, nil, decode(result.Proof)))
+}
+
+func TestGetEpochInfo(t *testing.T) {
+	db := rawdb.NewMemoryDatabase()
+	validatorA := common.HexToAddress("0xa000000000000000000000000000000000000000")
+	validatorB := common.HexToAddress("0xb000000000000000000000000000000000000000")
+	candidateC := common.HexToAddress("0xc000000000000000000000000000000000000000")
+
+	snap, err := newSnapshot(db)
+	assert.Nil(t, err)
+	for _, candidate := range []common.Address{candidateC, validatorB, validatorA} {
+		_, err = snap.BecomeCandidate(candidate, 1, big.NewInt(0))
+		assert.Nil(t, err)
+	}
+	_, err = snap.ExitCandidate(candidateC)
+	assert.Nil(t, err)
+	assert.Nil(t, snap.SetValidators([]common.Address{validatorB, validatorA}))
+	for number, minter := range []common.Address{validatorA, validatorA, validatorB} {
+		assert.Nil(t, snap.MintBlock(1, uint64(number+1), minter))
+	}
+	latest, err := snap.Root()
+	assert.Nil(t, err)
+	assert.Nil(t, snap.Commit(latest))
+
+	// The block being mined is sealed by B
+	assert.Nil(t, snap.MintBlock(1, 4, validatorB))
+	mined, err := snap.Root()
+	assert.Nil(t, err)
+	assert.Nil(t, snap.Commit(mined))
+
+	api := newTestAPI(db, HeaderExtra{}, HeaderExtra{Epoch: 1, EpochBlock: 1}, HeaderExtra{Epoch: 1, EpochBlock: 1},
+		HeaderExtra{Root: latest, Epoch: 1, EpochBlock: 1})
+	chain := api.chain.(*testHeaderChain)
+	pendingHeader := newTestHeader(4, HeaderExtra{Root: mined, Epoch: 1, EpochBlock: 1})
+	pendingHeader.ParentHash = chain.headers[3].Hash()
+	api.equality.SetPendingHeader(func() *types.Header { return pendingHeader })
+
+	pending := rpc.PendingBlockNumber
+	for _, test := range []struct {
+		number *rpc.BlockNumber
+		block  uint64
+		countB int64
+	}{
+		{nil, 3, 1},
+		{&pending, 4, 2},
+	} {
+		result, err := api.GetEpochInfo(test.number)
+		assert.Nil(t, err)
+		assert.Equal(t, &rpcEpochInfo{
+			BlockNumber:       hexutil.Uint64(test.block),
+			Epoch:             1,
+			EpochBlock:        1,
+			NextElectionBlock: 13,
+			Validators: []rpcValidator{
+				{Address: validatorB, CountMinted: big.NewInt(test.countB)},
+				{Address: validatorA, CountMinted: big.NewInt(2)},
+			},
+			Candidates: []common.Address{validatorA, validatorB},
+		}, result)
+	}
+}
+
+func TestGetSnapshot(t *testing.T) {
+	db := rawdb.NewMemoryDatabase()
+	keys := make([]*ecdsa.PrivateKey, 4)
+	validators := make([]common.Address, len(keys))
+	snap, err := newSnapshot(db)
+	assert.Nil(t, err)
+	for idx := range keys {
+		keys[idx], _ = crypto.GenerateKey()
+		validators[idx] = crypto.PubkeyToAddress(keys[idx].PublicKey)
+		_, err = snap.BecomeCandidate(validators[idx], 1, big.NewInt(0))
+		assert.Nil(t, err)
+	}
+	assert.Nil(t, snap.SetValidators(validators))
+	root, err := snap.Root()
+	assert.Nil(t, err)
+	assert.Nil(t, snap.Commit(root))
+
+	// Blocks 1 to 4 sealed by the validators in order
+	config := newTestTurnConfig(1)
+	headerExtra := HeaderExtra{Root: root, Epoch: 1, EpochBlock: 1}
+	chain := &testHeaderChain{config: params.TestnetChainConfig, headers: []*types.Header{{Number: big.NewInt(0), Time: config.GenesisTimestamp}}}
+	for _, key := range keys {
+		chain.headers = append(chain.headers, newTestTurnHeader(chain.CurrentHeader(), headerExtra, key, 1))
+	}
+	api := &API{chain: chain, equality: New(&config, db)}
+
+	// 4 validators keep the signers of the last 2 blocks out
+	result, err := api.GetSnapshot(nil)
+	assert.Nil(t, err)
+	assert.Equal(t, &rpcSnapshot{
+		Number:          4,
+		Hash:            chain.headers[4].Hash(),
+		Epoch:           1,
+		EpochBlock:      1,
+		Validators:      validators,
+		Recents:         map[hexutil.Uint64]common.Address{3: validators[2], 4: validators[3]},
+		CandidatesCount: 4,
+		Root:            root,
+	}, result)
+
+	// The recent blocks stop at genesis
+	result, err = api.GetSnapshotAtHash(chain.headers[1].Hash())
+	assert.Nil(t, err)
+	assert.Equal(t, hexutil.Uint64(1), result.Number)
+	assert.Equal(t, map[hexutil.Uint64]common.Address{1: validators[0]}, result.Recents)
+
+	_, err = api.GetSnapshotAtHash(common.Hash{1})
+	assert.Equal(t, errUnknownBlock, err)
+}
+
+func TestGetValidatorStats(t *testing.T) {
+	db := rawdb.NewMemoryDatabase()
+	validatorA := common.HexToAddress("0xa000000000000000000000000000000000000000")
+	validatorB := common.HexToAddress("0xb000000000000000000000000000000000000000")
+	validatorC := common.HexToAddress("0xc000000000000000000000000000000000000000")
+
+	// Epochs of 4 blocks, A is kicked out after the first one and elected again
+	// for the third one, in progress at block 10
+	minters := []common.Address{validatorA, validatorB, validatorA, validatorB, validatorB, validatorC, validatorB, validatorC, validatorA, validatorC}
+	snap, err := newSnapshot(db)
+	assert.Nil(t, err)
+	for idx, minter := range minters {
+		number := uint64(idx + 1)
+		assert.Nil(t, snap.MintBlock((number-1)/4+1, number, minter))
+	}
+	root, err := snap.Root()
+	assert.Nil(t, err)
+	assert.Nil(t, snap.Commit(root))
+
+	headerExtras := []HeaderExtra{{}}
+	for number := uint64(1); number <= 10; number++ {
+		epoch := (number-1)/4 + 1
+		headerExtra := HeaderExtra{Epoch: epoch, EpochBlock: (epoch-1)*4 + 1}
+		switch number {
+		case 1:
+			headerExtra.CurrentEpochValidators = []common.Address{validatorA, validatorB}
+		case 5:
+			headerExtra.CurrentBlockKickOutCandidates = []common.Address{validatorA}
+			headerExtra.CurrentEpochValidators = []common.Address{validatorB, validatorC}
+		case 9:
+			headerExtra.CurrentEpochValidators = []common.Address{validatorA, validatorC}
+		case 10:
+			headerExtra.Root = root
+		}
+		headerExtras = append(headerExtras, headerExtra)
+	}
+	api := newTestAPI(db, headerExtras...)
+
+	reward := func(blocks int64) *math.HexOrDecimal256 {
+		// The coinbase share of the testnet block reward of 2 ether
+		return (*math.HexOrDecimal256)(new(big.Int).Mul(big.NewInt(blocks), big.NewInt(2e17)))
+	}
+	result, err := api.GetValidatorStats(validatorA, 1, 3)
+	assert.Nil(t, err)
+	assert.Equal(t, []rpcEpochStats{
+		{Epoch: 1, FirstBlock: 1, LastBlock: 4, Sealed: 2, Expected: 2, KickedOut: true, Rewards: reward(2)},
+		{Epoch: 2, FirstBlock: 5, LastBlock: 8, Inactive: true, Rewards: reward(0)},
+		{Epoch: 3, FirstBlock: 9, LastBlock: 10, Sealed: 1, Expected: 1, Rewards: reward(1)},
+	}, result.Epochs)
+	assert.Equal(t, uint64(3), uint64(result.Sealed))
+	assert.Equal(t, uint64(3), uint64(result.Expected))
+	assert.Equal(t, uint64(1), uint64(result.KickOuts))
+	assert.Equal(t, reward(3), result.Rewards)
+
+	result, err = api.GetValidatorStats(validatorC, 2, 2)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(result.Epochs))
+	assert.Equal(t, uint64(2), uint64(result.Epochs[0].Sealed))
+
+	for _, test := range []struct {
+		from, to uint64
+		err      error
+	}{
+		{0, 1, errInvalidEpochRange},
+		{3, 2, errInvalidEpochRange},
+		{1, 4, errInvalidEpochRange},
+		{1, 101, errEpochRangeTooLarge},
+	} {
+		_, err = api.GetValidatorStats(validatorA, test.from, test.to)
+		assert.True(t, errors.Is(err, test.err), "from %d to %d: %v", test.from, test.to, err)
+	}
+}
+
+func TestGetConfig(t *testing.T) {
+	db := rawdb.NewMemoryDatabase()
+	config := *params.TestnetEqualityConfig()
+	config.Period = 7
+
+	snap, err := newSnapshot(db)
+	assert.Nil(t, err)
+	assert.Nil(t, snap.SetChainConfig(config))
+	root, err := snap.Root()
+	assert.Nil(t, err)
+	assert.Nil(t, snap.Commit(root))
+
+	pruned := root
+	pruned.ConfigHash = common.HexToHash("0x01")
+	api := newTestAPI(db, HeaderExtra{}, HeaderExtra{Epoch: 1, EpochBlock: 1}, HeaderExtra{Root: root, Epoch: 1, EpochBlock: 1}, HeaderExtra{Root: root, Epoch: 1, EpochBlock: 1})
+
+	// No config recorded before block 3
+	for _, number := range []rpc.BlockNumber{0, 1, 2} {
+		result, err := api.GetConfig(&number)
+		assert.Nil(t, err)
+		assert.Equal(t, uint64(number), uint64(result.BlockNumber))
+		assert.False(t, result.Recorded)
+		assert.True(t, result.Config.Equal(*params.TestnetEqualityConfig()))
+	}
+
+	number := rpc.BlockNumber(3)
+	result, err := api.GetConfig(&number)
+	assert.Nil(t, err)
+	assert.True(t, result.Recorded)
+	assert.Equal(t, uint64(7), result.Config.Period)
+
+	pending := rpc.PendingBlockNumber
+	result, err = api.GetConfig(&pending)
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(4), uint64(result.BlockNumber))
+	assert.Equal(t, uint64(7), result.Config.Period)
+
+	// Missing config trie is an error rather than the genesis config
+	chain := api.chain.(*testHeaderChain)
+	chain.headers = append(chain.headers, newTestHeader(4, HeaderExtra{Root: pruned, Epoch: 1, EpochBlock: 1}))
+	_, err = api.GetConfig(&pending)
+	assert.True(t, errors.Is(err, errMissingState))
+	assert.Contains(t, err.Error(), pruned.ConfigHash.Hex())
+}
+
+func TestPendingBlock(t *testing.T) {
+	db := rawdb.NewMemoryDatabase()
+	validator := common.HexToAddress("0x44d1ce0b7cb3588bca96151fe1bc05af38f91b6c")
+	candidate := common.HexToAddress("0xcc7c8317b21e1cea6139700c3c46c21af998d14c")
+
+	snap, err := newSnapshot(db)
+	assert.Nil(t, err)
+	_, err = snap.BecomeCandidate(validator, 1, big.NewInt(0))
+	assert.Nil(t, err)
+	assert.Nil(t, snap.SetValidators([]common.Address{validator}))
+	latest, err := snap.Root()
+	assert.Nil(t, err)
+	assert.Nil(t, snap.Commit(latest))
+
+	// The block being mined registers another candidate
+	_, err = snap.BecomeCandidate(candidate, 3, big.NewInt(0))
+	assert.Nil(t, err)
+	mined, err := snap.Root()
+	assert.Nil(t, err)
+	assert.Nil(t, snap.Commit(mined))
+
+	headerExtra := HeaderExtra{Root: latest, Epoch: 1, EpochBlock: 1, CurrentEpochValidators: []common.Address{validator}}
+	api := newTestAPI(db, HeaderExtra{}, headerExtra, HeaderExtra{Root: latest, Epoch: 1, EpochBlock: 1})
+	chain := api.chain.(*testHeaderChain)
+	pendingHeader := newTestHeader(3, HeaderExtra{Root: mined, Epoch: 1, EpochBlock: 1, CurrentBlockCandidates: []common.Address{candidate}})
+	pendingHeader.ParentHash = chain.headers[2].Hash()
+
+	var mining bool
+	api.equality.SetPendingHeader(func() *types.Header {
+		if !mining {
+			return nil
+		}
+		return pendingHeader
+	})
+
+	pending := rpc.PendingBlockNumber
+	for _, mining = range []bool{false, true} {
+		want := uint64(2)
+		addresses := []common.Address{validator}
+		if mining {
+			want, addresses = 3, []common.Address{validator, candidate}
+		}
+
+		candidates, err := api.GetCandidates(&pending, nil, nil)
+		assert.Nil(t, err)
+		assert.Equal(t, want, uint64(candidates.BlockNumber))
+		var seen []common.Address
+		for _, candidate := range candidates.Candidates {
+			seen = append(seen, candidate.Address)
+		}
+		assert.ElementsMatch(t, addresses, seen)
+
+		validators, err := api.GetValidators(&pending)
+		assert.Nil(t, err)
+		assert.Equal(t, want, uint64(validators.BlockNumber))
+		assert.Equal(t, []rpcValidator{{Address: validator, CountMinted: big.NewInt(0)}}, validators.Validators)
+
+		result, err := api.GetHeaderExtra(&pending)
+		assert.Nil(t, err)
+		assert.Equal(t, len(addresses)-1, len(result.CurrentBlockCandidates))
+
+		// The config in effect for the pending block is the one of its parent
+		config, err := api.GetConfig(&pending)
+		assert.Nil(t, err)
+		assert.Equal(t, uint64(3), uint64(config.BlockNumber))
+	}
+
+	// The latest block is unaffected by the block being mined
+	candidates, err := api.GetCandidates(nil, nil, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(candidates.Candidates))
+
+	// A header extra failing to decode falls back to the latest block
+	pendingHeader = &types.Header{Number: big.NewInt(3)}
+	result, err := api.GetValidators(&pending)
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(2), uint64(result.BlockNumber))
+}
+
+func TestGetHeaderExtraRange(t *testing.T) {
+	headerExtras := []HeaderExtra{{}}
+	for epoch := uint64(1); epoch <= 3; epoch++ {
+		headerExtras = append(headerExtras, HeaderExtra{Epoch: epoch, EpochBlock: epoch})
+	}
+	api := newTestAPI(rawdb.NewMemoryDatabase(), headerExtras...)
+	chain := api.chain.(*testHeaderChain)
+
+	result, err := api.GetHeaderExtraRange(1, rpc.LatestBlockNumber)
+	assert.Nil(t, err)
+	assert.Equal(t, 3, len(result))
+	for idx, entry := range result {
+		number := uint64(idx + 1)
+		assert.Equal(t, number, uint64(entry.Number))
+		assert.Equal(t, chain.headers[number].Hash(), entry.Hash)
+		assert.Equal(t, number, uint64(entry.HeaderExtra.Epoch))
+	}
+
+	result, err = api.GetHeaderExtraRange(2, 2)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(result))
+	assert.Equal(t, uint64(2), uint64(result[0].Number))
+
+	_, err = api.GetHeaderExtraRange(3, 2)
+	assert.True(t, errors.Is(err, errInvalidBlockRange))
+	_, err = api.GetHeaderExtraRange(1, 4)
+	assert.Equal(t, errUnknownBlock, err)
+
+	for number := uint64(len(chain.headers)); number <= maxHeaderExtraRange+1; number++ {
+		header := newTestHeader(number, HeaderExtra{Epoch: 3, EpochBlock: 3})
+		header.ParentHash = chain.headers[number-1].Hash()
+		chain.headers = append(chain.headers, header)
+	}
+	result, err = api.GetHeaderExtraRange(1, maxHeaderExtraRange)
+	assert.Nil(t, err)
+	assert.Equal(t, maxHeaderExtraRange, len(result))
+	_, err = api.GetHeaderExtraRange(0, maxHeaderExtraRange)
+	assert.True(t, errors.Is(err, errBlockRangeTooLarge))
+}
+
+func TestGetVanity(t *testing.T) {
+	api := newTestAPI(rawdb.NewMemoryDatabase(), HeaderExtra{})
+	assert.Nil(t, api.GetVanity())
+
+	api.equality.SetVanity([]byte("operator"))
+	vanity := api.GetVanity()
+	assert.Equal(t, ExtraVanity, len(vanity))
+	assert.Equal(t, "operator", string(bytes.TrimRight(vanity, "\x00")))
+}
@@ -0,0 +1,23 @@
+package equality
+
+import (
+	"github.com/SecretBlockChain/go-secret/common"
+	"github.com/SecretBlockChain/go-secret/params"
+)
+
+// candidateAccessRestricted returns whether the chain config restricts the
+// candidacy through its allow or deny list. The lists are changed by the config
+// proposals approved by a quorum of the validators.
+func candidateAccessRestricted(config params.EqualityConfig) bool {
+	return len(config.CandidateAllowList) > 0 || len(config.CandidateDenyList) > 0
+}
+
+// candidateBarred returns whether candidate is on the deny list of the chain
+// config, or missing in its allow list if not empty. A barred candidate may not
+// register, a registered one stays a candidate but is never elected.
+func candidateBarred(config params.EqualityConfig, candidate common.Address) bool {
+	if addressesExist(config.CandidateDenyList, candidate) {
+		return true
+	}
+	return len(config.CandidateAllowList) > 0 && !addressesExist(config.CandidateAllowList, candidate)
+}
@@ -0,0 +1,148 @@
+package equality
+
+import (
+	"crypto/ecdsa"
+	"encoding/json"
+	"math/big"
+	"testing"
+
+	"github.com/SecretBlockChain/go-secret/common"
+	"github.com/SecretBlockChain/go-secret/core/rawdb"
+	"github.com/SecretBlockChain/go-secret/core/state"
+	"github.com/SecretBlockChain/go-secret/core/types"
+	"github.com/SecretBlockChain/go-secret/crypto"
+	"github.com/SecretBlockChain/go-secret/params"
+	"github.com/SecretBlockChain/go-secret/rpc"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCandidateBarred(t *testing.T) {
+	allowed, denied, other := common.HexToAddress("0x01"), common.HexToAddress("0x02"), common.HexToAddress("0x03")
+	tests := []struct {
+		allow, deny []common.Address
+		barred      []common.Address
+	}{
+		{nil, nil, nil},
+		{nil, []common.Address{denied}, []common.Address{denied}},
+		{[]common.Address{allowed}, nil, []common.Address{denied, other}},
+		{[]common.Address{allowed}, []common.Address{denied}, []common.Address{denied, other}},
+	}
+	for i, test := range tests {
+		config := params.EqualityConfig{CandidateAllowList: test.allow, CandidateDenyList: test.deny}
+		assert.Equal(t, len(test.allow)+len(test.deny) > 0, candidateAccessRestricted(config), "test %d", i)
+		for _, candidate := range []common.Address{allowed, denied, other} {
+			assert.Equal(t, addressesExist(test.barred, candidate), candidateBarred(config, candidate), "test %d: %s", i, candidate.Hex())
+		}
+	}
+}
+
+func TestRegisterBarredCandidate(t *testing.T) {
+	statedb, err := state.New(common.Hash{}, state.NewDatabase(rawdb.NewMemoryDatabase()), nil)
+	assert.Nil(t, err)
+	allowed, denied := common.HexToAddress("0x01"), common.HexToAddress("0x02")
+
+	register := func(config params.EqualityConfig, candidate common.Address) bool {
+		snap, err := newSnapshot(rawdb.NewMemoryDatabase())
+		assert.Nil(t, err)
+		candidates, cancels := NewAddressSet(), NewAddressSet()
+		registerCandidate(config, statedb, 2, snap, &HeaderExtra{}, candidates, cancels, candidate, nil)
+		return candidates.Contains(candidate)
+	}
+	config := params.EqualityConfig{MinCandidateBalance: big.NewInt(0)}
+	assert.True(t, register(config, denied))
+	config.CandidateDenyList = []common.Address{denied}
+	assert.False(t, register(config, denied))
+	assert.True(t, register(config, allowed))
+	config.CandidateDenyList, config.CandidateAllowList = nil, []common.Address{allowed}
+	assert.False(t, register(config, denied))
+	assert.True(t, register(config, allowed))
+}
+
+func TestDenyValidatorMidEpoch(t *testing.T) {
+	var keys []*ecdsa.PrivateKey
+	var validators []common.Address
+	for i := 0; i < 3; i++ {
+		key, _ := crypto.GenerateKey()
+		keys = append(keys, key)
+		validators = append(validators, crypto.PubkeyToAddress(key.PublicKey))
+	}
+	denied := validators[1]
+
+	db := rawdb.NewMemoryDatabase()
+	statedb, err := state.New(common.Hash{}, state.NewDatabase(db), nil)
+	assert.Nil(t, err)
+	config := params.EqualityConfig{Period: 3, Epoch: 4, MaxValidatorsCount: 2, MinCandidateBalance: big.NewInt(0)}
+	e := New(&config, db)
+	snap, err := newSnapshot(db)
+	assert.Nil(t, err)
+	assert.Nil(t, snap.SetChainConfig(config))
+	for _, validator := range validators {
+		_, err = snap.BecomeCandidate(validator, 1, big.NewInt(0))
+		assert.Nil(t, err)
+	}
+	assert.Nil(t, snap.SetValidators(validators[:2]))
+
+	// The validators deny one of them in the middle of the epoch
+	restricted := config
+	restricted.CandidateDenyList = []common.Address{denied}
+	data, err := json.Marshal(restricted)
+	assert.Nil(t, err)
+	proposal := ConfigProposal{Proposer: validators[0], Config: restricted}
+	header := &types.Header{Number: big.NewInt(2), Coinbase: validators[0]}
+	headerExtra := HeaderExtra{Epoch: 1, EpochBlock: 1}
+	e.processTransactions(config, statedb, header, snap, &headerExtra, []*types.Transaction{
+		newVoteTestTransaction(t, keys[0], "equality:1:event:propose:"+string(data)),
+		newVoteTestTransaction(t, keys[1], "equality:1:event:approve:"+proposal.Hash().Hex()),
+	})
+	assert.Len(t, headerExtra.ChainConfig, 1)
+	current, err := snap.GetChainConfig()
+	assert.Nil(t, err)
+	assert.Equal(t, []common.Address{denied}, current.CandidateDenyList)
+
+	// The denied validator finishes the epoch, neither kicked out nor slashed
+	validatorsLeft, err := snap.GetValidators()
+	assert.Nil(t, err)
+	assert.Equal(t, validators[:2], validatorsLeft)
+	for number := uint64(2); number <= 4; number++ {
+		assert.Nil(t, snap.MintBlock(1, number, validators[number%2]))
+	}
+
+	// At the epoch transition the denied validator stays a candidate but is
+	// passed over
+	header = &types.Header{Number: big.NewInt(5), ParentHash: common.HexToHash("0x01")}
+	headerExtra = HeaderExtra{Epoch: 2, EpochBlock: 5}
+	assert.Nil(t, e.tryElect(current, statedb, header, snap, &headerExtra, nil))
+	assert.Empty(t, headerExtra.CurrentBlockKickOutCandidates)
+	assert.ElementsMatch(t, []common.Address{validators[0], validators[2]}, headerExtra.CurrentEpochValidators)
+	candidate, err := snap.GetCandidate(denied)
+	assert.Nil(t, err)
+	assert.NotNil(t, candidate)
+}
+
+func TestGetCandidatesBarred(t *testing.T) {
+	db := rawdb.NewMemoryDatabase()
+	snap, err := newSnapshot(db)
+	assert.Nil(t, err)
+	allowed, denied := common.HexToAddress("0x01"), common.HexToAddress("0x02")
+	for _, candidate := range []common.Address{allowed, denied} {
+		_, err = snap.BecomeCandidate(candidate, 1, big.NewInt(0))
+		assert.Nil(t, err)
+	}
+	root, err := snap.Root()
+	assert.Nil(t, err)
+	assert.Nil(t, snap.Commit(root))
+
+	api := newTestAPI(db, HeaderExtra{}, HeaderExtra{Root: root, Epoch: 1, EpochBlock: 1})
+	number := rpc.BlockNumber(1)
+	result, err := api.GetCandidates(&number, nil, nil)
+	assert.Nil(t, err)
+	assert.False(t, result.Candidates[0].Barred)
+	assert.False(t, result.Candidates[1].Barred)
+
+	api.equality.config.CandidateDenyList = []common.Address{denied}
+	result, err = api.GetCandidates(&number, nil, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, allowed, result.Candidates[0].Address)
+	assert.False(t, result.Candidates[0].Barred)
+	assert.True(t, result.Candidates[1].Barred)
+}
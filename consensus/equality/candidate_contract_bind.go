@@ -0,0 +1,235 @@
+// Code generated - DO NOT EDIT.
+// This file is a generated binding and any manual changes will be lost.
+
+package equality
+
+import (
+	"math/big"
+	"strings"
+
+	ethereum "github.com/SecretBlockChain/go-secret"
+	"github.com/SecretBlockChain/go-secret/accounts/abi"
+	"github.com/SecretBlockChain/go-secret/accounts/abi/bind"
+	"github.com/SecretBlockChain/go-secret/common"
+	"github.com/SecretBlockChain/go-secret/core/types"
+	"github.com/SecretBlockChain/go-secret/event"
+)
+
+// Reference imports to suppress errors if they are not otherwise used.
+var (
+	_ = big.NewInt
+	_ = strings.NewReader
+	_ = ethereum.NotFound
+	_ = bind.Bind
+	_ = common.Big1
+	_ = types.BloomLookup
+	_ = event.NewSubscription
+)
+
+// CandidateContractABI is the input ABI used to generate the binding from.
+const CandidateContractABI = "[{\"type\":\"function\",\"name\":\"becomeCandidate\",\"inputs\":[],\"outputs\":[],\"stateMutability\":\"payable\"},{\"type\":\"function\",\"name\":\"becomeCandidateWithMetadata\",\"inputs\":[{\"name\":\"metadata\",\"type\":\"bytes\"}],\"outputs\":[],\"stateMutability\":\"payable\"},{\"type\":\"function\",\"name\":\"cancelCandidate\",\"inputs\":[],\"outputs\":[],\"stateMutability\":\"nonpayable\"}]"
+
+// CandidateContract is an auto generated Go binding around an Ethereum contract.
+type CandidateContract struct {
+	CandidateContractCaller     // Read-only binding to the contract
+	CandidateContractTransactor // Write-only binding to the contract
+	CandidateContractFilterer   // Log filterer for contract events
+}
+
+// CandidateContractCaller is an auto generated read-only Go binding around an Ethereum contract.
+type CandidateContractCaller struct {
+	contract *bind.BoundContract // Generic contract wrapper for the low level calls
+}
+
+// CandidateContractTransactor is an auto generated write-only Go binding around an Ethereum contract.
+type CandidateContractTransactor struct {
+	contract *bind.BoundContract // Generic contract wrapper for the low level calls
+}
+
+// CandidateContractFilterer is an auto generated log filtering Go binding around an Ethereum contract events.
+type CandidateContractFilterer struct {
+	contract *bind.BoundContract // Generic contract wrapper for the low level calls
+}
+
+// CandidateContractSession is an auto generated Go binding around an Ethereum contract,
+// with pre-set call and transact options.
+type CandidateContractSession struct {
+	Contract     *CandidateContract // Generic contract binding to set the session for
+	CallOpts     bind.CallOpts      // Call options to use throughout this session
+	TransactOpts bind.TransactOpts  // Transaction auth options to use throughout this session
+}
+
+// CandidateContractCallerSession is an auto generated read-only Go binding around an Ethereum contract,
+// with pre-set call options.
+type CandidateContractCallerSession struct {
+	Contract *CandidateContractCaller // Generic contract caller binding to set the session for
+	CallOpts bind.CallOpts            // Call options to use throughout this session
+}
+
+// CandidateContractTransactorSession is an auto generated write-only Go binding around an Ethereum contract,
+// with pre-set transact options.
+type CandidateContractTransactorSession struct {
+	Contract     *CandidateContractTransactor // Generic contract transactor binding to set the session for
+	TransactOpts bind.TransactOpts            // Transaction auth options to use throughout this session
+}
+
+// CandidateContractRaw is an auto generated low-level Go binding around an Ethereum contract.
+type CandidateContractRaw struct {
+	Contract *CandidateContract // Generic contract binding to access the raw methods on
+}
+
+// CandidateContractCallerRaw is an auto generated low-level read-only Go binding around an Ethereum contract.
+type CandidateContractCallerRaw struct {
+	Contract *CandidateContractCaller // Generic read-only contract binding to access the raw methods on
+}
+
+// CandidateContractTransactorRaw is an auto generated low-level write-only Go binding around an Ethereum contract.
+type CandidateContractTransactorRaw struct {
+	Contract *CandidateContractTransactor // Generic write-only contract binding to access the raw methods on
+}
+
+// NewCandidateContract creates a new instance of CandidateContract, bound to a specific deployed contract.
+func NewCandidateContract(address common.Address, backend bind.ContractBackend) (*CandidateContract, error) {
+	contract, err := bindCandidateContract(address, backend, backend, backend)
+	if err != nil {
+		return nil, err
+	}
+	return &CandidateContract{CandidateContractCaller: CandidateContractCaller{contract: contract}, CandidateContractTransactor: CandidateContractTransactor{contract: contract}, CandidateContractFilterer: CandidateContractFilterer{contract: contract}}, nil
+}
+
+// NewCandidateContractCaller creates a new read-only instance of CandidateContract, bound to a specific deployed contract.
+func NewCandidateContractCaller(address common.Address, caller bind.ContractCaller) (*CandidateContractCaller, error) {
+	contract, err := bindCandidateContract(address, caller, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &CandidateContractCaller{contract: contract}, nil
+}
+
+// NewCandidateContractTransactor creates a new write-only instance of CandidateContract, bound to a specific deployed contract.
+func NewCandidateContractTransactor(address common.Address, transactor bind.ContractTransactor) (*CandidateContractTransactor, error) {
+	contract, err := bindCandidateContract(address, nil, transactor, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &CandidateContractTransactor{contract: contract}, nil
+}
+
+// NewCandidateContractFilterer creates a new log filterer instance of CandidateContract, bound to a specific deployed contract.
+func NewCandidateContractFilterer(address common.Address, filterer bind.ContractFilterer) (*CandidateContractFilterer, error) {
+	contract, err := bindCandidateContract(address, nil, nil, filterer)
+	if err != nil {
+		return nil, err
+	}
+	return &CandidateContractFilterer{contract: contract}, nil
+}
+
+// bindCandidateContract binds a generic wrapper to an already deployed contract.
+func bindCandidateContract(address common.Address, caller bind.ContractCaller, transactor bind.ContractTransactor, filterer bind.ContractFilterer) (*bind.BoundContract, error) {
+	parsed, err := abi.JSON(strings.NewReader(CandidateContractABI))
+	if err != nil {
+		return nil, err
+	}
+	return bind.NewBoundContract(address, parsed, caller, transactor, filterer), nil
+}
+
+// Call invokes the (constant) contract method with params as input values and
+// sets the output to result. The result type might be a single field for simple
+// returns, a slice of interfaces for anonymous returns and a struct for named
+// returns.
+func (_CandidateContract *CandidateContractRaw) Call(opts *bind.CallOpts, result *[]interface{}, method string, params ...interface{}) error {
+	return _CandidateContract.Contract.CandidateContractCaller.contract.Call(opts, result, method, params...)
+}
+
+// Transfer initiates a plain transaction to move funds to the contract, calling
+// its default method if one is available.
+func (_CandidateContract *CandidateContractRaw) Transfer(opts *bind.TransactOpts) (*types.Transaction, error) {
+	return _CandidateContract.Contract.CandidateContractTransactor.contract.Transfer(opts)
+}
+
+// Transact invokes the (paid) contract method with params as input values.
+func (_CandidateContract *CandidateContractRaw) Transact(opts *bind.TransactOpts, method string, params ...interface{}) (*types.Transaction, error) {
+	return _CandidateContract.Contract.CandidateContractTransactor.contract.Transact(opts, method, params...)
+}
+
+// Call invokes the (constant) contract method with params as input values and
+// sets the output to result. The result type might be a single field for simple
+// returns, a slice of interfaces for anonymous returns and a struct for named
+// returns.
+func (_CandidateContract *CandidateContractCallerRaw) Call(opts *bind.CallOpts, result *[]interface{}, method string, params ...interface{}) error {
+	return _CandidateContract.Contract.contract.Call(opts, result, method, params...)
+}
+
+// Transfer initiates a plain transaction to move funds to the contract, calling
+// its default method if one is available.
+func (_CandidateContract *CandidateContractTransactorRaw) Transfer(opts *bind.TransactOpts) (*types.Transaction, error) {
+	return _CandidateContract.Contract.contract.Transfer(opts)
+}
+
+// Transact invokes the (paid) contract method with params as input values.
+func (_CandidateContract *CandidateContractTransactorRaw) Transact(opts *bind.TransactOpts, method string, params ...interface{}) (*types.Transaction, error) {
+	return _CandidateContract.Contract.contract.Transact(opts, method, params...)
+}
+
+// BecomeCandidate is a paid mutator transaction binding the contract method 0x2f41e443.
+//
+// Solidity: function becomeCandidate() payable returns()
+func (_CandidateContract *CandidateContractTransactor) BecomeCandidate(opts *bind.TransactOpts) (*types.Transaction, error) {
+	return _CandidateContract.contract.Transact(opts, "becomeCandidate")
+}
+
+// BecomeCandidate is a paid mutator transaction binding the contract method 0x2f41e443.
+//
+// Solidity: function becomeCandidate() payable returns()
+func (_CandidateContract *CandidateContractSession) BecomeCandidate() (*types.Transaction, error) {
+	return _CandidateContract.Contract.BecomeCandidate(&_CandidateContract.TransactOpts)
+}
+
+// BecomeCandidate is a paid mutator transaction binding the contract method 0x2f41e443.
+//
+// Solidity: function becomeCandidate() payable returns()
+func (_CandidateContract *CandidateContractTransactorSession) BecomeCandidate() (*types.Transaction, error) {
+	return _CandidateContract.Contract.BecomeCandidate(&_CandidateContract.TransactOpts)
+}
+
+// BecomeCandidateWithMetadata is a paid mutator transaction binding the contract method 0x1f83cac0.
+//
+// Solidity: function becomeCandidateWithMetadata(bytes metadata) payable returns()
+func (_CandidateContract *CandidateContractTransactor) BecomeCandidateWithMetadata(opts *bind.TransactOpts, metadata []byte) (*types.Transaction, error) {
+	return _CandidateContract.contract.Transact(opts, "becomeCandidateWithMetadata", metadata)
+}
+
+// BecomeCandidateWithMetadata is a paid mutator transaction binding the contract method 0x1f83cac0.
+//
+// Solidity: function becomeCandidateWithMetadata(bytes metadata) payable returns()
+func (_CandidateContract *CandidateContractSession) BecomeCandidateWithMetadata(metadata []byte) (*types.Transaction, error) {
+	return _CandidateContract.Contract.BecomeCandidateWithMetadata(&_CandidateContract.TransactOpts, metadata)
+}
+
+// BecomeCandidateWithMetadata is a paid mutator transaction binding the contract method 0x1f83cac0.
+//
+// Solidity: function becomeCandidateWithMetadata(bytes metadata) payable returns()
+func (_CandidateContract *CandidateContractTransactorSession) BecomeCandidateWithMetadata(metadata []byte) (*types.Transaction, error) {
+	return _CandidateContract.Contract.BecomeCandidateWithMetadata(&_CandidateContract.TransactOpts, metadata)
+}
+
+// CancelCandidate is a paid mutator transaction binding the contract method 0xf7a8ec6a.
+//
+// Solidity: function cancelCandidate() returns()
+func (_CandidateContract *CandidateContractTransactor) CancelCandidate(opts *bind.TransactOpts) (*types.Transaction, error) {
+	return _CandidateContract.contract.Transact(opts, "cancelCandidate")
+}
+
+// CancelCandidate is a paid mutator transaction binding the contract method 0xf7a8ec6a.
+//
+// Solidity: function cancelCandidate() returns()
+func (_CandidateContract *CandidateContractSession) CancelCandidate() (*types.Transaction, error) {
+	return _CandidateContract.Contract.CancelCandidate(&_CandidateContract.TransactOpts)
+}
+
+// CancelCandidate is a paid mutator transaction binding the contract method 0xf7a8ec6a.
+//
+// Solidity: function cancelCandidate() returns()
+func (_CandidateContract *CandidateContractTransactorSession) CancelCandidate() (*types.Transaction, error) {
+	return _CandidateContract.Contract.CancelCandidate(&_CandidateContract.TransactOpts)
+}
@@ -0,0 +1,92 @@
+package equality
+
+import (
+	"bytes"
+	"errors"
+	"math/big"
+
+	"github.com/SecretBlockChain/go-secret/common"
+	"github.com/SecretBlockChain/go-secret/core/state"
+	"github.com/SecretBlockChain/go-secret/params"
+	"github.com/SecretBlockChain/go-secret/rlp"
+	"github.com/SecretBlockChain/go-secret/trie"
+)
+
+// With config.MaxCandidateCount set, the candidate trie holds at most that many
+// candidates. Once it is reached a registration is rejected unless its deposit
+// exceeds the lowest one, the candidate of the lowest deposit is then evicted
+// with its deposit refunded. Ties are broken by address, the greater address
+// is evicted first. The validators of the current epoch are not evicted.
+//
+// A registration through the candidate system contract deposits the value sent
+// then, the part beyond config.MinCandidateBalance is recorded as a top up so
+// verifiers replay the same deposit.
+
+// evictableCandidate returns the candidate the next registration beyond the max
+// candidate count evicts and its deposit, false if the count is not reached.
+func (snap *Snapshot) evictableCandidate(config params.EqualityConfig) (common.Address, *big.Int, bool, error) {
+	if config.MaxCandidateCount == 0 {
+		return common.Address{}, nil, false, nil
+	}
+	if _, full := snap.EnoughCandidates(int(config.MaxCandidateCount)); !full {
+		return common.Address{}, nil, false, nil
+	}
+	// No validators are elected before the first epoch, only missing state fails
+	validators, err := snap.GetValidators()
+	var missing *trie.MissingNodeError
+	if errors.As(err, &missing) {
+		return common.Address{}, nil, false, err
+	}
+
+	candidateTrie, err := snap.ensureTrie(candidatePrefix)
+	if err != nil {
+		return common.Address{}, nil, false, err
+	}
+	var (
+		lowest common.Address
+		staked *big.Int
+	)
+	iterCandidate := trie.NewIterator(candidateTrie.NodeIterator(nil))
+	for iterCandidate.Next() {
+		address, ok := candidateKey(iterCandidate.Key)
+		if !ok || addressesExist(validators, address) {
+			continue
+		}
+		var candidate Candidate
+		if err = rlp.DecodeBytes(iterCandidate.Value, &candidate); err != nil {
+			return common.Address{}, nil, false, err
+		}
+		// The candidates are iterated in address order, the greater address
+		// of equal deposits is kept
+		if staked == nil || candidate.Staked.Cmp(staked) < 0 ||
+			(candidate.Staked.Cmp(staked) == 0 && bytes.Compare(address[:], lowest[:]) > 0) {
+			lowest, staked = address, candidate.Staked
+		}
+	}
+	if iterCandidate.Err != nil {
+		return common.Address{}, nil, false, iterCandidate.Err
+	}
+	return lowest, staked, staked != nil, nil
+}
+
+// evictCandidate evicts candidate refunding its deposit. An eviction of a
+// candidate registered in the same block undoes the registration instead of
+// being recorded, the candidates are the ones of the block.
+func evictCandidate(state *state.StateDB, snap *Snapshot, headerExtra *HeaderExtra,
+	candidates *AddressSet, candidate common.Address) error {
+
+	exist, security, err := snap.CancelCandidate(candidate)
+	if err != nil || !exist {
+		return err
+	}
+	snap.journal.addBalance(state, candidate, security, opEvictionRefund)
+	// The refund covers the top ups of the block, they are not replayed
+	headerExtra.CurrentBlockTopUps = topUpsRemove(headerExtra.CurrentBlockTopUps, candidate)
+	headerExtra.CurrentBlockMetadata = candidateMetadataRemove(headerExtra.CurrentBlockMetadata, candidate)
+	headerExtra.CurrentBlockRewardRecipients = rewardRecipientsRemove(headerExtra.CurrentBlockRewardRecipients, candidate)
+	headerExtra.CurrentBlockSealerKeys = sealerKeysRemove(headerExtra.CurrentBlockSealerKeys, candidate)
+	if !candidates.Remove(candidate) {
+		headerExtra.CurrentBlockEvictedCandidates = append(headerExtra.CurrentBlockEvictedCandidates, candidate)
+	}
+	return nil
+}
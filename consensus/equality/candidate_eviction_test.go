@@ -0,0 +1,127 @@
+package equality
+
+import (
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/SecretBlockChain/go-secret/common"
+	"github.com/SecretBlockChain/go-secret/common/math"
+	"github.com/SecretBlockChain/go-secret/core/rawdb"
+	"github.com/SecretBlockChain/go-secret/core/state"
+	"github.com/SecretBlockChain/go-secret/core/types"
+	"github.com/SecretBlockChain/go-secret/crypto"
+	"github.com/SecretBlockChain/go-secret/params"
+	"github.com/SecretBlockChain/go-secret/rpc"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCandidateEviction(t *testing.T) {
+	key, _ := crypto.GenerateKey()
+	newcomer := crypto.PubkeyToAddress(key.PublicKey)
+	validator := common.HexToAddress("0x1000000000000000000000000000000000000000")
+	lower := common.HexToAddress("0xa000000000000000000000000000000000000000")
+	greater := common.HexToAddress("0xb000000000000000000000000000000000000000")
+	richer := common.HexToAddress("0xc000000000000000000000000000000000000000")
+
+	db := rawdb.NewMemoryDatabase()
+	statedb, err := state.New(common.Hash{}, state.NewDatabase(db), nil)
+	assert.Nil(t, err)
+	statedb.AddBalance(newcomer, big.NewInt(10))
+
+	config := params.EqualityConfig{Period: 3, Epoch: 30, MaxValidatorsCount: 1, MaxCandidateCount: 4,
+		MinCandidateBalance: big.NewInt(5)}
+	e := New(&config, db)
+	snap, err := newSnapshot(db)
+	assert.Nil(t, err)
+	for address, staked := range map[common.Address]int64{validator: 1, lower: 5, greater: 5, richer: 7} {
+		_, err = snap.BecomeCandidate(address, 1, big.NewInt(staked))
+		assert.Nil(t, err)
+	}
+	assert.Nil(t, snap.SetValidators([]common.Address{validator}))
+	root, err := snap.Root()
+	assert.Nil(t, err)
+	assert.Nil(t, snap.Commit(root))
+
+	// The validators are not evicted, the greater address of the lowest
+	// deposits is
+	evictable, staked, full, err := snap.evictableCandidate(config)
+	assert.Nil(t, err)
+	assert.True(t, full)
+	assert.Equal(t, greater, evictable)
+	assert.Equal(t, big.NewInt(5), staked)
+
+	// A registration not exceeding the lowest deposit is rejected
+	header := &types.Header{Number: big.NewInt(2)}
+	headerExtra := HeaderExtra{Epoch: 1, EpochBlock: 1}
+	e.processTransactions(config, statedb, header, snap, &headerExtra, []*types.Transaction{
+		newVoteTestTransaction(t, key, "equality:1:event:candidate"),
+	})
+	assert.Empty(t, headerExtra.CurrentBlockCandidates)
+	assert.Empty(t, headerExtra.CurrentBlockEvictedCandidates)
+	assert.Equal(t, big.NewInt(10), statedb.GetBalance(newcomer))
+
+	// A higher deposit sent to the candidate system contract evicts it, the
+	// part beyond the min candidate balance is recorded as a top up
+	data, err := candidateContractABI.Pack("becomeCandidate")
+	assert.Nil(t, err)
+	tx := types.NewTransaction(0, CandidateContractAddress, big.NewInt(6), 50000, big.NewInt(1), data)
+	tx, err = types.SignTx(tx, types.HomesteadSigner{}, key)
+	assert.Nil(t, err)
+	statedb.SubBalance(newcomer, tx.Value())
+	statedb.AddBalance(CandidateContractAddress, tx.Value())
+	e.processTransactions(config, statedb, header, snap, &headerExtra, []*types.Transaction{tx})
+	assert.Equal(t, []common.Address{newcomer}, headerExtra.CurrentBlockCandidates)
+	assert.Equal(t, []TopUp{{Candidate: newcomer, Amount: big.NewInt(1)}}, headerExtra.CurrentBlockTopUps)
+	assert.Equal(t, []common.Address{greater}, headerExtra.CurrentBlockEvictedCandidates)
+	assert.Nil(t, headerExtra.Validate(2, config))
+	assert.Equal(t, big.NewInt(4), statedb.GetBalance(newcomer))
+	assert.Equal(t, big.NewInt(5), statedb.GetBalance(greater))
+
+	registered, err := snap.GetCandidate(newcomer)
+	assert.Nil(t, err)
+	assert.Equal(t, big.NewInt(6), registered.Staked)
+	evicted, err := snap.GetCandidate(greater)
+	assert.Nil(t, err)
+	assert.Nil(t, evicted)
+	evictable, _, _, err = snap.evictableCandidate(config)
+	assert.Nil(t, err)
+	assert.Equal(t, lower, evictable)
+
+	logs, err := candidateLogs(config, 2, e.snapshots.open(root), snap, headerExtra)
+	assert.Nil(t, err)
+	assert.Contains(t, logs, newCandidateLog(CandidateEvictedTopic, greater, big.NewInt(5), 2))
+
+	// Verifiers evict the same candidate replaying the header extra, and
+	// reject the evictions of non candidates
+	replayed := e.snapshots.open(root)
+	assert.Nil(t, replayed.apply(config, header, headerExtra))
+	replayedRoot, err := replayed.Root()
+	assert.Nil(t, err)
+	snapRoot, err := snap.Root()
+	assert.Nil(t, err)
+	assert.Equal(t, snapRoot.CandidateHash, replayedRoot.CandidateHash)
+	forged := headerExtra
+	forged.CurrentBlockEvictedCandidates = []common.Address{newcomer}
+	assert.True(t, errors.Is(e.snapshots.open(root).apply(config, header, forged), errInvalidEviction))
+	assert.False(t, forged.Equal(headerExtra))
+
+	duplicate := headerExtra
+	duplicate.CurrentBlockEvictedCandidates = []common.Address{greater, greater}
+	assert.True(t, errors.Is(duplicate.Validate(2, config), errDuplicateAddress))
+
+	// The API reports the deposit a registration has to exceed
+	snapRoot, err = snap.Root()
+	assert.Nil(t, err)
+	assert.Nil(t, snap.Commit(snapRoot))
+	api := newTestAPI(db, HeaderExtra{}, HeaderExtra{Root: snapRoot, Epoch: 1, EpochBlock: 1})
+	api.equality.config.MaxValidatorsCount, api.equality.config.MaxCandidateCount = 1, 4
+	api.equality.config.MinCandidateBalance = config.MinCandidateBalance
+	number, limit := rpc.BlockNumber(1), 10
+	result, err := api.GetCandidates(&number, nil, &limit)
+	assert.Nil(t, err)
+	assert.Equal(t, (*math.HexOrDecimal256)(big.NewInt(5)), result.EvictionThreshold)
+	for _, candidate := range result.Candidates {
+		assert.Equal(t, candidate.Address == lower, candidate.Evictable, "candidate %x", candidate.Address)
+	}
+}
@@ -0,0 +1,27 @@
+package equality
+
+import (
+	"fmt"
+	"math/big"
+
+	"github.com/SecretBlockChain/go-secret/common"
+	"github.com/SecretBlockChain/go-secret/core/state"
+	"github.com/SecretBlockChain/go-secret/params"
+)
+
+// candidateEligible returns an error if candidate may not stand for election
+// at block number: the zero address never may, contracts can not seal blocks
+// and may not from the candidate guard block on, nor the candidates barred by
+// the allow and deny lists. The code is checked in the state of the block.
+func candidateEligible(config params.EqualityConfig, state *state.StateDB, number *big.Int, candidate common.Address) error {
+	if candidate == (common.Address{}) {
+		return fmt.Errorf("%w: zero address", errIneligibleCandidate)
+	}
+	if candidateBarred(config, candidate) {
+		return fmt.Errorf("%w: barred %s", errIneligibleCandidate, candidate.Hex())
+	}
+	if config.IsCandidateGuard(number) && state.GetCodeSize(candidate) > 0 {
+		return fmt.Errorf("%w: contract %s", errIneligibleCandidate, candidate.Hex())
+	}
+	return nil
+}
@@ -0,0 +1,111 @@
+package equality
+
+import (
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/SecretBlockChain/go-secret/common"
+	"github.com/SecretBlockChain/go-secret/core/rawdb"
+	"github.com/SecretBlockChain/go-secret/core/state"
+	"github.com/SecretBlockChain/go-secret/core/types"
+	"github.com/SecretBlockChain/go-secret/crypto"
+	"github.com/SecretBlockChain/go-secret/params"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCandidateEligible(t *testing.T) {
+	statedb, err := state.New(common.Hash{}, state.NewDatabase(rawdb.NewMemoryDatabase()), nil)
+	assert.Nil(t, err)
+	account := common.HexToAddress("0x01")
+	contract := common.HexToAddress("0x02")
+	statedb.SetCode(contract, []byte{0x60, 0x00})
+
+	config := params.EqualityConfig{CandidateGuardBlock: big.NewInt(10)}
+	tests := []struct {
+		candidate common.Address
+		number    int64
+		eligible  bool
+	}{
+		{account, 9, true},
+		{account, 10, true},
+		{contract, 9, true},
+		{contract, 10, false},
+		{common.Address{}, 9, false},
+		{common.Address{}, 10, false},
+	}
+	for i, test := range tests {
+		err := candidateEligible(config, statedb, big.NewInt(test.number), test.candidate)
+		if test.eligible {
+			assert.Nil(t, err, "test %d", i)
+		} else {
+			assert.True(t, errors.Is(err, errIneligibleCandidate), "test %d: %v", i, err)
+		}
+	}
+}
+
+func TestProcessContractCandidate(t *testing.T) {
+	key, _ := crypto.GenerateKey()
+	candidate := crypto.PubkeyToAddress(key.PublicKey)
+	txs := []*types.Transaction{newVoteTestTransaction(t, key, "equality:1:event:candidate")}
+
+	process := func(config params.EqualityConfig) HeaderExtra {
+		db := rawdb.NewMemoryDatabase()
+		statedb, err := state.New(common.Hash{}, state.NewDatabase(db), nil)
+		assert.Nil(t, err)
+		statedb.AddBalance(candidate, big.NewInt(100))
+		statedb.SetCode(candidate, []byte{0x60, 0x00})
+		snap, err := newSnapshot(db)
+		assert.Nil(t, err)
+		headerExtra := HeaderExtra{Epoch: 1, EpochBlock: 1}
+		header := &types.Header{Number: big.NewInt(5)}
+		New(&config, db).processTransactions(config, statedb, header, snap, &headerExtra, txs)
+		return headerExtra
+	}
+
+	// A contract registers until the candidate guard block
+	config := params.EqualityConfig{Epoch: 30, MaxValidatorsCount: 3, MinCandidateBalance: big.NewInt(10)}
+	assert.Equal(t, []common.Address{candidate}, process(config).CurrentBlockCandidates)
+	config.CandidateGuardBlock = big.NewInt(6)
+	assert.Equal(t, []common.Address{candidate}, process(config).CurrentBlockCandidates)
+	config.CandidateGuardBlock = big.NewInt(5)
+	assert.Empty(t, process(config).CurrentBlockCandidates)
+}
+
+func TestElectSkipsContractCandidates(t *testing.T) {
+	statedb, err := state.New(common.Hash{}, state.NewDatabase(rawdb.NewMemoryDatabase()), nil)
+	assert.Nil(t, err)
+	var candidates []common.Address
+	for i := 1; i <= 4; i++ {
+		candidates = append(candidates, common.BigToAddress(big.NewInt(int64(i))))
+	}
+	// The contract registered before the guard block stays a candidate
+	statedb.SetCode(candidates[0], []byte{0x60, 0x00})
+
+	elect := func(config params.EqualityConfig) []common.Address {
+		snap, err := newSnapshot(rawdb.NewMemoryDatabase())
+		assert.Nil(t, err)
+		for i, candidate := range candidates {
+			_, err = snap.BecomeCandidate(candidate, 1, big.NewInt(0))
+			assert.Nil(t, err)
+			vote := Vote{Delegator: common.BigToAddress(big.NewInt(int64(100 + i))), Candidate: candidate, Weight: big.NewInt(int64(10 - i))}
+			assert.Nil(t, snap.Vote(vote))
+		}
+		header := &types.Header{Number: big.NewInt(1), ParentHash: common.HexToHash("0x01")}
+		headerExtra := HeaderExtra{Epoch: 1, EpochBlock: 1}
+		assert.Nil(t, New(&config, rawdb.NewMemoryDatabase()).tryElect(config, statedb, header, snap, &headerExtra, nil))
+		exist, err := snap.GetCandidate(candidates[0])
+		assert.Nil(t, err)
+		assert.NotNil(t, exist)
+		return headerExtra.CurrentEpochValidators
+	}
+
+	for _, delegated := range []bool{false, true} {
+		config := params.EqualityConfig{Epoch: 30, MaxValidatorsCount: 4, DelegatedVoting: delegated}
+		assert.ElementsMatch(t, candidates, elect(config))
+		config.CandidateGuardBlock = big.NewInt(1)
+		assert.ElementsMatch(t, candidates[1:], elect(config))
+	}
+	config := params.EqualityConfig{Epoch: 30, MaxValidatorsCount: 1, DelegatedVoting: true, CandidateGuardBlock: big.NewInt(1)}
+	assert.Equal(t, []common.Address{candidates[1]}, elect(config))
+}
@@ -0,0 +1,23 @@
+package equality
+
+import (
+	"github.com/SecretBlockChain/go-secret/common"
+	"github.com/SecretBlockChain/go-secret/params"
+)
+
+// eligibleFrom returns the first block a candidate registered at block
+// registered may be elected at, the maturity blocks of config later.
+func eligibleFrom(config params.EqualityConfig, registered uint64) uint64 {
+	return registered + config.MaturityBlocks
+}
+
+// candidateMatured returns whether candidate was registered at least the
+// maturity blocks of config before block number, after the registration block
+// recorded in the candidate trie.
+func candidateMatured(config params.EqualityConfig, snap *Snapshot, number uint64, candidate common.Address) bool {
+	registration, err := snap.GetCandidate(candidate)
+	if err != nil || registration == nil {
+		return false
+	}
+	return eligibleFrom(config, registration.BlockNumber) <= number
+}
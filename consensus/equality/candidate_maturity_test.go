@@ -0,0 +1,70 @@
+package equality
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/SecretBlockChain/go-secret/common"
+	"github.com/SecretBlockChain/go-secret/common/math"
+	"github.com/SecretBlockChain/go-secret/core/rawdb"
+	"github.com/SecretBlockChain/go-secret/core/state"
+	"github.com/SecretBlockChain/go-secret/core/types"
+	"github.com/SecretBlockChain/go-secret/params"
+	"github.com/SecretBlockChain/go-secret/rpc"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestElectSkipsImmatureCandidates(t *testing.T) {
+	statedb, err := state.New(common.Hash{}, state.NewDatabase(rawdb.NewMemoryDatabase()), nil)
+	assert.Nil(t, err)
+	senior, flash := common.HexToAddress("0x01"), common.HexToAddress("0x02")
+
+	// The flash candidate registers one block before the epoch transition
+	elect := func(config params.EqualityConfig, number uint64) []common.Address {
+		snap, err := newSnapshot(rawdb.NewMemoryDatabase())
+		assert.Nil(t, err)
+		_, err = snap.BecomeCandidate(senior, 1, big.NewInt(0))
+		assert.Nil(t, err)
+		_, err = snap.BecomeCandidate(flash, 4, big.NewInt(0))
+		assert.Nil(t, err)
+		assert.Nil(t, snap.SetValidators([]common.Address{senior}))
+		for i, candidate := range []common.Address{senior, flash} {
+			vote := Vote{Delegator: common.BigToAddress(big.NewInt(int64(100 + i))), Candidate: candidate, Weight: big.NewInt(10)}
+			assert.Nil(t, snap.Vote(vote))
+		}
+		header := &types.Header{Number: new(big.Int).SetUint64(number), ParentHash: common.HexToHash("0x01")}
+		headerExtra := HeaderExtra{Epoch: (number-1)/config.Epoch + 1, EpochBlock: number}
+		assert.Nil(t, New(&config, rawdb.NewMemoryDatabase()).tryElect(config, statedb, header, snap, &headerExtra, nil))
+		return headerExtra.CurrentEpochValidators
+	}
+
+	for _, delegated := range []bool{false, true} {
+		config := params.EqualityConfig{Epoch: 4, MaxValidatorsCount: 2, DelegatedVoting: delegated}
+		assert.ElementsMatch(t, []common.Address{senior, flash}, elect(config, 5))
+		config.MaturityBlocks = 2
+		assert.Equal(t, []common.Address{senior}, elect(config, 5))
+		assert.ElementsMatch(t, []common.Address{senior, flash}, elect(config, 9))
+	}
+}
+
+func TestGetCandidatesEligibleFrom(t *testing.T) {
+	db := rawdb.NewMemoryDatabase()
+	snap, err := newSnapshot(db)
+	assert.Nil(t, err)
+	candidate := common.HexToAddress("0x01")
+	_, err = snap.BecomeCandidate(candidate, 4, big.NewInt(0))
+	assert.Nil(t, err)
+	root, err := snap.Root()
+	assert.Nil(t, err)
+	assert.Nil(t, snap.Commit(root))
+
+	api := newTestAPI(db, HeaderExtra{}, HeaderExtra{Root: root, Epoch: 1, EpochBlock: 1})
+	number := rpc.BlockNumber(1)
+	for _, maturity := range []uint64{0, 100} {
+		api.equality.config.MaturityBlocks = maturity
+		result, err := api.GetCandidates(&number, nil, nil)
+		assert.Nil(t, err)
+		assert.Len(t, result.Candidates, 1)
+		assert.Equal(t, math.NewHexOrDecimal256(int64(4+maturity)), result.Candidates[0].Eligible)
+	}
+}
@@ -0,0 +1,119 @@
+package equality
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+
+	"github.com/SecretBlockChain/go-secret/common"
+	"github.com/SecretBlockChain/go-secret/common/hexutil"
+	"github.com/SecretBlockChain/go-secret/rlp"
+)
+
+// MaxCandidateMetadataSize is the max size in bytes of the metadata a candidate
+// attaches to its registration, e.g. a moniker, a website and a contact.
+const MaxCandidateMetadataSize = 256
+
+// CandidateMetadata is the metadata a candidate set in a block, by registering
+// or registering again, the last one of a candidate within a block is kept.
+type CandidateMetadata struct {
+	Candidate common.Address `json:"candidate"`
+	Metadata  hexutil.Bytes  `json:"metadata"`
+}
+
+// Equal compares two candidate metadata for equality.
+func (metadata CandidateMetadata) Equal(other CandidateMetadata) bool {
+	return metadata.Candidate == other.Candidate && bytes.Equal(metadata.Metadata, other.Metadata)
+}
+
+// String implements the fmt.Stringer interface.
+func (metadata CandidateMetadata) String() string {
+	return fmt.Sprintf("%s:%s", metadata.Candidate.String(), metadata.Metadata)
+}
+
+// validate checks that the metadata is neither empty nor beyond
+// MaxCandidateMetadataSize.
+func (metadata CandidateMetadata) validate() error {
+	if len(metadata.Metadata) == 0 || len(metadata.Metadata) > MaxCandidateMetadataSize {
+		return fmt.Errorf("%w: %s has %d bytes, want 1 to %d", errInvalidMetadata,
+			metadata.Candidate.String(), len(metadata.Metadata), MaxCandidateMetadataSize)
+	}
+	return nil
+}
+
+// SetCandidateMetadata replaces the metadata of a candidate keeping its
+// deposit, return a bool value means address is a candidate.
+func (snap *Snapshot) SetCandidateMetadata(candidateAddr common.Address, metadata []byte) (bool, error) {
+	candidate, err := snap.GetCandidate(candidateAddr)
+	if err != nil || candidate == nil {
+		return false, err
+	}
+
+	candidateTrie, err := snap.ensureTrie(candidatePrefix)
+	if err != nil {
+		return false, err
+	}
+	candidate.Metadata = common.CopyBytes(metadata)
+	value, err := rlp.EncodeToBytes(candidate)
+	if err != nil {
+		return false, err
+	}
+	return true, candidateTrie.TryUpdate(candidateAddr.Bytes(), value)
+}
+
+// Return a copy of a CandidateMetadata slice sorted by candidate address bytes,
+// the slice itself if already sorted.
+func candidateMetadataSort(slice []CandidateMetadata) []CandidateMetadata {
+	if candidateMetadataSorted(slice) {
+		return slice
+	}
+
+	result := make([]CandidateMetadata, len(slice))
+	copy(result, slice)
+	sort.Slice(result, func(i, j int) bool {
+		return bytes.Compare(result[i].Candidate[:], result[j].Candidate[:]) < 0
+	})
+	return result
+}
+
+// candidateMetadataSorted returns whether a CandidateMetadata slice is sorted
+// by candidate address bytes.
+func candidateMetadataSorted(slice []CandidateMetadata) bool {
+	for idx := 1; idx < len(slice); idx++ {
+		if bytes.Compare(slice[idx-1].Candidate[:], slice[idx].Candidate[:]) > 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// Returns the candidates of a CandidateMetadata slice.
+func candidateMetadataCandidates(slice []CandidateMetadata) []common.Address {
+	candidates := make([]common.Address, 0, len(slice))
+	for _, metadata := range slice {
+		candidates = append(candidates, metadata.Candidate)
+	}
+	return candidates
+}
+
+// Return a copy of a CandidateMetadata slice with the metadata of the candidate
+// replaced.
+func candidateMetadataSet(slice []CandidateMetadata, metadata CandidateMetadata) []CandidateMetadata {
+	return append(candidateMetadataRemove(slice, metadata.Candidate), metadata)
+}
+
+// Return a copy of a CandidateMetadata slice without the metadata of the
+// candidate.
+func candidateMetadataRemove(slice []CandidateMetadata, candidate common.Address) []CandidateMetadata {
+	result := make([]CandidateMetadata, 0, len(slice))
+	for _, metadata := range slice {
+		if metadata.Candidate != candidate {
+			result = append(result, metadata)
+		}
+	}
+	if len(result) == 0 {
+		// Kept nil for the optional rlp field to stay unencoded
+		return nil
+	}
+	return result
+}
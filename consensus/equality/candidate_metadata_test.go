@@ -0,0 +1,150 @@
+package equality
+
+import (
+	"errors"
+	"math/big"
+	"strings"
+	"testing"
+
+	"github.com/SecretBlockChain/go-secret/common"
+	"github.com/SecretBlockChain/go-secret/common/hexutil"
+	"github.com/SecretBlockChain/go-secret/core/rawdb"
+	"github.com/SecretBlockChain/go-secret/core/state"
+	"github.com/SecretBlockChain/go-secret/core/types"
+	"github.com/SecretBlockChain/go-secret/crypto"
+	"github.com/SecretBlockChain/go-secret/params"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCandidateMetadata(t *testing.T) {
+	key, _ := crypto.GenerateKey()
+	candidate := crypto.PubkeyToAddress(key.PublicKey)
+	other := common.HexToAddress("0xa000000000000000000000000000000000000000")
+
+	db := rawdb.NewMemoryDatabase()
+	statedb, err := state.New(common.Hash{}, state.NewDatabase(db), nil)
+	assert.Nil(t, err)
+	statedb.AddBalance(candidate, big.NewInt(10))
+
+	config := params.EqualityConfig{Period: 3, Epoch: 30, MaxValidatorsCount: 3, MinCandidateBalance: big.NewInt(5),
+		MetadataBlock: big.NewInt(3)}
+	e := New(&config, db)
+	snap, err := newSnapshot(db)
+	assert.Nil(t, err)
+	_, err = snap.BecomeCandidate(other, 1, config.MinCandidateBalance)
+	assert.Nil(t, err)
+
+	// The metadata is ignored before the metadata block, the registration is not
+	header := &types.Header{Number: big.NewInt(2)}
+	headerExtra := HeaderExtra{Epoch: 1, EpochBlock: 1}
+	e.processTransactions(config, statedb, header, snap, &headerExtra, []*types.Transaction{
+		newVoteTestTransaction(t, key, "equality:1:event:candidate:moniker"),
+	})
+	assert.Equal(t, []common.Address{candidate}, headerExtra.CurrentBlockCandidates)
+	assert.Empty(t, headerExtra.CurrentBlockMetadata)
+	assert.Equal(t, big.NewInt(5), statedb.GetBalance(candidate))
+	elected, err := snap.RandCandidates(1, 2)
+	assert.Nil(t, err)
+	root, err := snap.Root()
+	assert.Nil(t, err)
+	assert.Nil(t, snap.Commit(root))
+
+	// Registering again replaces the metadata keeping the deposit, the last
+	// metadata of the block is kept
+	header = &types.Header{Number: big.NewInt(3)}
+	headerExtra = HeaderExtra{Epoch: 1, EpochBlock: 1}
+	e.processTransactions(config, statedb, header, snap, &headerExtra, []*types.Transaction{
+		newVoteTestTransaction(t, key, "equality:1:event:candidate:moniker"),
+		newVoteTestTransaction(t, key, "equality:1:event:candidate:moniker:https://example.org"),
+	})
+	assert.Empty(t, headerExtra.CurrentBlockCandidates)
+	assert.Equal(t, []CandidateMetadata{{Candidate: candidate, Metadata: []byte("moniker:https://example.org")}}, headerExtra.CurrentBlockMetadata)
+	assert.Nil(t, headerExtra.Validate(3, config))
+	assert.Equal(t, big.NewInt(5), statedb.GetBalance(candidate))
+	registered, err := snap.GetCandidate(candidate)
+	assert.Nil(t, err)
+	assert.Equal(t, big.NewInt(5), registered.Staked)
+	assert.Equal(t, uint64(2), registered.BlockNumber)
+	assert.Equal(t, hexutil.Bytes("moniker:https://example.org"), registered.Metadata)
+
+	// The metadata plays no part in the elections
+	reelected, err := snap.RandCandidates(1, 2)
+	assert.Nil(t, err)
+	assert.Equal(t, elected, reelected)
+
+	// Verifiers set the same metadata replaying the header extra, and reject the
+	// metadata of non candidates
+	replayed := e.snapshots.open(root)
+	assert.Nil(t, replayed.apply(config, header, headerExtra))
+	replayedRoot, err := replayed.Root()
+	assert.Nil(t, err)
+	snapRoot, err := snap.Root()
+	assert.Nil(t, err)
+	assert.Equal(t, snapRoot.CandidateHash, replayedRoot.CandidateHash)
+	forged := headerExtra
+	forged.CurrentBlockMetadata = append(forged.CurrentBlockMetadata, CandidateMetadata{Candidate: common.HexToAddress("0xb000000000000000000000000000000000000000"), Metadata: []byte("x")})
+	assert.True(t, errors.Is(e.snapshots.open(root).apply(config, header, forged), errInvalidMetadata))
+	assert.False(t, forged.Equal(headerExtra))
+
+	// Canceling within the block drops the metadata
+	header = &types.Header{Number: big.NewInt(4)}
+	headerExtra = HeaderExtra{Epoch: 1, EpochBlock: 1}
+	e.processTransactions(config, statedb, header, snap, &headerExtra, []*types.Transaction{
+		newVoteTestTransaction(t, key, "equality:1:event:candidate:moniker"),
+		newVoteTestTransaction(t, key, "equality:1:event:delegator"),
+	})
+	assert.Nil(t, headerExtra.CurrentBlockMetadata)
+	assert.Equal(t, []common.Address{candidate}, headerExtra.CurrentBlockCancelCandidates)
+}
+
+func TestCandidateMetadataValidate(t *testing.T) {
+	config := params.EqualityConfig{Period: 3, Epoch: 30, MaxValidatorsCount: 3, MinCandidateBalance: big.NewInt(5),
+		MetadataBlock: big.NewInt(3)}
+	candidate := common.HexToAddress("0xa000000000000000000000000000000000000000")
+	metadata := func(size int) HeaderExtra {
+		return HeaderExtra{Epoch: 1, EpochBlock: 1, CurrentBlockMetadata: []CandidateMetadata{
+			{Candidate: candidate, Metadata: make([]byte, size)},
+		}}
+	}
+
+	assert.Nil(t, metadata(MaxCandidateMetadataSize).Validate(3, config))
+	for _, size := range []int{0, MaxCandidateMetadataSize + 1} {
+		assert.True(t, errors.Is(metadata(size).Validate(3, config), errInvalidMetadata), "size %d", size)
+	}
+	assert.True(t, errors.Is(metadata(1).Validate(2, config), errInvalidMetadata))
+
+	duplicate := metadata(1)
+	duplicate.CurrentBlockMetadata = append(duplicate.CurrentBlockMetadata, duplicate.CurrentBlockMetadata[0])
+	assert.True(t, errors.Is(duplicate.Validate(3, config), errDuplicateAddress))
+}
+
+func TestCandidateMetadataTransactionDecode(t *testing.T) {
+	key, _ := crypto.GenerateKey()
+	ctx, err := NewTransaction(newVoteTestTransaction(t, key, "equality:1:event:candidate"))
+	assert.Nil(t, err)
+	assert.Nil(t, ctx.(*EventBecomeCandidate).Metadata)
+
+	ctx, err = NewTransaction(newVoteTestTransaction(t, key, "equality:1:event:candidate:"+strings.Repeat("m", MaxCandidateMetadataSize)))
+	assert.Nil(t, err)
+	assert.Len(t, ctx.(*EventBecomeCandidate).Metadata, MaxCandidateMetadataSize)
+	_, err = NewTransaction(newVoteTestTransaction(t, key, "equality:1:event:candidate:"+strings.Repeat("m", MaxCandidateMetadataSize+1)))
+	assert.NotNil(t, err)
+
+	// The candidate system contract takes the metadata as argument
+	data, err := candidateContractABI.Pack("becomeCandidateWithMetadata", []byte("moniker"))
+	assert.Nil(t, err)
+	tx := types.NewTransaction(0, CandidateContractAddress, big.NewInt(5), 50000, big.NewInt(1), data)
+	tx, err = types.SignTx(tx, types.HomesteadSigner{}, key)
+	assert.Nil(t, err)
+	ctx, err = NewTransaction(tx)
+	assert.Nil(t, err)
+	event := ctx.(*EventBecomeCandidate)
+	assert.Equal(t, []byte("moniker"), event.Metadata)
+	assert.Equal(t, big.NewInt(5), event.Deposit)
+
+	invalid := types.NewTransaction(0, CandidateContractAddress, big.NewInt(5), 50000, big.NewInt(1), data[:len(data)-40])
+	invalid, err = types.SignTx(invalid, types.HomesteadSigner{}, key)
+	assert.Nil(t, err)
+	_, err = NewTransaction(invalid)
+	assert.NotNil(t, err)
+}
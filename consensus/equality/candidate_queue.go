@@ -0,0 +1,125 @@
+package equality
+
+import (
+	"math/big"
+
+	"github.com/SecretBlockChain/go-secret/common"
+	"github.com/SecretBlockChain/go-secret/core/state"
+	"github.com/SecretBlockChain/go-secret/core/types"
+	"github.com/SecretBlockChain/go-secret/crypto"
+	"github.com/SecretBlockChain/go-secret/params"
+)
+
+// A block registers at most maxBlockCandidates candidates, bounding the share
+// of the header extra size limit its candidate list takes. The registrations
+// of a block beyond it are deferred to the following blocks: the candidates
+// of the deferred and the new registrations are taken in address order, the
+// ones beyond the limit are queued for the next block.
+//
+// The queue is kept in the storage of the candidate system contract, sorted by
+// address: slot 0 holds the number of queued candidates, slot i the candidate
+// i and the slot hashed from it the deposit of its registration, zero for the
+// min candidate balance. Nodes executing the blocks agree on it through the
+// state root, the header extra only lists the registrations taking effect.
+
+// maxBlockCandidates returns the number of candidates a block registers at
+// most, those of a quarter of the lower of the header extra size limits.
+func maxBlockCandidates(config params.EqualityConfig) int {
+	limit := headerExtraLimit(config)
+	if bytes := headerExtraBytesLimit(config); bytes < limit {
+		limit = bytes
+	}
+	return int(limit / 4 / (common.AddressLength + 1))
+}
+
+// candidateQueueSlot returns the storage slot of the queued candidate idx.
+func candidateQueueSlot(idx int) common.Hash {
+	return common.BigToHash(big.NewInt(int64(idx) + 1))
+}
+
+// candidateQueueDepositSlot returns the storage slot of the deposit of the
+// queued candidate idx.
+func candidateQueueDepositSlot(idx int) common.Hash {
+	return crypto.Keccak256Hash(candidateQueueSlot(idx).Bytes())
+}
+
+// queuedCandidate is a deferred registration of a candidate.
+type queuedCandidate struct {
+	Candidate common.Address
+	Deposit   *big.Int // Deposit of the registration, nil for the min candidate balance
+}
+
+// loadCandidateQueue returns the deferred registrations in address order.
+func loadCandidateQueue(state *state.StateDB) []queuedCandidate {
+	count := state.GetState(CandidateContractAddress, common.Hash{}).Big().Int64()
+	queue := make([]queuedCandidate, 0, count)
+	for idx := 0; idx < int(count); idx++ {
+		entry := queuedCandidate{
+			Candidate: common.BytesToAddress(state.GetState(CandidateContractAddress, candidateQueueSlot(idx)).Bytes()),
+		}
+		if deposit := state.GetState(CandidateContractAddress, candidateQueueDepositSlot(idx)); deposit != (common.Hash{}) {
+			entry.Deposit = deposit.Big()
+		}
+		queue = append(queue, entry)
+	}
+	return queue
+}
+
+// storeCandidateQueue replaces the deferred registrations by the deposits of
+// the queued candidates.
+func storeCandidateQueue(state *state.StateDB, journal *systemJournal, deposits map[common.Address]*big.Int) {
+	queue := make([]common.Address, 0, len(deposits))
+	for candidate := range deposits {
+		queue = append(queue, candidate)
+	}
+	queue = addressesSort(queue)
+	count := int(state.GetState(CandidateContractAddress, common.Hash{}).Big().Int64())
+	if count == 0 && len(queue) == 0 {
+		return
+	}
+
+	// The contract holds no code nor balance, its nonce keeps the account from
+	// being deleted as empty
+	if state.GetNonce(CandidateContractAddress) == 0 {
+		state.SetNonce(CandidateContractAddress, 1)
+	}
+	for idx, candidate := range queue {
+		var deposit common.Hash
+		if deposits[candidate] != nil {
+			deposit = common.BigToHash(deposits[candidate])
+		}
+		journal.setState(state, CandidateContractAddress, candidateQueueSlot(idx), common.BytesToHash(candidate.Bytes()), opCandidateQueue)
+		journal.setState(state, CandidateContractAddress, candidateQueueDepositSlot(idx), deposit, opCandidateQueue)
+	}
+	for idx := len(queue); idx < count; idx++ {
+		journal.setState(state, CandidateContractAddress, candidateQueueSlot(idx), common.Hash{}, opCandidateQueue)
+		journal.setState(state, CandidateContractAddress, candidateQueueDepositSlot(idx), common.Hash{}, opCandidateQueue)
+	}
+	journal.setState(state, CandidateContractAddress, common.Hash{}, common.BigToHash(big.NewInt(int64(len(queue)))), opCandidateQueue)
+}
+
+// admittedCandidates returns the candidates a block registers out of the queued
+// ones and the ones of its registrations, nil if all of them fit.
+func admittedCandidates(config params.EqualityConfig, queue []queuedCandidate, txs []*types.Transaction) map[common.Address]struct{} {
+	candidates := NewAddressSet()
+	for _, entry := range queue {
+		candidates.Add(entry.Candidate)
+	}
+	for _, tx := range txs {
+		if ctx, err := NewTransaction(tx); err == nil {
+			if event, ok := ctx.(*EventBecomeCandidate); ok {
+				candidates.Add(event.Candidate)
+			}
+		}
+	}
+	limit := maxBlockCandidates(config)
+	if candidates.Len() <= limit {
+		return nil
+	}
+
+	admitted := make(map[common.Address]struct{}, limit)
+	for _, candidate := range addressesSort(candidates.Slice())[:limit] {
+		admitted[candidate] = struct{}{}
+	}
+	return admitted
+}
@@ -0,0 +1,169 @@
+package equality
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"errors"
+	"math/big"
+	"math/rand"
+	"sort"
+	"testing"
+
+	"github.com/SecretBlockChain/go-secret/common"
+	"github.com/SecretBlockChain/go-secret/core/rawdb"
+	"github.com/SecretBlockChain/go-secret/core/state"
+	"github.com/SecretBlockChain/go-secret/core/types"
+	"github.com/SecretBlockChain/go-secret/crypto"
+	"github.com/SecretBlockChain/go-secret/params"
+	"github.com/stretchr/testify/assert"
+)
+
+// queuedCandidates returns the candidates of the deferred registrations.
+func queuedCandidates(queue []queuedCandidate) []common.Address {
+	candidates := make([]common.Address, 0, len(queue))
+	for _, entry := range queue {
+		candidates = append(candidates, entry.Candidate)
+	}
+	return candidates
+}
+
+func TestDeferCandidates(t *testing.T) {
+	config := params.EqualityConfig{Period: 3, Epoch: 30, MaxValidatorsCount: 3, MinCandidateBalance: big.NewInt(5),
+		MaxHeaderExtraSize: 64 * 1024, MaxHeaderExtraBytes: 64 * 1024}
+	limit := maxBlockCandidates(config)
+	assert.Equal(t, 780, limit)
+
+	// 10k registrations in one block
+	var txs []*types.Transaction
+	var candidates []common.Address
+	keys := make(map[common.Address]*ecdsa.PrivateKey)
+	for i := 0; i < 10000; i++ {
+		key, _ := crypto.GenerateKey()
+		txs = append(txs, newVoteTestTransaction(t, key, "equality:1:event:candidate"))
+		candidates = append(candidates, crypto.PubkeyToAddress(key.PublicKey))
+		keys[candidates[i]] = key
+	}
+	sorted := addressesSort(candidates)
+
+	newState := func() (*state.StateDB, *Snapshot) {
+		db := rawdb.NewMemoryDatabase()
+		statedb, err := state.New(common.Hash{}, state.NewDatabase(db), nil)
+		assert.Nil(t, err)
+		for _, candidate := range candidates {
+			statedb.AddBalance(candidate, big.NewInt(10))
+		}
+		snap, err := newSnapshot(db)
+		assert.Nil(t, err)
+		return statedb, snap
+	}
+	e := New(&config, rawdb.NewMemoryDatabase())
+	process := func(statedb *state.StateDB, snap *Snapshot, number int64, txs []*types.Transaction) HeaderExtra {
+		headerExtra := HeaderExtra{Epoch: 1, EpochBlock: 1}
+		e.processTransactions(config, statedb, &types.Header{Number: big.NewInt(number)}, snap, &headerExtra, txs)
+		assert.Nil(t, headerExtra.Validate(uint64(number), config))
+		return headerExtra
+	}
+
+	// The lowest addresses are registered, the others are queued with their
+	// deposits left
+	statedb, snap := newState()
+	headerExtra := process(statedb, snap, 2, txs)
+	assert.Equal(t, sorted[:limit], addressesSort(headerExtra.CurrentBlockCandidates))
+	assert.Equal(t, sorted[limit:], queuedCandidates(loadCandidateQueue(statedb)))
+	assert.Equal(t, big.NewInt(5), statedb.GetBalance(sorted[0]))
+	assert.Equal(t, big.NewInt(10), statedb.GetBalance(sorted[limit]))
+
+	// Verifiers split the block the same whatever the order of the transactions
+	shuffled := append([]*types.Transaction{}, txs...)
+	rand.Shuffle(len(shuffled), func(i, j int) { shuffled[i], shuffled[j] = shuffled[j], shuffled[i] })
+	verifier, verifierSnap := newState()
+	replayed := process(verifier, verifierSnap, 2, shuffled)
+	assert.Equal(t, headerExtra.Hash(), replayed.Hash())
+	assert.Equal(t, statedb.IntermediateRoot(true), verifier.IntermediateRoot(true))
+	root, err := snap.Root()
+	assert.Nil(t, err)
+	verifierRoot, err := verifierSnap.Root()
+	assert.Nil(t, err)
+	assert.Equal(t, root, verifierRoot)
+
+	// The queue is drained by the following blocks, a canceled registration
+	// leaves it
+	canceled := sorted[2*limit]
+	next := process(statedb, snap, 3, []*types.Transaction{newVoteTestTransaction(t, keys[canceled], "equality:1:event:delegator")})
+	assert.Equal(t, sorted[limit:2*limit], addressesSort(next.CurrentBlockCandidates))
+	assert.Equal(t, sorted[2*limit+1:], queuedCandidates(loadCandidateQueue(statedb)))
+	registered := 2 * limit
+	for number := int64(4); len(queuedCandidates(loadCandidateQueue(statedb))) > 0; number++ {
+		registered += len(process(statedb, snap, number, nil).CurrentBlockCandidates)
+	}
+	assert.Equal(t, len(candidates)-1, registered)
+	registeredCandidates, err := snap.GetCandidates()
+	assert.Nil(t, err)
+	assert.Len(t, registeredCandidates, len(candidates)-1)
+	assert.NotContains(t, registeredCandidates, canceled)
+	assert.Equal(t, big.NewInt(10), statedb.GetBalance(canceled))
+
+	// Header extras registering more candidates than a block admits are invalid
+	headerExtra = HeaderExtra{Epoch: 1, EpochBlock: 1, CurrentBlockCandidates: sorted[:limit+1]}
+	assert.True(t, errors.Is(headerExtra.Validate(2, config), errTooManyCandidates))
+}
+
+func TestDeferCandidateDeposit(t *testing.T) {
+	// A block registers two candidates at most
+	config := params.EqualityConfig{Period: 3, Epoch: 30, MaxValidatorsCount: 3, MinCandidateBalance: big.NewInt(5),
+		MaxCandidateCount: 10, MaxHeaderExtraBytes: 2 * 4 * (common.AddressLength + 1)}
+	assert.Equal(t, 2, maxBlockCandidates(config))
+
+	var keys []*ecdsa.PrivateKey
+	for i := 0; i < 3; i++ {
+		key, _ := crypto.GenerateKey()
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return bytes.Compare(crypto.PubkeyToAddress(keys[i].PublicKey).Bytes(), crypto.PubkeyToAddress(keys[j].PublicKey).Bytes()) < 0
+	})
+	deferred := crypto.PubkeyToAddress(keys[2].PublicKey)
+
+	db := rawdb.NewMemoryDatabase()
+	statedb, err := state.New(common.Hash{}, state.NewDatabase(db), nil)
+	assert.Nil(t, err)
+	snap, err := newSnapshot(db)
+	assert.Nil(t, err)
+	for _, key := range keys {
+		statedb.AddBalance(crypto.PubkeyToAddress(key.PublicKey), big.NewInt(10))
+	}
+
+	// The highest address sends a deposit above the min candidate balance to
+	// the candidate system contract, it is refunded while queued
+	data, err := candidateContractABI.Pack("becomeCandidate")
+	assert.Nil(t, err)
+	tx := types.NewTransaction(0, CandidateContractAddress, big.NewInt(7), 50000, big.NewInt(1), data)
+	tx, err = types.SignTx(tx, types.HomesteadSigner{}, keys[2])
+	assert.Nil(t, err)
+	statedb.SubBalance(deferred, tx.Value())
+	statedb.AddBalance(CandidateContractAddress, tx.Value())
+
+	e := New(&config, rawdb.NewMemoryDatabase())
+	headerExtra := HeaderExtra{Epoch: 1, EpochBlock: 1}
+	e.processTransactions(config, statedb, &types.Header{Number: big.NewInt(2)}, snap, &headerExtra, []*types.Transaction{
+		newVoteTestTransaction(t, keys[0], "equality:1:event:candidate"),
+		newVoteTestTransaction(t, keys[1], "equality:1:event:candidate"),
+		tx,
+	})
+	assert.Len(t, headerExtra.CurrentBlockCandidates, 2)
+	assert.Equal(t, []queuedCandidate{{Candidate: deferred, Deposit: big.NewInt(7)}}, loadCandidateQueue(statedb))
+	assert.Equal(t, big.NewInt(10), statedb.GetBalance(deferred))
+
+	// The queued registration takes effect with its deposit
+	headerExtra = HeaderExtra{Epoch: 1, EpochBlock: 1}
+	e.processTransactions(config, statedb, &types.Header{Number: big.NewInt(3)}, snap, &headerExtra, nil)
+	assert.Equal(t, []common.Address{deferred}, headerExtra.CurrentBlockCandidates)
+	assert.Equal(t, []TopUp{{Candidate: deferred, Amount: big.NewInt(2)}}, headerExtra.CurrentBlockTopUps)
+	assert.Empty(t, loadCandidateQueue(statedb))
+	assert.Equal(t, common.Hash{}, statedb.GetState(CandidateContractAddress, candidateQueueDepositSlot(0)))
+	assert.Equal(t, big.NewInt(3), statedb.GetBalance(deferred))
+
+	registered, err := snap.GetCandidate(deferred)
+	assert.Nil(t, err)
+	assert.Equal(t, big.NewInt(7), registered.Staked)
+}
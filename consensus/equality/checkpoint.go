@@ -0,0 +1,280 @@
+package equality
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"sort"
+
+	"github.com/SecretBlockChain/go-secret/accounts"
+	"github.com/SecretBlockChain/go-secret/common"
+	"github.com/SecretBlockChain/go-secret/common/hexutil"
+	"github.com/SecretBlockChain/go-secret/consensus"
+	"github.com/SecretBlockChain/go-secret/core/types"
+	"github.com/SecretBlockChain/go-secret/crypto"
+)
+
+// checkpointSigPrefix separates the checkpoint attestations from the other
+// data signed by the validators.
+var checkpointSigPrefix = []byte("equality-checkpoint")
+
+// maxCheckpointEpochs is the max number of epochs searched back for the
+// latest attested checkpoint.
+const maxCheckpointEpochs = 1024
+
+// Checkpoint is the final block of the previous epoch attested by its
+// validators, carried by the transition block of an epoch. Its fields are
+// append only, see HeaderExtra. The blocks up to an attested checkpoint are
+// final.
+type Checkpoint struct {
+	Number     uint64          `json:"number"`
+	Hash       common.Hash     `json:"hash"`
+	Signatures []hexutil.Bytes `json:"signatures"` // Signatures of CheckpointSigHash, one per validator
+}
+
+// CheckpointSigData returns the data a validator signs to attest the block of
+// number and hash as the checkpoint of its epoch.
+func CheckpointSigData(number uint64, hash common.Hash) []byte {
+	data := make([]byte, len(checkpointSigPrefix)+8+common.HashLength)
+	copy(data, checkpointSigPrefix)
+	binary.BigEndian.PutUint64(data[len(checkpointSigPrefix):], number)
+	copy(data[len(checkpointSigPrefix)+8:], hash[:])
+	return data
+}
+
+// CheckpointSigHash returns the hash of CheckpointSigData, the one recovered
+// from the signatures of a checkpoint.
+func CheckpointSigHash(number uint64, hash common.Hash) common.Hash {
+	return crypto.Keccak256Hash(CheckpointSigData(number, hash))
+}
+
+// Equal compares two checkpoints for equality.
+func (checkpoint Checkpoint) Equal(other Checkpoint) bool {
+	if checkpoint.Number != other.Number || checkpoint.Hash != other.Hash {
+		return false
+	}
+	if len(checkpoint.Signatures) != len(other.Signatures) {
+		return false
+	}
+	for idx, signature := range checkpoint.Signatures {
+		if !bytes.Equal(signature, other.Signatures[idx]) {
+			return false
+		}
+	}
+	return true
+}
+
+// String implements the fmt.Stringer interface.
+func (checkpoint Checkpoint) String() string {
+	return fmt.Sprintf("%d:%s:%d", checkpoint.Number, checkpoint.Hash.String(), len(checkpoint.Signatures))
+}
+
+// Signers recovers the validators that signed the checkpoint, in the order of
+// the signatures.
+func (checkpoint Checkpoint) Signers() ([]common.Address, error) {
+	hash := CheckpointSigHash(checkpoint.Number, checkpoint.Hash)
+	signers := make([]common.Address, 0, len(checkpoint.Signatures))
+	for _, signature := range checkpoint.Signatures {
+		pubkey, err := crypto.SigToPub(hash[:], signature)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", errInvalidCheckpoint, err)
+		}
+		signers = append(signers, crypto.PubkeyToAddress(*pubkey))
+	}
+	return signers, nil
+}
+
+// sorted returns a copy of the checkpoint with the signatures sorted by bytes,
+// the checkpoint itself if already sorted.
+func (checkpoint Checkpoint) sorted() Checkpoint {
+	less := func(slice []hexutil.Bytes) func(i, j int) bool {
+		return func(i, j int) bool { return bytes.Compare(slice[i], slice[j]) < 0 }
+	}
+	if sort.SliceIsSorted(checkpoint.Signatures, less(checkpoint.Signatures)) {
+		return checkpoint
+	}
+	signatures := make([]hexutil.Bytes, len(checkpoint.Signatures))
+	copy(signatures, checkpoint.Signatures)
+	sort.Slice(signatures, less(signatures))
+	checkpoint.Signatures = signatures
+	return checkpoint
+}
+
+// validate checks that the checkpoint attests the parent of the block of
+// headerNumber with well formed signatures.
+func (checkpoint Checkpoint) validate(headerNumber uint64) error {
+	if checkpoint.Number+1 != headerNumber {
+		return fmt.Errorf("%w: block %d at %d", errInvalidCheckpoint, checkpoint.Number, headerNumber)
+	}
+	if len(checkpoint.Signatures) == 0 {
+		return fmt.Errorf("%w: no signatures", errInvalidCheckpoint)
+	}
+	for _, signature := range checkpoint.Signatures {
+		if len(signature) != crypto.SignatureLength {
+			return fmt.Errorf("%w: signature of %d bytes", errInvalidCheckpoint, len(signature))
+		}
+	}
+	return nil
+}
+
+// checkpointQuorum returns whether signers out of validators attest a
+// checkpoint, at least two thirds of them.
+func checkpointQuorum(signers, validators int) bool {
+	return validators > 0 && 3*signers >= 2*validators
+}
+
+// verifyCheckpoint checks that the checkpoint carried by header is its parent,
+// attested by at least two thirds of validators, the ones of the previous
+// epoch, each signing once.
+func verifyCheckpoint(header *types.Header, checkpoint Checkpoint, validators []common.Address) error {
+	if err := checkpoint.validate(header.Number.Uint64()); err != nil {
+		return err
+	}
+	if checkpoint.Hash != header.ParentHash {
+		return fmt.Errorf("%w: hash %s, parent %s", errInvalidCheckpoint, checkpoint.Hash.String(), header.ParentHash.String())
+	}
+	signers, err := checkpoint.Signers()
+	if err != nil {
+		return err
+	}
+	seen := NewAddressSet()
+	for _, signer := range signers {
+		if !addressesExist(validators, signer) {
+			return fmt.Errorf("%w: signed by non validator %s", errInvalidCheckpoint, signer.Hex())
+		}
+		if seen.Contains(signer) {
+			return fmt.Errorf("%w: signed twice by %s", errInvalidCheckpoint, signer.Hex())
+		}
+		seen.Add(signer)
+	}
+	if !checkpointQuorum(len(signers), len(validators)) {
+		return fmt.Errorf("%w: signed by %d of %d validators", errInvalidCheckpoint, len(signers), len(validators))
+	}
+	return nil
+}
+
+// verifyCheckpoint checks the checkpoint carried by header against the
+// validators of the snapshot, the ones of the epoch ending before it.
+func (snap *Snapshot) verifyCheckpoint(header *types.Header, checkpoint Checkpoint) error {
+	validators, err := snap.GetValidators()
+	if err != nil {
+		return err
+	}
+	return verifyCheckpoint(header, checkpoint, validators)
+}
+
+// attestCheckpoint returns the checkpoint of the transition block header, its
+// parent attested by the signatures of the validators of the snapshot, nil
+// below the quorum. The signatures not recovering to a validator and the ones
+// of a validator signing again are dropped.
+func (snap *Snapshot) attestCheckpoint(header *types.Header, signatures [][]byte) (*Checkpoint, error) {
+	if len(signatures) == 0 {
+		return nil, nil
+	}
+	validators, err := snap.GetValidators()
+	if err != nil {
+		return nil, err
+	}
+
+	number := header.Number.Uint64() - 1
+	hash := CheckpointSigHash(number, header.ParentHash)
+	signers := NewAddressSet()
+	checkpoint := &Checkpoint{Number: number, Hash: header.ParentHash}
+	for _, signature := range signatures {
+		pubkey, err := crypto.SigToPub(hash[:], signature)
+		if err != nil {
+			continue
+		}
+		signer := crypto.PubkeyToAddress(*pubkey)
+		if !addressesExist(validators, signer) || signers.Contains(signer) {
+			continue
+		}
+		signers.Add(signer)
+		checkpoint.Signatures = append(checkpoint.Signatures, common.CopyBytes(signature))
+	}
+	if !checkpointQuorum(signers.Len(), len(validators)) {
+		return nil, nil
+	}
+	sorted := checkpoint.sorted()
+	return &sorted, nil
+}
+
+// SignCheckpoint signs header as the checkpoint of its epoch with the local
+// validator, the signature to contribute through a checkpoint transaction.
+// Only the final block of an epoch is signed.
+func (e *Equality) SignCheckpoint(header *types.Header) (common.Address, []byte, error) {
+	number := header.Number.Uint64()
+	if number == 0 {
+		return common.Address{}, nil, fmt.Errorf("%w: genesis block", errInvalidCheckpoint)
+	}
+	headerExtra, err := e.DecodeHeaderExtraCached(header)
+	if err != nil {
+		return common.Address{}, nil, err
+	}
+	config, err := e.chainConfig(header)
+	if err != nil {
+		return common.Address{}, nil, err
+	}
+	length, err := e.snapshots.open(headerExtra.Root).GetEpochLength(config)
+	if err != nil {
+		return common.Address{}, nil, err
+	}
+	if epoch, _ := nextEpoch(headerExtra, number+1, length); epoch == headerExtra.Epoch {
+		return common.Address{}, nil, fmt.Errorf("%w: block %d is not the final block of epoch %d",
+			errInvalidCheckpoint, number, headerExtra.Epoch)
+	}
+
+	e.lock.RLock()
+	signer, signFn := e.signer, e.signFn
+	e.lock.RUnlock()
+	if signFn == nil {
+		return common.Address{}, nil, errUnauthorized
+	}
+
+	signature, err := signFn(accounts.Account{Address: signer}, accounts.MimetypeEqualityCheckpoint,
+		CheckpointSigData(header.Number.Uint64(), header.Hash()))
+	if err != nil {
+		return common.Address{}, nil, err
+	}
+	if len(signature) != crypto.SignatureLength {
+		return common.Address{}, nil, fmt.Errorf("invalid signature length %d", len(signature))
+	}
+	return signer, signature, nil
+}
+
+// latestCheckpoint returns the transition block carrying the latest attested
+// checkpoint on the canonical chain up to header, searching back at most
+// maxCheckpointEpochs epochs. Nil if none is found.
+func (e *Equality) latestCheckpoint(chain consensus.ChainHeaderReader, header *types.Header) (*types.Header, *Checkpoint, error) {
+	for epochs := 0; header != nil && header.Number.Uint64() > 1 && epochs < maxCheckpointEpochs; epochs++ {
+		headerExtra, err := e.DecodeHeaderExtraCached(header)
+		if err != nil {
+			return nil, nil, err
+		}
+		if headerExtra.EpochBlock <= 1 {
+			break
+		}
+		if headerExtra.EpochBlock != header.Number.Uint64() {
+			if header = chain.GetHeaderByNumber(headerExtra.EpochBlock); header == nil {
+				return nil, nil, errUnknownBlock
+			}
+			if headerExtra, err = e.DecodeHeaderExtraCached(header); err != nil {
+				return nil, nil, err
+			}
+		}
+		if headerExtra.Checkpoint != nil {
+			return header, headerExtra.Checkpoint, nil
+		}
+
+		// The configs before the checkpoint block carry no checkpoints
+		config, err := e.chainConfig(header)
+		if err != nil {
+			return nil, nil, err
+		}
+		if !config.IsCheckpoint(header.Number) {
+			break
+		}
+		header = chain.GetHeader(header.ParentHash, header.Number.Uint64()-1)
+	}
+	return nil, nil, nil
+}
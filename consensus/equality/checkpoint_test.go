@@ -0,0 +1,217 @@
+package equality
+
+import (
+	"crypto/ecdsa"
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/SecretBlockChain/go-secret/accounts"
+	"github.com/SecretBlockChain/go-secret/common"
+	"github.com/SecretBlockChain/go-secret/common/hexutil"
+	"github.com/SecretBlockChain/go-secret/core/rawdb"
+	"github.com/SecretBlockChain/go-secret/core/state"
+	"github.com/SecretBlockChain/go-secret/core/types"
+	"github.com/SecretBlockChain/go-secret/crypto"
+	"github.com/SecretBlockChain/go-secret/params"
+	"github.com/SecretBlockChain/go-secret/rpc"
+	"github.com/stretchr/testify/assert"
+)
+
+// signTestCheckpoint returns the signature of key over block number and hash.
+func signTestCheckpoint(t *testing.T, key *ecdsa.PrivateKey, number uint64, hash common.Hash) []byte {
+	sigHash := CheckpointSigHash(number, hash)
+	signature, err := crypto.Sign(sigHash[:], key)
+	assert.Nil(t, err)
+	return signature
+}
+
+func TestCheckpointAttestation(t *testing.T) {
+	var keys []*ecdsa.PrivateKey
+	var validators []common.Address
+	for i := 0; i < 4; i++ {
+		key, _ := crypto.GenerateKey()
+		keys = append(keys, key)
+		validators = append(validators, crypto.PubkeyToAddress(key.PublicKey))
+	}
+	outsider, _ := crypto.GenerateKey()
+
+	snap, err := newSnapshot(rawdb.NewMemoryDatabase())
+	assert.Nil(t, err)
+	assert.Nil(t, snap.SetValidators(validators[:3]))
+	parent := newTestHeader(3, HeaderExtra{Epoch: 1, EpochBlock: 1})
+	header := newTestHeader(4, HeaderExtra{Epoch: 2, EpochBlock: 4})
+	header.ParentHash = parent.Hash()
+	sign := func(key *ecdsa.PrivateKey) []byte { return signTestCheckpoint(t, key, 3, parent.Hash()) }
+
+	// Below two thirds of the validators there is no checkpoint, the
+	// signatures of non validators and repeated ones do not count
+	checkpoint, err := snap.attestCheckpoint(header, [][]byte{sign(keys[0]), sign(keys[0]), sign(keys[3]), sign(outsider)})
+	assert.Nil(t, err)
+	assert.Nil(t, checkpoint)
+	checkpoint, err = snap.attestCheckpoint(header, nil)
+	assert.Nil(t, err)
+	assert.Nil(t, checkpoint)
+
+	checkpoint, err = snap.attestCheckpoint(header, [][]byte{sign(keys[1]), sign(outsider), sign(keys[0]), sign(keys[1])})
+	assert.Nil(t, err)
+	assert.NotNil(t, checkpoint)
+	assert.Equal(t, uint64(3), checkpoint.Number)
+	assert.Equal(t, parent.Hash(), checkpoint.Hash)
+	assert.Len(t, checkpoint.Signatures, 2)
+	assert.True(t, checkpoint.Equal(checkpoint.sorted()))
+	signers, err := checkpoint.Signers()
+	assert.Nil(t, err)
+	assert.ElementsMatch(t, validators[:2], signers)
+	assert.Nil(t, snap.verifyCheckpoint(header, *checkpoint))
+
+	// The checkpoint is the parent signed once by each of the quorum
+	tests := []struct {
+		checkpoint Checkpoint
+		header     *types.Header
+	}{
+		{Checkpoint{Number: 3, Hash: parent.Hash(), Signatures: []hexutil.Bytes{sign(keys[0])}}, header},
+		{Checkpoint{Number: 3, Hash: parent.Hash(), Signatures: []hexutil.Bytes{sign(keys[0]), sign(keys[0])}}, header},
+		{Checkpoint{Number: 3, Hash: parent.Hash(), Signatures: []hexutil.Bytes{sign(keys[0]), sign(keys[3])}}, header},
+		{Checkpoint{Number: 3, Hash: parent.Hash(), Signatures: []hexutil.Bytes{sign(keys[0]), sign(keys[1])[:64]}}, header},
+		{Checkpoint{Number: 2, Hash: parent.Hash(), Signatures: checkpoint.Signatures}, header},
+		{Checkpoint{Number: 3, Hash: common.Hash{0x01}, Signatures: checkpoint.Signatures}, header},
+		{*checkpoint, newTestHeader(4, HeaderExtra{})},
+	}
+	for i, test := range tests {
+		err := snap.verifyCheckpoint(test.header, test.checkpoint)
+		assert.True(t, errors.Is(err, errInvalidCheckpoint), "test %d: %v", i, err)
+	}
+
+	// Only the transition blocks from the checkpoint block on carry one
+	config := params.EqualityConfig{Epoch: 3, CheckpointBlock: big.NewInt(4)}
+	assert.Nil(t, HeaderExtra{Epoch: 2, EpochBlock: 4, Checkpoint: checkpoint}.Validate(4, config))
+	for _, test := range []struct {
+		headerExtra HeaderExtra
+		number      uint64
+	}{
+		{HeaderExtra{Epoch: 2, EpochBlock: 4, Checkpoint: checkpoint}, 5},
+		{HeaderExtra{Epoch: 1, EpochBlock: 1, Checkpoint: checkpoint}, 1},
+		{HeaderExtra{Epoch: 2, EpochBlock: 5, Checkpoint: checkpoint}, 5},
+	} {
+		err := test.headerExtra.Validate(test.number, config)
+		assert.True(t, errors.Is(err, errInvalidCheckpoint), "block %d: %v", test.number, err)
+	}
+	config.CheckpointBlock = big.NewInt(5)
+	err = HeaderExtra{Epoch: 2, EpochBlock: 4, Checkpoint: checkpoint}.Validate(4, config)
+	assert.True(t, errors.Is(err, errInvalidCheckpoint))
+}
+
+func TestProcessCheckpointTransactions(t *testing.T) {
+	var keys []*ecdsa.PrivateKey
+	var validators []common.Address
+	for i := 0; i < 3; i++ {
+		key, _ := crypto.GenerateKey()
+		keys = append(keys, key)
+		validators = append(validators, crypto.PubkeyToAddress(key.PublicKey))
+	}
+	parent := newTestHeader(3, HeaderExtra{Epoch: 1, EpochBlock: 1})
+	header := &types.Header{Number: big.NewInt(4), ParentHash: parent.Hash()}
+
+	var txs []*types.Transaction
+	for _, key := range keys[:2] {
+		signature := signTestCheckpoint(t, key, 3, parent.Hash())
+		// Any sender relays the signature of a validator
+		txs = append(txs, newVoteTestTransaction(t, keys[2], "equality:1:event:checkpoint:"+hexutil.Encode(signature)))
+	}
+	_, err := NewTransaction(newVoteTestTransaction(t, keys[0], "equality:1:event:checkpoint:0x01"))
+	assert.NotNil(t, err)
+
+	process := func(config params.EqualityConfig, headerExtra HeaderExtra) HeaderExtra {
+		db := rawdb.NewMemoryDatabase()
+		statedb, err := state.New(common.Hash{}, state.NewDatabase(db), nil)
+		assert.Nil(t, err)
+		snap, err := newSnapshot(db)
+		assert.Nil(t, err)
+		assert.Nil(t, snap.SetValidators(validators))
+		New(&config, db).processTransactions(config, statedb, header, snap, &headerExtra, txs)
+		return headerExtra
+	}
+
+	// The transition block attests the checkpoint once the fork is active
+	config := params.EqualityConfig{Epoch: 3, MaxValidatorsCount: 3, CheckpointBlock: big.NewInt(4)}
+	headerExtra := process(config, HeaderExtra{Epoch: 2, EpochBlock: 4})
+	assert.NotNil(t, headerExtra.Checkpoint)
+	assert.Equal(t, parent.Hash(), headerExtra.Checkpoint.Hash)
+	assert.Len(t, headerExtra.Checkpoint.Signatures, 2)
+	assert.Nil(t, headerExtra.Validate(4, config))
+
+	assert.Nil(t, process(config, HeaderExtra{Epoch: 1, EpochBlock: 1}).Checkpoint)
+	config.CheckpointBlock = nil
+	assert.Nil(t, process(config, HeaderExtra{Epoch: 2, EpochBlock: 4}).Checkpoint)
+}
+
+func TestFinalizedCheckpoint(t *testing.T) {
+	key, _ := crypto.GenerateKey()
+	validator := crypto.PubkeyToAddress(key.PublicKey)
+	config := params.EqualityConfig{Epoch: 3, CheckpointBlock: big.NewInt(1)}
+	e := New(&config, rawdb.NewMemoryDatabase())
+	e.Authorize(validator, func(account accounts.Account, mimeType string, data []byte) ([]byte, error) {
+		if mimeType != accounts.MimetypeEqualityCheckpoint {
+			return nil, errors.New("unexpected mime type " + mimeType)
+		}
+		return crypto.Sign(crypto.Keccak256(data), key)
+	})
+	chain := &testHeaderChain{headers: []*types.Header{{Number: big.NewInt(0)}}}
+	api, admin := &API{chain: chain, equality: e}, &AdminAPI{chain: chain, equality: e}
+	for number := uint64(1); number <= 3; number++ {
+		header := newTestHeader(number, HeaderExtra{Epoch: 1, EpochBlock: 1})
+		header.ParentHash = chain.headers[number-1].Hash()
+		chain.headers = append(chain.headers, header)
+	}
+
+	// Only the final block of an epoch is signed
+	_, err := admin.SignCheckpoint(2)
+	assert.True(t, errors.Is(err, errInvalidCheckpoint))
+	_, err = admin.SignCheckpoint(0)
+	assert.True(t, errors.Is(err, errInvalidCheckpoint))
+
+	// A block signed through the API carries no checkpoint yet
+	result, err := admin.SignCheckpoint(3)
+	assert.Nil(t, err)
+	assert.Equal(t, validator, result.Signer)
+	assert.Equal(t, chain.headers[3].Hash(), result.Hash)
+	assert.Equal(t, "equality:1:event:checkpoint:"+hexutil.Encode(result.Signature), result.Transaction)
+	checkpoint, err := api.GetFinalizedCheckpoint(nil)
+	assert.Nil(t, err)
+	assert.Nil(t, checkpoint)
+	final, err := api.IsFinal(1)
+	assert.Nil(t, err)
+	assert.False(t, final)
+
+	// The transition carrying the signature finalizes the blocks up to its
+	// parent, the later blocks of its epoch refer back to it
+	attested := &Checkpoint{Number: 3, Hash: result.Hash, Signatures: []hexutil.Bytes{result.Signature}}
+	for number := uint64(4); number <= 5; number++ {
+		header := newTestHeader(number, HeaderExtra{Epoch: 2, EpochBlock: 4})
+		if number == 4 {
+			header = newTestHeader(number, HeaderExtra{Epoch: 2, EpochBlock: 4, Checkpoint: attested})
+		}
+		header.ParentHash = chain.headers[number-1].Hash()
+		chain.headers = append(chain.headers, header)
+	}
+	assert.Nil(t, verifyCheckpoint(chain.headers[4], *attested, []common.Address{validator}))
+	checkpoint, err = api.GetFinalizedCheckpoint(nil)
+	assert.Nil(t, err)
+	assert.Equal(t, &rpcCheckpoint{Number: 3, Hash: result.Hash, BlockNumber: 4, BlockHash: chain.headers[4].Hash(),
+		Signers: []common.Address{validator}}, checkpoint)
+	at := rpc.BlockNumber(3)
+	checkpoint, err = api.GetFinalizedCheckpoint(&at)
+	assert.Nil(t, err)
+	assert.Nil(t, checkpoint)
+	for number, expected := range []bool{true, true, true, true, false, false} {
+		final, err = api.IsFinal(rpc.BlockNumber(number))
+		assert.Nil(t, err)
+		assert.Equal(t, expected, final, "block %d", number)
+	}
+
+	// The local node signs only if authorized
+	e.Authorize(validator, nil)
+	_, err = admin.SignCheckpoint(3)
+	assert.True(t, errors.Is(err, errUnauthorized))
+}
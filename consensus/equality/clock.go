@@ -0,0 +1,151 @@
+package equality
+
+import (
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/SecretBlockChain/go-secret/common"
+	"github.com/SecretBlockChain/go-secret/core/types"
+	"github.com/SecretBlockChain/go-secret/log"
+	"github.com/SecretBlockChain/go-secret/params"
+)
+
+const (
+	clockSkewSamples     = 32              // Number of recent block arrivals the skew is the median of
+	minClockSkewSamples  = 5               // Number of block arrivals needed to estimate the skew
+	maxClockSkewArrival  = time.Minute     // Arrival delay beyond which a block is not sampled, e.g. when syncing
+	clockSkewInterval    = time.Minute     // Interval of the clock skew checks
+	clockSkewWarningSkew = 3 * time.Second // Skew beyond which the local clock is warned about
+)
+
+// errClockSkewed is returned by Seal if the local clock is skewed against the
+// recently imported blocks beyond the max clock skew.
+var errClockSkewed = errors.New("local clock skewed")
+
+// Clock is the source of the local time of the engine.
+type Clock interface {
+	Now() time.Time
+}
+
+// systemClock is the clock of the system.
+type systemClock struct{}
+
+// Now implements Clock.
+func (systemClock) Now() time.Time { return time.Now() }
+
+// clockSkew estimates the skew of the local clock as the median delay between
+// the timestamps of recent blocks of other validators and their arrival. A
+// clock ahead of the network yields a positive skew.
+type clockSkew struct {
+	arrivals []time.Duration // Arrival delays of the recent blocks, oldest first
+	estimate time.Duration   // Skew estimated at the last check
+	checked  time.Time       // Time of the last check, zero before the first one
+	maxSkew  time.Duration   // Skew beyond which sealing is refused, 0 to never refuse
+	lock     sync.Mutex
+}
+
+// SetClock sets the clock the engine reads the local time from.
+func (e *Equality) SetClock(clock Clock) {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	e.clock = clock
+}
+
+// now returns the local time of the engine clock.
+func (e *Equality) now() time.Time {
+	e.lock.RLock()
+	clock := e.clock
+	e.lock.RUnlock()
+
+	return clock.Now()
+}
+
+// SetMaxClockSkew sets the skew of the local clock against the recently
+// imported blocks beyond which Seal refuses to seal, 0 to only warn about it.
+func (e *Equality) SetMaxClockSkew(skew time.Duration) {
+	e.skew.lock.Lock()
+	defer e.skew.lock.Unlock()
+
+	e.skew.maxSkew = skew
+}
+
+// ClockSkew returns the skew of the local clock estimated at the last check,
+// and whether enough blocks were imported to estimate it.
+func (e *Equality) ClockSkew() (time.Duration, bool) {
+	e.skew.lock.Lock()
+	defer e.skew.lock.Unlock()
+
+	return e.skew.estimate, !e.skew.checked.IsZero()
+}
+
+// sampleClockSkew records the arrival of a verified header sealed by signer.
+// The skew is checked once enough blocks arrived and at every interval after,
+// blocks of the local signer and blocks arriving late are left out.
+func (e *Equality) sampleClockSkew(header *types.Header, signer common.Address) {
+	e.lock.RLock()
+	local := e.signer
+	e.lock.RUnlock()
+	now := e.now()
+	arrival := now.Sub(time.Unix(int64(header.Time), 0))
+	if signer == local || arrival > maxClockSkewArrival || arrival < -maxClockSkewArrival {
+		return
+	}
+
+	e.skew.lock.Lock()
+	defer e.skew.lock.Unlock()
+
+	e.skew.arrivals = append(e.skew.arrivals, arrival)
+	if len(e.skew.arrivals) > clockSkewSamples {
+		e.skew.arrivals = e.skew.arrivals[len(e.skew.arrivals)-clockSkewSamples:]
+	}
+	if len(e.skew.arrivals) < minClockSkewSamples {
+		return
+	}
+	if !e.skew.checked.IsZero() && now.Sub(e.skew.checked) < clockSkewInterval {
+		return
+	}
+
+	sorted := append([]time.Duration(nil), e.skew.arrivals...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	e.skew.estimate, e.skew.checked = sorted[len(sorted)/2], now
+	clockSkewGauge.Update(int64(e.skew.estimate / time.Millisecond))
+	if e.skew.estimate > clockSkewWarningSkew || e.skew.estimate < -clockSkewWarningSkew {
+		log.Warn("[equality] Local clock skewed against the network, check the time synchronization (NTP)",
+			"skew", common.PrettyDuration(e.skew.estimate), "blocks", len(sorted), "refusing", e.skew.exceeded())
+	}
+}
+
+// exceeded returns whether the estimated skew is beyond the max clock skew.
+// The lock must be held.
+func (skew *clockSkew) exceeded() bool {
+	if skew.maxSkew == 0 || skew.checked.IsZero() {
+		return false
+	}
+	return skew.estimate > skew.maxSkew || skew.estimate < -skew.maxSkew
+}
+
+// checkClockSkew returns errClockSkewed if the local clock is skewed beyond
+// the max clock skew.
+func (e *Equality) checkClockSkew() error {
+	e.skew.lock.Lock()
+	defer e.skew.lock.Unlock()
+
+	if e.skew.exceeded() {
+		return errClockSkewed
+	}
+	return nil
+}
+
+// sealDelay returns the time to wait at now before the seal of header after
+// parent is released, never before a period of config after the parent
+// whatever the local clock.
+func sealDelay(config params.EqualityConfig, parent, header *types.Header, now time.Time) time.Duration {
+	release := header.Time
+	if earliest := earliestTime(config, parent); release < earliest {
+		release = earliest
+	}
+	return time.Unix(int64(release), 0).Sub(now)
+}
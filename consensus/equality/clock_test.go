@@ -0,0 +1,134 @@
+package equality
+
+import (
+	"math/big"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/SecretBlockChain/go-secret/accounts"
+	"github.com/SecretBlockChain/go-secret/common"
+	"github.com/SecretBlockChain/go-secret/core/rawdb"
+	"github.com/SecretBlockChain/go-secret/core/types"
+	"github.com/SecretBlockChain/go-secret/crypto"
+	"github.com/SecretBlockChain/go-secret/params"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeClock is a clock moved by hand.
+type fakeClock struct {
+	now  time.Time
+	lock sync.Mutex
+}
+
+func (clock *fakeClock) Now() time.Time {
+	clock.lock.Lock()
+	defer clock.lock.Unlock()
+
+	return clock.now
+}
+
+func (clock *fakeClock) Add(d time.Duration) {
+	clock.lock.Lock()
+	defer clock.lock.Unlock()
+
+	clock.now = clock.now.Add(d)
+}
+
+func TestClockSkew(t *testing.T) {
+	config := newTestSealingConfig()
+	e := New(&config, rawdb.NewMemoryDatabase())
+	clock := &fakeClock{now: time.Unix(1700000000, 0)}
+	e.SetClock(clock)
+	e.Authorize(testUserAddress, nil)
+	peer := common.HexToAddress("0xa000000000000000000000000000000000000000")
+
+	// arrive samples a block of signer arriving delay after its timestamp
+	arrive := func(signer common.Address, delay time.Duration) {
+		header := &types.Header{Number: big.NewInt(1), Time: uint64(clock.Now().Add(-delay).Unix())}
+		e.sampleClockSkew(header, signer)
+	}
+
+	// The local blocks and the blocks arriving late are left out
+	arrive(testUserAddress, 5*time.Second)
+	arrive(peer, 2*time.Hour)
+	arrive(peer, -2*time.Hour)
+	for _, delay := range []int{4, 5, 6, 5} {
+		arrive(peer, time.Duration(delay)*time.Second)
+	}
+	_, ok := e.ClockSkew()
+	assert.False(t, ok)
+
+	// The median of the arrivals is checked with enough of them
+	arrive(peer, 30*time.Second)
+	skew, ok := e.ClockSkew()
+	assert.True(t, ok)
+	assert.Equal(t, 5*time.Second, skew)
+
+	// Later arrivals are checked once an interval
+	for i := 0; i < clockSkewSamples; i++ {
+		arrive(peer, 0)
+	}
+	skew, _ = e.ClockSkew()
+	assert.Equal(t, 5*time.Second, skew)
+	clock.Add(clockSkewInterval)
+	arrive(peer, 0)
+	skew, _ = e.ClockSkew()
+	assert.Equal(t, time.Duration(0), skew)
+}
+
+func TestSealClockSkewed(t *testing.T) {
+	config := newTestSealingConfig()
+	e := New(&config, rawdb.NewMemoryDatabase())
+	clock := &fakeClock{now: time.Now()}
+	e.SetClock(clock)
+	e.Authorize(testUserAddress, func(account accounts.Account, mimeType string, data []byte) ([]byte, error) {
+		return crypto.Sign(crypto.Keccak256(data), testUserKey)
+	})
+	genesis := &types.Header{Number: big.NewInt(0), UncleHash: uncleHash, Time: uint64(clock.Now().Unix())}
+	chain := &testHeaderChain{config: params.TestnetChainConfig, headers: []*types.Header{genesis}}
+	newBlock := func() *types.Block {
+		header := newTestHeader(1, HeaderExtra{Epoch: 1, EpochBlock: 1, CurrentEpochValidators: config.Validators})
+		header.ParentHash = genesis.Hash()
+		header.Coinbase = testUserAddress
+		header.Time = genesis.Time + config.Period
+		return types.NewBlockWithHeader(header)
+	}
+	peer := common.HexToAddress("0xa000000000000000000000000000000000000000")
+	for i := 0; i < minClockSkewSamples; i++ {
+		e.sampleClockSkew(&types.Header{Number: big.NewInt(1), Time: uint64(clock.Now().Add(-10 * time.Second).Unix())}, peer)
+	}
+
+	// A skewed clock only warns unless a max clock skew is set
+	results := make(chan *types.Block, 1)
+	assert.Nil(t, e.Seal(chain, newBlock(), results, nil))
+	select {
+	case <-results:
+	case <-time.After(time.Duration(config.Period+1) * time.Second):
+		t.Fatal("sealing result not delivered in the slot")
+	}
+	e.SetMaxClockSkew(15 * time.Second)
+	assert.Nil(t, e.Seal(chain, newBlock(), make(chan *types.Block, 1), nil))
+	e.SetMaxClockSkew(3 * time.Second)
+	assert.Equal(t, errClockSkewed, e.Seal(chain, newBlock(), make(chan *types.Block, 1), nil))
+}
+
+func TestSealDelay(t *testing.T) {
+	config := params.EqualityConfig{Period: 5}
+	parent := &types.Header{Number: big.NewInt(1), Time: 100}
+	tests := []struct {
+		time  uint64
+		now   int64
+		delay time.Duration
+	}{
+		{105, 100, 5 * time.Second},  // Prepared in time
+		{105, 107, -2 * time.Second}, // Slot passed
+		{110, 100, 10 * time.Second}, // Prepared late
+		{101, 100, 5 * time.Second},  // Prepared on a clock behind, still a period after the parent
+		{101, 104, time.Second},
+	}
+	for _, test := range tests {
+		header := &types.Header{Number: big.NewInt(2), Time: test.time}
+		assert.Equal(t, test.delay, sealDelay(config, parent, header, time.Unix(test.now, 0)))
+	}
+}
@@ -0,0 +1,201 @@
+package equality
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sync"
+
+	"github.com/SecretBlockChain/go-secret/params"
+)
+
+// Compression codecs of the header extra payload, a version 2 encoding names
+// its codec in the byte following the version byte.
+const (
+	codecNone    byte = 0x00 // uncompressed rlp, used when compression does not pay off
+	codecGzip    byte = 0x01 // compress/gzip stream
+	codecDeflate byte = 0x02 // compress/flate stream, without gzip header and trailer
+)
+
+// compressionCodec creates the compressing writers and decompressing readers
+// of a codec. They are pooled by level, a pooled one being reset to the next
+// stream it handles.
+type compressionCodec struct {
+	name        string
+	newWriter   func(w io.Writer, level int) (io.WriteCloser, error)
+	resetWriter func(zw io.WriteCloser, w io.Writer)
+	newReader   func(r io.Reader) (io.Reader, error)
+	resetReader func(zr io.Reader, r io.Reader) error
+
+	writers [flate.BestCompression - flate.HuffmanOnly + 1]sync.Pool // Writers by level from flate.HuffmanOnly on
+	readers sync.Pool
+}
+
+var compressionCodecs = map[byte]*compressionCodec{
+	codecGzip: {
+		name: "gzip",
+		newWriter: func(w io.Writer, level int) (io.WriteCloser, error) {
+			return gzip.NewWriterLevel(w, level)
+		},
+		resetWriter: func(zw io.WriteCloser, w io.Writer) {
+			zw.(*gzip.Writer).Reset(w)
+		},
+		newReader: func(r io.Reader) (io.Reader, error) {
+			return gzip.NewReader(r)
+		},
+		resetReader: func(zr io.Reader, r io.Reader) error {
+			return zr.(*gzip.Reader).Reset(r)
+		},
+	},
+	codecDeflate: {
+		name: "deflate",
+		newWriter: func(w io.Writer, level int) (io.WriteCloser, error) {
+			return flate.NewWriter(w, level)
+		},
+		resetWriter: func(zw io.WriteCloser, w io.Writer) {
+			zw.(*flate.Writer).Reset(w)
+		},
+		newReader: func(r io.Reader) (io.Reader, error) {
+			return flate.NewReader(r), nil
+		},
+		resetReader: func(zr io.Reader, r io.Reader) error {
+			return zr.(flate.Resetter).Reset(r, nil)
+		},
+	},
+}
+
+// writer returns a compressing writer of the level into w, pooled if one was
+// released before.
+func (c *compressionCodec) writer(w io.Writer, level int) (io.WriteCloser, error) {
+	if level < flate.HuffmanOnly || level > flate.BestCompression {
+		return nil, fmt.Errorf("%w: level %d", errUnknownCompression, level)
+	}
+	if zw, ok := c.writers[level-flate.HuffmanOnly].Get().(io.WriteCloser); ok {
+		c.resetWriter(zw, w)
+		return zw, nil
+	}
+	return c.newWriter(w, level)
+}
+
+// releaseWriter returns a closed writer of the level to the pool.
+func (c *compressionCodec) releaseWriter(zw io.WriteCloser, level int) {
+	c.resetWriter(zw, ioutil.Discard)
+	c.writers[level-flate.HuffmanOnly].Put(zw)
+}
+
+// reader returns a decompressing reader of r, pooled if one was released
+// before.
+func (c *compressionCodec) reader(r io.Reader) (io.Reader, error) {
+	if zr, ok := c.readers.Get().(io.Reader); ok {
+		if err := c.resetReader(zr, r); err != nil {
+			return nil, err
+		}
+		return zr, nil
+	}
+	return c.newReader(r)
+}
+
+// releaseReader returns a reader to the pool.
+func (c *compressionCodec) releaseReader(zr io.Reader) {
+	c.readers.Put(zr)
+}
+
+// Buffers of the intermediate rlp bytes of the header extras encoded and
+// decoded, the decoded values copy what they keep.
+var rlpBuffers = sync.Pool{
+	New: func() interface{} { return new(bytes.Buffer) },
+}
+
+// compressionOf returns the codec and compression level of the chain config.
+// An empty Compression selects gzip and a zero CompressionLevel the default
+// level of the codec.
+func compressionOf(config params.EqualityConfig) (byte, int, error) {
+	codec := byte(0)
+	for id, c := range compressionCodecs {
+		if c.name == config.Compression {
+			codec = id
+		}
+	}
+	if config.Compression == "" {
+		codec = codecGzip
+	}
+	if codec == 0 {
+		return 0, 0, fmt.Errorf("%w: %q", errUnknownCompression, config.Compression)
+	}
+
+	level := flate.DefaultCompression
+	if config.CompressionLevel > flate.BestCompression {
+		return 0, 0, fmt.Errorf("%w: level %d", errUnknownCompression, config.CompressionLevel)
+	}
+	if config.CompressionLevel > 0 {
+		level = int(config.CompressionLevel)
+	}
+	return codec, level, nil
+}
+
+// compress compresses data with the codec at the given level.
+func compress(codec byte, level int, data []byte) ([]byte, error) {
+	return compressAppend(nil, codec, level, data)
+}
+
+// compressAppend appends data compressed with the codec at the given level to
+// dst, growing it only if its capacity does not fit the stream.
+func compressAppend(dst []byte, codec byte, level int, data []byte) ([]byte, error) {
+	c, ok := compressionCodecs[codec]
+	if !ok {
+		return nil, errUnknownCompression
+	}
+
+	buffer := bytes.NewBuffer(dst)
+	w, err := c.writer(buffer, level)
+	if err != nil {
+		return nil, err
+	}
+	if _, err = w.Write(data); err != nil {
+		return nil, err
+	}
+	if err = w.Close(); err != nil {
+		return nil, err
+	}
+	c.releaseWriter(w, level)
+	return buffer.Bytes(), nil
+}
+
+// decompress inflates a stream of the codec to at most limit bytes.
+func decompress(codec byte, data []byte, limit uint64) ([]byte, error) {
+	return decompressTo(bytes.NewBuffer(nil), codec, data, limit)
+}
+
+// decompressTo inflates a stream of the codec to at most limit bytes into
+// buffer, returning its bytes. An uncompressed stream is returned as is.
+func decompressTo(buffer *bytes.Buffer, codec byte, data []byte, limit uint64) ([]byte, error) {
+	if codec == codecNone {
+		if uint64(len(data)) > limit {
+			return nil, errHeaderExtraTooLarge
+		}
+		return data, nil
+	}
+
+	c, ok := compressionCodecs[codec]
+	if !ok {
+		return nil, errUnknownCompression
+	}
+
+	r, err := c.reader(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", errInvalidHeaderExtraCompression, err)
+	}
+	defer c.releaseReader(r)
+
+	n, err := buffer.ReadFrom(io.LimitReader(r, int64(limit)+1))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", errInvalidHeaderExtraCompression, err)
+	}
+	if uint64(n) > limit {
+		return nil, errHeaderExtraTooLarge
+	}
+	return buffer.Bytes(), nil
+}
@@ -2,10 +2,13 @@ package equality
 
 import (
 	"bytes"
+	"context"
 	"errors"
 	"fmt"
 	"io"
 	"math/big"
+	"runtime"
+	"strings"
 	"time"
 
 	"github.com/SecretBlockChain/go-secret/accounts"
@@ -30,10 +33,10 @@ func ecrecover(header *types.Header, sigcache *lru.ARCCache) (common.Address, er
 		return address.(common.Address), nil
 	}
 	// Retrieve the signature from the header extra-data
-	if len(header.Extra) < extraSeal {
+	if len(header.Extra) < ExtraSeal {
 		return common.Address{}, errMissingSignature
 	}
-	signature := header.Extra[len(header.Extra)-extraSeal:]
+	signature := header.Extra[len(header.Extra)-ExtraSeal:]
 
 	// Recover the public key and the Ethereum address
 	pubkey, err := crypto.Ecrecover(SealHash(header).Bytes(), signature)
@@ -58,24 +61,74 @@ func (e *Equality) Author(header *types.Header) (common.Address, error) {
 // given engine. Verifying the seal may be done optionally here, or explicitly
 // via the VerifySeal method.
 func (e *Equality) VerifyHeader(chain consensus.ChainHeaderReader, header *types.Header, seal bool) error {
-	return e.verifyHeader(chain, header, nil)
+	return e.verifyHeader(chain, header, nil, nil)
+}
+
+// headerPrecheck is the outcome of the checks of a header not depending on its
+// parent, done ahead of the sequential verification. The header extra is
+// decoded within the size limit of the chain config expected for the batch.
+type headerPrecheck struct {
+	err         error       // Failure of the standalone checks
+	headerExtra HeaderExtra // Header extra decoded within limit
+	decodeErr   error       // Failure decoding the header extra
+	limit       uint64      // Decompressed size limit of the decoding
 }
 
 // VerifyHeaders is similar to VerifyHeader, but verifies a batch of headers
 // concurrently. The method returns a quit channel to abort the operations and
 // a results channel to retrieve the async verifications (the order is that of
 // the input slice).
+//
+// A pool of workers checks the standalone fields, decodes the header extras
+// and recovers the signers ahead, while the checks depending on the parent are
+// done in order of the headers.
 func (e *Equality) VerifyHeaders(chain consensus.ChainHeaderReader, headers []*types.Header, seals []bool) (chan<- struct{}, <-chan error) {
 	abort := make(chan struct{})
 	results := make(chan error, len(headers))
-	numbers := make([]int64, 0)
-	for _, header := range headers {
-		numbers = append(numbers, header.Number.Int64())
+	if len(headers) == 0 {
+		return abort, results
+	}
+
+	workers := runtime.GOMAXPROCS(0)
+	if len(headers) < workers {
+		workers = len(headers)
+	}
+	var (
+		limit  = e.batchExtraLimit(chain, headers[0])
+		inputs = make(chan int)
+		checks = make([]headerPrecheck, len(headers))
+		done   = make([]chan struct{}, len(headers))
+	)
+	for i := range done {
+		done[i] = make(chan struct{})
+	}
+	for i := 0; i < workers; i++ {
+		go func() {
+			for index := range inputs {
+				checks[index] = e.precheckHeader(headers[index], limit)
+				close(done[index])
+			}
+		}()
 	}
+	go func() {
+		defer close(inputs)
+		for index := range headers {
+			select {
+			case inputs <- index:
+			case <-abort:
+				return
+			}
+		}
+	}()
 
 	go func() {
 		for i, header := range headers {
-			err := e.verifyHeader(chain, header, headers[:i])
+			select {
+			case <-done[i]:
+			case <-abort:
+				return
+			}
+			err := e.verifyHeader(chain, header, headers[:i], &checks[i])
 			select {
 			case <-abort:
 				return
@@ -86,26 +139,84 @@ func (e *Equality) VerifyHeaders(chain consensus.ChainHeaderReader, headers []*t
 	return abort, results
 }
 
+// batchExtraLimit returns the header extra size limit of the chain config
+// after the parent of the first header of a batch, the one of the engine if
+// the parent is unknown. Header extras of the batch are decoded ahead within
+// it, a config changing the limit within the batch has them decoded again.
+func (e *Equality) batchExtraLimit(chain consensus.ChainHeaderReader, first *types.Header) uint64 {
+	config := *e.config
+	if first.Number != nil && first.Number.Uint64() > 1 {
+		if parent := chain.GetHeader(first.ParentHash, first.Number.Uint64()-1); parent != nil {
+			if parentConfig, err := e.chainConfig(parent); err == nil {
+				config = parentConfig
+			}
+		}
+	}
+	return headerExtraLimit(config)
+}
+
+// precheckHeader checks the fields of a header not depending on its parent,
+// decodes its header extra within limit and caches its signer.
+func (e *Equality) precheckHeader(header *types.Header, limit uint64) headerPrecheck {
+	if err := verifyStandalone(header, e.latestTime()); err != nil {
+		return headerPrecheck{err: err}
+	}
+	check := headerPrecheck{limit: limit}
+	if header.Number.Uint64() > 0 {
+		check.headerExtra, check.decodeErr = decodeHeaderExtraWithLimit(header, limit)
+		ecrecover(header, e.signatures)
+	}
+	return check
+}
+
 // verifyHeader checks whether a header conforms to the consensus rules.The
 // caller may optionally pass in a batch of parents (ascending order) to avoid
-// looking those up from the database. This is useful for concurrently verifying
-// a batch of new headers.
-func (e *Equality) verifyHeader(chain consensus.ChainHeaderReader, header *types.Header, parents []*types.Header) error {
+// looking those up from the database, and the precheck of the header done
+// ahead. This is useful for concurrently verifying a batch of new headers.
+func (e *Equality) verifyHeader(chain consensus.ChainHeaderReader, header *types.Header, parents []*types.Header, check *headerPrecheck) error {
+	if check == nil {
+		if err := verifyStandalone(header, e.latestTime()); err != nil {
+			return err
+		}
+	} else if check.err != nil {
+		return check.err
+	}
+
+	// The headers up to the trusted checkpoint are only checked to connect to it
+	if trusted, err := e.trustedHeader(header); trusted || err != nil {
+		return err
+	}
+
+	// All basic checks passed, verify cascading fields
+	err := e.verifyCascadingFields(chain, header, parents, check)
+	if err != nil {
+		log.Warn("[equality] Failed to verify cascading fields", "number", header.Number.Int64(), "reason", err)
+		return err
+	}
+	if signer, err := ecrecover(header, e.signatures); err == nil && header.Number.Sign() > 0 {
+		e.sampleClockSkew(header, signer)
+	}
+	return nil
+}
+
+// verifyStandalone checks the header fields not depending on other headers,
+// latest being the latest timestamp accepted from the local clock.
+func verifyStandalone(header *types.Header, latest uint64) error {
 	if header.Number == nil {
 		return errUnknownBlock
 	}
 	log.Trace("[equality] VerifyHeader", "number", header.Number.Int64())
 
 	// Don't waste time checking blocks from the future
-	if header.Time > uint64(time.Now().Unix()) {
-		return consensus.ErrFutureBlock
+	if header.Time > latest {
+		return fmt.Errorf("%w: timestamp %d beyond %d", consensus.ErrFutureBlock, header.Time, latest)
 	}
 
 	// Check that the extra-data contains both the vanity and signature
-	if len(header.Extra) < extraVanity {
+	if len(header.Extra) < ExtraVanity {
 		return errMissingVanity
 	}
-	if len(header.Extra) < extraVanity+extraSeal {
+	if len(header.Extra) < ExtraVanity+ExtraSeal {
 		return errMissingSignature
 	}
 
@@ -118,20 +229,15 @@ func (e *Equality) verifyHeader(chain consensus.ChainHeaderReader, header *types
 	if header.UncleHash != uncleHash {
 		return errInvalidUncleHash
 	}
-
-	// All basic checks passed, verify cascading fields
-	err := e.verifyCascadingFields(chain, header, parents)
-	if err != nil {
-		log.Warn("[equality] Failed to verify cascading fields", "number", header.Number.Int64(), "reason", err)
-	}
-	return err
+	return nil
 }
 
 // verifyCascadingFields verifies all the header fields that are not standalone,
 // rather depend on a batch of previous headers. The caller may optionally pass
 // in a batch of parents (ascending order) to avoid looking those up from the
-// database. This is useful for concurrently verifying a batch of new headers.
-func (e *Equality) verifyCascadingFields(chain consensus.ChainHeaderReader, header *types.Header, parents []*types.Header) error {
+// database, and the precheck of the header to reuse its decoded header extra.
+// This is useful for concurrently verifying a batch of new headers.
+func (e *Equality) verifyCascadingFields(chain consensus.ChainHeaderReader, header *types.Header, parents []*types.Header, check *headerPrecheck) error {
 	// The genesis block is the always valid dead-end
 	number := header.Number.Uint64()
 	if number == 0 {
@@ -148,26 +254,21 @@ func (e *Equality) verifyCascadingFields(chain consensus.ChainHeaderReader, head
 	if parent == nil || parent.Number.Uint64() != number-1 || parent.Hash() != header.ParentHash {
 		return consensus.ErrUnknownAncestor
 	}
-	if parent.Time > header.Time {
-		return ErrInvalidTimestamp
-	}
 
 	// Load snapshot of parent block
+	var err error
 	var snap *Snapshot
+	var parentHeaderExtra HeaderExtra
 	config := *e.config
-	headerExtra, err := DecodeHeaderExtra(header)
+	if len(parents) > 0 {
+		parents = parents[:len(parents)-1]
+	}
+	snap, err = e.snapshot(chain, parent, parents)
 	if err != nil {
 		return err
 	}
-
-	parentHeaderExtra := headerExtra
-	if parent.Number.Int64() == 0 {
-		snap, err = newSnapshot(e.db)
-		if err != nil {
-			return err
-		}
-	} else {
-		parentHeaderExtra, err = DecodeHeaderExtra(parent)
+	if parent.Number.Int64() > 0 {
+		parentHeaderExtra, err = e.DecodeHeaderExtraCached(parent)
 		if err != nil {
 			return err
 		}
@@ -176,19 +277,52 @@ func (e *Equality) verifyCascadingFields(chain consensus.ChainHeaderReader, head
 		if err != nil {
 			return err
 		}
+	}
+	if earliest := earliestTime(config, parent); header.Time < earliest {
+		return fmt.Errorf("%w: timestamp %d before %d, a period of %ds after the parent",
+			ErrInvalidTimestamp, header.Time, earliest, config.Period)
+	}
 
-		snap, err = loadSnapshot(e.db, parentHeaderExtra.Root)
-		if err != nil {
-			return err
-		}
+	// Decode HeaderExtra within the size limits of the chain config
+	if limit := headerExtraBytesLimit(config); uint64(len(header.Extra)) > limit {
+		return classify(ProtocolViolation, fmt.Errorf("%w: %d encoded bytes > %d", errHeaderExtraTooLarge, len(header.Extra), limit))
+	}
+	var headerExtra HeaderExtra
+	if limit := headerExtraLimit(config); check != nil && check.limit == limit {
+		headerExtra, err = check.headerExtra, check.decodeErr
+	} else {
+		headerExtra, err = decodeHeaderExtraWithLimit(header, limit)
+	}
+	if err != nil {
+		return classify(ProtocolViolation, err)
+	}
+	if err = headerExtra.Validate(number, config); err != nil {
+		return err
+	}
+	e.headerExtras.Add(header.Hash(), headerExtra)
+	if parent.Number.Int64() == 0 {
+		parentHeaderExtra = headerExtra
 	}
 
-	// Ensure that the epoch timestamp and parent block are continuous
+	// Ensure that the epoch timestamp and parent block are continuous, the
+	// epoch advancing at the end of the running epoch
 	if headerExtra.Epoch != parentHeaderExtra.Epoch || headerExtra.EpochBlock != parentHeaderExtra.EpochBlock {
 		if headerExtra.Epoch != parentHeaderExtra.Epoch+1 || headerExtra.EpochBlock != number {
 			return ErrInvalidTimestamp
 		}
 	}
+	if parent.Number.Int64() > 0 {
+		length, err := snap.GetEpochLength(config)
+		if err != nil {
+			return err
+		}
+		epoch, epochBlock := nextEpoch(parentHeaderExtra, number, length)
+		if headerExtra.Epoch != epoch || headerExtra.EpochBlock != epochBlock {
+			return fmt.Errorf("%w: epoch %d at %d, want %d at %d", errInvalidEpochBlock,
+				headerExtra.Epoch, headerExtra.EpochBlock, epoch, epochBlock)
+		}
+		e.precomputeElection(chain, config, parent, parentHeaderExtra, length)
+	}
 
 	// Retrieve the snapshot needed to verify this header and cache it
 	err = snap.apply(config, header, headerExtra)
@@ -201,19 +335,27 @@ func (e *Equality) verifyCascadingFields(chain consensus.ChainHeaderReader, head
 		return err
 	}
 	if root != headerExtra.Root {
-		root.PrintDifference(number, headerExtra.Root)
-		parentHeaderExtra.Root.PrintDifference(number, headerExtra.Root)
-		return errors.New(fmt.Sprintf("invalid trie root, coinbase: %s", header.Coinbase.String()))
+		diff := root.fieldDifference(headerExtra.Root)
+		e.mismatches.report("root", number, header.Hash(), diff)
+		log.Debug("[equality] Trie roots changed by block", "number", number,
+			"changed", strings.Join(parentHeaderExtra.Root.Difference(headerExtra.Root), ", "))
+		err = rootMismatchError(number, root, headerExtra.Root)
+		e.recordFault(faultBadRoot, header, err, e.faultSigner(header), diff)
+		return classify(PossibleFork, err)
 	}
 
 	// Verify the seal and return
-	err = e.verifySeal(config, header, parent)
+	err = e.verifySeal(chain, config, header, parent, parents)
+	if errors.Is(err, errUnauthorized) || errors.Is(err, errUnauthorizedValidator) {
+		e.recordFault(faultUnauthorizedSigner, header, err, e.faultSigner(header), nil)
+		err = classify(ProtocolViolation, err)
+	}
 	if err != nil {
 		return err
 	}
 
-	// All basic checks passed, save snapshot to disk
-	if err = snap.Commit(root); err != nil {
+	// All basic checks passed, keep the snapshot
+	if err = e.snapshots.add(number, root); err != nil {
 		return errors.New("failed to write snapshot")
 	}
 	return nil
@@ -233,6 +375,9 @@ func (e *Equality) VerifyUncles(chain consensus.ChainReader, block *types.Block)
 func (e *Equality) VerifySeal(chain consensus.ChainHeaderReader, header *types.Header) error {
 	log.Trace("[equality] VerifySeal", "number", header.Number.Int64())
 
+	if trusted, err := e.trustedHeader(header); trusted || err != nil {
+		return err
+	}
 	config := *e.config
 	parent := chain.GetHeader(header.ParentHash, header.Number.Uint64()-1)
 	if header.Number.Int64() > 1 {
@@ -242,14 +387,15 @@ func (e *Equality) VerifySeal(chain consensus.ChainHeaderReader, header *types.H
 			return err
 		}
 	}
-	return e.verifySeal(config, header, parent)
+	return e.verifySeal(chain, config, header, parent, nil)
 }
 
 // verifySeal checks whether the signature contained in the header satisfies the
 // consensus protocol requirements. The method accepts an optional list of parent
 // headers that aren't yet part of the local blockchain to generate the snapshots
 // from.
-func (e *Equality) verifySeal(config params.EqualityConfig, header, parent *types.Header) error {
+func (e *Equality) verifySeal(chain consensus.ChainHeaderReader, config params.EqualityConfig,
+	header, parent *types.Header, parents []*types.Header) error {
 	// Verifying the genesis block is not supported
 	number := header.Number.Uint64()
 	if number == 0 {
@@ -261,10 +407,26 @@ func (e *Equality) verifySeal(config params.EqualityConfig, header, parent *type
 	if err != nil {
 		return err
 	}
+	if signer, err = e.blockValidator(config, header, parent, signer); err != nil {
+		return err
+	}
+	if config.IsTurn(header.Number) {
+		if parent == nil {
+			return consensus.ErrUnknownAncestor
+		}
+		return e.verifyTurn(chain, config, header, parent, parents, signer)
+	}
+	validators, err := e.sealingValidators(config, parent)
+	if err != nil {
+		return err
+	}
+	if err = checkValidator(validators, signer); err != nil {
+		return err
+	}
 	if !e.inTurn(config, parent, header.Time, signer) {
 		return errUnauthorized
 	}
-	return nil
+	return e.checkSlotRecent(chain, config, parent, parents, signer)
 }
 
 // Prepare initializes the consensus fields of a block header according to the
@@ -275,9 +437,6 @@ func (e *Equality) Prepare(chain consensus.ChainHeaderReader, header *types.Head
 	// Mix digest is reserved for now, set to empty
 	header.MixDigest = common.Hash{}
 
-	// Set the correct difficulty
-	header.Difficulty = e.CalcDifficulty(chain, 0, nil)
-
 	// Initialize HeaderExtra, update epoch for block
 	var headerExtra HeaderExtra
 	var config params.EqualityConfig
@@ -286,10 +445,14 @@ func (e *Equality) Prepare(chain consensus.ChainHeaderReader, header *types.Head
 	if parent == nil {
 		return consensus.ErrUnknownAncestor
 	}
+
+	// Set the correct difficulty
+	header.Difficulty = e.CalcDifficulty(chain, header.Time, parent)
+
 	if number == 1 {
 		config = *e.config
-		now := time.Now().Unix()
-		header.Time = parent.Time + config.Period
+		now := e.now().Unix()
+		header.Time = earliestTime(config, parent)
 		if int64(header.Time) < now {
 			header.Time = uint64(now)
 		}
@@ -297,7 +460,7 @@ func (e *Equality) Prepare(chain consensus.ChainHeaderReader, header *types.Head
 		headerExtra.Epoch = 1
 		headerExtra.EpochBlock = number
 	} else {
-		parentHeaderExtra, err := DecodeHeaderExtra(parent)
+		parentHeaderExtra, err := e.DecodeHeaderExtraCached(parent)
 		if err != nil {
 			return err
 		}
@@ -307,33 +470,41 @@ func (e *Equality) Prepare(chain consensus.ChainHeaderReader, header *types.Head
 			return err
 		}
 
-		now := time.Now().Unix()
-		header.Time = parent.Time + config.Period
+		now := e.now().Unix()
+		header.Time = earliestTime(config, parent)
 		if int64(header.Time) < now {
 			header.Time = uint64(now)
 		}
 
 		headerExtra.Root = parentHeaderExtra.Root
-		headerExtra.Epoch = parentHeaderExtra.Epoch
-		headerExtra.EpochBlock = parentHeaderExtra.EpochBlock
-		if number-headerExtra.EpochBlock == config.Epoch {
-			headerExtra.Epoch = parentHeaderExtra.Epoch + 1
-			headerExtra.EpochBlock = number
+		length, err := e.snapshots.open(parentHeaderExtra.Root).GetEpochLength(config)
+		if err != nil {
+			return err
 		}
+		headerExtra.Epoch, headerExtra.EpochBlock = nextEpoch(parentHeaderExtra, number, length)
+		e.precomputeElection(chain, config, parent, parentHeaderExtra, length)
+	}
+
+	// From the sealer key block on, the block of a validator sealing with
+	// another key is coinbased to the validator
+	e.lock.RLock()
+	signer := e.signer
+	e.lock.RUnlock()
+	if config.IsSealerKey(header.Number) && header.Coinbase == signer {
+		header.Coinbase = e.localValidator(config, parent, signer)
 	}
 
 	// Ensure the extra data has HeaderExtra struct
-	data, err := headerExtra.Encode()
+	data, err := headerExtra.EncodeWith(config)
 	if err != nil {
 		return err
 	}
 
-	if len(header.Extra) < extraVanity {
-		header.Extra = append(header.Extra, bytes.Repeat([]byte{0x00}, extraVanity-len(header.Extra))...)
+	vanity := e.Vanity()
+	if vanity == nil {
+		vanity = header.Extra
 	}
-	header.Extra = header.Extra[:extraVanity]
-	header.Extra = append(header.Extra, data...)
-	header.Extra = append(header.Extra, bytes.Repeat([]byte{0x00}, extraSeal)...)
+	header.Extra = assembleExtra(vanity, data)
 	return nil
 }
 
@@ -347,56 +518,98 @@ func (e *Equality) Finalize(chain consensus.ChainHeaderReader, header *types.Hea
 
 	log.Trace("[equality] Finalize", "number", header.Number.Int64())
 
+	if err := e.applySystemOperations(chain, header, state, txs, nil); err != nil {
+		state.Reset(common.Hash{})
+	}
+}
+
+// applySystemOperations replays the system operations of the block of header
+// on state, recording them into journal if not nil, and checks they yield its
+// header extra.
+func (e *Equality) applySystemOperations(chain consensus.ChainHeaderReader, header *types.Header, state *state.StateDB, txs []*types.Transaction,
+	journal *systemJournal) error {
+
 	// Load snapshot of parent block
 	var snap *Snapshot
 	number := header.Number.Uint64()
-	headerExtra, err := DecodeHeaderExtra(header)
+	headerExtra, err := e.DecodeHeaderExtraCached(header)
 	if err != nil {
-		state.Reset(common.Hash{})
-		return
+		return err
 	}
 
 	parent := chain.GetHeader(header.ParentHash, header.Number.Uint64()-1)
-	if number <= 1 {
-		snap, err = newSnapshot(e.db)
-	} else {
-		parentHeaderExtra, err := DecodeHeaderExtra(parent)
-		if err != nil {
-			state.Reset(common.Hash{})
-			return
-		}
-		snap, err = loadSnapshot(e.db, parentHeaderExtra.Root)
+	if parent == nil {
+		return consensus.ErrUnknownAncestor
 	}
+	snap, err = e.snapshot(chain, parent, nil)
 	if err != nil {
-		state.Reset(common.Hash{})
-		return
+		return err
 	}
+	snap.journal = journal
+	parentSnap := e.snapshots.open(snap.root)
 
 	// Get the chain configuration
 	config, err := e.chainConfig(parent)
 	if err != nil {
-		state.Reset(common.Hash{})
-		return
+		return err
 	}
 
 	// Accumulate any block rewards and commit the final state root
-	e.accumulateRewards(config, state, header)
+	e.accumulateRewards(config, state, header, snap)
+
+	// Reject the candidates that may not stand before replaying, the replay
+	// would only tell the candidates differ
+	for _, candidate := range headerExtra.CurrentBlockCandidates {
+		if err = candidateEligible(config, state, header.Number, candidate); err != nil {
+			log.Warn("[equality] Invalid block candidate", "number", number, "hash", header.Hash(), "err", err)
+			return err
+		}
+	}
 
 	// Replay custom transactions and check HeaderExtra of block header
 	temp := HeaderExtra{
-		Root:       headerExtra.Root,
 		Epoch:      headerExtra.Epoch,
 		EpochBlock: headerExtra.EpochBlock,
 	}
+	if err = snap.MintBlock(temp.Epoch, number, header.Coinbase); err != nil {
+		return err
+	}
 	e.processTransactions(config, state, header, snap, &temp, txs)
-	if err = e.tryElect(config, header, snap, &temp); err != nil || !temp.Equal(headerExtra) {
-		state.Reset(common.Hash{})
-		return
+	ranking, err := e.electionRankingOf(chain, config, header, parent, temp)
+	if err != nil {
+		return err
+	}
+	if err = e.tryElect(config, state, header, snap, &temp, ranking); err != nil {
+		return err
+	}
+	if err = snap.activateChainConfig(number); err != nil {
+		return err
+	}
+	if err = snap.settleEpochLength(config, number, temp.EpochBlock); err != nil {
+		return err
+	}
+	if temp.Root, err = snap.Root(); err != nil {
+		return err
+	}
+	if temp.Hash() != headerExtra.Hash() {
+		diff := temp.Difference(headerExtra)
+		e.mismatches.report("header extra", number, header.Hash(), diff)
+		e.recordHeaderExtraFault(header, diff)
+		return errHeaderExtraMismatch
+	}
+
+	if err = emitCandidateLogs(config, state, header, len(txs), parentSnap, snap, headerExtra); err != nil {
+		return err
+	}
+	if journal == nil {
+		// The metrics of a traced block were reported at its import
+		reportMetrics(config, number, len(header.Extra), snap, headerExtra)
 	}
 
 	// Accumulate any block and uncle rewards and commit the final state root
 	header.Root = state.IntermediateRoot(chain.Config().IsEIP158(header.Number))
 	header.UncleHash = types.CalcUncleHash(nil)
+	return nil
 }
 
 // FinalizeAndAssemble runs any post-transaction state modifications (e.g. block
@@ -419,17 +632,15 @@ func (e *Equality) FinalizeAndAssemble(chain consensus.ChainHeaderReader, header
 		EpochBlock: oldHeaderExtra.EpochBlock,
 	}
 	parent := chain.GetHeader(header.ParentHash, header.Number.Uint64()-1)
-	if header.Number.Int64() > 1 {
-		parentHeaderExtra, err := DecodeHeaderExtra(parent)
-		if err != nil {
-			return nil, err
-		}
-		headerExtra.Root = parentHeaderExtra.Root
+	if parent == nil {
+		return nil, consensus.ErrUnknownAncestor
 	}
-	snap, err := loadSnapshot(e.db, headerExtra.Root)
+	snap, err := e.snapshot(chain, parent, nil)
 	if err != nil {
 		return nil, err
 	}
+	headerExtra.Root = snap.root
+	parentSnap := e.snapshots.open(snap.root)
 
 	// Get the chain configuration
 	config, err := e.chainConfig(parent)
@@ -438,7 +649,7 @@ func (e *Equality) FinalizeAndAssemble(chain consensus.ChainHeaderReader, header
 	}
 
 	// Accumulate any block rewards and commit the final state root
-	e.accumulateRewards(config, state, header)
+	e.accumulateRewards(config, state, header, snap)
 
 	// Save validator of block to snapshot
 	if err = snap.MintBlock(headerExtra.Epoch, header.Number.Uint64(), header.Coinbase); err != nil {
@@ -449,28 +660,46 @@ func (e *Equality) FinalizeAndAssemble(chain consensus.ChainHeaderReader, header
 	e.processTransactions(config, state, header, snap, &headerExtra, txs)
 
 	// Elect validators in first block for epoch
-	if err = e.tryElect(config, header, snap, &headerExtra); err != nil {
+	ranking, err := e.electionRankingOf(chain, config, header, parent, headerExtra)
+	if err != nil {
+		return nil, err
+	}
+	if err = e.tryElect(config, state, header, snap, &headerExtra, ranking); err != nil {
 		log.Warn("[equality] Failed to try elect", "reason", err)
 		return nil, err
 	}
 
-	// Save snapshot of current block to db
+	// Take the chain config scheduled for the next block into effect
+	if err = snap.activateChainConfig(header.Number.Uint64()); err != nil {
+		return nil, err
+	}
+	if err = snap.settleEpochLength(config, header.Number.Uint64(), headerExtra.EpochBlock); err != nil {
+		return nil, err
+	}
+
+	// Save snapshot of current block
 	headerExtra.Root, err = snap.Root()
 	if err != nil {
 		return nil, err
 	}
-	if err = snap.Commit(headerExtra.Root); err != nil {
+	if err = e.snapshots.add(header.Number.Uint64(), headerExtra.Root); err != nil {
 		return nil, err
 	}
 
 	// Write HeaderExtra of current block into header.Extra
-	data, err := headerExtra.Encode()
+	data, err := headerExtra.EncodeWith(config)
 	if err != nil {
 		return nil, err
 	}
-	header.Extra = header.Extra[:extraVanity]
-	header.Extra = append(header.Extra, data...)
-	header.Extra = append(header.Extra, bytes.Repeat([]byte{0x00}, extraSeal)...)
+	header.Extra = assembleExtra(header.Extra, data)
+
+	// Log the candidate changes into a trailing receipt
+	if err = emitCandidateLogs(config, state, header, len(txs), parentSnap, snap, headerExtra); err != nil {
+		return nil, err
+	}
+	if logs := state.GetLogs(common.Hash{}); len(logs) > 0 {
+		receipts = append(receipts, types.NewSystemReceipt(logs, header.GasUsed))
+	}
 
 	header.Root = state.IntermediateRoot(chain.Config().IsEIP158(header.Number))
 	header.UncleHash = types.CalcUncleHash(nil)
@@ -491,13 +720,16 @@ func (e *Equality) Seal(chain consensus.ChainHeaderReader, block *types.Block, r
 	if number == 0 {
 		return errUnknownBlock
 	}
+	if e.closed() {
+		return errEngineClosed
+	}
 
 	// Check that the extra-data contains both the vanity and signature
-	if len(header.Extra) < extraVanity {
+	if len(header.Extra) < ExtraVanity {
 		return errMissingVanity
 	}
 
-	if len(header.Extra) < extraVanity+extraSeal {
+	if len(header.Extra) < ExtraVanity+ExtraSeal {
 		return errMissingSignature
 	}
 
@@ -508,31 +740,106 @@ func (e *Equality) Seal(chain consensus.ChainHeaderReader, block *types.Block, r
 		return err
 	}
 
-	// Bail out if we're unauthorized to sign a block
-	if !e.inTurn(config, parent, header.Time, header.Coinbase) {
+	// For 0-period chains, refuse to seal empty blocks (no reward but would spin sealing)
+	if config.IsDevMode() && len(block.Transactions()) == 0 {
+		log.Info("[equality] Sealing paused, waiting for transactions")
+		return nil
+	}
+
+	// Bail out if we're unauthorized to sign a block, out of turn validators
+	// wait for the block in turn to propagate
+	var wiggle time.Duration
+	if config.IsTurn(header.Number) {
+		ok, delay := e.maySeal(chain, config, parent, header.Coinbase)
+		if !ok {
+			return errUnauthorized
+		}
+		wiggle = delay
+	} else if !e.inTurn(config, parent, header.Time, header.Coinbase) {
 		return errUnauthorized
+	} else if err = e.checkSlotRecent(chain, config, parent, nil, header.Coinbase); err != nil {
+		return err
 	}
 
-	// Don't hold the signer fields for the entire sealing procedure
+	// Don't hold the signer fields for the entire sealing procedure, the
+	// header is prepared for the signer authorized at the time
 	e.lock.RLock()
 	signer, signFn := e.signer, e.signFn
 	e.lock.RUnlock()
+	if signFn == nil {
+		return errUnauthorized
+	}
+	if validator, err := e.blockValidator(config, header, parent, signer); err != nil || validator != header.Coinbase {
+		return errUnauthorized
+	}
 
-	// Sign all the things!
-	sigHash, err := signFn(accounts.Account{Address: signer}, accounts.MimetypeClique, EqualityRLP(header))
-	if err != nil {
+	// Refuse to seal on a clock skewed against the network if configured to,
+	// the block would be rejected or delay the next ones
+	if err = e.checkClockSkew(); err != nil {
+		skew, _ := e.ClockSkew()
+		log.Warn("[equality] Sealing refused, local clock skewed", "skew", common.PrettyDuration(skew))
 		return err
 	}
-	copy(header.Extra[len(header.Extra)-extraSeal:], sigHash)
 
-	// Wait until sealing is terminated or delay timeout.
-	delay := time.Unix(int64(header.Time), 0).Sub(time.Now())
+	// Sign while waiting for the slot, remote signers may take a while to
+	// answer. The signature is given up once the slot has passed, the blocks
+	// of a dev chain are sealed at once and wait for the signer until stopped.
+	// The slot is never before a period after the parent, whatever the local
+	// clock the header was prepared with.
+	delay := sealDelay(config, parent, header, e.now()) + wiggle
+	if config.IsDevMode() {
+		delay = 0
+	}
+	slot := time.Now().Add(delay)
+
+	// Register the sealing procedure for Close to wait for it, unless the
+	// engine has been closed meanwhile
+	e.lock.RLock()
+	if e.closed() {
+		e.lock.RUnlock()
+		return errEngineClosed
+	}
+	e.sealers.Add(2)
+	e.lock.RUnlock()
+
+	var (
+		ctx    context.Context
+		cancel context.CancelFunc
+	)
+	if config.IsDevMode() {
+		ctx, cancel = context.WithCancel(context.Background())
+	} else {
+		ctx, cancel = context.WithDeadline(context.Background(), slot.Add(time.Duration(config.Period)*time.Second))
+	}
 	log.Info("[equality] Waiting for slot to sign and propagate", "delay", common.PrettyDuration(delay))
 	go func() {
+		defer e.sealers.Done()
 		select {
 		case <-stop:
+			cancel()
+		case <-e.quit:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	go func() {
+		defer e.sealers.Done()
+		defer cancel()
+
+		sigHash, err := signHeader(ctx, signFn, signer, header)
+		if err != nil {
+			if !errors.Is(err, context.Canceled) {
+				log.Warn("[equality] Failed to sign block", "number", number, "err", err)
+			}
 			return
-		case <-time.After(delay):
+		}
+		copy(header.Extra[len(header.Extra)-ExtraSeal:], sigHash)
+
+		// Wait until sealing is terminated or delay timeout.
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(time.Until(slot)):
 		}
 
 		select {
@@ -544,6 +851,30 @@ func (e *Equality) Seal(chain consensus.ChainHeaderReader, block *types.Block, r
 	return nil
 }
 
+// signHeader requests the signature of the header from signFn, the full header
+// rlp is passed for external signers to check it. It gives up once ctx is done.
+func signHeader(ctx context.Context, signFn SignerFn, signer common.Address, header *types.Header) ([]byte, error) {
+	type signature struct {
+		sigHash []byte
+		err     error
+	}
+	signed := make(chan signature, 1)
+	go func() {
+		sigHash, err := signFn(accounts.Account{Address: signer}, accounts.MimetypeEquality, EqualityRLP(header))
+		signed <- signature{sigHash, err}
+	}()
+
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case result := <-signed:
+		if result.err == nil && len(result.sigHash) != ExtraSeal {
+			return nil, fmt.Errorf("invalid signature length %d", len(result.sigHash))
+		}
+		return result.sigHash, result.err
+	}
+}
+
 // SealHash returns the hash of a block prior to it being sealed.
 func (e *Equality) SealHash(header *types.Header) (hash common.Hash) {
 	return SealHash(header)
@@ -552,7 +883,22 @@ func (e *Equality) SealHash(header *types.Header) (hash common.Hash) {
 // CalcDifficulty is the difficulty adjustment algorithm. It returns the difficulty
 // that a new block should have.
 func (e *Equality) CalcDifficulty(chain consensus.ChainHeaderReader, time uint64, parent *types.Header) *big.Int {
-	return big.NewInt(defaultDifficulty)
+	if parent == nil {
+		return big.NewInt(defaultDifficulty)
+	}
+	config, err := e.chainConfig(parent)
+	if err != nil || !config.IsTurn(new(big.Int).Add(parent.Number, common.Big1)) {
+		return big.NewInt(defaultDifficulty)
+	}
+	validators, err := e.sealingValidators(config, parent)
+	if err != nil {
+		return new(big.Int).Set(diffNoTurn)
+	}
+
+	e.lock.RLock()
+	signer := e.signer
+	e.lock.RUnlock()
+	return turnDifficulty(validators, parent.Number.Uint64()+1, signer)
 }
 
 // SealHash returns the hash of a block prior to it being sealed.
@@ -1,23 +1,31 @@
 package equality
 
 import (
+	"errors"
+	"math/big"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/SecretBlockChain/go-secret/accounts"
+	"github.com/SecretBlockChain/go-secret/common"
+	"github.com/SecretBlockChain/go-secret/consensus"
+	"github.com/SecretBlockChain/go-secret/core/rawdb"
 	"github.com/SecretBlockChain/go-secret/core/types"
 	"github.com/SecretBlockChain/go-secret/crypto"
+	"github.com/SecretBlockChain/go-secret/params"
 	lru "github.com/hashicorp/golang-lru"
 	"github.com/stretchr/testify/assert"
 )
 
 func TestSealHash(t *testing.T) {
 	header := types.Header{
-		Extra: make([]byte, extraSeal),
+		Extra: make([]byte, ExtraSeal),
 	}
 	signFn := func(account accounts.Account, s string, data []byte) ([]byte, error) {
 		return crypto.Sign(crypto.Keccak256(data), testUserKey)
 	}
-	sigHash, err := signFn(accounts.Account{Address: testUserAddress}, accounts.MimetypeClique, EqualityRLP(&header))
+	sigHash, err := signFn(accounts.Account{Address: testUserAddress}, accounts.MimetypeEquality, EqualityRLP(&header))
 	assert.Nil(t, err)
 	copy(header.Extra, sigHash)
 
@@ -26,3 +34,350 @@ func TestSealHash(t *testing.T) {
 	assert.Nil(t, err)
 	assert.Equal(t, signer.String(), testUserAddress.String())
 }
+
+func TestVerifyHeaderRootMismatch(t *testing.T) {
+	db := rawdb.NewMemoryDatabase()
+	e := New(params.TestnetEqualityConfig(), db)
+	genesis := &types.Header{Number: big.NewInt(0), UncleHash: uncleHash}
+
+	// Compute the trie roots of the block locally
+	headerExtra := HeaderExtra{
+		Epoch:                  1,
+		EpochBlock:             1,
+		CurrentBlockCandidates: []common.Address{testUserAddress},
+		CurrentEpochValidators: []common.Address{testUserAddress},
+	}
+	snap, err := newSnapshot(rawdb.NewMemoryDatabase())
+	assert.Nil(t, err)
+	header := &types.Header{Number: big.NewInt(1), Coinbase: testUserAddress}
+	assert.Nil(t, snap.apply(*e.config, header, headerExtra))
+	headerExtra.Root, err = snap.Root()
+	assert.Nil(t, err)
+
+	newHeader := func(headerExtra HeaderExtra) *types.Header {
+		header := newTestHeader(1, headerExtra)
+		header.ParentHash = genesis.Hash()
+		header.UncleHash = uncleHash
+		header.Coinbase = testUserAddress
+		header.Time = genesis.Time + e.config.Period
+		return header
+	}
+	chain := &testHeaderChain{config: params.TestnetChainConfig, headers: []*types.Header{genesis}}
+
+	// A corrupted mint count root is rejected naming the field
+	corrupted := headerExtra
+	corrupted.Root.MintCntHash = common.HexToHash("0x01")
+	err = e.verifyHeader(chain, newHeader(corrupted), nil, nil)
+	assert.True(t, errors.Is(err, errInvalidRoot))
+	assert.Contains(t, err.Error(), "mintCntHash")
+	assert.NotContains(t, err.Error(), "candidateHash")
+
+	// The correct roots pass on to the seal check
+	err = e.verifyHeader(chain, newHeader(headerExtra), nil, nil)
+	assert.NotNil(t, err)
+	assert.False(t, errors.Is(err, errInvalidRoot))
+}
+
+func TestVerifyHeaderEmptyExtra(t *testing.T) {
+	config := newTestSealingConfig()
+	headers := newTestSealedChain(t, config, 2)
+	e := New(&config, rawdb.NewMemoryDatabase())
+
+	// Only the genesis block may carry no header extra, the blocks sealed by
+	// the engine always carry one
+	chain := &testHeaderChain{config: params.TestnetChainConfig, headers: headers[:1]}
+	assert.Nil(t, e.VerifyGenesis(headers[0]))
+	assert.Nil(t, e.verifyHeader(chain, headers[1], nil, nil))
+
+	empty := types.CopyHeader(headers[1])
+	empty.Extra = make([]byte, ExtraVanity+ExtraSeal)
+	signature, err := crypto.Sign(SealHash(empty).Bytes(), testUserKey)
+	assert.Nil(t, err)
+	copy(empty.Extra[ExtraVanity:], signature)
+	err = e.verifyHeader(chain, empty, nil, nil)
+	assert.True(t, errors.Is(err, ErrEmptyExtra), "have %v", err)
+	_, err = e.DecodeHeaderExtraCached(empty)
+	assert.True(t, errors.Is(err, ErrEmptyExtra))
+}
+
+// newTestSealedChain returns a genesis header followed by count headers sealed
+// in turn by the single validator of config, with the header extra roots the
+// verification computes.
+func newTestSealedChain(tb testing.TB, config params.EqualityConfig, count int) []*types.Header {
+	snap, err := newSnapshot(rawdb.NewMemoryDatabase())
+	assert.Nil(tb, err)
+
+	headers := []*types.Header{{Number: big.NewInt(0), UncleHash: uncleHash}}
+	for number := uint64(1); number <= uint64(count); number++ {
+		header := &types.Header{
+			Number:     new(big.Int).SetUint64(number),
+			ParentHash: headers[len(headers)-1].Hash(),
+			UncleHash:  uncleHash,
+			Coinbase:   testUserAddress,
+			Time:       config.GenesisTimestamp + number*config.Period,
+		}
+		headerExtra := HeaderExtra{Epoch: 1, EpochBlock: 1}
+		if number == 1 {
+			headerExtra.CurrentEpochValidators = config.Validators
+		}
+		assert.Nil(tb, snap.apply(config, header, headerExtra))
+		headerExtra.Root, err = snap.Root()
+		assert.Nil(tb, err)
+
+		header.Extra, err = EncodeHeaderExtra(nil, headerExtra)
+		assert.Nil(tb, err)
+		signature, err := crypto.Sign(SealHash(header).Bytes(), testUserKey)
+		assert.Nil(tb, err)
+		copy(header.Extra[len(header.Extra)-ExtraSeal:], signature)
+		headers = append(headers, header)
+	}
+	return headers
+}
+
+func newTestSealingConfig() params.EqualityConfig {
+	return params.EqualityConfig{
+		Period:             1,
+		Epoch:              100000,
+		MaxValidatorsCount: 21,
+		GenesisTimestamp:   1623283200,
+		Validators:         []common.Address{testUserAddress},
+	}
+}
+
+func TestVerifyHeaders(t *testing.T) {
+	config := newTestSealingConfig()
+	headers := newTestSealedChain(t, config, 64)
+	genesis := &testHeaderChain{config: params.TestnetChainConfig, headers: headers[:1]}
+
+	verify := func(headers []*types.Header) []error {
+		e := New(&config, rawdb.NewMemoryDatabase())
+		_, results := e.VerifyHeaders(genesis, headers, make([]bool, len(headers)))
+		errs := make([]error, 0, len(headers))
+		for range headers {
+			errs = append(errs, <-results)
+		}
+		return errs
+	}
+
+	// Results are delivered in the order of the headers
+	for idx, err := range verify(headers[1:]) {
+		assert.Nil(t, err, "header %d", idx+1)
+	}
+
+	// Standalone and cascading failures are reported at their headers
+	invalid := append([]*types.Header{}, headers[1:]...)
+	mixDigest := types.CopyHeader(invalid[19])
+	mixDigest.MixDigest = common.HexToHash("0x01")
+	invalid[19] = mixDigest
+	errs := verify(invalid)
+	for idx := 0; idx < 19; idx++ {
+		assert.Nil(t, errs[idx], "header %d", idx+1)
+	}
+	assert.Equal(t, errInvalidMixDigest, errs[19])
+	assert.Equal(t, consensus.ErrUnknownAncestor, errs[20])
+
+	// Aborting stops the verification without blocking
+	e := New(&config, rawdb.NewMemoryDatabase())
+	abort, results := e.VerifyHeaders(genesis, headers[1:], make([]bool, len(headers)-1))
+	close(abort)
+	for len(results) > 0 {
+		<-results
+	}
+}
+
+func TestVerifyHeaderTimestamp(t *testing.T) {
+	config := newTestSealingConfig()
+	config.Period = 5
+	config.GenesisTimestamp = uint64(time.Now().Unix())
+	headers := newTestSealedChain(t, config, 4)
+	chain := &testHeaderChain{config: params.TestnetChainConfig, headers: headers[:1]}
+	verify := func(e *Equality, headers []*types.Header) []error {
+		_, results := e.VerifyHeaders(chain, headers, make([]bool, len(headers)))
+		errs := make([]error, 0, len(headers))
+		for range headers {
+			errs = append(errs, <-results)
+		}
+		return errs
+	}
+
+	// Blocks sealed a period apart pass up to the allowed drift ahead of the
+	// local clock, the next one is from the future
+	errs := verify(New(&config, rawdb.NewMemoryDatabase()), headers[1:])
+	assert.Nil(t, errs[0])
+	assert.Nil(t, errs[1])
+	assert.Nil(t, errs[2])
+	assert.True(t, errors.Is(errs[3], consensus.ErrFutureBlock))
+
+	e := New(&config, rawdb.NewMemoryDatabase())
+	e.SetAllowedFutureDrift(0)
+	errs = verify(e, headers[1:3])
+	assert.True(t, errors.Is(errs[0], consensus.ErrFutureBlock))
+
+	// A block less than a period after its parent is rejected
+	early := types.CopyHeader(headers[2])
+	early.Time = headers[1].Time + config.Period - 1
+	errs = verify(New(&config, rawdb.NewMemoryDatabase()), []*types.Header{headers[1], early})
+	assert.Nil(t, errs[0])
+	assert.True(t, errors.Is(errs[1], ErrInvalidTimestamp))
+	assert.False(t, errors.Is(errs[1], consensus.ErrFutureBlock))
+}
+
+func TestVerifyHeaderPrecheckLimit(t *testing.T) {
+	config := newTestSealingConfig()
+	headers := newTestSealedChain(t, config, 1)
+	chain := &testHeaderChain{config: params.TestnetChainConfig, headers: headers[:1]}
+	e := New(&config, rawdb.NewMemoryDatabase())
+
+	// A header extra decoded ahead within another limit is decoded again
+	check := headerPrecheck{decodeErr: errHeaderExtraTooLarge, limit: 1}
+	assert.Nil(t, e.verifyHeader(chain, headers[1], nil, &check))
+
+	check = headerPrecheck{decodeErr: errHeaderExtraTooLarge, limit: headerExtraLimit(config)}
+	err := e.verifyHeader(chain, headers[1], nil, &check)
+	assert.True(t, errors.Is(err, errHeaderExtraTooLarge))
+	assert.True(t, IsProtocolViolation(err))
+}
+
+// BenchmarkVerifyHeaders verifies 10k headers one by one and as a batch
+// through VerifyHeaders, as imported by a syncing node.
+func BenchmarkVerifyHeaders(b *testing.B) {
+	config := newTestSealingConfig()
+	headers := newTestSealedChain(b, config, 10000)
+	genesis := &testHeaderChain{config: params.TestnetChainConfig, headers: headers[:1]}
+
+	b.Run("serial", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			e := New(&config, rawdb.NewMemoryDatabase())
+			for idx, header := range headers[1:] {
+				if err := e.VerifyHeader(&testHeaderChain{config: params.TestnetChainConfig, headers: headers[:idx+1]}, header, true); err != nil {
+					b.Fatal(err)
+				}
+			}
+		}
+	})
+	b.Run("batch", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			e := New(&config, rawdb.NewMemoryDatabase())
+			_, results := e.VerifyHeaders(genesis, headers[1:], make([]bool, len(headers)-1))
+			for range headers[1:] {
+				if err := <-results; err != nil {
+					b.Fatal(err)
+				}
+			}
+		}
+	})
+}
+
+func TestPrepareVanity(t *testing.T) {
+	config := newTestSealingConfig()
+	e := New(&config, rawdb.NewMemoryDatabase())
+	genesis := &types.Header{Number: big.NewInt(0)}
+	chain := &testHeaderChain{config: params.TestnetChainConfig, headers: []*types.Header{genesis}}
+	prepare := func(extra []byte) *types.Header {
+		header := &types.Header{Number: big.NewInt(1), ParentHash: genesis.Hash(), Extra: extra}
+		assert.Nil(t, e.Prepare(chain, header))
+		return header
+	}
+	padded := func(vanity string) []byte {
+		return append([]byte(vanity), make([]byte, ExtraVanity-len(vanity))...)
+	}
+
+	// The vanity of the header, e.g. the miner extra data, is kept by default
+	header := prepare([]byte("miner"))
+	assert.Equal(t, padded("miner"), header.Extra[:ExtraVanity])
+
+	// The vanity set overrides it, padded or truncated
+	e.SetVanity([]byte("operator"))
+	assert.Equal(t, padded("operator"), e.Vanity())
+	header = prepare([]byte("miner"))
+	assert.Equal(t, padded("operator"), header.Extra[:ExtraVanity])
+	e.SetVanity([]byte(strings.Repeat("v", ExtraVanity+8)))
+	assert.Equal(t, []byte(strings.Repeat("v", ExtraVanity)), e.Vanity())
+
+	// Re-preparing a header keeps its vanity and replaces the header extra
+	e.SetVanity(nil)
+	assert.Nil(t, e.Vanity())
+	prepared := prepare(header.Extra)
+	assert.Equal(t, header.Extra, prepared.Extra)
+	vanity, _, _, err := SplitExtra(prepared.Extra)
+	assert.Nil(t, err)
+	assert.Equal(t, padded("operator"), vanity)
+	headerExtra, err := DecodeHeaderExtra(prepared)
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(1), headerExtra.EpochBlock)
+}
+
+func TestSealRemoteSigner(t *testing.T) {
+	config := newTestSealingConfig()
+	config.Period = 5
+	e := New(&config, rawdb.NewMemoryDatabase())
+	genesis := &types.Header{Number: big.NewInt(0), UncleHash: uncleHash}
+	chain := &testHeaderChain{config: params.TestnetChainConfig, headers: []*types.Header{genesis}}
+
+	newBlock := func() *types.Block {
+		header := newTestHeader(1, HeaderExtra{Epoch: 1, EpochBlock: 1, CurrentEpochValidators: config.Validators})
+		header.ParentHash = genesis.Hash()
+		header.Coinbase = testUserAddress
+		header.Time = uint64(time.Now().Unix()) + config.Period
+		return types.NewBlockWithHeader(header)
+	}
+	remote := func(latency time.Duration) SignerFn {
+		return func(account accounts.Account, mimeType string, data []byte) ([]byte, error) {
+			if mimeType != accounts.MimetypeEquality {
+				return nil, errors.New("unexpected mime type " + mimeType)
+			}
+			time.Sleep(latency)
+			return crypto.Sign(crypto.Keccak256(data), testUserKey)
+		}
+	}
+
+	// Not authorized or authorized for another coinbase
+	assert.Equal(t, errUnauthorized, e.Seal(chain, newBlock(), make(chan *types.Block, 1), nil))
+	e.Authorize(common.HexToAddress("0xa000000000000000000000000000000000000000"), remote(0))
+	assert.Equal(t, errUnauthorized, e.Seal(chain, newBlock(), make(chan *types.Block, 1), nil))
+
+	// Re-authorized at runtime, the remote signer answering within 2 seconds
+	// doesn't delay the block beyond its slot
+	e.Authorize(testUserAddress, remote(2*time.Second))
+	block := newBlock()
+	results := make(chan *types.Block, 1)
+	assert.Nil(t, e.Seal(chain, block, results, nil))
+	select {
+	case sealed := <-results:
+		assert.False(t, time.Now().After(time.Unix(int64(block.Time())+1, 0)))
+		signer, err := ecrecover(sealed.Header(), e.signatures)
+		assert.Nil(t, err)
+		assert.Equal(t, testUserAddress, signer)
+	case <-time.After(time.Duration(config.Period+1) * time.Second):
+		t.Fatal("sealing result not delivered in the slot")
+	}
+
+	// Stopped sealing returns without waiting for the signer
+	stop := make(chan struct{})
+	results = make(chan *types.Block, 1)
+	assert.Nil(t, e.Seal(chain, newBlock(), results, stop))
+	close(stop)
+	select {
+	case <-results:
+		t.Fatal("sealing result delivered after stop")
+	case <-time.After(2500 * time.Millisecond):
+	}
+}
+
+func TestVerifyHeaderEncodedLimit(t *testing.T) {
+	config := newTestSealingConfig()
+	config.MaxHeaderExtraBytes = 220
+	headers := newTestSealedChain(t, config, 2)
+	chain := &testHeaderChain{config: params.TestnetChainConfig, headers: headers[:2]}
+	e := New(&config, rawdb.NewMemoryDatabase())
+
+	// The header extra data beyond the limit is rejected before decoding, the
+	// first block carrying the chain config exceeds it
+	assert.Greater(t, len(headers[1].Extra), 220)
+	err := e.verifyHeader(chain, headers[1], nil, nil)
+	assert.True(t, errors.Is(err, errHeaderExtraTooLarge))
+	assert.True(t, IsProtocolViolation(err))
+	assert.Nil(t, e.verifyHeader(chain, headers[2], nil, nil))
+
+	assert.Equal(t, uint64(defaultMaxHeaderExtraBytes), headerExtraBytesLimit(params.EqualityConfig{}))
+}
@@ -0,0 +1,84 @@
+package equality
+
+//go:generate abigen --abi candidate_contract.abi --pkg equality --type CandidateContract --out candidate_contract_bind.go
+
+import (
+	"errors"
+	"math/big"
+	"strings"
+
+	"github.com/SecretBlockChain/go-secret/accounts/abi"
+	"github.com/SecretBlockChain/go-secret/common"
+	"github.com/SecretBlockChain/go-secret/core/state"
+	"github.com/SecretBlockChain/go-secret/core/types"
+)
+
+// CandidateContractAddress is the address of the candidate system contract,
+// an alternative to the raw transaction data for the candidate events. It
+// holds no code, the engine intercepts the calls to it at Finalize:
+//
+//   - becomeCandidate() registers the sender, with at least MinCandidateBalance sent as value,
+//   - becomeCandidateWithMetadata(bytes) registers the sender as well, attaching the metadata,
+//   - cancelCandidate() cancels the sender's candidacy.
+//
+// The value sent is returned to the sender before the deposit is taken as for
+// the raw transaction data. Gas can not be estimated without code, so the
+// transactions through the CandidateContract binding need a gas limit set.
+var CandidateContractAddress = common.HexToAddress("0x000000000000000000000000000000000000e002")
+
+var candidateContractABI, _ = abi.JSON(strings.NewReader(CandidateContractABI))
+
+// isCandidateContractCall returns whether the transaction calls the candidate
+// system contract.
+func isCandidateContractCall(tx *types.Transaction) bool {
+	to := tx.To()
+	return to != nil && *to == CandidateContractAddress
+}
+
+// newContractTransaction new custom transaction from a call of the candidate
+// system contract.
+func newContractTransaction(tx *types.Transaction) (Transaction, error) {
+	method, err := candidateContractABI.MethodById(tx.Data())
+	if err != nil {
+		return nil, errors.New("undefined system contract method")
+	}
+
+	switch method.Name {
+	case "becomeCandidate", "becomeCandidateWithMetadata":
+		var metadata []byte
+		if len(method.Inputs) > 0 {
+			args, err := method.Inputs.Unpack(tx.Data()[4:])
+			if err != nil {
+				return nil, errors.New("invalid system contract arguments")
+			}
+			metadata = args[0].([]byte)
+		}
+		event := new(EventBecomeCandidate)
+		if err = event.Decode(tx, metadata); err != nil {
+			return nil, err
+		}
+		event.Deposit = new(big.Int).Set(tx.Value())
+		return event, nil
+	case "cancelCandidate":
+		event := new(EventCancelCandidate)
+		if err = event.Decode(tx, nil); err != nil {
+			return nil, err
+		}
+		return event, nil
+	}
+	return nil, errors.New("undefined system contract method")
+}
+
+// refundContractValue returns the value a transaction sent to the candidate
+// system contract to its sender, the contract holds no funds.
+func refundContractValue(state *state.StateDB, journal *systemJournal, tx *types.Transaction) {
+	if !isCandidateContractCall(tx) || tx.Value().Sign() <= 0 {
+		return
+	}
+	sender, err := types.Sender(types.NewEIP155Signer(tx.ChainId()), tx)
+	if err != nil {
+		return
+	}
+	journal.subBalance(state, CandidateContractAddress, tx.Value(), opContractRefund)
+	journal.addBalance(state, sender, tx.Value(), opContractRefund)
+}
@@ -0,0 +1,88 @@
+package equality
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/SecretBlockChain/go-secret/common"
+	"github.com/SecretBlockChain/go-secret/core/rawdb"
+	"github.com/SecretBlockChain/go-secret/core/state"
+	"github.com/SecretBlockChain/go-secret/core/types"
+	"github.com/SecretBlockChain/go-secret/crypto"
+	"github.com/SecretBlockChain/go-secret/params"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCandidateContract(t *testing.T) {
+	key, _ := crypto.GenerateKey()
+	sender := crypto.PubkeyToAddress(key.PublicKey)
+	funds := new(big.Int).Mul(big.NewInt(100), big.NewInt(params.Ether))
+
+	db := rawdb.NewMemoryDatabase()
+	config := params.EqualityConfig{Period: 3, Epoch: 30, MaxValidatorsCount: 3, MinCandidateBalance: big.NewInt(params.Ether)}
+	e := New(&config, db)
+	snap, err := newSnapshot(db)
+	assert.Nil(t, err)
+
+	// The engine replays the calls on the balances after the transaction, the
+	// value sent is kept by the contract and refunded by the engine, returning
+	// the balance change of the sender
+	var nonce, number uint64 = 0, 1
+	finalize := func(tx *types.Transaction) (HeaderExtra, *big.Int) {
+		statedb, err := state.New(common.Hash{}, state.NewDatabase(db), nil)
+		assert.Nil(t, err)
+		balance := new(big.Int).Sub(funds, tx.Value())
+		statedb.SetBalance(sender, balance)
+		statedb.SetBalance(CandidateContractAddress, tx.Value())
+
+		number++
+		header := &types.Header{Number: new(big.Int).SetUint64(number)}
+		headerExtra := HeaderExtra{Epoch: 1, EpochBlock: 1}
+		e.processTransactions(config, statedb, header, snap, &headerExtra, []*types.Transaction{tx})
+		assert.Zero(t, statedb.GetBalance(CandidateContractAddress).Sign())
+		return headerExtra, new(big.Int).Sub(statedb.GetBalance(sender), balance)
+	}
+	call := func(value *big.Int, method string) *types.Transaction {
+		data, err := candidateContractABI.Pack(method)
+		assert.Nil(t, err)
+		if value == nil {
+			value = new(big.Int)
+		}
+		tx, err := types.SignTx(types.NewTransaction(nonce, CandidateContractAddress, value, 50000, big.NewInt(1), data), types.HomesteadSigner{}, key)
+		assert.Nil(t, err)
+		nonce++
+		return tx
+	}
+
+	// A deposit below the min candidate balance is returned without registration
+	headerExtra, change := finalize(call(big.NewInt(1), "becomeCandidate"))
+	assert.Empty(t, headerExtra.CurrentBlockCandidates)
+	assert.Zero(t, change.Cmp(big.NewInt(1)))
+
+	// The deposit sent as value is taken as the candidate security
+	headerExtra, change = finalize(call(config.MinCandidateBalance, "becomeCandidate"))
+	assert.Equal(t, []common.Address{sender}, headerExtra.CurrentBlockCandidates)
+	assert.Zero(t, change.Sign())
+	candidate, err := snap.GetCandidate(sender)
+	assert.Nil(t, err)
+	assert.NotNil(t, candidate)
+
+	headerExtra, change = finalize(call(nil, "cancelCandidate"))
+	assert.Equal(t, []common.Address{sender}, headerExtra.CurrentBlockCancelCandidates)
+	assert.Zero(t, change.Cmp(config.MinCandidateBalance))
+
+	// The raw transaction data keeps working without a deposit sent
+	raw := types.NewTransaction(0, common.Address{}, big.NewInt(0), 50000, big.NewInt(1), []byte("equality:1:event:candidate"))
+	raw, err = types.SignTx(raw, types.HomesteadSigner{}, key)
+	assert.Nil(t, err)
+	ctx, err := NewTransaction(raw)
+	assert.Nil(t, err)
+	assert.Nil(t, ctx.(*EventBecomeCandidate).Deposit)
+
+	// Unknown methods of the contract are no candidate events
+	unknown := types.NewTransaction(0, CandidateContractAddress, big.NewInt(0), 50000, big.NewInt(1), []byte{0x01, 0x02, 0x03, 0x04})
+	unknown, err = types.SignTx(unknown, types.HomesteadSigner{}, key)
+	assert.Nil(t, err)
+	_, err = NewTransaction(unknown)
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,111 @@
+package equality
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math/big"
+	"sort"
+
+	"github.com/SecretBlockChain/go-secret/common"
+	"github.com/SecretBlockChain/go-secret/crypto"
+	"github.com/SecretBlockChain/go-secret/params"
+)
+
+// The random election from the election seed block on is specified so that
+// other clients can elect the same validators:
+//
+//	seed     = keccak256(parentHash || uint64be(epoch))
+//	order    = the candidate addresses sorted in ascending byte order
+//	state    = seed
+//	for i = len(order)-1 down to 1:
+//	    state = keccak256(state)
+//	    j     = uint64be(state[0:8]) mod (i+1)
+//	    swap order[i] and order[j]
+//	elected  = the first maxValidators addresses of order
+//
+// where parentHash is the hash of the parent of the epoch transition block and
+// epoch the number of the epoch it starts. The parent hash is only known once
+// the parent is sealed, and binding the epoch keeps a seed from being reused
+// by another transition. The modulo bias is below 2^-40 for any candidate count
+// a chain can hold.
+
+// ElectionSeed returns the seed of the election of the epoch transition block
+// whose parent has hash parentHash, starting epoch: the keccak256 hash of the
+// parent hash followed by the epoch as an 8-byte big endian integer.
+func ElectionSeed(parentHash common.Hash, epoch uint64) common.Hash {
+	var number [8]byte
+	binary.BigEndian.PutUint64(number[:], epoch)
+	return crypto.Keccak256Hash(parentHash.Bytes(), number[:])
+}
+
+// ShuffleAddresses returns a copy of addresses in the order of a Fisher–Yates
+// shuffle, from the last position down, each drawing the first 8 bytes of the
+// next hash of the keccak256 hash chain started at seed.
+func ShuffleAddresses(addresses []common.Address, seed common.Hash) []common.Address {
+	shuffled := make([]common.Address, len(addresses))
+	copy(shuffled, addresses)
+
+	state := seed
+	for i := len(shuffled) - 1; i > 0; i-- {
+		state = crypto.Keccak256Hash(state.Bytes())
+		j := binary.BigEndian.Uint64(state[:8]) % uint64(i+1)
+		shuffled[i], shuffled[j] = shuffled[j], shuffled[i]
+	}
+	return shuffled
+}
+
+// SelectCandidates returns the first n candidates of the shuffle of candidates
+// sorted by address with seed, all of them if fewer. The candidates are left
+// untouched, the order they are given in doesn't matter.
+func SelectCandidates(candidates []common.Address, seed common.Hash, n int) []common.Address {
+	if n <= 0 || len(candidates) == 0 {
+		return nil
+	}
+	sorted := make([]common.Address, len(candidates))
+	copy(sorted, candidates)
+	sort.Slice(sorted, func(i, j int) bool { return bytes.Compare(sorted[i][:], sorted[j][:]) < 0 })
+
+	selected := ShuffleAddresses(sorted, seed)
+	if len(selected) > n {
+		selected = selected[:n]
+	}
+	return selected
+}
+
+// seededElection is the random election from the election seed block on,
+// shuffling the candidates with the specified algorithm of SelectCandidates.
+type seededElection struct{}
+
+// Elect implements ElectionStrategy.
+func (seededElection) Elect(candidates []CandidateInfo, seed common.Hash, maxValidators int) []common.Address {
+	addresses := make([]common.Address, 0, len(candidates))
+	for _, candidate := range candidates {
+		addresses = append(addresses, candidate.Address)
+	}
+	return SelectCandidates(addresses, seed, maxValidators)
+}
+
+// electionStrategyAt returns the election strategy of the epoch transition
+// block of number under config, the seeded election replacing the random one
+// from the election seed block on.
+func electionStrategyAt(config params.EqualityConfig, number *big.Int) (ElectionStrategy, error) {
+	strategy, err := electionStrategyOf(config)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := strategy.(randomElection); ok && config.IsElectionSeed(number) {
+		return seededElection{}, nil
+	}
+	return strategy, nil
+}
+
+// transitionSeed returns the seed of the election of the epoch transition
+// block of number starting epoch, whose election is seeded with hash: the
+// parent hash, or the hash of the election cutoff block. From the election seed
+// block on the seed binds the epoch.
+func transitionSeed(config params.EqualityConfig, number *big.Int, hash common.Hash, epoch uint64) common.Hash {
+	if config.IsElectionSeed(number) {
+		return ElectionSeed(hash, epoch)
+	}
+	return hash
+}
@@ -0,0 +1,222 @@
+package equality
+
+import (
+	"errors"
+	"math/big"
+	"sync"
+
+	"github.com/SecretBlockChain/go-secret/common"
+	"github.com/SecretBlockChain/go-secret/consensus"
+	"github.com/SecretBlockChain/go-secret/core/types"
+	"github.com/SecretBlockChain/go-secret/log"
+	"github.com/SecretBlockChain/go-secret/params"
+	lru "github.com/hashicorp/golang-lru"
+)
+
+const (
+	electionCutoffDivisor = 20 // Fraction of the epoch the election cutoff block precedes the transition by
+	inMemoryRankings      = 16 // Number of recent election rankings to keep in memory
+)
+
+// errMissingElectionRanking is returned if an epoch transition from the
+// election cutoff block on is elected without the ranking of its cutoff block.
+var errMissingElectionRanking = errors.New("missing election ranking")
+
+// electionCutoff returns the number of the election cutoff block of the epoch
+// transition block of number, ending an epoch of length blocks: a twentieth of
+// the epoch before it, the parent at the latest.
+//
+// From the election cutoff block on, the candidates are ranked on the snapshot
+// after the cutoff block, and the transition elects the first ones of the
+// ranking still standing. The ranking, the expensive part of the election, is
+// computed ahead in the background so the transition block only commits it.
+func electionCutoff(number, length uint64) uint64 {
+	distance := length / electionCutoffDivisor
+	if distance == 0 {
+		distance = 1
+	}
+	return number - distance
+}
+
+// electionRanking is the ranking of the candidates of an election cutoff block.
+type electionRanking struct {
+	number uint64           // Number of the cutoff block
+	hash   common.Hash      // Hash of the cutoff block
+	seed   common.Hash      // Seed of the ranking, the hash of the cutoff block or derived from it
+	ranked []common.Address // Candidates in their order of election
+}
+
+// rankCandidates ranks the candidates of snap in their order of election under
+// config at the epoch transition block of number, by delegated votes or by the
+// election strategy electing them all. The strategies elect the same first
+// candidates whatever the max validators.
+func rankCandidates(config params.EqualityConfig, snap *Snapshot, seed common.Hash, number *big.Int) ([]common.Address, error) {
+	if config.DelegatedVoting {
+		weighted, err := snap.CountVotes()
+		if err != nil {
+			return nil, err
+		}
+		ranked := make([]common.Address, 0, len(weighted))
+		for _, candidate := range weighted {
+			ranked = append(ranked, candidate.Address)
+		}
+		return ranked, nil
+	}
+	strategy, err := electionStrategyAt(config, number)
+	if err != nil {
+		return nil, err
+	}
+	infos, err := snap.CandidateInfos()
+	if err != nil {
+		return nil, err
+	}
+	return strategy.Elect(infos, seed, len(infos)), nil
+}
+
+// elect returns the first n candidates of the ranking still candidates in snap
+// and eligible if eligible is set.
+func (ranking *electionRanking) elect(snap *Snapshot, n int, eligible func(common.Address) bool) ([]common.Address, error) {
+	elected := make([]common.Address, 0, n)
+	for _, candidate := range ranking.ranked {
+		if len(elected) >= n {
+			break
+		}
+		if eligible != nil && !eligible(candidate) {
+			continue
+		}
+		standing, err := snap.GetCandidate(candidate)
+		if err != nil {
+			return nil, err
+		}
+		if standing != nil {
+			elected = append(elected, candidate)
+		}
+	}
+	return elected, nil
+}
+
+// electionRankings caches the rankings of the recent election cutoff blocks,
+// computed in the background ahead of their epoch transitions.
+type electionRankings struct {
+	cache   *lru.ARCCache                 // Rankings by hash of their cutoff blocks
+	running map[common.Hash]chan struct{} // Rankings being computed, closed once done
+	lock    sync.Mutex
+}
+
+// newElectionRankings creates an empty cache of election rankings.
+func newElectionRankings() *electionRankings {
+	cache, _ := lru.NewARC(inMemoryRankings)
+	return &electionRankings{cache: cache, running: make(map[common.Hash]chan struct{})}
+}
+
+// precompute computes the ranking of the cutoff block of hash with rank in the
+// background, unless already known or being computed.
+func (rankings *electionRankings) precompute(hash common.Hash, rank func() ([]common.Address, error)) {
+	rankings.lock.Lock()
+	defer rankings.lock.Unlock()
+
+	if _, ok := rankings.running[hash]; ok || rankings.cache.Contains(hash) {
+		return
+	}
+	done := make(chan struct{})
+	rankings.running[hash] = done
+	go func() {
+		ranked, err := rank()
+		rankings.lock.Lock()
+		if err == nil {
+			rankings.cache.Add(hash, ranked)
+		} else {
+			log.Debug("[equality] Failed to precompute election ranking", "hash", hash, "err", err)
+		}
+		delete(rankings.running, hash)
+		rankings.lock.Unlock()
+		close(done)
+	}()
+}
+
+// get returns the ranking of the cutoff block of hash, waiting for it if being
+// computed in the background, computing it with rank if not known.
+func (rankings *electionRankings) get(hash common.Hash, rank func() ([]common.Address, error)) ([]common.Address, error) {
+	rankings.lock.Lock()
+	done := rankings.running[hash]
+	rankings.lock.Unlock()
+	if done != nil {
+		<-done
+	}
+	if ranked, ok := rankings.cache.Get(hash); ok {
+		return ranked.([]common.Address), nil
+	}
+
+	ranked, err := rank()
+	if err != nil {
+		return nil, err
+	}
+	rankings.cache.Add(hash, ranked)
+	return ranked, nil
+}
+
+// rankElection ranks the candidates of the election cutoff block of the epoch
+// transition block of number starting epoch, under the chain config in effect
+// at the cutoff block.
+func (e *Equality) rankElection(chain consensus.ChainHeaderReader, cutoff *types.Header, number *big.Int, epoch uint64) ([]common.Address, error) {
+	snap, err := e.snapshot(chain, cutoff, nil)
+	if err != nil {
+		return nil, err
+	}
+	config, err := e.chainConfigByHash(snap.root.ConfigHash)
+	if err != nil {
+		return nil, err
+	}
+	return rankCandidates(config, snap, transitionSeed(config, number, cutoff.Hash(), epoch), number)
+}
+
+// precomputeElection starts to rank the candidates in the background if parent
+// is the election cutoff block of the running epoch, the one it belongs to per
+// its header extra and of length blocks under config.
+func (e *Equality) precomputeElection(chain consensus.ChainHeaderReader, config params.EqualityConfig,
+	parent *types.Header, parentHeaderExtra HeaderExtra, length uint64) {
+
+	transition := parentHeaderExtra.EpochBlock + length
+	if parent.Number.Sign() == 0 || !config.IsElectionCutoff(new(big.Int).SetUint64(transition)) {
+		return
+	}
+	if parent.Number.Uint64() != electionCutoff(transition, length) || e.closed() {
+		return
+	}
+	e.rankings.precompute(parent.Hash(), func() ([]common.Address, error) {
+		return e.rankElection(chain, parent, new(big.Int).SetUint64(transition), parentHeaderExtra.Epoch+1)
+	})
+}
+
+// electionRankingOf returns the ranking the epoch transition block header after
+// parent elects its validators out of under config, nil if header is not an
+// epoch transition from the election cutoff block on.
+func (e *Equality) electionRankingOf(chain consensus.ChainHeaderReader, config params.EqualityConfig,
+	header, parent *types.Header, headerExtra HeaderExtra) (*electionRanking, error) {
+
+	number := header.Number.Uint64()
+	if number <= 1 || number != headerExtra.EpochBlock || !config.IsElectionCutoff(header.Number) {
+		return nil, nil
+	}
+	parentHeaderExtra, err := e.DecodeHeaderExtraCached(parent)
+	if err != nil {
+		return nil, err
+	}
+	number = electionCutoff(number, number-parentHeaderExtra.EpochBlock)
+	cutoff := parent
+	for cutoff.Number.Uint64() > number {
+		ancestor := chain.GetHeader(cutoff.ParentHash, cutoff.Number.Uint64()-1)
+		if ancestor == nil {
+			return nil, consensus.ErrUnknownAncestor
+		}
+		cutoff = ancestor
+	}
+	ranked, err := e.rankings.get(cutoff.Hash(), func() ([]common.Address, error) {
+		return e.rankElection(chain, cutoff, header.Number, headerExtra.Epoch)
+	})
+	if err != nil {
+		return nil, err
+	}
+	seed := transitionSeed(config, header.Number, cutoff.Hash(), headerExtra.Epoch)
+	return &electionRanking{number: number, hash: cutoff.Hash(), seed: seed, ranked: ranked}, nil
+}
@@ -0,0 +1,180 @@
+package equality
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/SecretBlockChain/go-secret/common"
+	"github.com/SecretBlockChain/go-secret/core/rawdb"
+	"github.com/SecretBlockChain/go-secret/core/types"
+	"github.com/SecretBlockChain/go-secret/crypto"
+	"github.com/SecretBlockChain/go-secret/ethdb"
+	"github.com/SecretBlockChain/go-secret/params"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestElectionCutoff(t *testing.T) {
+	tests := []struct {
+		number, length, cutoff uint64
+	}{
+		{28801, 28800, 27361},
+		{41, 40, 39},
+		{21, 20, 20},
+		{11, 10, 10},
+		{2, 1, 1},
+	}
+	for _, test := range tests {
+		assert.Equal(t, test.cutoff, electionCutoff(test.number, test.length), "number %d, length %d", test.number, test.length)
+	}
+}
+
+func TestRankCandidates(t *testing.T) {
+	snap := newTestElectionSnapshot(t, 12)
+	infos, err := snap.CandidateInfos()
+	assert.Nil(t, err)
+	seed := common.HexToHash("0x01")
+
+	// The ranking starts with the validators each strategy elects
+	for _, name := range []string{RandomElection, StakeElection, SeniorityElection} {
+		config := params.EqualityConfig{ElectionStrategy: name}
+		ranked, err := rankCandidates(config, snap, seed, big.NewInt(41))
+		assert.Nil(t, err)
+		assert.Len(t, ranked, 12)
+		strategy, err := electionStrategyOf(config)
+		assert.Nil(t, err)
+		for n := 1; n <= len(infos); n++ {
+			assert.Equal(t, strategy.Elect(infos, seed, n), ranked[:n], "strategy %s, %d validators", name, n)
+		}
+	}
+
+	// The candidates cancelled since the cutoff and the ineligible ones are
+	// passed over
+	ranked, err := rankCandidates(params.EqualityConfig{}, snap, seed, big.NewInt(41))
+	assert.Nil(t, err)
+	_, _, err = snap.CancelCandidate(ranked[0])
+	assert.Nil(t, err)
+	ranking := &electionRanking{hash: seed, ranked: ranked}
+	elected, err := ranking.elect(snap, 3, func(candidate common.Address) bool { return candidate != ranked[2] })
+	assert.Nil(t, err)
+	assert.Equal(t, []common.Address{ranked[1], ranked[3], ranked[4]}, elected)
+	elected, err = ranking.elect(snap, 20, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, ranked[1:], elected)
+}
+
+func TestElectionCutoffChain(t *testing.T) {
+	key, _ := crypto.GenerateKey()
+	validator := crypto.PubkeyToAddress(key.PublicKey)
+	config := *params.AllEthashProtocolChanges
+	config.Ethash = nil
+	config.Equality = &params.EqualityConfig{Epoch: 40, MaxValidatorsCount: 1, MinCandidateBalance: big.NewInt(0),
+		Validators: []common.Address{validator}, ElectionCutoffBlock: big.NewInt(1)}
+
+	db := rawdb.NewMemoryDatabase()
+	chain, engine := newTestBlockChain(t, db, &config, key)
+	var blocks types.Blocks
+	for number := 1; number <= 41; number++ {
+		block := sealTestBlock(t, chain, engine, key)
+		_, err := chain.InsertChain(types.Blocks{block})
+		assert.Nil(t, err)
+		blocks = append(blocks, block)
+	}
+
+	// The ranking of the cutoff block is computed as the next block is prepared
+	cutoff := chain.GetHeaderByNumber(39)
+	ranked, ok := engine.rankings.cache.Get(cutoff.Hash())
+	assert.True(t, ok)
+	assert.Equal(t, []common.Address{validator}, ranked)
+	headerExtra, err := DecodeHeaderExtra(chain.GetHeaderByNumber(41))
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(41), headerExtra.EpochBlock)
+	assert.Equal(t, []common.Address{validator}, headerExtra.CurrentEpochValidators)
+
+	// Another node verifies the transition, ranking the cutoff block as it
+	// verifies the block after it
+	verifier, _ := newTestBlockChain(t, rawdb.NewMemoryDatabase(), &config, key)
+	_, err = verifier.InsertChain(blocks)
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(41), verifier.CurrentBlock().NumberU64())
+
+	// The election trail replays with the ranking
+	trail, consistent, err := engine.replayElection(chain, chain.GetHeaderByNumber(41))
+	assert.Nil(t, err)
+	assert.True(t, consistent)
+	assert.Equal(t, []common.Address{validator}, trail.Validators)
+
+	// Without the ranking the transition is not elected
+	snap, err := engine.snapshot(chain, chain.GetHeaderByNumber(40), nil)
+	assert.Nil(t, err)
+	replayed := HeaderExtra{Epoch: headerExtra.Epoch, EpochBlock: headerExtra.EpochBlock}
+	assert.Equal(t, errMissingElectionRanking, engine.tryElect(*config.Equality, nil, chain.GetHeaderByNumber(41), snap, &replayed, nil))
+}
+
+// newBenchElectionRoot stores a snapshot of count candidates in db, the first
+// validators of them the validators of the running epoch.
+func newBenchElectionRoot(b *testing.B, db ethdb.Database, count, validators int) Root {
+	snap, err := newSnapshot(db)
+	if err != nil {
+		b.Fatal(err)
+	}
+	var elected []common.Address
+	for i := 0; i < count; i++ {
+		address := common.BytesToAddress(crypto.Keccak256(big.NewInt(int64(i)).Bytes()))
+		if _, err = snap.BecomeCandidate(address, uint64(i+1), big.NewInt(int64(i)*1000)); err != nil {
+			b.Fatal(err)
+		}
+		if i < validators {
+			elected = append(elected, address)
+		}
+	}
+	if err = snap.SetValidators(elected); err != nil {
+		b.Fatal(err)
+	}
+	root, err := snap.Root()
+	if err != nil {
+		b.Fatal(err)
+	}
+	if err = snap.Commit(root); err != nil {
+		b.Fatal(err)
+	}
+	return root
+}
+
+// benchmarkElectTransition elects the validators of an epoch transition out of
+// 2000 candidates, the ranking computed ahead from the election cutoff block.
+func benchmarkElectTransition(b *testing.B, strategy string, cutoff bool) {
+	db := rawdb.NewMemoryDatabase()
+	config := params.EqualityConfig{Epoch: 28800, MaxValidatorsCount: 21, ElectionStrategy: strategy}
+	if cutoff {
+		config.ElectionCutoffBlock = big.NewInt(1)
+	}
+	e := New(&config, db)
+	root := newBenchElectionRoot(b, db, 2000, int(config.MaxValidatorsCount))
+	header := &types.Header{Number: big.NewInt(28801), ParentHash: common.HexToHash("0x01")}
+
+	var ranking *electionRanking
+	if cutoff {
+		ranked, err := rankCandidates(config, e.snapshots.open(root), common.HexToHash("0x02"), header.Number)
+		if err != nil {
+			b.Fatal(err)
+		}
+		ranking = &electionRanking{number: 27361, hash: common.HexToHash("0x02"), ranked: ranked}
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		headerExtra := HeaderExtra{Epoch: 2, EpochBlock: 28801}
+		if err := e.tryElect(config, nil, header, e.snapshots.open(root), &headerExtra, ranking); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkElectTransitionRandom(b *testing.B) { benchmarkElectTransition(b, RandomElection, false) }
+func BenchmarkElectTransitionRandomCutoff(b *testing.B) {
+	benchmarkElectTransition(b, RandomElection, true)
+}
+func BenchmarkElectTransitionStake(b *testing.B) { benchmarkElectTransition(b, StakeElection, false) }
+func BenchmarkElectTransitionStakeCutoff(b *testing.B) {
+	benchmarkElectTransition(b, StakeElection, true)
+}
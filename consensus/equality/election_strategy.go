@@ -0,0 +1,189 @@
+package equality
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/big"
+	"math/rand"
+	"sort"
+	"sync"
+
+	"github.com/SecretBlockChain/go-secret/common"
+	"github.com/SecretBlockChain/go-secret/crypto"
+	"github.com/SecretBlockChain/go-secret/params"
+)
+
+// Names of the built in election strategies.
+const (
+	RandomElection    = "random"    // Candidates shuffled with equal chances, the default
+	StakeElection     = "stake"     // Candidates drawn with chances weighted by their deposits
+	SeniorityElection = "seniority" // Candidates registered the earliest
+)
+
+// errUnknownElectionStrategy is returned if a chain config names an election
+// strategy not registered.
+var errUnknownElectionStrategy = errors.New("unknown election strategy")
+
+// CandidateInfo is a candidate standing for election at an epoch transition.
+type CandidateInfo struct {
+	Address     common.Address
+	Staked      *big.Int // Security deposit of the candidate
+	BlockNumber uint64   // Block the candidate registered at
+	Exiting     bool     // Whether the candidate leaves at the transition
+}
+
+// ElectionStrategy elects the validators of the next epoch out of candidates,
+// ordered by address. The seed is the hash of the parent of the transition
+// block, from the election seed block on its ElectionSeed, the same inputs must
+// elect the same validators on every node.
+type ElectionStrategy interface {
+	Elect(candidates []CandidateInfo, seed common.Hash, maxValidators int) []common.Address
+}
+
+var (
+	electionStrategies = map[string]ElectionStrategy{
+		RandomElection:    randomElection{},
+		StakeElection:     stakeElection{},
+		SeniorityElection: seniorityElection{},
+	}
+	electionStrategiesLock sync.RWMutex
+)
+
+// RegisterElectionStrategy registers strategy by name, chain configs select it
+// through their election strategy field. It panics if the name is taken.
+func RegisterElectionStrategy(name string, strategy ElectionStrategy) {
+	electionStrategiesLock.Lock()
+	defer electionStrategiesLock.Unlock()
+
+	if name == "" || strategy == nil {
+		panic("equality: invalid election strategy")
+	}
+	if _, ok := electionStrategies[name]; ok {
+		panic("equality: election strategy " + name + " registered twice")
+	}
+	electionStrategies[name] = strategy
+}
+
+// electionStrategyOf returns the election strategy selected by config, the
+// random one if unset.
+func electionStrategyOf(config params.EqualityConfig) (ElectionStrategy, error) {
+	name := config.ElectionStrategy
+	if name == "" {
+		name = RandomElection
+	}
+	electionStrategiesLock.RLock()
+	defer electionStrategiesLock.RUnlock()
+
+	strategy, ok := electionStrategies[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", errUnknownElectionStrategy, config.ElectionStrategy)
+	}
+	return strategy, nil
+}
+
+// electionSeed returns the seed of the random number generators derived from
+// the seed of an election.
+func electionSeed(seed common.Hash) int64 {
+	return int64(binary.LittleEndian.Uint32(crypto.Keccak512(seed.Bytes())))
+}
+
+// randomElection shuffles the candidates, each with the same chance.
+type randomElection struct{}
+
+// Elect implements ElectionStrategy.
+func (randomElection) Elect(candidates []CandidateInfo, seed common.Hash, maxValidators int) []common.Address {
+	if maxValidators <= 0 || len(candidates) == 0 {
+		return nil
+	}
+	addresses := make([]common.Address, 0, len(candidates))
+	for _, candidate := range candidates {
+		addresses = append(addresses, candidate.Address)
+	}
+	return shuffleCandidates(addresses, electionSeed(seed), maxValidators)
+}
+
+// shuffleCandidates shuffles candidates in place with seed and returns the
+// first n of them.
+func shuffleCandidates(candidates []common.Address, seed int64, n int) []common.Address {
+	r := rand.New(rand.NewSource(seed))
+	for i := len(candidates) - 1; i > 0; i-- {
+		j := int(r.Int31n(int32(i + 1)))
+		candidates[i], candidates[j] = candidates[j], candidates[i]
+	}
+	if len(candidates) > n {
+		candidates = candidates[:n]
+	}
+	return candidates
+}
+
+// stakeElection draws the candidates one after the other, the chance of each
+// proportional to its deposit plus one wei, so that candidates without one
+// are still drawn.
+type stakeElection struct{}
+
+// Elect implements ElectionStrategy.
+func (stakeElection) Elect(candidates []CandidateInfo, seed common.Hash, maxValidators int) []common.Address {
+	if maxValidators <= 0 || len(candidates) == 0 {
+		return nil
+	}
+	weights := make([]*big.Int, len(candidates))
+	total := new(big.Int)
+	for i, candidate := range candidates {
+		weights[i] = new(big.Int).Set(common.Big1)
+		if candidate.Staked != nil && candidate.Staked.Sign() > 0 {
+			weights[i].Add(weights[i], candidate.Staked)
+		}
+		total.Add(total, weights[i])
+	}
+
+	remaining := append([]CandidateInfo(nil), candidates...)
+	elected := make([]common.Address, 0, maxValidators)
+	for round := uint64(0); len(remaining) > 0 && len(elected) < maxValidators; round++ {
+		var index [8]byte
+		binary.BigEndian.PutUint64(index[:], round)
+		draw := new(big.Int).SetBytes(crypto.Keccak256(seed.Bytes(), index[:]))
+		draw.Mod(draw, total)
+
+		picked := len(remaining) - 1
+		for i, weight := range weights {
+			if draw.Cmp(weight) < 0 {
+				picked = i
+				break
+			}
+			draw.Sub(draw, weight)
+		}
+		elected = append(elected, remaining[picked].Address)
+		total.Sub(total, weights[picked])
+		remaining = append(remaining[:picked], remaining[picked+1:]...)
+		weights = append(weights[:picked], weights[picked+1:]...)
+	}
+	return elected
+}
+
+// seniorityElection elects the candidates registered the earliest, the lower
+// address first among the ones registered at the same block.
+type seniorityElection struct{}
+
+// Elect implements ElectionStrategy.
+func (seniorityElection) Elect(candidates []CandidateInfo, seed common.Hash, maxValidators int) []common.Address {
+	if maxValidators <= 0 || len(candidates) == 0 {
+		return nil
+	}
+	sorted := append([]CandidateInfo(nil), candidates...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if sorted[i].BlockNumber != sorted[j].BlockNumber {
+			return sorted[i].BlockNumber < sorted[j].BlockNumber
+		}
+		return bytes.Compare(sorted[i].Address.Bytes(), sorted[j].Address.Bytes()) < 0
+	})
+	if len(sorted) > maxValidators {
+		sorted = sorted[:maxValidators]
+	}
+	elected := make([]common.Address, 0, len(sorted))
+	for _, candidate := range sorted {
+		elected = append(elected, candidate.Address)
+	}
+	return elected
+}
@@ -0,0 +1,130 @@
+package equality
+
+import (
+	"encoding/binary"
+	"errors"
+	"math/big"
+	"math/rand"
+	"testing"
+
+	"github.com/SecretBlockChain/go-secret/common"
+	"github.com/SecretBlockChain/go-secret/core/rawdb"
+	"github.com/SecretBlockChain/go-secret/crypto"
+	"github.com/SecretBlockChain/go-secret/params"
+	"github.com/stretchr/testify/assert"
+)
+
+// newTestElectionSnapshot returns a snapshot of count candidates registered at
+// descending blocks with ascending deposits.
+func newTestElectionSnapshot(t *testing.T, count int) *Snapshot {
+	snap, err := newSnapshot(rawdb.NewMemoryDatabase())
+	assert.Nil(t, err)
+	for i := 0; i < count; i++ {
+		key, _ := crypto.GenerateKey()
+		_, err = snap.BecomeCandidate(crypto.PubkeyToAddress(key.PublicKey), uint64(count-i), big.NewInt(int64(i)*1000))
+		assert.Nil(t, err)
+	}
+	return snap
+}
+
+// legacyRandCandidates is the election at random before the election
+// strategies were introduced.
+func legacyRandCandidates(candidates []common.Address, parentHash common.Hash, n int) []common.Address {
+	seed := int64(binary.LittleEndian.Uint32(crypto.Keccak512(parentHash.Bytes())))
+	shuffled := append([]common.Address(nil), candidates...)
+	r := rand.New(rand.NewSource(seed))
+	for i := len(shuffled) - 1; i > 0; i-- {
+		j := int(r.Int31n(int32(i + 1)))
+		shuffled[i], shuffled[j] = shuffled[j], shuffled[i]
+	}
+	if len(shuffled) > n {
+		shuffled = shuffled[:n]
+	}
+	return shuffled
+}
+
+func TestRandomElectionUnchanged(t *testing.T) {
+	snap := newTestElectionSnapshot(t, 12)
+	candidates, err := snap.CandidateInfos()
+	assert.Nil(t, err)
+	assert.Len(t, candidates, 12)
+	addresses := make([]common.Address, 0, len(candidates))
+	for _, candidate := range candidates {
+		addresses = append(addresses, candidate.Address)
+	}
+
+	strategy, err := electionStrategyOf(params.EqualityConfig{})
+	assert.Nil(t, err)
+	assert.Equal(t, randomElection{}, strategy)
+	for i := 0; i < 32; i++ {
+		parentHash := crypto.Keccak256Hash([]byte{byte(i)})
+		for _, n := range []int{1, 5, 12, 21} {
+			want := legacyRandCandidates(addresses, parentHash, n)
+			assert.Equal(t, want, strategy.Elect(candidates, parentHash, n))
+			elected, err := snap.RandCandidates(electionSeed(parentHash), n)
+			assert.Nil(t, err)
+			assert.Equal(t, want, elected)
+		}
+	}
+	assert.Nil(t, strategy.Elect(nil, common.Hash{}, 3))
+	assert.Nil(t, strategy.Elect(candidates, common.Hash{}, 0))
+}
+
+func TestElectionStrategiesDeterministic(t *testing.T) {
+	snap := newTestElectionSnapshot(t, 10)
+	candidates, err := snap.CandidateInfos()
+	assert.Nil(t, err)
+	seed := crypto.Keccak256Hash([]byte("parent"))
+
+	for _, name := range []string{StakeElection, SeniorityElection} {
+		strategy, err := electionStrategyOf(params.EqualityConfig{ElectionStrategy: name})
+		assert.Nil(t, err)
+		want := strategy.Elect(candidates, seed, 4)
+		assert.Len(t, want, 4, name)
+		assert.Equal(t, 4, NewAddressSet(want...).Len(), name)
+		for i := 0; i < 16; i++ {
+			assert.Equal(t, want, strategy.Elect(candidates, seed, 4), name)
+		}
+		// The candidates are left untouched
+		again, err := snap.CandidateInfos()
+		assert.Nil(t, err)
+		assert.Equal(t, again, candidates, name)
+		assert.Len(t, strategy.Elect(candidates, seed, 20), 10, name)
+	}
+
+	// The most senior candidates are the ones registered the earliest
+	seniority := seniorityElection{}.Elect(candidates, seed, 3)
+	for _, elected := range seniority {
+		for _, candidate := range candidates {
+			if candidate.Address == elected {
+				assert.True(t, candidate.BlockNumber <= 3)
+			}
+		}
+	}
+	assert.Equal(t, seniority, seniorityElection{}.Elect(candidates, common.Hash{0x01}, 3))
+
+	// A candidate with most of the deposits is drawn first
+	heavy := append([]CandidateInfo(nil), candidates...)
+	heavy[0].Staked = new(big.Int).Lsh(common.Big1, 128)
+	for i := 0; i < 8; i++ {
+		elected := stakeElection{}.Elect(heavy, crypto.Keccak256Hash([]byte{byte(i)}), 2)
+		assert.Equal(t, heavy[0].Address, elected[0])
+	}
+}
+
+func TestElectionStrategyRegistry(t *testing.T) {
+	_, err := electionStrategyOf(params.EqualityConfig{ElectionStrategy: "unknown"})
+	assert.True(t, errors.Is(err, errUnknownElectionStrategy))
+	config := params.EqualityConfig{Period: 3, Epoch: 3, MaxValidatorsCount: 1, MinCandidateBalance: big.NewInt(0),
+		ElectionStrategy: "unknown"}
+	assert.True(t, errors.Is(validateChainConfig(config), errInvalidChainConfig))
+	config.ElectionStrategy = SeniorityElection
+	assert.Nil(t, validateChainConfig(config))
+
+	assert.Panics(t, func() { RegisterElectionStrategy(RandomElection, seniorityElection{}) })
+	assert.Panics(t, func() { RegisterElectionStrategy("", seniorityElection{}) })
+	RegisterElectionStrategy("test", seniorityElection{})
+	strategy, err := electionStrategyOf(params.EqualityConfig{ElectionStrategy: "test"})
+	assert.Nil(t, err)
+	assert.Equal(t, seniorityElection{}, strategy)
+}
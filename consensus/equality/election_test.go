@@ -0,0 +1,197 @@
+package equality
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"io/ioutil"
+	"math/big"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"github.com/SecretBlockChain/go-secret/common"
+	"github.com/SecretBlockChain/go-secret/common/hexutil"
+	"github.com/SecretBlockChain/go-secret/core/rawdb"
+	"github.com/SecretBlockChain/go-secret/core/state"
+	"github.com/SecretBlockChain/go-secret/core/types"
+	"github.com/SecretBlockChain/go-secret/crypto"
+	"github.com/SecretBlockChain/go-secret/params"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/sha3"
+)
+
+// electionVector is a test vector of the seeded election for other clients:
+// the seed of the parent hash and the epoch, and the candidates it selects.
+type electionVector struct {
+	ParentHash    common.Hash      `json:"parentHash"`
+	Epoch         hexutil.Uint64   `json:"epoch"`
+	Seed          common.Hash      `json:"seed"`
+	Candidates    []common.Address `json:"candidates"`
+	MaxValidators int              `json:"maxValidators"`
+	Selected      []common.Address `json:"selected"`
+}
+
+// specSelectCandidates follows the specification of the seeded election word
+// by word.
+func specSelectCandidates(parentHash common.Hash, epoch uint64, candidates []common.Address, n int) []common.Address {
+	keccak := func(data ...[]byte) []byte {
+		hasher := sha3.NewLegacyKeccak256()
+		for _, b := range data {
+			hasher.Write(b)
+		}
+		return hasher.Sum(nil)
+	}
+	number := make([]byte, 8)
+	binary.BigEndian.PutUint64(number, epoch)
+	state := keccak(parentHash.Bytes(), number)
+
+	order := append([]common.Address(nil), candidates...)
+	sort.Slice(order, func(i, j int) bool { return bytes.Compare(order[i].Bytes(), order[j].Bytes()) < 0 })
+	for i := len(order) - 1; i > 0; i-- {
+		state = keccak(state)
+		j := new(big.Int).Mod(new(big.Int).SetBytes(state[:8]), big.NewInt(int64(i+1))).Int64()
+		order[i], order[j] = order[j], order[i]
+	}
+	if len(order) > n {
+		order = order[:n]
+	}
+	return order
+}
+
+func TestElectionSeed(t *testing.T) {
+	parent := common.HexToHash("0x01")
+	seed := ElectionSeed(parent, 2)
+	assert.Equal(t, crypto.Keccak256Hash(parent.Bytes(), []byte{0, 0, 0, 0, 0, 0, 0, 2}), seed)
+	assert.NotEqual(t, seed, ElectionSeed(parent, 3))
+	assert.NotEqual(t, seed, ElectionSeed(common.HexToHash("0x02"), 2))
+}
+
+func TestSelectCandidates(t *testing.T) {
+	snap := newTestElectionSnapshot(t, 12)
+	infos, err := snap.CandidateInfos()
+	assert.Nil(t, err)
+	candidates := make([]common.Address, 0, len(infos))
+	for _, info := range infos {
+		candidates = append(candidates, info.Address)
+	}
+	reversed := make([]common.Address, 0, len(candidates))
+	for i := len(candidates) - 1; i >= 0; i-- {
+		reversed = append(reversed, candidates[i])
+	}
+
+	for epoch := uint64(1); epoch <= 16; epoch++ {
+		parent := crypto.Keccak256Hash([]byte{byte(epoch)})
+		seed := ElectionSeed(parent, epoch)
+		all := SelectCandidates(candidates, seed, len(candidates))
+		assert.ElementsMatch(t, candidates, all)
+		assert.Equal(t, specSelectCandidates(parent, epoch, candidates, len(candidates)), all)
+
+		// The order the candidates are given in doesn't matter, and fewer
+		// validators are the first ones of the shuffle
+		assert.Equal(t, all, SelectCandidates(reversed, seed, len(candidates)))
+		for n := 1; n <= len(candidates); n++ {
+			assert.Equal(t, all[:n], SelectCandidates(candidates, seed, n))
+		}
+		assert.Equal(t, all, seededElection{}.Elect(infos, seed, 20))
+	}
+	assert.Nil(t, SelectCandidates(nil, common.Hash{}, 3))
+	assert.Nil(t, SelectCandidates(candidates, common.Hash{}, 0))
+}
+
+func TestElectionVectors(t *testing.T) {
+	var vectors []electionVector
+	for i, test := range []struct {
+		candidates, maxValidators int
+		epoch                     uint64
+	}{
+		{1, 1, 1}, {2, 1, 2}, {3, 3, 2}, {5, 3, 7}, {10, 4, 100}, {21, 21, 3}, {32, 21, 4096},
+	} {
+		vector := electionVector{
+			ParentHash:    crypto.Keccak256Hash([]byte("parent"), []byte{byte(i)}),
+			Epoch:         hexutil.Uint64(test.epoch),
+			MaxValidators: test.maxValidators,
+		}
+		set := NewAddressSet()
+		for j := 0; j < test.candidates; j++ {
+			set.Add(common.BytesToAddress(crypto.Keccak256([]byte{byte(i), byte(j)})))
+		}
+		vector.Candidates = set.Slice()
+		vector.Seed = ElectionSeed(vector.ParentHash, test.epoch)
+		vector.Selected = SelectCandidates(vector.Candidates, vector.Seed, test.maxValidators)
+		assert.Equal(t, specSelectCandidates(vector.ParentHash, test.epoch, vector.Candidates, test.maxValidators), vector.Selected)
+		vectors = append(vectors, vector)
+	}
+	data, err := json.MarshalIndent(vectors, "", "  ")
+	assert.Nil(t, err)
+	data = append(data, '\n')
+
+	path := filepath.Join("testdata", "golden", "election_vectors.json")
+	if *updateGolden {
+		assert.Nil(t, ioutil.WriteFile(path, data, 0644))
+		return
+	}
+	golden, err := ioutil.ReadFile(path)
+	assert.Nil(t, err)
+	var want []electionVector
+	assert.Nil(t, json.Unmarshal(golden, &want))
+	for _, vector := range want {
+		assert.Equal(t, vector.Seed, ElectionSeed(vector.ParentHash, uint64(vector.Epoch)))
+		assert.Equal(t, vector.Selected, SelectCandidates(vector.Candidates, vector.Seed, vector.MaxValidators))
+	}
+	if string(golden) != string(data) {
+		t.Errorf("%s changed, run go test -run TestElectionVectors -update if intended", path)
+	}
+}
+
+func TestSeededElectionTransition(t *testing.T) {
+	statedb, err := state.New(common.Hash{}, state.NewDatabase(rawdb.NewMemoryDatabase()), nil)
+	assert.Nil(t, err)
+	parent := common.HexToHash("0x01")
+
+	var candidates []common.Address
+	for i := 0; i < 12; i++ {
+		candidates = append(candidates, common.BytesToAddress(crypto.Keccak256([]byte{byte(i)})))
+	}
+	candidates = NewAddressSet(candidates...).Slice()
+
+	// elect returns the trail and the validators of the transition starting
+	// epoch+1, and the candidates in the order the snapshot lists them
+	elect := func(config params.EqualityConfig, epoch uint64) (*electionTrail, []common.Address, []common.Address) {
+		snap, err := newSnapshot(rawdb.NewMemoryDatabase())
+		assert.Nil(t, err)
+		for _, candidate := range candidates {
+			_, err = snap.BecomeCandidate(candidate, 1, big.NewInt(0))
+			assert.Nil(t, err)
+		}
+		assert.Nil(t, snap.SetValidators(nil))
+		infos, err := snap.CandidateInfos()
+		assert.Nil(t, err)
+		listed := make([]common.Address, 0, len(infos))
+		for _, info := range infos {
+			listed = append(listed, info.Address)
+		}
+		header := &types.Header{Number: big.NewInt(int64(epoch*config.Epoch + 1)), ParentHash: parent}
+		headerExtra := HeaderExtra{Epoch: epoch + 1, EpochBlock: header.Number.Uint64()}
+		trail := new(electionTrail)
+		assert.Nil(t, New(&config, rawdb.NewMemoryDatabase()).elect(config, statedb, header, snap, &headerExtra, nil, trail))
+		return trail, headerExtra.CurrentEpochValidators, listed
+	}
+
+	// Before the election seed block the legacy shuffle elects
+	config := params.EqualityConfig{Epoch: 10, MaxValidatorsCount: 5, ElectionSeedBlock: big.NewInt(31)}
+	trail, validators, listed := elect(config, 2)
+	assert.Equal(t, legacyRandCandidates(listed, parent, 5), validators)
+	assert.NotNil(t, trail.Seed)
+	assert.Nil(t, trail.SeedHash)
+
+	// From it on the specified selection elects, a seed per epoch
+	trail, validators, _ = elect(config, 3)
+	assert.Equal(t, SelectCandidates(candidates, ElectionSeed(parent, 4), 5), validators)
+	if assert.NotNil(t, trail.SeedHash) {
+		assert.Equal(t, ElectionSeed(parent, 4), *trail.SeedHash)
+	}
+	assert.Nil(t, trail.Seed)
+	_, next, _ := elect(config, 4)
+	assert.Equal(t, SelectCandidates(candidates, ElectionSeed(parent, 5), 5), next)
+}
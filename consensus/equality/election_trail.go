@@ -0,0 +1,209 @@
+package equality
+
+import (
+	"math"
+
+	"github.com/SecretBlockChain/go-secret/common"
+	"github.com/SecretBlockChain/go-secret/common/hexutil"
+	"github.com/SecretBlockChain/go-secret/consensus"
+	"github.com/SecretBlockChain/go-secret/core/rawdb"
+	"github.com/SecretBlockChain/go-secret/core/state"
+	"github.com/SecretBlockChain/go-secret/core/types"
+	"github.com/SecretBlockChain/go-secret/log"
+)
+
+// Kick out decisions left undone, the reason of their electionKickOut.
+const (
+	kickOutExited          = "exited"           // The validator already left as an exiting candidate
+	kickOutSingleValidator = "single validator" // A dev chain of a max validators count of 1 keeps its validator
+	kickOutCandidateFloor  = "candidate floor"  // The candidate count is down to the safe size
+	kickOutMinValidators   = "min validators"   // The candidate count is down to the min validators count
+)
+
+// electionMintCount is the activity of a validator of the previous epoch and
+// the threshold it is kicked out below: the blocks it minted out of the ones
+// it was scheduled for, inactive if less than minMinted.
+type electionMintCount struct {
+	Address   common.Address `json:"address"`
+	Minted    hexutil.Uint64 `json:"minted"`
+	Scheduled hexutil.Uint64 `json:"scheduled"`
+	MinMinted hexutil.Uint64 `json:"minMinted"`
+	Inactive  bool           `json:"inactive"`
+}
+
+// electionKickOut is the kick out decision of an inactive validator, the
+// candidate count and the safe size it is checked against.
+type electionKickOut struct {
+	Address        common.Address `json:"address"`
+	Kicked         bool           `json:"kicked"`
+	Reason         string         `json:"reason,omitempty"`
+	CandidateCount int            `json:"candidateCount"`
+	SafeSize       int            `json:"safeSize"`
+}
+
+// electionTrail is the decision trail of the election of an epoch block. The
+// decisions are logged at trace level as they are taken and recorded into the
+// trail, a nil trail records nothing and the values only logged are computed
+// once trace logging is enabled.
+type electionTrail struct {
+	BlockNumber     hexutil.Uint64      `json:"blockNumber"`
+	Epoch           hexutil.Uint64      `json:"epoch"`
+	Exited          []common.Address    `json:"exited"`
+	Candidates      int                 `json:"candidates"`
+	MintCounts      []electionMintCount `json:"mintCounts"`
+	KickOuts        []electionKickOut   `json:"kickOuts"`
+	DelegatedVoting bool                `json:"delegatedVoting"`
+	Seed            *hexutil.Uint64     `json:"seed,omitempty"`
+	SeedHash        *common.Hash        `json:"seedHash,omitempty"`
+	ValidatorCount  int                 `json:"validatorCount,omitempty"`
+	CarriedOver     bool                `json:"carriedOver"`
+	Validators      []common.Address    `json:"validators"`
+}
+
+// begin records the exiting candidates leaving before the election and the
+// number of candidates left.
+func (trail *electionTrail) begin(number, epoch uint64, exited []common.Address, snap *Snapshot) {
+	if trail == nil {
+		log.Trace("[equality] Election started", "number", number, "epoch", epoch,
+			"exited", len(exited), "candidates", log.Lazy{Fn: func() int {
+				count, _ := snap.EnoughCandidates(math.MaxInt32)
+				return count
+			}})
+		return
+	}
+	trail.BlockNumber, trail.Epoch = hexutil.Uint64(number), hexutil.Uint64(epoch)
+	trail.Exited = append([]common.Address{}, exited...)
+	trail.Candidates, _ = snap.EnoughCandidates(math.MaxInt32)
+	log.Trace("[equality] Election started", "number", number, "epoch", epoch,
+		"exited", len(exited), "candidates", trail.Candidates)
+}
+
+// mintCount records the activity of a validator of the previous epoch.
+func (trail *electionTrail) mintCount(count electionMintCount) {
+	log.Trace("[equality] Election mint count", "validator", count.Address, "minted", uint64(count.Minted),
+		"scheduled", uint64(count.Scheduled), "minMinted", uint64(count.MinMinted), "inactive", count.Inactive)
+	if trail != nil {
+		trail.MintCounts = append(trail.MintCounts, count)
+	}
+}
+
+// kickOut records the kick out decision of an inactive validator.
+func (trail *electionTrail) kickOut(decision electionKickOut) {
+	log.Trace("[equality] Election kick out", "validator", decision.Address, "kicked", decision.Kicked,
+		"reason", decision.Reason, "candidateCount", decision.CandidateCount, "safeSize", decision.SafeSize)
+	if trail != nil {
+		trail.KickOuts = append(trail.KickOuts, decision)
+	}
+}
+
+// seed records the seed the candidates are shuffled with, none for delegated
+// voting electing the candidates with the most votes.
+func (trail *electionTrail) seed(delegated bool, seed int64) {
+	if delegated {
+		log.Trace("[equality] Election by votes")
+	} else {
+		log.Trace("[equality] Election seed", "seed", seed)
+	}
+	if trail != nil {
+		trail.DelegatedVoting = delegated
+		if !delegated {
+			value := hexutil.Uint64(seed)
+			trail.Seed = &value
+		}
+	}
+}
+
+// seedHash records the seed the candidates are shuffled with from the election
+// seed block on.
+func (trail *electionTrail) seedHash(seed common.Hash) {
+	log.Trace("[equality] Election seed", "seed", seed)
+	if trail != nil {
+		trail.DelegatedVoting = false
+		trail.SeedHash = &seed
+	}
+}
+
+// validatorCount records the number of validators elected at most, sized by
+// the validator count formula out of the candidates left.
+func (trail *electionTrail) validatorCount(formula string, candidates, n int) {
+	log.Trace("[equality] Election size", "formula", formula, "candidates", candidates, "validators", n)
+	if trail != nil {
+		trail.ValidatorCount = n
+	}
+}
+
+// carryOver records the validators of the previous epoch carrying on, too few
+// candidates being left to reach the min validators count.
+func (trail *electionTrail) carryOver() {
+	log.Trace("[equality] Election carries the validators over")
+	if trail != nil {
+		trail.CarriedOver = true
+	}
+}
+
+// elected records the validators elected.
+func (trail *electionTrail) elected(validators []common.Address) {
+	log.Trace("[equality] Election done", "validators", log.Lazy{Fn: func() string {
+		return validatorsToString(validators)
+	}})
+	if trail != nil {
+		trail.Validators = append([]common.Address{}, validators...)
+	}
+}
+
+// stateReader is implemented by the chains giving access to the state of
+// their blocks.
+type stateReader interface {
+	StateAt(root common.Hash) (*state.StateDB, error)
+}
+
+// replayElection re-runs the election of the transition block header on a copy
+// of the snapshot of its parent and returns its decision trail, consistent if
+// it elects the validators and kicks out the candidates of the block.
+func (e *Equality) replayElection(chain consensus.ChainHeaderReader, header *types.Header) (*electionTrail, bool, error) {
+	headerExtra, err := e.DecodeHeaderExtraCached(header)
+	if err != nil {
+		return nil, false, err
+	}
+	parent := chain.GetHeader(header.ParentHash, header.Number.Uint64()-1)
+	if parent == nil {
+		return nil, false, consensus.ErrUnknownAncestor
+	}
+	snap, err := e.snapshot(chain, parent, nil)
+	if err != nil {
+		return nil, false, err
+	}
+	config, err := e.chainConfig(parent)
+	if err != nil {
+		return nil, false, err
+	}
+
+	// The operations of the block precede its election, the refunds go to a
+	// throwaway state, the one of the block if the chain has it for the code
+	// of the candidates checked from the candidate guard block on
+	if err = snap.applyOperations(config, header, headerExtra); err != nil {
+		return nil, false, err
+	}
+	var statedb *state.StateDB
+	if reader, ok := chain.(stateReader); ok {
+		statedb, _ = reader.StateAt(header.Root)
+	}
+	if statedb == nil {
+		if statedb, err = state.New(common.Hash{}, state.NewDatabase(rawdb.NewMemoryDatabase()), nil); err != nil {
+			return nil, false, err
+		}
+	}
+	replayed := HeaderExtra{Epoch: headerExtra.Epoch, EpochBlock: headerExtra.EpochBlock}
+	ranking, err := e.electionRankingOf(chain, config, header, parent, headerExtra)
+	if err != nil {
+		return nil, false, err
+	}
+	trail := new(electionTrail)
+	if err = e.elect(config, statedb, header, snap, &replayed, ranking, trail); err != nil {
+		return nil, false, err
+	}
+	replayed, headerExtra = replayed.Canonicalize(), headerExtra.Canonicalize()
+	consistent := addressesEqual(replayed.CurrentEpochValidators, headerExtra.CurrentEpochValidators) &&
+		addressesEqual(replayed.CurrentBlockKickOutCandidates, headerExtra.CurrentBlockKickOutCandidates)
+	return trail, consistent, nil
+}
@@ -0,0 +1,113 @@
+package equality
+
+import (
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/SecretBlockChain/go-secret/common"
+	"github.com/SecretBlockChain/go-secret/core/rawdb"
+	"github.com/SecretBlockChain/go-secret/core/state"
+	"github.com/SecretBlockChain/go-secret/core/types"
+	"github.com/SecretBlockChain/go-secret/crypto"
+	"github.com/SecretBlockChain/go-secret/params"
+	"github.com/stretchr/testify/assert"
+)
+
+// newTestElectionChain returns an API over a chain of validator A sealing the
+// first epoch alone while a candidate registers, the second epoch starting at
+// block 4 where validator B or C is kicked out. The blocks are finalized as
+// the engine does.
+func newTestElectionChain(t *testing.T) (*API, params.EqualityConfig) {
+	key, _ := crypto.GenerateKey()
+	candidate := crypto.PubkeyToAddress(key.PublicKey)
+	validatorA := common.HexToAddress("0xa000000000000000000000000000000000000000")
+	validatorB := common.HexToAddress("0xb000000000000000000000000000000000000000")
+	validatorC := common.HexToAddress("0xc000000000000000000000000000000000000000")
+
+	db := rawdb.NewMemoryDatabase()
+	statedb, err := state.New(common.Hash{}, state.NewDatabase(db), nil)
+	assert.Nil(t, err)
+	statedb.AddBalance(candidate, big.NewInt(10))
+
+	config := params.EqualityConfig{Period: 3, Epoch: 3, MaxValidatorsCount: 3, MinCandidateBalance: big.NewInt(5),
+		KickOutRatio: 50, Validators: []common.Address{validatorA, validatorB, validatorC}}
+	e := New(&config, db)
+	api := &API{chain: &testHeaderChain{config: params.TestnetChainConfig}, equality: e}
+	chain := api.chain.(*testHeaderChain)
+	chain.headers = []*types.Header{{Number: big.NewInt(0)}}
+
+	for number := uint64(1); number <= 4; number++ {
+		parent := chain.headers[number-1]
+		header := &types.Header{Number: new(big.Int).SetUint64(number), ParentHash: parent.Hash(), Coinbase: validatorA}
+		headerExtra := HeaderExtra{Epoch: 1, EpochBlock: 1}
+		if number == 4 {
+			headerExtra = HeaderExtra{Epoch: 2, EpochBlock: 4}
+		}
+		var txs []*types.Transaction
+		if number == 2 {
+			txs = append(txs, newVoteTestTransaction(t, key, "equality:1:event:candidate"))
+		}
+
+		snap, err := e.snapshot(chain, parent, nil)
+		assert.Nil(t, err)
+		assert.Nil(t, snap.MintBlock(headerExtra.Epoch, number, header.Coinbase))
+		e.processTransactions(config, statedb, header, snap, &headerExtra, txs)
+		assert.Nil(t, e.tryElect(config, statedb, header, snap, &headerExtra, nil))
+		assert.Nil(t, snap.activateChainConfig(number))
+		assert.Nil(t, snap.settleEpochLength(config, number, headerExtra.EpochBlock))
+		headerExtra.Root, err = snap.Root()
+		assert.Nil(t, err)
+		assert.Nil(t, snap.Commit(headerExtra.Root))
+		header.Extra = newTestHeader(number, headerExtra).Extra
+		chain.headers = append(chain.headers, header)
+	}
+	return api, config
+}
+
+func TestExplainElection(t *testing.T) {
+	validatorA := common.HexToAddress("0xa000000000000000000000000000000000000000")
+	validatorB := common.HexToAddress("0xb000000000000000000000000000000000000000")
+	validatorC := common.HexToAddress("0xc000000000000000000000000000000000000000")
+	api, config := newTestElectionChain(t)
+	chain := api.chain.(*testHeaderChain)
+	debug := &DebugAPI{chain: api.chain, equality: api.equality}
+	transition, err := api.equality.DecodeHeaderExtraCached(chain.headers[4])
+	assert.Nil(t, err)
+	assert.Len(t, transition.CurrentBlockKickOutCandidates, 1)
+
+	// The validators that minted nothing are inactive, one of them is kicked
+	// out before the candidates fall to the safe size
+	result, err := debug.ExplainElection(2)
+	assert.Nil(t, err)
+	assert.True(t, result.Consistent)
+	assert.Equal(t, chain.headers[4].Hash(), result.Hash)
+	assert.Equal(t, uint64(4), uint64(result.BlockNumber))
+	assert.Equal(t, 4, result.Candidates)
+	assert.Len(t, result.MintCounts, 3)
+	for _, count := range result.MintCounts {
+		assert.Equal(t, uint64(1), uint64(count.Scheduled), "validator %x", count.Address)
+		assert.Equal(t, uint64(1), uint64(count.MinMinted), "validator %x", count.Address)
+		assert.Equal(t, count.Address != validatorA, count.Inactive, "validator %x", count.Address)
+	}
+	kicked, kept := transition.CurrentBlockKickOutCandidates[0], validatorB
+	if kicked == validatorB {
+		kept = validatorC
+	}
+	assert.Equal(t, []electionKickOut{
+		{Address: kicked, Kicked: true, CandidateCount: 4, SafeSize: 3},
+		{Address: kept, Reason: kickOutCandidateFloor, CandidateCount: 3, SafeSize: 3},
+	}, result.KickOuts)
+	assert.NotNil(t, result.Seed)
+	assert.Equal(t, transition.CurrentEpochValidators, result.Validators)
+
+	// The genesis validators are elected at the first block, the epochs not
+	// reached are rejected
+	result, err = debug.ExplainElection(1)
+	assert.Nil(t, err)
+	assert.True(t, result.Consistent)
+	assert.ElementsMatch(t, config.Validators, result.Validators)
+	assert.Empty(t, result.KickOuts)
+	_, err = debug.ExplainElection(3)
+	assert.True(t, errors.Is(err, errInvalidEpochRange))
+}
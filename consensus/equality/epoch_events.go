@@ -0,0 +1,267 @@
+package equality
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+
+	"github.com/SecretBlockChain/go-secret/common"
+	"github.com/SecretBlockChain/go-secret/common/hexutil"
+	"github.com/SecretBlockChain/go-secret/consensus"
+	"github.com/SecretBlockChain/go-secret/core/types"
+	"github.com/SecretBlockChain/go-secret/event"
+	"github.com/SecretBlockChain/go-secret/log"
+	"github.com/SecretBlockChain/go-secret/rpc"
+)
+
+// maxNotifiedEpochs is the number of notified epoch transitions remembered to
+// recognize the transitions replaced by a reorg.
+const maxNotifiedEpochs = 128
+
+// errEpochEventsUnavailable is returned by the epoch subscription if the engine
+// is not following a chain.
+var errEpochEventsUnavailable = errors.New("epoch events unavailable")
+
+// EpochListener is notified of an epoch transition at block number, from the
+// old to the new validators. On a reorg replacing an already notified
+// transition, old holds the validators of the replaced transition.
+type EpochListener func(number uint64, old, new []common.Address, extra HeaderExtra)
+
+// EpochEvent is posted to the event mux for every epoch transition on the
+// canonical chain. Replaced is the hash of the transition block at the same
+// height the event replaces after a reorg, nil otherwise.
+type EpochEvent struct {
+	Number        uint64
+	Hash          common.Hash
+	OldValidators []common.Address
+	NewValidators []common.Address
+	HeaderExtra   HeaderExtra
+	Replaced      *common.Hash
+}
+
+// notifiedEpoch is an epoch transition the listeners have been notified of.
+type notifiedEpoch struct {
+	number     uint64
+	hash       common.Hash
+	validators []common.Address
+}
+
+// epochTransition is an epoch transition block awaiting notification.
+type epochTransition struct {
+	header   *types.Header
+	extra    HeaderExtra
+	replaced *notifiedEpoch
+}
+
+// epochNotifier tracks the epoch transitions of the canonical chain.
+type epochNotifier struct {
+	listeners []EpochListener
+	mux       *event.TypeMux
+	notified  []notifiedEpoch // Ascending by number
+	lock      sync.Mutex
+}
+
+// find returns the notified transition at number.
+func (notifier *epochNotifier) find(number uint64) (*notifiedEpoch, bool) {
+	idx := sort.Search(len(notifier.notified), func(i int) bool {
+		return notifier.notified[i].number >= number
+	})
+	if idx < len(notifier.notified) && notifier.notified[idx].number == number {
+		return &notifier.notified[idx], true
+	}
+	return nil, false
+}
+
+// record remembers the notified transition, replacing the one at its number.
+func (notifier *epochNotifier) record(epoch notifiedEpoch) {
+	if notified, ok := notifier.find(epoch.number); ok {
+		*notified = epoch
+		return
+	}
+	notifier.notified = append(notifier.notified, epoch)
+	sort.Slice(notifier.notified, func(i, j int) bool {
+		return notifier.notified[i].number < notifier.notified[j].number
+	})
+	if len(notifier.notified) > maxNotifiedEpochs {
+		notifier.notified = notifier.notified[len(notifier.notified)-maxNotifiedEpochs:]
+	}
+}
+
+// RegisterEpochListener registers a listener called synchronously for every
+// epoch transition finalized on the canonical chain. Panics of the listener
+// are recovered and logged.
+func (e *Equality) RegisterEpochListener(listener EpochListener) {
+	e.epochs.lock.Lock()
+	defer e.epochs.lock.Unlock()
+	e.epochs.listeners = append(e.epochs.listeners, listener)
+}
+
+// SetEventMux sets the event mux epoch transitions are posted to as EpochEvent.
+func (e *Equality) SetEventMux(mux *event.TypeMux) {
+	e.epochs.lock.Lock()
+	defer e.epochs.lock.Unlock()
+	e.epochs.mux = mux
+}
+
+// NewChainHead notifies the epoch transitions between the last notified one
+// and the new canonical head. The first head only marks the starting point,
+// transitions before it are not notified.
+func (e *Equality) NewChainHead(chain consensus.ChainHeaderReader, head *types.Header) {
+	e.epochs.lock.Lock()
+	defer e.epochs.lock.Unlock()
+
+	// Walk the epoch transitions back to the last one notified
+	var pending []epochTransition
+	var validators []common.Address
+	for header := head; header != nil && header.Number.Uint64() > 0; {
+		extra, err := e.DecodeHeaderExtraCached(header)
+		if err != nil {
+			log.Warn("[equality] Failed to follow epoch transitions", "number", header.Number, "err", err)
+			return
+		}
+		if extra.EpochBlock != header.Number.Uint64() {
+			if header = chain.GetHeaderByNumber(extra.EpochBlock); header == nil {
+				return
+			}
+			if extra, err = e.DecodeHeaderExtraCached(header); err != nil {
+				log.Warn("[equality] Failed to follow epoch transitions", "number", header.Number, "err", err)
+				return
+			}
+		}
+
+		number := header.Number.Uint64()
+		notified, ok := e.epochs.find(number)
+		if ok && notified.hash == header.Hash() {
+			validators = notified.validators
+			break
+		}
+		if len(e.epochs.notified) == 0 {
+			e.epochs.record(notifiedEpoch{number: number, hash: header.Hash(), validators: extra.CurrentEpochValidators})
+			return
+		}
+		if !ok && number < e.epochs.notified[0].number {
+			break
+		}
+
+		transition := epochTransition{header: header, extra: extra}
+		if ok {
+			replaced := *notified
+			transition.replaced = &replaced
+		}
+		pending = append(pending, transition)
+		if number <= 1 {
+			break
+		}
+		header = chain.GetHeader(header.ParentHash, number-1)
+	}
+
+	// Notify them in chain order
+	for idx := len(pending) - 1; idx >= 0; idx-- {
+		transition := pending[idx]
+		old := validators
+		if transition.replaced != nil {
+			old = transition.replaced.validators
+		}
+		e.notifyEpoch(transition, old)
+		validators = transition.extra.CurrentEpochValidators
+	}
+}
+
+// notifyEpoch notifies the listeners and posts the event of a transition.
+func (e *Equality) notifyEpoch(transition epochTransition, old []common.Address) {
+	number, hash := transition.header.Number.Uint64(), transition.header.Hash()
+	validators := transition.extra.CurrentEpochValidators
+	for _, listener := range e.epochs.listeners {
+		func() {
+			defer func() {
+				if r := recover(); r != nil {
+					log.Error("[equality] Epoch listener panicked", "number", number, "hash", hash, "err", r)
+				}
+			}()
+			listener(number, old, validators, transition.extra)
+		}()
+	}
+
+	ev := EpochEvent{
+		Number:        number,
+		Hash:          hash,
+		OldValidators: old,
+		NewValidators: validators,
+		HeaderExtra:   transition.extra,
+	}
+	if transition.replaced != nil {
+		replaced := transition.replaced.hash
+		ev.Replaced = &replaced
+	}
+	if e.epochs.mux != nil {
+		if err := e.epochs.mux.Post(ev); err != nil {
+			log.Debug("[equality] Failed to post epoch event", "number", number, "err", err)
+		}
+	}
+
+	e.epochs.record(notifiedEpoch{number: number, hash: hash, validators: validators})
+	log.Debug("[equality] Notified epoch transition", "number", number, "hash", hash,
+		"epoch", transition.extra.Epoch, "validators", validatorsToString(validators))
+}
+
+// rpcEpochEvent is the json representation of EpochEvent.
+type rpcEpochEvent struct {
+	Number        hexutil.Uint64    `json:"number"`
+	Hash          common.Hash       `json:"hash"`
+	Epoch         hexutil.Uint64    `json:"epoch"`
+	OldValidators checksumAddresses `json:"oldValidators"`
+	NewValidators checksumAddresses `json:"newValidators"`
+	Replaced      *common.Hash      `json:"replaced"`
+	HeaderExtra   *HeaderExtraJSON  `json:"headerExtra"`
+}
+
+// EpochEventAPI offers the epoch transitions as an eth_subscribe subscription.
+type EpochEventAPI struct {
+	equality *Equality
+}
+
+// EqualityEpoch sends a notification for every epoch transition on the
+// canonical chain, subscribed as eth_subscribe("equalityEpoch").
+func (api *EpochEventAPI) EqualityEpoch(ctx context.Context) (*rpc.Subscription, error) {
+	notifier, supported := rpc.NotifierFromContext(ctx)
+	if !supported {
+		return &rpc.Subscription{}, rpc.ErrNotificationsUnsupported
+	}
+
+	api.equality.epochs.lock.Lock()
+	mux := api.equality.epochs.mux
+	api.equality.epochs.lock.Unlock()
+	if mux == nil {
+		return &rpc.Subscription{}, errEpochEventsUnavailable
+	}
+
+	rpcSub := notifier.CreateSubscription()
+	sub := mux.Subscribe(EpochEvent{})
+	go func() {
+		defer sub.Unsubscribe()
+		for {
+			select {
+			case obj, ok := <-sub.Chan():
+				if !ok {
+					return
+				}
+				ev := obj.Data.(EpochEvent)
+				notifier.Notify(rpcSub.ID, &rpcEpochEvent{
+					Number:        hexutil.Uint64(ev.Number),
+					Hash:          ev.Hash,
+					Epoch:         hexutil.Uint64(ev.HeaderExtra.Epoch),
+					OldValidators: ev.OldValidators,
+					NewValidators: ev.NewValidators,
+					Replaced:      ev.Replaced,
+					HeaderExtra:   ev.HeaderExtra.JSON(),
+				})
+			case <-rpcSub.Err():
+				return
+			case <-notifier.Closed():
+				return
+			}
+		}
+	}()
+	return rpcSub, nil
+}
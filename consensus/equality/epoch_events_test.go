@@ -0,0 +1,115 @@
+package equality
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/SecretBlockChain/go-secret/common"
+	"github.com/SecretBlockChain/go-secret/core/rawdb"
+	"github.com/SecretBlockChain/go-secret/core/types"
+	"github.com/SecretBlockChain/go-secret/event"
+	"github.com/SecretBlockChain/go-secret/params"
+	"github.com/stretchr/testify/assert"
+)
+
+// extendEpochTestChain appends headers up to number with epochs of 4 blocks,
+// the validators elected by a transition are derived from fork.
+func extendEpochTestChain(headers []*types.Header, number uint64, fork int64) []*types.Header {
+	headers = append([]*types.Header{}, headers...)
+	for n := uint64(len(headers)); n <= number; n++ {
+		headerExtra := HeaderExtra{Epoch: (n-1)/4 + 1, EpochBlock: (n-1)/4*4 + 1}
+		if n == headerExtra.EpochBlock {
+			validator := common.BigToAddress(big.NewInt(fork*1000 + int64(n)))
+			headerExtra.CurrentEpochValidators = []common.Address{validator}
+		}
+		header := newTestHeader(n, headerExtra)
+		header.ParentHash = headers[n-1].Hash()
+		header.Time = uint64(fork)
+		headers = append(headers, header)
+	}
+	return headers
+}
+
+type testEpochNotification struct {
+	number uint64
+	old    []common.Address
+	new    []common.Address
+}
+
+func TestEpochListener(t *testing.T) {
+	e := New(params.TestnetEqualityConfig(), rawdb.NewMemoryDatabase())
+	mux := new(event.TypeMux)
+	e.SetEventMux(mux)
+	sub := mux.Subscribe(EpochEvent{})
+	defer sub.Unsubscribe()
+
+	// A panicking listener does not affect the others
+	var notifications []testEpochNotification
+	e.RegisterEpochListener(func(number uint64, old, new []common.Address, extra HeaderExtra) {
+		panic("listener failure")
+	})
+	e.RegisterEpochListener(func(number uint64, old, new []common.Address, extra HeaderExtra) {
+		notifications = append(notifications, testEpochNotification{number, old, new})
+	})
+	events := make(chan EpochEvent, 16)
+	go func() {
+		for obj := range sub.Chan() {
+			events <- obj.Data.(EpochEvent)
+		}
+	}()
+	nextEvent := func() EpochEvent { return <-events }
+
+	validator := func(fork int64, number uint64) []common.Address {
+		return []common.Address{common.BigToAddress(big.NewInt(fork*1000 + int64(number)))}
+	}
+	genesis := []*types.Header{{Number: big.NewInt(0)}}
+	main := extendEpochTestChain(genesis, 10, 0)
+	head := func(headers []*types.Header, number uint64) {
+		chain := &testHeaderChain{config: params.TestnetChainConfig, headers: headers[:number+1]}
+		e.NewChainHead(chain, headers[number])
+	}
+
+	// The first head marks the starting point
+	head(main, 2)
+	head(main, 4)
+	assert.Empty(t, notifications)
+
+	head(main, 6)
+	head(main, 6)
+	head(main, 10)
+	assert.Equal(t, []testEpochNotification{
+		{5, validator(0, 1), validator(0, 5)},
+		{9, validator(0, 5), validator(0, 9)},
+	}, notifications)
+	ev := nextEvent()
+	assert.Equal(t, uint64(5), ev.Number)
+	assert.Nil(t, ev.Replaced)
+	nextEvent()
+
+	// A reorg replacing the transition at 9 notifies the replacement once
+	fork := extendEpochTestChain(main[:7], 12, 1)
+	notifications = nil
+	head(fork, 11)
+	head(fork, 12)
+	assert.Equal(t, []testEpochNotification{{9, validator(0, 9), validator(1, 9)}}, notifications)
+	ev = nextEvent()
+	assert.Equal(t, main[9].Hash(), *ev.Replaced)
+	assert.Equal(t, fork[9].Hash(), ev.Hash)
+
+	// A reorg below the transition notifies nothing until the chain reaches it again
+	notifications = nil
+	head(main, 8)
+	assert.Empty(t, notifications)
+	main = extendEpochTestChain(main, 14, 0)
+	head(main, 14)
+	assert.Equal(t, []testEpochNotification{
+		{9, validator(1, 9), validator(0, 9)},
+		{13, validator(0, 9), validator(0, 13)},
+	}, notifications)
+	ev = nextEvent()
+	assert.Equal(t, fork[9].Hash(), *ev.Replaced)
+	ev = nextEvent()
+	assert.Equal(t, uint64(13), ev.Number)
+	assert.Nil(t, ev.Replaced)
+	assert.Equal(t, uint64(4), ev.HeaderExtra.Epoch)
+}
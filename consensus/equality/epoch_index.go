@@ -0,0 +1,188 @@
+package equality
+
+import (
+	"encoding/binary"
+
+	"github.com/SecretBlockChain/go-secret/common"
+	"github.com/SecretBlockChain/go-secret/consensus"
+	"github.com/SecretBlockChain/go-secret/core/types"
+	"github.com/SecretBlockChain/go-secret/ethdb"
+	"github.com/SecretBlockChain/go-secret/log"
+	"github.com/SecretBlockChain/go-secret/rlp"
+)
+
+var (
+	epochIndexPrefix = []byte("equality-epoch-")     // key: equality-epoch-{epoch}:{epochIndex}
+	epochIndexHead   = []byte("equality-epoch-head") // key: equality-epoch-head:{epoch}
+)
+
+// epochIndex is the transition block of an epoch of the canonical chain and
+// the validators elected at it. The index follows the canonical head, the
+// entries of the epochs a reorg replaces are rewritten, the ones beyond the
+// epoch of the new head deleted.
+type epochIndex struct {
+	Number     uint64
+	Hash       common.Hash
+	Validators []common.Address
+}
+
+// epochIndexKey returns the database key of the index of epoch.
+func epochIndexKey(epoch uint64) []byte {
+	key := make([]byte, len(epochIndexPrefix)+8)
+	copy(key, epochIndexPrefix)
+	binary.BigEndian.PutUint64(key[len(epochIndexPrefix):], epoch)
+	return key
+}
+
+// readEpochIndex retrieves the index of epoch, nil if not indexed.
+func readEpochIndex(db ethdb.KeyValueReader, epoch uint64) *epochIndex {
+	data, err := db.Get(epochIndexKey(epoch))
+	if err != nil || len(data) == 0 {
+		return nil
+	}
+	index := new(epochIndex)
+	if err = rlp.DecodeBytes(data, index); err != nil {
+		log.Warn("[equality] Invalid epoch index", "epoch", epoch, "err", err)
+		return nil
+	}
+	return index
+}
+
+// readEpochIndexHead retrieves the last indexed epoch.
+func readEpochIndexHead(db ethdb.KeyValueReader) (uint64, bool) {
+	data, err := db.Get(epochIndexHead)
+	if err != nil || len(data) != 8 {
+		return 0, false
+	}
+	return binary.BigEndian.Uint64(data), true
+}
+
+// writeEpochIndex writes the index of the transition block header into batch,
+// along with the blocks of the past epochs it compacts out of the mint count
+// trie, and its kick outs if its epoch is one of the epochs kept up to the one
+// of the head.
+func (e *Equality) writeEpochIndex(batch ethdb.KeyValueWriter, chain consensus.ChainHeaderReader,
+	header *types.Header, headerExtra HeaderExtra, headEpoch, epochs uint64) error {
+
+	data, err := rlp.EncodeToBytes(epochIndex{
+		Number:     header.Number.Uint64(),
+		Hash:       header.Hash(),
+		Validators: headerExtra.CurrentEpochValidators,
+	})
+	if err != nil {
+		return err
+	}
+	if err = batch.Put(epochIndexKey(headerExtra.Epoch), data); err != nil {
+		return err
+	}
+	if err = e.writeEpochMints(batch, chain, header, headerExtra); err != nil {
+		return err
+	}
+	if epochs > 0 && headEpoch-headerExtra.Epoch < epochs {
+		return e.writeKickOutHistory(batch, chain, header, headerExtra, epochs)
+	}
+	return nil
+}
+
+// IndexEpochs indexes the epoch transitions of the canonical chain up to head,
+// walking them back from head to the last one already indexed, along with the
+// kick outs of the kept epochs. A missing index is rebuilt from the first
+// epoch on. It returns the number of epochs indexed.
+func (e *Equality) IndexEpochs(chain consensus.ChainHeaderReader, head *types.Header) (int, error) {
+	e.epochLock.Lock()
+	defer e.epochLock.Unlock()
+
+	var (
+		pending   []*types.Header
+		extras    []HeaderExtra
+		headEpoch uint64
+	)
+	for header := head; header != nil && header.Number.Uint64() > 0; {
+		extra, err := e.DecodeHeaderExtraCached(header)
+		if err != nil {
+			return 0, err
+		}
+		if extra.EpochBlock != header.Number.Uint64() {
+			if header = chain.GetHeaderByNumber(extra.EpochBlock); header == nil {
+				return 0, consensus.ErrUnknownAncestor
+			}
+			if extra, err = e.DecodeHeaderExtraCached(header); err != nil {
+				return 0, err
+			}
+		}
+		if extra.Epoch == 0 {
+			break
+		}
+		if headEpoch == 0 {
+			headEpoch = extra.Epoch
+		}
+
+		number := header.Number.Uint64()
+		if index := readEpochIndex(e.db, extra.Epoch); index != nil && index.Hash == header.Hash() {
+			break
+		}
+		pending = append(pending, header)
+		extras = append(extras, extra)
+		if number <= 1 || extra.Epoch <= 1 {
+			break
+		}
+		header = chain.GetHeader(header.ParentHash, number-1)
+	}
+
+	// The kick outs of the epochs past the kept ones are not recorded
+	epochs := e.kickOutHistoryEpochs()
+	batch := e.db.NewBatch()
+	for idx, header := range pending {
+		if err := e.writeEpochIndex(batch, chain, header, extras[idx], headEpoch, epochs); err != nil {
+			return 0, err
+		}
+	}
+
+	// Drop the epochs of a replaced chain beyond the new head
+	indexed, _ := readEpochIndexHead(e.db)
+	for epoch := headEpoch + 1; epoch <= indexed; epoch++ {
+		if err := batch.Delete(epochIndexKey(epoch)); err != nil {
+			return 0, err
+		}
+		if err := batch.Delete(kickOutHistoryKey(epoch)); err != nil {
+			return 0, err
+		}
+		if err := batch.Delete(epochMintsKey(epoch - 1)); err != nil {
+			return 0, err
+		}
+	}
+	if len(pending) == 0 && indexed == headEpoch {
+		return 0, nil
+	}
+	data := make([]byte, 8)
+	binary.BigEndian.PutUint64(data, headEpoch)
+	if err := batch.Put(epochIndexHead, data); err != nil {
+		return 0, err
+	}
+	if err := batch.Write(); err != nil {
+		return 0, err
+	}
+	if len(pending) > 0 {
+		log.Debug("[equality] Indexed epochs", "from", extras[len(extras)-1].Epoch, "to", extras[0].Epoch)
+	}
+	return len(pending), nil
+}
+
+// epochValidators returns the index of epoch on the canonical chain of head,
+// indexing the epochs up to head first if the index is missing or stale.
+func (e *Equality) epochValidators(chain consensus.ChainHeaderReader, head *types.Header, epoch uint64) (*epochIndex, error) {
+	canonical := func(index *epochIndex) bool {
+		header := chain.GetHeaderByNumber(index.Number)
+		return header != nil && header.Hash() == index.Hash
+	}
+	if index := readEpochIndex(e.db, epoch); index != nil && canonical(index) {
+		return index, nil
+	}
+	if _, err := e.IndexEpochs(chain, head); err != nil {
+		return nil, err
+	}
+	if index := readEpochIndex(e.db, epoch); index != nil && canonical(index) {
+		return index, nil
+	}
+	return nil, nil
+}
@@ -0,0 +1,81 @@
+package equality
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/SecretBlockChain/go-secret/common"
+	"github.com/SecretBlockChain/go-secret/core/rawdb"
+	"github.com/SecretBlockChain/go-secret/core/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEpochIndex(t *testing.T) {
+	validatorA := common.HexToAddress("0xa000000000000000000000000000000000000000")
+	validatorB := common.HexToAddress("0xb000000000000000000000000000000000000000")
+	validatorC := common.HexToAddress("0xc000000000000000000000000000000000000000")
+	validatorD := common.HexToAddress("0xd000000000000000000000000000000000000000")
+
+	epoch := func(epoch, epochBlock uint64, validators ...common.Address) HeaderExtra {
+		return HeaderExtra{Epoch: epoch, EpochBlock: epochBlock, CurrentEpochValidators: validators}
+	}
+	first, second, third := epoch(1, 1), epoch(2, 4), epoch(3, 7)
+	api := newTestAPI(rawdb.NewMemoryDatabase(), HeaderExtra{}, epoch(1, 1, validatorA, validatorB), first, first,
+		epoch(2, 4, validatorB, validatorC), second, second, epoch(3, 7, validatorC, validatorA), third, third)
+	chain := api.chain.(*testHeaderChain)
+	fork := func(number int, headerExtras ...HeaderExtra) []*types.Header {
+		headers := append([]*types.Header{}, chain.headers[:number]...)
+		for _, headerExtra := range headerExtras {
+			header := newTestHeader(uint64(len(headers)), headerExtra)
+			header.ParentHash = headers[len(headers)-1].Hash()
+			header.Time = 1
+			headers = append(headers, header)
+		}
+		return headers
+	}
+	expect := func(epoch uint64, number uint64, validators ...common.Address) {
+		result, err := api.GetValidatorsByEpoch(epoch)
+		assert.Nil(t, err, "epoch %d", epoch)
+		assert.Equal(t, number, uint64(result.BlockNumber), "epoch %d", epoch)
+		assert.Equal(t, chain.headers[number].Hash(), result.Hash, "epoch %d", epoch)
+		assert.Equal(t, validators, result.Validators, "epoch %d", epoch)
+	}
+
+	// The index is built from the first epoch on, then only extended
+	count, err := api.equality.IndexEpochs(chain, chain.CurrentHeader())
+	assert.Nil(t, err)
+	assert.Equal(t, 3, count)
+	count, err = api.equality.IndexEpochs(chain, chain.CurrentHeader())
+	assert.Nil(t, err)
+	assert.Zero(t, count)
+	expect(1, 1, validatorA, validatorB)
+	expect(2, 4, validatorB, validatorC)
+	expect(3, 7, validatorC, validatorA)
+	_, err = api.GetValidatorsByEpoch(4)
+	assert.True(t, errors.Is(err, errInvalidEpochRange))
+
+	// A reorg back into the second epoch drops the third one
+	chain.headers = fork(6, second, second)
+	count, err = api.equality.IndexEpochs(chain, chain.CurrentHeader())
+	assert.Nil(t, err)
+	assert.Zero(t, count)
+	assert.Nil(t, readEpochIndex(api.equality.db, 3))
+	indexed, ok := readEpochIndexHead(api.equality.db)
+	assert.True(t, ok)
+	assert.Equal(t, uint64(2), indexed)
+
+	// The third epoch starting at another block, the stale index is caught up
+	// by the query
+	chain.headers = fork(8, epoch(3, 8, validatorD), epoch(3, 8))
+	expect(3, 8, validatorD)
+	expect(2, 4, validatorB, validatorC)
+
+	// A missing index is rebuilt by replaying the transitions
+	rebuilt := New(api.equality.config, rawdb.NewMemoryDatabase())
+	index, err := rebuilt.epochValidators(chain, chain.CurrentHeader(), 1)
+	assert.Nil(t, err)
+	assert.Equal(t, []common.Address{validatorA, validatorB}, index.Validators)
+	for epoch := uint64(1); epoch <= 3; epoch++ {
+		assert.NotNil(t, readEpochIndex(rebuilt.db, epoch), "epoch %d", epoch)
+	}
+}
@@ -1,15 +1,17 @@
 package equality
 
 import (
-	"encoding/binary"
+	"bytes"
 	"errors"
 	"math/big"
+	"sort"
 	"strings"
 	"sync"
 	"time"
 
 	"github.com/SecretBlockChain/go-secret/accounts"
 	"github.com/SecretBlockChain/go-secret/common"
+	"github.com/SecretBlockChain/go-secret/common/hexutil"
 	"github.com/SecretBlockChain/go-secret/consensus"
 	"github.com/SecretBlockChain/go-secret/core/state"
 	"github.com/SecretBlockChain/go-secret/core/types"
@@ -18,18 +20,25 @@ import (
 	"github.com/SecretBlockChain/go-secret/log"
 	"github.com/SecretBlockChain/go-secret/params"
 	"github.com/SecretBlockChain/go-secret/rpc"
-	"github.com/SecretBlockChain/go-secret/trie"
 	lru "github.com/hashicorp/golang-lru"
 )
 
+// Sizes of the fixed parts of header.Extra around the encoded HeaderExtra.
+const (
+	ExtraVanity = 32                     // Fixed number of extra-data prefix bytes reserved for signer vanity
+	ExtraSeal   = crypto.SignatureLength // Fixed number of extra-data suffix bytes reserved for signer seal
+)
+
 // Equality proof-of-equality protocol constants.
 var (
-	extraVanity        = 32                       // Fixed number of extra-data prefix bytes reserved for signer vanity
-	extraSeal          = crypto.SignatureLength   // Fixed number of extra-data suffix bytes reserved for signer seal
 	defaultDifficulty  = int64(1)                 // Default difficulty
 	inmemorySnapshots  = 12                       // Number of recent vote snapshots to keep in memory
 	inMemorySignatures = 4096                     // Number of recent block signatures to keep in memory
+	inMemoryExtras     = 512                      // Number of recent decoded header extras to keep in memory
+	inMemoryMissed     = 256                      // Number of recent blocks sealed out of turn to keep in memory
 	uncleHash          = types.CalcUncleHash(nil) // Always Keccak256(RLP([])) as uncles are meaningless outside of PoW.
+
+	defaultFutureDrift = 15 * time.Second // Default time a block may be ahead of the local clock
 )
 
 // Various error messages to mark blocks invalid. These should be private to
@@ -40,6 +49,10 @@ var (
 	// errUnauthorized is returned if a header is signed by a non-authorized entity.
 	errUnauthorized = errors.New("unauthorized")
 
+	// errUnauthorizedValidator is returned if a header is signed by an entity not
+	// among the validators of the epoch of the block.
+	errUnauthorizedValidator = errors.New("unauthorized validator")
+
 	// errUnknownBlock is returned when the list of signers is requested for a block
 	// that is not part of the local blockchain.
 	errUnknownBlock = errors.New("unknown block")
@@ -67,39 +80,294 @@ var (
 
 	// ErrChainConfigMissing is returned if the chain config is missing
 	ErrChainConfigMissing = errors.New("chain config missing")
+
+	// ErrEmptyExtra is returned if the payload between the vanity and the seal
+	// of a header is empty. The engine writes a HeaderExtra into every block it
+	// seals, only the genesis block of the networks created before it carried
+	// one has none, so empty payloads fail the verification of any other block.
+	ErrEmptyExtra = errors.New("empty header extra")
+
+	// errUnknownHeaderExtraVersion is returned if the encoded HeaderExtra carries
+	// a format version this node is unable to decode.
+	errUnknownHeaderExtraVersion = errors.New("unknown header extra version")
+
+	// errHeaderExtraTooLarge is returned if the encoded or the decompressed
+	// HeaderExtra exceeds the configured size limit.
+	errHeaderExtraTooLarge = errors.New("header extra too large")
+
+	// errInvalidHeaderExtraCompression is returned if the HeaderExtra payload is not
+	// a valid compressed stream.
+	errInvalidHeaderExtraCompression = errors.New("invalid header extra compression")
+
+	// errUnknownCompression is returned if a HeaderExtra compression codec or
+	// level is not supported.
+	errUnknownCompression = errors.New("unknown header extra compression")
+
+	// errInvalidHeaderExtraRLP is returned if the decompressed HeaderExtra payload
+	// is not a valid rlp encoding of HeaderExtra.
+	errInvalidHeaderExtraRLP = errors.New("invalid header extra rlp")
+
+	// errMissingState is returned if a trie of the snapshot referenced by a
+	// block is not available, usually because the state has been pruned.
+	errMissingState = errors.New("missing consensus state")
+
+	// errInvalidEpochBlock is returned if the epoch block of a HeaderExtra is
+	// beyond the number of its block.
+	errInvalidEpochBlock = errors.New("invalid epoch block")
+
+	// errDuplicateAddress is returned if an address list of a HeaderExtra
+	// contains the same address more than once.
+	errDuplicateAddress = errors.New("duplicate address in header extra")
+
+	// errZeroAddress is returned if an address list of a HeaderExtra contains
+	// the zero address.
+	errZeroAddress = errors.New("zero address in header extra")
+
+	// errUnexpectedValidators is returned if validators are carried by a block
+	// other than the first block of an epoch.
+	errUnexpectedValidators = errors.New("validators outside epoch block")
+
+	// errTooFewValidators is returned if an epoch transition kicks out candidates
+	// below the min validators count, or elects fewer validators than it
+	// without carrying the previous ones over.
+	errTooFewValidators = errors.New("too few validators")
+
+	// errTooManyValidators is returned if more validators are elected than the
+	// chain config allows.
+	errTooManyValidators = errors.New("too many validators")
+
+	// errPastActivation is returned if a chain config of a header extra takes
+	// effect at a block not following the header.
+	errPastActivation = errors.New("chain config activation in the past")
+
+	// errUnauthorizedProposal is returned if a config change is proposed or
+	// approved by an address not being a validator.
+	errUnauthorizedProposal = errors.New("config proposal by non validator")
+
+	// errUnknownProposal is returned if a config proposal is approved which is
+	// not pending or expired.
+	errUnknownProposal = errors.New("unknown config proposal")
+
+	// errDuplicateProposal is returned if a config is proposed while its
+	// previous proposal is pending.
+	errDuplicateProposal = errors.New("duplicate config proposal")
+
+	// errDuplicateApproval is returned if a validator approves a config
+	// proposal it already approved.
+	errDuplicateApproval = errors.New("duplicate config approval")
+
+	// errUnapprovedConfig is returned if a header extra carries a chain config
+	// not approved by a quorum of the validators.
+	errUnapprovedConfig = errors.New("unapproved chain config")
+
+	// errInvalidChainConfig is returned if a chain config of a header extra or a
+	// config proposal fails validation.
+	errInvalidChainConfig = errors.New("invalid chain config")
+
+	// errInvalidRoot is returned if the trie roots of a block's header extra
+	// differ from the ones computed by applying the block locally.
+	errInvalidRoot = errors.New("invalid trie root")
+
+	// errInvalidBlockRange is returned if a range of blocks is requested whose
+	// first block follows the last one.
+	errInvalidBlockRange = errors.New("invalid block range")
+
+	// errBlockRangeTooLarge is returned if more blocks are requested at once
+	// than an API call serves.
+	errBlockRangeTooLarge = errors.New("block range too large")
+
+	// errInvalidEpochRange is returned if a range of epochs is requested whose
+	// first epoch follows the last one or that is not reached yet.
+	errInvalidEpochRange = errors.New("invalid epoch range")
+
+	// errEpochRangeTooLarge is returned if more epochs are requested at once
+	// than an API call serves.
+	errEpochRangeTooLarge = errors.New("epoch range too large")
+
+	// errRecentlySigned is returned if a header is signed by a validator that
+	// sealed one of the recent blocks.
+	errRecentlySigned = errors.New("recently signed")
+
+	// errWrongDifficulty is returned if the difficulty of a block does not
+	// match the turn of its signer.
+	errWrongDifficulty = errors.New("wrong difficulty")
+
+	// errInvalidTopUp is returned if a header extra tops up the deposit of an
+	// address not being a candidate, an exiting candidate or by no amount.
+	errInvalidTopUp = errors.New("invalid deposit top up")
+
+	// errInvalidMetadata is returned if a header extra sets the metadata of an
+	// address not being a candidate, before the metadata block, or empty or
+	// oversized metadata.
+	errInvalidMetadata = errors.New("invalid candidate metadata")
+
+	// errInvalidEviction is returned if a header extra evicts an address not
+	// being a candidate.
+	errInvalidEviction = errors.New("invalid candidate eviction")
+
+	// errEngineClosed is returned if a block is sealed after the engine is closed.
+	errEngineClosed = errors.New("equality engine closed")
+
+	// errTooManyCandidates is returned if a header extra registers more
+	// candidates than a block admits.
+	errTooManyCandidates = errors.New("too many candidates")
+
+	// errInvalidRewardRecipient is returned if a header extra sets the reward
+	// recipient of an address not being a candidate, before the reward
+	// recipient block, or to the zero address.
+	errInvalidRewardRecipient = errors.New("invalid reward recipient")
+
+	// errInvalidSealerKey is returned if a header extra sets the sealer key of
+	// an address not a candidate, the zero address, or before the sealer key
+	// block.
+	errInvalidSealerKey = errors.New("invalid sealer key")
+
+	// errIneligibleCandidate is returned if a header extra registers the zero
+	// address or, from the candidate guard block on, a contract as a candidate.
+	errIneligibleCandidate = errors.New("ineligible candidate")
+
+	// errInvalidCheckpoint is returned if a header extra carries a checkpoint
+	// outside an epoch transition, before the checkpoint block, of a block
+	// other than the parent or not attested by two thirds of the validators.
+	errInvalidCheckpoint = errors.New("invalid checkpoint")
 )
 
 type SignerFn func(accounts.Account, string, []byte) ([]byte, error)
 
 // Equality is the proof-of-equality consensus engine.
 type Equality struct {
-	db         ethdb.Database         // Database to store and retrieve snapshot checkpoints
-	signatures *lru.ARCCache          // Signatures of recent blocks to speed up mining
-	config     *params.EqualityConfig // Consensus engine configuration parameters
-	signer     common.Address         // Ethereum address of the signing key
-	signFn     SignerFn               // Signer function to authorize hashes with
-	lock       sync.RWMutex           // Protects the signer fields
+	db            ethdb.Database         // Database to store and retrieve snapshot checkpoints
+	signatures    *lru.ARCCache          // Signatures of recent blocks to speed up mining
+	headerExtras  *lru.Cache             // Decoded header extras of recent blocks to speed up verification
+	missedTurns   *lru.ARCCache          // Recent blocks sealed out of turn already notified
+	snapshots     *snapshotLayers        // Snapshot tries of recent blocks kept in memory
+	epochs        *epochNotifier         // Epoch transitions notified to listeners
+	finality      *finalityTracker       // Finalized block of the latest chain head
+	mismatches    *mismatchReporter      // Consensus mismatches of the blocks failing to import
+	faults        *faultRecorder         // Fault records of the blocks failing verification
+	rankings      *electionRankings      // Election rankings of the recent cutoff blocks
+	skew          *clockSkew             // Skew of the local clock against the imported blocks
+	config        *params.EqualityConfig // Consensus engine configuration parameters
+	signer        common.Address         // Ethereum address of the signing key
+	signFn        SignerFn               // Signer function to authorize hashes with
+	pendingFn     func() *types.Header   // Retrieves the header of the block being mined
+	vanity        []byte                 // Vanity of the prepared headers, the one of the header if nil
+	indexDepth    uint64                 // Number of blocks behind the head the header extras are indexed at
+	kickOutEpochs uint64                 // Number of epochs the kick out history is kept for
+	futureDrift   time.Duration          // Time the imported blocks may be ahead of the local clock
+	extrasCache   int                    // Number of decoded header extras cached
+	gasFloor      *big.Int               // Gas price the consensus transactions are reserved room in mined blocks from
+	clock         Clock                  // Source of the local time
+	trusted       *TrustedCheckpoint     // Checkpoint the headers up to are trusted without verification, nil if none
+	sealers       sync.WaitGroup         // Sealing procedures in progress
+	epochLock     sync.Mutex             // Serializes the updates of the epoch index
+	optionsLock   sync.Mutex             // Serializes the changes of the local options
+	quit          chan struct{}          // Closed when the engine is closed
+	lock          sync.RWMutex           // Protects the signer, pending, vanity, index, history, drift, cache, floor, clock, trusted and quit fields
 }
 
 // New creates a Equality proof-of-equality consensus engine with the initial
 // signers set to the ones provided by the user.
 func New(config *params.EqualityConfig, db ethdb.Database) *Equality {
 	signatures, _ := lru.NewARC(inMemorySignatures)
-	return &Equality{db: db, signatures: signatures, config: config}
+	headerExtras, _ := lru.New(inMemoryExtras)
+	missedTurns, _ := lru.NewARC(inMemoryMissed)
+	quit := make(chan struct{})
+	return &Equality{
+		db:            db,
+		signatures:    signatures,
+		headerExtras:  headerExtras,
+		missedTurns:   missedTurns,
+		snapshots:     newSnapshotLayers(db, snapshotFlushInterval),
+		epochs:        new(epochNotifier),
+		finality:      new(finalityTracker),
+		mismatches:    newMismatchReporter(log.Root()),
+		faults:        newFaultRecorder(db, quit),
+		rankings:      newElectionRankings(),
+		skew:          new(clockSkew),
+		config:        config,
+		indexDepth:    defaultHeaderExtraIndexDepth,
+		kickOutEpochs: defaultKickOutHistoryEpochs,
+		futureDrift:   defaultFutureDrift,
+		extrasCache:   inMemoryExtras,
+		gasFloor:      new(big.Int),
+		clock:         systemClock{},
+		quit:          quit,
+	}
+}
+
+// DecodeHeaderExtraCached is DecodeHeaderExtra backed by a cache of recently
+// decoded headers. Headers failing to decode are never cached. The returned
+// HeaderExtra is shared with the cache and must not be modified.
+func (e *Equality) DecodeHeaderExtraCached(header *types.Header) (HeaderExtra, error) {
+	hash := header.Hash()
+	if headerExtra, ok := e.headerExtras.Get(hash); ok {
+		return headerExtra.(HeaderExtra), nil
+	}
+
+	headerExtra, err := DecodeHeaderExtra(header)
+	if err != nil {
+		return HeaderExtra{}, err
+	}
+	e.headerExtras.Add(hash, headerExtra)
+	return headerExtra, nil
 }
 
-// Close terminates any background threads maintained by the consensus engine.
+// Close terminates any background threads maintained by the consensus engine:
+// the sealing procedures in progress are aborted and the snapshot layers kept
+// in memory persisted, so a new engine opened on the database resumes from
+// them. Blocks sealed afterwards fail with errEngineClosed.
 func (e *Equality) Close() error {
-	return nil
+	e.lock.Lock()
+	select {
+	case <-e.quit:
+		e.lock.Unlock()
+		return nil
+	default:
+		close(e.quit)
+	}
+	e.lock.Unlock()
+
+	e.sealers.Wait()
+	return e.snapshots.flush()
+}
+
+// closed returns whether the engine is closed.
+func (e *Equality) closed() bool {
+	select {
+	case <-e.quit:
+		return true
+	default:
+		return false
+	}
 }
 
 // APIs returns the RPC APIs this consensus engine provides.
 func (e *Equality) APIs(chain consensus.ChainHeaderReader) []rpc.API {
+	api := &API{chain: chain, equality: e}
 	return []rpc.API{{
 		Namespace: "eq",
 		Version:   "1.0",
-		Service:   &API{chain: chain, equality: e},
+		Service:   api,
 		Public:    true,
+	}, {
+		Namespace: "equality",
+		Version:   "1.0",
+		Service:   api,
+		Public:    true,
+	}, {
+		Namespace: "eth",
+		Version:   "1.0",
+		Service:   &EpochEventAPI{equality: e},
+		Public:    true,
+	}, {
+		Namespace: "debug",
+		Version:   "1.0",
+		Service:   &DebugAPI{chain: chain, equality: e},
+	}, {
+		Namespace: "equalityadmin",
+		Version:   "1.0",
+		Service:   &AdminAPI{chain: chain, equality: e},
 	}}
 }
 
@@ -113,8 +381,86 @@ func (e *Equality) Authorize(signer common.Address, signFn SignerFn) {
 	e.signFn = signFn
 }
 
-// InTurn returns if a signer at a given block height is in-turn or not.
-func (e *Equality) InTurn(lastBlockHeader *types.Header, now uint64) bool {
+// SetVanity sets the text carried by the vanity of the prepared headers, padded
+// with zeros or truncated to ExtraVanity bytes. A nil vanity keeps the one the
+// header is prepared with, e.g. the miner extra data.
+func (e *Equality) SetVanity(vanity []byte) {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	if vanity == nil {
+		e.vanity = nil
+		return
+	}
+	e.vanity = make([]byte, ExtraVanity)
+	copy(e.vanity, vanity)
+}
+
+// Vanity returns the vanity set for the prepared headers, nil if none.
+func (e *Equality) Vanity() []byte {
+	e.lock.RLock()
+	defer e.lock.RUnlock()
+	return common.CopyBytes(e.vanity)
+}
+
+// SetPendingHeader injects the retriever of the header of the block being
+// mined, queries for the pending block fall back to the latest one if it
+// returns nil.
+func (e *Equality) SetPendingHeader(pendingFn func() *types.Header) {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	e.pendingFn = pendingFn
+}
+
+// SetAllowedFutureDrift sets the time the timestamp of an imported block may be
+// ahead of the local clock, later blocks fail with consensus.ErrFutureBlock.
+func (e *Equality) SetAllowedFutureDrift(drift time.Duration) {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	e.futureDrift = drift
+}
+
+// latestTime returns the latest timestamp of a block accepted for import now.
+func (e *Equality) latestTime() uint64 {
+	e.lock.RLock()
+	drift := e.futureDrift
+	e.lock.RUnlock()
+
+	return uint64(e.now().Add(drift).Unix())
+}
+
+// earliestTime returns the earliest timestamp of the block after parent, a
+// period of config after it.
+func earliestTime(config params.EqualityConfig, parent *types.Header) uint64 {
+	return parent.Time + config.Period
+}
+
+// pendingHeader returns the header of the block being mined, nil if no block
+// is being mined or its header extra can't be decoded.
+func (e *Equality) pendingHeader() *types.Header {
+	e.lock.RLock()
+	pendingFn := e.pendingFn
+	e.lock.RUnlock()
+
+	if pendingFn == nil {
+		return nil
+	}
+	header := pendingFn()
+	if header == nil || header.Number == nil {
+		return nil
+	}
+	if _, err := e.DecodeHeaderExtraCached(header); err != nil {
+		return nil
+	}
+	return header
+}
+
+// InTurn returns if a signer at a given block height is in-turn or not. From
+// the turn block on, it returns whether the signer may seal the block, in turn
+// or out of turn.
+func (e *Equality) InTurn(chain consensus.ChainHeaderReader, lastBlockHeader *types.Header, now uint64) bool {
 	config, err := e.chainConfig(lastBlockHeader)
 	if err != nil {
 		return false
@@ -122,62 +468,96 @@ func (e *Equality) InTurn(lastBlockHeader *types.Header, now uint64) bool {
 	if now <= config.GenesisTimestamp-config.Period {
 		return false
 	}
+	if config.IsTurn(new(big.Int).Add(lastBlockHeader.Number, common.Big1)) {
+		e.lock.RLock()
+		signer := e.signer
+		e.lock.RUnlock()
+		ok, _ := e.maySeal(chain, config, lastBlockHeader, e.localValidator(config, lastBlockHeader, signer))
+		return ok
+	}
 
 	// Estimate the next block time
-	nexBlockTime := lastBlockHeader.Time + config.Period
-	if int64(nexBlockTime) < time.Now().Unix() {
-		nexBlockTime = uint64(time.Now().Unix())
+	nexBlockTime := earliestTime(config, lastBlockHeader)
+	if now := e.now().Unix(); int64(nexBlockTime) < now {
+		nexBlockTime = uint64(now)
 	}
 
 	e.lock.Lock()
 	signer := e.signer
 	e.lock.Unlock()
-	return e.inTurn(config, lastBlockHeader, nexBlockTime, signer)
+	signer = e.localValidator(config, lastBlockHeader, signer)
+	if !e.inTurn(config, lastBlockHeader, nexBlockTime, signer) {
+		return false
+	}
+	return e.checkSlotRecent(chain, config, lastBlockHeader, nil, signer) == nil
 }
 
 func (e *Equality) inTurn(config params.EqualityConfig,
 	lastBlockHeader *types.Header, nexBlockTime uint64, signer common.Address) bool {
 
-	validators := config.Validators
-	if lastBlockHeader != nil && lastBlockHeader.Number.Int64() > 0 {
-		headerExtra, err := DecodeHeaderExtra(lastBlockHeader)
-		if err != nil {
-			return false
-		}
-
-		snap, err := loadSnapshot(e.db, headerExtra.Root)
-		if err != nil {
-			return false
-		}
-
-		validators, err = snap.GetValidators()
-		if err != nil {
-			return false
-		}
+	validators, err := e.sealingValidators(config, lastBlockHeader)
+	if err != nil {
+		return false
 	}
-
 	count := len(validators)
 	if count == 0 {
 		return false
 	}
+	if config.IsDevMode() {
+		// The single validator of a dev chain seals on demand, without slots
+		return validators[0] == signer
+	}
 
 	idx := (nexBlockTime - config.GenesisTimestamp) / config.Period % uint64(len(validators))
 	return validators[idx] == signer
 }
 
+// sealingValidators returns the validators of the block after lastBlockHeader
+// in sealing order, the genesis validators for the first block.
+func (e *Equality) sealingValidators(config params.EqualityConfig, lastBlockHeader *types.Header) ([]common.Address, error) {
+	if lastBlockHeader == nil || lastBlockHeader.Number.Int64() == 0 {
+		return config.Validators, nil
+	}
+	headerExtra, err := e.DecodeHeaderExtraCached(lastBlockHeader)
+	if err != nil {
+		return nil, err
+	}
+	validators, err := e.snapshots.open(headerExtra.Root).GetValidators()
+	if err != nil {
+		return nil, err
+	}
+
+	// Shuffle the sealing order of the epoch once activated
+	number := new(big.Int).Add(lastBlockHeader.Number, common.Big1)
+	if config.IsShuffle(number) {
+		validators = shuffleValidators(validators, epochSeed(headerExtra))
+	}
+	return validators, nil
+}
+
 // Gets the chain config for the specified block number.
 func (e *Equality) chainConfig(header *types.Header) (params.EqualityConfig, error) {
 	if header == nil || header.Number.Int64() == 0 {
 		return *e.config, nil
 	}
 
-	headerExtra, err := DecodeHeaderExtra(header)
+	headerExtra, err := e.DecodeHeaderExtraCached(header)
 	if err != nil {
 		return params.EqualityConfig{}, err
 	}
 	return e.chainConfigByHash(headerExtra.Root.ConfigHash)
 }
 
+// nextEpoch returns the epoch and the first block of the epoch of the block of
+// number after the one of parentExtra, a new epoch starts once the running one
+// reaches its length.
+func nextEpoch(parentExtra HeaderExtra, number, length uint64) (uint64, uint64) {
+	if number-parentExtra.EpochBlock == length {
+		return parentExtra.Epoch + 1, number
+	}
+	return parentExtra.Epoch, parentExtra.EpochBlock
+}
+
 // Gets the chain config by tire node hash value.
 func (e *Equality) chainConfigByHash(configHash common.Hash) (params.EqualityConfig, error) {
 	zero := common.Hash{}
@@ -185,11 +565,7 @@ func (e *Equality) chainConfigByHash(configHash common.Hash) (params.EqualityCon
 		return *e.config, nil
 	}
 
-	snap := Snapshot{
-		db:   trie.NewDatabase(e.db),
-		root: Root{ConfigHash: configHash},
-	}
-	config, err := snap.GetChainConfig()
+	config, err := e.snapshots.open(Root{ConfigHash: configHash}).GetChainConfig()
 	if err != nil {
 		return params.EqualityConfig{}, ErrChainConfigMissing
 	}
@@ -205,8 +581,17 @@ func validatorsToString(validators []common.Address) string {
 }
 
 // Elect validators in first block for epoch.
-func (e *Equality) tryElect(config params.EqualityConfig, header *types.Header,
-	snap *Snapshot, headerExtra *HeaderExtra) error {
+func (e *Equality) tryElect(config params.EqualityConfig, state *state.StateDB, header *types.Header,
+	snap *Snapshot, headerExtra *HeaderExtra, ranking *electionRanking) error {
+
+	return e.elect(config, state, header, snap, headerExtra, ranking, nil)
+}
+
+// elect elects the validators in the first block of an epoch, recording its
+// decisions into trail. From the election cutoff block on, the validators are
+// elected out of the ranking of the cutoff block.
+func (e *Equality) elect(config params.EqualityConfig, state *state.StateDB, header *types.Header,
+	snap *Snapshot, headerExtra *HeaderExtra, ranking *electionRanking, trail *electionTrail) error {
 
 	// Is come to next epoch?
 	number := header.Number.Uint64()
@@ -214,8 +599,16 @@ func (e *Equality) tryElect(config params.EqualityConfig, header *types.Header,
 		return nil
 	}
 
+	// Exiting candidates leave with their deposits before the election
+	exited, err := e.removeExitingCandidates(config, state, header, snap)
+	if err != nil {
+		return err
+	}
+	trail.begin(number, headerExtra.Epoch, exited, snap)
+
 	// Find not active validators
 	needKickOutValidators := make(SortableAddresses, 0)
+	scheduledBlocks := make(map[common.Address]uint64)
 	if number <= 1 {
 		for _, validator := range config.Validators {
 			if _, err := snap.BecomeCandidate(validator, 1, big.NewInt(0)); err != nil {
@@ -224,96 +617,473 @@ func (e *Equality) tryElect(config params.EqualityConfig, header *types.Header,
 			headerExtra.CurrentBlockCandidates = append(headerExtra.CurrentBlockCandidates, validator)
 		}
 
-		headerExtra.CurrentBlockCandidates = addressesDistinct(headerExtra.CurrentBlockCandidates)
+		headerExtra.CurrentBlockCandidates = NewAddressSet(headerExtra.CurrentBlockCandidates...).Slice()
+	} else if config.KickOutRatio > 0 {
+		validators, err := e.inactiveValidators(config, snap, number, headerExtra.Epoch-1, scheduledBlocks, trail)
+		if err != nil {
+			return err
+		}
+		needKickOutValidators = append(needKickOutValidators, validators...)
 	} else {
-		minMint := big.NewInt(int64(config.Epoch / config.MaxValidatorsCount / 2))
+		scheduled := config.Epoch / config.MaxValidatorsCount
+		minMint := big.NewInt(int64(scheduled / 2))
 		validators, err := snap.CountMinted(headerExtra.Epoch - 1)
 		if err != nil {
 			return err
 		}
 		for _, validator := range validators {
-			if validator.Weight.Cmp(minMint) == -1 {
+			inactive := validator.Weight.Cmp(minMint) == -1
+			if inactive {
 				needKickOutValidators = append(needKickOutValidators, validator)
 			}
+			scheduledBlocks[validator.Address] = scheduled
+			trail.mintCount(electionMintCount{Address: validator.Address, Minted: hexutil.Uint64(validator.Weight.Uint64()),
+				Scheduled: hexutil.Uint64(scheduled), MinMinted: hexutil.Uint64(minMint.Uint64()), Inactive: inactive})
 		}
 	}
 
-	// Kick out not active validators
-	if len(needKickOutValidators) > 0 {
-		safeSize := int(config.MaxValidatorsCount*2/3 + 1)
+	// Kick out not active validators, the single validator of a dev chain
+	// sealing on demand is kept
+	if len(needKickOutValidators) > 0 && config.IsDevMode() && config.MaxValidatorsCount <= 1 {
+		for _, validator := range needKickOutValidators {
+			trail.kickOut(electionKickOut{Address: validator.Address, Reason: kickOutSingleValidator})
+		}
+	} else if len(needKickOutValidators) > 0 {
+		// The candidates are kept above the safe size, and the min validators
+		// count if higher. The least active validators are kicked out first
+		// under a min validators count, sparing the most active ones
+		safeSize, floorReason := int(config.MaxValidatorsCount*2/3+1), kickOutCandidateFloor
+		if config.MinValidatorsCount > 0 {
+			sortBySeverity(needKickOutValidators, scheduledBlocks)
+			if minimum := int(config.MinValidatorsCount); minimum > safeSize {
+				safeSize, floorReason = minimum, kickOutMinValidators
+			}
+		}
 		candidateCount, _ := snap.EnoughCandidates(safeSize + len(needKickOutValidators))
+		exitedSet := NewAddressSet(exited...)
 		for i, validator := range needKickOutValidators {
+			decision := electionKickOut{Address: validator.Address, CandidateCount: candidateCount, SafeSize: safeSize}
+			if exitedSet.Contains(validator.Address) {
+				decision.Reason = kickOutExited
+				trail.kickOut(decision)
+				continue
+			}
+
 			// Ensure candidate count greater than or equal to safeSize
 			if candidateCount <= safeSize {
 				log.Info("[equality] No more candidate can be kick out",
 					"prevEpochID", headerExtra.Epoch-1,
 					"candidateCount", candidateCount, "needKickOutCount", len(needKickOutValidators)-i)
+				for _, validator := range needKickOutValidators[i:] {
+					if !exitedSet.Contains(validator.Address) {
+						trail.kickOut(electionKickOut{Address: validator.Address, Reason: floorReason,
+							CandidateCount: candidateCount, SafeSize: safeSize})
+					}
+				}
 				break
 			}
 
-			if _, _, err := snap.CancelCandidate(validator.Address); err != nil {
+			_, security, err := snap.CancelCandidate(validator.Address)
+			if err != nil {
 				return err
 			}
+			e.slashCandidate(config, state, snap.journal, validator.Address, security)
+			if config.KickOutLockOut > 0 {
+				if err := snap.SetKickOutBlock(validator.Address, number); err != nil {
+					return err
+				}
+			}
 
 			// If kick out success, candidateCount minus 1
 			candidateCount--
+			decision.Kicked = true
+			trail.kickOut(decision)
 			headerExtra.CurrentBlockKickOutCandidates = append(headerExtra.CurrentBlockKickOutCandidates, validator.Address)
 			log.Info("[equality] Kick out candidate",
 				"prevEpochID", headerExtra.Epoch-1, "candidate", validator, "mintCnt", validator.Weight.String())
 		}
 	}
 
-	// Shuffle candidates
-	seed := int64(binary.LittleEndian.Uint32(crypto.Keccak512(header.ParentHash.Bytes())))
-	candidates, err := snap.RandCandidates(seed, int(config.MaxValidatorsCount))
+	// The mint counts of the past epochs were last read by the kick outs, from
+	// the mint compaction block on they leave the snapshot for the epoch index
+	if config.IsMintCompaction(header.Number) {
+		if err := snap.CompactMintCounts(headerExtra.Epoch); err != nil {
+			return err
+		}
+	}
+
+	// Elect the candidates with the most votes, or through the election
+	// strategy of the chain config. From the candidate guard block on the
+	// candidates registered before that may not stand are never elected, nor
+	// the candidates registered less than the maturity blocks ago. Candidates
+	// barred since their registration are passed over, not kicked out
+	var eligible func(common.Address) bool
+	guard, restricted := config.IsCandidateGuard(header.Number), candidateAccessRestricted(config)
+	if guard || restricted || config.MaturityBlocks > 0 {
+		eligible = func(candidate common.Address) bool {
+			if guard && candidateEligible(config, state, header.Number, candidate) != nil {
+				return false
+			}
+			if restricted && candidateBarred(config, candidate) {
+				return false
+			}
+			return config.MaturityBlocks == 0 || candidateMatured(config, snap, number, candidate)
+		}
+	}
+	// The validator count formula sizes the election by the candidates left
+	n := int(config.MaxValidatorsCount)
+	if number > 1 && config.ValidatorCountFormula != "" {
+		count, err := snap.candidateCount()
+		if err != nil {
+			return err
+		}
+		n = validatorCount(config, count)
+		trail.validatorCount(config.ValidatorCountFormula, count, n)
+	}
+	var candidates []common.Address
+	if number > 1 && config.IsElectionCutoff(header.Number) {
+		if ranking == nil {
+			return errMissingElectionRanking
+		}
+		if config.IsElectionSeed(header.Number) && !config.DelegatedVoting {
+			trail.seedHash(ranking.seed)
+		} else {
+			trail.seed(config.DelegatedVoting, electionSeed(ranking.seed))
+		}
+		candidates, err = ranking.elect(snap, n, eligible)
+	} else if config.DelegatedVoting {
+		trail.seed(true, 0)
+		candidates, err = snap.topEligibleCandidates(n, eligible)
+	} else {
+		var strategy ElectionStrategy
+		if strategy, err = electionStrategyAt(config, header.Number); err != nil {
+			return err
+		}
+		var infos []CandidateInfo
+		if infos, err = snap.CandidateInfos(); err == nil {
+			if eligible != nil {
+				kept := infos[:0]
+				for _, info := range infos {
+					if eligible(info.Address) {
+						kept = append(kept, info)
+					}
+				}
+				infos = kept
+			}
+			seed := transitionSeed(config, header.Number, header.ParentHash, headerExtra.Epoch)
+			if config.IsElectionSeed(header.Number) {
+				trail.seedHash(seed)
+			} else {
+				trail.seed(false, electionSeed(seed))
+			}
+			candidates = strategy.Elect(infos, seed, n)
+		}
+	}
 	if err != nil {
 		return err
 	}
 
+	// Too few candidates to reach the min validators count, the validators of
+	// the previous epoch carry on
+	if number > 1 && uint64(len(candidates)) < config.MinValidatorsCount {
+		if candidates, err = carriedValidators(snap, headerExtra.CurrentBlockKickOutCandidates, n); err != nil {
+			return err
+		}
+		trail.carryOver()
+		log.Warn("[equality] Too few candidates, validators carried over", "number", number, "epoch", headerExtra.Epoch,
+			"minValidators", config.MinValidatorsCount, "validators", len(candidates))
+	}
+
 	headerExtra.CurrentEpochValidators = append(headerExtra.CurrentEpochValidators, candidates...)
+	trail.elected(headerExtra.CurrentEpochValidators)
 	log.Debug("[equality] Come to next epoch",
 		"number", number, "epoch", headerExtra.Epoch, "validators", validatorsToString(headerExtra.CurrentEpochValidators))
 	return snap.SetValidators(headerExtra.CurrentEpochValidators)
 }
 
-// Credits the coinbase of the given block with the mining reward.
-func (e *Equality) accumulateRewards(config params.EqualityConfig, state *state.StateDB, header *types.Header) {
+// inactiveValidators returns the validators of epoch that sealed less than
+// config.KickOutRatio percent of the blocks they were scheduled for. A
+// validator is only scheduled from the later of the epoch start and its
+// candidate registration, so joining the set late is not held against it.
+func (e *Equality) inactiveValidators(config params.EqualityConfig, snap *Snapshot, number, epoch uint64,
+	scheduledBlocks map[common.Address]uint64, trail *electionTrail) (SortableAddresses, error) {
+
+	validators, err := snap.CountMinted(epoch)
+	if err != nil || len(validators) == 0 {
+		return nil, err
+	}
+
+	var epochStart uint64 = 1
+	if number > config.Epoch {
+		epochStart = number - config.Epoch
+	}
+
+	inactive := make(SortableAddresses, 0)
+	for _, validator := range validators {
+		joined := epochStart
+		candidate, err := snap.GetCandidate(validator.Address)
+		if err != nil {
+			return nil, err
+		}
+		if candidate != nil && candidate.BlockNumber > joined && candidate.BlockNumber < number {
+			joined = candidate.BlockNumber
+		}
+
+		scheduled := (number - joined) / uint64(len(validators))
+		minted := validator.Weight.Uint64()
+		isInactive := minted*100 < scheduled*config.KickOutRatio
+		scheduledBlocks[validator.Address] = scheduled
+		if isInactive {
+			inactive = append(inactive, validator)
+		}
+		trail.mintCount(electionMintCount{Address: validator.Address, Minted: hexutil.Uint64(minted), Scheduled: hexutil.Uint64(scheduled),
+			MinMinted: hexutil.Uint64((scheduled*config.KickOutRatio + 99) / 100), Inactive: isInactive})
+	}
+	return inactive, nil
+}
+
+// carriedValidators returns the first n validators of the previous epoch
+// carrying on at an epoch transition electing too few validators, but the
+// kicked out ones.
+func carriedValidators(snap *Snapshot, kickOuts []common.Address, n int) ([]common.Address, error) {
+	validators, err := snap.GetValidators()
+	if err != nil {
+		return nil, err
+	}
+	kicked := NewAddressSet(kickOuts...)
+	carried := make([]common.Address, 0, len(validators))
+	for _, validator := range validators {
+		if len(carried) >= n {
+			break
+		}
+		if !kicked.Contains(validator) {
+			carried = append(carried, validator)
+		}
+	}
+	return carried, nil
+}
+
+// sortBySeverity orders the validators to kick out by the share of the blocks
+// they were scheduled for that they minted, the lowest first, then by address.
+func sortBySeverity(validators SortableAddresses, scheduledBlocks map[common.Address]uint64) {
+	sort.Slice(validators, func(i, j int) bool {
+		left := validators[i].Weight.Uint64() * scheduledBlocks[validators[j].Address]
+		right := validators[j].Weight.Uint64() * scheduledBlocks[validators[i].Address]
+		if left != right {
+			return left < right
+		}
+		return bytes.Compare(validators[i].Address[:], validators[j].Address[:]) < 0
+	})
+}
+
+// removeExitingCandidates removes the exiting candidates at the transition of
+// header and refunds their deposits, returning their addresses.
+func (e *Equality) removeExitingCandidates(config params.EqualityConfig, state *state.StateDB,
+	header *types.Header, snap *Snapshot) ([]common.Address, error) {
+
+	if !config.IsCandidateExit(header.Number) || header.Number.Uint64() <= 1 {
+		return nil, nil
+	}
+	exiting, err := snap.ExitingCandidates()
+	if err != nil {
+		return nil, err
+	}
+	for _, candidate := range exiting {
+		_, security, err := snap.CancelCandidate(candidate)
+		if err != nil {
+			return nil, err
+		}
+		snap.journal.addBalance(state, candidate, security, opExitRefund)
+		log.Info("[equality] Exiting candidate removed", "candidate", candidate, "security", security)
+	}
+	return exiting, nil
+}
+
+// slashCandidate sends config.SlashRatio percent of the security deposit of
+// a kicked out candidate to config.SlashRecipient and refunds the rest, odd
+// wei are rounded in favour of the candidate. Without a slash ratio the
+// deposit is kept back as before.
+func (e *Equality) slashCandidate(config params.EqualityConfig, state *state.StateDB, journal *systemJournal,
+	candidate common.Address, security *big.Int) {
+
+	if config.SlashRatio == 0 || security == nil || security.Sign() <= 0 {
+		return
+	}
+
+	slashed := new(big.Int).Mul(security, new(big.Int).SetUint64(config.SlashRatio))
+	slashed.Div(slashed, big.NewInt(100))
+	if slashed.Cmp(security) > 0 {
+		slashed.Set(security)
+	}
+	if config.SlashRecipient != nil {
+		journal.addBalance(state, *config.SlashRecipient, slashed, opSlash)
+	}
+	journal.addBalance(state, candidate, new(big.Int).Sub(security, slashed), opKickOutRefund)
+
+	log.Info("[equality] Slash candidate", "candidate", candidate,
+		"security", security, "slashed", slashed, "recipient", config.SlashRecipient)
+}
+
+// lockOut returns the number of blocks from number on that reject the
+// registration of a kicked out candidate. The window of the given config
+// is applied, so shortening it also releases already kicked out candidates.
+func lockOut(config params.EqualityConfig, snap *Snapshot, candidate common.Address, number uint64) (uint64, error) {
+	kickOutBlock, kicked, err := snap.GetKickOutBlock(candidate)
+	if err != nil || !kicked {
+		return 0, err
+	}
+	if until := kickOutBlock + config.KickOutLockOut; until > number {
+		return until - number, nil
+	}
+	return 0, nil
+}
+
+// blockReward returns the reward of the block of number under config, nil if
+// there is none.
+func blockReward(config params.EqualityConfig, number uint64) *big.Int {
 	var blockReward *big.Int
-	number := header.Number.Uint64()
 	for _, reward := range config.Rewards {
 		blockReward = reward.Reward
 		if reward.Number >= number {
 			break
 		}
 	}
+	return blockReward
+}
 
+// sealerReward returns the shares of blockReward paid to the coinbase and to
+// the community fund, the rest goes to the pool. The community fund gets
+// config.CommunityRate basis points of the sealer reward, rounded down in
+// favour of the coinbase.
+func sealerReward(config params.EqualityConfig, blockReward *big.Int) (*big.Int, *big.Int) {
+	base := big.NewInt(0).Div(blockReward, big.NewInt(10))
+	community := big.NewInt(0)
+	if config.CommunityRate > 0 && config.CommunityAddress != nil {
+		community.Mul(base, new(big.Int).SetUint64(config.CommunityRate))
+		community.Div(community, big.NewInt(10000))
+	}
+	return base.Sub(base, community), community
+}
+
+// Credits the coinbase of the given block with the mining reward, or the reward
+// recipient it set in snap, the snapshot of the parent block.
+func (e *Equality) accumulateRewards(config params.EqualityConfig, state *state.StateDB, header *types.Header, snap *Snapshot) {
+	blockReward := blockReward(config, header.Number.Uint64())
 	if blockReward == nil || blockReward.Cmp(big.NewInt(0)) <= 0 {
 		return
 	}
 
-	base := big.NewInt(0).Div(blockReward, big.NewInt(10))
-	state.AddBalance(header.Coinbase, base)
-	state.AddBalance(config.Pool, big.NewInt(0).Sub(blockReward, base))
+	base, community := sealerReward(config, blockReward)
+	pool := big.NewInt(0).Sub(blockReward, base)
+	pool.Sub(pool, community)
+	recipient := rewardRecipientOf(config, snap, header)
+	var journal *systemJournal
+	if snap != nil {
+		journal = snap.journal
+	}
+	journal.addBalance(state, recipient, base, opReward)
+	if community.Sign() > 0 {
+		journal.addBalance(state, *config.CommunityAddress, community, opCommunityReward)
+	}
+	journal.addBalance(state, config.Pool, pool, opPoolReward)
 
 	log.Debug("[equality] Accumulate rewards",
-		"coinbase", header.Coinbase, "amount", base,
-		"pool", config.Pool, "amount", big.NewInt(0).Sub(blockReward, base))
+		"coinbase", header.Coinbase, "amount", base, "community", community,
+		"pool", config.Pool, "amount", pool)
+}
+
+// registerCandidate registers candidate if its balance covers the deposit and
+// it is not locked out, locking the deposit. Beyond the max candidate count the
+// deposit must exceed the lowest one, whose candidate is evicted. The deposit
+// is the minimum one if nil. The candidates and cancels are the ones of the
+// block.
+func registerCandidate(config params.EqualityConfig, state *state.StateDB, number uint64, snap *Snapshot,
+	headerExtra *HeaderExtra, candidates, cancels *AddressSet, candidate common.Address, deposit *big.Int) {
+
+	if err := candidateEligible(config, state, new(big.Int).SetUint64(number), candidate); err != nil {
+		log.Debug("[equality] Rejected candidate registration", "number", number, "candidate", candidate, "err", err)
+		return
+	}
+	if deposit == nil || config.MaxCandidateCount == 0 {
+		deposit = config.MinCandidateBalance
+	}
+	if state.GetBalance(candidate).Cmp(deposit) == -1 {
+		return
+	}
+	if blocks, err := lockOut(config, snap, candidate, number); err != nil || blocks > 0 {
+		return
+	}
+	if registered, err := snap.GetCandidate(candidate); err != nil || registered != nil {
+		return
+	}
+	evictable, staked, full, err := snap.evictableCandidate(config)
+	if err != nil || (full && deposit.Cmp(staked) <= 0) {
+		return
+	}
+	if full {
+		if err = evictCandidate(state, snap, headerExtra, candidates, evictable); err != nil {
+			return
+		}
+	}
+	if alreadyIsCandidate, err := snap.BecomeCandidate(candidate, number, config.MinCandidateBalance); err == nil && !alreadyIsCandidate {
+		snap.journal.subBalance(state, candidate, config.MinCandidateBalance, opDeposit)
+		candidates.Add(candidate)
+		cancels.Remove(candidate)
+	}
+	if excess := new(big.Int).Sub(deposit, config.MinCandidateBalance); excess.Sign() > 0 && candidates.Contains(candidate) {
+		if topped, err := snap.TopUpCandidate(candidate, excess); err == nil && topped {
+			snap.journal.subBalance(state, candidate, excess, opDeposit)
+			headerExtra.CurrentBlockTopUps = topUpsAdd(headerExtra.CurrentBlockTopUps, candidate, excess)
+		}
+	}
 }
 
-// Process custom transactions, write into header.Extra.
+// Process custom transactions, write into header.Extra. The candidate
+// operations are carried by the transactions only, into the state and the
+// snapshot tries of the branch including them: a block reorged out takes its
+// operations along, they apply again once the transaction pool reinjects them.
 func (e *Equality) processTransactions(config params.EqualityConfig, state *state.StateDB, header *types.Header,
 	snap *Snapshot, headerExtra *HeaderExtra, txs []*types.Transaction) {
 
 	number := header.Number.Uint64()
 	if number <= 1 {
-		if err := snap.SetChainConfig(config); err != nil {
+		// The genesis config is in effect from the first block on
+		config.ActivationBlock = 0
+		if err := validateChainConfig(config); err != nil {
+			log.Error("[equality] Invalid genesis chain config", "err", err)
+		}
+		if err := snap.ScheduleChainConfig(config); err != nil {
 			panic(err)
 		}
 		headerExtra.ChainConfig = []params.EqualityConfig{config}
 	}
 
+	// The address lists of the header extra are built as sets, checked for
+	// every candidate event
+	candidates := NewAddressSet(headerExtra.CurrentBlockCandidates...)
+	cancels := NewAddressSet(headerExtra.CurrentBlockCancelCandidates...)
+	cancelVotes := NewAddressSet(headerExtra.CurrentBlockCancelVotes...)
+
+	// Register the deferred candidates first, the registrations beyond the
+	// limit of the block are queued again
+	queue := loadCandidateQueue(state)
+	admitted := admittedCandidates(config, queue, txs)
+	deferred := make(map[common.Address]*big.Int)
+	for _, entry := range queue {
+		if _, ok := admitted[entry.Candidate]; admitted != nil && !ok {
+			deferred[entry.Candidate] = entry.Deposit
+			continue
+		}
+		registerCandidate(config, state, number, snap, headerExtra, candidates, cancels, entry.Candidate, entry.Deposit)
+	}
+
+	// The checkpoint signatures are collected by the transition blocks only
+	collectCheckpoint := number > 1 && headerExtra.EpochBlock == number && config.IsCheckpoint(header.Number)
+	var signatures [][]byte
+
 	count := 0
 	for _, tx := range txs {
+		refundContractValue(state, snap.journal, tx)
 		ctx, err := NewTransaction(tx)
 		if err != nil {
 			continue
@@ -324,35 +1094,170 @@ func (e *Equality) processTransactions(config params.EqualityConfig, state *stat
 			switch ctx.(type) {
 			case *EventBecomeCandidate:
 				event := ctx.(*EventBecomeCandidate)
-				if state.GetBalance(event.Candidate).Cmp(config.MinCandidateBalance) == -1 {
-					break
+				if event.Deposit == nil || event.Deposit.Cmp(config.MinCandidateBalance) >= 0 {
+					if _, ok := admitted[event.Candidate]; admitted != nil && !ok {
+						deferred[event.Candidate] = event.Deposit
+					} else {
+						registerCandidate(config, state, number, snap, headerExtra, candidates, cancels, event.Candidate, event.Deposit)
+					}
 				}
-				if alreadyIsCandidate, err := snap.BecomeCandidate(event.Candidate, number, config.MinCandidateBalance); err == nil {
-					if !alreadyIsCandidate {
-						state.SubBalance(event.Candidate, config.MinCandidateBalance)
-						headerExtra.CurrentBlockCandidates = append(headerExtra.CurrentBlockCandidates, event.Candidate)
-						if addressesExist(headerExtra.CurrentBlockCancelCandidates, event.Candidate) {
-							headerExtra.CurrentBlockCancelCandidates = addressesRemove(headerExtra.CurrentBlockCancelCandidates, event.Candidate)
-						}
+				// Registering again replaces the metadata of a candidate, no deposit
+				// is needed. A deferred registration keeps its deposit in the queue,
+				// its metadata is dropped
+				if len(event.Metadata) > 0 && config.IsMetadata(header.Number) {
+					if set, err := snap.SetCandidateMetadata(event.Candidate, event.Metadata); err == nil && set {
+						metadata := CandidateMetadata{Candidate: event.Candidate, Metadata: common.CopyBytes(event.Metadata)}
+						headerExtra.CurrentBlockMetadata = candidateMetadataSet(headerExtra.CurrentBlockMetadata, metadata)
 					}
 				}
 				count++
 			case *EventCancelCandidate:
 				event := ctx.(*EventCancelCandidate)
+				delete(deferred, event.Delegator)
+				if config.IsCandidateExit(header.Number) && !candidates.Contains(event.Delegator) {
+					// The deposit stays locked until the candidate leaves at the next transition
+					if exist, err := snap.ExitCandidate(event.Delegator); err == nil && exist {
+						cancels.Add(event.Delegator)
+					}
+					count++
+					break
+				}
 				if exist, security, err := snap.CancelCandidate(event.Delegator); err == nil && exist {
-					state.AddBalance(event.Delegator, security)
-					headerExtra.CurrentBlockCancelCandidates = append(headerExtra.CurrentBlockCancelCandidates, event.Delegator)
-					if addressesExist(headerExtra.CurrentBlockCandidates, event.Delegator) {
-						headerExtra.CurrentBlockCandidates = addressesRemove(headerExtra.CurrentBlockCandidates, event.Delegator)
+					snap.journal.addBalance(state, event.Delegator, security, opCancelRefund)
+					cancels.Add(event.Delegator)
+					candidates.Remove(event.Delegator)
+					// The refund covers the top ups of the block, they are not replayed
+					headerExtra.CurrentBlockTopUps = topUpsRemove(headerExtra.CurrentBlockTopUps, event.Delegator)
+					headerExtra.CurrentBlockMetadata = candidateMetadataRemove(headerExtra.CurrentBlockMetadata, event.Delegator)
+					headerExtra.CurrentBlockRewardRecipients = rewardRecipientsRemove(headerExtra.CurrentBlockRewardRecipients, event.Delegator)
+					headerExtra.CurrentBlockSealerKeys = sealerKeysRemove(headerExtra.CurrentBlockSealerKeys, event.Delegator)
+				}
+				count++
+			case *EventTopUpCandidate:
+				event := ctx.(*EventTopUpCandidate)
+				if !config.IsTopUp(header.Number) {
+					break
+				}
+				if state.GetBalance(event.Candidate).Cmp(event.Amount) == -1 {
+					break
+				}
+				if topped, err := snap.TopUpCandidate(event.Candidate, event.Amount); err == nil && topped {
+					snap.journal.subBalance(state, event.Candidate, event.Amount, opTopUp)
+					headerExtra.CurrentBlockTopUps = topUpsAdd(headerExtra.CurrentBlockTopUps, event.Candidate, event.Amount)
+				}
+				count++
+			case *EventSetRewardRecipient:
+				event := ctx.(*EventSetRewardRecipient)
+				if !config.IsRewardRecipient(header.Number) {
+					break
+				}
+				if set, err := snap.SetRewardRecipient(event.Candidate, event.Recipient); err == nil && set {
+					recipient := RewardRecipient{Candidate: event.Candidate, Recipient: event.Recipient}
+					headerExtra.CurrentBlockRewardRecipients = rewardRecipientsSet(headerExtra.CurrentBlockRewardRecipients, recipient)
+				}
+				count++
+			case *EventSetSealer:
+				event := ctx.(*EventSetSealer)
+				if !config.IsSealerKey(header.Number) {
+					break
+				}
+				if set, err := snap.SetSealer(event.Candidate, event.Sealer, headerExtra.Epoch+1); err == nil && set {
+					key := SealerKey{Candidate: event.Candidate, Sealer: event.Sealer}
+					headerExtra.CurrentBlockSealerKeys = sealerKeysSet(headerExtra.CurrentBlockSealerKeys, key)
+				}
+				count++
+			case *EventVote:
+				event := ctx.(*EventVote)
+				if !config.DelegatedVoting {
+					break
+				}
+				if candidate, err := snap.GetCandidate(event.Candidate); err != nil || candidate == nil {
+					break
+				}
+				// The balance is locked as the weight of the vote, a vote replacing
+				// another one adds the balance to the weight locked already
+				previous, err := snap.GetVote(event.Delegator)
+				if err != nil {
+					break
+				}
+				balance := new(big.Int).Set(state.GetBalance(event.Delegator))
+				weight := new(big.Int).Set(balance)
+				if previous != nil {
+					weight.Add(weight, previous.Weight)
+				}
+				if weight.Sign() <= 0 {
+					break
+				}
+				vote := Vote{Delegator: event.Delegator, Candidate: event.Candidate, Weight: weight}
+				if err = snap.Vote(vote); err == nil {
+					if balance.Sign() > 0 {
+						snap.journal.subBalance(state, event.Delegator, balance, opVoteLock)
 					}
+					headerExtra.CurrentBlockVotes = append(votesRemove(headerExtra.CurrentBlockVotes, event.Delegator), vote)
+					cancelVotes.Remove(event.Delegator)
+				}
+				count++
+			case *EventCancelVote:
+				event := ctx.(*EventCancelVote)
+				if !config.DelegatedVoting {
+					break
+				}
+				if exist, weight, err := snap.CancelVote(event.Delegator); err == nil && exist {
+					snap.journal.addBalance(state, event.Delegator, weight, opVoteRefund)
+					headerExtra.CurrentBlockVotes = votesRemove(headerExtra.CurrentBlockVotes, event.Delegator)
+					cancelVotes.Add(event.Delegator)
+				}
+				count++
+			case *EventProposeConfig:
+				event := ctx.(*EventProposeConfig)
+				proposal := ConfigProposal{Proposer: event.Proposer, Config: event.Config}
+				if err = snap.applyConfigProposal(config, number, proposal); err == nil {
+					headerExtra.CurrentBlockProposals = append(headerExtra.CurrentBlockProposals, proposal)
+				}
+				count++
+			case *EventApproveConfig:
+				event := ctx.(*EventApproveConfig)
+				approval := ConfigApproval{Validator: event.Validator, Proposal: event.Proposal}
+				if err = snap.applyConfigApproval(config, number, approval); err == nil {
+					headerExtra.CurrentBlockApprovals = append(headerExtra.CurrentBlockApprovals, approval)
+				}
+				count++
+			case *EventSignCheckpoint:
+				event := ctx.(*EventSignCheckpoint)
+				if collectCheckpoint {
+					signatures = append(signatures, event.Signature)
 				}
 				count++
 			}
 		}
 	}
+	headerExtra.CurrentBlockCandidates = candidates.Slice()
+	headerExtra.CurrentBlockCancelCandidates = cancels.Slice()
+	headerExtra.CurrentBlockCancelVotes = cancelVotes.Slice()
+	storeCandidateQueue(state, snap.journal, deferred)
+
+	// Attest the final block of the previous epoch if signed by a quorum of
+	// its validators, still the ones of the snapshot before the election
+	if collectCheckpoint {
+		checkpoint, err := snap.attestCheckpoint(header, signatures)
+		if err != nil {
+			log.Warn("[equality] Failed to attest checkpoint", "number", number, "err", err)
+		}
+		headerExtra.Checkpoint = checkpoint
+	}
 
-	headerExtra.CurrentBlockCandidates = addressesDistinct(headerExtra.CurrentBlockCandidates)
-	headerExtra.CurrentBlockCancelCandidates = addressesDistinct(headerExtra.CurrentBlockCancelCandidates)
+	// Include the config change approved by a quorum of the validators
+	if number > 1 {
+		approved, err := snap.approvedConfig(config, number, *headerExtra)
+		if err == nil && approved != nil {
+			err = snap.applyApprovedConfig(config, number, *approved)
+		}
+		if err != nil {
+			log.Warn("[equality] Failed to include approved config", "number", number, "err", err)
+		} else if approved != nil {
+			headerExtra.ChainConfig = []params.EqualityConfig{*approved}
+		}
+	}
 
 	log.Trace("[equality] Processing transactions done", "txs", count)
 }
@@ -1,15 +1,23 @@
 package equality
 
 import (
+	"crypto/ecdsa"
+	"errors"
 	"math/big"
+	"runtime"
 	"testing"
 	"time"
 
 	"github.com/SecretBlockChain/go-secret/accounts"
 	"github.com/SecretBlockChain/go-secret/common"
+	"github.com/SecretBlockChain/go-secret/core"
 	"github.com/SecretBlockChain/go-secret/core/rawdb"
+	"github.com/SecretBlockChain/go-secret/core/state"
+	"github.com/SecretBlockChain/go-secret/core/types"
+	"github.com/SecretBlockChain/go-secret/core/vm"
 	"github.com/SecretBlockChain/go-secret/crypto"
 	"github.com/SecretBlockChain/go-secret/params"
+	"github.com/stretchr/testify/assert"
 )
 
 var (
@@ -36,3 +44,737 @@ func TestNewEquality(t *testing.T) {
 		return crypto.Sign(crypto.Keccak256(data), testUserKey)
 	})
 }
+
+// newTestHeader returns a header carrying the encoded header extra.
+func newTestHeader(number uint64, headerExtra HeaderExtra) *types.Header {
+	payload, err := headerExtra.Encode()
+	if err != nil {
+		panic(err)
+	}
+	extra := append(make([]byte, ExtraVanity), payload...)
+	extra = append(extra, make([]byte, ExtraSeal)...)
+	return &types.Header{Number: new(big.Int).SetUint64(number), Extra: extra}
+}
+
+// newTestHeaderExtra returns a header extra carrying n epoch validators.
+func newTestHeaderExtra(n int) HeaderExtra {
+	headerExtra := HeaderExtra{Epoch: 2, EpochBlock: 180}
+	for i := 0; i < n; i++ {
+		key, _ := crypto.GenerateKey()
+		headerExtra.CurrentEpochValidators = append(headerExtra.CurrentEpochValidators, crypto.PubkeyToAddress(key.PublicKey))
+	}
+	return headerExtra
+}
+
+func TestCloseRestart(t *testing.T) {
+	config := newTestSealingConfig()
+	config.Period = 5
+	db := rawdb.NewMemoryDatabase()
+	genesis := &types.Header{Number: big.NewInt(0), UncleHash: uncleHash}
+	chain := &testHeaderChain{config: params.TestnetChainConfig, headers: []*types.Header{genesis}}
+	signFn := func(account accounts.Account, mimeType string, data []byte) ([]byte, error) {
+		return crypto.Sign(crypto.Keccak256(data), testUserKey)
+	}
+	newBlock := func() *types.Block {
+		header := newTestHeader(1, HeaderExtra{Epoch: 1, EpochBlock: 1, CurrentEpochValidators: config.Validators})
+		header.ParentHash = genesis.Hash()
+		header.Coinbase = testUserAddress
+		header.Time = uint64(time.Now().Unix()) + config.Period
+		return types.NewBlockWithHeader(header)
+	}
+
+	goroutines := runtime.NumGoroutine()
+	var root Root
+	for i := uint64(1); i <= 100; i++ {
+		e := New(&config, db)
+		e.SetSnapshotFlushInterval(1 << 20)
+
+		// The layers of the previous engines were persisted on close
+		assert.True(t, e.snapshots.available(root), "restart %d", i)
+		snap := e.snapshots.open(root)
+		assert.Nil(t, snap.MintBlock(1, i, testUserAddress))
+		var err error
+		root, err = snap.Root()
+		assert.Nil(t, err)
+		assert.Nil(t, e.snapshots.add(i, root))
+
+		// Closing aborts the sealing waiting for its slot, later seals fail
+		e.Authorize(testUserAddress, signFn)
+		results := make(chan *types.Block, 1)
+		assert.Nil(t, e.Seal(chain, newBlock(), results, nil))
+		assert.Nil(t, e.Close())
+		assert.Nil(t, e.Close())
+		assert.Equal(t, errEngineClosed, e.Seal(chain, newBlock(), results, nil))
+		assert.Empty(t, results)
+	}
+	counts, err := New(&config, db).snapshots.open(root).MintCounts(1)
+	assert.Nil(t, err)
+	assert.Equal(t, map[common.Address]uint64{testUserAddress: 100}, counts)
+
+	// No sealing goroutine is left behind
+	for deadline := time.Now().Add(time.Second); runtime.NumGoroutine() > goroutines && time.Now().Before(deadline); {
+		time.Sleep(10 * time.Millisecond)
+	}
+	assert.LessOrEqual(t, runtime.NumGoroutine(), goroutines)
+}
+
+func TestDecodeHeaderExtraCached(t *testing.T) {
+	equality := New(&params.EqualityConfig{}, rawdb.NewMemoryDatabase())
+
+	header := newTestHeader(180, newTestHeaderExtra(21))
+	headerExtra, err := equality.DecodeHeaderExtraCached(header)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, equality.headerExtras.Len())
+
+	cached, err := equality.DecodeHeaderExtraCached(header)
+	assert.Nil(t, err)
+	assert.True(t, cached.Equal(headerExtra))
+
+	// Decode errors are never cached
+	invalid := &types.Header{Number: big.NewInt(1), Extra: make([]byte, ExtraVanity+ExtraSeal)}
+	_, err = equality.DecodeHeaderExtraCached(invalid)
+	assert.NotNil(t, err)
+	_, err = equality.DecodeHeaderExtraCached(invalid)
+	assert.NotNil(t, err)
+	assert.Equal(t, 1, equality.headerExtras.Len())
+}
+
+func BenchmarkDecodeHeaderExtra(b *testing.B) {
+	header := newTestHeader(180, newTestHeaderExtra(21))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := DecodeHeaderExtra(header); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkDecodeHeaderExtraCached(b *testing.B) {
+	equality := New(&params.EqualityConfig{}, rawdb.NewMemoryDatabase())
+	header := newTestHeader(180, newTestHeaderExtra(21))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := equality.DecodeHeaderExtraCached(header); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// newKickOutTestSnapshot returns a snapshot at the end of a 30 block epoch,
+// where validator3 joined at block 19 and sealed every remaining slot.
+func newKickOutTestSnapshot(t *testing.T, validators []common.Address) *Snapshot {
+	snap, err := newSnapshot(rawdb.NewMemoryDatabase())
+	assert.Nil(t, err)
+	assert.Nil(t, snap.SetValidators(validators))
+
+	_, err = snap.BecomeCandidate(validators[0], 1, big.NewInt(0))
+	assert.Nil(t, err)
+	_, err = snap.BecomeCandidate(validators[1], 1, big.NewInt(0))
+	assert.Nil(t, err)
+	_, err = snap.BecomeCandidate(validators[2], 19, big.NewInt(0))
+	assert.Nil(t, err)
+	for i := 0; i < 3; i++ {
+		key, _ := crypto.GenerateKey()
+		_, err = snap.BecomeCandidate(crypto.PubkeyToAddress(key.PublicKey), 1, big.NewInt(0))
+		assert.Nil(t, err)
+	}
+
+	for number := uint64(1); number <= 10; number++ {
+		assert.Nil(t, snap.MintBlock(1, number, validators[0]))
+	}
+	for number := uint64(11); number <= 14; number++ {
+		assert.Nil(t, snap.MintBlock(1, number, validators[1]))
+	}
+	for number := uint64(19); number <= 22; number++ {
+		assert.Nil(t, snap.MintBlock(1, number, validators[2]))
+	}
+	return snap
+}
+
+func TestTryElectKickOutRatio(t *testing.T) {
+	validators := []common.Address{
+		common.HexToAddress("0xcc7c8317b21e1cea6139700c3c46c21af998d14c"),
+		common.HexToAddress("0x44d1ce0b7cb3588bca96151fe1bc05af38f91b6c"),
+		common.HexToAddress("0xf541c3cd1d2df407fb9bb52b3489fc2aaeedd97e"),
+	}
+	header := &types.Header{Number: big.NewInt(31), ParentHash: common.HexToHash("0x01")}
+
+	tests := []struct {
+		ratio     uint64
+		kickedOut []common.Address
+	}{
+		// The min mint count rule ignores that validator3 joined late
+		{0, []common.Address{validators[1], validators[2]}},
+		{50, []common.Address{validators[1]}},
+		{100, []common.Address{validators[1]}},
+	}
+	for _, test := range tests {
+		config := params.EqualityConfig{Epoch: 30, MaxValidatorsCount: 3, KickOutRatio: test.ratio}
+		e := New(&config, rawdb.NewMemoryDatabase())
+		snap := newKickOutTestSnapshot(t, validators)
+
+		headerExtra := HeaderExtra{Epoch: 2, EpochBlock: 31}
+		assert.Nil(t, e.tryElect(config, nil, header, snap, &headerExtra, nil))
+		assert.ElementsMatch(t, test.kickedOut, headerExtra.CurrentBlockKickOutCandidates, "ratio %d", test.ratio)
+		assert.Len(t, headerExtra.CurrentEpochValidators, 3)
+	}
+
+	// The single validator of a dev chain is not kicked out
+	config := params.EqualityConfig{Epoch: 30, MaxValidatorsCount: 1}
+	e := New(&config, rawdb.NewMemoryDatabase())
+	headerExtra := HeaderExtra{Epoch: 2, EpochBlock: 31}
+	assert.Nil(t, e.tryElect(config, nil, header, newKickOutTestSnapshot(t, validators), &headerExtra, nil))
+	assert.Empty(t, headerExtra.CurrentBlockKickOutCandidates)
+	assert.Len(t, headerExtra.CurrentEpochValidators, 1)
+
+	// Other chains of a max validators count of 1 kick out as before
+	config.Period = 3
+	e = New(&config, rawdb.NewMemoryDatabase())
+	headerExtra = HeaderExtra{Epoch: 2, EpochBlock: 31}
+	assert.Nil(t, e.tryElect(config, nil, header, newKickOutTestSnapshot(t, validators), &headerExtra, nil))
+	assert.NotEmpty(t, headerExtra.CurrentBlockKickOutCandidates)
+	assert.Len(t, headerExtra.CurrentEpochValidators, 1)
+}
+
+func TestMinValidatorsCount(t *testing.T) {
+	validatorA := common.HexToAddress("0xa000000000000000000000000000000000000000")
+	validatorB := common.HexToAddress("0xb000000000000000000000000000000000000000")
+	validatorC := common.HexToAddress("0xc000000000000000000000000000000000000000")
+	validatorD := common.HexToAddress("0xd000000000000000000000000000000000000000")
+	candidateE := common.HexToAddress("0xe000000000000000000000000000000000000000")
+	validators := []common.Address{validatorA, validatorB, validatorC, validatorD}
+
+	// Every validator of the first epoch missed its slots, A minting one block
+	// of the three it was scheduled for, the others none
+	newSnap := func(candidates ...common.Address) *Snapshot {
+		snap, err := newSnapshot(rawdb.NewMemoryDatabase())
+		assert.Nil(t, err)
+		assert.Nil(t, snap.SetValidators(validators))
+		for _, candidate := range candidates {
+			_, err = snap.BecomeCandidate(candidate, 1, big.NewInt(0))
+			assert.Nil(t, err)
+		}
+		assert.Nil(t, snap.MintBlock(1, 1, validatorA))
+		return snap
+	}
+	header := &types.Header{Number: big.NewInt(13), ParentHash: common.HexToHash("0x01")}
+	elect := func(config params.EqualityConfig, snap *Snapshot) (HeaderExtra, *electionTrail) {
+		e := New(&config, rawdb.NewMemoryDatabase())
+		headerExtra, trail := HeaderExtra{Epoch: 2, EpochBlock: 13}, new(electionTrail)
+		assert.Nil(t, e.elect(config, nil, header, snap, &headerExtra, nil, trail))
+		return headerExtra, trail
+	}
+	all := append([]common.Address{candidateE}, validators...)
+
+	// Down to the safe size of 3 candidates two validators are kicked out, the
+	// min validators count stops at 4 kicking out the least active one
+	config := params.EqualityConfig{Epoch: 12, MaxValidatorsCount: 4, KickOutRatio: 50}
+	headerExtra, _ := elect(config, newSnap(all...))
+	assert.Len(t, headerExtra.CurrentBlockKickOutCandidates, 2)
+	assert.Len(t, headerExtra.CurrentEpochValidators, 3)
+
+	config.MinValidatorsCount = 4
+	headerExtra, trail := elect(config, newSnap(all...))
+	assert.Equal(t, []common.Address{validatorB}, headerExtra.CurrentBlockKickOutCandidates)
+	assert.Len(t, headerExtra.CurrentEpochValidators, 4)
+	assert.Len(t, trail.MintCounts, 4)
+	for _, count := range trail.MintCounts {
+		assert.True(t, count.Inactive, "validator %x", count.Address)
+	}
+	assert.Equal(t, []electionKickOut{
+		{Address: validatorB, Kicked: true, CandidateCount: 5, SafeSize: 4},
+		{Address: validatorC, Reason: kickOutMinValidators, CandidateCount: 4, SafeSize: 4},
+		{Address: validatorD, Reason: kickOutMinValidators, CandidateCount: 4, SafeSize: 4},
+		{Address: validatorA, Reason: kickOutMinValidators, CandidateCount: 4, SafeSize: 4},
+	}, trail.KickOuts)
+	assert.False(t, trail.CarriedOver)
+	assert.Nil(t, newSnap(all...).applyElection(config, header, headerExtra))
+
+	// Kicking out beyond the min validators count is rejected
+	forged := headerExtra
+	forged.CurrentBlockKickOutCandidates = []common.Address{validatorB, validatorC}
+	forged.CurrentEpochValidators = []common.Address{validatorA, validatorD, candidateE}
+	assert.True(t, errors.Is(newSnap(all...).applyElection(config, header, forged), errTooFewValidators))
+
+	// With a validator gone, too few candidates are left: none is kicked out
+	// and the validators of the previous epoch carry on
+	headerExtra, trail = elect(config, newSnap(validatorA, validatorB, validatorC))
+	assert.Empty(t, headerExtra.CurrentBlockKickOutCandidates)
+	assert.ElementsMatch(t, validators, headerExtra.CurrentEpochValidators)
+	assert.True(t, trail.CarriedOver)
+	assert.Nil(t, newSnap(validatorA, validatorB, validatorC).applyElection(config, header, headerExtra))
+
+	// Electing fewer validators instead is rejected
+	forged = headerExtra
+	forged.CurrentEpochValidators = []common.Address{validatorA, validatorB, validatorC}
+	assert.True(t, errors.Is(newSnap(validatorA, validatorB, validatorC).applyElection(config, header, forged), errTooFewValidators))
+
+	config.MinValidatorsCount = 0
+	assert.Nil(t, newSnap(validatorA, validatorB, validatorC).applyElection(config, header, forged))
+}
+
+func TestKickOutLockOut(t *testing.T) {
+	candidate := crypto.PubkeyToAddress(testKey.PublicKey)
+	tx := types.NewTransaction(1, candidate, big.NewInt(0), 99999999, big.NewInt(1000), []byte("equality:1:event:candidate"))
+	tx, err := types.SignTx(tx, types.HomesteadSigner{}, testKey)
+	assert.Nil(t, err)
+
+	tests := []struct {
+		lockOut    uint64
+		number     uint64
+		registered bool
+	}{
+		{50, 120, false},
+		{50, 149, false},
+		{50, 150, true},
+		// Shortening the window releases the candidate kicked out before
+		{10, 120, true},
+		// Without a window the kick out record is ignored
+		{0, 101, true},
+	}
+	for _, test := range tests {
+		db := rawdb.NewMemoryDatabase()
+		snap, err := newSnapshot(db)
+		assert.Nil(t, err)
+		_, err = snap.BecomeCandidate(candidate, 1, big.NewInt(1))
+		assert.Nil(t, err)
+		_, _, err = snap.CancelCandidate(candidate)
+		assert.Nil(t, err)
+		assert.Nil(t, snap.SetKickOutBlock(candidate, 100))
+
+		statedb, err := state.New(common.Hash{}, state.NewDatabase(db), nil)
+		assert.Nil(t, err)
+		statedb.AddBalance(candidate, big.NewInt(10))
+
+		config := params.EqualityConfig{Epoch: 30, MinCandidateBalance: big.NewInt(1), KickOutLockOut: test.lockOut}
+		e := New(&config, db)
+		header := &types.Header{Number: new(big.Int).SetUint64(test.number)}
+		headerExtra := HeaderExtra{Epoch: 4, EpochBlock: 91}
+		e.processTransactions(config, statedb, header, snap, &headerExtra, []*types.Transaction{tx})
+
+		registered, err := snap.GetCandidate(candidate)
+		assert.Nil(t, err)
+		_, kicked, err := snap.GetKickOutBlock(candidate)
+		assert.Nil(t, err)
+		if test.registered {
+			assert.NotNil(t, registered, "lockOut %d number %d", test.lockOut, test.number)
+			assert.Equal(t, []common.Address{candidate}, headerExtra.CurrentBlockCandidates)
+			assert.False(t, kicked)
+		} else {
+			assert.Nil(t, registered, "lockOut %d number %d", test.lockOut, test.number)
+			assert.Empty(t, headerExtra.CurrentBlockCandidates)
+			assert.True(t, kicked)
+		}
+	}
+}
+
+func TestMinCandidateBalance(t *testing.T) {
+	var keys []*ecdsa.PrivateKey
+	var candidates []common.Address
+	for i := 0; i < 3; i++ {
+		key, _ := crypto.GenerateKey()
+		keys = append(keys, key)
+		candidates = append(candidates, crypto.PubkeyToAddress(key.PublicKey))
+	}
+	db := rawdb.NewMemoryDatabase()
+	statedb, err := state.New(common.Hash{}, state.NewDatabase(db), nil)
+	assert.Nil(t, err)
+	for idx, balance := range []int64{10, 3, 7} {
+		statedb.AddBalance(candidates[idx], big.NewInt(balance))
+	}
+
+	config := params.EqualityConfig{Period: 3, Epoch: 30, MaxValidatorsCount: 3, MinCandidateBalance: big.NewInt(5)}
+	e := New(&config, db)
+	snap, err := newSnapshot(db)
+	assert.Nil(t, err)
+	assert.Nil(t, snap.SetChainConfig(config))
+	replayed, err := newSnapshot(db)
+	assert.Nil(t, err)
+
+	// Registrations below the min candidate balance are left out of the block
+	header := &types.Header{Number: big.NewInt(2)}
+	headerExtra := HeaderExtra{Epoch: 1, EpochBlock: 1}
+	e.processTransactions(config, statedb, header, snap, &headerExtra, []*types.Transaction{
+		newVoteTestTransaction(t, keys[0], "equality:1:event:candidate"),
+		newVoteTestTransaction(t, keys[1], "equality:1:event:candidate"),
+	})
+	assert.Equal(t, []common.Address{candidates[0]}, headerExtra.CurrentBlockCandidates)
+	assert.Equal(t, big.NewInt(5), statedb.GetBalance(candidates[0]))
+	assert.Equal(t, big.NewInt(3), statedb.GetBalance(candidates[1]))
+
+	// Verifiers lock the same deposit replaying the header extra, and a block
+	// listing the rejected registration does not match their replay
+	assert.Nil(t, replayed.apply(config, header, headerExtra))
+	candidate, err := replayed.GetCandidate(candidates[0])
+	assert.Nil(t, err)
+	assert.Equal(t, big.NewInt(5), candidate.Staked)
+	forged := headerExtra
+	forged.CurrentBlockCandidates = candidates[:2]
+	assert.False(t, forged.Equal(headerExtra))
+
+	// The minimum is raised by a chain config entry from block 4 on
+	raised := config
+	raised.MinCandidateBalance = big.NewInt(8)
+	raised.ActivationBlock = 4
+	assert.Nil(t, snap.ScheduleChainConfig(raised))
+	assert.Nil(t, snap.activateChainConfig(3))
+	current, err := snap.GetChainConfig()
+	assert.Nil(t, err)
+	assert.Equal(t, big.NewInt(8), current.MinCandidateBalance)
+
+	header = &types.Header{Number: big.NewInt(4)}
+	headerExtra = HeaderExtra{Epoch: 1, EpochBlock: 1}
+	e.processTransactions(current, statedb, header, snap, &headerExtra, []*types.Transaction{
+		newVoteTestTransaction(t, keys[2], "equality:1:event:candidate"),
+	})
+	assert.Empty(t, headerExtra.CurrentBlockCandidates)
+	assert.Equal(t, big.NewInt(7), statedb.GetBalance(candidates[2]))
+
+	// The candidate registered with the old minimum is not kicked out for it,
+	// only the validator below the min mint count is
+	var others []common.Address
+	for i := 1; i <= 4; i++ {
+		other := common.BigToAddress(big.NewInt(int64(i)))
+		others = append(others, other)
+		_, err = snap.BecomeCandidate(other, 4, big.NewInt(8))
+		assert.Nil(t, err)
+	}
+	assert.Nil(t, snap.SetValidators([]common.Address{candidates[0], others[0]}))
+	for number := uint64(5); number <= 30; number++ {
+		minter := candidates[0]
+		if number == 30 {
+			minter = others[0]
+		}
+		assert.Nil(t, snap.MintBlock(1, number, minter))
+	}
+	header = &types.Header{Number: big.NewInt(31), ParentHash: common.HexToHash("0x01")}
+	headerExtra = HeaderExtra{Epoch: 2, EpochBlock: 31}
+	assert.Nil(t, e.tryElect(current, statedb, header, snap, &headerExtra, nil))
+	assert.Equal(t, others[:1], headerExtra.CurrentBlockKickOutCandidates)
+	candidate, err = snap.GetCandidate(candidates[0])
+	assert.Nil(t, err)
+	assert.Equal(t, big.NewInt(5), candidate.Staked)
+
+	// Canceling returns the deposit locked at registration
+	header = &types.Header{Number: big.NewInt(32)}
+	headerExtra = HeaderExtra{Epoch: 2, EpochBlock: 31}
+	e.processTransactions(current, statedb, header, snap, &headerExtra, []*types.Transaction{
+		newVoteTestTransaction(t, keys[0], "equality:1:event:delegator"),
+	})
+	assert.Equal(t, candidates[:1], headerExtra.CurrentBlockCancelCandidates)
+	assert.Equal(t, big.NewInt(10), statedb.GetBalance(candidates[0]))
+}
+
+func TestCandidateExit(t *testing.T) {
+	var keys []*ecdsa.PrivateKey
+	var validators []common.Address
+	for i := 0; i < 3; i++ {
+		key, _ := crypto.GenerateKey()
+		keys = append(keys, key)
+		validators = append(validators, crypto.PubkeyToAddress(key.PublicKey))
+	}
+	others := []common.Address{common.HexToAddress("0x01"), common.HexToAddress("0x02")}
+	recipient := common.HexToAddress("0x03")
+	exiting := validators[0]
+
+	db := rawdb.NewMemoryDatabase()
+	statedb, err := state.New(common.Hash{}, state.NewDatabase(db), nil)
+	assert.Nil(t, err)
+	config := params.EqualityConfig{Period: 3, Epoch: 30, MaxValidatorsCount: 3, MinCandidateBalance: big.NewInt(5),
+		SlashRatio: 100, SlashRecipient: &recipient, CandidateExitBlock: big.NewInt(1)}
+	e := New(&config, db)
+
+	// The block producer mines and a verifier replays the header extras
+	newParent := func() *Snapshot {
+		snap, err := newSnapshot(db)
+		assert.Nil(t, err)
+		assert.Nil(t, snap.SetChainConfig(config))
+		for _, candidate := range append(append([]common.Address{}, validators...), others...) {
+			_, err = snap.BecomeCandidate(candidate, 1, big.NewInt(5))
+			assert.Nil(t, err)
+		}
+		assert.Nil(t, snap.SetValidators(validators))
+		return snap
+	}
+	mined, replayed := newParent(), newParent()
+	mine := func(number uint64, coinbase common.Address, headerExtra HeaderExtra, txs ...*types.Transaction) HeaderExtra {
+		header := &types.Header{Number: new(big.Int).SetUint64(number), Coinbase: coinbase, ParentHash: common.HexToHash("0x01")}
+		assert.Nil(t, mined.MintBlock(headerExtra.Epoch, number, coinbase))
+		e.processTransactions(config, statedb, header, mined, &headerExtra, txs)
+		assert.Nil(t, e.tryElect(config, statedb, header, mined, &headerExtra, nil))
+
+		assert.Nil(t, replayed.apply(config, header, headerExtra))
+		have, err := replayed.Root()
+		assert.Nil(t, err)
+		want, err := mined.Root()
+		assert.Nil(t, err)
+		assert.Equal(t, want, have, "block %d", number)
+		return headerExtra
+	}
+
+	// The validator cancels mid-epoch and keeps sealing with its deposit locked
+	for number := uint64(2); number <= 30; number++ {
+		coinbase := validators[1+number%2]
+		var txs []*types.Transaction
+		switch number {
+		case 10:
+			txs = append(txs, newVoteTestTransaction(t, keys[0], "equality:1:event:delegator"))
+		case 11, 12:
+			coinbase = exiting
+		}
+		headerExtra := mine(number, coinbase, HeaderExtra{Epoch: 1, EpochBlock: 1}, txs...)
+		if number == 10 {
+			assert.Equal(t, []common.Address{exiting}, headerExtra.CurrentBlockCancelCandidates)
+		}
+	}
+	candidate, err := mined.GetCandidate(exiting)
+	assert.Nil(t, err)
+	assert.True(t, candidate.Exiting)
+	assert.Equal(t, big.NewInt(5), candidate.Staked)
+	assert.Equal(t, 0, statedb.GetBalance(exiting).Sign())
+
+	// It leaves at the transition with its deposit, instead of being kicked
+	// out and slashed for its few blocks
+	headerExtra := mine(31, validators[1], HeaderExtra{Epoch: 2, EpochBlock: 31})
+	assert.Empty(t, headerExtra.CurrentBlockKickOutCandidates)
+	assert.Equal(t, 3, len(headerExtra.CurrentEpochValidators))
+	assert.False(t, addressesExist(headerExtra.CurrentEpochValidators, exiting))
+	candidate, err = mined.GetCandidate(exiting)
+	assert.Nil(t, err)
+	assert.Nil(t, candidate)
+	assert.Equal(t, big.NewInt(5), statedb.GetBalance(exiting))
+	assert.Equal(t, 0, statedb.GetBalance(recipient).Sign())
+}
+
+func TestAccumulateRewards(t *testing.T) {
+	pool := common.HexToAddress("0x44d1ce0b7cb3588bca96151fe1bc05af38f91b6c")
+	coinbase := common.HexToAddress("0xcc7c8317b21e1cea6139700c3c46c21af998d14c")
+	config := params.EqualityConfig{Pool: pool, Rewards: []params.EqualityReward{
+		{Number: 10, Reward: big.NewInt(800)},
+		{Number: 20, Reward: big.NewInt(400)},
+		{Number: 30, Reward: big.NewInt(0)},
+	}}
+	assert.Nil(t, (&params.EqualityConfig{Period: 3, Epoch: 30, MaxValidatorsCount: 3, MinCandidateBalance: big.NewInt(0),
+		Rewards: config.Rewards}).Validate())
+
+	// The reward changes right after the last block of a rule
+	tests := []struct {
+		number uint64
+		reward int64
+	}{
+		{1, 800}, {10, 800}, {11, 400}, {20, 400}, {21, 0}, {30, 0}, {31, 0},
+	}
+	e := New(&config, rawdb.NewMemoryDatabase())
+	for _, test := range tests {
+		statedb, err := state.New(common.Hash{}, state.NewDatabase(rawdb.NewMemoryDatabase()), nil)
+		assert.Nil(t, err)
+		header := &types.Header{Number: new(big.Int).SetUint64(test.number), Coinbase: coinbase}
+		e.accumulateRewards(config, statedb, header, nil)
+		assert.Equal(t, test.reward/10, statedb.GetBalance(coinbase).Int64(), "block %d", test.number)
+		assert.Equal(t, test.reward-test.reward/10, statedb.GetBalance(pool).Int64(), "block %d", test.number)
+	}
+
+	// The blocks after the schedule keep the last reward
+	config.Rewards = config.Rewards[:2]
+	assert.Equal(t, big.NewInt(400), blockReward(config, 1000))
+	assert.Nil(t, blockReward(params.EqualityConfig{}, 1))
+}
+
+func TestCommunityReward(t *testing.T) {
+	pool := common.HexToAddress("0x44d1ce0b7cb3588bca96151fe1bc05af38f91b6c")
+	coinbase := common.HexToAddress("0xcc7c8317b21e1cea6139700c3c46c21af998d14c")
+	community := common.HexToAddress("0x6c4ab069affd856bb915ee93cb59370574f5331e")
+
+	tests := []struct {
+		reward    int64
+		rate      uint64
+		address   *common.Address
+		coinbase  int64
+		community int64
+	}{
+		{1000, 0, &community, 100, 0},
+		{1000, 10000, &community, 0, 100},
+		{1000, 2500, &community, 75, 25},
+		// Odd wei of the community share are left to the coinbase
+		{1017, 3333, &community, 68, 33},
+		{1000, 5000, nil, 100, 0},
+	}
+	for _, test := range tests {
+		statedb, err := state.New(common.Hash{}, state.NewDatabase(rawdb.NewMemoryDatabase()), nil)
+		assert.Nil(t, err)
+
+		config := params.EqualityConfig{Pool: pool, CommunityRate: test.rate, CommunityAddress: test.address,
+			Rewards: []params.EqualityReward{{Number: 10, Reward: big.NewInt(test.reward)}}}
+		e := New(&config, rawdb.NewMemoryDatabase())
+		e.accumulateRewards(config, statedb, &types.Header{Number: big.NewInt(1), Coinbase: coinbase}, nil)
+		assert.Equal(t, test.coinbase, statedb.GetBalance(coinbase).Int64(), "reward %d rate %d", test.reward, test.rate)
+		assert.Equal(t, test.community, statedb.GetBalance(community).Int64(), "reward %d rate %d", test.reward, test.rate)
+		assert.Equal(t, test.reward-test.reward/10, statedb.GetBalance(pool).Int64(), "reward %d rate %d", test.reward, test.rate)
+	}
+}
+
+// TestSealerRewardWithFees checks the balances after a block carrying a
+// transaction: the sealer earns the gas fees at the gas price on top of its
+// share of the block reward. The chain predates the london fork, no base fee
+// is burned.
+func TestSealerRewardWithFees(t *testing.T) {
+	key, _ := crypto.GenerateKey()
+	validator := crypto.PubkeyToAddress(key.PublicKey)
+	pool := common.HexToAddress("0x44d1ce0b7cb3588bca96151fe1bc05af38f91b6c")
+	recipient := common.HexToAddress("0x6c4ab069affd856bb915ee93cb59370574f5331e")
+	config := *params.AllEthashProtocolChanges
+	config.Ethash = nil
+	config.Equality = &params.EqualityConfig{Epoch: 3, MaxValidatorsCount: 1, MinCandidateBalance: big.NewInt(0),
+		Validators: []common.Address{validator}, Pool: pool, Rewards: []params.EqualityReward{{Number: 100, Reward: big.NewInt(1000)}}}
+
+	db := rawdb.NewMemoryDatabase()
+	headerExtra, err := GenesisHeaderExtra(*config.Equality, db)
+	assert.Nil(t, err)
+	extra, err := EncodeHeaderExtra(nil, headerExtra)
+	assert.Nil(t, err)
+	funds := big.NewInt(params.Ether)
+	genesis := core.Genesis{Config: &config, GasLimit: params.GenesisGasLimit, ExtraData: extra,
+		Alloc: core.GenesisAlloc{testUserAddress: {Balance: funds}}}
+	genesis.MustCommit(db)
+	engine := New(config.Equality, db)
+	engine.SetAllowedFutureDrift(0)
+	chain, err := core.NewBlockChain(db, nil, &config, engine, vm.Config{}, nil, nil)
+	assert.Nil(t, err)
+
+	parent := chain.CurrentBlock()
+	header := &types.Header{ParentHash: parent.Hash(), Number: big.NewInt(1), GasLimit: parent.GasLimit(), Coinbase: validator}
+	assert.Nil(t, engine.Prepare(chain, header))
+	statedb, err := chain.StateAt(parent.Root())
+	assert.Nil(t, err)
+	value, gasPrice := big.NewInt(5000), big.NewInt(3)
+	tx, err := types.SignTx(types.NewTransaction(0, recipient, value, params.TxGas, gasPrice, nil),
+		types.NewEIP155Signer(config.ChainID), testUserKey)
+	assert.Nil(t, err)
+	receipt, err := core.ApplyTransaction(&config, chain, &header.Coinbase, new(core.GasPool).AddGas(header.GasLimit),
+		statedb, header, tx, &header.GasUsed, vm.Config{})
+	assert.Nil(t, err)
+	block, err := engine.FinalizeAndAssemble(chain, header, statedb, []*types.Transaction{tx}, nil, []*types.Receipt{receipt})
+	assert.Nil(t, err)
+	sealed := block.Header()
+	signature, err := crypto.Sign(SealHash(sealed).Bytes(), key)
+	assert.Nil(t, err)
+	copy(sealed.Extra[len(sealed.Extra)-ExtraSeal:], signature)
+	_, err = chain.InsertChain(types.Blocks{block.WithSeal(sealed)})
+	assert.Nil(t, err)
+
+	// The gas fees paid by the sender all go to the sealer
+	fees := new(big.Int).Mul(new(big.Int).SetUint64(params.TxGas), gasPrice)
+	final, err := chain.State()
+	assert.Nil(t, err)
+	assert.Equal(t, new(big.Int).Add(big.NewInt(100), fees), final.GetBalance(validator))
+	assert.Equal(t, big.NewInt(900), final.GetBalance(pool))
+	assert.Equal(t, value, final.GetBalance(recipient))
+	assert.Equal(t, new(big.Int).Sub(funds, new(big.Int).Add(value, fees)), final.GetBalance(testUserAddress))
+}
+
+func TestSlashCandidate(t *testing.T) {
+	candidate := common.HexToAddress("0xcc7c8317b21e1cea6139700c3c46c21af998d14c")
+	recipient := common.HexToAddress("0x44d1ce0b7cb3588bca96151fe1bc05af38f91b6c")
+
+	tests := []struct {
+		ratio     uint64
+		recipient *common.Address
+		security  int64
+		refunded  int64
+		slashed   int64
+	}{
+		// Kicked out deposits are kept back without a slash ratio
+		{0, &recipient, 101, 0, 0},
+		{50, &recipient, 101, 51, 50},
+		{33, &recipient, 1, 1, 0},
+		{30, &recipient, 1000, 700, 300},
+		{100, &recipient, 101, 0, 101},
+		{150, &recipient, 101, 0, 101},
+		// Burned without a recipient
+		{50, nil, 101, 51, 0},
+	}
+	for _, test := range tests {
+		statedb, err := state.New(common.Hash{}, state.NewDatabase(rawdb.NewMemoryDatabase()), nil)
+		assert.Nil(t, err)
+
+		config := params.EqualityConfig{SlashRatio: test.ratio, SlashRecipient: test.recipient}
+		e := New(&config, rawdb.NewMemoryDatabase())
+		e.slashCandidate(config, statedb, nil, candidate, big.NewInt(test.security))
+		assert.Equal(t, big.NewInt(test.refunded), statedb.GetBalance(candidate), "ratio %d security %d", test.ratio, test.security)
+		assert.Equal(t, big.NewInt(test.slashed), statedb.GetBalance(recipient), "ratio %d security %d", test.ratio, test.security)
+	}
+}
+
+func TestChainConfigActivation(t *testing.T) {
+	db := rawdb.NewMemoryDatabase()
+	config := params.EqualityConfig{Period: 3, Epoch: 30, MaxValidatorsCount: 3, MinCandidateBalance: big.NewInt(0)}
+	e := New(&config, db)
+
+	snap, err := newSnapshot(db)
+	assert.Nil(t, err)
+	var candidates []common.Address
+	for i := 1; i <= 6; i++ {
+		candidate := common.BigToAddress(big.NewInt(int64(i)))
+		candidates = append(candidates, candidate)
+		_, err = snap.BecomeCandidate(candidate, 1, big.NewInt(0))
+		assert.Nil(t, err)
+	}
+	assert.Nil(t, snap.SetChainConfig(config))
+
+	// A config raising the validator count is approved mid-epoch
+	scheduled := config
+	scheduled.MaxValidatorsCount = 5
+	scheduled.ActivationBlock = 45
+	current := config
+	for number := uint64(31); number <= 60; number++ {
+		headerExtra := HeaderExtra{Epoch: 2, EpochBlock: 31}
+		if number == 31 {
+			headerExtra.CurrentEpochValidators = candidates[:3]
+		}
+		if number == 40 {
+			proposal := ConfigProposal{Proposer: candidates[0], Config: scheduled}
+			headerExtra.CurrentBlockProposals = []ConfigProposal{proposal}
+			headerExtra.CurrentBlockApprovals = []ConfigApproval{{Validator: candidates[1], Proposal: proposal.Hash()}}
+			headerExtra.ChainConfig = []params.EqualityConfig{scheduled}
+		}
+		assert.Nil(t, headerExtra.Validate(number, current))
+
+		header := &types.Header{Number: new(big.Int).SetUint64(number), Coinbase: candidates[number%3]}
+		assert.Nil(t, snap.apply(current, header, headerExtra))
+		root, err := snap.Root()
+		assert.Nil(t, err)
+		assert.Nil(t, snap.Commit(root))
+
+		// The config is in effect from its activation block on
+		current, err = e.chainConfigByHash(root.ConfigHash)
+		assert.Nil(t, err)
+		pending, err := snap.GetPendingChainConfig()
+		assert.Nil(t, err)
+		if number+1 < scheduled.ActivationBlock {
+			assert.Equal(t, uint64(3), current.MaxValidatorsCount)
+			assert.Equal(t, number >= 40, pending != nil)
+		} else {
+			assert.Equal(t, uint64(5), current.MaxValidatorsCount)
+			assert.Nil(t, pending)
+		}
+
+		// The validators are not changed until the next election
+		validators, err := snap.GetValidators()
+		assert.Nil(t, err)
+		assert.Equal(t, candidates[:3], validators)
+	}
+
+	header := &types.Header{Number: big.NewInt(61), ParentHash: common.HexToHash("0x01")}
+	headerExtra := HeaderExtra{Epoch: 3, EpochBlock: 61}
+	assert.Nil(t, e.tryElect(current, nil, header, snap, &headerExtra, nil))
+	assert.Equal(t, 5, len(headerExtra.CurrentEpochValidators))
+
+	// Configs must take effect at a later block
+	headerExtra = HeaderExtra{Epoch: 3, EpochBlock: 61, ChainConfig: []params.EqualityConfig{scheduled}}
+	assert.True(t, errors.Is(headerExtra.Validate(62, current), errPastActivation))
+	scheduled.ActivationBlock = 63
+	headerExtra.ChainConfig = []params.EqualityConfig{scheduled}
+	assert.Nil(t, headerExtra.Validate(62, current))
+}
@@ -0,0 +1,251 @@
+package equality
+
+import (
+	"encoding/binary"
+	"sync"
+	"time"
+
+	"github.com/SecretBlockChain/go-secret/common"
+	"github.com/SecretBlockChain/go-secret/core/types"
+	"github.com/SecretBlockChain/go-secret/ethdb"
+	"github.com/SecretBlockChain/go-secret/log"
+	"github.com/SecretBlockChain/go-secret/rlp"
+)
+
+var (
+	faultPrefix  = []byte("equality-fault-")      // key: equality-fault-{slot}:{consensusFault}
+	faultHeadKey = []byte("equality-fault-count") // key: equality-fault-count:{records written}
+)
+
+const (
+	maxConsensusFaults  = 1024        // Number of fault records kept, a new one overwrites the oldest
+	faultQueueSize      = 64          // Number of fault records waiting to be written, the ones beyond are dropped
+	faultRecordInterval = time.Second // Interval the fault records are rate limited over
+	faultRecordBurst    = 16          // Number of fault records written at most an interval
+)
+
+// The rules violated by the blocks failing the equality verification.
+const (
+	faultBadRoot             = "bad root"
+	faultUnauthorizedSigner  = "unauthorized signer"
+	faultInvalidKickOut      = "invalid kick-out list"
+	faultHeaderExtraMismatch = "header extra mismatch"
+)
+
+// faultField is a field of a faulty block differing from the locally computed
+// value.
+type faultField struct {
+	Field   string
+	Ours    string
+	Theirs  string
+	Added   []common.Address // Addresses of the block missing in the computed ones
+	Removed []common.Address // Addresses computed missing in the ones of the block
+}
+
+// consensusFault is the evidence of a block failing the equality verification,
+// kept for post-mortems in a capped table: the rule violated, the addresses
+// offending it and the values computed locally.
+type consensusFault struct {
+	Sequence  uint64           // Position of the record among the ones ever written
+	Number    uint64           // Number of the faulty block
+	Hash      common.Hash      // Hash of the faulty block
+	Rule      string           // Rule violated by the block
+	Reason    string           // Error the verification failed with
+	Addresses []common.Address // Signer of the block or validators kicked out wrongly
+	Fields    []faultField     // Values of the block differing from the computed ones
+	Time      uint64           // Unix time the fault was recorded at
+}
+
+// faultKey returns the database key of the fault record of sequence.
+func faultKey(sequence uint64) []byte {
+	key := make([]byte, len(faultPrefix)+8)
+	copy(key, faultPrefix)
+	binary.BigEndian.PutUint64(key[len(faultPrefix):], sequence%maxConsensusFaults)
+	return key
+}
+
+// readFaultCount retrieves the number of fault records ever written.
+func readFaultCount(db ethdb.KeyValueReader) uint64 {
+	data, err := db.Get(faultHeadKey)
+	if err != nil || len(data) != 8 {
+		return 0
+	}
+	return binary.BigEndian.Uint64(data)
+}
+
+// readFault retrieves the fault record of sequence, nil if overwritten or not
+// recorded.
+func readFault(db ethdb.KeyValueReader, sequence uint64) *consensusFault {
+	data, err := db.Get(faultKey(sequence))
+	if err != nil || len(data) == 0 {
+		return nil
+	}
+	fault := new(consensusFault)
+	if err = rlp.DecodeBytes(data, fault); err != nil {
+		log.Warn("[equality] Invalid consensus fault record", "sequence", sequence, "err", err)
+		return nil
+	}
+	if fault.Sequence != sequence {
+		return nil
+	}
+	return fault
+}
+
+// faultRecorder writes the fault records of the blocks failing verification
+// in the background, so the import path never waits for the database. The
+// records beyond the burst of an interval or a full queue are dropped.
+type faultRecorder struct {
+	db      ethdb.Database
+	queue   chan consensusFault
+	quit    <-chan struct{}
+	start   sync.Once
+	pending sync.WaitGroup // Records queued and not written yet
+	window  time.Time      // Start of the rate limiting interval
+	count   int            // Records queued in the interval
+	dropped uint64         // Records dropped since the last one queued
+	now     func() time.Time
+	lock    sync.Mutex
+}
+
+// newFaultRecorder creates a recorder writing to db until quit is closed.
+func newFaultRecorder(db ethdb.Database, quit <-chan struct{}) *faultRecorder {
+	return &faultRecorder{
+		db:    db,
+		queue: make(chan consensusFault, faultQueueSize),
+		quit:  quit,
+		now:   time.Now,
+	}
+}
+
+// record queues fault to be written, without waiting.
+func (recorder *faultRecorder) record(fault consensusFault) {
+	recorder.lock.Lock()
+	defer recorder.lock.Unlock()
+
+	now := recorder.now()
+	if now.Sub(recorder.window) >= faultRecordInterval {
+		recorder.window, recorder.count = now, 0
+	}
+	if recorder.count >= faultRecordBurst {
+		recorder.dropped++
+		return
+	}
+	fault.Time = uint64(now.Unix())
+
+	recorder.start.Do(func() { go recorder.loop() })
+	recorder.pending.Add(1)
+	select {
+	case recorder.queue <- fault:
+		recorder.count++
+		if recorder.dropped > 0 {
+			log.Warn("[equality] Consensus fault records dropped", "count", recorder.dropped)
+			recorder.dropped = 0
+		}
+	default:
+		recorder.pending.Done()
+		recorder.dropped++
+	}
+}
+
+// loop writes the queued fault records until the engine is closed.
+func (recorder *faultRecorder) loop() {
+	for {
+		select {
+		case fault := <-recorder.queue:
+			if err := recorder.write(fault); err != nil {
+				log.Warn("[equality] Failed to write consensus fault record", "number", fault.Number, "rule", fault.Rule, "err", err)
+			}
+			recorder.pending.Done()
+		case <-recorder.quit:
+			return
+		}
+	}
+}
+
+// write stores fault after the records written, overwriting the oldest one if
+// the table is full.
+func (recorder *faultRecorder) write(fault consensusFault) error {
+	fault.Sequence = readFaultCount(recorder.db)
+	data, err := rlp.EncodeToBytes(fault)
+	if err != nil {
+		return err
+	}
+	count := make([]byte, 8)
+	binary.BigEndian.PutUint64(count, fault.Sequence+1)
+
+	batch := recorder.db.NewBatch()
+	if err = batch.Put(faultKey(fault.Sequence), data); err != nil {
+		return err
+	}
+	if err = batch.Put(faultHeadKey, count); err != nil {
+		return err
+	}
+	return batch.Write()
+}
+
+// wait blocks until the queued fault records are written.
+func (recorder *faultRecorder) wait() {
+	recorder.pending.Wait()
+}
+
+// faults returns the kept fault records, the latest first, at most limit of
+// them if limit is positive.
+func (recorder *faultRecorder) faults(limit int) []consensusFault {
+	count := readFaultCount(recorder.db)
+	var result []consensusFault
+	for sequence := count; sequence > 0 && count-sequence < maxConsensusFaults; sequence-- {
+		if limit > 0 && len(result) >= limit {
+			break
+		}
+		if fault := readFault(recorder.db, sequence-1); fault != nil {
+			result = append(result, *fault)
+		}
+	}
+	return result
+}
+
+// recordFault records the block of header violating rule with err, the
+// addresses offending it and the fields of diff it differs from the locally
+// computed values in.
+func (e *Equality) recordFault(rule string, header *types.Header, err error, addresses []common.Address, diff HeaderExtraDifference) {
+	fault := consensusFault{
+		Number:    header.Number.Uint64(),
+		Hash:      header.Hash(),
+		Rule:      rule,
+		Addresses: addresses,
+	}
+	if err != nil {
+		fault.Reason = err.Error()
+	}
+	for _, field := range diff {
+		fault.Fields = append(fault.Fields, faultField(field))
+	}
+	e.faults.record(fault)
+}
+
+// recordHeaderExtraFault records the block of header whose header extra
+// differs in diff from the one replayed locally, an invalid kick-out list if
+// the kicked out validators differ.
+func (e *Equality) recordHeaderExtraFault(header *types.Header, diff HeaderExtraDifference) {
+	rule, addresses := faultHeaderExtraMismatch, []common.Address(nil)
+	for _, field := range diff {
+		if field.Field == "currentBlockKickOutCandidates" {
+			rule = faultInvalidKickOut
+			addresses = append(append(addresses, field.Added...), field.Removed...)
+		}
+	}
+	if rule == faultHeaderExtraMismatch {
+		addresses = e.faultSigner(header)
+	}
+	e.recordFault(rule, header, nil, addresses, diff)
+}
+
+// faultSigner returns the signer of the faulty block of header, none if the
+// seal doesn't recover one.
+func (e *Equality) faultSigner(header *types.Header) []common.Address {
+	signer, err := ecrecover(header, e.signatures)
+	if err != nil {
+		return nil
+	}
+	return []common.Address{signer}
+}
@@ -0,0 +1,135 @@
+package equality
+
+import (
+	"crypto/ecdsa"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/SecretBlockChain/go-secret/common"
+	"github.com/SecretBlockChain/go-secret/core/rawdb"
+	"github.com/SecretBlockChain/go-secret/core/types"
+	"github.com/SecretBlockChain/go-secret/crypto"
+	"github.com/SecretBlockChain/go-secret/params"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConsensusFaults(t *testing.T) {
+	key, _ := crypto.GenerateKey()
+	validator := crypto.PubkeyToAddress(key.PublicKey)
+	outsider, _ := crypto.GenerateKey()
+	stranger := common.HexToAddress("0xa000000000000000000000000000000000000000")
+	config := *params.AllEthashProtocolChanges
+	config.Ethash = nil
+	config.Equality = &params.EqualityConfig{Epoch: 3, MaxValidatorsCount: 1, MinCandidateBalance: big.NewInt(0),
+		Validators: []common.Address{validator}}
+
+	db := rawdb.NewMemoryDatabase()
+	chain, engine := newTestBlockChain(t, db, &config, key)
+	_, err := chain.InsertChain(types.Blocks{sealTestBlock(t, chain, engine, key)})
+	assert.Nil(t, err)
+
+	// forge returns the next block with its header extra modified by update,
+	// sealed by signer
+	forge := func(update func(*HeaderExtra), signer *ecdsa.PrivateKey) *types.Block {
+		block := sealTestBlock(t, chain, engine, key)
+		header := block.Header()
+		headerExtra, err := DecodeHeaderExtra(header)
+		assert.Nil(t, err)
+		update(&headerExtra)
+		header.Extra, err = EncodeHeaderExtra(header.Extra[:ExtraVanity], headerExtra)
+		assert.Nil(t, err)
+		signature, err := crypto.Sign(SealHash(header).Bytes(), signer)
+		assert.Nil(t, err)
+		copy(header.Extra[len(header.Extra)-ExtraSeal:], signature)
+		return block.WithSeal(header)
+	}
+
+	// Each fault class is recorded once written. The kick-out list is only
+	// checked as Finalize replays the block, resetting its state, which the
+	// empty state of the test chain doesn't fail the import for
+	blocks := []*types.Block{
+		forge(func(headerExtra *HeaderExtra) { headerExtra.Root.MintCntHash = common.HexToHash("0x01") }, key),
+		forge(func(*HeaderExtra) {}, outsider),
+		forge(func(headerExtra *HeaderExtra) { headerExtra.CurrentBlockKickOutCandidates = []common.Address{stranger} }, key),
+	}
+	for idx, block := range blocks {
+		_, err = chain.InsertChain(types.Blocks{block})
+		if idx < 2 {
+			assert.NotNil(t, err)
+		}
+	}
+	engine.faults.wait()
+
+	faults := engine.faults.faults(0)
+	if !assert.Len(t, faults, 3) {
+		return
+	}
+	kickOut, unauthorized, badRoot := faults[0], faults[1], faults[2]
+
+	assert.Equal(t, uint64(0), badRoot.Sequence)
+	assert.Equal(t, uint64(2), badRoot.Number)
+	assert.Equal(t, blocks[0].Hash(), badRoot.Hash)
+	assert.Equal(t, faultBadRoot, badRoot.Rule)
+	assert.Contains(t, badRoot.Reason, "root")
+	assert.Equal(t, []common.Address{validator}, badRoot.Addresses)
+	assert.Len(t, badRoot.Fields, 1)
+	assert.Equal(t, "root.mintCntHash", badRoot.Fields[0].Field)
+
+	assert.Equal(t, blocks[1].Hash(), unauthorized.Hash)
+	assert.Equal(t, faultUnauthorizedSigner, unauthorized.Rule)
+	assert.Equal(t, []common.Address{crypto.PubkeyToAddress(outsider.PublicKey)}, unauthorized.Addresses)
+	assert.Empty(t, unauthorized.Fields)
+
+	assert.Equal(t, blocks[2].Hash(), kickOut.Hash)
+	assert.Equal(t, faultInvalidKickOut, kickOut.Rule)
+	assert.Equal(t, []common.Address{stranger}, kickOut.Addresses)
+	assert.Len(t, kickOut.Fields, 1)
+	assert.Equal(t, "currentBlockKickOutCandidates", kickOut.Fields[0].Field)
+	assert.Equal(t, []common.Address{stranger}, kickOut.Fields[0].Added)
+	assert.NotZero(t, kickOut.Time)
+
+	// The records are read back through the API, the latest first
+	api := &AdminAPI{chain: chain, equality: engine}
+	recent := api.GetFaults(2)
+	assert.Len(t, recent, 2)
+	assert.Equal(t, faultInvalidKickOut, recent[0].Rule)
+	assert.Equal(t, faultUnauthorizedSigner, recent[1].Rule)
+	assert.Len(t, api.GetFaults(0), 3)
+
+	// A new engine reads the records of the database
+	assert.Len(t, New(config.Equality, db).faults.faults(0), 3)
+}
+
+func TestFaultRecorderLimits(t *testing.T) {
+	quit := make(chan struct{})
+	defer close(quit)
+	recorder := newFaultRecorder(rawdb.NewMemoryDatabase(), quit)
+	now := time.Unix(1700000000, 0)
+	recorder.now = func() time.Time { return now }
+
+	// The records beyond the burst of an interval are dropped
+	for number := uint64(0); number < faultRecordBurst+4; number++ {
+		recorder.record(consensusFault{Number: number, Rule: faultBadRoot})
+	}
+	recorder.wait()
+	faults := recorder.faults(0)
+	assert.Len(t, faults, faultRecordBurst)
+	assert.Equal(t, uint64(faultRecordBurst-1), faults[0].Number)
+	assert.Equal(t, uint64(now.Unix()), faults[0].Time)
+
+	now = now.Add(faultRecordInterval)
+	recorder.record(consensusFault{Number: 100, Rule: faultBadRoot})
+	recorder.wait()
+	assert.Equal(t, uint64(100), recorder.faults(1)[0].Number)
+
+	// The table keeps the latest records only
+	for number := uint64(0); number < maxConsensusFaults; number++ {
+		assert.Nil(t, recorder.write(consensusFault{Number: 1000 + number}))
+	}
+	faults = recorder.faults(0)
+	assert.Len(t, faults, maxConsensusFaults)
+	assert.Equal(t, uint64(faultRecordBurst+maxConsensusFaults), faults[0].Sequence)
+	assert.Equal(t, uint64(1000+maxConsensusFaults-1), faults[0].Number)
+	assert.Equal(t, uint64(1000), faults[maxConsensusFaults-1].Number)
+}
@@ -0,0 +1,138 @@
+package equality
+
+import (
+	"sync"
+
+	"github.com/SecretBlockChain/go-secret/common"
+	"github.com/SecretBlockChain/go-secret/consensus"
+	"github.com/SecretBlockChain/go-secret/core/types"
+)
+
+// maxFinalityDepth is the max number of blocks searched back from the head for
+// the finalized block.
+const maxFinalityDepth = 4096
+
+// finalizedBlock is the finalized block of a chain head.
+type finalizedBlock struct {
+	head   common.Hash // Head the block is finalized at
+	number uint64
+	hash   common.Hash
+}
+
+// finalityTracker holds the finalized block of the latest chain head, the
+// search of the next head stops at it.
+type finalityTracker struct {
+	last *finalizedBlock
+	lock sync.Mutex
+}
+
+// finalityQuorum returns whether signers out of validators finalize a block,
+// more than two thirds of them.
+func finalityQuorum(signers, validators int) bool {
+	return validators > 0 && 3*signers > 2*validators
+}
+
+// finalize returns the finalized block of the chain of head: the latest block
+// more than two thirds of the validators of its epoch sealed blocks on top of,
+// the genesis block if none. The sealers of a following epoch count for the
+// block as long as they are validators of its epoch, a block at the end of an
+// epoch electing new validators may never be finalized itself but is once a
+// descendant is. The search goes back at most maxFinalityDepth blocks and
+// stops at the finalized block of the previous head if an ancestor of head,
+// the sealers on top of it only grow.
+func (e *Equality) finalize(chain consensus.ChainHeaderReader, head *types.Header) (*finalizedBlock, error) {
+	e.finality.lock.Lock()
+	defer e.finality.lock.Unlock()
+
+	last := e.finality.last
+	if last != nil && last.head == head.Hash() {
+		return last, nil
+	}
+
+	var (
+		sealers    = NewAddressSet() // Sealers of the blocks on top of header
+		validators []common.Address  // Validators of the epoch of header
+		epochBlock uint64            // Transition block of the epoch of validators
+		found      *finalizedBlock
+	)
+	for header, depth := head, 0; ; depth++ {
+		number := header.Number.Uint64()
+		if last != nil && last.number == number && last.hash == header.Hash() {
+			found = &finalizedBlock{head: head.Hash(), number: last.number, hash: last.hash}
+			break
+		}
+		if number == 0 || depth >= maxFinalityDepth {
+			found = &finalizedBlock{head: head.Hash()}
+			if genesis := chain.GetHeaderByNumber(0); genesis != nil {
+				found.hash = genesis.Hash()
+			}
+			break
+		}
+
+		headerExtra, err := e.DecodeHeaderExtraCached(header)
+		if err != nil {
+			return nil, err
+		}
+		if validators == nil || headerExtra.EpochBlock != epochBlock {
+			if validators, err = e.epochValidatorsOf(chain, header, headerExtra); err != nil {
+				return nil, err
+			}
+			epochBlock = headerExtra.EpochBlock
+		}
+		signers := 0
+		for _, validator := range validators {
+			if sealers.Contains(validator) {
+				signers++
+			}
+		}
+		if finalityQuorum(signers, len(validators)) {
+			found = &finalizedBlock{head: head.Hash(), number: number, hash: header.Hash()}
+			break
+		}
+
+		sealers.Add(header.Coinbase)
+		if header = chain.GetHeader(header.ParentHash, number-1); header == nil {
+			return nil, errUnknownBlock
+		}
+	}
+	e.finality.last = found
+	return found, nil
+}
+
+// epochValidatorsOf returns the validators of the epoch of header, elected at
+// its transition block.
+func (e *Equality) epochValidatorsOf(chain consensus.ChainHeaderReader, header *types.Header,
+	headerExtra HeaderExtra) ([]common.Address, error) {
+
+	if headerExtra.EpochBlock != header.Number.Uint64() {
+		if header = chain.GetHeaderByNumber(headerExtra.EpochBlock); header == nil {
+			return nil, errUnknownBlock
+		}
+		var err error
+		if headerExtra, err = e.DecodeHeaderExtraCached(header); err != nil {
+			return nil, err
+		}
+	}
+	return headerExtra.CurrentEpochValidators, nil
+}
+
+// TrackFinality brings the finalized block up to the chain head, the search
+// of the following heads starts over from it.
+func (e *Equality) TrackFinality(chain consensus.ChainHeaderReader, head *types.Header) error {
+	_, err := e.finalize(chain, head)
+	return err
+}
+
+// FinalizedHeader returns the header of the finalized block of the current
+// head of chain, nil if unknown.
+func (e *Equality) FinalizedHeader(chain consensus.ChainHeaderReader) *types.Header {
+	head := chain.CurrentHeader()
+	if head == nil {
+		return nil
+	}
+	finalized, err := e.finalize(chain, head)
+	if err != nil {
+		return nil
+	}
+	return chain.GetHeader(finalized.hash, finalized.number)
+}
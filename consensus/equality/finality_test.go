@@ -0,0 +1,87 @@
+package equality
+
+import (
+	"testing"
+
+	"github.com/SecretBlockChain/go-secret/common"
+	"github.com/SecretBlockChain/go-secret/core/rawdb"
+	"github.com/SecretBlockChain/go-secret/core/types"
+	"github.com/SecretBlockChain/go-secret/params"
+	"github.com/SecretBlockChain/go-secret/rpc"
+	"github.com/stretchr/testify/assert"
+)
+
+// appendTestFinalityHeader appends the header of headerExtra sealed by sealer
+// to chain.
+func appendTestFinalityHeader(chain *testHeaderChain, headerExtra HeaderExtra, sealer common.Address) {
+	number := uint64(len(chain.headers))
+	header := newTestHeader(number, headerExtra)
+	header.ParentHash = chain.headers[number-1].Hash()
+	header.Coinbase = sealer
+	chain.headers = append(chain.headers, header)
+}
+
+func TestFinalizedBlock(t *testing.T) {
+	validatorA := common.HexToAddress("0xa000000000000000000000000000000000000000")
+	validatorB := common.HexToAddress("0xb000000000000000000000000000000000000000")
+	validatorC := common.HexToAddress("0xc000000000000000000000000000000000000000")
+	validatorD := common.HexToAddress("0xd000000000000000000000000000000000000000")
+	validatorE := common.HexToAddress("0xe000000000000000000000000000000000000000")
+	validatorF := common.HexToAddress("0xf000000000000000000000000000000000000000")
+	validatorG := common.HexToAddress("0x1000000000000000000000000000000000000000")
+
+	config := params.EqualityConfig{Epoch: 6}
+	e := New(&config, rawdb.NewMemoryDatabase())
+	chain := &testHeaderChain{headers: []*types.Header{newTestHeader(0, HeaderExtra{})}}
+	api := &API{chain: chain, equality: e}
+	finalized := func() uint64 {
+		result, err := api.GetFinalizedBlock()
+		assert.Nil(t, err)
+		assert.Equal(t, chain.headers[result.Number].Hash(), result.Hash)
+		return uint64(result.Number)
+	}
+
+	// Validator D is offline, the three others finalize a block once all of
+	// them sealed one on top of it
+	first := HeaderExtra{Epoch: 1, EpochBlock: 1, CurrentEpochValidators: []common.Address{validatorA, validatorB, validatorC, validatorD}}
+	appendTestFinalityHeader(chain, first, validatorA)
+	for _, sealer := range []common.Address{validatorB, validatorC, validatorA, validatorB, validatorC} {
+		appendTestFinalityHeader(chain, HeaderExtra{Epoch: 1, EpochBlock: 1}, sealer)
+		head := uint64(len(chain.headers) - 1)
+		if head < 3 {
+			assert.Equal(t, uint64(0), finalized(), "head %d", head)
+		} else {
+			assert.Equal(t, head-3, finalized(), "head %d", head)
+		}
+	}
+	sealed := len(chain.headers)
+
+	// The sealers of the next epoch only count for the blocks of the previous
+	// one if they were its validators as well
+	second := HeaderExtra{Epoch: 2, EpochBlock: 7, CurrentEpochValidators: []common.Address{validatorA, validatorE, validatorF, validatorG}}
+	appendTestFinalityHeader(chain, second, validatorA)
+	assert.Nil(t, e.TrackFinality(chain, chain.CurrentHeader()))
+	assert.Equal(t, uint64(4), finalized())
+	for _, sealer := range []common.Address{validatorE, validatorF} {
+		appendTestFinalityHeader(chain, HeaderExtra{Epoch: 2, EpochBlock: 7}, sealer)
+		assert.Equal(t, uint64(4), finalized())
+	}
+	appendTestFinalityHeader(chain, HeaderExtra{Epoch: 2, EpochBlock: 7}, validatorG)
+	assert.Equal(t, uint64(7), finalized())
+
+	at := rpc.FinalizedBlockNumber
+	header, err := api.header(&at)
+	assert.Nil(t, err)
+	assert.Equal(t, chain.headers[7].Hash(), header.Hash())
+	assert.Equal(t, chain.headers[7].Hash(), e.FinalizedHeader(chain).Hash())
+
+	// Two validators out of four never finalize a block
+	chain.headers = chain.headers[:1]
+	e = New(&config, rawdb.NewMemoryDatabase())
+	api.equality = e
+	appendTestFinalityHeader(chain, first, validatorA)
+	for i := 2; i < sealed; i++ {
+		appendTestFinalityHeader(chain, HeaderExtra{Epoch: 1, EpochBlock: 1}, []common.Address{validatorA, validatorB}[i%2])
+	}
+	assert.Equal(t, uint64(0), finalized())
+}
@@ -0,0 +1,75 @@
+package equality
+
+import (
+	"fmt"
+
+	"github.com/SecretBlockChain/go-secret/core/types"
+	"github.com/SecretBlockChain/go-secret/ethdb"
+	"github.com/SecretBlockChain/go-secret/params"
+)
+
+// GenesisHeaderExtra creates the snapshot tries of a new network in db and
+// returns the header extra to embed into its genesis header: the epoch trie
+// holds the genesis validators, the config trie the genesis config, the
+// candidate and mint count tries are empty.
+func GenesisHeaderExtra(config params.EqualityConfig, db ethdb.Database) (HeaderExtra, error) {
+	config.ActivationBlock = 0
+	if err := validateChainConfig(config); err != nil {
+		return HeaderExtra{}, err
+	}
+
+	snap, err := newSnapshot(db)
+	if err != nil {
+		return HeaderExtra{}, err
+	}
+	if err = snap.SetValidators(config.Validators); err != nil {
+		return HeaderExtra{}, err
+	}
+	if err = snap.SetChainConfig(config); err != nil {
+		return HeaderExtra{}, err
+	}
+	root, err := snap.Root()
+	if err != nil {
+		return HeaderExtra{}, err
+	}
+	if err = snap.Commit(root); err != nil {
+		return HeaderExtra{}, err
+	}
+
+	return HeaderExtra{
+		Root:                   root,
+		CurrentEpochValidators: config.Validators,
+		ChainConfig:            []params.EqualityConfig{config},
+	}, nil
+}
+
+// genesisRoot returns the trie roots of the genesis header, empty for the
+// genesis headers of the networks created before they carried a header extra.
+func genesisRoot(genesis *types.Header) (Root, error) {
+	if _, payload, _, err := SplitExtra(genesis.Extra); err != nil || len(payload) == 0 {
+		return Root{}, nil
+	}
+	headerExtra, err := DecodeHeaderExtra(genesis)
+	if err != nil {
+		return Root{}, err
+	}
+	return headerExtra.Root, nil
+}
+
+// VerifyGenesis checks that the trie roots embedded into the genesis header
+// are the ones created from the genesis config of the engine, the mismatching
+// roots are reported by field. Genesis headers without a header extra pass.
+func (e *Equality) VerifyGenesis(genesis *types.Header) error {
+	root, err := genesisRoot(genesis)
+	if err != nil || root == (Root{}) {
+		return err
+	}
+	headerExtra, err := GenesisHeaderExtra(*e.config, e.db)
+	if err != nil {
+		return fmt.Errorf("invalid genesis config: %w", err)
+	}
+	if headerExtra.Root != root {
+		return rootMismatchError(0, headerExtra.Root, root)
+	}
+	return nil
+}
@@ -0,0 +1,64 @@
+package equality
+
+import (
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/SecretBlockChain/go-secret/common"
+	"github.com/SecretBlockChain/go-secret/core/rawdb"
+	"github.com/SecretBlockChain/go-secret/core/types"
+	"github.com/SecretBlockChain/go-secret/params"
+	"github.com/stretchr/testify/assert"
+)
+
+// newTestGenesis returns a genesis header carrying the header extra created
+// from config.
+func newTestGenesis(t *testing.T, config params.EqualityConfig) *types.Header {
+	headerExtra, err := GenesisHeaderExtra(config, rawdb.NewMemoryDatabase())
+	assert.Nil(t, err)
+	extra, err := EncodeHeaderExtra([]byte("genesis"), headerExtra)
+	assert.Nil(t, err)
+	return &types.Header{Number: big.NewInt(0), Time: config.GenesisTimestamp, Extra: extra}
+}
+
+func TestGenesisHeaderExtra(t *testing.T) {
+	config := *params.TestnetEqualityConfig()
+	config.Validators = []common.Address{testUserAddress, common.HexToAddress("0xa000000000000000000000000000000000000000")}
+	genesis := newTestGenesis(t, config)
+
+	// The embedded header extra round trips
+	headerExtra, err := DecodeHeaderExtra(genesis)
+	assert.Nil(t, err)
+	assert.Equal(t, config.Validators, headerExtra.CurrentEpochValidators)
+	assert.Equal(t, []params.EqualityConfig{config}, headerExtra.ChainConfig)
+	assert.NotEqual(t, common.Hash{}, headerExtra.Root.EpochHash)
+	assert.NotEqual(t, common.Hash{}, headerExtra.Root.ConfigHash)
+	assert.Equal(t, common.Hash{}, headerExtra.Root.CandidateHash)
+	assert.Equal(t, common.Hash{}, headerExtra.Root.MintCntHash)
+
+	// The snapshot of the genesis block is opened at its roots
+	db := rawdb.NewMemoryDatabase()
+	e := New(&config, db)
+	assert.Nil(t, e.VerifyGenesis(genesis))
+	snap, err := e.snapshot(&testHeaderChain{config: params.TestnetChainConfig, headers: []*types.Header{genesis}}, genesis, nil)
+	assert.Nil(t, err)
+	validators, err := snap.GetValidators()
+	assert.Nil(t, err)
+	assert.Equal(t, config.Validators, validators)
+	stored, err := snap.GetChainConfig()
+	assert.Nil(t, err)
+	assert.Equal(t, config.Period, stored.Period)
+
+	// Genesis headers without a header extra pass
+	legacy := &types.Header{Number: big.NewInt(0), Extra: make([]byte, ExtraVanity+ExtraSeal)}
+	assert.Nil(t, e.VerifyGenesis(legacy))
+
+	// A genesis created from other validators fails with the epoch trie
+	other := config
+	other.Validators = config.Validators[:1]
+	err = New(&other, db).VerifyGenesis(genesis)
+	assert.True(t, errors.Is(err, errInvalidRoot))
+	assert.Contains(t, err.Error(), "epochHash")
+	assert.NotContains(t, err.Error(), "candidateHash")
+}
@@ -4,43 +4,88 @@ import (
 	"bytes"
 	"compress/gzip"
 	"fmt"
-	"io"
+	"math/big"
+	"sort"
 	"strings"
+	"time"
 
 	"github.com/SecretBlockChain/go-secret/common"
 	"github.com/SecretBlockChain/go-secret/core/types"
+	"github.com/SecretBlockChain/go-secret/crypto"
+	"github.com/SecretBlockChain/go-secret/log"
 	"github.com/SecretBlockChain/go-secret/params"
 	"github.com/SecretBlockChain/go-secret/rlp"
 )
 
-// Root is the state tree root.
+// Root is the state tree root. Its fields are append only, see HeaderExtra.
 type Root struct {
 	EpochHash     common.Hash
 	CandidateHash common.Hash
 	MintCntHash   common.Hash
 	ConfigHash    common.Hash
+	DelegateHash  common.Hash `rlp:"optional"` // Votes of delegated voting, empty without votes
 }
 
-func (root Root) PrintDifference(number uint64, other Root) {
-	slice := make([]string, 0)
-	slice = append(slice, fmt.Sprintf("BlockNumber: %d", number))
-	if root.EpochHash != other.EpochHash {
-		slice = append(slice, fmt.Sprintf("EpochHash: %s ---- %s", root.EpochHash.String(), other.EpochHash.String()))
+// rootField is a named trie root of Root.
+type rootField struct {
+	name string
+	hash common.Hash
+}
+
+// fields returns the trie roots of Root in declaration order.
+func (root Root) fields() []rootField {
+	return []rootField{
+		{"epochHash", root.EpochHash},
+		{"candidateHash", root.CandidateHash},
+		{"mintCntHash", root.MintCntHash},
+		{"configHash", root.ConfigHash},
+		{"delegateHash", root.DelegateHash},
 	}
-	if root.CandidateHash != other.CandidateHash {
-		slice = append(slice, fmt.Sprintf("CandidateHash: %s ---- %s", root.CandidateHash.String(), other.CandidateHash.String()))
+}
+
+// Difference returns the trie roots differing from other, one entry per field
+// formatted as "name: ours != theirs". Equal roots yield an empty slice.
+func (root Root) Difference(other Root) []string {
+	ours, theirs := root.fields(), other.fields()
+	slice := make([]string, 0)
+	for idx := range ours {
+		if ours[idx].hash != theirs[idx].hash {
+			slice = append(slice, fmt.Sprintf("%s: %s != %s", ours[idx].name, ours[idx].hash.String(), theirs[idx].hash.String()))
+		}
 	}
-	if root.MintCntHash != other.MintCntHash {
-		slice = append(slice, fmt.Sprintf("MintCntHash: %s ---- %s", root.MintCntHash.String(), other.MintCntHash.String()))
+	return slice
+}
+
+// LogDifference logs the trie roots differing from other at warn level, one
+// key/value pair per field. Nothing is logged when the roots are equal.
+func (root Root) LogDifference(logger log.Logger, number uint64, other Root) {
+	ours, theirs := root.fields(), other.fields()
+	ctx := []interface{}{"number", number}
+	for idx := range ours {
+		if ours[idx].hash != theirs[idx].hash {
+			ctx = append(ctx, ours[idx].name, fmt.Sprintf("%s != %s", ours[idx].hash.String(), theirs[idx].hash.String()))
+		}
 	}
-	if root.ConfigHash != other.ConfigHash {
-		slice = append(slice, fmt.Sprintf("ConfigHash: %s ---- %s", root.ConfigHash.String(), other.ConfigHash.String()))
+	if len(ctx) > 2 {
+		logger.Warn("[equality] Root hash difference", ctx...)
 	}
-	fmt.Printf("######### Root Hash Difference #########\n%s\n", strings.Join(slice, "\n"))
 }
 
-// HeaderExtra is the struct of info in header.Extra[extraVanity:len(header.extra)-extraSeal].
+// rootMismatchError returns errInvalidRoot annotated with the trie roots of the
+// block at number differing from the locally computed ones.
+func rootMismatchError(number uint64, ours, theirs Root) error {
+	return fmt.Errorf("%w at block %d: %s", errInvalidRoot, number, strings.Join(ours.Difference(theirs), ", "))
+}
+
+// HeaderExtra is the struct of info in header.Extra[ExtraVanity:len(header.extra)-ExtraSeal].
 // HeaderExtra is the current struct.
+//
+// The fields are rlp encoded in declaration order and append only, as are the
+// ones of the types it is made of: a new field goes at the end with the rlp
+// optional tag, so the header extras of existing blocks, lacking it, decode
+// with its zero value and the header extras leaving it unset keep their
+// encoding. Fields are never inserted, reordered or removed,
+// TestHeaderExtraLayout pins their order.
 type HeaderExtra struct {
 	Root                          Root
 	Epoch                         uint64
@@ -50,53 +95,281 @@ type HeaderExtra struct {
 	CurrentBlockCancelCandidates  []common.Address
 	CurrentEpochValidators        []common.Address
 	ChainConfig                   []params.EqualityConfig
+
+	// Fields below were appended for delegated voting, they are optional in
+	// rlp so HeaderExtras without votes keep their encoding.
+	CurrentBlockVotes       []Vote           `rlp:"optional"`
+	CurrentBlockCancelVotes []common.Address `rlp:"optional"`
+
+	// Config changes proposed and approved by the validators in the block.
+	CurrentBlockProposals []ConfigProposal `rlp:"optional"`
+	CurrentBlockApprovals []ConfigApproval `rlp:"optional"`
+
+	// Deposits topped up by candidates in the block.
+	CurrentBlockTopUps []TopUp `rlp:"optional"`
+
+	// Metadata set by candidates registering in the block.
+	CurrentBlockMetadata []CandidateMetadata `rlp:"optional"`
+
+	// Candidates evicted by higher deposits beyond the max candidate count.
+	CurrentBlockEvictedCandidates []common.Address `rlp:"optional"`
+
+	// Final block of the previous epoch attested at an epoch transition.
+	Checkpoint *Checkpoint `rlp:"optional"`
+
+	// Reward recipients set by candidates in the block.
+	CurrentBlockRewardRecipients []RewardRecipient `rlp:"optional"`
+
+	// Sealer keys set by candidates in the block, sealing from the next epoch.
+	CurrentBlockSealerKeys []SealerKey `rlp:"optional"`
 }
 
-// NewHeaderExtra new HeaderExtra from rlp bytes.
+// HeaderExtra encoding format versions. Every encoded HeaderExtra starts with
+// a version byte followed by the payload, except for the legacy format which
+// is a bare gzip stream.
+const (
+	headerExtraVersionLegacy byte = 0x00 // gzip(rlp(HeaderExtra)) without version prefix
+	headerExtraVersion1      byte = 0x01 // version || gzip(rlp(HeaderExtra))
+	headerExtraVersion2      byte = 0x02 // version || codec || compress(rlp(HeaderExtra))
+
+	headerExtraVersion = headerExtraVersion2 // Version used by Encode
+)
+
+// Limits of the decompressed HeaderExtra size. A HeaderExtra is dominated by
+// its address lists, each address costs 21 bytes in rlp. Even an epoch block
+// of a 30M gas block carrying a candidate operation per 21000 gas (~1430
+// entries per list), 100 validators and a config with 100 genesis validators
+// stays below 128KB, the default leaves twice that as headroom. The absolute
+// cap bounds memory for any input regardless of configuration.
+const (
+	defaultMaxHeaderExtraSize = 256 * 1024  // Default decompressed size limit
+	maxHeaderExtraSizeCap     = 1024 * 1024 // Absolute decompressed size limit
+)
+
+// headerExtraLimit returns the max decompressed HeaderExtra size of the config.
+func headerExtraLimit(config params.EqualityConfig) uint64 {
+	limit := config.MaxHeaderExtraSize
+	if limit == 0 {
+		limit = defaultMaxHeaderExtraSize
+	}
+	if limit > maxHeaderExtraSizeCap {
+		limit = maxHeaderExtraSizeCap
+	}
+	return limit
+}
+
+// The encoded header extra is carried by every header and relayed before it is
+// verified, its size is bounded apart from the decompressed one: a compressible
+// payload within the decompressed limit may still bloat the headers. Addresses
+// hardly compress, the default fits a block of 1500 of them.
+const defaultMaxHeaderExtraBytes = 32 * 1024 // Default encoded size limit
+
+// headerExtraBytesLimit returns the max size of the header extra data as carried
+// in the header, including the vanity and the seal.
+func headerExtraBytesLimit(config params.EqualityConfig) uint64 {
+	if config.MaxHeaderExtraBytes == 0 {
+		return defaultMaxHeaderExtraBytes
+	}
+	return config.MaxHeaderExtraBytes
+}
+
+// headerExtraDecoders maps format versions to their payload decoders.
+var headerExtraDecoders = map[byte]func(payload []byte, limit uint64) (HeaderExtra, error){
+	headerExtraVersionLegacy: decodeHeaderExtraV1,
+	headerExtraVersion1:      decodeHeaderExtraV1,
+	headerExtraVersion2:      decodeHeaderExtraV2,
+}
+
+// isGzip returns whether data starts with the gzip magic number.
+func isGzip(data []byte) bool {
+	return len(data) >= 2 && data[0] == 0x1f && data[1] == 0x8b
+}
+
+// NewHeaderExtra new HeaderExtra from encoded bytes.
 func NewHeaderExtra(data []byte) (HeaderExtra, error) {
-	r, err := gzip.NewReader(bytes.NewReader(data))
+	return NewHeaderExtraWithLimit(data, maxHeaderExtraSizeCap)
+}
+
+// NewHeaderExtraWithLimit new HeaderExtra from encoded bytes, failing with
+// errHeaderExtraTooLarge if the decompressed payload exceeds limit bytes and
+// with ErrEmptyExtra if there are no bytes.
+func NewHeaderExtraWithLimit(data []byte, limit uint64) (HeaderExtra, error) {
+	if len(data) == 0 {
+		return HeaderExtra{}, ErrEmptyExtra
+	}
+	version, payload := headerExtraVersionLegacy, data
+	if !isGzip(data) {
+		version, payload = data[0], data[1:]
+	}
+
+	decode, ok := headerExtraDecoders[version]
+	if !ok {
+		return HeaderExtra{}, errUnknownHeaderExtraVersion
+	}
+	return decode(payload, limit)
+}
+
+// decodeHeaderExtraV1 decodes a gzip compressed rlp payload of HeaderExtra.
+func decodeHeaderExtraV1(payload []byte, limit uint64) (HeaderExtra, error) {
+	buffer := rlpBuffers.Get().(*bytes.Buffer)
+	defer releaseRLPBuffer(buffer)
+	data, err := decompressTo(buffer, codecGzip, payload, limit)
 	if err != nil {
 		return HeaderExtra{}, err
 	}
+	return decodeHeaderExtraRLP(data)
+}
 
-	buffer := bytes.NewBuffer(nil)
-	for {
-		var temp [128]byte
-		n, err := r.Read(temp[:])
-		if n > 0 {
-			buffer.Write(temp[:n])
-		}
-		if err != nil {
-			if err == io.EOF {
-				break
-			}
-			return HeaderExtra{}, err
-		}
+// decodeHeaderExtraV2 decodes a codec tagged, compressed rlp payload of HeaderExtra.
+func decodeHeaderExtraV2(payload []byte, limit uint64) (HeaderExtra, error) {
+	if len(payload) == 0 {
+		return HeaderExtra{}, errUnknownCompression
+	}
+	buffer := rlpBuffers.Get().(*bytes.Buffer)
+	defer releaseRLPBuffer(buffer)
+	data, err := decompressTo(buffer, payload[0], payload[1:], limit)
+	if err != nil {
+		return HeaderExtra{}, err
+	}
+	return decodeHeaderExtraRLP(data)
+}
+
+// DecodeHeaderExtraRaw decodes the raw rlp bytes of HeaderExtra, the payload
+// of header.Extra after its version and codec bytes once decompressed. It is
+// meant for consumers decompressing the payload themselves.
+func DecodeHeaderExtraRaw(data []byte) (HeaderExtra, error) {
+	if len(data) == 0 {
+		return HeaderExtra{}, ErrEmptyExtra
+	}
+	if uint64(len(data)) > maxHeaderExtraSizeCap {
+		return HeaderExtra{}, errHeaderExtraTooLarge
 	}
+	return decodeHeaderExtraRLP(data)
+}
 
+// decodeHeaderExtraRLP decodes the rlp bytes of HeaderExtra.
+func decodeHeaderExtraRLP(data []byte) (HeaderExtra, error) {
 	var headerExtra HeaderExtra
-	if err := rlp.DecodeBytes(buffer.Bytes(), &headerExtra); err != nil {
-		return HeaderExtra{}, err
+	if err := rlp.DecodeBytes(data, &headerExtra); err != nil {
+		return HeaderExtra{}, fmt.Errorf("%w: %v", errInvalidHeaderExtraRLP, err)
 	}
 	return headerExtra, nil
 }
 
-// Encode encode header extra as rlp bytes.
+// Encode encode header extra as versioned, compressed rlp bytes with the
+// default compression.
 func (headerExtra HeaderExtra) Encode() ([]byte, error) {
-	data, err := rlp.EncodeToBytes(headerExtra)
+	return headerExtra.EncodeWith(params.EqualityConfig{})
+}
+
+// EncodeWith encode header extra as versioned, compressed rlp bytes with the
+// compression selected by the chain config.
+func (headerExtra HeaderExtra) EncodeWith(config params.EqualityConfig) ([]byte, error) {
+	codec, level, err := compressionOf(config)
+	if err != nil {
+		return nil, err
+	}
+
+	buffer := rlpBuffers.Get().(*bytes.Buffer)
+	defer releaseRLPBuffer(buffer)
+	if err = rlp.Encode(buffer, headerExtra.Canonicalize()); err != nil {
+		return nil, err
+	}
+	data := buffer.Bytes()
+
+	// The payload is compressed behind its version and codec into a slice
+	// fitting the raw rlp, which compression rarely exceeds
+	encoded := append(make([]byte, 0, len(data)+2), headerExtraVersion2, codec)
+	if encoded, err = compressAppend(encoded, codec, level, data); err != nil {
+		return nil, err
+	}
+
+	// Small payloads, e.g. a Root and epoch numbers only, grow from the
+	// compression framing. Store them as raw rlp instead.
+	if len(encoded)-2 >= len(data) {
+		encoded = append(encoded[:1], codecNone)
+		encoded = append(encoded, data...)
+	}
+	return encoded, nil
+}
+
+// releaseRLPBuffer returns a buffer of rlp bytes to the pool, the ones grown
+// by oversized payloads are dropped.
+func releaseRLPBuffer(buffer *bytes.Buffer) {
+	if buffer.Cap() > defaultMaxHeaderExtraSize {
+		return
+	}
+	buffer.Reset()
+	rlpBuffers.Put(buffer)
+}
+
+// encodeVersioned rlp encodes and gzip compresses the value, prefixed by version.
+func encodeVersioned(version byte, value interface{}) ([]byte, error) {
+	data, err := rlp.EncodeToBytes(value)
 	if err != nil {
 		return nil, err
 	}
 
-	buffer := bytes.NewBuffer(nil)
-	w := gzip.NewWriter(buffer)
-	w.Write(data)
-	w.Close()
-	return buffer.Bytes(), nil
+	compressed, err := compress(codecGzip, gzip.DefaultCompression, data)
+	if err != nil {
+		return nil, err
+	}
+	if version == headerExtraVersionLegacy {
+		return compressed, nil
+	}
+	return append([]byte{version}, compressed...), nil
+}
+
+// Canonicalize returns a copy of header extra with the candidate lists sorted
+// by address bytes, the votes by delegator, the top ups by candidate and the
+// checkpoint signatures by bytes, so the same sets always encode to the same
+// bytes. The validators keep their
+// election order.
+func (headerExtra HeaderExtra) Canonicalize() HeaderExtra {
+	headerExtra.CurrentBlockCandidates = addressesSort(headerExtra.CurrentBlockCandidates)
+	headerExtra.CurrentBlockKickOutCandidates = addressesSort(headerExtra.CurrentBlockKickOutCandidates)
+	headerExtra.CurrentBlockCancelCandidates = addressesSort(headerExtra.CurrentBlockCancelCandidates)
+	headerExtra.CurrentBlockVotes = votesSort(headerExtra.CurrentBlockVotes)
+	headerExtra.CurrentBlockCancelVotes = addressesSort(headerExtra.CurrentBlockCancelVotes)
+	headerExtra.CurrentBlockProposals = configProposalsSort(headerExtra.CurrentBlockProposals)
+	headerExtra.CurrentBlockApprovals = configApprovalsSort(headerExtra.CurrentBlockApprovals)
+	headerExtra.CurrentBlockTopUps = topUpsSort(headerExtra.CurrentBlockTopUps)
+	headerExtra.CurrentBlockMetadata = candidateMetadataSort(headerExtra.CurrentBlockMetadata)
+	headerExtra.CurrentBlockEvictedCandidates = addressesSort(headerExtra.CurrentBlockEvictedCandidates)
+	if headerExtra.Checkpoint != nil {
+		checkpoint := headerExtra.Checkpoint.sorted()
+		headerExtra.Checkpoint = &checkpoint
+	}
+	headerExtra.CurrentBlockRewardRecipients = rewardRecipientsSort(headerExtra.CurrentBlockRewardRecipients)
+	headerExtra.CurrentBlockSealerKeys = sealerKeysSort(headerExtra.CurrentBlockSealerKeys)
+	return headerExtra
 }
 
-// Equal compares two HeaderExtras for equality.
+// Hash returns the keccak256 hash of the canonical rlp encoding of header extra
+// with its chain configs normalized, uncompressed, so it commits to the content
+// regardless of the compression of the header. HeaderExtras equal by Equal
+// have the same hash.
+func (headerExtra HeaderExtra) Hash() common.Hash {
+	headerExtra = headerExtra.Canonicalize()
+	if len(headerExtra.ChainConfig) > 0 {
+		configs := make([]params.EqualityConfig, 0, len(headerExtra.ChainConfig))
+		for _, config := range headerExtra.ChainConfig {
+			configs = append(configs, normalizeChainConfig(config))
+		}
+		headerExtra.ChainConfig = configs
+	}
+	data, err := rlp.EncodeToBytes(headerExtra)
+	if err != nil {
+		panic(err)
+	}
+	return crypto.Keccak256Hash(data)
+}
+
+// Equal compares the canonical forms of two HeaderExtras for equality. The
+// fields are compared in place rather than through Hash, which encodes both
+// sides: BenchmarkHeaderExtraEqual runs an order of magnitude slower hashing.
 func (headerExtra HeaderExtra) Equal(other HeaderExtra) bool {
+	headerExtra, other = headerExtra.Canonicalize(), other.Canonicalize()
 	if headerExtra.Root != other.Root {
 		return false
 	}
@@ -151,18 +424,275 @@ func (headerExtra HeaderExtra) Equal(other HeaderExtra) bool {
 			return false
 		}
 	}
+
+	if len(headerExtra.CurrentBlockVotes) != len(other.CurrentBlockVotes) {
+		return false
+	}
+	for idx, vote := range headerExtra.CurrentBlockVotes {
+		if !vote.Equal(other.CurrentBlockVotes[idx]) {
+			return false
+		}
+	}
+
+	if len(headerExtra.CurrentBlockCancelVotes) != len(other.CurrentBlockCancelVotes) {
+		return false
+	}
+	for idx, delegator := range headerExtra.CurrentBlockCancelVotes {
+		if delegator != other.CurrentBlockCancelVotes[idx] {
+			return false
+		}
+	}
+
+	if len(headerExtra.CurrentBlockProposals) != len(other.CurrentBlockProposals) {
+		return false
+	}
+	for idx, proposal := range headerExtra.CurrentBlockProposals {
+		if !proposal.Equal(other.CurrentBlockProposals[idx]) {
+			return false
+		}
+	}
+
+	if len(headerExtra.CurrentBlockApprovals) != len(other.CurrentBlockApprovals) {
+		return false
+	}
+	for idx, approval := range headerExtra.CurrentBlockApprovals {
+		if approval != other.CurrentBlockApprovals[idx] {
+			return false
+		}
+	}
+
+	if len(headerExtra.CurrentBlockTopUps) != len(other.CurrentBlockTopUps) {
+		return false
+	}
+	for idx, topUp := range headerExtra.CurrentBlockTopUps {
+		if !topUp.Equal(other.CurrentBlockTopUps[idx]) {
+			return false
+		}
+	}
+
+	if len(headerExtra.CurrentBlockMetadata) != len(other.CurrentBlockMetadata) {
+		return false
+	}
+	for idx, metadata := range headerExtra.CurrentBlockMetadata {
+		if !metadata.Equal(other.CurrentBlockMetadata[idx]) {
+			return false
+		}
+	}
+
+	if len(headerExtra.CurrentBlockEvictedCandidates) != len(other.CurrentBlockEvictedCandidates) {
+		return false
+	}
+	for idx, candidate := range headerExtra.CurrentBlockEvictedCandidates {
+		if candidate != other.CurrentBlockEvictedCandidates[idx] {
+			return false
+		}
+	}
+
+	if (headerExtra.Checkpoint == nil) != (other.Checkpoint == nil) {
+		return false
+	}
+	if headerExtra.Checkpoint != nil && !headerExtra.Checkpoint.Equal(*other.Checkpoint) {
+		return false
+	}
+
+	if len(headerExtra.CurrentBlockRewardRecipients) != len(other.CurrentBlockRewardRecipients) {
+		return false
+	}
+	for idx, recipient := range headerExtra.CurrentBlockRewardRecipients {
+		if recipient != other.CurrentBlockRewardRecipients[idx] {
+			return false
+		}
+	}
+
+	if len(headerExtra.CurrentBlockSealerKeys) != len(other.CurrentBlockSealerKeys) {
+		return false
+	}
+	for idx, key := range headerExtra.CurrentBlockSealerKeys {
+		if key != other.CurrentBlockSealerKeys[idx] {
+			return false
+		}
+	}
 	return true
 }
 
+// Validate checks the internal consistency of header extra carried by the
+// block of headerNumber under the chain config.
+func (headerExtra HeaderExtra) Validate(headerNumber uint64, config params.EqualityConfig) error {
+	if headerExtra.EpochBlock > headerNumber {
+		return fmt.Errorf("%w: %d > %d", errInvalidEpochBlock, headerExtra.EpochBlock, headerNumber)
+	}
+
+	lists := []struct {
+		name      string
+		addresses []common.Address
+	}{
+		{"candidates", headerExtra.CurrentBlockCandidates},
+		{"kick out candidates", headerExtra.CurrentBlockKickOutCandidates},
+		{"cancel candidates", headerExtra.CurrentBlockCancelCandidates},
+		{"validators", headerExtra.CurrentEpochValidators},
+		{"votes", votesDelegators(headerExtra.CurrentBlockVotes)},
+		{"cancel votes", headerExtra.CurrentBlockCancelVotes},
+		{"top ups", topUpsCandidates(headerExtra.CurrentBlockTopUps)},
+		{"metadata", candidateMetadataCandidates(headerExtra.CurrentBlockMetadata)},
+		{"evicted candidates", headerExtra.CurrentBlockEvictedCandidates},
+		{"reward recipients", rewardRecipientsCandidates(headerExtra.CurrentBlockRewardRecipients)},
+		{"sealer keys", sealerKeysCandidates(headerExtra.CurrentBlockSealerKeys)},
+	}
+	for _, list := range lists {
+		if NewAddressSet(list.addresses...).Len() != len(list.addresses) {
+			return fmt.Errorf("%w: %s", errDuplicateAddress, list.name)
+		}
+		if addressesExist(list.addresses, common.Address{}) {
+			return fmt.Errorf("%w: %s", errZeroAddress, list.name)
+		}
+	}
+
+	if limit := maxBlockCandidates(config); len(headerExtra.CurrentBlockCandidates) > limit {
+		return fmt.Errorf("%w: %d > %d", errTooManyCandidates, len(headerExtra.CurrentBlockCandidates), limit)
+	}
+
+	for _, vote := range headerExtra.CurrentBlockVotes {
+		if vote.Candidate == (common.Address{}) {
+			return fmt.Errorf("%w: vote candidates", errZeroAddress)
+		}
+		if addressesExist(headerExtra.CurrentBlockCancelVotes, vote.Delegator) {
+			return fmt.Errorf("%w: votes and cancel votes", errDuplicateAddress)
+		}
+	}
+
+	for _, topUp := range headerExtra.CurrentBlockTopUps {
+		if topUp.Amount == nil || topUp.Amount.Sign() <= 0 {
+			return fmt.Errorf("%w: %s", errInvalidTopUp, topUp)
+		}
+	}
+
+	if len(headerExtra.CurrentBlockMetadata) > 0 && !config.IsMetadata(new(big.Int).SetUint64(headerNumber)) {
+		return fmt.Errorf("%w: before the metadata block", errInvalidMetadata)
+	}
+	for _, metadata := range headerExtra.CurrentBlockMetadata {
+		if err := metadata.validate(); err != nil {
+			return err
+		}
+	}
+
+	if len(headerExtra.CurrentBlockRewardRecipients) > 0 && !config.IsRewardRecipient(new(big.Int).SetUint64(headerNumber)) {
+		return fmt.Errorf("%w: before the reward recipient block", errInvalidRewardRecipient)
+	}
+	for _, recipient := range headerExtra.CurrentBlockRewardRecipients {
+		if recipient.Recipient == (common.Address{}) {
+			return fmt.Errorf("%w: %s", errInvalidRewardRecipient, recipient)
+		}
+	}
+
+	if len(headerExtra.CurrentBlockSealerKeys) > 0 && !config.IsSealerKey(new(big.Int).SetUint64(headerNumber)) {
+		return fmt.Errorf("%w: before the sealer key block", errInvalidSealerKey)
+	}
+	for _, key := range headerExtra.CurrentBlockSealerKeys {
+		if key.Sealer == (common.Address{}) {
+			return fmt.Errorf("%w: %s", errInvalidSealerKey, key)
+		}
+	}
+
+	if checkpoint := headerExtra.Checkpoint; checkpoint != nil {
+		if !config.IsCheckpoint(new(big.Int).SetUint64(headerNumber)) {
+			return fmt.Errorf("%w: before the checkpoint block", errInvalidCheckpoint)
+		}
+		if headerExtra.EpochBlock != headerNumber || headerNumber <= 1 {
+			return fmt.Errorf("%w: outside epoch transition", errInvalidCheckpoint)
+		}
+		if err := checkpoint.validate(headerNumber); err != nil {
+			return err
+		}
+	}
+
+	for _, config := range headerExtra.ChainConfig {
+		if err := validateChainConfig(config); err != nil {
+			return err
+		}
+		if config.ActivationBlock != 0 && config.ActivationBlock <= headerNumber {
+			return fmt.Errorf("%w: %d <= %d", errPastActivation, config.ActivationBlock, headerNumber)
+		}
+	}
+
+	if len(headerExtra.CurrentEpochValidators) > 0 && headerExtra.EpochBlock != headerNumber {
+		return errUnexpectedValidators
+	}
+	if uint64(len(headerExtra.CurrentEpochValidators)) > config.MaxValidatorsCount {
+		return fmt.Errorf("%w: %d > %d", errTooManyValidators, len(headerExtra.CurrentEpochValidators), config.MaxValidatorsCount)
+	}
+	return nil
+}
+
+// validateChainConfig checks the fields of a chain config, its header extra
+// compression, its election strategy and its validator count formula.
+func validateChainConfig(config params.EqualityConfig) error {
+	if err := config.Validate(); err != nil {
+		return fmt.Errorf("%w: %v", errInvalidChainConfig, err)
+	}
+	if _, _, err := compressionOf(config); err != nil {
+		return fmt.Errorf("%w: %v", errInvalidChainConfig, err)
+	}
+	if _, err := electionStrategyOf(config); err != nil {
+		return fmt.Errorf("%w: %v", errInvalidChainConfig, err)
+	}
+	if err := checkValidatorCountFormula(config); err != nil {
+		return fmt.Errorf("%w: %v", errInvalidChainConfig, err)
+	}
+	return nil
+}
+
+// EncodeHeaderExtra returns the full header.Extra carrying the encoded header
+// extra after vanity, with zeroed space for the seal. A shorter vanity is
+// padded with zeros and a longer one truncated to ExtraVanity bytes.
+func EncodeHeaderExtra(vanity []byte, extra HeaderExtra) ([]byte, error) {
+	payload, err := extra.Encode()
+	if err != nil {
+		return nil, err
+	}
+	return assembleExtra(vanity, payload), nil
+}
+
+// assembleExtra returns the header.Extra layout of the vanity and the encoded
+// header extra with zeroed space for the seal.
+func assembleExtra(vanity, payload []byte) []byte {
+	extra := make([]byte, ExtraVanity, ExtraVanity+len(payload)+ExtraSeal)
+	copy(extra, vanity)
+	extra = append(extra, payload...)
+	return append(extra, make([]byte, ExtraSeal)...)
+}
+
+// SplitExtra splits header.Extra into the vanity, the encoded header extra and
+// the seal, the parts share the memory of extra.
+func SplitExtra(extra []byte) (vanity, payload, seal []byte, err error) {
+	if len(extra) < ExtraVanity {
+		return nil, nil, nil, errMissingVanity
+	}
+	if len(extra) < ExtraVanity+ExtraSeal {
+		return nil, nil, nil, errMissingSignature
+	}
+	return extra[:ExtraVanity], extra[ExtraVanity : len(extra)-ExtraSeal], extra[len(extra)-ExtraSeal:], nil
+}
+
+// DecodeHeaderExtra decodes the HeaderExtra embedded in header.Extra.
 func DecodeHeaderExtra(header *types.Header) (HeaderExtra, error) {
-	headerExtra := header.Extra
-	if len(headerExtra) < extraVanity {
-		return HeaderExtra{}, errMissingVanity
+	return decodeHeaderExtraWithLimit(header, maxHeaderExtraSizeCap)
+}
+
+// decodeHeaderExtraWithLimit decodes the HeaderExtra embedded in header.Extra
+// with a decompressed size limit. Failures are annotated with the block number
+// and hash, the underlying cause remains accessible through errors.Is.
+func decodeHeaderExtraWithLimit(header *types.Header, limit uint64) (HeaderExtra, error) {
+	defer headerExtraDecodeTimer.UpdateSince(time.Now())
+
+	var headerExtra HeaderExtra
+	_, payload, _, err := SplitExtra(header.Extra)
+	if err == nil {
+		headerExtra, err = NewHeaderExtraWithLimit(payload, limit)
 	}
-	if len(headerExtra) < extraVanity+extraSeal {
-		return HeaderExtra{}, errMissingSignature
+	if err != nil {
+		return HeaderExtra{}, fmt.Errorf("block %v (%s): %w", header.Number, header.Hash().Hex(), err)
 	}
-	return NewHeaderExtra(headerExtra[extraVanity : len(headerExtra)-extraSeal])
+	return headerExtra, nil
 }
 
 // Returns whether an address exists in the address list.
@@ -175,30 +705,28 @@ func addressesExist(slice []common.Address, addr common.Address) bool {
 	return false
 }
 
-// Ensure each element of an common.Address slice are not the same.
-func addressesDistinct(slice []common.Address) []common.Address {
-	if len(slice) <= 1 {
+// Return a copy of an common.Address slice sorted by address bytes, the slice
+// itself if already sorted.
+func addressesSort(slice []common.Address) []common.Address {
+	if addressesSorted(slice) {
 		return slice
 	}
 
-	set := make(map[common.Address]struct{})
-	result := make([]common.Address, 0, len(slice))
-	for _, address := range slice {
-		if _, ok := set[address]; !ok {
-			set[address] = struct{}{}
-			result = append(result, address)
-		}
-	}
+	result := make([]common.Address, len(slice))
+	copy(result, slice)
+	sort.Slice(result, func(i, j int) bool {
+		return bytes.Compare(result[i][:], result[j][:]) < 0
+	})
 	return result
 }
 
-// Remove an element from the address list.
-func addressesRemove(slice []common.Address, addr common.Address) []common.Address {
-	result := make([]common.Address, 0, len(slice))
-	for _, address := range slice {
-		if address != addr {
-			result = append(result, address)
+// addressesSorted returns whether an common.Address slice is sorted by address
+// bytes, the header extras decoded from blocks are.
+func addressesSorted(slice []common.Address) bool {
+	for idx := 1; idx < len(slice); idx++ {
+		if bytes.Compare(slice[idx-1][:], slice[idx][:]) > 0 {
+			return false
 		}
 	}
-	return result
+	return true
 }
@@ -0,0 +1,193 @@
+package equality
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/SecretBlockChain/go-secret/common"
+	"github.com/SecretBlockChain/go-secret/core/types"
+	"github.com/SecretBlockChain/go-secret/params"
+)
+
+var (
+	// errDiscontinuousHeaders is returned if a header does not follow the
+	// previous one of a header range.
+	errDiscontinuousHeaders = errors.New("discontinuous headers")
+
+	// errUnexpectedKickOut is returned if a transition kicks out a validator
+	// that sealed enough blocks of the previous epoch.
+	errUnexpectedKickOut = errors.New("unexpected kick out")
+
+	// errIneligibleValidator is returned if a transition elects a candidate
+	// canceled or kicked out before.
+	errIneligibleValidator = errors.New("ineligible validator")
+
+	// errUnexpectedCoinbase is returned if a block is sealed by an address not
+	// among the validators of its epoch.
+	errUnexpectedCoinbase = errors.New("coinbase not a validator")
+)
+
+// HeaderExtraChainError is returned by VerifyHeaderExtraChain, naming the
+// header and the rule it fails.
+type HeaderExtraChainError struct {
+	Number uint64
+	Hash   common.Hash
+	Rule   string
+	Err    error
+}
+
+func (err *HeaderExtraChainError) Error() string {
+	return fmt.Sprintf("header %d [%s] fails %s: %v", err.Number, err.Hash.TerminalString(), err.Rule, err.Err)
+}
+
+func (err *HeaderExtraChainError) Unwrap() error {
+	return err.Err
+}
+
+// VerifyHeaderExtraChain checks the header extras of a contiguous header range
+// against each other under config, without access to the snapshot tries:
+//
+//   - the epoch fields advance at every config.Epoch blocks,
+//   - the blocks of an epoch whose transition is in range are sealed by its validators,
+//   - the kick outs of a transition match the mint counts of the previous epoch,
+//     if its transition is in range as well,
+//   - a transition elects no candidate canceled or kicked out in range before,
+//   - the checkpoint of a transition is attested by the validators of the
+//     previous epoch, if its transition is in range as well.
+//
+// Rules depending on state before the range, like the candidates registered
+// earlier, are not checked. The chain config is assumed constant in range.
+func VerifyHeaderExtraChain(headers []*types.Header, config params.EqualityConfig) error {
+	if err := config.Validate(); err != nil {
+		return err
+	}
+	headerError := func(header *types.Header, rule string, err error) error {
+		return &HeaderExtraChainError{Number: header.Number.Uint64(), Hash: header.Hash(), Rule: rule, Err: err}
+	}
+
+	var (
+		prev       *types.Header
+		prevExtra  HeaderExtra
+		validators []common.Address // Validators of the current epoch, nil if unknown
+		minted     map[common.Address]uint64
+		registered = make(map[common.Address]uint64) // Registration block of the candidates
+		canceled   = make(map[common.Address]bool)
+	)
+	if len(headers) > 0 && headers[0].Number.Uint64() == 1 && len(config.Validators) > 0 {
+		validators = config.Validators
+	}
+	for _, header := range headers {
+		number := header.Number.Uint64()
+		headerExtra, err := DecodeHeaderExtra(header)
+		if err != nil {
+			return headerError(header, "header extra", err)
+		}
+		if err = headerExtra.Validate(number, config); err != nil {
+			return headerError(header, "header extra", err)
+		}
+
+		// Continuity of the range and its epochs
+		if prev != nil {
+			if number != prev.Number.Uint64()+1 || header.ParentHash != prev.Hash() {
+				return headerError(header, "parent", errDiscontinuousHeaders)
+			}
+			epoch, epochBlock := prevExtra.Epoch, prevExtra.EpochBlock
+			if number-epochBlock == config.Epoch {
+				epoch, epochBlock = epoch+1, number
+			}
+			if headerExtra.Epoch != epoch || headerExtra.EpochBlock != epochBlock {
+				return headerError(header, "epoch", fmt.Errorf("%w: epoch %d at %d, want %d at %d",
+					errInvalidEpochBlock, headerExtra.Epoch, headerExtra.EpochBlock, epoch, epochBlock))
+			}
+		}
+
+		// Candidate changes of the block apply before its election
+		for _, candidate := range headerExtra.CurrentBlockEvictedCandidates {
+			delete(registered, candidate)
+			canceled[candidate] = true
+		}
+		for _, candidate := range headerExtra.CurrentBlockCandidates {
+			registered[candidate] = number
+			delete(canceled, candidate)
+		}
+		for _, candidate := range headerExtra.CurrentBlockCancelCandidates {
+			delete(registered, candidate)
+			canceled[candidate] = true
+		}
+
+		if number == headerExtra.EpochBlock && number > 1 {
+			if minted != nil {
+				inactive := headerChainInactive(config, number, minted, registered)
+				for _, candidate := range headerExtra.CurrentBlockKickOutCandidates {
+					if !inactive[candidate] {
+						return headerError(header, "kick out", fmt.Errorf("%w: %s", errUnexpectedKickOut, candidate.Hex()))
+					}
+				}
+			}
+			for _, candidate := range headerExtra.CurrentBlockKickOutCandidates {
+				delete(registered, candidate)
+				canceled[candidate] = true
+			}
+			for _, validator := range headerExtra.CurrentEpochValidators {
+				if canceled[validator] {
+					return headerError(header, "validators", fmt.Errorf("%w: %s", errIneligibleValidator, validator.Hex()))
+				}
+			}
+		}
+
+		if checkpoint := headerExtra.Checkpoint; checkpoint != nil && validators != nil {
+			if err = verifyCheckpoint(header, *checkpoint, validators); err != nil {
+				return headerError(header, "checkpoint", err)
+			}
+		}
+
+		// A transition is sealed by the validators of the previous epoch but
+		// minted in its own epoch
+		if validators != nil && !addressesExist(validators, header.Coinbase) {
+			return headerError(header, "coinbase", fmt.Errorf("%w: %s", errUnexpectedCoinbase, header.Coinbase.Hex()))
+		}
+		if number == headerExtra.EpochBlock {
+			validators = headerExtra.CurrentEpochValidators
+			minted = make(map[common.Address]uint64)
+		}
+		if minted != nil {
+			minted[header.Coinbase]++
+		}
+		prev, prevExtra = header, headerExtra
+	}
+	return nil
+}
+
+// headerChainInactive returns the validators of the epoch ending before the
+// transition at number that fall short of the mint rule, mirroring the
+// selection of tryElect from the mint counts of the epoch.
+func headerChainInactive(config params.EqualityConfig, number uint64,
+	minted map[common.Address]uint64, registered map[common.Address]uint64) map[common.Address]bool {
+
+	inactive := make(map[common.Address]bool)
+	if config.KickOutRatio == 0 {
+		minMint := config.Epoch / config.MaxValidatorsCount / 2
+		for validator, count := range minted {
+			if count < minMint {
+				inactive[validator] = true
+			}
+		}
+		return inactive
+	}
+
+	var epochStart uint64 = 1
+	if number > config.Epoch {
+		epochStart = number - config.Epoch
+	}
+	for validator, count := range minted {
+		joined := epochStart
+		if block, ok := registered[validator]; ok && block > joined && block < number {
+			joined = block
+		}
+		scheduled := (number - joined) / uint64(len(minted))
+		if count*100 < scheduled*config.KickOutRatio {
+			inactive[validator] = true
+		}
+	}
+	return inactive
+}
@@ -0,0 +1,118 @@
+package equality
+
+import (
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/SecretBlockChain/go-secret/common"
+	"github.com/SecretBlockChain/go-secret/core/types"
+	"github.com/SecretBlockChain/go-secret/params"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVerifyHeaderExtraChain(t *testing.T) {
+	validatorA := common.HexToAddress("0xa000000000000000000000000000000000000000")
+	validatorB := common.HexToAddress("0xb000000000000000000000000000000000000000")
+	validatorC := common.HexToAddress("0xc000000000000000000000000000000000000000")
+	candidateD := common.HexToAddress("0xd000000000000000000000000000000000000000")
+	config := params.EqualityConfig{Period: 3, Epoch: 8, MaxValidatorsCount: 2, MinCandidateBalance: big.NewInt(0)}
+
+	// Validator B seals a single block of the first epoch, below the min mint
+	// count of 2, and is replaced by C at block 9
+	newChain := func(modify func(number uint64, headerExtra *HeaderExtra, header *types.Header)) []*types.Header {
+		headers := []*types.Header{{Number: big.NewInt(0)}}
+		for number := uint64(1); number <= 10; number++ {
+			headerExtra := HeaderExtra{Epoch: 1, EpochBlock: 1}
+			coinbase := validatorA
+			switch number {
+			case 1:
+				headerExtra.CurrentBlockCandidates = []common.Address{validatorA, validatorB, validatorC, candidateD}
+				headerExtra.CurrentEpochValidators = []common.Address{validatorA, validatorB}
+			case 5:
+				headerExtra.CurrentBlockCancelCandidates = []common.Address{candidateD}
+			case 8:
+				coinbase = validatorB
+			case 9:
+				headerExtra = HeaderExtra{Epoch: 2, EpochBlock: 9}
+				headerExtra.CurrentBlockKickOutCandidates = []common.Address{validatorB}
+				headerExtra.CurrentEpochValidators = []common.Address{validatorA, validatorC}
+			case 10:
+				headerExtra = HeaderExtra{Epoch: 2, EpochBlock: 9}
+				coinbase = validatorC
+			}
+			header := &types.Header{Coinbase: coinbase}
+			if modify != nil {
+				modify(number, &headerExtra, header)
+			}
+			encoded := newTestHeader(number, headerExtra)
+			encoded.Coinbase = header.Coinbase
+			encoded.ParentHash = headers[number-1].Hash()
+			headers = append(headers, encoded)
+		}
+		return headers[1:]
+	}
+	headers := newChain(nil)
+	assert.Nil(t, VerifyHeaderExtraChain(headers, config))
+	assert.Nil(t, VerifyHeaderExtraChain(headers[1:], config))
+	assert.Nil(t, VerifyHeaderExtraChain(nil, config))
+
+	// Without the previous transition in range the kick outs are not checked
+	kickOutA := newChain(func(number uint64, headerExtra *HeaderExtra, header *types.Header) {
+		if number == 9 {
+			headerExtra.CurrentBlockKickOutCandidates = []common.Address{validatorA}
+			headerExtra.CurrentEpochValidators = []common.Address{validatorB, validatorC}
+		}
+		if number >= 9 {
+			header.Coinbase = validatorB
+		}
+	})
+	assert.Nil(t, VerifyHeaderExtraChain(kickOutA[4:], config))
+
+	tests := []struct {
+		name    string
+		headers []*types.Header
+		number  uint64
+		rule    string
+		err     error
+	}{
+		{"active validator kicked out", kickOutA, 9, "kick out", errUnexpectedKickOut},
+		{"kicked out validator elected", newChain(func(number uint64, headerExtra *HeaderExtra, header *types.Header) {
+			if number == 9 {
+				headerExtra.CurrentEpochValidators = []common.Address{validatorA, validatorB}
+			}
+		}), 9, "validators", errIneligibleValidator},
+		{"canceled candidate elected", newChain(func(number uint64, headerExtra *HeaderExtra, header *types.Header) {
+			if number == 9 {
+				headerExtra.CurrentEpochValidators = []common.Address{validatorA, candidateD}
+			}
+		}), 9, "validators", errIneligibleValidator},
+		{"sealed by another epoch", newChain(func(number uint64, headerExtra *HeaderExtra, header *types.Header) {
+			if number == 5 {
+				header.Coinbase = validatorC
+			}
+		}), 5, "coinbase", errUnexpectedCoinbase},
+		{"missed transition", newChain(func(number uint64, headerExtra *HeaderExtra, header *types.Header) {
+			if number >= 9 {
+				*headerExtra = HeaderExtra{Epoch: 1, EpochBlock: 1}
+			}
+		}), 9, "epoch", errInvalidEpochBlock},
+		{"missing header", append(append([]*types.Header{}, headers[:4]...), headers[5:]...), 6, "parent", errDiscontinuousHeaders},
+		{"invalid header extra", newChain(func(number uint64, headerExtra *HeaderExtra, header *types.Header) {
+			if number == 10 {
+				headerExtra.CurrentEpochValidators = []common.Address{validatorA}
+			}
+		}), 10, "header extra", errUnexpectedValidators},
+	}
+	for _, test := range tests {
+		err := VerifyHeaderExtraChain(test.headers, config)
+		var chainErr *HeaderExtraChainError
+		if !errors.As(err, &chainErr) {
+			t.Errorf("%s: have %v, want chain error", test.name, err)
+			continue
+		}
+		assert.Equal(t, test.number, chainErr.Number, test.name)
+		assert.Equal(t, test.rule, chainErr.Rule, test.name)
+		assert.True(t, errors.Is(err, test.err), "%s: have %v, want %v", test.name, err, test.err)
+	}
+}
@@ -0,0 +1,265 @@
+package equality
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/SecretBlockChain/go-secret/common"
+	"github.com/SecretBlockChain/go-secret/params"
+)
+
+// FieldDifference is the difference of a HeaderExtra field. Scalar fields are
+// reported as ours and theirs, address lists as the addresses added and
+// removed by theirs.
+type FieldDifference struct {
+	Field   string
+	Ours    string
+	Theirs  string
+	Added   []common.Address // Addresses in theirs missing in ours
+	Removed []common.Address // Addresses in ours missing in theirs
+}
+
+// String implements the fmt.Stringer interface.
+func (diff FieldDifference) String() string {
+	if len(diff.Added) == 0 && len(diff.Removed) == 0 {
+		return fmt.Sprintf("%s: %s != %s", diff.Field, diff.Ours, diff.Theirs)
+	}
+	return fmt.Sprintf("%s: +%s -%s", diff.Field, validatorsToString(diff.Added), validatorsToString(diff.Removed))
+}
+
+// HeaderExtraDifference is the difference of two HeaderExtras, one entry per
+// differing field.
+type HeaderExtraDifference []FieldDifference
+
+// String implements the fmt.Stringer interface.
+func (diff HeaderExtraDifference) String() string {
+	slice := make([]string, 0, len(diff))
+	for _, field := range diff {
+		slice = append(slice, field.String())
+	}
+	return strings.Join(slice, "; ")
+}
+
+// fieldDifference returns the trie roots of other differing from root, fields
+// named root.<name>.
+func (root Root) fieldDifference(other Root) HeaderExtraDifference {
+	diff := make(HeaderExtraDifference, 0)
+	ours, theirs := root.fields(), other.fields()
+	for idx := range ours {
+		if ours[idx].hash != theirs[idx].hash {
+			diff = append(diff, FieldDifference{
+				Field:  "root." + ours[idx].name,
+				Ours:   ours[idx].hash.String(),
+				Theirs: theirs[idx].hash.String(),
+			})
+		}
+	}
+	return diff
+}
+
+// Difference returns the fields of other differing from header extra, in
+// their canonical forms. Equal HeaderExtras yield an empty difference.
+func (headerExtra HeaderExtra) Difference(other HeaderExtra) HeaderExtraDifference {
+	headerExtra, other = headerExtra.Canonicalize(), other.Canonicalize()
+
+	diff := headerExtra.Root.fieldDifference(other.Root)
+	if headerExtra.Epoch != other.Epoch {
+		diff = append(diff, FieldDifference{
+			Field:  "epoch",
+			Ours:   fmt.Sprint(headerExtra.Epoch),
+			Theirs: fmt.Sprint(other.Epoch),
+		})
+	}
+	if headerExtra.EpochBlock != other.EpochBlock {
+		diff = append(diff, FieldDifference{
+			Field:  "epochBlock",
+			Ours:   fmt.Sprint(headerExtra.EpochBlock),
+			Theirs: fmt.Sprint(other.EpochBlock),
+		})
+	}
+
+	lists := []struct {
+		name   string
+		ours   []common.Address
+		theirs []common.Address
+	}{
+		{"currentBlockCandidates", headerExtra.CurrentBlockCandidates, other.CurrentBlockCandidates},
+		{"currentBlockKickOutCandidates", headerExtra.CurrentBlockKickOutCandidates, other.CurrentBlockKickOutCandidates},
+		{"currentBlockCancelCandidates", headerExtra.CurrentBlockCancelCandidates, other.CurrentBlockCancelCandidates},
+		{"currentEpochValidators", headerExtra.CurrentEpochValidators, other.CurrentEpochValidators},
+		{"currentBlockCancelVotes", headerExtra.CurrentBlockCancelVotes, other.CurrentBlockCancelVotes},
+		{"currentBlockEvictedCandidates", headerExtra.CurrentBlockEvictedCandidates, other.CurrentBlockEvictedCandidates},
+	}
+	for _, list := range lists {
+		added, removed := addressesDifference(list.ours, list.theirs)
+		if len(added) > 0 || len(removed) > 0 {
+			diff = append(diff, FieldDifference{Field: list.name, Added: added, Removed: removed})
+		} else if !addressesEqual(list.ours, list.theirs) {
+			// Same set in another order, only possible for the validators
+			diff = append(diff, FieldDifference{
+				Field:  list.name,
+				Ours:   validatorsToString(list.ours),
+				Theirs: validatorsToString(list.theirs),
+			})
+		}
+	}
+
+	if ours, theirs := votesToString(headerExtra.CurrentBlockVotes), votesToString(other.CurrentBlockVotes); ours != theirs {
+		diff = append(diff, FieldDifference{Field: "currentBlockVotes", Ours: ours, Theirs: theirs})
+	}
+	if ours, theirs := configProposalsToString(headerExtra.CurrentBlockProposals), configProposalsToString(other.CurrentBlockProposals); ours != theirs {
+		diff = append(diff, FieldDifference{Field: "currentBlockProposals", Ours: ours, Theirs: theirs})
+	}
+	if ours, theirs := configApprovalsToString(headerExtra.CurrentBlockApprovals), configApprovalsToString(other.CurrentBlockApprovals); ours != theirs {
+		diff = append(diff, FieldDifference{Field: "currentBlockApprovals", Ours: ours, Theirs: theirs})
+	}
+	if ours, theirs := topUpsToString(headerExtra.CurrentBlockTopUps), topUpsToString(other.CurrentBlockTopUps); ours != theirs {
+		diff = append(diff, FieldDifference{Field: "currentBlockTopUps", Ours: ours, Theirs: theirs})
+	}
+	if ours, theirs := candidateMetadataToString(headerExtra.CurrentBlockMetadata), candidateMetadataToString(other.CurrentBlockMetadata); ours != theirs {
+		diff = append(diff, FieldDifference{Field: "currentBlockMetadata", Ours: ours, Theirs: theirs})
+	}
+	if ours, theirs := checkpointToString(headerExtra.Checkpoint), checkpointToString(other.Checkpoint); ours != theirs {
+		diff = append(diff, FieldDifference{Field: "checkpoint", Ours: ours, Theirs: theirs})
+	}
+	if ours, theirs := rewardRecipientsToString(headerExtra.CurrentBlockRewardRecipients), rewardRecipientsToString(other.CurrentBlockRewardRecipients); ours != theirs {
+		diff = append(diff, FieldDifference{Field: "currentBlockRewardRecipients", Ours: ours, Theirs: theirs})
+	}
+	if ours, theirs := sealerKeysToString(headerExtra.CurrentBlockSealerKeys), sealerKeysToString(other.CurrentBlockSealerKeys); ours != theirs {
+		diff = append(diff, FieldDifference{Field: "currentBlockSealerKeys", Ours: ours, Theirs: theirs})
+	}
+
+	count := len(headerExtra.ChainConfig)
+	if len(other.ChainConfig) > count {
+		count = len(other.ChainConfig)
+	}
+	for idx := 0; idx < count; idx++ {
+		var ours, theirs string
+		if idx < len(headerExtra.ChainConfig) {
+			ours = chainConfigToString(headerExtra.ChainConfig[idx])
+		}
+		if idx < len(other.ChainConfig) {
+			theirs = chainConfigToString(other.ChainConfig[idx])
+		}
+		if ours != theirs {
+			diff = append(diff, FieldDifference{
+				Field:  fmt.Sprintf("chainConfig[%d]", idx),
+				Ours:   ours,
+				Theirs: theirs,
+			})
+		}
+	}
+	return diff
+}
+
+// votesToString returns the votes formatted as delegator->candidate:weight.
+func votesToString(votes []Vote) string {
+	slice := make([]string, 0, len(votes))
+	for _, vote := range votes {
+		slice = append(slice, vote.String())
+	}
+	return "[" + strings.Join(slice, ",") + "]"
+}
+
+// topUpsToString returns the top ups formatted as candidate:amount.
+func topUpsToString(topUps []TopUp) string {
+	slice := make([]string, 0, len(topUps))
+	for _, topUp := range topUps {
+		slice = append(slice, topUp.String())
+	}
+	return "[" + strings.Join(slice, ",") + "]"
+}
+
+// checkpointToString returns the checkpoint formatted as number:hash:signatures,
+// empty for none.
+func checkpointToString(checkpoint *Checkpoint) string {
+	if checkpoint == nil {
+		return ""
+	}
+	return checkpoint.String()
+}
+
+// candidateMetadataToString returns the metadata formatted as candidate:metadata.
+func candidateMetadataToString(metadata []CandidateMetadata) string {
+	slice := make([]string, 0, len(metadata))
+	for _, entry := range metadata {
+		slice = append(slice, entry.String())
+	}
+	return "[" + strings.Join(slice, ",") + "]"
+}
+
+// rewardRecipientsToString returns the reward recipients formatted as
+// candidate->recipient.
+func rewardRecipientsToString(recipients []RewardRecipient) string {
+	slice := make([]string, 0, len(recipients))
+	for _, recipient := range recipients {
+		slice = append(slice, recipient.String())
+	}
+	return "[" + strings.Join(slice, ",") + "]"
+}
+
+// sealerKeysToString returns the sealer keys formatted as candidate->sealer.
+func sealerKeysToString(keys []SealerKey) string {
+	slice := make([]string, 0, len(keys))
+	for _, key := range keys {
+		slice = append(slice, key.String())
+	}
+	return "[" + strings.Join(slice, ",") + "]"
+}
+
+// configProposalsToString returns the proposals formatted as proposer:hash.
+func configProposalsToString(proposals []ConfigProposal) string {
+	slice := make([]string, 0, len(proposals))
+	for _, proposal := range proposals {
+		slice = append(slice, proposal.Proposer.String()+":"+proposal.Hash().String())
+	}
+	return "[" + strings.Join(slice, ",") + "]"
+}
+
+// configApprovalsToString returns the approvals formatted as validator:hash.
+func configApprovalsToString(approvals []ConfigApproval) string {
+	slice := make([]string, 0, len(approvals))
+	for _, approval := range approvals {
+		slice = append(slice, approval.Validator.String()+":"+approval.Proposal.String())
+	}
+	return "[" + strings.Join(slice, ",") + "]"
+}
+
+// chainConfigToString returns the json of a chain config.
+func chainConfigToString(config params.EqualityConfig) string {
+	data, err := json.Marshal(config)
+	if err != nil {
+		return err.Error()
+	}
+	return string(data)
+}
+
+// Compute the addresses of theirs missing in ours and of ours missing in theirs.
+func addressesDifference(ours, theirs []common.Address) (added, removed []common.Address) {
+	oursSet, theirsSet := NewAddressSet(ours...), NewAddressSet(theirs...)
+	for _, address := range theirs {
+		if !oursSet.Contains(address) {
+			added = append(added, address)
+		}
+	}
+	for _, address := range ours {
+		if !theirsSet.Contains(address) {
+			removed = append(removed, address)
+		}
+	}
+	return added, removed
+}
+
+// Compare two common.Address slices element by element.
+func addressesEqual(a, b []common.Address) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for idx := range a {
+		if a[idx] != b[idx] {
+			return false
+		}
+	}
+	return true
+}
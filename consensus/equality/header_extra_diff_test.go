@@ -0,0 +1,64 @@
+package equality
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/SecretBlockChain/go-secret/common"
+	"github.com/SecretBlockChain/go-secret/params"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHeaderExtraDifference(t *testing.T) {
+	address1 := common.HexToAddress("0xcc7c8317b21e1cea6139700c3c46c21af998d14c")
+	address2 := common.HexToAddress("0x44d1ce0b7cb3588bca96151fe1bc05af38f91b6c")
+	address3 := common.HexToAddress("0x0d4ea9bd8ca6a1e1ad9d4c8d7f33d692bcccd8c7")
+	address4 := common.HexToAddress("0x7a6f8f2ef53b1d1a3cd9c6f2a1e3b28e6f0a1c55")
+
+	ours := HeaderExtra{
+		Epoch:                  2,
+		EpochBlock:             180,
+		CurrentBlockCandidates: []common.Address{address1, address2, address3},
+		CurrentEpochValidators: []common.Address{address1, address2},
+		ChainConfig:            []params.EqualityConfig{{Epoch: 180, MinCandidateBalance: big.NewInt(1)}},
+	}
+	assert.Empty(t, ours.Difference(ours))
+
+	// Permutations of the candidate sets are not a difference
+	theirs := ours
+	theirs.CurrentBlockCandidates = []common.Address{address3, address1, address2}
+	assert.Empty(t, ours.Difference(theirs))
+
+	// Overlapping sets report the added and removed addresses only
+	theirs.Root.ConfigHash = common.HexToHash("0x01")
+	theirs.EpochBlock = 181
+	theirs.CurrentBlockCandidates = []common.Address{address2, address3, address4}
+	theirs.CurrentBlockCancelCandidates = []common.Address{address1}
+	theirs.CurrentEpochValidators = []common.Address{address2, address1}
+	theirs.ChainConfig = nil
+
+	diff := ours.Difference(theirs)
+	assert.Equal(t, 6, len(diff))
+	assert.Equal(t, FieldDifference{Field: "root.configHash", Ours: common.Hash{}.String(), Theirs: theirs.Root.ConfigHash.String()}, diff[0])
+	assert.Equal(t, FieldDifference{Field: "epochBlock", Ours: "180", Theirs: "181"}, diff[1])
+	assert.Equal(t, FieldDifference{
+		Field:   "currentBlockCandidates",
+		Added:   []common.Address{address4},
+		Removed: []common.Address{address1},
+	}, diff[2])
+	assert.Equal(t, FieldDifference{
+		Field: "currentBlockCancelCandidates",
+		Added: []common.Address{address1},
+	}, diff[3])
+	assert.Equal(t, "currentEpochValidators", diff[4].Field)
+	assert.Empty(t, diff[4].Added)
+	assert.Empty(t, diff[4].Removed)
+	assert.Equal(t, validatorsToString(ours.CurrentEpochValidators), diff[4].Ours)
+	assert.Equal(t, validatorsToString(theirs.CurrentEpochValidators), diff[4].Theirs)
+	assert.Equal(t, "chainConfig[0]", diff[5].Field)
+	assert.Equal(t, "", diff[5].Theirs)
+
+	assert.Equal(t, "epochBlock: 180 != 181", diff[1].String())
+	assert.Equal(t, "currentBlockCandidates: +["+address4.String()+"] -["+address1.String()+"]", diff[2].String())
+	assert.Contains(t, diff.String(), "; epochBlock: 180 != 181; ")
+}
@@ -0,0 +1,230 @@
+package equality
+
+//go:generate go test -run TestHeaderExtraGolden -update
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/SecretBlockChain/go-secret/common"
+	"github.com/SecretBlockChain/go-secret/common/hexutil"
+	"github.com/SecretBlockChain/go-secret/core/types"
+	"github.com/SecretBlockChain/go-secret/params"
+	"github.com/SecretBlockChain/go-secret/rlp"
+	"github.com/stretchr/testify/assert"
+)
+
+var updateGolden = flag.Bool("update", false, "regenerate the golden files in testdata/golden")
+
+// goldenHeaderExtra returns the canonical header extra of the golden files,
+// every field set.
+func goldenHeaderExtra() HeaderExtra {
+	address := func(b byte) common.Address {
+		return common.BytesToAddress(bytes.Repeat([]byte{b}, common.AddressLength))
+	}
+	hash := func(b byte) common.Hash { return common.BytesToHash(bytes.Repeat([]byte{b}, common.HashLength)) }
+	signature := func(b byte) hexutil.Bytes { return bytes.Repeat([]byte{b}, ExtraSeal) }
+
+	config := params.EqualityConfig{
+		Period:              3,
+		Epoch:               201600,
+		MaxValidatorsCount:  21,
+		MinCandidateBalance: big.NewInt(1000),
+		GenesisTimestamp:    1625976000,
+		Validators:          []common.Address{address(0x01), address(0x02)},
+		Pool:                address(0x0f),
+		Rewards:             params.EqualityRewards{{Number: 45000000, Reward: big.NewInt(2000)}},
+		KickOutRatio:        50,
+		DelegatedVoting:     true,
+	}
+	return HeaderExtra{
+		Root: Root{
+			EpochHash:     hash(0x11),
+			CandidateHash: hash(0x22),
+			MintCntHash:   hash(0x33),
+			ConfigHash:    hash(0x44),
+			DelegateHash:  hash(0x55),
+		},
+		Epoch:                         7,
+		EpochBlock:                    1411201,
+		CurrentBlockCandidates:        []common.Address{address(0x21), address(0x22)},
+		CurrentBlockKickOutCandidates: []common.Address{address(0x31)},
+		CurrentBlockCancelCandidates:  []common.Address{address(0x41)},
+		CurrentEpochValidators:        []common.Address{address(0x03), address(0x01), address(0x02)},
+		ChainConfig:                   []params.EqualityConfig{config},
+		CurrentBlockVotes:             []Vote{{Delegator: address(0x51), Candidate: address(0x21), Weight: big.NewInt(3000)}},
+		CurrentBlockCancelVotes:       []common.Address{address(0x52)},
+		CurrentBlockProposals:         []ConfigProposal{{Proposer: address(0x01), Config: config}},
+		CurrentBlockApprovals:         []ConfigApproval{{Validator: address(0x02), Proposal: hash(0x66)}},
+		CurrentBlockTopUps:            []TopUp{{Candidate: address(0x22), Amount: big.NewInt(500)}},
+		CurrentBlockMetadata:          []CandidateMetadata{{Candidate: address(0x21), Metadata: []byte("moniker")}},
+		CurrentBlockEvictedCandidates: []common.Address{address(0x61)},
+		Checkpoint:                    &Checkpoint{Number: 1411200, Hash: hash(0x77), Signatures: []hexutil.Bytes{signature(0x01), signature(0x02)}},
+		CurrentBlockRewardRecipients:  []RewardRecipient{{Candidate: address(0x21), Recipient: address(0x71)}},
+	}
+}
+
+// goldenExtra returns header.Extra carrying payload behind a fixed vanity and
+// a dummy seal.
+func goldenExtra(payload []byte) []byte {
+	vanity := []byte("equality golden vector")
+	extra := assembleExtra(vanity, payload)
+	for i := 0; i < ExtraSeal; i++ {
+		extra[len(extra)-ExtraSeal+i] = byte(i)
+	}
+	return extra
+}
+
+// headerExtraSchema documents the byte layout of header.Extra and the fields
+// of the rlp encoded types in encoding order.
+func headerExtraSchema() string {
+	var schema strings.Builder
+	fmt.Fprintf(&schema, `# Header extra wire format
+
+Generated by TestHeaderExtraGolden, do not edit. Run
+go test -run TestHeaderExtraGolden -update after an intended change.
+
+header.Extra = vanity (%d bytes) || payload || seal (%d bytes)
+
+The seal is the secp256k1 signature [R || S || V] of the sealer over the
+header hashed with the seal zeroed.
+
+payload = version (1 byte) || codec (1 byte) || data, version 0x%02x:
+
+- codec 0x%02x: data is the rlp of HeaderExtra, if compression does not pay off
+- codec 0x%02x: data is a gzip stream of the rlp
+- codec 0x%02x: data is a raw deflate stream of the rlp
+
+Older blocks carry version 0x%02x, version || gzip stream, or a bare gzip
+stream starting with 0x1f 0x8b.
+
+Each type is an rlp list of its fields in order. Fields tagged optional were
+appended after launch, the unset ones at the end of a list are omitted. The
+address lists of a block are sets sorted by address bytes, the votes by
+delegator, the top ups, metadata and reward recipients by candidate and the
+checkpoint signatures by bytes. The validators keep their election order.
+`, ExtraVanity, ExtraSeal, headerExtraVersion2, codecNone, codecGzip, codecDeflate, headerExtraVersion1)
+
+	seen := map[reflect.Type]bool{}
+	queue := []reflect.Type{reflect.TypeOf(HeaderExtra{})}
+	for len(queue) > 0 {
+		typ := queue[0]
+		queue = queue[1:]
+		fmt.Fprintf(&schema, "\n## %s\n\n| # | Field | RLP | Tags |\n|---|---|---|---|\n", typ.Name())
+		for i := 0; i < typ.NumField(); i++ {
+			field := typ.Field(i)
+			if field.PkgPath != "" || field.Tag.Get("rlp") == "-" {
+				continue
+			}
+			description, nested := schemaType(field.Type)
+			for _, nested := range nested {
+				if !seen[nested] {
+					seen[nested] = true
+					queue = append(queue, nested)
+				}
+			}
+			fmt.Fprintf(&schema, "| %d | %s | %s | %s |\n", i, field.Name, description, field.Tag.Get("rlp"))
+		}
+	}
+	return schema.String()
+}
+
+// schemaType describes the rlp encoding of typ and returns the struct types it
+// is made of.
+func schemaType(typ reflect.Type) (string, []reflect.Type) {
+	switch {
+	case typ == reflect.TypeOf(big.Int{}):
+		return "uint (big integer)", nil
+	case typ.Kind() == reflect.Ptr:
+		return schemaType(typ.Elem())
+	case typ.Kind() == reflect.Array && typ.Elem().Kind() == reflect.Uint8:
+		return fmt.Sprintf("bytes%d", typ.Len()), nil
+	case typ.Kind() == reflect.Slice && typ.Elem().Kind() == reflect.Uint8:
+		return "bytes", nil
+	case typ.Kind() == reflect.Slice:
+		description, nested := schemaType(typ.Elem())
+		return "list of " + description, nested
+	case typ.Kind() == reflect.Struct:
+		return typ.Name(), []reflect.Type{typ}
+	case typ.Kind() == reflect.Bool:
+		return "uint (0 or 1)", nil
+	case typ.Kind() == reflect.String:
+		return "string", nil
+	default:
+		return "uint", nil
+	}
+}
+
+func TestHeaderExtraGolden(t *testing.T) {
+	headerExtra := goldenHeaderExtra()
+	assert.True(t, headerExtra.Equal(headerExtra.Canonicalize()))
+	assert.Nil(t, headerExtra.Validate(headerExtra.EpochBlock, params.EqualityConfig{MaxValidatorsCount: 21,
+		CheckpointBlock: big.NewInt(1), MetadataBlock: big.NewInt(1), RewardRecipientBlock: big.NewInt(1)}))
+
+	fixture, err := json.MarshalIndent(headerExtra, "", "  ")
+	assert.Nil(t, err)
+	raw, err := rlp.EncodeToBytes(headerExtra)
+	assert.Nil(t, err)
+	payload, err := headerExtra.Encode()
+	assert.Nil(t, err)
+	assert.Equal(t, []byte{headerExtraVersion2, codecGzip}, payload[:2])
+	extra := goldenExtra(payload)
+
+	files := []struct {
+		name string
+		data []byte
+	}{
+		{"header_extra.json", append(fixture, '\n')},
+		{"header_extra.rlp", raw},
+		{"header_extra.gz", payload[2:]},
+		{"header_extra_extra.bin", extra},
+		{"header_extra_schema.md", []byte(headerExtraSchema())},
+	}
+	for _, file := range files {
+		path := filepath.Join("testdata", "golden", file.name)
+		if *updateGolden {
+			assert.Nil(t, ioutil.WriteFile(path, file.data, 0644))
+			continue
+		}
+		golden, err := ioutil.ReadFile(path)
+		assert.Nil(t, err)
+		if !bytes.Equal(golden, file.data) {
+			t.Errorf("%s changed, run go test -run TestHeaderExtraGolden -update if intended", path)
+		}
+	}
+
+	// The golden files decode back to the fixture at every layer
+	decoded, err := DecodeHeaderExtraRaw(raw)
+	assert.Nil(t, err)
+	assert.True(t, decoded.Equal(headerExtra))
+	reader, err := gzip.NewReader(bytes.NewReader(payload[2:]))
+	assert.Nil(t, err)
+	decompressed, err := ioutil.ReadAll(reader)
+	assert.Nil(t, err)
+	assert.Equal(t, raw, decompressed)
+	vanity, split, seal, err := SplitExtra(extra)
+	assert.Nil(t, err)
+	assert.Len(t, vanity, ExtraVanity)
+	assert.Equal(t, payload, split)
+	assert.Len(t, seal, ExtraSeal)
+	decoded, err = DecodeHeaderExtra(&types.Header{Number: big.NewInt(int64(headerExtra.EpochBlock)), Extra: extra})
+	assert.Nil(t, err)
+	assert.True(t, decoded.Equal(headerExtra))
+	var unmarshaled HeaderExtra
+	assert.Nil(t, json.Unmarshal(fixture, &unmarshaled))
+	assert.True(t, unmarshaled.Equal(headerExtra))
+
+	_, err = DecodeHeaderExtraRaw(nil)
+	assert.Equal(t, ErrEmptyExtra, err)
+	_, err = DecodeHeaderExtraRaw(payload)
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,162 @@
+package equality
+
+import (
+	"encoding/binary"
+
+	"github.com/SecretBlockChain/go-secret/common"
+	"github.com/SecretBlockChain/go-secret/consensus"
+	"github.com/SecretBlockChain/go-secret/core/types"
+	"github.com/SecretBlockChain/go-secret/ethdb"
+	"github.com/SecretBlockChain/go-secret/log"
+	"github.com/SecretBlockChain/go-secret/params"
+	"github.com/SecretBlockChain/go-secret/rlp"
+)
+
+var (
+	headerExtraIndexPrefix = []byte("equality-index-")     // key: equality-index-{number}:{headerExtraIndex}
+	headerExtraIndexHead   = []byte("equality-index-head") // key: equality-index-head:{number}
+)
+
+// defaultHeaderExtraIndexDepth is the default number of blocks behind the head
+// after which the header extras are indexed, the depth blocks are moved to the
+// freezer at, no reorg replaces them.
+const defaultHeaderExtraIndexDepth = params.FullImmutabilityThreshold
+
+// maxHeaderExtraIndexBatch is the maximum number of headers indexed at once,
+// the remaining ones are indexed on the following heads.
+const maxHeaderExtraIndexBatch = 8192
+
+// headerExtraIndex is the compact part of the header extra of an indexed block
+// historical queries are answered from, without decompressing its header.
+// Validators are only set for the first block of an epoch.
+type headerExtraIndex struct {
+	Hash       common.Hash
+	Root       Root
+	Epoch      uint64
+	EpochBlock uint64
+	Validators []common.Address `rlp:"optional"`
+}
+
+// headerExtraIndexKey returns the database key of the index of block number.
+func headerExtraIndexKey(number uint64) []byte {
+	key := make([]byte, len(headerExtraIndexPrefix)+8)
+	copy(key, headerExtraIndexPrefix)
+	binary.BigEndian.PutUint64(key[len(headerExtraIndexPrefix):], number)
+	return key
+}
+
+// readHeaderExtraIndex retrieves the index of block number, nil if not indexed.
+func readHeaderExtraIndex(db ethdb.KeyValueReader, number uint64) *headerExtraIndex {
+	data, err := db.Get(headerExtraIndexKey(number))
+	if err != nil || len(data) == 0 {
+		return nil
+	}
+	index := new(headerExtraIndex)
+	if err = rlp.DecodeBytes(data, index); err != nil {
+		log.Warn("[equality] Invalid header extra index", "number", number, "err", err)
+		return nil
+	}
+	return index
+}
+
+// readHeaderExtraIndexHead retrieves the number of the last indexed block.
+func readHeaderExtraIndexHead(db ethdb.KeyValueReader) (uint64, bool) {
+	data, err := db.Get(headerExtraIndexHead)
+	if err != nil || len(data) != 8 {
+		return 0, false
+	}
+	return binary.BigEndian.Uint64(data), true
+}
+
+// SetHeaderExtraIndexDepth sets the number of blocks behind the head after
+// which the header extras are indexed, zero disables the index.
+func (e *Equality) SetHeaderExtraIndexDepth(depth uint64) {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	e.indexDepth = depth
+}
+
+// headerExtraIndex retrieves the index of header, nil if it is not indexed or
+// the index belongs to another block at its height.
+func (e *Equality) headerExtraIndex(header *types.Header) *headerExtraIndex {
+	index := readHeaderExtraIndex(e.db, header.Number.Uint64())
+	if index == nil || index.Hash != header.Hash() {
+		return nil
+	}
+	return index
+}
+
+// writeHeaderExtraIndex writes the index of the header extra of header into
+// batch.
+func writeHeaderExtraIndex(batch ethdb.KeyValueWriter, header *types.Header, headerExtra HeaderExtra) error {
+	number := header.Number.Uint64()
+	index := headerExtraIndex{
+		Hash:       header.Hash(),
+		Root:       headerExtra.Root,
+		Epoch:      headerExtra.Epoch,
+		EpochBlock: headerExtra.EpochBlock,
+	}
+	if headerExtra.EpochBlock == number {
+		index.Validators = headerExtra.CurrentEpochValidators
+	}
+	data, err := rlp.EncodeToBytes(index)
+	if err != nil {
+		return err
+	}
+	return batch.Put(headerExtraIndexKey(number), data)
+}
+
+// IndexHeaderExtras indexes the header extras of the canonical blocks at least
+// the index depth behind head, continuing after the last indexed block. It
+// returns the number of blocks indexed, at most 8192 per call.
+func (e *Equality) IndexHeaderExtras(chain consensus.ChainHeaderReader, head *types.Header) (int, error) {
+	e.lock.RLock()
+	depth := e.indexDepth
+	e.lock.RUnlock()
+
+	if depth == 0 || head.Number.Uint64() <= depth {
+		return 0, nil
+	}
+	last := head.Number.Uint64() - depth
+
+	var number uint64 = 1
+	if indexed, ok := readHeaderExtraIndexHead(e.db); ok {
+		number = indexed + 1
+	}
+	if number > last {
+		return 0, nil
+	}
+	if last-number >= maxHeaderExtraIndexBatch {
+		last = number + maxHeaderExtraIndexBatch - 1
+	}
+
+	start := number
+	batch := e.db.NewBatch()
+	for ; number <= last; number++ {
+		header := chain.GetHeaderByNumber(number)
+		if header == nil {
+			break
+		}
+		headerExtra, err := DecodeHeaderExtra(header)
+		if err != nil {
+			return 0, err
+		}
+		if err = writeHeaderExtraIndex(batch, header, headerExtra); err != nil {
+			return 0, err
+		}
+	}
+
+	if number == start {
+		return 0, nil
+	}
+	indexed := make([]byte, 8)
+	binary.BigEndian.PutUint64(indexed, number-1)
+	if err := batch.Put(headerExtraIndexHead, indexed); err != nil {
+		return 0, err
+	}
+	if err := batch.Write(); err != nil {
+		return 0, err
+	}
+	log.Debug("[equality] Indexed header extras", "from", start, "to", number-1)
+	return int(number - start), nil
+}
@@ -0,0 +1,74 @@
+package equality
+
+import (
+	"testing"
+
+	"github.com/SecretBlockChain/go-secret/common"
+	"github.com/SecretBlockChain/go-secret/core/rawdb"
+	"github.com/SecretBlockChain/go-secret/rpc"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHeaderExtraIndex(t *testing.T) {
+	validatorA := common.HexToAddress("0xa000000000000000000000000000000000000000")
+	validatorB := common.HexToAddress("0xb000000000000000000000000000000000000000")
+	validatorC := common.HexToAddress("0xc000000000000000000000000000000000000000")
+
+	// The snapshots of the blocks are pruned
+	pruned := Root{EpochHash: common.HexToHash("0x01")}
+	first := HeaderExtra{Root: pruned, Epoch: 1, EpochBlock: 1}
+	second := HeaderExtra{Root: pruned, Epoch: 2, EpochBlock: 4}
+	transition := func(headerExtra HeaderExtra, validators ...common.Address) HeaderExtra {
+		headerExtra.CurrentEpochValidators = validators
+		return headerExtra
+	}
+	api := newTestAPI(rawdb.NewMemoryDatabase(), HeaderExtra{}, transition(first, validatorA, validatorB), first, first,
+		transition(second, validatorB, validatorC), second, second)
+	chain := api.chain.(*testHeaderChain)
+	head := chain.CurrentHeader()
+
+	api.equality.SetHeaderExtraIndexDepth(0)
+	count, err := api.equality.IndexHeaderExtras(chain, head)
+	assert.Nil(t, err)
+	assert.Zero(t, count)
+
+	api.equality.SetHeaderExtraIndexDepth(2)
+	count, err = api.equality.IndexHeaderExtras(chain, head)
+	assert.Nil(t, err)
+	assert.Equal(t, 4, count)
+	indexed, ok := readHeaderExtraIndexHead(api.equality.db)
+	assert.True(t, ok)
+	assert.Equal(t, uint64(4), indexed)
+
+	// Indexed blocks are answered without decoding their header extras
+	api.equality.headerExtras.Purge()
+	for _, test := range []struct {
+		number     rpc.BlockNumber
+		epoch      uint64
+		validators []common.Address
+	}{
+		{2, 1, []common.Address{validatorA, validatorB}},
+		{4, 2, []common.Address{validatorB, validatorC}},
+	} {
+		result, err := api.GetValidators(&test.number)
+		assert.Nil(t, err)
+		assert.Equal(t, test.epoch, uint64(result.Epoch))
+		assert.Equal(t, len(test.validators), len(result.Validators))
+		for idx, validator := range result.Validators {
+			assert.Equal(t, test.validators[idx], validator.Address)
+			assert.Nil(t, validator.CountMinted)
+		}
+	}
+	assert.Zero(t, api.equality.headerExtras.Len())
+
+	// Blocks within the depth are not indexed until the head advances
+	assert.Nil(t, api.equality.headerExtraIndex(chain.headers[5]))
+	count, err = api.equality.IndexHeaderExtras(chain, head)
+	assert.Nil(t, err)
+	assert.Zero(t, count)
+
+	// Another block at an indexed height is not answered from the index
+	other := newTestHeader(2, first)
+	other.ParentHash = common.HexToHash("0x02")
+	assert.Nil(t, api.equality.headerExtraIndex(other))
+}
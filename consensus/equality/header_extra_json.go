@@ -0,0 +1,163 @@
+package equality
+
+import (
+	"encoding/json"
+
+	"github.com/SecretBlockChain/go-secret/common"
+	"github.com/SecretBlockChain/go-secret/common/hexutil"
+	"github.com/SecretBlockChain/go-secret/core/types"
+	"github.com/SecretBlockChain/go-secret/params"
+)
+
+// rootJSON is the json representation of Root, the delegate hash is omitted
+// without delegated voting.
+type rootJSON struct {
+	EpochHash     common.Hash  `json:"epochHash"`
+	CandidateHash common.Hash  `json:"candidateHash"`
+	MintCntHash   common.Hash  `json:"mintCntHash"`
+	ConfigHash    common.Hash  `json:"configHash"`
+	DelegateHash  *common.Hash `json:"delegateHash,omitempty"`
+}
+
+// MarshalJSON marshals as JSON.
+func (root Root) MarshalJSON() ([]byte, error) {
+	enc := rootJSON{
+		EpochHash:     root.EpochHash,
+		CandidateHash: root.CandidateHash,
+		MintCntHash:   root.MintCntHash,
+		ConfigHash:    root.ConfigHash,
+	}
+	if root.DelegateHash != (common.Hash{}) {
+		enc.DelegateHash = &root.DelegateHash
+	}
+	return json.Marshal(enc)
+}
+
+// UnmarshalJSON unmarshals from JSON.
+func (root *Root) UnmarshalJSON(input []byte) error {
+	var dec rootJSON
+	if err := json.Unmarshal(input, &dec); err != nil {
+		return err
+	}
+	*root = Root{
+		EpochHash:     dec.EpochHash,
+		CandidateHash: dec.CandidateHash,
+		MintCntHash:   dec.MintCntHash,
+		ConfigHash:    dec.ConfigHash,
+	}
+	if dec.DelegateHash != nil {
+		root.DelegateHash = *dec.DelegateHash
+	}
+	return nil
+}
+
+// checksumAddresses is an address list marshaling as EIP55 checksummed
+// strings, empty lists are marshaled as [] rather than null.
+type checksumAddresses []common.Address
+
+// MarshalJSON marshals as JSON.
+func (addresses checksumAddresses) MarshalJSON() ([]byte, error) {
+	slice := make([]string, 0, len(addresses))
+	for _, address := range addresses {
+		slice = append(slice, address.Hex())
+	}
+	return json.Marshal(slice)
+}
+
+// HeaderExtraJSON is the json representation of HeaderExtra.
+type HeaderExtraJSON struct {
+	Root                          Root                    `json:"root"`
+	Epoch                         hexutil.Uint64          `json:"epoch"`
+	EpochBlock                    hexutil.Uint64          `json:"epochBlock"`
+	CurrentBlockCandidates        checksumAddresses       `json:"currentBlockCandidates"`
+	CurrentBlockKickOutCandidates checksumAddresses       `json:"currentBlockKickOutCandidates"`
+	CurrentBlockCancelCandidates  checksumAddresses       `json:"currentBlockCancelCandidates"`
+	CurrentEpochValidators        checksumAddresses       `json:"currentEpochValidators"`
+	ChainConfig                   []params.EqualityConfig `json:"chainConfig"`
+	CurrentBlockVotes             []Vote                  `json:"currentBlockVotes,omitempty"`
+	CurrentBlockCancelVotes       checksumAddresses       `json:"currentBlockCancelVotes,omitempty"`
+	CurrentBlockProposals         []ConfigProposal        `json:"currentBlockProposals,omitempty"`
+	CurrentBlockApprovals         []ConfigApproval        `json:"currentBlockApprovals,omitempty"`
+	CurrentBlockTopUps            []TopUp                 `json:"currentBlockTopUps,omitempty"`
+	CurrentBlockMetadata          []CandidateMetadata     `json:"currentBlockMetadata,omitempty"`
+	CurrentBlockEvictedCandidates checksumAddresses       `json:"currentBlockEvictedCandidates,omitempty"`
+	Checkpoint                    *Checkpoint             `json:"checkpoint,omitempty"`
+	CurrentBlockRewardRecipients  []RewardRecipient       `json:"currentBlockRewardRecipients,omitempty"`
+	CurrentBlockSealerKeys        []SealerKey             `json:"currentBlockSealerKeys,omitempty"`
+}
+
+// JSON returns the json representation of HeaderExtra.
+func (headerExtra HeaderExtra) JSON() *HeaderExtraJSON {
+	chainConfig := headerExtra.ChainConfig
+	if chainConfig == nil {
+		chainConfig = make([]params.EqualityConfig, 0)
+	}
+	return &HeaderExtraJSON{
+		Root:                          headerExtra.Root,
+		Epoch:                         hexutil.Uint64(headerExtra.Epoch),
+		EpochBlock:                    hexutil.Uint64(headerExtra.EpochBlock),
+		CurrentBlockCandidates:        headerExtra.CurrentBlockCandidates,
+		CurrentBlockKickOutCandidates: headerExtra.CurrentBlockKickOutCandidates,
+		CurrentBlockCancelCandidates:  headerExtra.CurrentBlockCancelCandidates,
+		CurrentEpochValidators:        headerExtra.CurrentEpochValidators,
+		ChainConfig:                   chainConfig,
+		CurrentBlockVotes:             headerExtra.CurrentBlockVotes,
+		CurrentBlockCancelVotes:       headerExtra.CurrentBlockCancelVotes,
+		CurrentBlockProposals:         headerExtra.CurrentBlockProposals,
+		CurrentBlockApprovals:         headerExtra.CurrentBlockApprovals,
+		CurrentBlockTopUps:            headerExtra.CurrentBlockTopUps,
+		CurrentBlockMetadata:          headerExtra.CurrentBlockMetadata,
+		CurrentBlockEvictedCandidates: headerExtra.CurrentBlockEvictedCandidates,
+		Checkpoint:                    headerExtra.Checkpoint,
+		CurrentBlockRewardRecipients:  headerExtra.CurrentBlockRewardRecipients,
+		CurrentBlockSealerKeys:        headerExtra.CurrentBlockSealerKeys,
+	}
+}
+
+// HeaderExtra converts the json representation back to HeaderExtra.
+func (enc *HeaderExtraJSON) HeaderExtra() HeaderExtra {
+	return HeaderExtra{
+		Root:                          enc.Root,
+		Epoch:                         uint64(enc.Epoch),
+		EpochBlock:                    uint64(enc.EpochBlock),
+		CurrentBlockCandidates:        enc.CurrentBlockCandidates,
+		CurrentBlockKickOutCandidates: enc.CurrentBlockKickOutCandidates,
+		CurrentBlockCancelCandidates:  enc.CurrentBlockCancelCandidates,
+		CurrentEpochValidators:        enc.CurrentEpochValidators,
+		ChainConfig:                   enc.ChainConfig,
+		CurrentBlockVotes:             enc.CurrentBlockVotes,
+		CurrentBlockCancelVotes:       enc.CurrentBlockCancelVotes,
+		CurrentBlockProposals:         enc.CurrentBlockProposals,
+		CurrentBlockApprovals:         enc.CurrentBlockApprovals,
+		CurrentBlockTopUps:            enc.CurrentBlockTopUps,
+		CurrentBlockMetadata:          enc.CurrentBlockMetadata,
+		CurrentBlockEvictedCandidates: enc.CurrentBlockEvictedCandidates,
+		Checkpoint:                    enc.Checkpoint,
+		CurrentBlockRewardRecipients:  enc.CurrentBlockRewardRecipients,
+		CurrentBlockSealerKeys:        enc.CurrentBlockSealerKeys,
+	}
+}
+
+// MarshalJSON marshals as JSON.
+func (headerExtra HeaderExtra) MarshalJSON() ([]byte, error) {
+	return json.Marshal(headerExtra.JSON())
+}
+
+// UnmarshalJSON unmarshals from JSON.
+func (headerExtra *HeaderExtra) UnmarshalJSON(input []byte) error {
+	var dec HeaderExtraJSON
+	if err := json.Unmarshal(input, &dec); err != nil {
+		return err
+	}
+	*headerExtra = dec.HeaderExtra()
+	return nil
+}
+
+// HeaderExtraToJSON decodes the HeaderExtra of header and marshals it as JSON.
+func HeaderExtraToJSON(header *types.Header) ([]byte, error) {
+	headerExtra, err := DecodeHeaderExtra(header)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(headerExtra)
+}
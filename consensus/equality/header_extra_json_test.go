@@ -0,0 +1,83 @@
+package equality
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"strings"
+	"testing"
+
+	"github.com/SecretBlockChain/go-secret/common"
+	"github.com/SecretBlockChain/go-secret/core/types"
+	"github.com/SecretBlockChain/go-secret/params"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHeaderExtraJSON(t *testing.T) {
+	address1 := common.HexToAddress("0xcc7c8317b21e1cea6139700c3c46c21af998d14c")
+	address2 := common.HexToAddress("0x44d1ce0b7cb3588bca96151fe1bc05af38f91b6c")
+	headerExtra := HeaderExtra{
+		Root: Root{
+			EpochHash:     common.HexToHash("0x01"),
+			CandidateHash: common.HexToHash("0x02"),
+			MintCntHash:   common.HexToHash("0x03"),
+			ConfigHash:    common.HexToHash("0x04"),
+		},
+		Epoch:                  3,
+		EpochBlock:             360,
+		CurrentBlockCandidates: []common.Address{address1},
+		CurrentEpochValidators: []common.Address{address1, address2},
+		ChainConfig: []params.EqualityConfig{{
+			Period:              3,
+			Epoch:               180,
+			MaxValidatorsCount:  21,
+			MinCandidateBalance: big.NewInt(1000),
+			Validators:          []common.Address{address2},
+		}},
+	}
+
+	data, err := json.Marshal(headerExtra)
+	assert.Nil(t, err)
+	assert.True(t, strings.Contains(string(data), address1.Hex()))
+	assert.True(t, strings.Contains(string(data), `"currentBlockKickOutCandidates":[]`))
+	assert.True(t, strings.Contains(string(data), `"epochHash":"0x0000000000000000000000000000000000000000000000000000000000000001"`))
+
+	config, err := json.Marshal(headerExtra.ChainConfig[0])
+	assert.Nil(t, err)
+	assert.True(t, strings.Contains(string(data), string(config)))
+
+	var decoded HeaderExtra
+	assert.Nil(t, json.Unmarshal(data, &decoded))
+	assert.True(t, decoded.Equal(headerExtra))
+
+	again, err := json.Marshal(decoded)
+	assert.Nil(t, err)
+	assert.True(t, bytes.Equal(data, again))
+
+	// Empty HeaderExtra
+	data, err = json.Marshal(HeaderExtra{})
+	assert.Nil(t, err)
+	assert.False(t, strings.Contains(string(data), "null"))
+	assert.Nil(t, json.Unmarshal(data, &decoded))
+	again, err = json.Marshal(decoded)
+	assert.Nil(t, err)
+	assert.True(t, bytes.Equal(data, again))
+}
+
+func TestHeaderExtraToJSON(t *testing.T) {
+	headerExtra := HeaderExtra{Epoch: 1, EpochBlock: 1}
+	payload, err := headerExtra.Encode()
+	assert.Nil(t, err)
+
+	header := &types.Header{Extra: append(append(make([]byte, ExtraVanity), payload...), make([]byte, ExtraSeal)...)}
+	data, err := HeaderExtraToJSON(header)
+	assert.Nil(t, err)
+
+	want, err := json.Marshal(headerExtra)
+	assert.Nil(t, err)
+	assert.Equal(t, string(want), string(data))
+
+	_, err = HeaderExtraToJSON(&types.Header{})
+	assert.True(t, errors.Is(err, errMissingVanity))
+}
@@ -1,11 +1,25 @@
 package equality
 
 import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/big"
 	"math/rand"
+	"reflect"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/SecretBlockChain/go-secret/common"
+	"github.com/SecretBlockChain/go-secret/common/hexutil"
+	"github.com/SecretBlockChain/go-secret/core/types"
+	"github.com/SecretBlockChain/go-secret/log"
+	"github.com/SecretBlockChain/go-secret/params"
+	"github.com/SecretBlockChain/go-secret/rlp"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -26,6 +40,7 @@ func TestEncodeHeaderExtra(t *testing.T) {
 
 	newHeaderExtra, err := NewHeaderExtra(data)
 	assert.Nil(t, err)
+	headerExtra = headerExtra.Canonicalize()
 	assert.Equal(t, newHeaderExtra.Root.EpochHash, headerExtra.Root.EpochHash)
 	assert.Equal(t, newHeaderExtra.Root.CandidateHash, headerExtra.Root.CandidateHash)
 	assert.Equal(t, newHeaderExtra.Root.MintCntHash, headerExtra.Root.MintCntHash)
@@ -34,6 +49,46 @@ func TestEncodeHeaderExtra(t *testing.T) {
 	assert.Equal(t, newHeaderExtra.CurrentBlockCandidates, headerExtra.CurrentBlockCandidates)
 }
 
+func TestEncodeHeaderExtraLayout(t *testing.T) {
+	headerExtra := HeaderExtra{
+		Epoch:                  2,
+		EpochBlock:             180,
+		CurrentEpochValidators: []common.Address{common.HexToAddress("0xcc7c8317b21e1cea6139700c3c46c21af998d14c")},
+	}
+	extra, err := EncodeHeaderExtra([]byte("secret"), headerExtra)
+	assert.Nil(t, err)
+
+	// The layout survives the rlp round trip of a real header
+	data, err := rlp.EncodeToBytes(&types.Header{Number: big.NewInt(180), Extra: extra})
+	assert.Nil(t, err)
+	var header types.Header
+	assert.Nil(t, rlp.DecodeBytes(data, &header))
+
+	vanity, payload, seal, err := SplitExtra(header.Extra)
+	assert.Nil(t, err)
+	assert.Equal(t, append([]byte("secret"), make([]byte, ExtraVanity-6)...), vanity)
+	assert.Equal(t, make([]byte, ExtraSeal), seal)
+	want, err := headerExtra.Encode()
+	assert.Nil(t, err)
+	assert.Equal(t, want, payload)
+	decoded, err := DecodeHeaderExtra(&header)
+	assert.Nil(t, err)
+	assert.True(t, decoded.Equal(headerExtra))
+
+	// Vanity longer than its space is truncated
+	long := bytes.Repeat([]byte{0x01}, ExtraVanity+1)
+	extra, err = EncodeHeaderExtra(long, headerExtra)
+	assert.Nil(t, err)
+	vanity, _, _, err = SplitExtra(extra)
+	assert.Nil(t, err)
+	assert.Equal(t, long[:ExtraVanity], vanity)
+
+	_, _, _, err = SplitExtra(make([]byte, ExtraVanity-1))
+	assert.True(t, errors.Is(err, errMissingVanity))
+	_, _, _, err = SplitExtra(make([]byte, ExtraVanity+ExtraSeal-1))
+	assert.True(t, errors.Is(err, errMissingSignature))
+}
+
 func TestHeaderExtraEqual(t *testing.T) {
 	var headerExtra HeaderExtra
 	var otherHeaderExtra HeaderExtra
@@ -55,3 +110,674 @@ func TestHeaderExtraEqual(t *testing.T) {
 	otherHeaderExtra.CurrentEpochValidators = append(otherHeaderExtra.CurrentEpochValidators, headerExtra.CurrentEpochValidators[0])
 	assert.True(t, headerExtra.Equal(otherHeaderExtra))
 }
+
+// headerExtraNext is a hypothetical successor layout carrying an additional field.
+type headerExtraNext struct {
+	HeaderExtra HeaderExtra
+	Delegators  []common.Address
+}
+
+func TestHeaderExtraVersions(t *testing.T) {
+	headerExtra := HeaderExtra{
+		Epoch:                  2,
+		EpochBlock:             180,
+		CurrentEpochValidators: []common.Address{common.HexToAddress("0xcc7c8317b21e1cea6139700c3c46c21af998d14c")},
+	}
+
+	// Legacy encoding without version prefix
+	legacy, err := encodeVersioned(headerExtraVersionLegacy, headerExtra)
+	assert.Nil(t, err)
+	assert.True(t, isGzip(legacy))
+	decoded, err := NewHeaderExtra(legacy)
+	assert.Nil(t, err)
+	assert.True(t, decoded.Equal(headerExtra))
+
+	// Version 1 encoding, gzip without codec byte
+	v1, err := encodeVersioned(headerExtraVersion1, headerExtra)
+	assert.Nil(t, err)
+	decoded, err = NewHeaderExtra(v1)
+	assert.Nil(t, err)
+	assert.True(t, decoded.Equal(headerExtra))
+
+	// Current encoding
+	data, err := headerExtra.Encode()
+	assert.Nil(t, err)
+	assert.Equal(t, headerExtraVersion, data[0])
+	decoded, err = NewHeaderExtra(data)
+	assert.Nil(t, err)
+	assert.True(t, decoded.Equal(headerExtra))
+
+	// Unknown version
+	_, err = NewHeaderExtra(append([]byte{0x7f}, data[1:]...))
+	assert.Equal(t, errUnknownHeaderExtraVersion, err)
+	_, err = NewHeaderExtra(nil)
+	assert.Equal(t, ErrEmptyExtra, err)
+
+	// Successor layout registered under a new version
+	const version byte = 0x7f
+	headerExtraDecoders[version] = func(payload []byte, limit uint64) (HeaderExtra, error) {
+		data, err := decompress(codecGzip, payload, limit)
+		if err != nil {
+			return HeaderExtra{}, err
+		}
+		var next headerExtraNext
+		if err := rlp.DecodeBytes(data, &next); err != nil {
+			return HeaderExtra{}, err
+		}
+		return next.HeaderExtra, nil
+	}
+	defer delete(headerExtraDecoders, version)
+
+	next := headerExtraNext{HeaderExtra: headerExtra, Delegators: []common.Address{common.HexToAddress("0x44d1ce0b7cb3588bca96151fe1bc05af38f91b6c")}}
+	data, err = encodeVersioned(version, next)
+	assert.Nil(t, err)
+	decoded, err = NewHeaderExtra(data)
+	assert.Nil(t, err)
+	assert.True(t, decoded.Equal(headerExtra))
+
+	decoded, err = NewHeaderExtra(legacy)
+	assert.Nil(t, err)
+	assert.True(t, decoded.Equal(headerExtra))
+}
+
+func TestHeaderExtraHash(t *testing.T) {
+	// The hash of the sample is pinned, a change of the encoding changes it
+	data, err := ioutil.ReadFile("testdata/header_extra_hash.json")
+	assert.Nil(t, err)
+	var vector struct {
+		HeaderExtra HeaderExtra `json:"headerExtra"`
+		Hash        common.Hash `json:"hash"`
+	}
+	assert.Nil(t, json.Unmarshal(data, &vector))
+	headerExtra := vector.HeaderExtra
+	assert.Equal(t, vector.Hash, headerExtra.Hash())
+
+	// Stable across the encoding versions and compressions
+	for _, version := range []byte{headerExtraVersionLegacy, headerExtraVersion1} {
+		data, err := encodeVersioned(version, headerExtra)
+		assert.Nil(t, err)
+		decoded, err := NewHeaderExtra(data)
+		assert.Nil(t, err)
+		assert.Equal(t, vector.Hash, decoded.Hash(), "version %d", version)
+	}
+	for _, config := range []params.EqualityConfig{
+		{},
+		{Compression: "gzip", CompressionLevel: 1},
+		{Compression: "deflate", CompressionLevel: 9},
+	} {
+		data, err := headerExtra.EncodeWith(config)
+		assert.Nil(t, err)
+		decoded, err := NewHeaderExtra(data)
+		assert.Nil(t, err)
+		assert.Equal(t, vector.Hash, decoded.Hash(), "compression %q level %d", config.Compression, config.CompressionLevel)
+	}
+
+	// The candidate lists are sets, the validators keep their order
+	reordered := headerExtra
+	reordered.CurrentBlockCandidates = []common.Address{headerExtra.CurrentBlockCandidates[1], headerExtra.CurrentBlockCandidates[0]}
+	reordered.ChainConfig = []params.EqualityConfig{headerExtra.ChainConfig[0]}
+	reordered.ChainConfig[0].TurnBlock = big.NewInt(0)
+	assert.True(t, reordered.Equal(headerExtra))
+	assert.Equal(t, vector.Hash, reordered.Hash())
+	reordered.CurrentEpochValidators = []common.Address{headerExtra.CurrentEpochValidators[1], headerExtra.CurrentEpochValidators[0]}
+	assert.False(t, reordered.Equal(headerExtra))
+	assert.NotEqual(t, vector.Hash, reordered.Hash())
+
+	changed := headerExtra
+	changed.Epoch++
+	assert.NotEqual(t, vector.Hash, changed.Hash())
+}
+
+func TestHeaderExtraCompat(t *testing.T) {
+	// The encodings of the header extras of every format in use are pinned,
+	// the fields appended since decode into their zero values and encode
+	// back to the same bytes
+	data, err := ioutil.ReadFile("testdata/header_extra_compat.json")
+	assert.Nil(t, err)
+	var vectors []struct {
+		Name        string        `json:"name"`
+		HeaderExtra HeaderExtra   `json:"headerExtra"`
+		RLP         hexutil.Bytes `json:"rlp"`
+		Extra       hexutil.Bytes `json:"extra"`
+		Hash        common.Hash   `json:"hash"`
+	}
+	assert.Nil(t, json.Unmarshal(data, &vectors))
+	assert.NotEmpty(t, vectors)
+	for _, vector := range vectors {
+		decoded, err := NewHeaderExtra(vector.Extra)
+		assert.Nil(t, err, vector.Name)
+		assert.True(t, decoded.Equal(vector.HeaderExtra), "%s: %v", vector.Name, decoded.Difference(vector.HeaderExtra))
+		assert.Equal(t, vector.Hash, decoded.Hash(), vector.Name)
+
+		encoded, err := rlp.EncodeToBytes(decoded)
+		assert.Nil(t, err, vector.Name)
+		assert.Equal(t, []byte(vector.RLP), encoded, vector.Name)
+		var raw HeaderExtra
+		assert.Nil(t, rlp.DecodeBytes(vector.RLP, &raw), vector.Name)
+		assert.True(t, raw.Equal(decoded), vector.Name)
+	}
+}
+
+// headerExtraLayouts are the rlp encoded fields of the header extra and the
+// types it is made of in encoding order. Fields are only ever appended and
+// optional in rlp, the ones appended after this list included.
+var headerExtraLayouts = []struct {
+	value  interface{}
+	fields []string
+}{
+	{Root{}, []string{"EpochHash", "CandidateHash", "MintCntHash", "ConfigHash", "DelegateHash"}},
+	{HeaderExtra{}, []string{"Root", "Epoch", "EpochBlock", "CurrentBlockCandidates", "CurrentBlockKickOutCandidates",
+		"CurrentBlockCancelCandidates", "CurrentEpochValidators", "ChainConfig", "CurrentBlockVotes", "CurrentBlockCancelVotes",
+		"CurrentBlockProposals", "CurrentBlockApprovals", "CurrentBlockTopUps", "CurrentBlockMetadata", "CurrentBlockEvictedCandidates",
+		"Checkpoint", "CurrentBlockRewardRecipients"}},
+	{Vote{}, []string{"Delegator", "Candidate", "Weight"}},
+	{ConfigProposal{}, []string{"Proposer", "Config"}},
+	{ConfigApproval{}, []string{"Validator", "Proposal"}},
+	{TopUp{}, []string{"Candidate", "Amount"}},
+	{CandidateMetadata{}, []string{"Candidate", "Metadata"}},
+	{Checkpoint{}, []string{"Number", "Hash", "Signatures"}},
+	{RewardRecipient{}, []string{"Candidate", "Recipient"}},
+	{Candidate{}, []string{"Staked", "BlockNumber", "Exiting", "Metadata", "RewardRecipient"}},
+}
+
+func TestHeaderExtraLayout(t *testing.T) {
+	for _, layout := range headerExtraLayouts {
+		typ := reflect.TypeOf(layout.value)
+		if typ.NumField() < len(layout.fields) {
+			t.Fatalf("%s has %d fields, want at least %d: fields are append only", typ.Name(), typ.NumField(), len(layout.fields))
+		}
+		for idx, name := range layout.fields {
+			if field := typ.Field(idx); field.Name != name {
+				t.Fatalf("%s field %d is %s, want %s: fields are append only", typ.Name(), idx, field.Name, name)
+			}
+		}
+		for idx := len(layout.fields); idx < typ.NumField(); idx++ {
+			field := typ.Field(idx)
+			if !strings.Contains(field.Tag.Get("rlp"), "optional") {
+				t.Fatalf("%s field %s appended without the rlp optional tag", typ.Name(), field.Name)
+			}
+		}
+	}
+}
+
+func TestHeaderExtraCompression(t *testing.T) {
+	headerExtra := newTestHeaderExtra(21)
+
+	tests := []struct {
+		config params.EqualityConfig
+		codec  byte
+	}{
+		{params.EqualityConfig{}, codecGzip},
+		{params.EqualityConfig{Compression: "gzip", CompressionLevel: 1}, codecGzip},
+		{params.EqualityConfig{Compression: "gzip", CompressionLevel: 9}, codecGzip},
+		{params.EqualityConfig{Compression: "deflate"}, codecDeflate},
+		{params.EqualityConfig{Compression: "deflate", CompressionLevel: 9}, codecDeflate},
+	}
+	for _, test := range tests {
+		data, err := headerExtra.EncodeWith(test.config)
+		assert.Nil(t, err)
+		assert.Equal(t, []byte{headerExtraVersion2, test.codec}, data[:2])
+
+		decoded, err := NewHeaderExtra(data)
+		assert.Nil(t, err)
+		assert.True(t, decoded.Equal(headerExtra))
+	}
+
+	_, err := headerExtra.EncodeWith(params.EqualityConfig{Compression: "zstd"})
+	assert.True(t, errors.Is(err, errUnknownCompression))
+	_, err = headerExtra.EncodeWith(params.EqualityConfig{CompressionLevel: 10})
+	assert.True(t, errors.Is(err, errUnknownCompression))
+
+	data, err := headerExtra.Encode()
+	assert.Nil(t, err)
+	data[1] = 0x7f
+	_, err = NewHeaderExtra(data)
+	assert.Equal(t, errUnknownCompression, err)
+	_, err = NewHeaderExtra([]byte{headerExtraVersion2})
+	assert.Equal(t, errUnknownCompression, err)
+}
+
+func TestHeaderExtraRawPayload(t *testing.T) {
+	rand := rand.New(rand.NewSource(time.Now().Unix()))
+	randomRoot := func() Root {
+		var root Root
+		rand.Read(root.EpochHash[:])
+		rand.Read(root.CandidateHash[:])
+		rand.Read(root.MintCntHash[:])
+		rand.Read(root.ConfigHash[:])
+		return root
+	}
+
+	// Non-epoch blocks only carry the Root and epoch numbers, stored uncompressed
+	minimal := HeaderExtra{Root: randomRoot(), Epoch: 12, EpochBlock: 345600}
+	raw, err := rlp.EncodeToBytes(minimal)
+	assert.Nil(t, err)
+	data, err := minimal.Encode()
+	assert.Nil(t, err)
+	assert.Equal(t, []byte{headerExtraVersion2, codecNone}, data[:2])
+	assert.Equal(t, len(raw)+2, len(data))
+	decoded, err := NewHeaderExtra(data)
+	assert.Nil(t, err)
+	assert.True(t, decoded.Equal(minimal))
+
+	_, err = NewHeaderExtraWithLimit(data, uint64(len(raw)-1))
+	assert.Equal(t, errHeaderExtraTooLarge, err)
+
+	// Epoch transitions repeat the elected validators from the candidates
+	epoch := newBenchmarkHeaderExtra()
+	epoch.Root = randomRoot()
+	epoch.CurrentEpochValidators = epoch.CurrentBlockCandidates[:21]
+	raw, err = rlp.EncodeToBytes(epoch)
+	assert.Nil(t, err)
+	data, err = epoch.EncodeWith(params.EqualityConfig{CompressionLevel: 9})
+	assert.Nil(t, err)
+	assert.Equal(t, []byte{headerExtraVersion2, codecGzip}, data[:2])
+	assert.Less(t, len(data), len(raw))
+	decoded, err = NewHeaderExtra(data)
+	assert.Nil(t, err)
+	assert.True(t, decoded.Equal(epoch))
+}
+
+func TestHeaderExtraSizeLimit(t *testing.T) {
+	// A highly compressible HeaderExtra inflating to several megabytes
+	var bomb HeaderExtra
+	candidate := common.HexToAddress("0xcc7c8317b21e1cea6139700c3c46c21af998d14c")
+	bomb.CurrentBlockCandidates = make([]common.Address, 200000)
+	for i := range bomb.CurrentBlockCandidates {
+		bomb.CurrentBlockCandidates[i] = candidate
+	}
+	data, err := bomb.Encode()
+	assert.Nil(t, err)
+	assert.True(t, len(data) < 64*1024)
+
+	_, err = NewHeaderExtra(data)
+	assert.Equal(t, errHeaderExtraTooLarge, err)
+
+	// The chain config may lower the limit
+	var headerExtra HeaderExtra
+	headerExtra.CurrentBlockCandidates = []common.Address{candidate, candidate}
+	data, err = headerExtra.Encode()
+	assert.Nil(t, err)
+
+	size, err := rlp.EncodeToBytes(headerExtra)
+	assert.Nil(t, err)
+	limit := headerExtraLimit(params.EqualityConfig{MaxHeaderExtraSize: uint64(len(size))})
+	_, err = NewHeaderExtraWithLimit(data, limit)
+	assert.Nil(t, err)
+	_, err = NewHeaderExtraWithLimit(data, limit-1)
+	assert.Equal(t, errHeaderExtraTooLarge, err)
+
+	assert.Equal(t, uint64(defaultMaxHeaderExtraSize), headerExtraLimit(params.EqualityConfig{}))
+	assert.Equal(t, uint64(maxHeaderExtraSizeCap), headerExtraLimit(params.EqualityConfig{MaxHeaderExtraSize: 1 << 30}))
+}
+
+func TestDecodeHeaderExtraErrors(t *testing.T) {
+	valid, err := HeaderExtra{Epoch: 1, EpochBlock: 1}.Encode()
+	assert.Nil(t, err)
+	assert.Equal(t, codecGzip, valid[1])
+
+	garbage := bytes.NewBuffer([]byte{headerExtraVersion2, codecGzip})
+	w := gzip.NewWriter(garbage)
+	w.Write([]byte{0xc3, 0x01, 0x02})
+	w.Close()
+
+	wrap := func(payload []byte) []byte {
+		extra := append(make([]byte, ExtraVanity), payload...)
+		return append(extra, make([]byte, ExtraSeal)...)
+	}
+	tests := []struct {
+		name  string
+		extra []byte
+		err   error
+	}{
+		{"missing vanity", make([]byte, ExtraVanity-1), errMissingVanity},
+		{"missing signature", make([]byte, ExtraVanity+ExtraSeal-1), errMissingSignature},
+		{"empty payload", wrap(nil), ErrEmptyExtra},
+		{"truncated gzip", wrap(valid[:len(valid)/2]), errInvalidHeaderExtraCompression},
+		{"gzip header only", wrap(valid[:12]), errInvalidHeaderExtraCompression},
+		{"legacy gzip header only", wrap(valid[2:12]), errInvalidHeaderExtraCompression},
+		{"garbage rlp", wrap(garbage.Bytes()), errInvalidHeaderExtraRLP},
+		{"truncated raw rlp", wrap([]byte{headerExtraVersion2, codecNone, 0xc3, 0x01}), errInvalidHeaderExtraRLP},
+	}
+	for _, test := range tests {
+		header := &types.Header{Number: big.NewInt(7), Extra: test.extra}
+		_, err := DecodeHeaderExtra(header)
+		assert.True(t, errors.Is(err, test.err), "%s: have %v, want %v", test.name, err, test.err)
+		assert.True(t, strings.Contains(err.Error(), header.Hash().Hex()), test.name)
+	}
+
+	// The full payload decodes
+	headerExtra, err := DecodeHeaderExtra(&types.Header{Number: big.NewInt(7), Extra: wrap(valid)})
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(1), headerExtra.EpochBlock)
+}
+
+func TestRootDifference(t *testing.T) {
+	root := Root{EpochHash: common.HexToHash("0x01"), CandidateHash: common.HexToHash("0x02")}
+	other := Root{EpochHash: common.HexToHash("0x01"), CandidateHash: common.HexToHash("0x03"), ConfigHash: common.HexToHash("0x04")}
+
+	assert.Empty(t, root.Difference(root))
+	diff := root.Difference(other)
+	assert.Equal(t, 2, len(diff))
+	assert.True(t, strings.HasPrefix(diff[0], "candidateHash: "))
+	assert.True(t, strings.HasPrefix(diff[1], "configHash: "))
+
+	var records []*log.Record
+	logger := log.New()
+	logger.SetHandler(log.FuncHandler(func(r *log.Record) error {
+		records = append(records, r)
+		return nil
+	}))
+
+	root.LogDifference(logger, 10, root)
+	assert.Empty(t, records)
+
+	root.LogDifference(logger, 10, other)
+	assert.Equal(t, 1, len(records))
+	assert.Equal(t, log.LvlWarn, records[0].Lvl)
+	assert.Equal(t, []interface{}{
+		"number", uint64(10),
+		"candidateHash", root.CandidateHash.String() + " != " + other.CandidateHash.String(),
+		"configHash", root.ConfigHash.String() + " != " + other.ConfigHash.String(),
+	}, records[0].Ctx)
+}
+
+// benchmarkCompressions are the compression settings compared by benchmarks.
+var benchmarkCompressions = []params.EqualityConfig{
+	{Compression: "gzip", CompressionLevel: 1},
+	{Compression: "gzip"},
+	{Compression: "gzip", CompressionLevel: 9},
+	{Compression: "deflate", CompressionLevel: 1},
+	{Compression: "deflate"},
+	{Compression: "deflate", CompressionLevel: 9},
+}
+
+// newBenchmarkHeaderExtra returns a HeaderExtra with 21 validators and 200 candidates.
+func newBenchmarkHeaderExtra() HeaderExtra {
+	headerExtra := newTestHeaderExtra(21)
+	headerExtra.CurrentBlockCandidates = newTestHeaderExtra(200).CurrentEpochValidators
+	return headerExtra
+}
+
+func benchmarkName(config params.EqualityConfig) string {
+	return fmt.Sprintf("%s-%d", config.Compression, config.CompressionLevel)
+}
+
+func BenchmarkEncodeHeaderExtra(b *testing.B) {
+	headerExtra := newBenchmarkHeaderExtra()
+	for _, config := range benchmarkCompressions {
+		b.Run(benchmarkName(config), func(b *testing.B) {
+			var data []byte
+			var err error
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if data, err = headerExtra.EncodeWith(config); err != nil {
+					b.Fatal(err)
+				}
+			}
+			b.ReportMetric(float64(len(data)), "bytes")
+		})
+	}
+}
+
+func BenchmarkNewHeaderExtra(b *testing.B) {
+	headerExtra := newBenchmarkHeaderExtra()
+	for _, config := range benchmarkCompressions {
+		data, err := headerExtra.EncodeWith(config)
+		if err != nil {
+			b.Fatal(err)
+		}
+		b.Run(benchmarkName(config), func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if _, err := NewHeaderExtra(data); err != nil {
+					b.Fatal(err)
+				}
+			}
+			b.ReportMetric(float64(len(data)), "bytes")
+		})
+	}
+}
+
+func TestHeaderExtraEncodePooled(t *testing.T) {
+	headerExtra := newBenchmarkSizedHeaderExtra(21, 200, 0)
+	first := make(map[string][]byte)
+	for _, config := range benchmarkCompressions {
+		data, err := headerExtra.EncodeWith(config)
+		assert.Nil(t, err)
+		first[benchmarkName(config)] = data
+	}
+
+	// The pooled writers and readers are reset to the streams they handle,
+	// a corrupted stream does not spoil the next one
+	for round := 0; round < 3; round++ {
+		for _, config := range benchmarkCompressions {
+			data, err := headerExtra.EncodeWith(config)
+			assert.Nil(t, err)
+			assert.Equal(t, first[benchmarkName(config)], data, benchmarkName(config))
+
+			corrupted := append([]byte{}, data[:len(data)/2]...)
+			_, err = NewHeaderExtra(corrupted)
+			assert.NotNil(t, err, benchmarkName(config))
+			decoded, err := NewHeaderExtra(data)
+			assert.Nil(t, err, benchmarkName(config))
+			assert.True(t, decoded.Equal(headerExtra), benchmarkName(config))
+		}
+	}
+}
+
+// benchmarkHeaderExtraSizes are the header extras compared by the size
+// benchmarks: the validators of a block, an epoch transition registering 200
+// candidates and one registering 1000 candidates with as many votes.
+var benchmarkHeaderExtraSizes = []struct {
+	name        string
+	validators  int
+	candidates  int
+	delegations int
+}{
+	{"small", 21, 0, 0},
+	{"medium", 21, 200, 0},
+	{"large", 21, 1000, 1000},
+}
+
+// newBenchmarkSizedHeaderExtra returns a header extra with the given number of
+// validators, candidates and votes, in canonical order as decoded from blocks.
+func newBenchmarkSizedHeaderExtra(validators, candidates, delegations int) HeaderExtra {
+	headerExtra := newTestHeaderExtra(validators)
+	rand.Read(headerExtra.Root.EpochHash[:])
+	rand.Read(headerExtra.Root.CandidateHash[:])
+	headerExtra.CurrentBlockCandidates = newTestHeaderExtra(candidates).CurrentEpochValidators
+	for _, delegator := range newTestHeaderExtra(delegations).CurrentEpochValidators {
+		candidate := headerExtra.CurrentBlockCandidates[len(headerExtra.CurrentBlockVotes)%len(headerExtra.CurrentBlockCandidates)]
+		headerExtra.CurrentBlockVotes = append(headerExtra.CurrentBlockVotes, Vote{Delegator: delegator, Candidate: candidate, Weight: big.NewInt(1)})
+	}
+	return headerExtra.Canonicalize()
+}
+
+func BenchmarkHeaderExtraEncode(b *testing.B) {
+	for _, size := range benchmarkHeaderExtraSizes {
+		headerExtra := newBenchmarkSizedHeaderExtra(size.validators, size.candidates, size.delegations)
+		b.Run(size.name, func(b *testing.B) {
+			var data []byte
+			var err error
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if data, err = headerExtra.Encode(); err != nil {
+					b.Fatal(err)
+				}
+			}
+			b.ReportMetric(float64(len(data)), "bytes")
+		})
+	}
+}
+
+func BenchmarkHeaderExtraDecode(b *testing.B) {
+	for _, size := range benchmarkHeaderExtraSizes {
+		data, err := newBenchmarkSizedHeaderExtra(size.validators, size.candidates, size.delegations).Encode()
+		if err != nil {
+			b.Fatal(err)
+		}
+		b.Run(size.name, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if _, err := NewHeaderExtra(data); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkHeaderExtraEqual(b *testing.B) {
+	for _, size := range benchmarkHeaderExtraSizes {
+		headerExtra := newBenchmarkSizedHeaderExtra(size.validators, size.candidates, size.delegations)
+		data, err := headerExtra.Encode()
+		if err != nil {
+			b.Fatal(err)
+		}
+		decoded, err := NewHeaderExtra(data)
+		if err != nil {
+			b.Fatal(err)
+		}
+		b.Run(size.name, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if !headerExtra.Equal(decoded) {
+					b.Fatal("header extras differ")
+				}
+			}
+		})
+		// The comparison through the hashes Equal is measured against
+		b.Run(size.name+"/hash", func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if headerExtra.Hash() != decoded.Hash() {
+					b.Fatal("header extras differ")
+				}
+			}
+		})
+	}
+}
+
+func TestHeaderExtraValidate(t *testing.T) {
+	config := params.EqualityConfig{Epoch: 180, MaxValidatorsCount: 3}
+	address1 := common.HexToAddress("0xcc7c8317b21e1cea6139700c3c46c21af998d14c")
+	address2 := common.HexToAddress("0x44d1ce0b7cb3588bca96151fe1bc05af38f91b6c")
+	address3 := common.HexToAddress("0x0d4ea9bd8ca6a1e1ad9d4c8d7f33d692bcccd8c7")
+	address4 := common.HexToAddress("0x7a6f8f2ef53b1d1a3cd9c6f2a1e3b28e6f0a1c55")
+	chainConfig := params.EqualityConfig{Period: 3, Epoch: 180, MaxValidatorsCount: 3, MinCandidateBalance: big.NewInt(0)}
+	unknownCompression := chainConfig
+	unknownCompression.Compression = "zstd"
+
+	tests := []struct {
+		name        string
+		number      uint64
+		headerExtra HeaderExtra
+		err         error
+	}{
+		{"valid block", 200, HeaderExtra{Epoch: 2, EpochBlock: 180, CurrentBlockCandidates: []common.Address{address1}}, nil},
+		{"valid epoch block", 180, HeaderExtra{Epoch: 2, EpochBlock: 180, CurrentEpochValidators: []common.Address{address1, address2, address3}}, nil},
+		{"epoch block ahead", 179, HeaderExtra{Epoch: 2, EpochBlock: 180}, errInvalidEpochBlock},
+		{"duplicate candidates", 200, HeaderExtra{EpochBlock: 180, CurrentBlockCandidates: []common.Address{address1, address1}}, errDuplicateAddress},
+		{"duplicate kick outs", 180, HeaderExtra{EpochBlock: 180, CurrentBlockKickOutCandidates: []common.Address{address2, address1, address2}}, errDuplicateAddress},
+		{"duplicate cancels", 200, HeaderExtra{EpochBlock: 180, CurrentBlockCancelCandidates: []common.Address{address3, address3}}, errDuplicateAddress},
+		{"duplicate validators", 180, HeaderExtra{EpochBlock: 180, CurrentEpochValidators: []common.Address{address1, address1}}, errDuplicateAddress},
+		{"zero candidate", 200, HeaderExtra{EpochBlock: 180, CurrentBlockCandidates: []common.Address{{}}}, errZeroAddress},
+		{"zero kick out", 180, HeaderExtra{EpochBlock: 180, CurrentBlockKickOutCandidates: []common.Address{address1, {}}}, errZeroAddress},
+		{"zero cancel", 200, HeaderExtra{EpochBlock: 180, CurrentBlockCancelCandidates: []common.Address{{}}}, errZeroAddress},
+		{"zero validator", 180, HeaderExtra{EpochBlock: 180, CurrentEpochValidators: []common.Address{{}}}, errZeroAddress},
+		{"validators outside epoch block", 181, HeaderExtra{EpochBlock: 180, CurrentEpochValidators: []common.Address{address1}}, errUnexpectedValidators},
+		{"too many validators", 180, HeaderExtra{EpochBlock: 180, CurrentEpochValidators: []common.Address{address1, address2, address3, address4}}, errTooManyValidators},
+		{"valid top up", 200, HeaderExtra{EpochBlock: 180, CurrentBlockTopUps: []TopUp{{Candidate: address1, Amount: big.NewInt(1)}}}, nil},
+		{"duplicate top ups", 200, HeaderExtra{EpochBlock: 180, CurrentBlockTopUps: []TopUp{{Candidate: address1, Amount: big.NewInt(1)}, {Candidate: address1, Amount: big.NewInt(2)}}}, errDuplicateAddress},
+		{"zero top up", 200, HeaderExtra{EpochBlock: 180, CurrentBlockTopUps: []TopUp{{Candidate: address1, Amount: big.NewInt(0)}}}, errInvalidTopUp},
+		{"valid chain config", 200, HeaderExtra{EpochBlock: 180, ChainConfig: []params.EqualityConfig{chainConfig}}, nil},
+		{"zero period", 200, HeaderExtra{EpochBlock: 180, ChainConfig: []params.EqualityConfig{{Epoch: 180, MaxValidatorsCount: 3, MinCandidateBalance: big.NewInt(0)}}}, errInvalidChainConfig},
+		{"unknown compression", 200, HeaderExtra{EpochBlock: 180, ChainConfig: []params.EqualityConfig{unknownCompression}}, errInvalidChainConfig},
+	}
+	for _, test := range tests {
+		err := test.headerExtra.Validate(test.number, config)
+		if test.err == nil {
+			assert.Nil(t, err, test.name)
+		} else {
+			assert.True(t, errors.Is(err, test.err), "%s: have %v, want %v", test.name, err, test.err)
+		}
+	}
+}
+
+func TestHeaderExtraCanonicalize(t *testing.T) {
+	address1 := common.HexToAddress("0xcc7c8317b21e1cea6139700c3c46c21af998d14c")
+	address2 := common.HexToAddress("0x44d1ce0b7cb3588bca96151fe1bc05af38f91b6c")
+	address3 := common.HexToAddress("0x0d4ea9bd8ca6a1e1ad9d4c8d7f33d692bcccd8c7")
+
+	headerExtra := HeaderExtra{
+		Epoch:                         2,
+		EpochBlock:                    180,
+		CurrentBlockCandidates:        []common.Address{address1, address2, address3},
+		CurrentBlockKickOutCandidates: []common.Address{address2, address1},
+		CurrentBlockCancelCandidates:  []common.Address{address3, address1},
+		CurrentEpochValidators:        []common.Address{address1, address2, address3},
+	}
+	permutation := HeaderExtra{
+		Epoch:                         2,
+		EpochBlock:                    180,
+		CurrentBlockCandidates:        []common.Address{address3, address1, address2},
+		CurrentBlockKickOutCandidates: []common.Address{address1, address2},
+		CurrentBlockCancelCandidates:  []common.Address{address1, address3},
+		CurrentEpochValidators:        []common.Address{address1, address2, address3},
+	}
+
+	data, err := headerExtra.Encode()
+	assert.Nil(t, err)
+	other, err := permutation.Encode()
+	assert.Nil(t, err)
+	assert.Equal(t, data, other)
+	assert.True(t, headerExtra.Equal(permutation))
+
+	canonical := headerExtra.Canonicalize()
+	assert.Equal(t, []common.Address{address3, address2, address1}, canonical.CurrentBlockCandidates)
+	assert.Equal(t, []common.Address{address2, address1}, canonical.CurrentBlockKickOutCandidates)
+	assert.Equal(t, []common.Address{address3, address1}, canonical.CurrentBlockCancelCandidates)
+
+	// The input is left untouched and the election order is kept
+	assert.Equal(t, []common.Address{address1, address2, address3}, headerExtra.CurrentBlockCandidates)
+	assert.Equal(t, headerExtra.CurrentEpochValidators, canonical.CurrentEpochValidators)
+
+	// Validators in a different order are a different election result
+	permutation.CurrentEpochValidators = []common.Address{address3, address2, address1}
+	assert.False(t, headerExtra.Equal(permutation))
+}
+
+// The seed corpora of the fuzz targets in testdata/fuzz are the encodings of
+// representative header extras in every format version and codec, they run
+// as regression tests under go test together with the inputs of past failures.
+
+func FuzzNewHeaderExtra(f *testing.F) {
+	f.Fuzz(func(t *testing.T, data []byte) {
+		headerExtra, err := NewHeaderExtra(data)
+		if err != nil {
+			return
+		}
+		// Decoded header extras are encoded again to the same content
+		encoded, err := headerExtra.Encode()
+		if err != nil {
+			t.Fatalf("failed to encode decoded header extra: %v", err)
+		}
+		decoded, err := NewHeaderExtra(encoded)
+		if err != nil {
+			t.Fatalf("failed to decode encoded header extra: %v", err)
+		}
+		if !decoded.Equal(headerExtra) {
+			t.Fatalf("header extra changed by encoding: %v", headerExtra.Difference(decoded))
+		}
+	})
+}
+
+func FuzzDecodeHeaderExtra(f *testing.F) {
+	f.Fuzz(func(t *testing.T, extra []byte) {
+		header := &types.Header{Number: big.NewInt(1), Extra: extra}
+		if _, err := DecodeHeaderExtra(header); err != nil && !strings.HasPrefix(err.Error(), "block 1 ") {
+			t.Fatalf("unannotated decode error: %v", err)
+		}
+	})
+}
@@ -0,0 +1,110 @@
+package equality
+
+import (
+	"fmt"
+
+	"github.com/SecretBlockChain/go-secret/consensus"
+	"github.com/SecretBlockChain/go-secret/log"
+)
+
+// RebuildIndexes rebuilds the equality data persisted for the canonical blocks
+// from and to inclusive, lost by an import of exported blocks or left stale by
+// a crash: the snapshot tries up to block to are replayed from the latest
+// available ones and persisted, the epoch index and the kick out history of
+// the transitions in range and the header extra index of the indexed blocks
+// in range are rewritten. The epoch and header extra indexes are then brought
+// up to the current head.
+func (e *Equality) RebuildIndexes(chain consensus.ChainHeaderReader, from, to uint64) error {
+	if from == 0 {
+		from = 1
+	}
+	if from > to {
+		return fmt.Errorf("%w: from block %d, to block %d", errInvalidBlockRange, from, to)
+	}
+	head := chain.CurrentHeader()
+	if head == nil || to > head.Number.Uint64() {
+		return fmt.Errorf("%w: block %d beyond the head", errUnknownBlock, to)
+	}
+	last := chain.GetHeaderByNumber(to)
+	if last == nil {
+		return errUnknownBlock
+	}
+
+	// Replay the snapshot tries of the blocks lacking them
+	if _, err := e.snapshot(chain, last, nil); err != nil {
+		return err
+	}
+	if err := e.snapshots.flush(); err != nil {
+		return err
+	}
+
+	headExtra, err := e.DecodeHeaderExtraCached(head)
+	if err != nil {
+		return err
+	}
+	if err = e.rewriteIndexes(chain, from, to, headExtra.Epoch); err != nil {
+		return err
+	}
+	log.Info("[equality] Rebuilt indexes", "from", from, "to", to)
+
+	if _, err = e.IndexEpochs(chain, head); err != nil {
+		return err
+	}
+	_, err = e.IndexHeaderExtras(chain, head)
+	return err
+}
+
+// rewriteIndexes rewrites the epoch index and the kick out history of the
+// transitions of the canonical blocks from and to inclusive, and the header
+// extra index of the indexed ones, the head being in headEpoch.
+func (e *Equality) rewriteIndexes(chain consensus.ChainHeaderReader, from, to, headEpoch uint64) error {
+	e.epochLock.Lock()
+	defer e.epochLock.Unlock()
+
+	indexed, _ := readHeaderExtraIndexHead(e.db)
+	epochs := e.kickOutHistoryEpochs()
+	batch := e.db.NewBatch()
+	for number := from; number <= to; number++ {
+		header := chain.GetHeaderByNumber(number)
+		if header == nil {
+			return errUnknownBlock
+		}
+		headerExtra, err := e.DecodeHeaderExtraCached(header)
+		if err != nil {
+			return err
+		}
+		if headerExtra.EpochBlock == number && headerExtra.Epoch > 0 {
+			if err = e.writeEpochIndex(batch, chain, header, headerExtra, headEpoch, epochs); err != nil {
+				return err
+			}
+		}
+		if number <= indexed {
+			if err = writeHeaderExtraIndex(batch, header, headerExtra); err != nil {
+				return err
+			}
+		}
+	}
+	return batch.Write()
+}
+
+// DebugAPI offers the maintenance of the equality data persisted by a node,
+// exposed in the debug namespace.
+type DebugAPI struct {
+	chain    consensus.ChainHeaderReader
+	equality *Equality
+}
+
+// RebuildEqualityIndexes rebuilds the snapshot tries, the epoch index, the
+// kick out history and the header extra index of the canonical blocks from
+// and to inclusive, to the current head if zero, after a crash left them
+// stale
+func (api *DebugAPI) RebuildEqualityIndexes(from, to uint64) error {
+	if to == 0 {
+		head := api.chain.CurrentHeader()
+		if head == nil {
+			return errUnknownBlock
+		}
+		to = head.Number.Uint64()
+	}
+	return api.equality.RebuildIndexes(api.chain, from, to)
+}
@@ -0,0 +1,138 @@
+package equality
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"io"
+	"math/big"
+	"testing"
+
+	"github.com/SecretBlockChain/go-secret/accounts"
+	"github.com/SecretBlockChain/go-secret/common"
+	"github.com/SecretBlockChain/go-secret/core"
+	"github.com/SecretBlockChain/go-secret/core/rawdb"
+	"github.com/SecretBlockChain/go-secret/core/types"
+	"github.com/SecretBlockChain/go-secret/core/vm"
+	"github.com/SecretBlockChain/go-secret/crypto"
+	"github.com/SecretBlockChain/go-secret/ethdb"
+	"github.com/SecretBlockChain/go-secret/params"
+	"github.com/SecretBlockChain/go-secret/rlp"
+	"github.com/stretchr/testify/assert"
+)
+
+// newTestBlockChain returns a blockchain of the equality engine over db, its
+// genesis committed, sealing with key.
+func newTestBlockChain(t *testing.T, db ethdb.Database, config *params.ChainConfig, key *ecdsa.PrivateKey) (*core.BlockChain, *Equality) {
+	headerExtra, err := GenesisHeaderExtra(*config.Equality, db)
+	assert.Nil(t, err)
+	extra, err := EncodeHeaderExtra(nil, headerExtra)
+	assert.Nil(t, err)
+	genesis := core.Genesis{Config: config, GasLimit: params.GenesisGasLimit, ExtraData: extra}
+	genesis.MustCommit(db)
+
+	engine := New(config.Equality, db)
+	engine.Authorize(crypto.PubkeyToAddress(key.PublicKey), func(account accounts.Account, mimeType string, data []byte) ([]byte, error) {
+		return crypto.Sign(crypto.Keccak256(data), key)
+	})
+	engine.SetAllowedFutureDrift(0)
+	chain, err := core.NewBlockChain(db, nil, config, engine, vm.Config{}, nil, nil)
+	assert.Nil(t, err)
+	return chain, engine
+}
+
+// sealTestBlock prepares, finalizes and seals the empty block on top of the
+// head of chain with key.
+func sealTestBlock(t *testing.T, chain *core.BlockChain, engine *Equality, key *ecdsa.PrivateKey) *types.Block {
+	parent := chain.CurrentBlock()
+	header := &types.Header{
+		ParentHash: parent.Hash(),
+		Number:     new(big.Int).Add(parent.Number(), common.Big1),
+		GasLimit:   parent.GasLimit(),
+		Coinbase:   crypto.PubkeyToAddress(key.PublicKey),
+	}
+	assert.Nil(t, engine.Prepare(chain, header))
+	statedb, err := chain.StateAt(parent.Root())
+	assert.Nil(t, err)
+	block, err := engine.FinalizeAndAssemble(chain, header, statedb, nil, nil, nil)
+	assert.Nil(t, err)
+
+	sealed := block.Header()
+	signature, err := crypto.Sign(SealHash(sealed).Bytes(), key)
+	assert.Nil(t, err)
+	copy(sealed.Extra[len(sealed.Extra)-ExtraSeal:], signature)
+	return block.WithSeal(sealed)
+}
+
+func TestRebuildIndexes(t *testing.T) {
+	key, _ := crypto.GenerateKey()
+	validator := crypto.PubkeyToAddress(key.PublicKey)
+	config := *params.AllEthashProtocolChanges
+	config.Ethash = nil
+	config.Equality = &params.EqualityConfig{Epoch: 3, MaxValidatorsCount: 1, MinCandidateBalance: big.NewInt(0),
+		Validators: []common.Address{validator}}
+
+	// Seal five epochs and export them
+	db := rawdb.NewMemoryDatabase()
+	chain, engine := newTestBlockChain(t, db, &config, key)
+	for number := 1; number <= 15; number++ {
+		_, err := chain.InsertChain(types.Blocks{sealTestBlock(t, chain, engine, key)})
+		assert.Nil(t, err)
+	}
+	var exported bytes.Buffer
+	assert.Nil(t, chain.Export(&exported))
+	chain.Stop()
+	assert.Nil(t, engine.Close())
+
+	// Import them into a fresh node, the snapshot tries are kept in memory
+	// until flushed along the rebuilt indexes
+	db = rawdb.NewMemoryDatabase()
+	chain, engine = newTestBlockChain(t, db, &config, key)
+	stream := rlp.NewStream(&exported, 0)
+	for {
+		block := new(types.Block)
+		if err := stream.Decode(block); err == io.EOF {
+			break
+		} else {
+			assert.Nil(t, err)
+		}
+		if block.NumberU64() > 0 {
+			_, err := chain.InsertChain(types.Blocks{block})
+			assert.Nil(t, err)
+		}
+	}
+	head := chain.CurrentHeader()
+	assert.Equal(t, uint64(15), head.Number.Uint64())
+	headExtra, err := engine.DecodeHeaderExtraCached(head)
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(5), headExtra.Epoch)
+	assert.False(t, New(config.Equality, db).snapshots.available(headExtra.Root))
+	_, ok := readEpochIndexHead(db)
+	assert.False(t, ok)
+
+	assert.NotNil(t, engine.RebuildIndexes(chain, 10, 16))
+	assert.NotNil(t, engine.RebuildIndexes(chain, 10, 9))
+	assert.Nil(t, engine.RebuildIndexes(chain, 1, head.Number.Uint64()))
+	indexed, ok := readEpochIndexHead(db)
+	assert.True(t, ok)
+	assert.Equal(t, uint64(5), indexed)
+
+	// A node restarted on the database answers from the persisted data
+	reopened := New(config.Equality, db)
+	assert.True(t, reopened.snapshots.available(headExtra.Root))
+	api := &API{chain: chain, equality: reopened}
+	for epoch := uint64(1); epoch <= 5; epoch++ {
+		result, err := api.GetValidatorsByEpoch(epoch)
+		assert.Nil(t, err)
+		assert.Equal(t, 3*epoch-2, uint64(result.BlockNumber))
+		assert.Equal(t, chain.GetHeaderByNumber(3*epoch-2).Hash(), result.Hash)
+		assert.Equal(t, []common.Address{validator}, result.Validators)
+	}
+
+	// A stale entry is rewritten through the debug API
+	assert.Nil(t, db.Put(epochIndexKey(3), []byte{0x01}))
+	assert.Nil(t, (&DebugAPI{chain: chain, equality: reopened}).RebuildEqualityIndexes(7, 0))
+	index := readEpochIndex(db, 3)
+	assert.NotNil(t, index)
+	assert.Equal(t, uint64(7), index.Number)
+	chain.Stop()
+}
@@ -0,0 +1,118 @@
+package equality
+
+import (
+	"fmt"
+
+	"github.com/SecretBlockChain/go-secret/common"
+	"github.com/SecretBlockChain/go-secret/common/hexutil"
+	"github.com/SecretBlockChain/go-secret/consensus"
+	"github.com/SecretBlockChain/go-secret/core/types"
+)
+
+// ExtraDump is a decoded header.Extra, printed by the command line inspector.
+// The block fields are set when dumped from a header.
+type ExtraDump struct {
+	Number      *hexutil.Uint64  `json:"number,omitempty"`
+	Hash        *common.Hash     `json:"hash,omitempty"`
+	Signer      *common.Address  `json:"signer,omitempty"`
+	Vanity      hexutil.Bytes    `json:"vanity,omitempty"`
+	HeaderExtra *HeaderExtraJSON `json:"headerExtra"`
+}
+
+// DumpExtra decodes extra, either a whole header.Extra with its vanity and
+// seal or the payload between them.
+func DumpExtra(extra []byte) (*ExtraDump, error) {
+	vanity, payload, _, err := SplitExtra(extra)
+	if err == nil {
+		var headerExtra HeaderExtra
+		if headerExtra, err = NewHeaderExtra(payload); err == nil {
+			return &ExtraDump{Vanity: vanity, HeaderExtra: headerExtra.JSON()}, nil
+		}
+	}
+	headerExtra, payloadErr := NewHeaderExtra(extra)
+	if payloadErr != nil {
+		return nil, err
+	}
+	return &ExtraDump{HeaderExtra: headerExtra.JSON()}, nil
+}
+
+// DumpHeaderExtra decodes the header extra of header, along with its signer
+// if the seal recovers one.
+func (e *Equality) DumpHeaderExtra(header *types.Header) (*ExtraDump, error) {
+	headerExtra, err := DecodeHeaderExtra(header)
+	if err != nil {
+		return nil, err
+	}
+	number, hash := hexutil.Uint64(header.Number.Uint64()), header.Hash()
+	dump := &ExtraDump{Number: &number, Hash: &hash, Vanity: header.Extra[:ExtraVanity], HeaderExtra: headerExtra.JSON()}
+	if header.Number.Sign() > 0 {
+		if signer, err := e.Author(header); err == nil {
+			dump.Signer = &signer
+		}
+	}
+	return dump, nil
+}
+
+// RootMismatch is a block whose header extra carries trie roots other than
+// the ones replayed from its parent.
+type RootMismatch struct {
+	Number     uint64
+	Hash       common.Hash
+	Difference HeaderExtraDifference // Fields of the header extra differing from the replayed one
+}
+
+// VerifyRange replays the header extras of the canonical blocks from and to
+// inclusive onto the snapshot of the parent of from, returning the first block
+// the roots of which differ from the replayed ones, nil if none does.
+func (e *Equality) VerifyRange(chain consensus.ChainHeaderReader, from, to uint64) (*RootMismatch, error) {
+	if from == 0 {
+		from = 1
+	}
+	if from > to {
+		return nil, fmt.Errorf("%w: from block %d, to block %d", errInvalidBlockRange, from, to)
+	}
+	head := chain.CurrentHeader()
+	if head == nil || to > head.Number.Uint64() {
+		return nil, fmt.Errorf("%w: block %d beyond the head", errUnknownBlock, to)
+	}
+	parent := chain.GetHeaderByNumber(from - 1)
+	if parent == nil {
+		return nil, errUnknownBlock
+	}
+	snap, err := e.snapshot(chain, parent, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	for number := from; number <= to; number++ {
+		header := chain.GetHeaderByNumber(number)
+		if header == nil {
+			return nil, errUnknownBlock
+		}
+		headerExtra, err := e.DecodeHeaderExtraCached(header)
+		if err != nil {
+			return nil, err
+		}
+		config, err := e.chainConfigByHash(snap.root.ConfigHash)
+		if err != nil {
+			return nil, err
+		}
+		if err = snap.apply(config, header, headerExtra); err != nil {
+			return nil, fmt.Errorf("block %d (%s): %w", number, header.Hash().Hex(), err)
+		}
+		root, err := snap.Root()
+		if err != nil {
+			return nil, err
+		}
+		if root != headerExtra.Root {
+			replayed := headerExtra
+			replayed.Root = root
+			return &RootMismatch{Number: number, Hash: header.Hash(), Difference: replayed.Difference(headerExtra)}, nil
+		}
+		if err = e.snapshots.add(number, root); err != nil {
+			return nil, err
+		}
+		snap = e.snapshots.open(root)
+	}
+	return nil, nil
+}
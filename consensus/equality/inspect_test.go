@@ -0,0 +1,88 @@
+package equality
+
+import (
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/SecretBlockChain/go-secret/common"
+	"github.com/SecretBlockChain/go-secret/core/rawdb"
+	"github.com/SecretBlockChain/go-secret/core/types"
+	"github.com/SecretBlockChain/go-secret/crypto"
+	"github.com/SecretBlockChain/go-secret/params"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDumpExtra(t *testing.T) {
+	headerExtra := goldenHeaderExtra()
+	payload, err := headerExtra.Encode()
+	assert.Nil(t, err)
+	extra := goldenExtra(payload)
+
+	// Both the whole extra and the payload alone decode
+	dump, err := DumpExtra(extra)
+	assert.Nil(t, err)
+	assert.Equal(t, extra[:ExtraVanity], []byte(dump.Vanity))
+	assert.Equal(t, headerExtra.JSON(), dump.HeaderExtra)
+	dump, err = DumpExtra(payload)
+	assert.Nil(t, err)
+	assert.Empty(t, dump.Vanity)
+	assert.Equal(t, headerExtra.JSON(), dump.HeaderExtra)
+
+	_, err = DumpExtra(extra[:ExtraVanity])
+	assert.True(t, errors.Is(err, errMissingSignature))
+	_, err = DumpExtra(nil)
+	assert.True(t, errors.Is(err, errMissingVanity))
+}
+
+func TestVerifyRange(t *testing.T) {
+	key, _ := crypto.GenerateKey()
+	validator := crypto.PubkeyToAddress(key.PublicKey)
+	config := *params.AllEthashProtocolChanges
+	config.Ethash = nil
+	config.Equality = &params.EqualityConfig{Epoch: 3, MaxValidatorsCount: 1, MinCandidateBalance: big.NewInt(0),
+		Validators: []common.Address{validator}}
+
+	db := rawdb.NewMemoryDatabase()
+	chain, engine := newTestBlockChain(t, db, &config, key)
+	for number := 1; number <= 8; number++ {
+		_, err := chain.InsertChain(types.Blocks{sealTestBlock(t, chain, engine, key)})
+		assert.Nil(t, err)
+	}
+
+	dump, err := engine.DumpHeaderExtra(chain.GetHeaderByNumber(4))
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(4), uint64(*dump.Number))
+	assert.Equal(t, validator, *dump.Signer)
+
+	// The sealed chain replays from any block
+	for _, from := range []uint64{0, 1, 5} {
+		mismatch, err := New(config.Equality, db).VerifyRange(chain, from, 8)
+		assert.Nil(t, err)
+		assert.Nil(t, mismatch)
+	}
+	_, err = engine.VerifyRange(chain, 5, 4)
+	assert.True(t, errors.Is(err, errInvalidBlockRange))
+	_, err = engine.VerifyRange(chain, 5, 9)
+	assert.True(t, errors.Is(err, errUnknownBlock))
+
+	// A header extra with forged mint counts is the first mismatch
+	forged := &testHeaderChain{config: &config}
+	for number := uint64(0); number <= 8; number++ {
+		header := types.CopyHeader(chain.GetHeaderByNumber(number))
+		if number >= 6 {
+			headerExtra, err := DecodeHeaderExtra(header)
+			assert.Nil(t, err)
+			headerExtra.Root.MintCntHash = common.HexToHash("0x01")
+			header.Extra, err = EncodeHeaderExtra(header.Extra[:ExtraVanity], headerExtra)
+			assert.Nil(t, err)
+		}
+		forged.headers = append(forged.headers, header)
+	}
+	mismatch, err := New(config.Equality, db).VerifyRange(forged, 1, 8)
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(6), mismatch.Number)
+	assert.Equal(t, forged.headers[6].Hash(), mismatch.Hash)
+	assert.Len(t, mismatch.Difference, 1)
+	assert.Equal(t, "root.mintCntHash", mismatch.Difference[0].Field)
+}
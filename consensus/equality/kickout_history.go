@@ -0,0 +1,175 @@
+package equality
+
+import (
+	"encoding/binary"
+
+	"github.com/SecretBlockChain/go-secret/common"
+	"github.com/SecretBlockChain/go-secret/consensus"
+	"github.com/SecretBlockChain/go-secret/core/types"
+	"github.com/SecretBlockChain/go-secret/ethdb"
+	"github.com/SecretBlockChain/go-secret/log"
+	"github.com/SecretBlockChain/go-secret/rlp"
+)
+
+var kickOutHistoryPrefix = []byte("equality-kickout-") // key: equality-kickout-{epoch}:{kickOutHistory}
+
+// defaultKickOutHistoryEpochs is the default number of epochs the kick outs
+// are kept for.
+const defaultKickOutHistoryEpochs = 256
+
+// kickOutEvent is a validator kicked out at an epoch transition, the blocks it
+// minted in the previous epoch out of the ones it was scheduled for and the
+// threshold it fell below.
+type kickOutEvent struct {
+	Validator common.Address
+	Minted    uint64
+	Scheduled uint64
+	MinMinted uint64
+}
+
+// kickOutHistory is the kick outs of the transition block of an epoch. The
+// history of the last epochs is written along the epoch index, an epoch
+// falling out of them is deleted as a new one is indexed. An entry is only
+// valid while the epoch index of its epoch refers to its block, the entries
+// of the epochs a reorg replaces are rewritten or deleted with their index.
+type kickOutHistory struct {
+	Epoch    uint64
+	Number   uint64
+	Hash     common.Hash
+	KickOuts []kickOutEvent
+}
+
+// kickOutHistoryKey returns the database key of the kick outs of epoch.
+func kickOutHistoryKey(epoch uint64) []byte {
+	key := make([]byte, len(kickOutHistoryPrefix)+8)
+	copy(key, kickOutHistoryPrefix)
+	binary.BigEndian.PutUint64(key[len(kickOutHistoryPrefix):], epoch)
+	return key
+}
+
+// readKickOutHistory retrieves the kick outs of epoch, nil if none recorded.
+func readKickOutHistory(db ethdb.KeyValueReader, epoch uint64) *kickOutHistory {
+	data, err := db.Get(kickOutHistoryKey(epoch))
+	if err != nil || len(data) == 0 {
+		return nil
+	}
+	history := new(kickOutHistory)
+	if err = rlp.DecodeBytes(data, history); err != nil {
+		log.Warn("[equality] Invalid kick out history", "epoch", epoch, "err", err)
+		return nil
+	}
+	return history
+}
+
+// SetKickOutHistoryEpochs sets the number of epochs the kick outs are kept for,
+// zero disables the history.
+func (e *Equality) SetKickOutHistoryEpochs(epochs uint64) {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	e.kickOutEpochs = epochs
+}
+
+// kickOutHistoryEpochs returns the number of epochs the kick outs are kept for.
+func (e *Equality) kickOutHistoryEpochs() uint64 {
+	e.lock.RLock()
+	defer e.lock.RUnlock()
+	return e.kickOutEpochs
+}
+
+// writeKickOutHistory records the kick outs of the transition block header of
+// epoch into batch, deleting the ones of the epoch falling out of the kept
+// epochs and the ones of a replaced block if header has none. The mint counts
+// are taken from a replay of the election, the kick outs of an election
+// failing to replay are not recorded.
+func (e *Equality) writeKickOutHistory(batch ethdb.KeyValueWriter, chain consensus.ChainHeaderReader,
+	header *types.Header, headerExtra HeaderExtra, epochs uint64) error {
+
+	if headerExtra.Epoch > epochs {
+		if err := batch.Delete(kickOutHistoryKey(headerExtra.Epoch - epochs)); err != nil {
+			return err
+		}
+	}
+	key := kickOutHistoryKey(headerExtra.Epoch)
+	if len(headerExtra.CurrentBlockKickOutCandidates) == 0 {
+		return batch.Delete(key)
+	}
+	// The epoch index is not held back by an election failing to replay, a
+	// snapshot missing after a sync
+	trail, _, err := e.replayElection(chain, header)
+	if err != nil {
+		log.Warn("[equality] Failed to replay election for kick out history", "epoch", headerExtra.Epoch,
+			"number", header.Number, "err", err)
+		return batch.Delete(key)
+	}
+	counts := make(map[common.Address]electionMintCount, len(trail.MintCounts))
+	for _, count := range trail.MintCounts {
+		counts[count.Address] = count
+	}
+
+	history := kickOutHistory{
+		Epoch:    headerExtra.Epoch,
+		Number:   header.Number.Uint64(),
+		Hash:     header.Hash(),
+		KickOuts: make([]kickOutEvent, 0, len(headerExtra.CurrentBlockKickOutCandidates)),
+	}
+	for _, validator := range headerExtra.CurrentBlockKickOutCandidates {
+		count := counts[validator]
+		history.KickOuts = append(history.KickOuts, kickOutEvent{
+			Validator: validator,
+			Minted:    uint64(count.Minted),
+			Scheduled: uint64(count.Scheduled),
+			MinMinted: uint64(count.MinMinted),
+		})
+	}
+	data, err := rlp.EncodeToBytes(history)
+	if err != nil {
+		return err
+	}
+	return batch.Put(key, data)
+}
+
+// kickOuts returns the kick outs of validator in the kept epochs of the
+// canonical chain of head, the latest first, at most limit of them if limit
+// is positive, each history holding the kick out of validator only. The epoch
+// index is brought up to head first.
+func (e *Equality) kickOuts(chain consensus.ChainHeaderReader, head *types.Header,
+	validator common.Address, limit int) ([]kickOutHistory, error) {
+
+	epochs := e.kickOutHistoryEpochs()
+	if epochs == 0 {
+		return nil, nil
+	}
+	if _, err := e.IndexEpochs(chain, head); err != nil {
+		return nil, err
+	}
+	last, ok := readEpochIndexHead(e.db)
+	if !ok {
+		return nil, nil
+	}
+
+	var result []kickOutHistory
+	for epoch := last; epoch > 0 && last-epoch < epochs; epoch-- {
+		history := readKickOutHistory(e.db, epoch)
+		if history == nil {
+			continue
+		}
+		if index := readEpochIndex(e.db, epoch); index == nil || index.Hash != history.Hash {
+			continue
+		}
+		for _, event := range history.KickOuts {
+			if event.Validator != validator {
+				continue
+			}
+			result = append(result, kickOutHistory{
+				Epoch:    history.Epoch,
+				Number:   history.Number,
+				Hash:     history.Hash,
+				KickOuts: []kickOutEvent{event},
+			})
+			if limit > 0 && len(result) >= limit {
+				return result, nil
+			}
+		}
+	}
+	return result, nil
+}
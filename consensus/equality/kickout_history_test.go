@@ -0,0 +1,65 @@
+package equality
+
+import (
+	"testing"
+
+	"github.com/SecretBlockChain/go-secret/common"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestKickOutHistory(t *testing.T) {
+	validatorA := common.HexToAddress("0xa000000000000000000000000000000000000000")
+	api, _ := newTestElectionChain(t)
+	chain := api.chain.(*testHeaderChain)
+	transition, err := api.equality.DecodeHeaderExtraCached(chain.headers[4])
+	assert.Nil(t, err)
+	assert.Len(t, transition.CurrentBlockKickOutCandidates, 1)
+	kicked := transition.CurrentBlockKickOutCandidates[0]
+
+	// The kick out is recorded with the mint count and the threshold of the
+	// validator as the epoch is indexed
+	expected := []rpcKickOut{{Epoch: 2, BlockNumber: 4, Hash: chain.headers[4].Hash(), Minted: 0, Scheduled: 1, MinMinted: 1}}
+	result, err := api.GetKickOutHistory(kicked, 10)
+	assert.Nil(t, err)
+	assert.Equal(t, expected, result)
+	result, err = api.GetKickOutHistory(validatorA, 0)
+	assert.Nil(t, err)
+	assert.Empty(t, result)
+
+	// A reorg back into the first epoch rolls it back, the transition back on
+	// the canonical chain records it again
+	head := chain.headers[4]
+	chain.headers = chain.headers[:4]
+	result, err = api.GetKickOutHistory(kicked, 10)
+	assert.Nil(t, err)
+	assert.Empty(t, result)
+	assert.Nil(t, readKickOutHistory(api.equality.db, 2))
+	chain.headers = append(chain.headers, head)
+	result, err = api.GetKickOutHistory(kicked, 10)
+	assert.Nil(t, err)
+	assert.Equal(t, expected, result)
+
+	// The epochs past the kept ones are neither recorded nor reported
+	api.equality.SetKickOutHistoryEpochs(0)
+	result, err = api.GetKickOutHistory(kicked, 10)
+	assert.Nil(t, err)
+	assert.Empty(t, result)
+
+	// A rebuilt index records the kept epochs only, an epoch falling out of
+	// them is deleted
+	rebuilt := New(api.equality.config, api.equality.db)
+	rebuilt.SetKickOutHistoryEpochs(1)
+	for _, epoch := range []uint64{1, 2} {
+		assert.Nil(t, rebuilt.db.Delete(epochIndexKey(epoch)))
+		assert.Nil(t, rebuilt.db.Delete(kickOutHistoryKey(epoch)))
+	}
+	histories, err := rebuilt.kickOuts(chain, chain.CurrentHeader(), kicked, 0)
+	assert.Nil(t, err)
+	assert.Len(t, histories, 1)
+	chain.headers = append(chain.headers, newTestHeader(5, HeaderExtra{Epoch: 3, EpochBlock: 5}))
+	chain.headers[5].ParentHash = head.Hash()
+	histories, err = rebuilt.kickOuts(chain, chain.CurrentHeader(), kicked, 0)
+	assert.Nil(t, err)
+	assert.Empty(t, histories)
+	assert.Nil(t, readKickOutHistory(rebuilt.db, 2))
+}
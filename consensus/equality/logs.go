@@ -0,0 +1,115 @@
+package equality
+
+import (
+	"math/big"
+
+	"github.com/SecretBlockChain/go-secret/common"
+	"github.com/SecretBlockChain/go-secret/core/state"
+	"github.com/SecretBlockChain/go-secret/core/types"
+	"github.com/SecretBlockChain/go-secret/crypto"
+	"github.com/SecretBlockChain/go-secret/params"
+)
+
+// CandidateLogAddress is the address of the logs emitted for the candidate
+// changes applied by a block, they follow the logs of the block's transactions
+// in a trailing receipt of their own.
+var CandidateLogAddress = common.HexToAddress("0x000000000000000000000000000000000000e001")
+
+// Topics of the candidate logs, the data holds the candidate address and the
+// deposit amount, both abi encoded. The amount of a top up is the one added to
+// the deposit in the block.
+var (
+	CandidateRegisteredTopic = crypto.Keccak256Hash([]byte("CandidateRegistered(address,uint256)"))
+	CandidateCanceledTopic   = crypto.Keccak256Hash([]byte("CandidateCanceled(address,uint256)"))
+	CandidateKickedOutTopic  = crypto.Keccak256Hash([]byte("CandidateKickedOut(address,uint256)"))
+	CandidateToppedUpTopic   = crypto.Keccak256Hash([]byte("CandidateToppedUp(address,uint256)"))
+	CandidateEvictedTopic    = crypto.Keccak256Hash([]byte("CandidateEvicted(address,uint256)"))
+)
+
+// CandidateLogABI is the abi of the candidate logs for decoding them, e.g. with
+// the bind package against CandidateLogAddress.
+const CandidateLogABI = `[
+	{"type":"event","name":"CandidateRegistered","anonymous":false,"inputs":[{"name":"candidate","type":"address","indexed":false},{"name":"deposit","type":"uint256","indexed":false}]},
+	{"type":"event","name":"CandidateCanceled","anonymous":false,"inputs":[{"name":"candidate","type":"address","indexed":false},{"name":"deposit","type":"uint256","indexed":false}]},
+	{"type":"event","name":"CandidateKickedOut","anonymous":false,"inputs":[{"name":"candidate","type":"address","indexed":false},{"name":"deposit","type":"uint256","indexed":false}]},
+	{"type":"event","name":"CandidateToppedUp","anonymous":false,"inputs":[{"name":"candidate","type":"address","indexed":false},{"name":"amount","type":"uint256","indexed":false}]},
+	{"type":"event","name":"CandidateEvicted","anonymous":false,"inputs":[{"name":"candidate","type":"address","indexed":false},{"name":"deposit","type":"uint256","indexed":false}]}
+]`
+
+// newCandidateLog returns the log of a candidate change with the deposit of
+// the candidate.
+func newCandidateLog(topic common.Hash, candidate common.Address, deposit *big.Int, number uint64) *types.Log {
+	if deposit == nil {
+		deposit = new(big.Int)
+	}
+	data := make([]byte, 0, 64)
+	data = append(data, common.LeftPadBytes(candidate.Bytes(), 32)...)
+	data = append(data, common.LeftPadBytes(deposit.Bytes(), 32)...)
+	return &types.Log{
+		Address:     CandidateLogAddress,
+		Topics:      []common.Hash{topic},
+		Data:        data,
+		BlockNumber: number,
+	}
+}
+
+// candidateLogs returns the logs of the candidate changes of the block of
+// number. The deposits of registered candidates are read from snap holding the
+// state after the block, the ones of canceled, kicked out and evicted
+// candidates from parent holding the state before it.
+func candidateLogs(config params.EqualityConfig, number uint64, parent, snap *Snapshot, headerExtra HeaderExtra) ([]*types.Log, error) {
+	// Without a deposit before the block, a candidate registered and canceled
+	// within the block and got its deposit of this block refunded
+	deposit := func(snap *Snapshot, address common.Address) (*big.Int, error) {
+		candidate, err := snap.GetCandidate(address)
+		if err != nil || candidate == nil {
+			return config.MinCandidateBalance, err
+		}
+		return candidate.Staked, nil
+	}
+
+	var logs []*types.Log
+	lists := []struct {
+		topic      common.Hash
+		snap       *Snapshot
+		candidates []common.Address
+	}{
+		{CandidateRegisteredTopic, snap, headerExtra.CurrentBlockCandidates},
+		{CandidateCanceledTopic, parent, headerExtra.CurrentBlockCancelCandidates},
+		{CandidateKickedOutTopic, parent, headerExtra.CurrentBlockKickOutCandidates},
+		{CandidateEvictedTopic, parent, headerExtra.CurrentBlockEvictedCandidates},
+	}
+	for _, list := range lists {
+		for _, candidate := range list.candidates {
+			amount, err := deposit(list.snap, candidate)
+			if err != nil {
+				return nil, err
+			}
+			logs = append(logs, newCandidateLog(list.topic, candidate, amount, number))
+		}
+	}
+	for _, topUp := range headerExtra.CurrentBlockTopUps {
+		logs = append(logs, newCandidateLog(CandidateToppedUpTopic, topUp.Candidate, topUp.Amount, number))
+	}
+	return logs, nil
+}
+
+// emitCandidateLogs adds the logs of the candidate changes of the block to the
+// state, recorded without a transaction hash after the block's transactions.
+func emitCandidateLogs(config params.EqualityConfig, state *state.StateDB, header *types.Header, txs int,
+	parent, snap *Snapshot, headerExtra HeaderExtra) error {
+
+	if !config.IsCandidateLog(header.Number) {
+		return nil
+	}
+	logs, err := candidateLogs(config, header.Number.Uint64(), parent, snap, headerExtra)
+	if err != nil {
+		return err
+	}
+
+	state.Prepare(common.Hash{}, header.Hash(), txs)
+	for _, log := range logs {
+		state.AddLog(log)
+	}
+	return nil
+}
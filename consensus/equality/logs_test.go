@@ -0,0 +1,95 @@
+package equality
+
+import (
+	"math/big"
+	"strings"
+	"testing"
+
+	"github.com/SecretBlockChain/go-secret/accounts/abi"
+	"github.com/SecretBlockChain/go-secret/common"
+	"github.com/SecretBlockChain/go-secret/core/rawdb"
+	"github.com/SecretBlockChain/go-secret/core/state"
+	"github.com/SecretBlockChain/go-secret/core/types"
+	"github.com/SecretBlockChain/go-secret/params"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCandidateLogs(t *testing.T) {
+	registered := common.HexToAddress("0x1000000000000000000000000000000000000001")
+	canceled := common.HexToAddress("0x2000000000000000000000000000000000000002")
+	kickedOut := common.HexToAddress("0x3000000000000000000000000000000000000003")
+	transient := common.HexToAddress("0x4000000000000000000000000000000000000004")
+
+	db := rawdb.NewMemoryDatabase()
+	e := New(params.TestnetEqualityConfig(), db)
+	parent := e.snapshots.open(Root{})
+	for _, candidate := range []common.Address{canceled, kickedOut} {
+		_, err := parent.BecomeCandidate(candidate, 1, big.NewInt(7))
+		assert.Nil(t, err)
+	}
+	root, err := parent.Root()
+	assert.Nil(t, err)
+	parent = e.snapshots.open(root)
+
+	// Registrations of the block are read after it, cancels and kick outs before
+	snap := e.snapshots.open(root)
+	_, err = snap.BecomeCandidate(registered, 10, big.NewInt(5))
+	assert.Nil(t, err)
+	_, _, err = snap.CancelCandidate(canceled)
+	assert.Nil(t, err)
+	_, _, err = snap.CancelCandidate(kickedOut)
+	assert.Nil(t, err)
+	headerExtra := HeaderExtra{
+		CurrentBlockCandidates:        []common.Address{registered},
+		CurrentBlockCancelCandidates:  []common.Address{canceled, transient},
+		CurrentBlockKickOutCandidates: []common.Address{kickedOut},
+	}
+	config := params.EqualityConfig{MinCandidateBalance: big.NewInt(5), CandidateLogBlock: big.NewInt(10)}
+	logs, err := candidateLogs(config, 10, parent, snap, headerExtra)
+	assert.Nil(t, err)
+
+	parsed, err := abi.JSON(strings.NewReader(CandidateLogABI))
+	assert.Nil(t, err)
+	want := []struct {
+		event     string
+		candidate common.Address
+		deposit   int64
+	}{
+		{"CandidateRegistered", registered, 5},
+		{"CandidateCanceled", canceled, 7},
+		{"CandidateCanceled", transient, 5},
+		{"CandidateKickedOut", kickedOut, 7},
+	}
+	assert.Len(t, logs, len(want))
+	for idx, log := range logs {
+		event := parsed.Events[want[idx].event]
+		assert.Equal(t, CandidateLogAddress, log.Address)
+		assert.Equal(t, []common.Hash{event.ID}, log.Topics, want[idx].event)
+
+		var decoded struct {
+			Candidate common.Address
+			Deposit   *big.Int
+		}
+		assert.Nil(t, parsed.UnpackIntoInterface(&decoded, want[idx].event, log.Data))
+		assert.Equal(t, want[idx].candidate, decoded.Candidate)
+		assert.Equal(t, big.NewInt(want[idx].deposit), decoded.Deposit)
+	}
+
+	// The logs are recorded without transaction hash from the candidate log block on
+	statedb, err := state.New(common.Hash{}, state.NewDatabase(db), nil)
+	assert.Nil(t, err)
+	header := &types.Header{Number: big.NewInt(9)}
+	assert.Nil(t, emitCandidateLogs(config, statedb, header, 2, parent, snap, headerExtra))
+	assert.Empty(t, statedb.GetLogs(common.Hash{}))
+
+	header.Number = big.NewInt(10)
+	assert.Nil(t, emitCandidateLogs(config, statedb, header, 2, parent, snap, headerExtra))
+	emitted := statedb.GetLogs(common.Hash{})
+	assert.Len(t, emitted, len(want))
+	assert.Equal(t, header.Hash(), emitted[0].BlockHash)
+	assert.Equal(t, uint(2), emitted[0].TxIndex)
+
+	receipt := types.NewSystemReceipt(emitted, 0)
+	assert.True(t, receipt.Bloom.Test(CandidateLogAddress.Bytes()))
+	assert.True(t, receipt.Bloom.Test(CandidateKickedOutTopic.Bytes()))
+}
@@ -0,0 +1,39 @@
+package equality
+
+import (
+	"github.com/SecretBlockChain/go-secret/metrics"
+	"github.com/SecretBlockChain/go-secret/params"
+)
+
+var (
+	headerExtraDecodeTimer = metrics.NewRegisteredTimer("consensus/equality/extra/decode", nil)
+	headerExtraSizeGauge   = metrics.NewRegisteredGauge("consensus/equality/extra/size", nil)
+	validatorsGauge        = metrics.NewRegisteredGauge("consensus/equality/validators", nil)
+	candidatesGauge        = metrics.NewRegisteredGauge("consensus/equality/candidates", nil)
+	epochRemainingGauge    = metrics.NewRegisteredGauge("consensus/equality/epoch/remaining", nil)
+	kickOutCounter         = metrics.NewRegisteredCounter("consensus/equality/kickouts", nil)
+	cancelCandidateCounter = metrics.NewRegisteredCounter("consensus/equality/cancels", nil)
+	clockSkewGauge         = metrics.NewRegisteredGauge("consensus/equality/clock/skew", nil)
+)
+
+// reportMetrics updates the engine metrics after the block of number with the
+// header extra of extraSize bytes was processed on top of snap.
+func reportMetrics(config params.EqualityConfig, number uint64, extraSize int, snap *Snapshot, headerExtra HeaderExtra) {
+	if !metrics.Enabled {
+		return
+	}
+
+	headerExtraSizeGauge.Update(int64(extraSize))
+	kickOutCounter.Inc(int64(len(headerExtra.CurrentBlockKickOutCandidates)))
+	cancelCandidateCounter.Inc(int64(len(headerExtra.CurrentBlockCancelCandidates)))
+	if length, err := snap.GetEpochLength(config); err == nil && headerExtra.EpochBlock+length > number {
+		epochRemainingGauge.Update(int64(headerExtra.EpochBlock + length - number))
+	}
+
+	if validators, err := snap.GetValidators(); err == nil {
+		validatorsGauge.Update(int64(len(validators)))
+	}
+	if candidates, err := snap.GetCandidates(); err == nil {
+		candidatesGauge.Update(int64(len(candidates)))
+	}
+}
@@ -0,0 +1,49 @@
+package equality
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/SecretBlockChain/go-secret/common"
+	"github.com/SecretBlockChain/go-secret/metrics"
+	"github.com/SecretBlockChain/go-secret/params"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReportMetrics(t *testing.T) {
+	// The metrics are registered as no-ops with metrics disabled
+	enabled := metrics.Enabled
+	kickOuts, cancels := kickOutCounter, cancelCandidateCounter
+	validators, candidates, remaining := validatorsGauge, candidatesGauge, epochRemainingGauge
+	defer func() {
+		metrics.Enabled = enabled
+		kickOutCounter, cancelCandidateCounter = kickOuts, cancels
+		validatorsGauge, candidatesGauge, epochRemainingGauge = validators, candidates, remaining
+	}()
+	metrics.Enabled = true
+	kickOutCounter, cancelCandidateCounter = metrics.NewCounterForced(), metrics.NewCounterForced()
+	validatorsGauge, candidatesGauge, epochRemainingGauge = metrics.NewGauge(), metrics.NewGauge(), metrics.NewGauge()
+
+	// The first block of an epoch kicking out a validator
+	addresses := []common.Address{
+		common.HexToAddress("0xcc7c8317b21e1cea6139700c3c46c21af998d14c"),
+		common.HexToAddress("0x44d1ce0b7cb3588bca96151fe1bc05af38f91b6c"),
+		common.HexToAddress("0xf541c3cd1d2df407fb9bb52b3489fc2aaeedd97e"),
+	}
+	config := params.EqualityConfig{Epoch: 30, MaxValidatorsCount: 3, KickOutRatio: 50, MinCandidateBalance: big.NewInt(0)}
+	snap := newKickOutTestSnapshot(t, addresses)
+	header := newTestHeader(31, HeaderExtra{})
+	header.ParentHash = common.HexToHash("0x01")
+	headerExtra := HeaderExtra{Epoch: 2, EpochBlock: 31}
+	e := New(&config, nil)
+	assert.Nil(t, e.tryElect(config, nil, header, snap, &headerExtra, nil))
+	assert.Len(t, headerExtra.CurrentBlockKickOutCandidates, 1)
+
+	reportMetrics(config, 31, len(header.Extra), snap, headerExtra)
+	reportMetrics(config, 32, len(header.Extra), snap, HeaderExtra{Epoch: 2, EpochBlock: 31, CurrentBlockCancelCandidates: addresses[:1]})
+	assert.Equal(t, int64(1), kickOutCounter.Count())
+	assert.Equal(t, int64(1), cancelCandidateCounter.Count())
+	assert.Equal(t, int64(3), validatorsGauge.Value())
+	assert.Equal(t, int64(5), candidatesGauge.Value())
+	assert.Equal(t, int64(29), epochRemainingGauge.Value())
+}
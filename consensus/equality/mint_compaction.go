@@ -0,0 +1,126 @@
+package equality
+
+import (
+	"encoding/binary"
+
+	"github.com/SecretBlockChain/go-secret/common"
+	"github.com/SecretBlockChain/go-secret/consensus"
+	"github.com/SecretBlockChain/go-secret/core/types"
+	"github.com/SecretBlockChain/go-secret/ethdb"
+	"github.com/SecretBlockChain/go-secret/log"
+	"github.com/SecretBlockChain/go-secret/rlp"
+)
+
+var epochMintsPrefix = []byte("equality-mints-") // key: equality-mints-{epoch}:{epochMints}
+
+// mintedBlock is a block of the mint count trie and the validator sealing it.
+type mintedBlock struct {
+	Number    uint64
+	Validator common.Address
+}
+
+// epochMints is the blocks minted in an epoch the transition block of a later
+// epoch compacted out of the mint count trie. The records are written along
+// the epoch index, an entry is only valid while its block is canonical.
+type epochMints struct {
+	Epoch  uint64
+	Number uint64
+	Hash   common.Hash
+	Blocks []mintedBlock
+}
+
+// epochMintsKey returns the database key of the blocks minted in epoch.
+func epochMintsKey(epoch uint64) []byte {
+	key := make([]byte, len(epochMintsPrefix)+8)
+	copy(key, epochMintsPrefix)
+	binary.BigEndian.PutUint64(key[len(epochMintsPrefix):], epoch)
+	return key
+}
+
+// readEpochMints retrieves the blocks minted in epoch, nil if none recorded.
+func readEpochMints(db ethdb.KeyValueReader, epoch uint64) *epochMints {
+	data, err := db.Get(epochMintsKey(epoch))
+	if err != nil || len(data) == 0 {
+		return nil
+	}
+	mints := new(epochMints)
+	if err = rlp.DecodeBytes(data, mints); err != nil {
+		log.Warn("[equality] Invalid epoch mints", "epoch", epoch, "err", err)
+		return nil
+	}
+	return mints
+}
+
+// writeEpochMints records into batch the blocks of the past epochs the
+// transition block header compacts out of the mint count trie, the ones left
+// in the snapshot of its parent: the previous epoch, every earlier one at the
+// first compaction. Nothing is recorded before the mint compaction block, nor
+// if the snapshot of the parent is missing after a sync.
+func (e *Equality) writeEpochMints(batch ethdb.KeyValueWriter, chain consensus.ChainHeaderReader,
+	header *types.Header, headerExtra HeaderExtra) error {
+
+	number := header.Number.Uint64()
+	if number <= 1 {
+		return nil
+	}
+	parent := chain.GetHeader(header.ParentHash, number-1)
+	if parent == nil {
+		return consensus.ErrUnknownAncestor
+	}
+	config, err := e.chainConfig(parent)
+	if err != nil {
+		log.Warn("[equality] Failed to load chain config for epoch mints", "epoch", headerExtra.Epoch, "number", number, "err", err)
+		return nil
+	}
+	if !config.IsMintCompaction(header.Number) {
+		return nil
+	}
+	parentExtra, err := e.DecodeHeaderExtraCached(parent)
+	if err != nil {
+		return err
+	}
+	if !e.snapshots.available(parentExtra.Root) {
+		log.Warn("[equality] Missing snapshot for epoch mints", "epoch", headerExtra.Epoch, "number", number)
+		return nil
+	}
+	mints, err := e.snapshots.open(parentExtra.Root).pastMints(headerExtra.Epoch)
+	if err != nil {
+		log.Warn("[equality] Failed to read epoch mints", "epoch", headerExtra.Epoch, "number", number, "err", err)
+		return nil
+	}
+	for epoch, blocks := range mints {
+		data, err := rlp.EncodeToBytes(epochMints{Epoch: epoch, Number: number, Hash: header.Hash(), Blocks: blocks})
+		if err != nil {
+			return err
+		}
+		if err = batch.Put(epochMintsKey(epoch), data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// mintedBlocks returns the blocks minted in epoch, taken from snap, the
+// snapshot of a block of a later epoch, or from the records of the canonical
+// chain of head once compacted out of the mint count trie. The epoch index is
+// brought up to head if the epoch is not recorded.
+func (e *Equality) mintedBlocks(chain consensus.ChainHeaderReader, head *types.Header, snap *Snapshot, epoch uint64) ([]mintedBlock, error) {
+	blocks, err := snap.epochMints(epoch)
+	if err != nil || len(blocks) > 0 {
+		return blocks, err
+	}
+	canonical := func(mints *epochMints) bool {
+		header := chain.GetHeaderByNumber(mints.Number)
+		return header != nil && header.Hash() == mints.Hash
+	}
+	if mints := readEpochMints(e.db, epoch); mints != nil && canonical(mints) {
+		return mints.Blocks, nil
+	}
+	if _, err = e.IndexEpochs(chain, head); err != nil {
+		return nil, err
+	}
+	if mints := readEpochMints(e.db, epoch); mints != nil && canonical(mints) {
+		return mints.Blocks, nil
+	}
+	return blocks, nil
+}
@@ -0,0 +1,79 @@
+package equality
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/SecretBlockChain/go-secret/common"
+	"github.com/SecretBlockChain/go-secret/core/rawdb"
+	"github.com/SecretBlockChain/go-secret/core/types"
+	"github.com/SecretBlockChain/go-secret/crypto"
+	"github.com/SecretBlockChain/go-secret/params"
+	"github.com/SecretBlockChain/go-secret/rpc"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMintCompaction(t *testing.T) {
+	key, _ := crypto.GenerateKey()
+	validator := crypto.PubkeyToAddress(key.PublicKey)
+	config := *params.AllEthashProtocolChanges
+	config.Ethash = nil
+	config.Equality = &params.EqualityConfig{Epoch: 3, MaxValidatorsCount: 1, MinCandidateBalance: big.NewInt(0),
+		Validators: []common.Address{validator}, MintCompactionBlock: big.NewInt(7)}
+
+	// Seal four epochs, the transition of epoch 3 compacting the first two.
+	// The chain verifying every block matches the roots its producer sealed
+	chain, engine := newTestBlockChain(t, rawdb.NewMemoryDatabase(), &config, key)
+	defer chain.Stop()
+	for number := 1; number <= 12; number++ {
+		_, err := chain.InsertChain(types.Blocks{sealTestBlock(t, chain, engine, key)})
+		assert.Nil(t, err, "block %d", number)
+	}
+	headers := make([]*types.Header, 13)
+	for number := range headers {
+		headers[number] = chain.GetHeaderByNumber(uint64(number))
+	}
+	snapAt := func(number int) *Snapshot {
+		snap, err := engine.snapshot(chain, headers[number], nil)
+		assert.Nil(t, err)
+		return snap
+	}
+	counts, err := snapAt(6).MintCounts(1)
+	assert.Nil(t, err)
+	assert.Equal(t, map[common.Address]uint64{validator: 3}, counts)
+	for epoch := uint64(1); epoch <= 3; epoch++ {
+		blocks, err := snapAt(9).epochMints(epoch)
+		assert.Nil(t, err)
+		assert.Equal(t, epoch == 3, len(blocks) == 3, "epoch %d", epoch)
+	}
+
+	// The snapshots replayed from the header extras compact alike
+	known := &testHeaderChain{config: &config, headers: headers}
+	db := rawdb.NewMemoryDatabase()
+	_, err = GenesisHeaderExtra(*config.Equality, db)
+	assert.Nil(t, err)
+	replayed, err := New(config.Equality, db).snapshot(known, headers[12], nil)
+	assert.Nil(t, err)
+	root, err := replayed.Root()
+	assert.Nil(t, err)
+	headerExtra, err := DecodeHeaderExtra(headers[12])
+	assert.Nil(t, err)
+	assert.Equal(t, headerExtra.Root, root)
+
+	// The compacted epochs stay available from the epoch index
+	api := &API{chain: chain, equality: engine}
+	number := rpc.BlockNumber(12)
+	for epoch := uint64(1); epoch <= 4; epoch++ {
+		counts, err := api.GetMintCount(&number, &epoch)
+		assert.Nil(t, err)
+		assert.Equal(t, map[common.Address]uint64{validator: 3}, counts, "epoch %d", epoch)
+	}
+	assert.Equal(t, uint64(7), readEpochMints(engine.db, 1).Number)
+	assert.Equal(t, uint64(10), readEpochMints(engine.db, 3).Number)
+	assert.Nil(t, readEpochMints(engine.db, 4))
+	stats, err := api.GetValidatorStats(validator, 1, 4)
+	assert.Nil(t, err)
+	for _, epoch := range stats.Epochs {
+		assert.Equal(t, 3, int(epoch.Sealed), "epoch %d", epoch.Epoch)
+	}
+}
@@ -0,0 +1,183 @@
+package equality
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/SecretBlockChain/go-secret/common"
+	"github.com/SecretBlockChain/go-secret/log"
+)
+
+// defaultMismatchSummaryInterval is the default interval the repeated consensus
+// mismatches are summarized at.
+const defaultMismatchSummaryInterval = time.Minute
+
+// maxConsensusMismatches is the max number of distinct consensus mismatches
+// kept, the least recently seen one is dropped for a new one.
+const maxConsensusMismatches = 256
+
+// mismatchKey is the signature consensus mismatches are aggregated by.
+type mismatchKey struct {
+	field  string
+	ours   string
+	theirs string
+}
+
+// consensusMismatch is a field of the blocks whose locally computed value
+// differs from the one of the blocks, the same values seen count times.
+type consensusMismatch struct {
+	source    string      // Check the mismatch failed, "root" or "header extra"
+	key       mismatchKey // Field and values differing
+	count     uint64      // Blocks the mismatch was seen for
+	reported  uint64      // Count at the last summary
+	first     uint64      // Number of the first block failing
+	last      uint64      // Number of the last block failing
+	lastHash  common.Hash // Hash of the last block failing
+	firstSeen time.Time
+	lastSeen  time.Time
+}
+
+// mismatchReporter aggregates the consensus mismatches of the blocks failing
+// to import by field and differing values. The first occurrence of a mismatch
+// is logged at once, the repeated ones are counted and summarized at most once
+// an interval, as mismatches are reported, instead of logged for every block.
+type mismatchReporter struct {
+	logger      log.Logger
+	interval    time.Duration
+	mismatches  map[mismatchKey]*consensusMismatch
+	lastSummary time.Time
+	now         func() time.Time
+	lock        sync.Mutex
+}
+
+// newMismatchReporter creates a mismatch reporter logging to logger.
+func newMismatchReporter(logger log.Logger) *mismatchReporter {
+	return &mismatchReporter{
+		logger:     logger,
+		interval:   defaultMismatchSummaryInterval,
+		mismatches: make(map[mismatchKey]*consensusMismatch),
+		now:        time.Now,
+	}
+}
+
+// mismatchKeyOf returns the signature of a field difference, address lists are
+// keyed by the addresses removed and added.
+func mismatchKeyOf(diff FieldDifference) mismatchKey {
+	if len(diff.Added) > 0 || len(diff.Removed) > 0 {
+		return mismatchKey{field: diff.Field, ours: "-" + validatorsToString(diff.Removed), theirs: "+" + validatorsToString(diff.Added)}
+	}
+	return mismatchKey{field: diff.Field, ours: diff.Ours, theirs: diff.Theirs}
+}
+
+// report records the differences of the block of number and hash found by the
+// check source, logging the ones not seen before and summarizing the repeated
+// ones if the interval elapsed.
+func (reporter *mismatchReporter) report(source string, number uint64, hash common.Hash, diff HeaderExtraDifference) {
+	reporter.lock.Lock()
+	defer reporter.lock.Unlock()
+
+	now := reporter.now()
+	if reporter.lastSummary.IsZero() {
+		reporter.lastSummary = now
+	}
+	for _, field := range diff {
+		key := mismatchKeyOf(field)
+		mismatch, ok := reporter.mismatches[key]
+		if !ok {
+			reporter.evict()
+			mismatch = &consensusMismatch{source: source, key: key, first: number, firstSeen: now}
+			reporter.mismatches[key] = mismatch
+			reporter.logger.Error("[equality] Consensus mismatch", "source", source, "number", number, "hash", hash,
+				"field", key.field, "ours", key.ours, "theirs", key.theirs)
+		}
+		mismatch.count++
+		mismatch.last, mismatch.lastHash, mismatch.lastSeen = number, hash, now
+		if !ok {
+			mismatch.reported = mismatch.count
+		}
+	}
+	if now.Sub(reporter.lastSummary) >= reporter.interval {
+		reporter.summarize(now)
+	}
+}
+
+// summarize logs the mismatches repeated since the last summary.
+func (reporter *mismatchReporter) summarize(now time.Time) {
+	for _, mismatch := range reporter.sorted() {
+		if mismatch.count == mismatch.reported {
+			continue
+		}
+		reporter.logger.Warn("[equality] Consensus mismatch repeated", "source", mismatch.source,
+			"field", mismatch.key.field, "ours", mismatch.key.ours, "theirs", mismatch.key.theirs,
+			"repeats", mismatch.count-mismatch.reported, "total", mismatch.count, "last", mismatch.last)
+		mismatch.reported = mismatch.count
+	}
+	reporter.lastSummary = now
+}
+
+// evict drops the least recently seen mismatch if the mismatches are full.
+func (reporter *mismatchReporter) evict() {
+	if len(reporter.mismatches) < maxConsensusMismatches {
+		return
+	}
+	var oldest *consensusMismatch
+	for _, mismatch := range reporter.mismatches {
+		if oldest == nil || mismatch.lastSeen.Before(oldest.lastSeen) {
+			oldest = mismatch
+		}
+	}
+	delete(reporter.mismatches, oldest.key)
+}
+
+// sorted returns the mismatches the most recently seen first.
+func (reporter *mismatchReporter) sorted() []*consensusMismatch {
+	mismatches := make([]*consensusMismatch, 0, len(reporter.mismatches))
+	for _, mismatch := range reporter.mismatches {
+		mismatches = append(mismatches, mismatch)
+	}
+	sort.Slice(mismatches, func(i, j int) bool {
+		if !mismatches[i].lastSeen.Equal(mismatches[j].lastSeen) {
+			return mismatches[i].lastSeen.After(mismatches[j].lastSeen)
+		}
+		if mismatches[i].last != mismatches[j].last {
+			return mismatches[i].last > mismatches[j].last
+		}
+		return mismatches[i].key.field < mismatches[j].key.field
+	})
+	return mismatches
+}
+
+// recent returns copies of the mismatches the most recently seen first.
+func (reporter *mismatchReporter) recent() []consensusMismatch {
+	reporter.lock.Lock()
+	defer reporter.lock.Unlock()
+
+	mismatches := reporter.sorted()
+	result := make([]consensusMismatch, 0, len(mismatches))
+	for _, mismatch := range mismatches {
+		result = append(result, *mismatch)
+	}
+	return result
+}
+
+// setInterval sets the interval the repeated mismatches are summarized at.
+func (reporter *mismatchReporter) setInterval(interval time.Duration) {
+	reporter.lock.Lock()
+	defer reporter.lock.Unlock()
+	reporter.interval = interval
+}
+
+// summaryInterval returns the interval the repeated mismatches are summarized
+// at.
+func (reporter *mismatchReporter) summaryInterval() time.Duration {
+	reporter.lock.Lock()
+	defer reporter.lock.Unlock()
+	return reporter.interval
+}
+
+// SetMismatchSummaryInterval sets the interval the repeated consensus
+// mismatches of the blocks failing to import are summarized at.
+func (e *Equality) SetMismatchSummaryInterval(interval time.Duration) {
+	e.mismatches.setInterval(interval)
+}
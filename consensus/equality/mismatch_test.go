@@ -0,0 +1,91 @@
+package equality
+
+import (
+	"testing"
+	"time"
+
+	"github.com/SecretBlockChain/go-secret/common"
+	"github.com/SecretBlockChain/go-secret/core/rawdb"
+	"github.com/SecretBlockChain/go-secret/log"
+	"github.com/SecretBlockChain/go-secret/params"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMismatchReporter(t *testing.T) {
+	var records []*log.Record
+	logger := log.New()
+	logger.SetHandler(log.FuncHandler(func(r *log.Record) error {
+		records = append(records, r)
+		return nil
+	}))
+	now := time.Unix(1623283200, 0)
+	reporter := newMismatchReporter(logger)
+	reporter.now = func() time.Time { return now }
+
+	ours := Root{CandidateHash: common.HexToHash("0x01")}
+	theirs := Root{CandidateHash: common.HexToHash("0x02")}
+	validator := common.HexToAddress("0xa000000000000000000000000000000000000000")
+
+	// The first occurrence is logged at once, the repeats are only counted
+	for number := uint64(10); number < 20; number++ {
+		reporter.report("root", number, common.Hash{byte(number)}, ours.fieldDifference(theirs))
+		now = now.Add(time.Second)
+	}
+	assert.Len(t, records, 1)
+	assert.Equal(t, log.LvlError, records[0].Lvl)
+	assert.Equal(t, []interface{}{"source", "root", "number", uint64(10), "hash", common.Hash{10},
+		"field", "root.candidateHash", "ours", ours.CandidateHash.String(), "theirs", theirs.CandidateHash.String()}, records[0].Ctx)
+
+	// A different signature is logged at once as well
+	diff := HeaderExtraDifference{{Field: "currentEpochValidators", Added: []common.Address{validator}}}
+	reporter.report("header extra", 20, common.Hash{20}, diff)
+	assert.Len(t, records, 2)
+
+	// The repeats are summarized once the interval elapsed
+	now = now.Add(defaultMismatchSummaryInterval)
+	reporter.report("root", 21, common.Hash{21}, ours.fieldDifference(theirs))
+	assert.Len(t, records, 3)
+	assert.Equal(t, log.LvlWarn, records[2].Lvl)
+	assert.Equal(t, []interface{}{"source", "root", "field", "root.candidateHash", "ours", ours.CandidateHash.String(),
+		"theirs", theirs.CandidateHash.String(), "repeats", uint64(10), "total", uint64(11), "last", uint64(21)}, records[2].Ctx)
+	now = now.Add(defaultMismatchSummaryInterval)
+	reporter.report("header extra", 22, common.Hash{22}, diff)
+	assert.Len(t, records, 4)
+	assert.Equal(t, uint64(1), records[3].Ctx[9])
+
+	recent := reporter.recent()
+	assert.Len(t, recent, 2)
+	assert.Equal(t, mismatchKey{field: "currentEpochValidators", ours: "-[]", theirs: "+" + validatorsToString([]common.Address{validator})}, recent[0].key)
+	assert.Equal(t, uint64(2), recent[0].count)
+	assert.Equal(t, uint64(11), recent[1].count)
+	assert.Equal(t, uint64(10), recent[1].first)
+	assert.Equal(t, uint64(21), recent[1].last)
+
+	// The least recently seen mismatch makes room for a new one
+	for i := 0; i < maxConsensusMismatches; i++ {
+		now = now.Add(time.Second)
+		reporter.report("root", 30, common.Hash{30}, HeaderExtraDifference{{Field: "epoch", Ours: "1", Theirs: string(rune('a' + i))}})
+	}
+	recent = reporter.recent()
+	assert.Len(t, recent, maxConsensusMismatches)
+	for _, mismatch := range recent {
+		assert.Equal(t, "epoch", mismatch.key.field)
+	}
+}
+
+func TestConsensusMismatchesAPI(t *testing.T) {
+	e := New(&params.EqualityConfig{}, rawdb.NewMemoryDatabase())
+	api := &AdminAPI{chain: &testHeaderChain{}, equality: e}
+	assert.Empty(t, api.ConsensusMismatches())
+
+	e.mismatches.report("header extra", 5, common.Hash{5}, HeaderExtraDifference{{Field: "epoch", Ours: "1", Theirs: "2"}})
+	result := api.ConsensusMismatches()
+	assert.Len(t, result, 1)
+	assert.Equal(t, "header extra", result[0].Source)
+	assert.Equal(t, "epoch", result[0].Field)
+	assert.Equal(t, "1", result[0].Ours)
+	assert.Equal(t, "2", result[0].Theirs)
+	assert.Equal(t, uint64(1), uint64(result[0].Count))
+	assert.Equal(t, uint64(5), uint64(result[0].LastNumber))
+	assert.Equal(t, common.Hash{5}, result[0].LastHash)
+}
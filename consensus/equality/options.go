@@ -0,0 +1,209 @@
+package equality
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/SecretBlockChain/go-secret/common/math"
+	"github.com/SecretBlockChain/go-secret/consensus"
+	"github.com/SecretBlockChain/go-secret/log"
+	"github.com/SecretBlockChain/go-secret/params"
+)
+
+// maxHeaderExtraCacheSize is the max number of decoded header extras an option
+// change may have the engine cache.
+const maxHeaderExtraCacheSize = 1 << 16
+
+// Names of the local options of the engine, changed at runtime without restart.
+// None of them is consensus-critical: nodes running other values agree on the
+// same chain.
+const (
+	headerExtraCacheOption        = "headerExtraCacheSize"    // Number of decoded header extras cached
+	snapshotFlushIntervalOption   = "snapshotFlushInterval"   // Number of blocks between persisted snapshots
+	mismatchSummaryIntervalOption = "mismatchSummaryInterval" // Interval the repeated mismatches are logged at
+	consensusTxGasFloorOption     = "consensusTxGasFloor"     // Gas price in wei the consensus transactions are reserved from
+)
+
+var (
+	// errUnknownOption is returned if an option changed is not a local option
+	// of the engine.
+	errUnknownOption = errors.New("unknown option")
+
+	// errConsensusOption is returned if an option changed is a parameter of
+	// the chain config, which the validators change through on-chain proposals.
+	errConsensusOption = errors.New("consensus-critical option")
+
+	// errInvalidOption is returned if the value of an option changed doesn't
+	// parse or is out of range.
+	errInvalidOption = errors.New("invalid option value")
+)
+
+// engineOption is a local option of the engine: get formats its running value,
+// parse validates a new value, returning the change applying it.
+type engineOption struct {
+	get   func(e *Equality) string
+	parse func(value string) (func(e *Equality), error)
+}
+
+// engineOptions are the local options changed through SetOption.
+var engineOptions = map[string]engineOption{
+	headerExtraCacheOption: {
+		get: func(e *Equality) string { return strconv.Itoa(e.headerExtraCacheSize()) },
+		parse: func(value string) (func(e *Equality), error) {
+			size, err := strconv.Atoi(value)
+			if err != nil || size < 1 || size > maxHeaderExtraCacheSize {
+				return nil, fmt.Errorf("%w: %s must be within 1 and %d", errInvalidOption, headerExtraCacheOption, maxHeaderExtraCacheSize)
+			}
+			return func(e *Equality) { e.SetHeaderExtraCacheSize(size) }, nil
+		},
+	},
+	snapshotFlushIntervalOption: {
+		get: func(e *Equality) string { return strconv.FormatUint(e.snapshots.flushInterval(), 10) },
+		parse: func(value string) (func(e *Equality), error) {
+			interval, err := strconv.ParseUint(value, 10, 64)
+			if err != nil || interval == 0 {
+				return nil, fmt.Errorf("%w: %s must be a positive number of blocks", errInvalidOption, snapshotFlushIntervalOption)
+			}
+			return func(e *Equality) { e.SetSnapshotFlushInterval(interval) }, nil
+		},
+	},
+	mismatchSummaryIntervalOption: {
+		get: func(e *Equality) string { return e.mismatches.summaryInterval().String() },
+		parse: func(value string) (func(e *Equality), error) {
+			interval, err := time.ParseDuration(value)
+			if err != nil || interval <= 0 {
+				return nil, fmt.Errorf("%w: %s must be a positive duration", errInvalidOption, mismatchSummaryIntervalOption)
+			}
+			return func(e *Equality) { e.SetMismatchSummaryInterval(interval) }, nil
+		},
+	},
+	consensusTxGasFloorOption: {
+		get: func(e *Equality) string { return e.ConsensusTxGasFloor().String() },
+		parse: func(value string) (func(e *Equality), error) {
+			floor, ok := math.ParseBig256(value)
+			if !ok || floor.Sign() < 0 {
+				return nil, fmt.Errorf("%w: %s must be a gas price in wei", errInvalidOption, consensusTxGasFloorOption)
+			}
+			return func(e *Equality) { e.SetConsensusTxGasFloor(floor) }, nil
+		},
+	},
+}
+
+// chainConfigOptions are the json names of the chain config parameters,
+// rejected as options.
+var chainConfigOptions = func() map[string]bool {
+	names := make(map[string]bool)
+	kind := reflect.TypeOf(params.EqualityConfig{})
+	for i := 0; i < kind.NumField(); i++ {
+		if name := strings.Split(kind.Field(i).Tag.Get("json"), ",")[0]; name != "" && name != "-" {
+			names[name] = true
+		}
+	}
+	return names
+}()
+
+// SetOption validates and changes the local option of name to value on the
+// running engine. Parameters of the chain config are rejected: they are agreed
+// on by the validators through config proposals.
+func (e *Equality) SetOption(name, value string) error {
+	option, ok := engineOptions[name]
+	if !ok {
+		if chainConfigOptions[name] {
+			return fmt.Errorf("%w: %s is a chain config parameter, change it through a config proposal of the validators (equality:1:event:propose)",
+				errConsensusOption, name)
+		}
+		return fmt.Errorf("%w: %s, not one of %s", errUnknownOption, name, strings.Join(optionNames(), ", "))
+	}
+	apply, err := option.parse(strings.TrimSpace(value))
+	if err != nil {
+		return err
+	}
+
+	e.optionsLock.Lock()
+	defer e.optionsLock.Unlock()
+	apply(e)
+	log.Info("[equality] Changed option", "name", name, "value", option.get(e))
+	return nil
+}
+
+// Options returns the running values of the local options by name.
+func (e *Equality) Options() map[string]string {
+	e.optionsLock.Lock()
+	defer e.optionsLock.Unlock()
+
+	options := make(map[string]string, len(engineOptions))
+	for name, option := range engineOptions {
+		options[name] = option.get(e)
+	}
+	return options
+}
+
+// optionNames returns the names of the local options in order.
+func optionNames() []string {
+	names := make([]string, 0, len(engineOptions))
+	for name := range engineOptions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// SetHeaderExtraCacheSize sets the number of decoded header extras cached, the
+// least recently used ones beyond are evicted.
+func (e *Equality) SetHeaderExtraCacheSize(size int) {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	e.headerExtras.Resize(size)
+	e.extrasCache = size
+}
+
+// headerExtraCacheSize returns the number of decoded header extras cached.
+func (e *Equality) headerExtraCacheSize() int {
+	e.lock.RLock()
+	defer e.lock.RUnlock()
+	return e.extrasCache
+}
+
+// SetConsensusTxGasFloor sets the gas price the consensus transactions need for
+// the miner to reserve them room in its blocks, the ones priced lower compete
+// with the other transactions.
+func (e *Equality) SetConsensusTxGasFloor(floor *big.Int) {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	e.gasFloor = new(big.Int).Set(floor)
+}
+
+// ConsensusTxGasFloor returns the gas price the consensus transactions need for
+// the miner to reserve them room in its blocks.
+func (e *Equality) ConsensusTxGasFloor() *big.Int {
+	e.lock.RLock()
+	defer e.lock.RUnlock()
+	return new(big.Int).Set(e.gasFloor)
+}
+
+// AdminAPI offers the changes of the local options of a running node and the
+// operations signing with its validator key. It is exposed in a namespace of
+// its own, equalityadmin, served over IPC and over HTTP or WebSocket only if
+// listed explicitly.
+type AdminAPI struct {
+	chain    consensus.ChainHeaderReader
+	equality *Equality
+}
+
+// SetOption changes the local option of name to value, one of the names listed
+// by GetOptions. Chain config parameters are rejected.
+func (api *AdminAPI) SetOption(name string, value string) error {
+	return api.equality.SetOption(name, value)
+}
+
+// GetOptions returns the running values of the local options by name.
+func (api *AdminAPI) GetOptions() map[string]string {
+	return api.equality.Options()
+}
@@ -0,0 +1,167 @@
+package equality
+
+import (
+	"errors"
+	"math/big"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/SecretBlockChain/go-secret/common"
+	"github.com/SecretBlockChain/go-secret/core/rawdb"
+	"github.com/SecretBlockChain/go-secret/core/types"
+	"github.com/SecretBlockChain/go-secret/crypto"
+	"github.com/SecretBlockChain/go-secret/node"
+	"github.com/SecretBlockChain/go-secret/params"
+	"github.com/SecretBlockChain/go-secret/rpc"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSetOption(t *testing.T) {
+	e := New(params.TestnetEqualityConfig(), rawdb.NewMemoryDatabase())
+	api := &AdminAPI{equality: e}
+	assert.Equal(t, map[string]string{
+		headerExtraCacheOption:        strconv.Itoa(inMemoryExtras),
+		snapshotFlushIntervalOption:   strconv.Itoa(snapshotFlushInterval),
+		mismatchSummaryIntervalOption: defaultMismatchSummaryInterval.String(),
+		consensusTxGasFloorOption:     "0",
+	}, api.GetOptions())
+
+	tests := []struct {
+		name  string
+		value string
+		want  string // Running value after the change, empty if rejected
+		err   error
+	}{
+		{headerExtraCacheOption, "2", "2", nil},
+		{headerExtraCacheOption, "0", "", errInvalidOption},
+		{headerExtraCacheOption, "1000000", "", errInvalidOption},
+		{snapshotFlushIntervalOption, " 16 ", "16", nil},
+		{snapshotFlushIntervalOption, "0", "", errInvalidOption},
+		{snapshotFlushIntervalOption, "-1", "", errInvalidOption},
+		{mismatchSummaryIntervalOption, "90s", "1m30s", nil},
+		{mismatchSummaryIntervalOption, "0s", "", errInvalidOption},
+		{mismatchSummaryIntervalOption, "soon", "", errInvalidOption},
+		{consensusTxGasFloorOption, "1000000000", "1000000000", nil},
+		{consensusTxGasFloorOption, "0x10", "16", nil},
+		{consensusTxGasFloorOption, "-1", "", errInvalidOption},
+
+		// The chain config parameters are consensus-critical
+		{"period", "1", "", errConsensusOption},
+		{"epoch", "100", "", errConsensusOption},
+		{"maxValidatorsCount", "7", "", errConsensusOption},
+		{"maxHeaderExtraSize", "1024", "", errConsensusOption},
+		{"validatorCountFormula", LinearValidatorCount, "", errConsensusOption},
+		{"futureDrift", "1s", "", errUnknownOption},
+	}
+	for _, test := range tests {
+		before := api.GetOptions()
+		err := api.SetOption(test.name, test.value)
+		if test.err != nil {
+			assert.True(t, errors.Is(err, test.err), "%s=%s: %v", test.name, test.value, err)
+			assert.Equal(t, before, api.GetOptions(), "%s=%s", test.name, test.value)
+			continue
+		}
+		assert.Nil(t, err, "%s=%s", test.name, test.value)
+		assert.Equal(t, test.want, api.GetOptions()[test.name])
+	}
+	assert.Contains(t, api.SetOption("epoch", "1").Error(), "config proposal")
+	assert.Equal(t, uint64(16), e.snapshots.flushInterval())
+	assert.Equal(t, 90*time.Second, e.mismatches.summaryInterval())
+	assert.Equal(t, big.NewInt(16), e.ConsensusTxGasFloor())
+
+	// A smaller cache evicts the least recently used header extras
+	for number := int64(1); number <= 3; number++ {
+		e.headerExtras.Add(common.BigToHash(big.NewInt(number)), HeaderExtra{})
+	}
+	assert.Equal(t, 2, e.headerExtras.Len())
+	assert.Nil(t, e.SetOption(headerExtraCacheOption, "1"))
+	assert.Equal(t, 1, e.headerExtras.Len())
+	assert.True(t, e.headerExtras.Contains(common.BigToHash(big.NewInt(3))))
+}
+
+func TestSetOptionWhileImporting(t *testing.T) {
+	key, _ := crypto.GenerateKey()
+	validator := crypto.PubkeyToAddress(key.PublicKey)
+	config := *params.AllEthashProtocolChanges
+	config.Ethash = nil
+	config.Equality = &params.EqualityConfig{Epoch: 3, MaxValidatorsCount: 1, MinCandidateBalance: big.NewInt(0),
+		Validators: []common.Address{validator}}
+
+	chain, engine := newTestBlockChain(t, rawdb.NewMemoryDatabase(), &config, key)
+	defer chain.Stop()
+
+	// Options are toggled and read back while the blocks import
+	var (
+		wg   sync.WaitGroup
+		quit = make(chan struct{})
+	)
+	toggles := map[string][]string{
+		headerExtraCacheOption:        {"1", "2", "512"},
+		snapshotFlushIntervalOption:   {"1", "2", "5"},
+		mismatchSummaryIntervalOption: {"1ms", "1s"},
+		consensusTxGasFloorOption:     {"0", "1"},
+	}
+	for name, values := range toggles {
+		wg.Add(1)
+		go func(name string, values []string) {
+			defer wg.Done()
+			for i := 0; ; i++ {
+				select {
+				case <-quit:
+					return
+				default:
+				}
+				assert.Nil(t, engine.SetOption(name, values[i%len(values)]))
+				assert.Len(t, engine.Options(), len(engineOptions))
+			}
+		}(name, values)
+	}
+	for number := 1; number <= 12; number++ {
+		_, err := chain.InsertChain(types.Blocks{sealTestBlock(t, chain, engine, key)})
+		assert.Nil(t, err, "block %d", number)
+	}
+	close(quit)
+	wg.Wait()
+
+	// The snapshots of the blocks imported are intact whatever the interval
+	// they were persisted at
+	assert.Nil(t, engine.SetOption(snapshotFlushIntervalOption, "1"))
+	head := chain.CurrentHeader()
+	headerExtra, err := DecodeHeaderExtra(head)
+	assert.Nil(t, err)
+	assert.Nil(t, engine.snapshots.checkIntact(headerExtra.Root))
+	assert.Equal(t, uint64(12), head.Number.Uint64())
+}
+
+func TestAdminAPINamespace(t *testing.T) {
+	e := New(params.TestnetEqualityConfig(), rawdb.NewMemoryDatabase())
+	apis := e.APIs(&testHeaderChain{})
+
+	// Whitelisting the equality namespace over HTTP or WebSocket leaves the
+	// admin methods out
+	server := rpc.NewServer()
+	defer server.Stop()
+	assert.Nil(t, node.RegisterApisFromWhitelist(apis, []string{"equality"}, server, false))
+	client := rpc.DialInProc(server)
+	defer client.Close()
+	for _, method := range []string{"setOption", "getOptions", "signCheckpoint", "generateCheckpoint", "consensusMismatches", "getFaults"} {
+		for _, namespace := range []string{"equality", "equalityadmin"} {
+			var result interface{}
+			err := client.Call(&result, namespace+"_"+method)
+			assert.NotNil(t, err, namespace+"_"+method)
+			assert.Contains(t, err.Error(), "does not exist", namespace+"_"+method)
+		}
+	}
+
+	// Listed explicitly, the admin namespace serves them
+	server = rpc.NewServer()
+	defer server.Stop()
+	assert.Nil(t, node.RegisterApisFromWhitelist(apis, []string{"equalityadmin"}, server, false))
+	client = rpc.DialInProc(server)
+	defer client.Close()
+	var options map[string]string
+	assert.Nil(t, client.Call(&options, "equalityadmin_getOptions"))
+	assert.NotEmpty(t, options)
+}
@@ -0,0 +1,84 @@
+package equality
+
+import (
+	"bytes"
+	"encoding/binary"
+
+	"github.com/SecretBlockChain/go-secret/common"
+	"github.com/SecretBlockChain/go-secret/core/types"
+	"github.com/SecretBlockChain/go-secret/crypto"
+	"github.com/SecretBlockChain/go-secret/ethdb/memorydb"
+	"github.com/SecretBlockChain/go-secret/trie"
+)
+
+// The proofs of the snapshot tries follow the conventions of eth_getProof: the
+// rlp encoded nodes on the path of the key from the root down, proving either
+// the value of the key or its absence. The keys are the full trie keys, the
+// prefix of the trie included.
+
+// proofList collects the nodes of a proof in the order they are written.
+type proofList [][]byte
+
+func (n *proofList) Put(key []byte, value []byte) error {
+	*n = append(*n, common.CopyBytes(value))
+	return nil
+}
+
+func (n *proofList) Delete(key []byte) error {
+	panic("not supported")
+}
+
+// proveEntry returns the full key of the entry key of the trie of prefix, its
+// value, nil if absent, and the proof of the value.
+func (snap *Snapshot) proveEntry(prefix, key []byte) ([]byte, []byte, [][]byte, error) {
+	t, err := snap.ensureTrie(prefix)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	value, err := t.TryGet(key)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	var proof proofList
+	if err = t.Prove(key, 0, &proof); err != nil {
+		return nil, nil, nil, err
+	}
+	return append(common.CopyBytes(prefix), key...), value, proof, nil
+}
+
+// ProveCandidate returns the candidate trie key of address, the rlp encoded
+// Candidate stored under it, nil if address is not a candidate, and its proof.
+func (snap *Snapshot) ProveCandidate(address common.Address) ([]byte, []byte, [][]byte, error) {
+	return snap.proveEntry(candidatePrefix, address.Bytes())
+}
+
+// ProveMintBlock returns the mint count trie key of block number of epoch, the
+// address of the validator sealing it, nil if unknown, and its proof.
+func (snap *Snapshot) ProveMintBlock(epoch, number uint64) ([]byte, []byte, [][]byte, error) {
+	key := make([]byte, 16)
+	binary.BigEndian.PutUint64(key[:8], epoch)
+	binary.BigEndian.PutUint64(key[8:], number)
+	return snap.proveEntry(mintCntPrefix, key)
+}
+
+// VerifyEqualityProof returns whether proof proves that the trie of root holds
+// value at key, an empty value proving its absence. It needs no database, the
+// key is the full trie key returned along with the proof.
+func VerifyEqualityProof(root common.Hash, key, value []byte, proof [][]byte) bool {
+	// Empty tries have no node to prove the absence with
+	if root == (common.Hash{}) || root == types.EmptyRootHash {
+		return len(proof) == 0 && len(value) == 0
+	}
+
+	db := memorydb.New()
+	for _, node := range proof {
+		if err := db.Put(crypto.Keccak256(node), node); err != nil {
+			return false
+		}
+	}
+	proven, err := trie.VerifyProof(root, key, db)
+	if err != nil {
+		return false
+	}
+	return bytes.Equal(proven, value)
+}
@@ -0,0 +1,68 @@
+package equality
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/SecretBlockChain/go-secret/common"
+	"github.com/SecretBlockChain/go-secret/core/rawdb"
+	"github.com/SecretBlockChain/go-secret/core/types"
+	"github.com/SecretBlockChain/go-secret/rlp"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVerifyEqualityProof(t *testing.T) {
+	snap, err := newSnapshot(rawdb.NewMemoryDatabase())
+	assert.Nil(t, err)
+
+	// Absences are proven in empty tries without nodes
+	outsider := common.HexToAddress("0xa000000000000000000000000000000000000000")
+	key, value, proof, err := snap.ProveCandidate(outsider)
+	assert.Nil(t, err)
+	assert.Nil(t, value)
+	assert.Empty(t, proof)
+	assert.True(t, VerifyEqualityProof(common.Hash{}, key, nil, proof))
+	assert.True(t, VerifyEqualityProof(types.EmptyRootHash, key, nil, proof))
+
+	var candidates []common.Address
+	for i := int64(1); i <= 20; i++ {
+		candidate := common.BigToAddress(big.NewInt(i))
+		candidates = append(candidates, candidate)
+		_, err = snap.BecomeCandidate(candidate, uint64(i), big.NewInt(i*100))
+		assert.Nil(t, err)
+	}
+	root, err := snap.Root()
+	assert.Nil(t, err)
+	assert.Nil(t, snap.Commit(root))
+
+	// The entry of a candidate proves its deposit
+	key, value, proof, err = snap.ProveCandidate(candidates[4])
+	assert.Nil(t, err)
+	assert.Equal(t, append(common.CopyBytes(candidatePrefix), candidates[4].Bytes()...), key)
+	var candidate Candidate
+	assert.Nil(t, rlp.DecodeBytes(value, &candidate))
+	assert.Equal(t, big.NewInt(500), candidate.Staked)
+	assert.True(t, VerifyEqualityProof(root.CandidateHash, key, value, proof))
+
+	// Other values, keys, roots and tampered proofs fail
+	other, err := rlp.EncodeToBytes(Candidate{Staked: big.NewInt(1000), BlockNumber: 5})
+	assert.Nil(t, err)
+	assert.False(t, VerifyEqualityProof(root.CandidateHash, key, other, proof))
+	assert.False(t, VerifyEqualityProof(root.CandidateHash, key, nil, proof))
+	assert.False(t, VerifyEqualityProof(root.MintCntHash, key, value, proof))
+	otherKey, _, _, err := snap.ProveCandidate(candidates[5])
+	assert.Nil(t, err)
+	assert.False(t, VerifyEqualityProof(root.CandidateHash, otherKey, value, proof))
+	tampered := append([][]byte{}, proof...)
+	tampered[len(tampered)-1] = append(common.CopyBytes(tampered[len(tampered)-1]), 0)
+	assert.False(t, VerifyEqualityProof(root.CandidateHash, key, value, tampered))
+	assert.False(t, VerifyEqualityProof(root.CandidateHash, key, value, proof[1:]))
+
+	// The absence of a non candidate is proven, not its presence
+	key, value, proof, err = snap.ProveCandidate(outsider)
+	assert.Nil(t, err)
+	assert.Nil(t, value)
+	assert.NotEmpty(t, proof)
+	assert.True(t, VerifyEqualityProof(root.CandidateHash, key, nil, proof))
+	assert.False(t, VerifyEqualityProof(root.CandidateHash, key, other, proof))
+}
@@ -0,0 +1,324 @@
+package equality
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+
+	"github.com/SecretBlockChain/go-secret/common"
+	"github.com/SecretBlockChain/go-secret/crypto"
+	"github.com/SecretBlockChain/go-secret/params"
+	"github.com/SecretBlockChain/go-secret/rlp"
+	"github.com/SecretBlockChain/go-secret/trie"
+)
+
+// proposalPrefix is the prefix of the config proposals in the config trie,
+// key: proposal-{hash}:{PendingProposal}
+var proposalPrefix = []byte("proposal-")
+
+// ConfigProposal is a chain config change proposed by a validator, it is
+// included in a header extra once approved by a quorum of the validators.
+type ConfigProposal struct {
+	Proposer common.Address        `json:"proposer"`
+	Config   params.EqualityConfig `json:"config"`
+}
+
+// Hash returns the hash identifying the proposed config, proposals of the same
+// config by different validators are the same proposal.
+func (proposal ConfigProposal) Hash() common.Hash {
+	return configHash(proposal.Config)
+}
+
+// Equal compares two config proposals for equality.
+func (proposal ConfigProposal) Equal(other ConfigProposal) bool {
+	return proposal.Proposer == other.Proposer && proposal.Config.Equal(other.Config)
+}
+
+// ConfigApproval is the approval of a config proposal by a validator.
+type ConfigApproval struct {
+	Validator common.Address `json:"validator"`
+	Proposal  common.Hash    `json:"proposal"`
+}
+
+// PendingProposal is a config proposal awaiting the approval of a quorum.
+type PendingProposal struct {
+	Config    params.EqualityConfig
+	Number    uint64           // Block the config was proposed in
+	Approvals []common.Address // Validators approving the config, the proposer first
+}
+
+// expired returns whether the proposal is expired at the block of number,
+// proposals are open for the blocks of an epoch.
+func (proposal PendingProposal) expired(number uint64, config params.EqualityConfig) bool {
+	return number > proposal.Number+config.Epoch
+}
+
+// configHash returns the hash of the rlp encoding of a chain config.
+func configHash(config params.EqualityConfig) common.Hash {
+	data, err := rlp.EncodeToBytes(config)
+	if err != nil {
+		panic(err)
+	}
+	return crypto.Keccak256Hash(data)
+}
+
+// configQuorum returns whether the approvals reach the quorum of validators
+// required by the chain config, approvals of others are not counted.
+func configQuorum(config params.EqualityConfig, approvals, validators []common.Address) bool {
+	if len(validators) == 0 {
+		return false
+	}
+
+	var count uint64
+	for _, validator := range NewAddressSet(approvals...).Slice() {
+		if addressesExist(validators, validator) {
+			count++
+		}
+	}
+	if config.ConfigQuorum == 0 {
+		return count*3 >= uint64(len(validators))*2
+	}
+	return count*100 >= uint64(len(validators))*config.ConfigQuorum
+}
+
+// GetConfigProposal returns the pending proposal of the config with hash, nil
+// if the config has not been proposed.
+func (snap *Snapshot) GetConfigProposal(hash common.Hash) (*PendingProposal, error) {
+	configTrie, err := snap.ensureTrie(configPrefix)
+	if err != nil {
+		return nil, err
+	}
+
+	value, err := configTrie.TryGet(append(proposalPrefix, hash.Bytes()...))
+	if err != nil || value == nil {
+		return nil, err
+	}
+
+	var proposal PendingProposal
+	if err = rlp.DecodeBytes(value, &proposal); err != nil {
+		return nil, err
+	}
+	return &proposal, nil
+}
+
+// GetConfigProposals returns the pending proposals ordered by hash.
+func (snap *Snapshot) GetConfigProposals() ([]common.Hash, []PendingProposal, error) {
+	configTrie, err := snap.ensureTrie(configPrefix)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var hashes []common.Hash
+	var proposals []PendingProposal
+	iter := trie.NewIterator(configTrie.PrefixIterator(proposalPrefix))
+	for iter.Next() {
+		var proposal PendingProposal
+		if err = rlp.DecodeBytes(iter.Value, &proposal); err != nil {
+			return nil, nil, err
+		}
+		hashes = append(hashes, common.BytesToHash(iter.Key))
+		proposals = append(proposals, proposal)
+	}
+	if iter.Err != nil {
+		return nil, nil, iter.Err
+	}
+	return hashes, proposals, nil
+}
+
+// ProposeConfig records the config proposal made in the block of number,
+// replacing the previous proposal of the same config.
+func (snap *Snapshot) ProposeConfig(proposal ConfigProposal, number uint64) error {
+	configTrie, err := snap.ensureTrie(configPrefix)
+	if err != nil {
+		return err
+	}
+
+	value, err := rlp.EncodeToBytes(PendingProposal{
+		Config:    proposal.Config,
+		Number:    number,
+		Approvals: []common.Address{proposal.Proposer},
+	})
+	if err != nil {
+		return err
+	}
+	return configTrie.TryUpdate(append(proposalPrefix, proposal.Hash().Bytes()...), value)
+}
+
+// ApproveConfig records the approval of a pending proposal.
+func (snap *Snapshot) ApproveConfig(approval ConfigApproval) error {
+	proposal, err := snap.GetConfigProposal(approval.Proposal)
+	if err != nil {
+		return err
+	}
+	if proposal == nil {
+		return fmt.Errorf("%w: %s", errUnknownProposal, approval.Proposal.Hex())
+	}
+	if addressesExist(proposal.Approvals, approval.Validator) {
+		return nil
+	}
+	proposal.Approvals = append(proposal.Approvals, approval.Validator)
+
+	configTrie, err := snap.ensureTrie(configPrefix)
+	if err != nil {
+		return err
+	}
+	value, err := rlp.EncodeToBytes(proposal)
+	if err != nil {
+		return err
+	}
+	return configTrie.TryUpdate(append(proposalPrefix, approval.Proposal.Bytes()...), value)
+}
+
+// ClearConfigProposals removes all pending proposals.
+func (snap *Snapshot) ClearConfigProposals() error {
+	hashes, _, err := snap.GetConfigProposals()
+	if err != nil {
+		return err
+	}
+
+	configTrie, err := snap.ensureTrie(configPrefix)
+	if err != nil {
+		return err
+	}
+	for _, hash := range hashes {
+		if err = configTrie.TryDelete(append(proposalPrefix, hash.Bytes()...)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// applyConfigProposal records the config proposal of a validator made in the
+// block of number. A config may only be proposed again once its previous
+// proposal expired.
+func (snap *Snapshot) applyConfigProposal(config params.EqualityConfig, number uint64, proposal ConfigProposal) error {
+	validators, err := snap.GetValidators()
+	if err != nil {
+		return err
+	}
+	if !addressesExist(validators, proposal.Proposer) {
+		return fmt.Errorf("%w: %s", errUnauthorizedProposal, proposal.Proposer.Hex())
+	}
+	if err := validateChainConfig(proposal.Config); err != nil {
+		return err
+	}
+	if activation := proposal.Config.ActivationBlock; activation != 0 && activation <= number {
+		return fmt.Errorf("%w: %d <= %d", errPastActivation, activation, number)
+	}
+
+	pending, err := snap.GetConfigProposal(proposal.Hash())
+	if err != nil {
+		return err
+	}
+	if pending != nil && !pending.expired(number, config) {
+		return fmt.Errorf("%w: %s", errDuplicateProposal, proposal.Hash().Hex())
+	}
+	return snap.ProposeConfig(proposal, number)
+}
+
+// applyConfigApproval records the approval of a validator of a proposal not
+// expired at the block of number.
+func (snap *Snapshot) applyConfigApproval(config params.EqualityConfig, number uint64, approval ConfigApproval) error {
+	validators, err := snap.GetValidators()
+	if err != nil {
+		return err
+	}
+	if !addressesExist(validators, approval.Validator) {
+		return fmt.Errorf("%w: %s", errUnauthorizedProposal, approval.Validator.Hex())
+	}
+
+	pending, err := snap.GetConfigProposal(approval.Proposal)
+	if err != nil {
+		return err
+	}
+	if pending == nil || pending.expired(number, config) {
+		return fmt.Errorf("%w: %s", errUnknownProposal, approval.Proposal.Hex())
+	}
+	if addressesExist(pending.Approvals, approval.Validator) {
+		return fmt.Errorf("%w: %s by %s", errDuplicateApproval, approval.Proposal.Hex(), approval.Validator.Hex())
+	}
+	return snap.ApproveConfig(approval)
+}
+
+// approvedConfig returns the first config proposed or approved in the block of
+// number whose proposal reaches the quorum, nil if there is none.
+func (snap *Snapshot) approvedConfig(config params.EqualityConfig, number uint64, headerExtra HeaderExtra) (*params.EqualityConfig, error) {
+	hashes := make([]common.Hash, 0, len(headerExtra.CurrentBlockProposals)+len(headerExtra.CurrentBlockApprovals))
+	for _, proposal := range headerExtra.CurrentBlockProposals {
+		hashes = append(hashes, proposal.Hash())
+	}
+	for _, approval := range headerExtra.CurrentBlockApprovals {
+		hashes = append(hashes, approval.Proposal)
+	}
+	if len(hashes) == 0 {
+		return nil, nil
+	}
+
+	validators, err := snap.GetValidators()
+	if err != nil {
+		return nil, err
+	}
+	for _, hash := range hashes {
+		pending, err := snap.GetConfigProposal(hash)
+		if err != nil {
+			return nil, err
+		}
+		if pending != nil && !pending.expired(number, config) && configQuorum(config, pending.Approvals, validators) {
+			return &pending.Config, nil
+		}
+	}
+	return nil, nil
+}
+
+// applyApprovedConfig schedules a config included in the block of number, its
+// proposal must reach the quorum. The competing proposals are discarded.
+func (snap *Snapshot) applyApprovedConfig(config params.EqualityConfig, number uint64, approved params.EqualityConfig) error {
+	hash := configHash(approved)
+	pending, err := snap.GetConfigProposal(hash)
+	if err != nil {
+		return err
+	}
+	validators, err := snap.GetValidators()
+	if err != nil {
+		return err
+	}
+	if pending == nil || pending.expired(number, config) || !configQuorum(config, pending.Approvals, validators) {
+		return fmt.Errorf("%w: %s", errUnapprovedConfig, hash.Hex())
+	}
+
+	if err = snap.ScheduleChainConfig(approved); err != nil {
+		return err
+	}
+	return snap.ClearConfigProposals()
+}
+
+// Return a copy of a ConfigProposal slice sorted by hash.
+func configProposalsSort(slice []ConfigProposal) []ConfigProposal {
+	if len(slice) == 0 {
+		return slice
+	}
+
+	result := make([]ConfigProposal, len(slice))
+	copy(result, slice)
+	sort.Slice(result, func(i, j int) bool {
+		return bytes.Compare(result[i].Hash().Bytes(), result[j].Hash().Bytes()) < 0
+	})
+	return result
+}
+
+// Return a copy of a ConfigApproval slice sorted by proposal and validator.
+func configApprovalsSort(slice []ConfigApproval) []ConfigApproval {
+	if len(slice) == 0 {
+		return slice
+	}
+
+	result := make([]ConfigApproval, len(slice))
+	copy(result, slice)
+	sort.Slice(result, func(i, j int) bool {
+		if cmp := bytes.Compare(result[i].Proposal[:], result[j].Proposal[:]); cmp != 0 {
+			return cmp < 0
+		}
+		return bytes.Compare(result[i].Validator[:], result[j].Validator[:]) < 0
+	})
+	return result
+}
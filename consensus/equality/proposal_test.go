@@ -0,0 +1,144 @@
+package equality
+
+import (
+	"crypto/ecdsa"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/SecretBlockChain/go-secret/common"
+	"github.com/SecretBlockChain/go-secret/core/rawdb"
+	"github.com/SecretBlockChain/go-secret/core/state"
+	"github.com/SecretBlockChain/go-secret/core/types"
+	"github.com/SecretBlockChain/go-secret/crypto"
+	"github.com/SecretBlockChain/go-secret/params"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConfigQuorum(t *testing.T) {
+	validators := []common.Address{
+		common.HexToAddress("0x01"), common.HexToAddress("0x02"),
+		common.HexToAddress("0x03"), common.HexToAddress("0x04"),
+	}
+	for idx, test := range []struct {
+		quorum    uint64
+		approvals []common.Address
+		reached   bool
+	}{
+		{0, validators[:2], false},
+		{0, validators[:3], true},
+		{50, validators[:2], true},
+		{50, validators[:1], false},
+		{100, validators[:3], false},
+		// Approvals of others and duplicates are not counted
+		{50, []common.Address{validators[0], validators[0]}, false},
+		{50, []common.Address{validators[0], common.HexToAddress("0x05")}, false},
+	} {
+		config := params.EqualityConfig{ConfigQuorum: test.quorum}
+		assert.Equal(t, test.reached, configQuorum(config, test.approvals, validators), "test %d", idx)
+	}
+	assert.False(t, configQuorum(params.EqualityConfig{}, validators, nil))
+}
+
+func TestConfigProposals(t *testing.T) {
+	var keys []*ecdsa.PrivateKey
+	var validators []common.Address
+	for i := 0; i < 4; i++ {
+		key, _ := crypto.GenerateKey()
+		keys = append(keys, key)
+		validators = append(validators, crypto.PubkeyToAddress(key.PublicKey))
+	}
+	outsider := keys[3]
+	validators = validators[:3]
+
+	db := rawdb.NewMemoryDatabase()
+	statedb, err := state.New(common.Hash{}, state.NewDatabase(db), nil)
+	assert.Nil(t, err)
+	config := params.EqualityConfig{Period: 3, Epoch: 30, MaxValidatorsCount: 3, MinCandidateBalance: big.NewInt(0)}
+	e := New(&config, db)
+
+	// The block producer mines and a verifier replays the header extras
+	newParent := func() *Snapshot {
+		snap, err := newSnapshot(db)
+		assert.Nil(t, err)
+		assert.Nil(t, snap.SetChainConfig(config))
+		assert.Nil(t, snap.SetValidators(validators))
+		return snap
+	}
+	mined, replayed := newParent(), newParent()
+	mine := func(number uint64, txs ...*types.Transaction) HeaderExtra {
+		header := &types.Header{Number: new(big.Int).SetUint64(number), Coinbase: validators[0]}
+		headerExtra := HeaderExtra{Epoch: 1, EpochBlock: 1}
+		assert.Nil(t, mined.MintBlock(1, number, header.Coinbase))
+		e.processTransactions(config, statedb, header, mined, &headerExtra, txs)
+		assert.Nil(t, headerExtra.Validate(number, config))
+
+		assert.Nil(t, replayed.apply(config, header, headerExtra))
+		have, err := replayed.Root()
+		assert.Nil(t, err)
+		want, err := mined.Root()
+		assert.Nil(t, err)
+		assert.Equal(t, want, have)
+		return headerExtra
+	}
+	propose := func(key *ecdsa.PrivateKey, config params.EqualityConfig) *types.Transaction {
+		data, err := json.Marshal(config)
+		assert.Nil(t, err)
+		return newVoteTestTransaction(t, key, "equality:1:event:propose:"+string(data))
+	}
+	approve := func(key *ecdsa.PrivateKey, hash common.Hash) *types.Transaction {
+		return newVoteTestTransaction(t, key, "equality:1:event:approve:"+hash.Hex())
+	}
+
+	// Competing proposals, the one of the outsider is ignored
+	configA, configB := config, config
+	configA.Period, configB.Period = 7, 9
+	proposalA := ConfigProposal{Proposer: validators[0], Config: configA}
+	proposalB := ConfigProposal{Proposer: validators[1], Config: configB}
+	headerExtra := mine(2, propose(keys[0], configA), propose(keys[1], configB), propose(outsider, configB), propose(keys[2], configA))
+	assert.Equal(t, 2, len(headerExtra.CurrentBlockProposals))
+	assert.Empty(t, headerExtra.ChainConfig)
+
+	// The first proposal reaching the quorum is included and discards the other
+	headerExtra = mine(3, approve(outsider, proposalB.Hash()), approve(keys[0], proposalA.Hash()), approve(keys[2], proposalA.Hash()))
+	assert.Equal(t, []ConfigApproval{{Validator: validators[2], Proposal: proposalA.Hash()}}, headerExtra.CurrentBlockApprovals)
+	assert.Equal(t, 1, len(headerExtra.ChainConfig))
+	assert.True(t, headerExtra.ChainConfig[0].Equal(configA))
+	recorded, err := mined.GetChainConfig()
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(7), recorded.Period)
+	pending, err := mined.GetConfigProposal(proposalB.Hash())
+	assert.Nil(t, err)
+	assert.Nil(t, pending)
+
+	data, err := headerExtra.Encode()
+	assert.Nil(t, err)
+	decoded, err := NewHeaderExtra(data)
+	assert.Nil(t, err)
+	assert.True(t, decoded.Equal(headerExtra))
+
+	// Invalid configs can not be proposed
+	invalid := config
+	invalid.Period = 0
+	headerExtra = mine(4, approve(keys[2], proposalB.Hash()), propose(keys[0], invalid))
+	assert.Empty(t, headerExtra.CurrentBlockApprovals)
+	assert.Empty(t, headerExtra.CurrentBlockProposals)
+	assert.Empty(t, headerExtra.ChainConfig)
+
+	// Proposals expire after an epoch
+	headerExtra = mine(5, propose(keys[1], configB))
+	assert.Equal(t, 1, len(headerExtra.CurrentBlockProposals))
+	assert.True(t, headerExtra.CurrentBlockProposals[0].Equal(proposalB))
+	headerExtra = mine(36, approve(keys[0], proposalB.Hash()))
+	assert.Empty(t, headerExtra.CurrentBlockApprovals)
+
+	// Verification rejects the approval of an expired proposal and unapproved configs
+	header := &types.Header{Number: big.NewInt(37)}
+	expired := HeaderExtra{Epoch: 2, EpochBlock: 31, CurrentBlockApprovals: []ConfigApproval{{Validator: validators[0], Proposal: proposalB.Hash()}}}
+	assert.True(t, errors.Is(replayed.apply(config, header, expired), errUnknownProposal))
+	unapproved := HeaderExtra{Epoch: 2, EpochBlock: 31, ChainConfig: []params.EqualityConfig{configB}}
+	assert.True(t, errors.Is(replayed.apply(config, header, unapproved), errUnapprovedConfig))
+	outsiders := HeaderExtra{Epoch: 2, EpochBlock: 31, CurrentBlockProposals: []ConfigProposal{{Proposer: crypto.PubkeyToAddress(outsider.PublicKey), Config: configB}}}
+	assert.True(t, errors.Is(replayed.apply(config, header, outsiders), errUnauthorizedProposal))
+}
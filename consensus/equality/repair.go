@@ -0,0 +1,230 @@
+package equality
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/SecretBlockChain/go-secret/common"
+	"github.com/SecretBlockChain/go-secret/consensus"
+	"github.com/SecretBlockChain/go-secret/core/types"
+	"github.com/SecretBlockChain/go-secret/ethdb"
+	"github.com/SecretBlockChain/go-secret/log"
+	"github.com/SecretBlockChain/go-secret/rlp"
+)
+
+var repairProgressKey = []byte("equality-repair-progress") // key: equality-repair-progress:{repairProgress}
+
+const (
+	maxRepairCheckpoints = 64              // Number of checkpoints searched for intact tries before replaying from genesis
+	repairReportInterval = 8 * time.Second // Interval the progress of a repair is logged at
+)
+
+// repairProgress is the last block whose tries a repair rebuilt and persisted.
+type repairProgress struct {
+	Number uint64
+	Hash   common.Hash
+}
+
+// readRepairProgress retrieves the block the last repair reached, nil if none.
+func readRepairProgress(db ethdb.KeyValueReader) *repairProgress {
+	data, err := db.Get(repairProgressKey)
+	if err != nil || len(data) == 0 {
+		return nil
+	}
+	progress := new(repairProgress)
+	if err = rlp.DecodeBytes(data, progress); err != nil {
+		log.Warn("[equality] Invalid repair progress", "err", err)
+		return nil
+	}
+	return progress
+}
+
+// writeRepairProgress stores the block of header as the one a repair reached.
+func writeRepairProgress(db ethdb.KeyValueWriter, header *types.Header) error {
+	data, err := rlp.EncodeToBytes(repairProgress{Number: header.Number.Uint64(), Hash: header.Hash()})
+	if err != nil {
+		return err
+	}
+	return db.Put(repairProgressKey, data)
+}
+
+// Error implements error, a repair failing at the first block whose roots
+// differ from the rebuilt ones.
+func (mismatch *RootMismatch) Error() string {
+	return fmt.Sprintf("root mismatch at block %d (%s): %s", mismatch.Number, mismatch.Hash.Hex(), mismatch.Difference)
+}
+
+// Repair rebuilds the snapshot tries of the canonical blocks up to block upto,
+// the head if zero, in db after a corruption left nodes of them missing. The
+// header extras are replayed from the block the last repair reached or the
+// latest checkpoint whose tries are whole, from genesis otherwise, and each
+// block is checked to carry the rebuilt roots: the first one differing is
+// returned as a *RootMismatch.
+//
+// The tries are persisted every snapshot flush interval along the progress,
+// an interrupted repair resumes from the last persisted block.
+func Repair(chain consensus.ChainHeaderReader, db ethdb.Database, upto uint64) error {
+	_, err := repair(chain, db, upto, snapshotFlushInterval)
+	return err
+}
+
+// repair is Repair persisting the tries every interval blocks, returning the
+// block the replay started from.
+func repair(chain consensus.ChainHeaderReader, db ethdb.Database, upto, interval uint64) (uint64, error) {
+	config := chain.Config().Equality
+	if config == nil {
+		return 0, ErrChainConfigMissing
+	}
+	head := chain.CurrentHeader()
+	if head == nil {
+		return 0, errUnknownBlock
+	}
+	if upto == 0 {
+		upto = head.Number.Uint64()
+	}
+	if upto > head.Number.Uint64() {
+		return 0, fmt.Errorf("%w: block %d beyond the head", errUnknownBlock, upto)
+	}
+	if interval == 0 {
+		interval = 1
+	}
+
+	e := New(config, db)
+	e.SetSnapshotFlushInterval(interval)
+	defer e.Close()
+
+	start, snap, err := e.repairStart(chain, upto, interval)
+	if err != nil {
+		return 0, err
+	}
+	log.Info("[equality] Repairing snapshot tries", "from", start, "upto", upto)
+
+	var (
+		begin    = time.Now()
+		reported = begin
+	)
+	for number := start + 1; number <= upto; number++ {
+		header := chain.GetHeaderByNumber(number)
+		if header == nil {
+			return start, fmt.Errorf("%w: block %d", errUnknownBlock, number)
+		}
+		headerExtra, err := e.DecodeHeaderExtraCached(header)
+		if err != nil {
+			return start, fmt.Errorf("block %d (%s): %w", number, header.Hash().Hex(), err)
+		}
+		config, err := e.chainConfigByHash(snap.root.ConfigHash)
+		if err != nil {
+			return start, err
+		}
+		if err = snap.apply(config, header, headerExtra); err != nil {
+			return start, fmt.Errorf("block %d (%s): %w", number, header.Hash().Hex(), err)
+		}
+		root, err := snap.Root()
+		if err != nil {
+			return start, err
+		}
+		if root != headerExtra.Root {
+			replayed := headerExtra
+			replayed.Root = root
+			return start, &RootMismatch{Number: number, Hash: header.Hash(), Difference: replayed.Difference(headerExtra)}
+		}
+		if err = e.snapshots.add(number, root); err != nil {
+			return start, err
+		}
+		if number%interval == 0 {
+			if err = writeRepairProgress(db, header); err != nil {
+				return start, err
+			}
+		}
+		snap = e.snapshots.open(root)
+
+		if time.Since(reported) >= repairReportInterval {
+			done, elapsed := number-start, time.Since(begin)
+			eta := time.Duration(float64(elapsed) / float64(done) * float64(upto-number))
+			log.Info("[equality] Repairing snapshot tries", "number", number, "upto", upto,
+				"elapsed", common.PrettyDuration(elapsed), "eta", common.PrettyDuration(eta))
+			reported = time.Now()
+		}
+	}
+
+	if err = e.snapshots.flush(); err != nil {
+		return start, err
+	}
+	if upto > 0 {
+		if err = writeRepairProgress(db, chain.GetHeaderByNumber(upto)); err != nil {
+			return start, err
+		}
+	}
+	log.Info("[equality] Repaired snapshot tries", "from", start, "upto", upto, "elapsed", common.PrettyDuration(time.Since(begin)))
+	return start, nil
+}
+
+// repairStart returns the block a repair up to block upto replays from and
+// its snapshot: the block the last repair reached, else the latest checkpoint
+// of interval blocks, if its tries are whole, else genesis, whose tries are
+// recreated from the genesis config.
+func (e *Equality) repairStart(chain consensus.ChainHeaderReader, upto, interval uint64) (uint64, *Snapshot, error) {
+	if progress := readRepairProgress(e.db); progress != nil && progress.Number <= upto {
+		header := chain.GetHeaderByNumber(progress.Number)
+		if header != nil && header.Hash() == progress.Hash {
+			snap, err := e.intactSnapshot(header)
+			if err == nil {
+				return progress.Number, snap, nil
+			}
+			log.Warn("[equality] Tries of the last repair not intact", "number", progress.Number, "err", err)
+		}
+	}
+
+	checked := 0
+	for number := upto - upto%interval; number > 0 && checked < maxRepairCheckpoints; number -= interval {
+		checked++
+		header := chain.GetHeaderByNumber(number)
+		if header == nil {
+			return 0, nil, fmt.Errorf("%w: block %d", errUnknownBlock, number)
+		}
+		snap, err := e.intactSnapshot(header)
+		if err == nil {
+			return number, snap, nil
+		}
+		log.Debug("[equality] Checkpoint tries not intact", "number", number, "err", err)
+	}
+
+	genesis := chain.GetHeaderByNumber(0)
+	if genesis == nil {
+		return 0, nil, fmt.Errorf("%w: genesis", errUnknownBlock)
+	}
+	root, err := genesisRoot(genesis)
+	if err != nil {
+		return 0, nil, err
+	}
+	if root != (Root{}) {
+		headerExtra, err := GenesisHeaderExtra(*e.config, e.db)
+		if err != nil {
+			return 0, nil, err
+		}
+		if headerExtra.Root != root {
+			return 0, nil, rootMismatchError(0, headerExtra.Root, root)
+		}
+	}
+	return 0, e.snapshots.open(root), nil
+}
+
+// intactSnapshot returns the snapshot after header if every node of its tries
+// is in the database.
+func (e *Equality) intactSnapshot(header *types.Header) (*Snapshot, error) {
+	headerExtra, err := e.DecodeHeaderExtraCached(header)
+	if err != nil {
+		return nil, err
+	}
+	if err = e.snapshots.checkIntact(headerExtra.Root); err != nil {
+		return nil, err
+	}
+	return e.snapshots.open(headerExtra.Root), nil
+}
+
+// RepairEqualityTries rebuilds the snapshot tries of the canonical blocks up
+// to block upto, the head if zero, after a database corruption, reporting the
+// first block whose roots differ from the rebuilt ones.
+func (api *DebugAPI) RepairEqualityTries(upto uint64) error {
+	return Repair(api.chain, api.equality.db, upto)
+}
@@ -0,0 +1,108 @@
+package equality
+
+import (
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/SecretBlockChain/go-secret/common"
+	"github.com/SecretBlockChain/go-secret/core/rawdb"
+	"github.com/SecretBlockChain/go-secret/core/types"
+	"github.com/SecretBlockChain/go-secret/crypto"
+	"github.com/SecretBlockChain/go-secret/params"
+	"github.com/SecretBlockChain/go-secret/trie"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRepair(t *testing.T) {
+	key, _ := crypto.GenerateKey()
+	validator := crypto.PubkeyToAddress(key.PublicKey)
+	config := *params.AllEthashProtocolChanges
+	config.Ethash = nil
+	config.Equality = &params.EqualityConfig{Epoch: 3, MaxValidatorsCount: 1, MinCandidateBalance: big.NewInt(0),
+		Validators: []common.Address{validator}}
+
+	db := rawdb.NewMemoryDatabase()
+	chain, engine := newTestBlockChain(t, db, &config, key)
+	for number := 1; number <= 20; number++ {
+		_, err := chain.InsertChain(types.Blocks{sealTestBlock(t, chain, engine, key)})
+		assert.Nil(t, err)
+	}
+	chain.Stop()
+	assert.Nil(t, engine.Close())
+	head := chain.CurrentHeader()
+	headExtra, err := DecodeHeaderExtra(head)
+	assert.Nil(t, err)
+	assert.Nil(t, newSnapshotLayers(db, 1).checkIntact(headExtra.Root))
+
+	// A node lost below the root of the mint count trie goes unnoticed by the
+	// availability check, not by the walk of the tries
+	mintCntTrie, err := trie.New(headExtra.Root.MintCntHash, newSnapshotLayers(db, 1).triedb)
+	assert.Nil(t, err)
+	var lost common.Hash
+	for it := mintCntTrie.NodeIterator(nil); it.Next(true); {
+		if hash := it.Hash(); hash != (common.Hash{}) && hash != headExtra.Root.MintCntHash {
+			lost = hash
+			break
+		}
+	}
+	if !assert.NotEqual(t, common.Hash{}, lost) {
+		return
+	}
+	rawdb.DeleteTrieNode(db, lost)
+	assert.True(t, newSnapshotLayers(db, 1).available(headExtra.Root))
+	assert.NotNil(t, newSnapshotLayers(db, 1).checkIntact(headExtra.Root))
+
+	// The repair replays from the latest intact checkpoint, then resumes from
+	// the block it reached
+	start, err := repair(chain, db, 10, 4)
+	assert.Nil(t, err)
+	assert.True(t, start <= 8 && start%4 == 0, "start %d", start)
+	start, err = repair(chain, db, 0, 4)
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(10), start)
+	assert.Nil(t, newSnapshotLayers(db, 1).checkIntact(headExtra.Root))
+	assert.Equal(t, head.Hash(), readRepairProgress(db).Hash)
+
+	// Without progress the latest checkpoint is intact now
+	assert.Nil(t, db.Delete(repairProgressKey))
+	start, err = repair(chain, db, 0, 4)
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(20), start)
+
+	// With every trie lost the repair replays from genesis and reports the
+	// first block carrying other roots, its progress kept
+	headers := &testHeaderChain{config: &config}
+	for number := uint64(0); number <= head.Number.Uint64(); number++ {
+		headers.headers = append(headers.headers, chain.GetHeaderByNumber(number))
+	}
+	forged := &testHeaderChain{config: &config, headers: append([]*types.Header{}, headers.headers...)}
+	header := types.CopyHeader(forged.headers[15])
+	headerExtra, err := DecodeHeaderExtra(header)
+	assert.Nil(t, err)
+	headerExtra.Root.MintCntHash = common.HexToHash("0x01")
+	header.Extra, err = EncodeHeaderExtra(header.Extra[:ExtraVanity], headerExtra)
+	assert.Nil(t, err)
+	forged.headers[15] = header
+
+	lostDb := rawdb.NewMemoryDatabase()
+	start, err = repair(forged, lostDb, 0, 4)
+	assert.Equal(t, uint64(0), start)
+	var mismatch *RootMismatch
+	if assert.True(t, errors.As(err, &mismatch), "err %v", err) {
+		assert.Equal(t, uint64(15), mismatch.Number)
+		assert.Equal(t, header.Hash(), mismatch.Hash)
+		assert.Len(t, mismatch.Difference, 1)
+		assert.Equal(t, "root.mintCntHash", mismatch.Difference[0].Field)
+	}
+	assert.Equal(t, uint64(12), readRepairProgress(lostDb).Number)
+	start, err = repair(headers, lostDb, 0, 4)
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(12), start)
+	assert.Nil(t, newSnapshotLayers(lostDb, 1).checkIntact(headExtra.Root))
+
+	// The debug API repairs up to the head
+	api := &DebugAPI{chain: chain, equality: New(config.Equality, db)}
+	assert.Nil(t, api.RepairEqualityTries(0))
+	assert.True(t, errors.Is(api.RepairEqualityTries(21), errUnknownBlock))
+}
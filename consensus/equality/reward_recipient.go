@@ -0,0 +1,121 @@
+package equality
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+
+	"github.com/SecretBlockChain/go-secret/common"
+	"github.com/SecretBlockChain/go-secret/core/types"
+	"github.com/SecretBlockChain/go-secret/params"
+	"github.com/SecretBlockChain/go-secret/rlp"
+)
+
+// RewardRecipient is the address a candidate set in a block to receive the
+// sealer rewards of its blocks instead of itself, the last one of a candidate
+// within a block is kept. A recipient equal to the candidate pays the candidate
+// again.
+type RewardRecipient struct {
+	Candidate common.Address `json:"candidate"`
+	Recipient common.Address `json:"recipient"`
+}
+
+// String implements the fmt.Stringer interface.
+func (recipient RewardRecipient) String() string {
+	return fmt.Sprintf("%s->%s", recipient.Candidate.String(), recipient.Recipient.String())
+}
+
+// SetRewardRecipient replaces the reward recipient of a candidate, cleared if
+// the candidate itself, return a bool value means address is a candidate.
+func (snap *Snapshot) SetRewardRecipient(candidateAddr common.Address, recipient common.Address) (bool, error) {
+	candidate, err := snap.GetCandidate(candidateAddr)
+	if err != nil || candidate == nil {
+		return false, err
+	}
+
+	candidateTrie, err := snap.ensureTrie(candidatePrefix)
+	if err != nil {
+		return false, err
+	}
+	candidate.RewardRecipient = nil
+	if recipient != candidateAddr {
+		candidate.RewardRecipient = &recipient
+	}
+	value, err := rlp.EncodeToBytes(candidate)
+	if err != nil {
+		return false, err
+	}
+	return true, candidateTrie.TryUpdate(candidateAddr.Bytes(), value)
+}
+
+// rewardRecipientOf returns the receiver of the sealer reward of header: the
+// recipient its coinbase set as a candidate by the parent block, from the
+// reward recipient block on, the coinbase otherwise. A recipient set in a
+// block is paid from the next block on.
+func rewardRecipientOf(config params.EqualityConfig, snap *Snapshot, header *types.Header) common.Address {
+	if snap == nil || !config.IsRewardRecipient(header.Number) {
+		return header.Coinbase
+	}
+	candidate, err := snap.GetCandidate(header.Coinbase)
+	if err != nil || candidate == nil || candidate.RewardRecipient == nil {
+		return header.Coinbase
+	}
+	return *candidate.RewardRecipient
+}
+
+// Return a copy of a RewardRecipient slice sorted by candidate address bytes,
+// the slice itself if already sorted.
+func rewardRecipientsSort(slice []RewardRecipient) []RewardRecipient {
+	if rewardRecipientsSorted(slice) {
+		return slice
+	}
+
+	result := make([]RewardRecipient, len(slice))
+	copy(result, slice)
+	sort.Slice(result, func(i, j int) bool {
+		return bytes.Compare(result[i].Candidate[:], result[j].Candidate[:]) < 0
+	})
+	return result
+}
+
+// rewardRecipientsSorted returns whether a RewardRecipient slice is sorted by
+// candidate address bytes.
+func rewardRecipientsSorted(slice []RewardRecipient) bool {
+	for idx := 1; idx < len(slice); idx++ {
+		if bytes.Compare(slice[idx-1].Candidate[:], slice[idx].Candidate[:]) > 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// Returns the candidates of a RewardRecipient slice.
+func rewardRecipientsCandidates(slice []RewardRecipient) []common.Address {
+	candidates := make([]common.Address, 0, len(slice))
+	for _, recipient := range slice {
+		candidates = append(candidates, recipient.Candidate)
+	}
+	return candidates
+}
+
+// Return a copy of a RewardRecipient slice with the recipient of the candidate
+// replaced.
+func rewardRecipientsSet(slice []RewardRecipient, recipient RewardRecipient) []RewardRecipient {
+	return append(rewardRecipientsRemove(slice, recipient.Candidate), recipient)
+}
+
+// Return a copy of a RewardRecipient slice without the recipient of the
+// candidate.
+func rewardRecipientsRemove(slice []RewardRecipient, candidate common.Address) []RewardRecipient {
+	result := make([]RewardRecipient, 0, len(slice))
+	for _, recipient := range slice {
+		if recipient.Candidate != candidate {
+			result = append(result, recipient)
+		}
+	}
+	if len(result) == 0 {
+		// Kept nil for the optional rlp field to stay unencoded
+		return nil
+	}
+	return result
+}
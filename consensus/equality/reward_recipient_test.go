@@ -0,0 +1,112 @@
+package equality
+
+import (
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/SecretBlockChain/go-secret/common"
+	"github.com/SecretBlockChain/go-secret/core/rawdb"
+	"github.com/SecretBlockChain/go-secret/core/state"
+	"github.com/SecretBlockChain/go-secret/core/types"
+	"github.com/SecretBlockChain/go-secret/crypto"
+	"github.com/SecretBlockChain/go-secret/params"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRewardRecipientSwitch(t *testing.T) {
+	key, _ := crypto.GenerateKey()
+	candidate := crypto.PubkeyToAddress(key.PublicKey)
+	recipient := common.HexToAddress("0x44d1ce0b7cb3588bca96151fe1bc05af38f91b6c")
+	config := params.EqualityConfig{Epoch: 30, MaxValidatorsCount: 3, MinCandidateBalance: big.NewInt(0),
+		Rewards: params.EqualityRewards{{Number: 1000, Reward: big.NewInt(1000)}}, RewardRecipientBlock: big.NewInt(5)}
+	base, _ := sealerReward(config, blockReward(config, 5))
+
+	db := rawdb.NewMemoryDatabase()
+	statedb, err := state.New(common.Hash{}, state.NewDatabase(db), nil)
+	assert.Nil(t, err)
+	snap, err := newSnapshot(db)
+	assert.Nil(t, err)
+	_, err = snap.BecomeCandidate(candidate, 1, big.NewInt(0))
+	assert.Nil(t, err)
+	e := New(&config, db)
+
+	// The block setting the recipient mid epoch still pays the sealer
+	header := &types.Header{Number: big.NewInt(5), Coinbase: candidate}
+	e.accumulateRewards(config, statedb, header, snap)
+	assert.Equal(t, base, statedb.GetBalance(candidate))
+	headerExtra := HeaderExtra{Epoch: 1, EpochBlock: 1}
+	txs := []*types.Transaction{newVoteTestTransaction(t, key, "equality:1:event:recipient:"+recipient.Hex())}
+	e.processTransactions(config, statedb, header, snap, &headerExtra, txs)
+	assert.Equal(t, []RewardRecipient{{Candidate: candidate, Recipient: recipient}}, headerExtra.CurrentBlockRewardRecipients)
+	assert.Nil(t, headerExtra.Validate(5, config))
+
+	// The recipient is part of the snapshot replayed from the header extra
+	replayed, err := newSnapshot(rawdb.NewMemoryDatabase())
+	assert.Nil(t, err)
+	_, err = replayed.BecomeCandidate(candidate, 1, big.NewInt(0))
+	assert.Nil(t, err)
+	assert.Nil(t, replayed.applyOperations(config, header, headerExtra))
+	root, err := snap.Root()
+	assert.Nil(t, err)
+	replayedRoot, err := replayed.Root()
+	assert.Nil(t, err)
+	assert.Equal(t, root.CandidateHash, replayedRoot.CandidateHash)
+
+	// The next block pays the recipient
+	e.accumulateRewards(config, statedb, &types.Header{Number: big.NewInt(6), Coinbase: candidate}, snap)
+	assert.Equal(t, base, statedb.GetBalance(candidate))
+	assert.Equal(t, base, statedb.GetBalance(recipient))
+
+	// Setting the candidate itself pays it again
+	txs = []*types.Transaction{newVoteTestTransaction(t, key, "equality:1:event:recipient:"+candidate.Hex())}
+	e.processTransactions(config, statedb, &types.Header{Number: big.NewInt(6)}, snap, &HeaderExtra{Epoch: 1, EpochBlock: 1}, txs)
+	e.accumulateRewards(config, statedb, &types.Header{Number: big.NewInt(7), Coinbase: candidate}, snap)
+	assert.Equal(t, new(big.Int).Mul(base, big.NewInt(2)), statedb.GetBalance(candidate))
+	assert.Equal(t, base, statedb.GetBalance(recipient))
+}
+
+func TestRewardRecipientFork(t *testing.T) {
+	key, _ := crypto.GenerateKey()
+	candidate := crypto.PubkeyToAddress(key.PublicKey)
+	recipient := common.HexToAddress("0x44d1ce0b7cb3588bca96151fe1bc05af38f91b6c")
+	txs := []*types.Transaction{newVoteTestTransaction(t, key, "equality:1:event:recipient:"+recipient.Hex())}
+	_, err := NewTransaction(newVoteTestTransaction(t, key, "equality:1:event:recipient:"+common.Address{}.Hex()))
+	assert.NotNil(t, err)
+
+	process := func(config params.EqualityConfig, register bool) HeaderExtra {
+		db := rawdb.NewMemoryDatabase()
+		statedb, err := state.New(common.Hash{}, state.NewDatabase(db), nil)
+		assert.Nil(t, err)
+		snap, err := newSnapshot(db)
+		assert.Nil(t, err)
+		if register {
+			_, err = snap.BecomeCandidate(candidate, 1, big.NewInt(0))
+			assert.Nil(t, err)
+		}
+		headerExtra := HeaderExtra{Epoch: 1, EpochBlock: 1}
+		New(&config, db).processTransactions(config, statedb, &types.Header{Number: big.NewInt(5)}, snap, &headerExtra, txs)
+		return headerExtra
+	}
+
+	// Only candidates set a recipient, once the fork is active
+	config := params.EqualityConfig{Epoch: 30, MaxValidatorsCount: 3, MinCandidateBalance: big.NewInt(0)}
+	assert.Empty(t, process(config, true).CurrentBlockRewardRecipients)
+	config.RewardRecipientBlock = big.NewInt(6)
+	assert.Empty(t, process(config, true).CurrentBlockRewardRecipients)
+	config.RewardRecipientBlock = big.NewInt(5)
+	assert.Empty(t, process(config, false).CurrentBlockRewardRecipients)
+	assert.Len(t, process(config, true).CurrentBlockRewardRecipients, 1)
+
+	set := HeaderExtra{CurrentBlockRewardRecipients: []RewardRecipient{{Candidate: candidate, Recipient: recipient}}}
+	assert.Nil(t, set.Validate(5, config))
+	assert.True(t, errors.Is(set.Validate(4, config), errInvalidRewardRecipient))
+	zero := HeaderExtra{CurrentBlockRewardRecipients: []RewardRecipient{{Candidate: candidate}}}
+	assert.True(t, errors.Is(zero.Validate(5, config), errInvalidRewardRecipient))
+
+	// The header extra of a block setting a recipient for no candidate is invalid
+	snap, err := newSnapshot(rawdb.NewMemoryDatabase())
+	assert.Nil(t, err)
+	err = snap.applyOperations(config, &types.Header{Number: big.NewInt(5)}, set)
+	assert.True(t, errors.Is(err, errInvalidRewardRecipient))
+}
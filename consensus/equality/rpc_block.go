@@ -0,0 +1,29 @@
+package equality
+
+import (
+	"github.com/SecretBlockChain/go-secret/common/hexutil"
+	"github.com/SecretBlockChain/go-secret/core/types"
+)
+
+// rpcBlockFields is the equality object added to the blocks returned by
+// eth_getBlockByNumber and eth_getBlockByHash.
+type rpcBlockFields struct {
+	Epoch      hexutil.Uint64 `json:"epoch"`
+	EpochBlock hexutil.Uint64 `json:"epochBlock"`
+	Root       Root           `json:"root"`
+}
+
+// RPCMarshalBlockFields adds the epoch and the trie roots decoded from the
+// header extra of header to the rpc fields of its block, under "equality".
+func (e *Equality) RPCMarshalBlockFields(header *types.Header, fields map[string]interface{}) error {
+	headerExtra, err := e.DecodeHeaderExtraCached(header)
+	if err != nil {
+		return err
+	}
+	fields["equality"] = rpcBlockFields{
+		Epoch:      hexutil.Uint64(headerExtra.Epoch),
+		EpochBlock: hexutil.Uint64(headerExtra.EpochBlock),
+		Root:       headerExtra.Root,
+	}
+	return nil
+}
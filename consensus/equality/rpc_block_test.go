@@ -0,0 +1,55 @@
+package equality
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/SecretBlockChain/go-secret/common"
+	"github.com/SecretBlockChain/go-secret/core/rawdb"
+	"github.com/SecretBlockChain/go-secret/core/types"
+	"github.com/SecretBlockChain/go-secret/internal/ethapi"
+	"github.com/SecretBlockChain/go-secret/rpc"
+	"github.com/stretchr/testify/assert"
+)
+
+var _ ethapi.BlockFieldsMarshaler = (*Equality)(nil)
+
+func TestRPCMarshalBlockFields(t *testing.T) {
+	headerExtra := HeaderExtra{
+		Root: Root{EpochHash: common.HexToHash("0x01"), CandidateHash: common.HexToHash("0x02"),
+			MintCntHash: common.HexToHash("0x03"), ConfigHash: common.HexToHash("0x04")},
+		Epoch:      2,
+		EpochBlock: 5,
+	}
+	api := newTestAPI(rawdb.NewMemoryDatabase(), HeaderExtra{}, headerExtra)
+	header := api.chain.GetHeaderByNumber(1)
+
+	// The block keeps its fields, the equality object is added
+	fields, err := ethapi.RPCMarshalBlock(types.NewBlockWithHeader(header), true, false)
+	assert.Nil(t, err)
+	count := len(fields)
+	assert.Nil(t, api.equality.RPCMarshalBlockFields(header, fields))
+	assert.Len(t, fields, count+1)
+	assert.Equal(t, header.Hash(), fields["hash"])
+
+	// The object agrees with the header extra
+	number := rpc.BlockNumber(1)
+	want, err := api.GetHeaderExtra(&number)
+	assert.Nil(t, err)
+	data, err := json.Marshal(fields["equality"])
+	assert.Nil(t, err)
+	var have HeaderExtraJSON
+	assert.Nil(t, json.Unmarshal(data, &have))
+	assert.Equal(t, want.Epoch, have.Epoch)
+	assert.Equal(t, want.EpochBlock, have.EpochBlock)
+	assert.Equal(t, want.Root, have.Root)
+	var object map[string]json.RawMessage
+	assert.Nil(t, json.Unmarshal(data, &object))
+	assert.Len(t, object, 3)
+
+	// A header extra that doesn't decode adds nothing
+	invalid := &types.Header{Number: header.Number, Extra: []byte{0x01}}
+	fields = make(map[string]interface{})
+	assert.NotNil(t, api.equality.RPCMarshalBlockFields(invalid, fields))
+	assert.Empty(t, fields)
+}
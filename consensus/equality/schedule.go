@@ -0,0 +1,110 @@
+package equality
+
+import (
+	"math/big"
+	"time"
+
+	"github.com/SecretBlockChain/go-secret/common"
+	"github.com/SecretBlockChain/go-secret/consensus"
+	"github.com/SecretBlockChain/go-secret/core/types"
+)
+
+// sealerSlot is the expected sealer of a future block and the estimated time
+// of the block. The sealer of a block following the next epoch transition is
+// elected there, it is unknown.
+type sealerSlot struct {
+	Number    uint64
+	Time      uint64
+	Validator common.Address
+	Known     bool
+}
+
+// sealerSchedule returns the expected sealers of the count blocks following
+// header, the in turn validators of the current epoch in its sealing order.
+// The blocks are estimated a period apart from the earliest time of the first
+// one, or from now if later. The chain config of header is assumed to remain
+// in effect over the schedule.
+func (e *Equality) sealerSchedule(header *types.Header, count, now uint64) ([]sealerSlot, error) {
+	config, err := e.chainConfig(header)
+	if err != nil {
+		return nil, err
+	}
+
+	// The validators of the current epoch seal up to the next transition
+	// block, in the order shuffled from the epoch seed once activated. The
+	// genesis validators seal the first block only
+	validators, shuffled, transition := config.Validators, config.Validators, uint64(1)
+	if header.Number.Uint64() > 0 {
+		headerExtra, err := e.DecodeHeaderExtraCached(header)
+		if err != nil {
+			return nil, err
+		}
+		snap := e.snapshots.open(headerExtra.Root)
+		if validators, err = snap.GetValidators(); err != nil {
+			return nil, err
+		}
+		length, err := snap.GetEpochLength(config)
+		if err != nil {
+			return nil, err
+		}
+		shuffled = shuffleValidators(validators, epochSeed(headerExtra))
+		transition = headerExtra.EpochBlock + length
+	}
+
+	next := earliestTime(config, header)
+	if now > next {
+		next = now
+	}
+	slots := make([]sealerSlot, 0, count)
+	for i := uint64(0); i < count; i++ {
+		slot := sealerSlot{Number: header.Number.Uint64() + 1 + i, Time: next + i*config.Period}
+		if slot.Number <= transition && len(validators) > 0 {
+			number := new(big.Int).SetUint64(slot.Number)
+			order := validators
+			if config.IsShuffle(number) {
+				order = shuffled
+			}
+			switch {
+			case config.IsDevMode():
+				slot.Validator = order[0]
+			case config.IsTurn(number):
+				slot.Validator = turnValidator(order, slot.Number)
+			default:
+				slot.Validator = order[(slot.Time-config.GenesisTimestamp)/config.Period%uint64(len(order))]
+			}
+			slot.Known = true
+		}
+		slots = append(slots, slot)
+	}
+	return slots, nil
+}
+
+// NextSlot returns the number and the estimated time of the next block after
+// the current head that signer is expected to seal in turn, false if it has
+// none before the next epoch transition.
+func (e *Equality) NextSlot(chain consensus.ChainHeaderReader, signer common.Address) (uint64, time.Time, bool) {
+	head := chain.CurrentHeader()
+	if head == nil {
+		return 0, time.Time{}, false
+	}
+	config, err := e.chainConfig(head)
+	if err != nil {
+		return 0, time.Time{}, false
+	}
+	validators, err := e.sealingValidators(config, head)
+	if err != nil || !addressesExist(validators, signer) {
+		return 0, time.Time{}, false
+	}
+
+	// Every validator is in turn once within as many blocks as validators
+	slots, err := e.sealerSchedule(head, uint64(len(validators)), uint64(time.Now().Unix()))
+	if err != nil {
+		return 0, time.Time{}, false
+	}
+	for _, slot := range slots {
+		if slot.Known && slot.Validator == signer {
+			return slot.Number, time.Unix(int64(slot.Time), 0), true
+		}
+	}
+	return 0, time.Time{}, false
+}
@@ -0,0 +1,114 @@
+package equality
+
+import (
+	"errors"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/SecretBlockChain/go-secret/common"
+	"github.com/SecretBlockChain/go-secret/core/rawdb"
+	"github.com/SecretBlockChain/go-secret/params"
+	"github.com/SecretBlockChain/go-secret/rpc"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSealerSchedule(t *testing.T) {
+	validatorA := common.HexToAddress("0xa000000000000000000000000000000000000000")
+	validatorB := common.HexToAddress("0xb000000000000000000000000000000000000000")
+	validatorC := common.HexToAddress("0xc000000000000000000000000000000000000000")
+	validators := []common.Address{validatorA, validatorB, validatorC}
+
+	db := rawdb.NewMemoryDatabase()
+	headerExtra := HeaderExtra{Root: newTestValidatorsRoot(t, db, validators), Epoch: 1, EpochBlock: 1}
+	chain := &testHeaderChain{}
+	for number := uint64(0); number <= 10; number++ {
+		header := newTestHeader(number, headerExtra)
+		header.Time = 1623283200 + number
+		if number == 9 {
+			header.Time = 1623283200 + 20
+		}
+		if number > 0 {
+			header.ParentHash = chain.headers[number-1].Hash()
+		}
+		chain.headers = append(chain.headers, header)
+	}
+
+	// The slots follow the block timestamps without turns and the block
+	// numbers with them, the sealers past the epoch transition are unknown
+	for _, test := range []struct {
+		config   params.EqualityConfig
+		expected []common.Address
+	}{
+		{newTestTurnConfig(0), []common.Address{validatorA, validatorB, validatorC, validatorA}},
+		{newTestTurnConfig(1), []common.Address{validatorB, validatorC, validatorA, validatorB}},
+	} {
+		slots, err := New(&test.config, db).sealerSchedule(chain.headers[9], 5, 0)
+		assert.Nil(t, err)
+		assert.Len(t, slots, 5)
+		for i, slot := range slots {
+			assert.Equal(t, uint64(10+i), slot.Number)
+			assert.Equal(t, uint64(1623283200+21+i), slot.Time)
+			if i < len(test.expected) {
+				assert.True(t, slot.Known, "block %d", slot.Number)
+				assert.Equal(t, test.expected[i], slot.Validator, "block %d", slot.Number)
+			} else {
+				assert.False(t, slot.Known, "block %d", slot.Number)
+				assert.Equal(t, common.Address{}, slot.Validator, "block %d", slot.Number)
+			}
+		}
+	}
+
+	// The sealing order is shuffled from the shuffle block on, and the first
+	// block is estimated from now if later
+	config := newTestTurnConfig(1)
+	config.ShuffleBlock = big.NewInt(12)
+	e := New(&config, db)
+	shuffled := shuffleValidators(validators, epochSeed(headerExtra))
+	slots, err := e.sealerSchedule(chain.headers[9], 4, 1623283200+30)
+	assert.Nil(t, err)
+	assert.Equal(t, []sealerSlot{
+		{Number: 10, Time: 1623283200 + 30, Validator: validatorB, Known: true},
+		{Number: 11, Time: 1623283200 + 31, Validator: validatorC, Known: true},
+		{Number: 12, Time: 1623283200 + 32, Validator: turnValidator(shuffled, 12), Known: true},
+		{Number: 13, Time: 1623283200 + 33, Validator: turnValidator(shuffled, 13), Known: true},
+	}, slots)
+
+	// The genesis validators seal the first block only
+	config.Validators = []common.Address{validatorC}
+	slots, err = New(&config, db).sealerSchedule(chain.headers[0], 2, 0)
+	assert.Nil(t, err)
+	assert.Equal(t, []sealerSlot{
+		{Number: 1, Time: 1623283201, Validator: validatorC, Known: true},
+		{Number: 2, Time: 1623283202},
+	}, slots)
+
+	// A validator is next in turn once within the epoch, the others never
+	turn := newTestTurnConfig(1)
+	e = New(&turn, db)
+	number, eta, ok := e.NextSlot(chain, validatorA)
+	assert.True(t, ok)
+	assert.Equal(t, uint64(12), number)
+	assert.False(t, eta.Before(time.Unix(int64(chain.headers[10].Time), 0)))
+	_, _, ok = e.NextSlot(chain, common.HexToAddress("0xd000000000000000000000000000000000000000"))
+	assert.False(t, ok)
+	_, _, ok = e.NextSlot(&testHeaderChain{}, validatorA)
+	assert.False(t, ok)
+
+	// The API returns the schedule and bounds the lookahead
+	api := &API{chain: chain, equality: e}
+	at := rpc.BlockNumber(9)
+	result, err := api.GetSealerSchedule(&at, 5)
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(9), uint64(result.BlockNumber))
+	assert.Len(t, result.Slots, 5)
+	assert.Equal(t, validatorB, *result.Slots[0].Validator)
+	assert.Equal(t, uint64(1623283200+21), uint64(result.Slots[0].Time))
+	assert.Nil(t, result.Slots[4].Validator)
+	assert.False(t, result.Slots[4].Known)
+
+	_, err = api.GetSealerSchedule(&at, 0)
+	assert.True(t, errors.Is(err, errInvalidBlockRange))
+	_, err = api.GetSealerSchedule(&at, maxSealerScheduleBlocks+1)
+	assert.True(t, errors.Is(err, errBlockRangeTooLarge))
+}
@@ -0,0 +1,225 @@
+package equality
+
+import (
+	"bytes"
+	"fmt"
+	"math/big"
+	"sort"
+
+	"github.com/SecretBlockChain/go-secret/common"
+	"github.com/SecretBlockChain/go-secret/consensus"
+	"github.com/SecretBlockChain/go-secret/core/types"
+	"github.com/SecretBlockChain/go-secret/params"
+	"github.com/SecretBlockChain/go-secret/rlp"
+)
+
+// SealerKey is the address a candidate set in a block to seal its blocks with
+// instead of its own key, from the epoch after the block on. The last one of a
+// candidate within a block is kept. A sealer equal to the candidate restores
+// its own key. The deposit, the mint counts and the rewards stay with the
+// candidate, the coinbase of the blocks sealed by the key.
+type SealerKey struct {
+	Candidate common.Address `json:"candidate"`
+	Sealer    common.Address `json:"sealer"`
+}
+
+// String implements the fmt.Stringer interface.
+func (key SealerKey) String() string {
+	return fmt.Sprintf("%s->%s", key.Candidate.String(), key.Sealer.String())
+}
+
+// sealerAt returns the key sealing the blocks of epoch for the candidate of
+// address: the sealer set from its epoch on, the one it replaced before, the
+// candidate itself if none.
+func (candidate *Candidate) sealerAt(address common.Address, epoch uint64) common.Address {
+	sealer := candidate.Sealer
+	if epoch < candidate.SealerEpoch {
+		sealer = candidate.PreviousSealer
+	}
+	if sealer == nil {
+		return address
+	}
+	return *sealer
+}
+
+// SetSealer replaces the sealer of a candidate from epoch on, the one in effect
+// before is kept for the blocks up to the epoch. Return a bool value means
+// address is a candidate.
+func (snap *Snapshot) SetSealer(candidateAddr common.Address, sealer common.Address, epoch uint64) (bool, error) {
+	candidate, err := snap.GetCandidate(candidateAddr)
+	if err != nil || candidate == nil {
+		return false, err
+	}
+
+	candidateTrie, err := snap.ensureTrie(candidatePrefix)
+	if err != nil {
+		return false, err
+	}
+	candidate.PreviousSealer = nil
+	if previous := candidate.sealerAt(candidateAddr, epoch-1); previous != candidateAddr {
+		candidate.PreviousSealer = &previous
+	}
+	candidate.Sealer = nil
+	if sealer != candidateAddr {
+		candidate.Sealer = &sealer
+	}
+	candidate.SealerEpoch = epoch
+	value, err := rlp.EncodeToBytes(candidate)
+	if err != nil {
+		return false, err
+	}
+	return true, candidateTrie.TryUpdate(candidateAddr.Bytes(), value)
+}
+
+// SealerOf returns the key sealing the blocks of epoch for validator, the
+// validator itself if not a candidate or without a sealer set.
+func (snap *Snapshot) SealerOf(validator common.Address, epoch uint64) (common.Address, error) {
+	candidate, err := snap.GetCandidate(validator)
+	if err != nil || candidate == nil {
+		return validator, err
+	}
+	return candidate.sealerAt(validator, epoch), nil
+}
+
+// epochOf returns the epoch of the block of header, the block after parent,
+// and the snapshot after parent its sealer keys are looked up in.
+func (e *Equality) epochOf(config params.EqualityConfig, header, parent *types.Header) (uint64, *Snapshot, error) {
+	if parent.Number.Uint64() == 0 {
+		root, err := genesisRoot(parent)
+		if err != nil {
+			return 0, nil, err
+		}
+		return 1, e.snapshots.open(root), nil
+	}
+	parentExtra, err := e.DecodeHeaderExtraCached(parent)
+	if err != nil {
+		return 0, nil, err
+	}
+	snap := e.snapshots.open(parentExtra.Root)
+	if header != nil {
+		headerExtra, err := e.DecodeHeaderExtraCached(header)
+		if err != nil {
+			return 0, nil, err
+		}
+		return headerExtra.Epoch, snap, nil
+	}
+	length, err := snap.GetEpochLength(config)
+	if err != nil {
+		return 0, nil, err
+	}
+	epoch, _ := nextEpoch(parentExtra, parent.Number.Uint64()+1, length)
+	return epoch, snap, nil
+}
+
+// blockValidator returns the validator sealing header with the key of signer.
+// From the sealer key block on it is the coinbase, whose key sealing the epoch
+// of the block must be signer, the signer itself before.
+func (e *Equality) blockValidator(config params.EqualityConfig, header, parent *types.Header, signer common.Address) (common.Address, error) {
+	if !config.IsSealerKey(header.Number) {
+		return signer, nil
+	}
+	if parent == nil {
+		return common.Address{}, consensus.ErrUnknownAncestor
+	}
+	epoch, snap, err := e.epochOf(config, header, parent)
+	if err != nil {
+		return common.Address{}, err
+	}
+	sealer, err := snap.SealerOf(header.Coinbase, epoch)
+	if err != nil {
+		return common.Address{}, err
+	}
+	if sealer != signer {
+		return common.Address{}, fmt.Errorf("%w: %s not the sealer of %s in epoch %d", errUnauthorizedValidator,
+			signer.Hex(), header.Coinbase.Hex(), epoch)
+	}
+	return header.Coinbase, nil
+}
+
+// localValidator returns the validator the local signer seals the block after
+// parent for: from the sealer key block on, the first validator whose key
+// sealing the epoch of the block is the signer, the signer itself otherwise.
+func (e *Equality) localValidator(config params.EqualityConfig, parent *types.Header, signer common.Address) common.Address {
+	if parent == nil || !config.IsSealerKey(new(big.Int).Add(parent.Number, common.Big1)) {
+		return signer
+	}
+	validators, err := e.sealingValidators(config, parent)
+	if err != nil {
+		return signer
+	}
+	epoch, snap, err := e.epochOf(config, nil, parent)
+	if err != nil {
+		return signer
+	}
+	for _, validator := range validators {
+		if sealer, err := snap.SealerOf(validator, epoch); err == nil && sealer == signer {
+			return validator
+		}
+	}
+	return signer
+}
+
+// headerValidator returns the validator having sealed header, a block of the
+// chain: its coinbase from the sealer key block on, its signer before.
+func (e *Equality) headerValidator(config params.EqualityConfig, header *types.Header) (common.Address, error) {
+	if config.IsSealerKey(header.Number) {
+		return header.Coinbase, nil
+	}
+	return ecrecover(header, e.signatures)
+}
+
+// Return a copy of a SealerKey slice sorted by candidate address bytes, the
+// slice itself if already sorted.
+func sealerKeysSort(slice []SealerKey) []SealerKey {
+	if sealerKeysSorted(slice) {
+		return slice
+	}
+
+	result := make([]SealerKey, len(slice))
+	copy(result, slice)
+	sort.Slice(result, func(i, j int) bool {
+		return bytes.Compare(result[i].Candidate[:], result[j].Candidate[:]) < 0
+	})
+	return result
+}
+
+// sealerKeysSorted returns whether a SealerKey slice is sorted by candidate
+// address bytes.
+func sealerKeysSorted(slice []SealerKey) bool {
+	for idx := 1; idx < len(slice); idx++ {
+		if bytes.Compare(slice[idx-1].Candidate[:], slice[idx].Candidate[:]) > 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// Returns the candidates of a SealerKey slice.
+func sealerKeysCandidates(slice []SealerKey) []common.Address {
+	candidates := make([]common.Address, 0, len(slice))
+	for _, key := range slice {
+		candidates = append(candidates, key.Candidate)
+	}
+	return candidates
+}
+
+// Return a copy of a SealerKey slice with the sealer of the candidate
+// replaced.
+func sealerKeysSet(slice []SealerKey, key SealerKey) []SealerKey {
+	return append(sealerKeysRemove(slice, key.Candidate), key)
+}
+
+// Return a copy of a SealerKey slice without the sealer of the candidate.
+func sealerKeysRemove(slice []SealerKey, candidate common.Address) []SealerKey {
+	result := make([]SealerKey, 0, len(slice))
+	for _, key := range slice {
+		if key.Candidate != candidate {
+			result = append(result, key)
+		}
+	}
+	if len(result) == 0 {
+		// Kept nil for the optional rlp field to stay unencoded
+		return nil
+	}
+	return result
+}
@@ -0,0 +1,161 @@
+package equality
+
+import (
+	"crypto/ecdsa"
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/SecretBlockChain/go-secret/common"
+	"github.com/SecretBlockChain/go-secret/core/rawdb"
+	"github.com/SecretBlockChain/go-secret/core/state"
+	"github.com/SecretBlockChain/go-secret/core/types"
+	"github.com/SecretBlockChain/go-secret/crypto"
+	"github.com/SecretBlockChain/go-secret/params"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSealerKeyBoundary(t *testing.T) {
+	keys := make([]*ecdsa.PrivateKey, 4)
+	addresses := make([]common.Address, len(keys))
+	for idx := range keys {
+		keys[idx], _ = crypto.GenerateKey()
+		addresses[idx] = crypto.PubkeyToAddress(keys[idx].PublicKey)
+	}
+	validators, rotated := addresses[:3], keys[3]
+
+	// Validator 0 rotates its key to key 3 during epoch 1, sealing from epoch 2
+	db := rawdb.NewMemoryDatabase()
+	config := newTestTurnConfig(1)
+	config.SealerKeyBlock = big.NewInt(1)
+	snap, err := newSnapshot(db)
+	assert.Nil(t, err)
+	for _, validator := range validators {
+		_, err = snap.BecomeCandidate(validator, 1, big.NewInt(0))
+		assert.Nil(t, err)
+	}
+	assert.Nil(t, snap.SetValidators(validators))
+	set, err := snap.SetSealer(validators[0], addresses[3], 2)
+	assert.Nil(t, err)
+	assert.True(t, set)
+	root, err := snap.Root()
+	assert.Nil(t, err)
+	assert.Nil(t, snap.Commit(root))
+	e := New(&config, db)
+
+	previous := HeaderExtra{Root: root, Epoch: 1, EpochBlock: 1}
+	next := HeaderExtra{Root: root, Epoch: 2, EpochBlock: 13, CurrentEpochValidators: validators}
+
+	// seal signs the header after parent coinbased to validator by key
+	seal := func(parent *types.Header, headerExtra HeaderExtra, validator common.Address, key *ecdsa.PrivateKey) *types.Header {
+		header := newTestTurnHeader(parent, headerExtra, key, 0)
+		header.Coinbase = validator
+		header.Difficulty = turnDifficulty(validators, header.Number.Uint64(), validator)
+		signature, err := crypto.Sign(SealHash(header).Bytes(), key)
+		assert.Nil(t, err)
+		copy(header.Extra[len(header.Extra)-ExtraSeal:], signature)
+		return header
+	}
+	b11 := newTestHeader(11, previous)
+	b11.Time = config.GenesisTimestamp + 11
+	b12 := seal(b11, previous, validators[2], keys[2])
+	chain := &testHeaderChain{config: params.TestnetChainConfig, headers: make([]*types.Header, 13)}
+	chain.headers[11], chain.headers[12] = b11, b12
+
+	// The old key seals the last block of epoch 1, the new key doesn't yet
+	assert.Nil(t, e.verifySeal(chain, config, seal(b11, previous, validators[0], keys[0]), b11, nil))
+	err = e.verifySeal(chain, config, seal(b11, previous, validators[0], rotated), b11, nil)
+	assert.True(t, errors.Is(err, errUnauthorizedValidator))
+
+	// The boundary block of epoch 2 is sealed by the new key only
+	assert.Nil(t, e.verifySeal(chain, config, seal(b12, next, validators[0], rotated), b12, nil))
+	err = e.verifySeal(chain, config, seal(b12, next, validators[0], keys[0]), b12, nil)
+	assert.True(t, errors.Is(err, errUnauthorizedValidator))
+	assert.Contains(t, err.Error(), addresses[0].Hex())
+
+	// The new key seals for the validator, not as one itself
+	err = e.verifySeal(chain, config, seal(b12, next, addresses[3], rotated), b12, nil)
+	assert.True(t, errors.Is(err, errUnauthorizedValidator))
+	assert.Equal(t, validators[0], e.localValidator(config, b12, addresses[3]))
+	assert.Equal(t, addresses[3], e.localValidator(config, b11, addresses[3]))
+
+	// The blocks are credited to the validator, not to the key
+	header := seal(b12, next, validators[0], rotated)
+	validator, err := e.headerValidator(config, header)
+	assert.Nil(t, err)
+	assert.Equal(t, validators[0], validator)
+
+	// Before the sealer key block the validators seal with their own keys
+	config.SealerKeyBlock = big.NewInt(14)
+	assert.Nil(t, e.verifySeal(chain, config, seal(b12, next, validators[0], keys[0]), b12, nil))
+	err = e.verifySeal(chain, config, seal(b12, next, validators[0], rotated), b12, nil)
+	assert.True(t, errors.Is(err, errUnauthorizedValidator))
+	assert.Equal(t, addresses[3], e.localValidator(config, b12, addresses[3]))
+}
+
+func TestSealerKeyTransaction(t *testing.T) {
+	key, _ := crypto.GenerateKey()
+	candidate := crypto.PubkeyToAddress(key.PublicKey)
+	sealer := common.HexToAddress("0x44d1ce0b7cb3588bca96151fe1bc05af38f91b6c")
+	_, err := NewTransaction(newVoteTestTransaction(t, key, "equality:1:event:sealer:"+common.Address{}.Hex()))
+	assert.NotNil(t, err)
+
+	process := func(config params.EqualityConfig, register bool, data string) (*Snapshot, HeaderExtra) {
+		db := rawdb.NewMemoryDatabase()
+		statedb, err := state.New(common.Hash{}, state.NewDatabase(db), nil)
+		assert.Nil(t, err)
+		snap, err := newSnapshot(db)
+		assert.Nil(t, err)
+		if register {
+			_, err = snap.BecomeCandidate(candidate, 1, big.NewInt(0))
+			assert.Nil(t, err)
+		}
+		headerExtra := HeaderExtra{Epoch: 1, EpochBlock: 1}
+		txs := []*types.Transaction{newVoteTestTransaction(t, key, data)}
+		New(&config, db).processTransactions(config, statedb, &types.Header{Number: big.NewInt(5)}, snap, &headerExtra, txs)
+		return snap, headerExtra
+	}
+
+	// Only candidates set a sealer, once the fork is active
+	config := params.EqualityConfig{Epoch: 30, MaxValidatorsCount: 3, MinCandidateBalance: big.NewInt(0)}
+	_, headerExtra := process(config, true, "equality:1:event:sealer:"+sealer.Hex())
+	assert.Empty(t, headerExtra.CurrentBlockSealerKeys)
+	config.SealerKeyBlock = big.NewInt(5)
+	_, headerExtra = process(config, false, "equality:1:event:sealer:"+sealer.Hex())
+	assert.Empty(t, headerExtra.CurrentBlockSealerKeys)
+	snap, headerExtra := process(config, true, "equality:1:event:sealer:"+sealer.Hex())
+	assert.Equal(t, []SealerKey{{Candidate: candidate, Sealer: sealer}}, headerExtra.CurrentBlockSealerKeys)
+	assert.Nil(t, headerExtra.Validate(5, config))
+	assert.True(t, errors.Is(headerExtra.Validate(4, config), errInvalidSealerKey))
+
+	// The sealer takes effect at the next epoch, the deposit stays with the candidate
+	current, err := snap.SealerOf(candidate, 1)
+	assert.Nil(t, err)
+	assert.Equal(t, candidate, current)
+	following, err := snap.SealerOf(candidate, 2)
+	assert.Nil(t, err)
+	assert.Equal(t, sealer, following)
+	record, err := snap.GetCandidate(candidate)
+	assert.Nil(t, err)
+	assert.NotNil(t, record)
+
+	// The sealer is part of the snapshot replayed from the header extra
+	replayed, err := newSnapshot(rawdb.NewMemoryDatabase())
+	assert.Nil(t, err)
+	_, err = replayed.BecomeCandidate(candidate, 1, big.NewInt(0))
+	assert.Nil(t, err)
+	assert.Nil(t, replayed.applyOperations(config, &types.Header{Number: big.NewInt(5)}, headerExtra))
+	root, err := snap.Root()
+	assert.Nil(t, err)
+	replayedRoot, err := replayed.Root()
+	assert.Nil(t, err)
+	assert.Equal(t, root.CandidateHash, replayedRoot.CandidateHash)
+
+	// A header extra setting the sealer of no candidate or the zero address is invalid
+	empty, err := newSnapshot(rawdb.NewMemoryDatabase())
+	assert.Nil(t, err)
+	err = empty.applyOperations(config, &types.Header{Number: big.NewInt(5)}, headerExtra)
+	assert.True(t, errors.Is(err, errInvalidSealerKey))
+	zero := HeaderExtra{CurrentBlockSealerKeys: []SealerKey{{Candidate: candidate}}}
+	assert.True(t, errors.Is(zero.Validate(5, config), errInvalidSealerKey))
+}
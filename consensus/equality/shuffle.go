@@ -0,0 +1,23 @@
+package equality
+
+import (
+	"encoding/binary"
+
+	"github.com/SecretBlockChain/go-secret/common"
+	"github.com/SecretBlockChain/go-secret/crypto"
+)
+
+// epochSeed returns the seed of the sealing order of the epoch of header
+// extra. The epoch trie only changes at epoch blocks, so every block of an
+// epoch derives the same seed from its Root.EpochHash.
+func epochSeed(headerExtra HeaderExtra) common.Hash {
+	epoch := make([]byte, 8)
+	binary.BigEndian.PutUint64(epoch, headerExtra.Epoch)
+	return crypto.Keccak256Hash(headerExtra.Root.EpochHash.Bytes(), epoch)
+}
+
+// shuffleValidators returns a copy of the validators in the order of a
+// Fisher–Yates shuffle, drawing from a keccak hash chain started at seed.
+func shuffleValidators(validators []common.Address, seed common.Hash) []common.Address {
+	return ShuffleAddresses(validators, seed)
+}
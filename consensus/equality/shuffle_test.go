@@ -0,0 +1,58 @@
+package equality
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/SecretBlockChain/go-secret/common"
+	"github.com/SecretBlockChain/go-secret/core/rawdb"
+	"github.com/SecretBlockChain/go-secret/params"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestShuffleValidators(t *testing.T) {
+	validators := newTestHeaderExtra(21).CurrentEpochValidators
+	headerExtra := HeaderExtra{Root: Root{EpochHash: common.HexToHash("0x1234")}, Epoch: 7}
+
+	// Two nodes derive the same schedule from the same epoch
+	other := HeaderExtra{Root: Root{EpochHash: common.HexToHash("0x1234")}, Epoch: 7, EpochBlock: 100}
+	shuffled := shuffleValidators(validators, epochSeed(headerExtra))
+	assert.Equal(t, shuffled, shuffleValidators(append([]common.Address{}, validators...), epochSeed(other)))
+	assert.ElementsMatch(t, validators, shuffled)
+	assert.NotEqual(t, validators, shuffled)
+
+	// Each epoch is shuffled differently
+	headerExtra.Epoch++
+	assert.NotEqual(t, shuffled, shuffleValidators(validators, epochSeed(headerExtra)))
+
+	assert.Empty(t, shuffleValidators(nil, epochSeed(headerExtra)))
+}
+
+func TestInTurnShuffle(t *testing.T) {
+	config := params.EqualityConfig{Period: 5, Epoch: 100, MaxValidatorsCount: 21, GenesisTimestamp: 1000}
+	e := New(&config, rawdb.NewMemoryDatabase())
+
+	headerExtra := newTestHeaderExtra(21)
+	snap := e.snapshots.open(Root{})
+	assert.Nil(t, snap.SetValidators(headerExtra.CurrentEpochValidators))
+	root, err := snap.Root()
+	assert.Nil(t, err)
+	headerExtra.Root = root
+	parent := newTestHeader(200, headerExtra)
+
+	slot := func(idx int) uint64 { return config.GenesisTimestamp + uint64(idx)*config.Period }
+	shuffled := shuffleValidators(headerExtra.CurrentEpochValidators, epochSeed(headerExtra))
+	for _, test := range []struct {
+		shuffleBlock *big.Int
+		schedule     []common.Address
+	}{
+		{nil, headerExtra.CurrentEpochValidators},
+		{big.NewInt(202), headerExtra.CurrentEpochValidators},
+		{big.NewInt(201), shuffled},
+	} {
+		config.ShuffleBlock = test.shuffleBlock
+		for idx, validator := range test.schedule {
+			assert.True(t, e.inTurn(config, parent, slot(idx), validator), "shuffle block %v slot %d", test.shuffleBlock, idx)
+		}
+	}
+}
@@ -6,11 +6,11 @@ import (
 	"errors"
 	"fmt"
 	"math/big"
-	"math/rand"
 	"sort"
 	"strings"
 
 	"github.com/SecretBlockChain/go-secret/common"
+	"github.com/SecretBlockChain/go-secret/common/hexutil"
 	"github.com/SecretBlockChain/go-secret/core/types"
 	"github.com/SecretBlockChain/go-secret/ethdb"
 	"github.com/SecretBlockChain/go-secret/params"
@@ -25,10 +25,34 @@ var (
 	configPrefix    = []byte("config")     // key: config:{params.EqualityConfig}
 )
 
-// Candidate basic information
+// kickOutSuffix marks the kick out record of a candidate in the candidate trie,
+// key: candidate-{candidateAddr}kickOut:{kickOutBlock}
+var kickOutSuffix = []byte("kickOut")
+
+// candidateKey returns the candidate address of a candidate trie key, false
+// if the key holds another record than the candidate information.
+func candidateKey(key []byte) (common.Address, bool) {
+	if len(key) != len(candidatePrefix)+common.AddressLength {
+		return common.Address{}, false
+	}
+	return common.BytesToAddress(key), true
+}
+
+// Candidate basic information, Staked is the deposit locked at registration
+// and returned as is on cancel, whatever MinCandidateBalance is by then. An
+// exiting candidate canceled and is removed at the next epoch transition.
+// Metadata is the identity the candidate published, it plays no part in the
+// elections.
 type Candidate struct {
-	Staked      *big.Int `json:"staked"`
-	BlockNumber uint64   `json:"blockNumber"`
+	Staked      *big.Int      `json:"staked"`
+	BlockNumber uint64        `json:"blockNumber"`
+	Exiting     bool          `json:"exiting,omitempty" rlp:"optional"`
+	Metadata    hexutil.Bytes `json:"metadata,omitempty" rlp:"optional"`
+
+	RewardRecipient *common.Address `json:"rewardRecipient,omitempty" rlp:"nil,optional"` // Receiver of the sealer rewards, the candidate if nil
+	Sealer          *common.Address `json:"sealer,omitempty" rlp:"nil,optional"`          // Key sealing the blocks of the candidate from SealerEpoch on, the candidate if nil
+	SealerEpoch     uint64          `json:"sealerEpoch,omitempty" rlp:"optional"`         // Epoch the sealer takes effect at
+	PreviousSealer  *common.Address `json:"previousSealer,omitempty" rlp:"nil,optional"`  // Key sealing the blocks before SealerEpoch, the candidate if nil
 }
 
 // SortableAddress sorted by votes.
@@ -66,7 +90,9 @@ type Snapshot struct {
 	candidateTrie *Trie
 	mintCntTrie   *Trie
 	configTrie    *Trie
+	delegateTrie  *Trie
 	db            *trie.Database
+	journal       *systemJournal // Records the system operations applied along, nil unless tracing
 }
 
 // newSnapshot creates a new empty snapshot
@@ -116,6 +142,12 @@ func (snap *Snapshot) ensureTrie(prefix []byte) (*Trie, error) {
 		}
 		snap.configTrie, err = NewTrieWithPrefix(snap.root.ConfigHash, prefix, snap.db)
 		return snap.configTrie, err
+	case string(delegatePrefix):
+		if snap.delegateTrie != nil {
+			return snap.delegateTrie, nil
+		}
+		snap.delegateTrie, err = NewTrieWithPrefix(snap.root.DelegateHash, prefix, snap.db)
+		return snap.delegateTrie, err
 	default:
 		return nil, errors.New("unknown prefix")
 	}
@@ -124,7 +156,46 @@ func (snap *Snapshot) ensureTrie(prefix []byte) (*Trie, error) {
 // apply creates a new authorization snapshot by applying the given headers to
 // the original one.
 func (snap *Snapshot) apply(config params.EqualityConfig, header *types.Header, headerExtra HeaderExtra) error {
+	// The checkpoint is attested by the validators before the election
+	if headerExtra.Checkpoint != nil {
+		if err := snap.verifyCheckpoint(header, *headerExtra.Checkpoint); err != nil {
+			return err
+		}
+	}
+	if err := snap.applyOperations(config, header, headerExtra); err != nil {
+		return err
+	}
+	if err := snap.applyElection(config, header, headerExtra); err != nil {
+		return err
+	}
+
 	number := header.Number.Uint64()
+	if err := snap.activateChainConfig(number); err != nil {
+		return err
+	}
+	if err := snap.settleEpochLength(config, number, headerExtra.EpochBlock); err != nil {
+		return err
+	}
+
+	if err := snap.MintBlock(headerExtra.Epoch, header.Number.Uint64(), header.Coinbase); err != nil {
+		return err
+	}
+	return nil
+}
+
+// applyOperations applies the candidate, vote and config operations carried by
+// the transactions of the block of header, the ones preceding its election.
+func (snap *Snapshot) applyOperations(config params.EqualityConfig, header *types.Header, headerExtra HeaderExtra) error {
+	number := header.Number.Uint64()
+	// Evictions make room for the registrations of the block
+	for _, candidate := range headerExtra.CurrentBlockEvictedCandidates {
+		if exist, _, err := snap.CancelCandidate(candidate); err != nil {
+			return err
+		} else if !exist {
+			return fmt.Errorf("%w: %s", errInvalidEviction, candidate.Hex())
+		}
+	}
+
 	for _, candidate := range headerExtra.CurrentBlockCandidates {
 		security := big.NewInt(0)
 		if number > 1 {
@@ -135,33 +206,169 @@ func (snap *Snapshot) apply(config params.EqualityConfig, header *types.Header,
 		}
 	}
 
-	for _, candidate := range headerExtra.CurrentBlockKickOutCandidates {
-		if _, _, err := snap.CancelCandidate(candidate); err != nil {
+	for _, metadata := range headerExtra.CurrentBlockMetadata {
+		set, err := snap.SetCandidateMetadata(metadata.Candidate, metadata.Metadata)
+		if err != nil {
 			return err
 		}
+		if !set {
+			return fmt.Errorf("%w: %s", errInvalidMetadata, metadata)
+		}
+	}
+
+	for _, recipient := range headerExtra.CurrentBlockRewardRecipients {
+		set, err := snap.SetRewardRecipient(recipient.Candidate, recipient.Recipient)
+		if err != nil {
+			return err
+		}
+		if !set {
+			return fmt.Errorf("%w: %s", errInvalidRewardRecipient, recipient)
+		}
+	}
+
+	for _, key := range headerExtra.CurrentBlockSealerKeys {
+		set, err := snap.SetSealer(key.Candidate, key.Sealer, headerExtra.Epoch+1)
+		if err != nil {
+			return err
+		}
+		if !set {
+			return fmt.Errorf("%w: %s", errInvalidSealerKey, key)
+		}
+	}
+
+	for _, topUp := range headerExtra.CurrentBlockTopUps {
+		topped, err := snap.TopUpCandidate(topUp.Candidate, topUp.Amount)
+		if err != nil {
+			return err
+		}
+		if !topped {
+			return fmt.Errorf("%w: %s", errInvalidTopUp, topUp)
+		}
 	}
 
 	for _, candidate := range headerExtra.CurrentBlockCancelCandidates {
+		if config.IsCandidateExit(header.Number) {
+			if _, err := snap.ExitCandidate(candidate); err != nil {
+				return err
+			}
+			continue
+		}
 		if _, _, err := snap.CancelCandidate(candidate); err != nil {
 			return err
 		}
 	}
 
-	if header.Number.Uint64() == headerExtra.EpochBlock {
-		if err := snap.SetValidators(headerExtra.CurrentEpochValidators); err != nil {
+	for _, vote := range headerExtra.CurrentBlockVotes {
+		if err := snap.Vote(vote); err != nil {
 			return err
 		}
 	}
 
-	if len(headerExtra.ChainConfig) > 0 {
-		last := len(headerExtra.ChainConfig) - 1
-		if err := snap.SetChainConfig(headerExtra.ChainConfig[last]); err != nil {
+	for _, delegator := range headerExtra.CurrentBlockCancelVotes {
+		if _, _, err := snap.CancelVote(delegator); err != nil {
 			return err
 		}
 	}
 
-	if err := snap.MintBlock(headerExtra.Epoch, header.Number.Uint64(), header.Coinbase); err != nil {
-		return err
+	// Config changes are approved by the validators of the last epoch
+	for _, proposal := range headerExtra.CurrentBlockProposals {
+		if err := snap.applyConfigProposal(config, number, proposal); err != nil {
+			return err
+		}
+	}
+
+	for _, approval := range headerExtra.CurrentBlockApprovals {
+		if err := snap.applyConfigApproval(config, number, approval); err != nil {
+			return err
+		}
+	}
+
+	if number <= 1 {
+		if len(headerExtra.ChainConfig) > 0 {
+			last := len(headerExtra.ChainConfig) - 1
+			if err := snap.ScheduleChainConfig(headerExtra.ChainConfig[last]); err != nil {
+				return err
+			}
+		}
+	} else if len(headerExtra.ChainConfig) > 1 {
+		return fmt.Errorf("%w: %d configs in block", errUnapprovedConfig, len(headerExtra.ChainConfig))
+	} else if len(headerExtra.ChainConfig) == 1 {
+		if err := snap.applyApprovedConfig(config, number, headerExtra.ChainConfig[0]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// applyElection applies the election of the block of header: the kicked out
+// candidates leave and, if the block starts an epoch, the exiting candidates
+// leave and the validators of the header extra are elected.
+func (snap *Snapshot) applyElection(config params.EqualityConfig, header *types.Header, headerExtra HeaderExtra) error {
+	number := header.Number.Uint64()
+
+	// Exiting candidates leave before the election
+	if config.IsCandidateExit(header.Number) && number == headerExtra.EpochBlock && number > 1 {
+		exiting, err := snap.ExitingCandidates()
+		if err != nil {
+			return err
+		}
+		for _, candidate := range exiting {
+			if _, _, err := snap.CancelCandidate(candidate); err != nil {
+				return err
+			}
+		}
+	}
+
+	for _, candidate := range headerExtra.CurrentBlockKickOutCandidates {
+		if _, _, err := snap.CancelCandidate(candidate); err != nil {
+			return err
+		}
+		if config.KickOutLockOut > 0 {
+			if err := snap.SetKickOutBlock(candidate, number); err != nil {
+				return err
+			}
+		}
+	}
+
+	// Kick outs leave at least the min validators count of candidates, fewer
+	// validators are only elected by carrying the previous ones over
+	minimum := config.MinValidatorsCount
+	if minimum > 0 && number > 1 && len(headerExtra.CurrentBlockKickOutCandidates) > 0 {
+		if count, ok := snap.EnoughCandidates(int(minimum)); !ok {
+			return fmt.Errorf("%w: %d candidates left by kick outs, want %d", errTooFewValidators, count, minimum)
+		}
+	}
+	if number == headerExtra.EpochBlock {
+		// The validator count formula bounds the validators by the candidates
+		// left by the kick outs and exits, the ones the election drew from
+		limit := int(config.MaxValidatorsCount)
+		if number > 1 && config.ValidatorCountFormula != "" {
+			count, err := snap.candidateCount()
+			if err != nil {
+				return err
+			}
+			limit = validatorCount(config, count)
+			if len(headerExtra.CurrentEpochValidators) > limit {
+				return fmt.Errorf("%w: %d > %d by the %s formula out of %d candidates", errTooManyValidators,
+					len(headerExtra.CurrentEpochValidators), limit, config.ValidatorCountFormula, count)
+			}
+		}
+		if minimum > 0 && number > 1 && uint64(len(headerExtra.CurrentEpochValidators)) < minimum {
+			carried, err := carriedValidators(snap, headerExtra.CurrentBlockKickOutCandidates, limit)
+			if err != nil {
+				return err
+			}
+			if !addressesEqual(addressesSort(carried), addressesSort(headerExtra.CurrentEpochValidators)) {
+				return fmt.Errorf("%w: %d validators elected, want %d", errTooFewValidators,
+					len(headerExtra.CurrentEpochValidators), minimum)
+			}
+		}
+		if config.IsMintCompaction(header.Number) {
+			if err := snap.CompactMintCounts(headerExtra.Epoch); err != nil {
+				return err
+			}
+		}
+		return snap.SetValidators(headerExtra.CurrentEpochValidators)
 	}
 	return nil
 }
@@ -196,6 +403,13 @@ func (snap *Snapshot) Root() (root Root, err error) {
 			return Root{}, err
 		}
 	}
+
+	if snap.delegateTrie != nil {
+		root.DelegateHash, err = snap.delegateTrie.Commit(nil)
+		if err != nil {
+			return Root{}, err
+		}
+	}
 	return root, err
 }
 
@@ -221,10 +435,76 @@ func (snap *Snapshot) Commit(root Root) error {
 			return err
 		}
 	}
+	if snap.root.DelegateHash != root.DelegateHash {
+		if err := snap.db.Commit(root.DelegateHash, false, nil); err != nil {
+			return err
+		}
+	}
 	snap.root = root
 	return nil
 }
 
+// normalizeChainConfig returns the config with its unset fields as nil. Rlp
+// decodes some of them as empty values, normalized the configs of blocks and
+// of their decoded header extras encode the same.
+func normalizeChainConfig(config params.EqualityConfig) params.EqualityConfig {
+	if len(config.Rewards) == 0 {
+		config.Rewards = nil
+	}
+	if len(config.Validators) == 0 {
+		config.Validators = nil
+	}
+	if len(config.CandidateAllowList) == 0 {
+		config.CandidateAllowList = nil
+	}
+	if len(config.CandidateDenyList) == 0 {
+		config.CandidateDenyList = nil
+	}
+	if config.ShuffleBlock != nil && config.ShuffleBlock.Sign() == 0 {
+		config.ShuffleBlock = nil
+	}
+	if config.CandidateLogBlock != nil && config.CandidateLogBlock.Sign() == 0 {
+		config.CandidateLogBlock = nil
+	}
+	if config.CandidateExitBlock != nil && config.CandidateExitBlock.Sign() == 0 {
+		config.CandidateExitBlock = nil
+	}
+	if config.TurnBlock != nil && config.TurnBlock.Sign() == 0 {
+		config.TurnBlock = nil
+	}
+	if config.RecentBlock != nil && config.RecentBlock.Sign() == 0 {
+		config.RecentBlock = nil
+	}
+	if config.TopUpBlock != nil && config.TopUpBlock.Sign() == 0 {
+		config.TopUpBlock = nil
+	}
+	if config.MetadataBlock != nil && config.MetadataBlock.Sign() == 0 {
+		config.MetadataBlock = nil
+	}
+	if config.CheckpointBlock != nil && config.CheckpointBlock.Sign() == 0 {
+		config.CheckpointBlock = nil
+	}
+	if config.CandidateGuardBlock != nil && config.CandidateGuardBlock.Sign() == 0 {
+		config.CandidateGuardBlock = nil
+	}
+	if config.RewardRecipientBlock != nil && config.RewardRecipientBlock.Sign() == 0 {
+		config.RewardRecipientBlock = nil
+	}
+	if config.ElectionCutoffBlock != nil && config.ElectionCutoffBlock.Sign() == 0 {
+		config.ElectionCutoffBlock = nil
+	}
+	if config.ElectionSeedBlock != nil && config.ElectionSeedBlock.Sign() == 0 {
+		config.ElectionSeedBlock = nil
+	}
+	if config.SealerKeyBlock != nil && config.SealerKeyBlock.Sign() == 0 {
+		config.SealerKeyBlock = nil
+	}
+	if config.MintCompactionBlock != nil && config.MintCompactionBlock.Sign() == 0 {
+		config.MintCompactionBlock = nil
+	}
+	return config
+}
+
 // GetChainConfig returns chain config from snapshot.
 func (snap *Snapshot) GetChainConfig() (params.EqualityConfig, error) {
 	configTrie, err := snap.ensureTrie(configPrefix)
@@ -233,7 +513,10 @@ func (snap *Snapshot) GetChainConfig() (params.EqualityConfig, error) {
 	}
 
 	key := []byte("config")
-	data := configTrie.Get(key)
+	data, err := configTrie.TryGet(key)
+	if err != nil {
+		return params.EqualityConfig{}, err
+	}
 	var config params.EqualityConfig
 	if err := json.Unmarshal(data, &config); err != nil {
 		return params.EqualityConfig{}, err
@@ -243,11 +526,51 @@ func (snap *Snapshot) GetChainConfig() (params.EqualityConfig, error) {
 
 // SetChainConfig write chain config to snapshot.
 func (snap *Snapshot) SetChainConfig(config params.EqualityConfig) error {
-	if len(config.Rewards) == 0 {
-		config.Rewards = nil
+	configTrie, err := snap.ensureTrie(configPrefix)
+	if err != nil {
+		return err
 	}
-	if len(config.Validators) == 0 {
-		config.Validators = nil
+
+	key := []byte("config")
+	data, err := json.Marshal(normalizeChainConfig(config))
+	if err != nil {
+		return err
+	}
+	return configTrie.TryUpdate(key, data)
+}
+
+// GetPendingChainConfig returns the chain config scheduled to take effect at
+// its activation block, nil if none is scheduled.
+func (snap *Snapshot) GetPendingChainConfig() (*params.EqualityConfig, error) {
+	// Leave the config trie untouched before any config was recorded, it
+	// would turn its zero root into the empty one
+	if snap.configTrie == nil && snap.root.ConfigHash == (common.Hash{}) {
+		return nil, nil
+	}
+
+	configTrie, err := snap.ensureTrie(configPrefix)
+	if err != nil {
+		return nil, err
+	}
+
+	key := []byte("pending")
+	data, err := configTrie.TryGet(key)
+	if err != nil || data == nil {
+		return nil, err
+	}
+	var config params.EqualityConfig
+	if err := json.Unmarshal(data, &config); err != nil {
+		return nil, err
+	}
+	return &config, nil
+}
+
+// ScheduleChainConfig records a chain config to take effect at its activation
+// block, replacing the config scheduled before. A config without activation
+// block takes effect for the next block.
+func (snap *Snapshot) ScheduleChainConfig(config params.EqualityConfig) error {
+	if config.ActivationBlock == 0 {
+		return snap.SetChainConfig(config)
 	}
 
 	configTrie, err := snap.ensureTrie(configPrefix)
@@ -255,8 +578,91 @@ func (snap *Snapshot) SetChainConfig(config params.EqualityConfig) error {
 		return err
 	}
 
-	key := []byte("config")
-	data, err := json.Marshal(config)
+	key := []byte("pending")
+	data, err := json.Marshal(normalizeChainConfig(config))
+	if err != nil {
+		return err
+	}
+	return configTrie.TryUpdate(key, data)
+}
+
+// activateChainConfig takes the scheduled chain config into effect once the
+// block following number reaches its activation block.
+func (snap *Snapshot) activateChainConfig(number uint64) error {
+	config, err := snap.GetPendingChainConfig()
+	if err != nil || config == nil || config.ActivationBlock > number+1 {
+		return err
+	}
+	if err = snap.SetChainConfig(*config); err != nil {
+		return err
+	}
+
+	configTrie, err := snap.ensureTrie(configPrefix)
+	if err != nil {
+		return err
+	}
+	return configTrie.TryDelete([]byte("pending"))
+}
+
+// GetEpochLength returns the number of blocks of the epoch running after the
+// snapshot, config being the chain config in effect for the next block. The
+// Epoch of a config changed within an epoch applies from its end on.
+func (snap *Snapshot) GetEpochLength(config params.EqualityConfig) (uint64, error) {
+	if snap.configTrie == nil && snap.root.ConfigHash == (common.Hash{}) {
+		return config.Epoch, nil
+	}
+
+	configTrie, err := snap.ensureTrie(configPrefix)
+	if err != nil {
+		return 0, err
+	}
+	data, err := configTrie.TryGet([]byte("epoch"))
+	if err != nil {
+		return 0, err
+	}
+	if data == nil {
+		return config.Epoch, nil
+	}
+	var length uint64
+	if err = rlp.DecodeBytes(data, &length); err != nil {
+		return 0, err
+	}
+	return length, nil
+}
+
+// settleEpochLength records the length of the running epoch after the block of
+// number, processed under config and belonging to the epoch starting at
+// epochBlock. The length is kept until the epoch ends if the block changed
+// the Epoch of the chain config, it is recorded only while both differ.
+func (snap *Snapshot) settleEpochLength(config params.EqualityConfig, number, epochBlock uint64) error {
+	if snap.configTrie == nil && snap.root.ConfigHash == (common.Hash{}) {
+		return nil
+	}
+
+	length := config.Epoch
+	if number != epochBlock {
+		var err error
+		if length, err = snap.GetEpochLength(config); err != nil {
+			return err
+		}
+	}
+	current, err := snap.GetChainConfig()
+	if err != nil {
+		return err
+	}
+
+	configTrie, err := snap.ensureTrie(configPrefix)
+	if err != nil {
+		return err
+	}
+	key := []byte("epoch")
+	if current.Epoch == length {
+		if data, err := configTrie.TryGet(key); err != nil || data == nil {
+			return err
+		}
+		return configTrie.TryDelete(key)
+	}
+	data, err := rlp.EncodeToBytes(length)
 	if err != nil {
 		return err
 	}
@@ -272,7 +678,10 @@ func (snap *Snapshot) GetValidators() ([]common.Address, error) {
 
 	key := []byte("validator")
 	var validators []common.Address
-	validatorsRLP := epochTrie.Get(key)
+	validatorsRLP, err := epochTrie.TryGet(key)
+	if err != nil {
+		return nil, err
+	}
 	if err := rlp.DecodeBytes(validatorsRLP, &validators); err != nil {
 		return nil, fmt.Errorf("failed to decode validators: %s", err)
 	}
@@ -301,6 +710,22 @@ func (snap *Snapshot) CountMinted(epoch uint64) (SortableAddresses, error) {
 		return nil, err
 	}
 
+	mapper, err := snap.MintCounts(epoch)
+	if err != nil {
+		return nil, err
+	}
+
+	addresses := make(SortableAddresses, 0)
+	for idx := range validators {
+		count := mapper[validators[idx]]
+		addresses = append(addresses, SortableAddress{Address: validators[idx], Weight: new(big.Int).SetUint64(count)})
+	}
+	sort.Sort(sort.Reverse(addresses))
+	return addresses, nil
+}
+
+// MintCounts returns the number of blocks minted by each validator in epoch.
+func (snap *Snapshot) MintCounts(epoch uint64) (map[common.Address]uint64, error) {
 	mintCntTrie, err := snap.ensureTrie(mintCntPrefix)
 	if err != nil {
 		return nil, err
@@ -310,24 +735,38 @@ func (snap *Snapshot) CountMinted(epoch uint64) (SortableAddresses, error) {
 	binary.BigEndian.PutUint64(prefix, epoch)
 	iter := trie.NewIterator(mintCntTrie.PrefixIterator(prefix))
 
-	mapper := make(map[common.Address]int64)
+	mapper := make(map[common.Address]uint64)
 	for iter.Next() {
-		validator := common.BytesToAddress(iter.Value)
-		count, _ := mapper[validator]
-		mapper[validator] = count + 1
+		mapper[common.BytesToAddress(iter.Value)]++
+	}
+	if iter.Err != nil {
+		return nil, iter.Err
 	}
+	return mapper, nil
+}
 
-	addresses := make(SortableAddresses, 0)
-	for idx := range validators {
-		count, ok := mapper[validators[idx]]
-		if !ok {
-			addresses = append(addresses, SortableAddress{Address: validators[idx], Weight: big.NewInt(0)})
-		} else {
-			addresses = append(addresses, SortableAddress{Address: validators[idx], Weight: big.NewInt(count)})
+// MintedBlocks returns the numbers of the blocks minted by validator in epoch
+// in ascending order.
+func (snap *Snapshot) MintedBlocks(epoch uint64, validator common.Address) ([]uint64, error) {
+	mintCntTrie, err := snap.ensureTrie(mintCntPrefix)
+	if err != nil {
+		return nil, err
+	}
+
+	prefix := make([]byte, 8)
+	binary.BigEndian.PutUint64(prefix, epoch)
+	iter := trie.NewIterator(mintCntTrie.PrefixIterator(prefix))
+
+	numbers := make([]uint64, 0)
+	for iter.Next() {
+		if common.BytesToAddress(iter.Value) == validator {
+			numbers = append(numbers, binary.BigEndian.Uint64(iter.Key[len(iter.Key)-8:]))
 		}
 	}
-	sort.Sort(sort.Reverse(addresses))
-	return addresses, nil
+	if iter.Err != nil {
+		return nil, iter.Err
+	}
+	return numbers, nil
 }
 
 // ForgeBlock write validator of block to snapshot.
@@ -343,6 +782,80 @@ func (snap *Snapshot) MintBlock(epoch, number uint64, validator common.Address)
 	return mintCntTrie.TryUpdate(key, validator.Bytes())
 }
 
+// epochMints returns the blocks minted in epoch in ascending order.
+func (snap *Snapshot) epochMints(epoch uint64) ([]mintedBlock, error) {
+	mintCntTrie, err := snap.ensureTrie(mintCntPrefix)
+	if err != nil {
+		return nil, err
+	}
+
+	prefix := make([]byte, 8)
+	binary.BigEndian.PutUint64(prefix, epoch)
+	iter := trie.NewIterator(mintCntTrie.PrefixIterator(prefix))
+
+	blocks := make([]mintedBlock, 0)
+	for iter.Next() {
+		blocks = append(blocks, mintedBlock{
+			Number:    binary.BigEndian.Uint64(iter.Key[len(iter.Key)-8:]),
+			Validator: common.BytesToAddress(iter.Value),
+		})
+	}
+	if iter.Err != nil {
+		return nil, iter.Err
+	}
+	return blocks, nil
+}
+
+// pastMints returns the blocks minted in the epochs before epoch by epoch, the
+// ones a compaction at epoch drops.
+func (snap *Snapshot) pastMints(epoch uint64) (map[uint64][]mintedBlock, error) {
+	mintCntTrie, err := snap.ensureTrie(mintCntPrefix)
+	if err != nil {
+		return nil, err
+	}
+
+	mints := make(map[uint64][]mintedBlock)
+	iter := trie.NewIterator(mintCntTrie.NodeIterator(nil))
+	for iter.Next() {
+		if len(iter.Key) != len(mintCntPrefix)+16 {
+			continue
+		}
+		past := binary.BigEndian.Uint64(iter.Key[len(iter.Key)-16 : len(iter.Key)-8])
+		if past >= epoch {
+			break
+		}
+		mints[past] = append(mints[past], mintedBlock{
+			Number:    binary.BigEndian.Uint64(iter.Key[len(iter.Key)-8:]),
+			Validator: common.BytesToAddress(iter.Value),
+		})
+	}
+	if iter.Err != nil {
+		return nil, iter.Err
+	}
+	return mints, nil
+}
+
+// CompactMintCounts rewrites the mint count trie with the blocks of epoch only,
+// dropping the ones of the past epochs. The validators of epoch start from no
+// minted block but the ones already recorded.
+func (snap *Snapshot) CompactMintCounts(epoch uint64) error {
+	blocks, err := snap.epochMints(epoch)
+	if err != nil {
+		return err
+	}
+	mintCntTrie, err := NewTrieWithPrefix(common.Hash{}, mintCntPrefix, snap.db)
+	if err != nil {
+		return err
+	}
+	snap.mintCntTrie = mintCntTrie
+	for _, block := range blocks {
+		if err = snap.MintBlock(epoch, block.Number, block.Validator); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 // GetCandidates returns all candidates.
 func (snap *Snapshot) GetCandidates() (map[common.Address]Candidate, error) {
 	candidateTrie, err := snap.ensureTrie(candidatePrefix)
@@ -353,15 +866,53 @@ func (snap *Snapshot) GetCandidates() (map[common.Address]Candidate, error) {
 	candidates := make(map[common.Address]Candidate, 0)
 	iterCandidate := trie.NewIterator(candidateTrie.NodeIterator(nil))
 	for iterCandidate.Next() {
+		address, ok := candidateKey(iterCandidate.Key)
+		if !ok {
+			continue
+		}
 		var candidate Candidate
 		if err = rlp.DecodeBytes(iterCandidate.Value, &candidate); err != nil {
 			return nil, err
 		}
-		candidates[common.BytesToAddress(iterCandidate.Key)] = candidate
+		candidates[address] = candidate
 	}
 	return candidates, nil
 }
 
+// GetCandidatesFrom returns at most limit candidates ordered by address,
+// starting at the start address. The address of the candidate following the
+// returned ones is returned as next, nil if there is none.
+func (snap *Snapshot) GetCandidatesFrom(start common.Address, limit int) ([]common.Address, []Candidate, *common.Address, error) {
+	candidateTrie, err := snap.ensureTrie(candidatePrefix)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	addresses := make([]common.Address, 0)
+	candidates := make([]Candidate, 0)
+	iterCandidate := trie.NewIterator(candidateTrie.NodeIterator(start.Bytes()))
+	for iterCandidate.Next() {
+		address, ok := candidateKey(iterCandidate.Key)
+		if !ok {
+			continue
+		}
+		if len(addresses) >= limit {
+			return addresses, candidates, &address, nil
+		}
+
+		var candidate Candidate
+		if err = rlp.DecodeBytes(iterCandidate.Value, &candidate); err != nil {
+			return nil, nil, nil, err
+		}
+		addresses = append(addresses, address)
+		candidates = append(candidates, candidate)
+	}
+	if iterCandidate.Err != nil {
+		return nil, nil, nil, iterCandidate.Err
+	}
+	return addresses, candidates, nil, nil
+}
+
 // GetCandidate returns specified candidate information.
 func (snap *Snapshot) GetCandidate(candidateAddr common.Address) (*Candidate, error) {
 	candidateTrie, err := snap.ensureTrie(candidatePrefix)
@@ -396,6 +947,9 @@ func (snap *Snapshot) EnoughCandidates(n int) (int, bool) {
 
 	iterCandidate := trie.NewIterator(candidateTrie.NodeIterator(nil))
 	for iterCandidate.Next() {
+		if _, ok := candidateKey(iterCandidate.Key); !ok {
+			continue
+		}
 		candidateCount++
 		if candidateCount >= n {
 			return candidateCount, true
@@ -404,6 +958,23 @@ func (snap *Snapshot) EnoughCandidates(n int) (int, bool) {
 	return candidateCount, false
 }
 
+// candidateCount returns the number of candidates.
+func (snap *Snapshot) candidateCount() (int, error) {
+	candidateTrie, err := snap.ensureTrie(candidatePrefix)
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+	iterCandidate := trie.NewIterator(candidateTrie.NodeIterator(nil))
+	for iterCandidate.Next() {
+		if _, ok := candidateKey(iterCandidate.Key); ok {
+			count++
+		}
+	}
+	return count, iterCandidate.Err
+}
+
 // RandCandidates random return n candidates.
 func (snap *Snapshot) RandCandidates(seed int64, n int) ([]common.Address, error) {
 	if n <= 0 {
@@ -424,20 +995,41 @@ func (snap *Snapshot) RandCandidates(seed int64, n int) ([]common.Address, error
 	// All candidate
 	candidates := make([]common.Address, 0)
 	for existCandidate {
-		candidates = append(candidates, common.BytesToAddress(iterCandidate.Key))
+		if address, ok := candidateKey(iterCandidate.Key); ok {
+			candidates = append(candidates, address)
+		}
 		existCandidate = iterCandidate.Next()
 	}
+	if len(candidates) == 0 {
+		return nil, nil
+	}
 
 	// Shuffle candidates
-	r := rand.New(rand.NewSource(seed))
-	for i := len(candidates) - 1; i > 0; i-- {
-		j := int(r.Int31n(int32(i + 1)))
-		candidates[i], candidates[j] = candidates[j], candidates[i]
+	return shuffleCandidates(candidates, seed, n), nil
+}
+
+// CandidateInfos returns the candidates ordered by address.
+func (snap *Snapshot) CandidateInfos() ([]CandidateInfo, error) {
+	candidateTrie, err := snap.ensureTrie(candidatePrefix)
+	if err != nil {
+		return nil, err
 	}
-	if len(candidates) > n {
-		candidates = candidates[:n]
+
+	candidates := make([]CandidateInfo, 0)
+	iterCandidate := trie.NewIterator(candidateTrie.NodeIterator(nil))
+	for iterCandidate.Next() {
+		address, ok := candidateKey(iterCandidate.Key)
+		if !ok {
+			continue
+		}
+		var candidate Candidate
+		if err = rlp.DecodeBytes(iterCandidate.Value, &candidate); err != nil {
+			return nil, err
+		}
+		candidates = append(candidates, CandidateInfo{Address: address, Staked: candidate.Staked,
+			BlockNumber: candidate.BlockNumber, Exiting: candidate.Exiting})
 	}
-	return candidates, nil
+	return candidates, iterCandidate.Err
 }
 
 // BecomeCandidate add a new candidate, return a bool value means address already is or not a candidate
@@ -469,7 +1061,96 @@ func (snap *Snapshot) BecomeCandidate(
 	if err != nil {
 		return false, err
 	}
-	return false, candidateTrie.TryUpdate(key, value)
+	if err = candidateTrie.TryUpdate(key, value); err != nil {
+		return false, err
+	}
+
+	// Registering again ends the lock out of a kicked out candidate
+	kickOutKey := append(key, kickOutSuffix...)
+	kickOutRLP, err := candidateTrie.TryGet(kickOutKey)
+	if err != nil || kickOutRLP == nil {
+		return false, err
+	}
+	return false, candidateTrie.TryDelete(kickOutKey)
+}
+
+// SetKickOutBlock records the block the candidate was kicked out at.
+func (snap *Snapshot) SetKickOutBlock(candidateAddr common.Address, number uint64) error {
+	candidateTrie, err := snap.ensureTrie(candidatePrefix)
+	if err != nil {
+		return err
+	}
+
+	value, err := rlp.EncodeToBytes(number)
+	if err != nil {
+		return err
+	}
+	return candidateTrie.TryUpdate(append(candidateAddr.Bytes(), kickOutSuffix...), value)
+}
+
+// GetKickOutBlock returns the block the candidate was last kicked out at,
+// false if it has not been kicked out since it last registered.
+func (snap *Snapshot) GetKickOutBlock(candidateAddr common.Address) (uint64, bool, error) {
+	candidateTrie, err := snap.ensureTrie(candidatePrefix)
+	if err != nil {
+		return 0, false, err
+	}
+
+	value, err := candidateTrie.TryGet(append(candidateAddr.Bytes(), kickOutSuffix...))
+	if err != nil || value == nil {
+		return 0, false, err
+	}
+
+	var number uint64
+	if err = rlp.DecodeBytes(value, &number); err != nil {
+		return 0, false, err
+	}
+	return number, true, nil
+}
+
+// ExitCandidate marks a candidate as exiting, return a bool value means
+// address is a candidate not exiting yet.
+func (snap *Snapshot) ExitCandidate(candidateAddr common.Address) (bool, error) {
+	candidate, err := snap.GetCandidate(candidateAddr)
+	if err != nil || candidate == nil || candidate.Exiting {
+		return false, err
+	}
+
+	candidateTrie, err := snap.ensureTrie(candidatePrefix)
+	if err != nil {
+		return false, err
+	}
+	candidate.Exiting = true
+	value, err := rlp.EncodeToBytes(candidate)
+	if err != nil {
+		return false, err
+	}
+	return true, candidateTrie.TryUpdate(candidateAddr.Bytes(), value)
+}
+
+// ExitingCandidates returns the exiting candidates ordered by address.
+func (snap *Snapshot) ExitingCandidates() ([]common.Address, error) {
+	candidateTrie, err := snap.ensureTrie(candidatePrefix)
+	if err != nil {
+		return nil, err
+	}
+
+	exiting := make([]common.Address, 0)
+	iterCandidate := trie.NewIterator(candidateTrie.NodeIterator(nil))
+	for iterCandidate.Next() {
+		address, ok := candidateKey(iterCandidate.Key)
+		if !ok {
+			continue
+		}
+		var candidate Candidate
+		if err = rlp.DecodeBytes(iterCandidate.Value, &candidate); err != nil {
+			return nil, err
+		}
+		if candidate.Exiting {
+			exiting = append(exiting, address)
+		}
+	}
+	return exiting, iterCandidate.Err
 }
 
 // CancelCandidate remove a candidate
@@ -0,0 +1,180 @@
+package equality
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/SecretBlockChain/go-secret/common"
+	"github.com/SecretBlockChain/go-secret/core/types"
+	"github.com/SecretBlockChain/go-secret/ethdb"
+	"github.com/SecretBlockChain/go-secret/rlp"
+	"github.com/SecretBlockChain/go-secret/trie"
+)
+
+// snapshotExportVersion is the version of the snapshot export format.
+//
+// An export is a stream of rlp items: a snapshotExportHeader, followed for
+// every trie by a snapshotExportSection and its entries in key order.
+const snapshotExportVersion = 1
+
+var (
+	// errUnknownSnapshotExportVersion is returned if a snapshot export carries
+	// a format version this node is unable to import.
+	errUnknownSnapshotExportVersion = errors.New("unknown snapshot export version")
+
+	// errSnapshotRootMismatch is returned if an imported trie does not hash to
+	// the root it was exported with.
+	errSnapshotRootMismatch = errors.New("snapshot trie root mismatch")
+)
+
+type snapshotExportHeader struct {
+	Version uint64
+	Root    Root
+}
+
+type snapshotExportSection struct {
+	Name  string
+	Root  common.Hash
+	Count uint64
+}
+
+type snapshotExportEntry struct {
+	Key   []byte
+	Value []byte
+}
+
+// snapshotTrie is a trie of the snapshot with its name and root.
+type snapshotTrie struct {
+	name   string
+	prefix []byte
+	root   *common.Hash
+}
+
+// tries returns the tries of the snapshot root in export order. The delegate
+// trie only exists with delegated voting, it is left out when empty so the
+// exports of other chains remain unchanged.
+func (root *Root) tries() []snapshotTrie {
+	tries := []snapshotTrie{
+		{"epoch", epochPrefix, &root.EpochHash},
+		{"candidate", candidatePrefix, &root.CandidateHash},
+		{"mintCnt", mintCntPrefix, &root.MintCntHash},
+		{"config", configPrefix, &root.ConfigHash},
+	}
+	if root.DelegateHash != (common.Hash{}) {
+		tries = append(tries, snapshotTrie{"delegate", delegatePrefix, &root.DelegateHash})
+	}
+	return tries
+}
+
+// ExportSnapshot writes the state tries of the snapshot at root to w.
+func ExportSnapshot(db ethdb.Database, root Root, w io.Writer) error {
+	return exportSnapshot(trie.NewDatabase(db), root, w)
+}
+
+// exportSnapshot writes the state tries of the snapshot at root, read from
+// triedb, to w.
+func exportSnapshot(triedb *trie.Database, root Root, w io.Writer) error {
+	buffer := bufio.NewWriter(w)
+	if err := rlp.Encode(buffer, snapshotExportHeader{Version: snapshotExportVersion, Root: root}); err != nil {
+		return err
+	}
+
+	for _, t := range root.tries() {
+		prefixTrie, err := NewTrieWithPrefix(*t.root, t.prefix, triedb)
+		if err != nil {
+			return fmt.Errorf("%s trie: %w", t.name, err)
+		}
+
+		// Count the entries first, the sections are streamed
+		var count uint64
+		iter := trie.NewIterator(prefixTrie.NodeIterator(nil))
+		for iter.Next() {
+			count++
+		}
+		if iter.Err != nil {
+			return fmt.Errorf("%s trie: %w", t.name, iter.Err)
+		}
+
+		section := snapshotExportSection{Name: t.name, Root: *t.root, Count: count}
+		if err = rlp.Encode(buffer, section); err != nil {
+			return err
+		}
+		iter = trie.NewIterator(prefixTrie.NodeIterator(nil))
+		for iter.Next() {
+			if err = rlp.Encode(buffer, snapshotExportEntry{Key: iter.Key, Value: iter.Value}); err != nil {
+				return err
+			}
+		}
+		if iter.Err != nil {
+			return fmt.Errorf("%s trie: %w", t.name, iter.Err)
+		}
+	}
+	return buffer.Flush()
+}
+
+// ImportSnapshot reads a snapshot exported by ExportSnapshot from r into db and
+// returns its root. Nothing is written unless every trie hashes to its exported
+// root, the caller is expected to compare the returned root with the Root of
+// the header the snapshot belongs to.
+func ImportSnapshot(db ethdb.Database, r io.Reader) (Root, error) {
+	stream := rlp.NewStream(r, 0)
+	var header snapshotExportHeader
+	if err := stream.Decode(&header); err != nil {
+		return Root{}, err
+	}
+	if header.Version != snapshotExportVersion {
+		return Root{}, fmt.Errorf("%w: %d", errUnknownSnapshotExportVersion, header.Version)
+	}
+
+	triedb := trie.NewDatabase(db)
+	root := header.Root
+	for _, t := range root.tries() {
+		var section snapshotExportSection
+		if err := stream.Decode(&section); err != nil {
+			return Root{}, fmt.Errorf("%s trie: %w", t.name, err)
+		}
+		if section.Name != t.name || section.Root != *t.root {
+			return Root{}, fmt.Errorf("%w: unexpected section %s %s, want %s %s",
+				errSnapshotRootMismatch, section.Name, section.Root.Hex(), t.name, t.root.Hex())
+		}
+
+		// Keys are exported with their prefix, insert them as is
+		importTrie, err := NewTrieWithPrefix(common.Hash{}, nil, triedb)
+		if err != nil {
+			return Root{}, err
+		}
+		for i := uint64(0); i < section.Count; i++ {
+			var entry snapshotExportEntry
+			if err = stream.Decode(&entry); err != nil {
+				return Root{}, fmt.Errorf("%s trie: %w", t.name, err)
+			}
+			if err = importTrie.TryUpdate(entry.Key, entry.Value); err != nil {
+				return Root{}, fmt.Errorf("%s trie: %w", t.name, err)
+			}
+		}
+
+		hash, err := importTrie.Commit(nil)
+		if err != nil {
+			return Root{}, err
+		}
+		if hash == types.EmptyRootHash && *t.root == (common.Hash{}) {
+			hash = common.Hash{}
+		}
+		if hash != *t.root {
+			return Root{}, fmt.Errorf("%w: %s trie have %s, want %s", errSnapshotRootMismatch, t.name, hash.Hex(), t.root.Hex())
+		}
+	}
+
+	// All tries verified, flush them to disk
+	for _, t := range root.tries() {
+		if *t.root == (common.Hash{}) {
+			continue
+		}
+		if err := triedb.Commit(*t.root, false, nil); err != nil {
+			return Root{}, err
+		}
+	}
+	return root, nil
+}
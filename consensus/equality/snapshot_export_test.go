@@ -0,0 +1,80 @@
+package equality
+
+import (
+	"bytes"
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/SecretBlockChain/go-secret/common"
+	"github.com/SecretBlockChain/go-secret/core/rawdb"
+	"github.com/SecretBlockChain/go-secret/ethdb/memorydb"
+	"github.com/SecretBlockChain/go-secret/params"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExportImportSnapshot(t *testing.T) {
+	db := rawdb.NewMemoryDatabase()
+	validator := common.HexToAddress("0x44d1ce0b7cb3588bca96151fe1bc05af38f91b6c")
+	candidate := common.HexToAddress("0xcc7c8317b21e1cea6139700c3c46c21af998d14c")
+
+	snap, err := newSnapshot(db)
+	assert.Nil(t, err)
+	assert.Nil(t, snap.SetChainConfig(*params.TestnetEqualityConfig()))
+	assert.Nil(t, snap.SetValidators([]common.Address{validator}))
+	_, err = snap.BecomeCandidate(validator, 1, big.NewInt(0))
+	assert.Nil(t, err)
+	_, err = snap.BecomeCandidate(candidate, 2, big.NewInt(1000))
+	assert.Nil(t, err)
+	assert.Nil(t, snap.MintBlock(1, 1, validator))
+	root, err := snap.Root()
+	assert.Nil(t, err)
+	assert.Nil(t, snap.Commit(root))
+
+	var buffer bytes.Buffer
+	assert.Nil(t, ExportSnapshot(db, root, &buffer))
+	exported := buffer.Bytes()
+
+	// Import into an empty database
+	imported := rawdb.NewMemoryDatabase()
+	result, err := ImportSnapshot(imported, bytes.NewReader(exported))
+	assert.Nil(t, err)
+	assert.Equal(t, root, result)
+
+	snap, err = loadSnapshot(imported, result)
+	assert.Nil(t, err)
+	validators, err := snap.GetValidators()
+	assert.Nil(t, err)
+	assert.Equal(t, []common.Address{validator}, validators)
+	stored, err := snap.GetCandidate(candidate)
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(2), stored.BlockNumber)
+	counts, err := snap.MintCounts(1)
+	assert.Nil(t, err)
+	assert.Equal(t, map[common.Address]uint64{validator: 1}, counts)
+	config, err := snap.GetChainConfig()
+	assert.Nil(t, err)
+	assert.True(t, config.Equal(*params.TestnetEqualityConfig()))
+
+	// A corrupted candidate entry is detected and nothing written
+	corrupted := append([]byte{}, exported...)
+	offset := bytes.LastIndex(corrupted, candidate.Bytes())
+	assert.True(t, offset > 0)
+	corrupted[offset] ^= 0xff
+	refused := memorydb.New()
+	_, err = ImportSnapshot(rawdb.NewDatabase(refused), bytes.NewReader(corrupted))
+	assert.True(t, errors.Is(err, errSnapshotRootMismatch))
+	assert.Contains(t, err.Error(), "candidate trie")
+	assert.Equal(t, 0, refused.Len())
+
+	// Mismatching sections are refused
+	corrupted = append([]byte{}, exported...)
+	offset = bytes.Index(corrupted, []byte("mintCnt"))
+	corrupted[offset] = 'M'
+	_, err = ImportSnapshot(rawdb.NewMemoryDatabase(), bytes.NewReader(corrupted))
+	assert.True(t, errors.Is(err, errSnapshotRootMismatch))
+
+	// Truncated exports are refused
+	_, err = ImportSnapshot(rawdb.NewMemoryDatabase(), bytes.NewReader(exported[:len(exported)-1]))
+	assert.NotNil(t, err)
+}
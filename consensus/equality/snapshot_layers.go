@@ -0,0 +1,233 @@
+package equality
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/SecretBlockChain/go-secret/common"
+	"github.com/SecretBlockChain/go-secret/consensus"
+	"github.com/SecretBlockChain/go-secret/core/types"
+	"github.com/SecretBlockChain/go-secret/ethdb"
+	"github.com/SecretBlockChain/go-secret/log"
+	"github.com/SecretBlockChain/go-secret/trie"
+)
+
+// snapshotFlushInterval is the default number of blocks after which the
+// in-memory snapshot layers are persisted to the database.
+const snapshotFlushInterval = 1024
+
+// snapshotLayers keeps the snapshot tries of recent blocks in memory on top of
+// the database. The layer of a block is keyed by the Root of its header, and
+// referenced until a checkpoint at a later block is persisted. Snapshots are
+// opened at the Root of the requested header, so the layers of a branch lost
+// in a reorg are not read again and are released at the next checkpoint.
+type snapshotLayers struct {
+	triedb   *trie.Database
+	interval uint64
+	layers   map[Root]uint64 // Block numbers of the layers not yet persisted
+	lock     sync.Mutex
+}
+
+// newSnapshotLayers creates snapshot layers persisting every interval blocks.
+func newSnapshotLayers(db ethdb.Database, interval uint64) *snapshotLayers {
+	return &snapshotLayers{
+		triedb:   trie.NewDatabase(db),
+		interval: interval,
+		layers:   make(map[Root]uint64),
+	}
+}
+
+// hashes returns the non empty trie roots of root.
+func (root Root) hashes() []common.Hash {
+	fields := root.fields()
+	hashes := make([]common.Hash, 0, len(fields))
+	for _, field := range fields {
+		if field.hash != (common.Hash{}) {
+			hashes = append(hashes, field.hash)
+		}
+	}
+	return hashes
+}
+
+// open returns the snapshot at root backed by the layers.
+func (layers *snapshotLayers) open(root Root) *Snapshot {
+	return &Snapshot{root: root, db: layers.triedb}
+}
+
+// available reports whether the tries of root are in memory or on disk.
+func (layers *snapshotLayers) available(root Root) bool {
+	for _, hash := range root.hashes() {
+		if _, err := layers.triedb.Node(hash); err != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// checkIntact walks the tries of root whole, failing at the first node neither
+// in memory nor on disk. Unlike available it finds the nodes lost below the
+// trie roots.
+func (layers *snapshotLayers) checkIntact(root Root) error {
+	for _, hash := range root.hashes() {
+		t, err := trie.New(hash, layers.triedb)
+		if err != nil {
+			return err
+		}
+		it := t.NodeIterator(nil)
+		for it.Next(true) {
+		}
+		if err = it.Error(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// setInterval changes the number of blocks between persisted checkpoints.
+func (layers *snapshotLayers) setInterval(interval uint64) {
+	layers.lock.Lock()
+	defer layers.lock.Unlock()
+	layers.interval = interval
+}
+
+// flushInterval returns the number of blocks between persisted checkpoints.
+func (layers *snapshotLayers) flushInterval() uint64 {
+	layers.lock.Lock()
+	defer layers.lock.Unlock()
+	return layers.interval
+}
+
+// add records the layer of block number, whose tries have been committed to
+// memory. On a checkpoint the layer is persisted, layers of blocks up to the
+// checkpoint are released.
+func (layers *snapshotLayers) add(number uint64, root Root) error {
+	layers.lock.Lock()
+	defer layers.lock.Unlock()
+
+	if _, ok := layers.layers[root]; !ok {
+		for _, hash := range root.hashes() {
+			layers.triedb.Reference(hash, common.Hash{})
+		}
+		layers.layers[root] = number
+	}
+	if layers.interval > 1 && number%layers.interval != 0 {
+		return nil
+	}
+
+	for _, hash := range root.hashes() {
+		if err := layers.triedb.Commit(hash, false, nil); err != nil {
+			return err
+		}
+	}
+	for layer, layerNumber := range layers.layers {
+		if layerNumber <= number {
+			for _, hash := range layer.hashes() {
+				layers.triedb.Dereference(hash)
+			}
+			delete(layers.layers, layer)
+		}
+	}
+	log.Debug("[equality] Persisted snapshot", "number", number, "layers", len(layers.layers))
+	return nil
+}
+
+// flush persists the layers not yet persisted and releases them.
+func (layers *snapshotLayers) flush() error {
+	layers.lock.Lock()
+	defer layers.lock.Unlock()
+
+	for layer := range layers.layers {
+		for _, hash := range layer.hashes() {
+			if err := layers.triedb.Commit(hash, false, nil); err != nil {
+				return err
+			}
+		}
+	}
+	for layer := range layers.layers {
+		for _, hash := range layer.hashes() {
+			layers.triedb.Dereference(hash)
+		}
+		delete(layers.layers, layer)
+	}
+	return nil
+}
+
+// SetSnapshotFlushInterval sets the number of blocks between snapshots being
+// persisted to the database, snapshots of the blocks in between are kept in
+// memory only and rebuilt from headers after a restart.
+func (e *Equality) SetSnapshotFlushInterval(interval uint64) {
+	e.snapshots.setInterval(interval)
+}
+
+// snapshot returns the snapshot after header. Missing tries, e.g. of layers
+// lost on restart, are rebuilt by replaying the headers following the nearest
+// ancestor with available tries. The parents, if given, are the ancestors of
+// header not yet known by chain, in ascending order.
+func (e *Equality) snapshot(chain consensus.ChainHeaderReader, header *types.Header, parents []*types.Header) (*Snapshot, error) {
+	var snap *Snapshot
+	var headers []*types.Header
+	for snap == nil {
+		if header.Number.Uint64() == 0 {
+			root, err := genesisRoot(header)
+			if err != nil {
+				return nil, err
+			}
+			snap = e.snapshots.open(root)
+			break
+		}
+
+		headerExtra, err := e.DecodeHeaderExtraCached(header)
+		if err != nil {
+			return nil, err
+		}
+		if e.snapshots.available(headerExtra.Root) {
+			snap = e.snapshots.open(headerExtra.Root)
+			break
+		}
+		headers = append(headers, header)
+
+		number, hash := header.Number.Uint64()-1, header.ParentHash
+		if len(parents) > 0 {
+			header = parents[len(parents)-1]
+			parents = parents[:len(parents)-1]
+		} else {
+			header = chain.GetHeader(hash, number)
+		}
+		if header == nil || header.Number.Uint64() != number || header.Hash() != hash {
+			return nil, consensus.ErrUnknownAncestor
+		}
+	}
+
+	if len(headers) > 0 {
+		log.Info("[equality] Rebuilding snapshot", "number", headers[0].Number, "from", headers[len(headers)-1].Number)
+	}
+	for i := len(headers) - 1; i >= 0; i-- {
+		header := headers[i]
+		headerExtra, err := e.DecodeHeaderExtraCached(header)
+		if err != nil {
+			return nil, err
+		}
+		config, err := e.chainConfigByHash(snap.root.ConfigHash)
+		if err != nil {
+			return nil, err
+		}
+
+		if err = snap.apply(config, header, headerExtra); err != nil {
+			return nil, err
+		}
+		root, err := snap.Root()
+		if err != nil {
+			return nil, err
+		}
+		if root != headerExtra.Root {
+			return nil, fmt.Errorf("%w: failed to rebuild block %d, %s", errMissingState,
+				header.Number.Uint64(), strings.Join(root.Difference(headerExtra.Root), ", "))
+		}
+		if err = e.snapshots.add(header.Number.Uint64(), root); err != nil {
+			return nil, err
+		}
+		snap = e.snapshots.open(root)
+	}
+	return snap, nil
+}
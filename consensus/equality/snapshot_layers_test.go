@@ -0,0 +1,86 @@
+package equality
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/SecretBlockChain/go-secret/common"
+	"github.com/SecretBlockChain/go-secret/core/rawdb"
+	"github.com/SecretBlockChain/go-secret/core/types"
+	"github.com/SecretBlockChain/go-secret/params"
+	"github.com/stretchr/testify/assert"
+)
+
+// extendTestChain appends count blocks to the headers, each registering a
+// candidate derived from seed, and returns the extended headers.
+func extendTestChain(t *testing.T, e *Equality, headers []*types.Header, count int, seed int64) []*types.Header {
+	headers = append([]*types.Header{}, headers...)
+	chain := &testHeaderChain{config: params.TestnetChainConfig}
+	for i := 0; i < count; i++ {
+		parent := headers[len(headers)-1]
+		chain.headers = headers
+		snap, err := e.snapshot(chain, parent, nil)
+		assert.Nil(t, err)
+
+		number := parent.Number.Uint64() + 1
+		candidate := common.BigToAddress(big.NewInt(seed + int64(number)))
+		header := &types.Header{Number: new(big.Int).SetUint64(number), ParentHash: parent.Hash(), Coinbase: candidate}
+		headerExtra := HeaderExtra{Epoch: 1, EpochBlock: 1, CurrentBlockCandidates: []common.Address{candidate}}
+		assert.Nil(t, snap.apply(*e.config, header, headerExtra))
+		headerExtra.Root, err = snap.Root()
+		assert.Nil(t, err)
+		assert.Nil(t, e.snapshots.add(number, headerExtra.Root))
+
+		header.Extra = newTestHeader(number, headerExtra).Extra
+		headers = append(headers, header)
+	}
+	return headers
+}
+
+func TestSnapshotLayersReorg(t *testing.T) {
+	db := rawdb.NewMemoryDatabase()
+	engine := New(params.TestnetEqualityConfig(), db)
+	engine.SetSnapshotFlushInterval(4)
+
+	genesis := []*types.Header{{Number: big.NewInt(0)}}
+	main := extendTestChain(t, engine, genesis, 19, 0)
+	fork := extendTestChain(t, engine, main[:9], 10, 1000)
+	assert.Equal(t, 19, len(fork))
+
+	candidateAt := func(e *Equality, headers []*types.Header, number uint64) *Candidate {
+		chain := &testHeaderChain{config: params.TestnetChainConfig, headers: headers}
+		snap, err := e.snapshot(chain, headers[len(headers)-1], nil)
+		assert.Nil(t, err)
+		candidate, err := snap.GetCandidate(headers[number].Coinbase)
+		assert.Nil(t, err)
+		return candidate
+	}
+
+	// Both branches are served from the layers, the fork unwinds the main
+	// chain candidates after the common ancestor
+	assert.NotNil(t, candidateAt(engine, fork, 8))
+	assert.NotNil(t, candidateAt(engine, fork, 18))
+	for number := 9; number <= 18; number++ {
+		chain := &testHeaderChain{config: params.TestnetChainConfig, headers: fork}
+		snap, err := engine.snapshot(chain, fork[len(fork)-1], nil)
+		assert.Nil(t, err)
+		candidate, err := snap.GetCandidate(main[number].Coinbase)
+		assert.Nil(t, err)
+		assert.Nil(t, candidate, "block %d", number)
+	}
+	assert.NotNil(t, candidateAt(engine, main, 18))
+
+	// Layers up to the last checkpoint are persisted and released
+	for _, number := range engine.snapshots.layers {
+		assert.True(t, number > 16)
+	}
+
+	// A restarted engine rebuilds the layers since the checkpoint from headers
+	restarted := New(params.TestnetEqualityConfig(), db)
+	restarted.SetSnapshotFlushInterval(4)
+	assert.NotNil(t, candidateAt(restarted, main, 18))
+	assert.Equal(t, 3, len(restarted.snapshots.layers))
+	for _, number := range restarted.snapshots.layers {
+		assert.True(t, number > 16)
+	}
+}
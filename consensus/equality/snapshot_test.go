@@ -152,3 +152,117 @@ func TestCountMinted(t *testing.T) {
 	assert.Equal(t, result[2].Address, validator3)
 	assert.Equal(t, result[2].Weight, big.NewInt(4))
 }
+
+func TestGetCandidatesFrom(t *testing.T) {
+	db := rawdb.NewMemoryDatabase()
+	snap, err := newSnapshot(db)
+	assert.Nil(t, err)
+
+	candidate1 := common.HexToAddress("0x10702d5b794d97fb720e02506ecfdb1186a804b1")
+	candidate2 := common.HexToAddress("0x19e28f4ca35205a5060d8375c9fca1a315f4d7b6")
+	candidate3 := common.HexToAddress("0x44d1ce0b7cb3588bca96151fe1bc05af38f91b6c")
+	for idx, candidate := range []common.Address{candidate3, candidate1, candidate2} {
+		_, err = snap.BecomeCandidate(candidate, uint64(idx+1), big.NewInt(int64(idx)))
+		assert.Nil(t, err)
+	}
+
+	addresses, candidates, next, err := snap.GetCandidatesFrom(common.Address{}, 2)
+	assert.Nil(t, err)
+	assert.Equal(t, []common.Address{candidate1, candidate2}, addresses)
+	assert.Equal(t, uint64(2), candidates[0].BlockNumber)
+	assert.Equal(t, &candidate3, next)
+
+	addresses, candidates, next, err = snap.GetCandidatesFrom(*next, 2)
+	assert.Nil(t, err)
+	assert.Equal(t, []common.Address{candidate3}, addresses)
+	assert.Equal(t, big.NewInt(0), candidates[0].Staked)
+	assert.Nil(t, next)
+}
+
+func TestKickOutBlock(t *testing.T) {
+	snap, err := newSnapshot(rawdb.NewMemoryDatabase())
+	assert.Nil(t, err)
+
+	kicked := common.HexToAddress("0xcc7c8317b21e1cea6139700c3c46c21af998d14c")
+	other := common.HexToAddress("0x44d1ce0b7cb3588bca96151fe1bc05af38f91b6c")
+	for _, candidate := range []common.Address{kicked, other} {
+		_, err = snap.BecomeCandidate(candidate, 1, big.NewInt(0))
+		assert.Nil(t, err)
+	}
+	_, exist, err := snap.GetKickOutBlock(kicked)
+	assert.Nil(t, err)
+	assert.False(t, exist)
+
+	_, _, err = snap.CancelCandidate(kicked)
+	assert.Nil(t, err)
+	assert.Nil(t, snap.SetKickOutBlock(kicked, 100))
+	number, exist, err := snap.GetKickOutBlock(kicked)
+	assert.Nil(t, err)
+	assert.True(t, exist)
+	assert.Equal(t, uint64(100), number)
+
+	// The kick out record is no candidate
+	candidates, err := snap.GetCandidates()
+	assert.Nil(t, err)
+	assert.Len(t, candidates, 1)
+	addresses, _, next, err := snap.GetCandidatesFrom(common.Address{}, 10)
+	assert.Nil(t, err)
+	assert.Equal(t, []common.Address{other}, addresses)
+	assert.Nil(t, next)
+	count, _ := snap.EnoughCandidates(2)
+	assert.Equal(t, 1, count)
+	random, err := snap.RandCandidates(100, 2)
+	assert.Nil(t, err)
+	assert.Equal(t, []common.Address{other}, random)
+
+	// Registering again removes the record
+	_, err = snap.BecomeCandidate(kicked, 200, big.NewInt(0))
+	assert.Nil(t, err)
+	_, exist, err = snap.GetKickOutBlock(kicked)
+	assert.Nil(t, err)
+	assert.False(t, exist)
+}
+
+func TestEpochLengthChange(t *testing.T) {
+	db := rawdb.NewMemoryDatabase()
+	snap, err := newSnapshot(db)
+	assert.Nil(t, err)
+	config := params.EqualityConfig{Period: 1, Epoch: 86400, MaxValidatorsCount: 3, MinCandidateBalance: big.NewInt(0)}
+	assert.Nil(t, snap.SetChainConfig(config))
+
+	// The epoch is shortened in the middle of the first one, which keeps its
+	// length until its end
+	shortened := config
+	shortened.Epoch = 43200
+	prev := HeaderExtra{Epoch: 1, EpochBlock: 1}
+	var elections []uint64
+	for number := uint64(2); len(elections) < 3; number++ {
+		current, err := snap.GetChainConfig()
+		assert.Nil(t, err)
+		length, err := snap.GetEpochLength(current)
+		assert.Nil(t, err)
+		if number <= 86400 {
+			assert.Equal(t, config.Epoch, length)
+		}
+
+		headerExtra := prev
+		headerExtra.Epoch, headerExtra.EpochBlock = nextEpoch(prev, number, length)
+		if headerExtra.EpochBlock == number {
+			elections = append(elections, number)
+		}
+		if number == 10000 {
+			assert.Nil(t, snap.ScheduleChainConfig(shortened))
+		}
+		assert.Nil(t, snap.settleEpochLength(current, number, headerExtra.EpochBlock))
+		prev = headerExtra
+	}
+	assert.Equal(t, []uint64{86401, 129601, 172801}, elections)
+	assert.Equal(t, uint64(4), prev.Epoch)
+
+	// The length is no longer recorded once the config one is in effect
+	configTrie, err := snap.ensureTrie(configPrefix)
+	assert.Nil(t, err)
+	data, err := configTrie.TryGet([]byte("epoch"))
+	assert.Nil(t, err)
+	assert.Nil(t, data)
+}
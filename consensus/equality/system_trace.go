@@ -0,0 +1,94 @@
+package equality
+
+import (
+	"errors"
+	"math/big"
+
+	"github.com/SecretBlockChain/go-secret/common"
+	"github.com/SecretBlockChain/go-secret/common/hexutil"
+	"github.com/SecretBlockChain/go-secret/consensus"
+	"github.com/SecretBlockChain/go-secret/core/state"
+	"github.com/SecretBlockChain/go-secret/core/types"
+)
+
+// Reasons of the system operations, the state changes applied by the engine
+// at the finalization of a block.
+const (
+	opReward          = "reward"          // Sealer reward of the block
+	opCommunityReward = "communityReward" // Community share of the block reward
+	opPoolReward      = "poolReward"      // Pool share of the block reward
+	opDeposit         = "deposit"         // Deposit locked by a candidate registration
+	opTopUp           = "topUp"           // Deposit locked by a candidate top up
+	opCancelRefund    = "cancelRefund"    // Deposit refunded to a cancelled candidate
+	opExitRefund      = "exitRefund"      // Deposit refunded to a candidate exiting at the transition
+	opEvictionRefund  = "evictionRefund"  // Deposit refunded to a candidate evicted by a higher one
+	opKickOutRefund   = "kickOutRefund"   // Deposit share refunded to a kicked out validator
+	opSlash           = "slash"           // Deposit share of a kicked out validator paid to the slash recipient
+	opContractRefund  = "contractRefund"  // Value sent to the candidate contract returned to its sender
+	opCandidateQueue  = "candidateQueue"  // Deferred registrations stored by the candidate contract
+	opVoteLock        = "voteLock"        // Balance locked as the weight of a vote
+	opVoteRefund      = "voteRefund"      // Weight of a cancelled vote returned to its delegator
+)
+
+// errHeaderExtraMismatch is returned if the finalization of a block doesn't
+// yield its header extra.
+var errHeaderExtraMismatch = errors.New("header extra mismatch")
+
+// SystemOperation is a state change applied by the engine at the finalization
+// of a block, either a balance or a storage change.
+type SystemOperation struct {
+	Reason  string         `json:"reason"`
+	Address common.Address `json:"address"`
+	Balance *hexutil.Big   `json:"balance,omitempty"` // Balance change, negative if debited
+	Slot    *common.Hash   `json:"slot,omitempty"`    // Storage slot written
+	Value   *common.Hash   `json:"value,omitempty"`   // Value written to the storage slot
+}
+
+// systemJournal records the system operations applied to a block being traced.
+// A nil journal applies the operations without recording them.
+type systemJournal struct {
+	operations []SystemOperation
+}
+
+// addBalance credits amount to address for reason.
+func (journal *systemJournal) addBalance(state *state.StateDB, address common.Address, amount *big.Int, reason string) {
+	state.AddBalance(address, amount)
+	if journal != nil {
+		journal.operations = append(journal.operations, SystemOperation{
+			Reason: reason, Address: address, Balance: (*hexutil.Big)(new(big.Int).Set(amount)),
+		})
+	}
+}
+
+// subBalance debits amount from address for reason.
+func (journal *systemJournal) subBalance(state *state.StateDB, address common.Address, amount *big.Int, reason string) {
+	state.SubBalance(address, amount)
+	if journal != nil {
+		journal.operations = append(journal.operations, SystemOperation{
+			Reason: reason, Address: address, Balance: (*hexutil.Big)(new(big.Int).Neg(amount)),
+		})
+	}
+}
+
+// setState writes value to the storage slot of address for reason.
+func (journal *systemJournal) setState(state *state.StateDB, address common.Address, slot, value common.Hash, reason string) {
+	state.SetState(address, slot, value)
+	if journal != nil {
+		journal.operations = append(journal.operations, SystemOperation{
+			Reason: reason, Address: address, Slot: &slot, Value: &value,
+		})
+	}
+}
+
+// TraceSystemOperations replays the finalization of the block of header on
+// state, the state after its transactions, and returns the balance and storage
+// changes the engine applied, in order. The block must be a valid one.
+func (e *Equality) TraceSystemOperations(chain consensus.ChainHeaderReader, header *types.Header, state *state.StateDB,
+	txs []*types.Transaction) ([]SystemOperation, error) {
+
+	journal := new(systemJournal)
+	if err := e.applySystemOperations(chain, types.CopyHeader(header), state, txs, journal); err != nil {
+		return nil, err
+	}
+	return journal.operations, nil
+}
@@ -0,0 +1,93 @@
+package equality
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/SecretBlockChain/go-secret/common"
+	"github.com/SecretBlockChain/go-secret/common/hexutil"
+	"github.com/SecretBlockChain/go-secret/core/rawdb"
+	"github.com/SecretBlockChain/go-secret/core/state"
+	"github.com/SecretBlockChain/go-secret/core/types"
+	"github.com/SecretBlockChain/go-secret/crypto"
+	"github.com/SecretBlockChain/go-secret/params"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTraceSystemOperations(t *testing.T) {
+	validators := []common.Address{
+		common.HexToAddress("0xcc7c8317b21e1cea6139700c3c46c21af998d14c"),
+		common.HexToAddress("0x44d1ce0b7cb3588bca96151fe1bc05af38f91b6c"),
+		common.HexToAddress("0xf541c3cd1d2df407fb9bb52b3489fc2aaeedd97e"),
+	}
+	recipient := common.HexToAddress("0x01")
+
+	// Validators 1 and 2 minted too few blocks of epoch 1 and are kicked out
+	// at the transition, their deposits split with the slash recipient
+	db := rawdb.NewMemoryDatabase()
+	config := params.EqualityConfig{Epoch: 30, MaxValidatorsCount: 3, MinCandidateBalance: big.NewInt(0),
+		KickOutRatio: 50, SlashRatio: 50, SlashRecipient: &recipient}
+	snap, err := newSnapshot(db)
+	assert.Nil(t, err)
+	assert.Nil(t, snap.SetValidators(validators))
+	for _, validator := range validators {
+		_, err = snap.BecomeCandidate(validator, 1, big.NewInt(100))
+		assert.Nil(t, err)
+	}
+	for i := 0; i < 3; i++ {
+		key, _ := crypto.GenerateKey()
+		_, err = snap.BecomeCandidate(crypto.PubkeyToAddress(key.PublicKey), 1, big.NewInt(100))
+		assert.Nil(t, err)
+	}
+	for number := uint64(1); number <= 28; number++ {
+		assert.Nil(t, snap.MintBlock(1, number, validators[0]))
+	}
+	assert.Nil(t, snap.MintBlock(1, 29, validators[1]))
+	assert.Nil(t, snap.MintBlock(1, 30, validators[2]))
+	root, err := snap.Root()
+	assert.Nil(t, err)
+	assert.Nil(t, snap.Commit(root))
+	e := New(&config, db)
+
+	parent := newTestHeader(30, HeaderExtra{Root: root, Epoch: 1, EpochBlock: 1})
+	chain := &testHeaderChain{config: params.TestnetChainConfig, headers: make([]*types.Header, 31)}
+	chain.headers[30] = parent
+	newState := func() *state.StateDB {
+		statedb, err := state.New(common.Hash{}, state.NewDatabase(rawdb.NewMemoryDatabase()), nil)
+		assert.Nil(t, err)
+		return statedb
+	}
+
+	header := newTestHeader(31, HeaderExtra{Epoch: 2, EpochBlock: 31})
+	header.ParentHash, header.Coinbase = parent.Hash(), validators[0]
+	block, err := e.FinalizeAndAssemble(chain, header, newState(), nil, nil, nil)
+	assert.Nil(t, err)
+	headerExtra, err := DecodeHeaderExtra(block.Header())
+	assert.Nil(t, err)
+	assert.ElementsMatch(t, validators[1:], headerExtra.CurrentBlockKickOutCandidates)
+
+	// The trace replays the refunds and slashes of the kick outs
+	statedb := newState()
+	operations, err := e.TraceSystemOperations(chain, block.Header(), statedb, nil)
+	assert.Nil(t, err)
+	for _, validator := range validators[1:] {
+		assert.Contains(t, operations, SystemOperation{Reason: opKickOutRefund, Address: validator, Balance: (*hexutil.Big)(big.NewInt(50))})
+		assert.Equal(t, big.NewInt(50), statedb.GetBalance(validator))
+	}
+	var slashed int
+	for _, operation := range operations {
+		if operation.Reason == opSlash {
+			assert.Equal(t, recipient, operation.Address)
+			assert.Equal(t, big.NewInt(50), operation.Balance.ToInt())
+			slashed++
+		}
+	}
+	assert.Equal(t, 2, slashed)
+	assert.Equal(t, block.Root(), statedb.IntermediateRoot(true))
+
+	// The trace of a block whose header extra doesn't match fails
+	forged := block.Header()
+	forged.Coinbase = validators[1]
+	_, err = e.TraceSystemOperations(chain, forged, newState(), nil)
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,115 @@
+package equality
+
+import (
+	"bytes"
+	"fmt"
+	"math/big"
+	"sort"
+
+	"github.com/SecretBlockChain/go-secret/common"
+	"github.com/SecretBlockChain/go-secret/rlp"
+)
+
+// TopUp is the increase of the deposit locked by a candidate, the amounts of
+// the top ups of a candidate within a block are summed up.
+type TopUp struct {
+	Candidate common.Address `json:"candidate"`
+	Amount    *big.Int       `json:"amount"`
+}
+
+// Equal compares two top ups for equality.
+func (topUp TopUp) Equal(other TopUp) bool {
+	if topUp.Candidate != other.Candidate {
+		return false
+	}
+	if topUp.Amount == nil || other.Amount == nil {
+		return topUp.Amount == other.Amount
+	}
+	return topUp.Amount.Cmp(other.Amount) == 0
+}
+
+// String implements the fmt.Stringer interface.
+func (topUp TopUp) String() string {
+	return fmt.Sprintf("%s:%v", topUp.Candidate.String(), topUp.Amount)
+}
+
+// TopUpCandidate adds amount to the deposit of a candidate, return a bool value
+// means address is a candidate not exiting.
+func (snap *Snapshot) TopUpCandidate(candidateAddr common.Address, amount *big.Int) (bool, error) {
+	candidate, err := snap.GetCandidate(candidateAddr)
+	if err != nil || candidate == nil || candidate.Exiting {
+		return false, err
+	}
+
+	candidateTrie, err := snap.ensureTrie(candidatePrefix)
+	if err != nil {
+		return false, err
+	}
+	candidate.Staked = new(big.Int).Add(candidate.Staked, amount)
+	value, err := rlp.EncodeToBytes(candidate)
+	if err != nil {
+		return false, err
+	}
+	return true, candidateTrie.TryUpdate(candidateAddr.Bytes(), value)
+}
+
+// Return a copy of a TopUp slice sorted by candidate address bytes, the slice
+// itself if already sorted.
+func topUpsSort(slice []TopUp) []TopUp {
+	if topUpsSorted(slice) {
+		return slice
+	}
+
+	result := make([]TopUp, len(slice))
+	copy(result, slice)
+	sort.Slice(result, func(i, j int) bool {
+		return bytes.Compare(result[i].Candidate[:], result[j].Candidate[:]) < 0
+	})
+	return result
+}
+
+// topUpsSorted returns whether a TopUp slice is sorted by candidate address
+// bytes.
+func topUpsSorted(slice []TopUp) bool {
+	for idx := 1; idx < len(slice); idx++ {
+		if bytes.Compare(slice[idx-1].Candidate[:], slice[idx].Candidate[:]) > 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// Returns the candidates of a TopUp slice.
+func topUpsCandidates(slice []TopUp) []common.Address {
+	candidates := make([]common.Address, 0, len(slice))
+	for _, topUp := range slice {
+		candidates = append(candidates, topUp.Candidate)
+	}
+	return candidates
+}
+
+// Return a copy of a TopUp slice with amount added to the top up of the
+// candidate.
+func topUpsAdd(slice []TopUp, candidate common.Address, amount *big.Int) []TopUp {
+	result := make([]TopUp, 0, len(slice)+1)
+	total := new(big.Int).Set(amount)
+	for _, topUp := range slice {
+		if topUp.Candidate == candidate {
+			total.Add(total, topUp.Amount)
+			continue
+		}
+		result = append(result, topUp)
+	}
+	return append(result, TopUp{Candidate: candidate, Amount: total})
+}
+
+// Return a copy of a TopUp slice without the top up of the candidate.
+func topUpsRemove(slice []TopUp, candidate common.Address) []TopUp {
+	result := make([]TopUp, 0, len(slice))
+	for _, topUp := range slice {
+		if topUp.Candidate != candidate {
+			result = append(result, topUp)
+		}
+	}
+	return result
+}
@@ -0,0 +1,121 @@
+package equality
+
+import (
+	"crypto/ecdsa"
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/SecretBlockChain/go-secret/common"
+	"github.com/SecretBlockChain/go-secret/core/rawdb"
+	"github.com/SecretBlockChain/go-secret/core/state"
+	"github.com/SecretBlockChain/go-secret/core/types"
+	"github.com/SecretBlockChain/go-secret/crypto"
+	"github.com/SecretBlockChain/go-secret/params"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTopUpCandidate(t *testing.T) {
+	var keys []*ecdsa.PrivateKey
+	var addresses []common.Address
+	for i := 0; i < 3; i++ {
+		key, _ := crypto.GenerateKey()
+		keys = append(keys, key)
+		addresses = append(addresses, crypto.PubkeyToAddress(key.PublicKey))
+	}
+	candidate, outsider, exiting := addresses[0], addresses[1], addresses[2]
+
+	db := rawdb.NewMemoryDatabase()
+	statedb, err := state.New(common.Hash{}, state.NewDatabase(db), nil)
+	assert.Nil(t, err)
+	for _, address := range addresses {
+		statedb.AddBalance(address, big.NewInt(10))
+	}
+
+	config := params.EqualityConfig{Period: 3, Epoch: 30, MaxValidatorsCount: 3, MinCandidateBalance: big.NewInt(5),
+		CandidateExitBlock: big.NewInt(1), TopUpBlock: big.NewInt(3)}
+	e := New(&config, db)
+	snap, err := newSnapshot(db)
+	assert.Nil(t, err)
+	for _, address := range []common.Address{candidate, exiting} {
+		_, err = snap.BecomeCandidate(address, 1, config.MinCandidateBalance)
+		assert.Nil(t, err)
+	}
+	_, err = snap.ExitCandidate(exiting)
+	assert.Nil(t, err)
+	root, err := snap.Root()
+	assert.Nil(t, err)
+	assert.Nil(t, snap.Commit(root))
+
+	// Top ups are ignored before the top up block
+	header := &types.Header{Number: big.NewInt(2)}
+	headerExtra := HeaderExtra{Epoch: 1, EpochBlock: 1}
+	e.processTransactions(config, statedb, header, snap, &headerExtra, []*types.Transaction{
+		newVoteTestTransaction(t, keys[0], "equality:1:event:topup:2"),
+	})
+	assert.Empty(t, headerExtra.CurrentBlockTopUps)
+	assert.Equal(t, big.NewInt(10), statedb.GetBalance(candidate))
+
+	// The top ups of a candidate are summed up and locked, the ones of
+	// non candidates, exiting candidates and beyond the balance are rejected
+	header = &types.Header{Number: big.NewInt(3)}
+	headerExtra = HeaderExtra{Epoch: 1, EpochBlock: 1}
+	e.processTransactions(config, statedb, header, snap, &headerExtra, []*types.Transaction{
+		newVoteTestTransaction(t, keys[0], "equality:1:event:topup:2"),
+		newVoteTestTransaction(t, keys[0], "equality:1:event:topup:3"),
+		newVoteTestTransaction(t, keys[0], "equality:1:event:topup:6"),
+		newVoteTestTransaction(t, keys[1], "equality:1:event:topup:2"),
+		newVoteTestTransaction(t, keys[2], "equality:1:event:topup:2"),
+	})
+	assert.Equal(t, []TopUp{{Candidate: candidate, Amount: big.NewInt(5)}}, headerExtra.CurrentBlockTopUps)
+	assert.Equal(t, big.NewInt(5), statedb.GetBalance(candidate))
+	assert.Equal(t, big.NewInt(10), statedb.GetBalance(outsider))
+	assert.Equal(t, big.NewInt(10), statedb.GetBalance(exiting))
+
+	candidates, err := snap.GetCandidates()
+	assert.Nil(t, err)
+	assert.Equal(t, big.NewInt(10), candidates[candidate].Staked)
+	assert.Equal(t, big.NewInt(5), candidates[exiting].Staked)
+	logs, err := candidateLogs(config, 3, snap, snap, headerExtra)
+	assert.Nil(t, err)
+	assert.Equal(t, []*types.Log{newCandidateLog(CandidateToppedUpTopic, candidate, big.NewInt(5), 3)}, logs)
+
+	// Verifiers lock the same deposit replaying the header extra, and reject
+	// the top ups of non candidates
+	replayed := e.snapshots.open(root)
+	assert.Nil(t, replayed.apply(config, header, headerExtra))
+	topped, err := replayed.GetCandidate(candidate)
+	assert.Nil(t, err)
+	assert.Equal(t, big.NewInt(10), topped.Staked)
+	forged := headerExtra
+	forged.CurrentBlockTopUps = append(forged.CurrentBlockTopUps, TopUp{Candidate: outsider, Amount: big.NewInt(2)})
+	assert.True(t, errors.Is(e.snapshots.open(root).apply(config, header, forged), errInvalidTopUp))
+	assert.False(t, forged.Equal(headerExtra))
+
+	// Canceling within the block returns the deposit with the top ups
+	config.CandidateExitBlock = nil
+	header = &types.Header{Number: big.NewInt(4)}
+	headerExtra = HeaderExtra{Epoch: 1, EpochBlock: 1}
+	e.processTransactions(config, statedb, header, snap, &headerExtra, []*types.Transaction{
+		newVoteTestTransaction(t, keys[0], "equality:1:event:topup:5"),
+		newVoteTestTransaction(t, keys[0], "equality:1:event:delegator"),
+	})
+	assert.Empty(t, headerExtra.CurrentBlockTopUps)
+	assert.Equal(t, []common.Address{candidate}, headerExtra.CurrentBlockCancelCandidates)
+	assert.Equal(t, big.NewInt(15), statedb.GetBalance(candidate))
+}
+
+func TestTopUpTransactionDecode(t *testing.T) {
+	key, _ := crypto.GenerateKey()
+	ctx, err := NewTransaction(newVoteTestTransaction(t, key, "equality:1:event:topup:1000000000000000000"))
+	assert.Nil(t, err)
+	topUp, ok := ctx.(*EventTopUpCandidate)
+	assert.True(t, ok)
+	assert.Equal(t, crypto.PubkeyToAddress(key.PublicKey), topUp.Candidate)
+	assert.Equal(t, "1000000000000000000", topUp.Amount.String())
+
+	for _, amount := range []string{"", "0", "-1", "0x10", "one"} {
+		_, err = NewTransaction(newVoteTestTransaction(t, key, "equality:1:event:topup:"+amount))
+		assert.NotNil(t, err, "amount %q", amount)
+	}
+}
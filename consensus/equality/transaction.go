@@ -1,12 +1,17 @@
 package equality
 
 import (
+	"encoding/json"
 	"errors"
+	"math/big"
 	"reflect"
 	"strings"
 
 	"github.com/SecretBlockChain/go-secret/common"
+	"github.com/SecretBlockChain/go-secret/common/hexutil"
 	"github.com/SecretBlockChain/go-secret/core/types"
+	"github.com/SecretBlockChain/go-secret/crypto"
+	"github.com/SecretBlockChain/go-secret/params"
 )
 
 // Transaction custom transaction interface.
@@ -27,6 +32,14 @@ var (
 	prototypes = []Transaction{
 		new(EventBecomeCandidate),
 		new(EventCancelCandidate),
+		new(EventVote),
+		new(EventCancelVote),
+		new(EventProposeConfig),
+		new(EventApproveConfig),
+		new(EventTopUpCandidate),
+		new(EventSignCheckpoint),
+		new(EventSetRewardRecipient),
+		new(EventSetSealer),
 	}
 	prototypeMapper = map[TransactionType][]Transaction{}
 )
@@ -39,8 +52,12 @@ func init() {
 }
 
 // NewTransaction new custom transaction from transaction data.
-// data format: equality:version:type:action:data
+// data format: equality:version:type:action:data, or a call of the candidate
+// system contract at CandidateContractAddress
 func NewTransaction(tx *types.Transaction) (Transaction, error) {
+	if isCandidateContractCall(tx) {
+		return newContractTransaction(tx)
+	}
 	slice := strings.Split(string(tx.Data()), ":")
 	if len(slice) < 4 {
 		return nil, errors.New("invalid custom transaction data")
@@ -80,11 +97,20 @@ func NewTransaction(tx *types.Transaction) (Transaction, error) {
 	return nil, errors.New("undefined custom transaction action")
 }
 
+// IsConsensusTransaction returns whether tx is a custom transaction of the
+// engine, in the raw data format or a call of the candidate system contract.
+func IsConsensusTransaction(tx *types.Transaction) bool {
+	_, err := NewTransaction(tx)
+	return err == nil
+}
+
 // EventBecomeCandidate apply to become Candidate.
-// data like "equality:1:event:candidate"
-// Sender will become a Candidate
+// data like "equality:1:event:candidate" or "equality:1:event:candidate:{metadata}"
+// Sender will become a Candidate, a Candidate registering again only replaces its metadata
 type EventBecomeCandidate struct {
 	Candidate common.Address
+	Deposit   *big.Int // Value sent to the candidate system contract, nil for the raw data
+	Metadata  []byte   // At most MaxCandidateMetadataSize bytes, nil for none
 }
 
 func (event *EventBecomeCandidate) Type() TransactionType {
@@ -96,11 +122,15 @@ func (event *EventBecomeCandidate) Action() string {
 }
 
 func (event *EventBecomeCandidate) Decode(tx *types.Transaction, data []byte) error {
+	if len(data) > MaxCandidateMetadataSize {
+		return errors.New("invalid candidate metadata")
+	}
 	txSender, err := types.Sender(types.NewEIP155Signer(tx.ChainId()), tx)
 	if err != nil {
 		return err
 	}
 	event.Candidate = txSender
+	event.Metadata = data
 	return nil
 }
 
@@ -127,3 +157,236 @@ func (event *EventCancelCandidate) Decode(tx *types.Transaction, data []byte) er
 	event.Delegator = txSender
 	return nil
 }
+
+// EventVote apply to vote for a Candidate.
+// data like "equality:1:event:vote:0x44d1ce0b7cb3588bca96151fe1bc05af38f91b6c"
+// Sender will delegate its balance to the Candidate, locked until it cancels the vote
+type EventVote struct {
+	Delegator common.Address
+	Candidate common.Address
+}
+
+func (event *EventVote) Type() TransactionType {
+	return EventTransactionType
+}
+
+func (event *EventVote) Action() string {
+	return "vote"
+}
+
+func (event *EventVote) Decode(tx *types.Transaction, data []byte) error {
+	if !common.IsHexAddress(string(data)) {
+		return errors.New("invalid candidate address")
+	}
+	txSender, err := types.Sender(types.NewEIP155Signer(tx.ChainId()), tx)
+	if err != nil {
+		return err
+	}
+	event.Delegator = txSender
+	event.Candidate = common.HexToAddress(string(data))
+	return nil
+}
+
+// EventCancelVote apply to cancel vote.
+// data like "equality:1:event:unvote"
+// Sender will withdraw its vote, the balance locked by it is returned
+type EventCancelVote struct {
+	Delegator common.Address
+}
+
+func (event *EventCancelVote) Type() TransactionType {
+	return EventTransactionType
+}
+
+func (event *EventCancelVote) Action() string {
+	return "unvote"
+}
+
+func (event *EventCancelVote) Decode(tx *types.Transaction, data []byte) error {
+	txSender, err := types.Sender(types.NewEIP155Signer(tx.ChainId()), tx)
+	if err != nil {
+		return err
+	}
+	event.Delegator = txSender
+	return nil
+}
+
+// EventProposeConfig apply to propose a chain config change.
+// data like "equality:1:event:propose:{"period":3,...}"
+// Sender proposes the json encoded config, it must be a validator
+type EventProposeConfig struct {
+	Proposer common.Address
+	Config   params.EqualityConfig
+}
+
+func (event *EventProposeConfig) Type() TransactionType {
+	return EventTransactionType
+}
+
+func (event *EventProposeConfig) Action() string {
+	return "propose"
+}
+
+func (event *EventProposeConfig) Decode(tx *types.Transaction, data []byte) error {
+	if err := json.Unmarshal(data, &event.Config); err != nil {
+		return errors.New("invalid chain config")
+	}
+	txSender, err := types.Sender(types.NewEIP155Signer(tx.ChainId()), tx)
+	if err != nil {
+		return err
+	}
+	event.Proposer = txSender
+	return nil
+}
+
+// EventApproveConfig apply to approve a chain config change.
+// data like "equality:1:event:approve:0x5c3f2e5a5d28e91b7f9a2abf4d2e1ed8e6d7b4c1a0b1e4c4b9b6d2c0f0a1b2c3"
+// Sender approves the proposal with the hash, it must be a validator
+type EventApproveConfig struct {
+	Validator common.Address
+	Proposal  common.Hash
+}
+
+func (event *EventApproveConfig) Type() TransactionType {
+	return EventTransactionType
+}
+
+func (event *EventApproveConfig) Action() string {
+	return "approve"
+}
+
+func (event *EventApproveConfig) Decode(tx *types.Transaction, data []byte) error {
+	hash, err := hexutil.Decode(string(data))
+	if err != nil || len(hash) != common.HashLength {
+		return errors.New("invalid proposal hash")
+	}
+	txSender, err := types.Sender(types.NewEIP155Signer(tx.ChainId()), tx)
+	if err != nil {
+		return err
+	}
+	event.Validator = txSender
+	event.Proposal = common.BytesToHash(hash)
+	return nil
+}
+
+// EventTopUpCandidate apply to top up the deposit of a Candidate.
+// data like "equality:1:event:topup:1000000000000000000"
+// Sender locks the amount in wei on top of its deposit, it must be a candidate not exiting
+type EventTopUpCandidate struct {
+	Candidate common.Address
+	Amount    *big.Int
+}
+
+func (event *EventTopUpCandidate) Type() TransactionType {
+	return EventTransactionType
+}
+
+func (event *EventTopUpCandidate) Action() string {
+	return "topup"
+}
+
+func (event *EventTopUpCandidate) Decode(tx *types.Transaction, data []byte) error {
+	amount, ok := new(big.Int).SetString(string(data), 10)
+	if !ok || amount.Sign() <= 0 {
+		return errors.New("invalid top up amount")
+	}
+	txSender, err := types.Sender(types.NewEIP155Signer(tx.ChainId()), tx)
+	if err != nil {
+		return err
+	}
+	event.Candidate = txSender
+	event.Amount = amount
+	return nil
+}
+
+// EventSetRewardRecipient apply to route the sealer rewards of a Candidate.
+// data like "equality:1:event:recipient:0x44d1ce0b7cb3588bca96151fe1bc05af38f91b6c"
+// Sender must be a candidate, its own address pays the rewards to it again
+type EventSetRewardRecipient struct {
+	Candidate common.Address
+	Recipient common.Address
+}
+
+func (event *EventSetRewardRecipient) Type() TransactionType {
+	return EventTransactionType
+}
+
+func (event *EventSetRewardRecipient) Action() string {
+	return "recipient"
+}
+
+func (event *EventSetRewardRecipient) Decode(tx *types.Transaction, data []byte) error {
+	if !common.IsHexAddress(string(data)) {
+		return errors.New("invalid reward recipient address")
+	}
+	recipient := common.HexToAddress(string(data))
+	if recipient == (common.Address{}) {
+		return errors.New("invalid reward recipient address")
+	}
+	txSender, err := types.Sender(types.NewEIP155Signer(tx.ChainId()), tx)
+	if err != nil {
+		return err
+	}
+	event.Candidate = txSender
+	event.Recipient = recipient
+	return nil
+}
+
+// EventSetSealer apply to seal the blocks of a Candidate with another key.
+// data like "equality:1:event:sealer:0x44d1ce0b7cb3588bca96151fe1bc05af38f91b6c"
+// Sender must be a candidate, the key seals from the next epoch on, its own
+// address restores its own key
+type EventSetSealer struct {
+	Candidate common.Address
+	Sealer    common.Address
+}
+
+func (event *EventSetSealer) Type() TransactionType {
+	return EventTransactionType
+}
+
+func (event *EventSetSealer) Action() string {
+	return "sealer"
+}
+
+func (event *EventSetSealer) Decode(tx *types.Transaction, data []byte) error {
+	if !common.IsHexAddress(string(data)) {
+		return errors.New("invalid sealer address")
+	}
+	sealer := common.HexToAddress(string(data))
+	if sealer == (common.Address{}) {
+		return errors.New("invalid sealer address")
+	}
+	txSender, err := types.Sender(types.NewEIP155Signer(tx.ChainId()), tx)
+	if err != nil {
+		return err
+	}
+	event.Candidate = txSender
+	event.Sealer = sealer
+	return nil
+}
+
+// EventSignCheckpoint apply to attest the checkpoint of an epoch.
+// data like "equality:1:event:checkpoint:0x<65 bytes signature>"
+// Any sender relays the signature of a validator over the final block of the
+// previous epoch, it is collected by the transition block
+type EventSignCheckpoint struct {
+	Signature []byte
+}
+
+func (event *EventSignCheckpoint) Type() TransactionType {
+	return EventTransactionType
+}
+
+func (event *EventSignCheckpoint) Action() string {
+	return "checkpoint"
+}
+
+func (event *EventSignCheckpoint) Decode(tx *types.Transaction, data []byte) error {
+	signature, err := hexutil.Decode(string(data))
+	if err != nil || len(signature) != crypto.SignatureLength {
+		return errors.New("invalid checkpoint signature")
+	}
+	event.Signature = signature
+	return nil
+}
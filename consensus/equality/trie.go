@@ -5,6 +5,7 @@ import (
 	"fmt"
 
 	"github.com/SecretBlockChain/go-secret/common"
+	"github.com/SecretBlockChain/go-secret/ethdb"
 	"github.com/SecretBlockChain/go-secret/log"
 	"github.com/SecretBlockChain/go-secret/trie"
 )
@@ -108,6 +109,20 @@ func (t *Trie) TryDelete(key []byte) error {
 	return t.trie.TryDelete(key)
 }
 
+// Prove constructs a merkle proof for key. The result contains all encoded nodes
+// on the path to the value at key. The value itself is also included in the last
+// node and can be retrieved by verifying the proof.
+//
+// If the trie does not contain a value for key, the returned proof contains all
+// nodes of the longest existing prefix of the key (at least the root node), ending
+// with the node that proves the absence of the key.
+func (t *Trie) Prove(key []byte, fromLevel uint, proofDb ethdb.KeyValueWriter) error {
+	if t.prefix != nil {
+		key = append(t.prefix, key...)
+	}
+	return t.trie.Prove(key, fromLevel, proofDb)
+}
+
 // Commit writes all nodes to the trie's database.
 // Nodes are stored with their sha3 hash as the key.
 ////
@@ -0,0 +1,139 @@
+package equality
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+
+	"github.com/SecretBlockChain/go-secret/common"
+	"github.com/SecretBlockChain/go-secret/common/hexutil"
+	"github.com/SecretBlockChain/go-secret/core/types"
+	"github.com/SecretBlockChain/go-secret/log"
+)
+
+// errTrustedCheckpointMismatch is returned if the block at the number of the
+// trusted checkpoint, or the snapshot of the checkpoint, isn't the one the
+// checkpoint names.
+var errTrustedCheckpointMismatch = errors.New("trusted checkpoint mismatch")
+
+// TrustedCheckpoint is a block the headers up to are trusted without being
+// verified, e.g. to sync a chain without decoding the header extras from
+// genesis. The snapshot of the block is imported from the checkpoint, the
+// headers following it are verified against it.
+type TrustedCheckpoint struct {
+	Number     uint64           `json:"number"`
+	Hash       common.Hash      `json:"hash"`
+	Epoch      uint64           `json:"epoch"`
+	EpochBlock uint64           `json:"epochBlock"`
+	Validators []common.Address `json:"validators"`
+	Snapshot   hexutil.Bytes    `json:"snapshot"` // Snapshot tries after the block, as exported by ExportSnapshot
+
+	root Root // Root of the imported snapshot
+}
+
+// LoadTrustedCheckpoint reads a trusted checkpoint from the json file at path.
+func LoadTrustedCheckpoint(path string) (*TrustedCheckpoint, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	checkpoint := new(TrustedCheckpoint)
+	if err = json.Unmarshal(data, checkpoint); err != nil {
+		return nil, fmt.Errorf("invalid trusted checkpoint %s: %w", path, err)
+	}
+	return checkpoint, nil
+}
+
+// GenerateTrustedCheckpoint returns the trusted checkpoint of header, a block
+// of the local chain whose snapshot is available.
+func (e *Equality) GenerateTrustedCheckpoint(header *types.Header) (*TrustedCheckpoint, error) {
+	if header.Number.Uint64() == 0 {
+		return nil, errUnknownBlock
+	}
+	headerExtra, err := e.DecodeHeaderExtraCached(header)
+	if err != nil {
+		return nil, err
+	}
+	validators, err := e.snapshots.open(headerExtra.Root).GetValidators()
+	if err != nil {
+		return nil, err
+	}
+	var buffer bytes.Buffer
+	if err = exportSnapshot(e.snapshots.triedb, headerExtra.Root, &buffer); err != nil {
+		return nil, err
+	}
+	return &TrustedCheckpoint{
+		Number:     header.Number.Uint64(),
+		Hash:       header.Hash(),
+		Epoch:      headerExtra.Epoch,
+		EpochBlock: headerExtra.EpochBlock,
+		Validators: validators,
+		Snapshot:   buffer.Bytes(),
+	}, nil
+}
+
+// SetTrustedCheckpoint imports the snapshot of checkpoint and trusts the
+// headers up to it from then on, nil verifies every header again. The
+// validators of the snapshot must be the ones of the checkpoint.
+func (e *Equality) SetTrustedCheckpoint(checkpoint *TrustedCheckpoint) error {
+	if checkpoint == nil {
+		e.lock.Lock()
+		e.trusted = nil
+		e.lock.Unlock()
+		return nil
+	}
+
+	root, err := ImportSnapshot(e.db, bytes.NewReader(checkpoint.Snapshot))
+	if err != nil {
+		return err
+	}
+	validators, err := e.snapshots.open(root).GetValidators()
+	if err != nil {
+		return err
+	}
+	if validatorsToString(validators) != validatorsToString(checkpoint.Validators) {
+		return fmt.Errorf("%w: validators %s, snapshot has %s", errTrustedCheckpointMismatch,
+			validatorsToString(checkpoint.Validators), validatorsToString(validators))
+	}
+
+	trusted := *checkpoint
+	trusted.Snapshot = nil
+	trusted.root = root
+	e.lock.Lock()
+	e.trusted = &trusted
+	e.lock.Unlock()
+	log.Info("[equality] Trusting checkpoint", "number", checkpoint.Number, "hash", checkpoint.Hash, "epoch", checkpoint.Epoch)
+	return nil
+}
+
+// trustedHeader returns whether header is trusted by the trusted checkpoint:
+// the headers below it are, and the block of the checkpoint, whose hash, epoch
+// and trie roots must be the ones of the checkpoint. The chain connecting to
+// the checkpoint is the only one the headers below it are part of.
+func (e *Equality) trustedHeader(header *types.Header) (bool, error) {
+	e.lock.RLock()
+	trusted := e.trusted
+	e.lock.RUnlock()
+
+	number := header.Number.Uint64()
+	if trusted == nil || number > trusted.Number {
+		return false, nil
+	}
+	if number < trusted.Number {
+		return true, nil
+	}
+	if hash := header.Hash(); hash != trusted.Hash {
+		return false, classify(PossibleFork, fmt.Errorf("%w: block %d is %s, want %s",
+			errTrustedCheckpointMismatch, number, hash.Hex(), trusted.Hash.Hex()))
+	}
+	headerExtra, err := e.DecodeHeaderExtraCached(header)
+	if err != nil {
+		return false, err
+	}
+	if headerExtra.Root != trusted.root || headerExtra.Epoch != trusted.Epoch || headerExtra.EpochBlock != trusted.EpochBlock {
+		return false, fmt.Errorf("%w: block %d carries another snapshot or epoch", errTrustedCheckpointMismatch, number)
+	}
+	return true, nil
+}
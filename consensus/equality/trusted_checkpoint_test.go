@@ -0,0 +1,87 @@
+package equality
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"math/big"
+	"path/filepath"
+	"testing"
+
+	"github.com/SecretBlockChain/go-secret/common"
+	"github.com/SecretBlockChain/go-secret/core/rawdb"
+	"github.com/SecretBlockChain/go-secret/core/types"
+	"github.com/SecretBlockChain/go-secret/crypto"
+	"github.com/SecretBlockChain/go-secret/params"
+	"github.com/SecretBlockChain/go-secret/rpc"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTrustedCheckpoint(t *testing.T) {
+	key, _ := crypto.GenerateKey()
+	validator := crypto.PubkeyToAddress(key.PublicKey)
+	config := *params.AllEthashProtocolChanges
+	config.Ethash = nil
+	config.Equality = &params.EqualityConfig{Epoch: 3, MaxValidatorsCount: 1, MinCandidateBalance: big.NewInt(0),
+		Validators: []common.Address{validator}}
+
+	// Sync three epochs, generate the checkpoint of the last block of epoch 2
+	chain, engine := newTestBlockChain(t, rawdb.NewMemoryDatabase(), &config, key)
+	for number := 1; number <= 9; number++ {
+		_, err := chain.InsertChain(types.Blocks{sealTestBlock(t, chain, engine, key)})
+		assert.Nil(t, err)
+	}
+	headers := make([]*types.Header, 10)
+	for number := range headers {
+		headers[number] = chain.GetHeaderByNumber(uint64(number))
+	}
+	number := rpc.BlockNumber(6)
+	checkpoint, err := (&AdminAPI{chain: chain, equality: engine}).GenerateCheckpoint(&number)
+	chain.Stop()
+	assert.Nil(t, err)
+	assert.Equal(t, headers[6].Hash(), checkpoint.Hash)
+	assert.Equal(t, uint64(2), checkpoint.Epoch)
+	assert.Equal(t, uint64(4), checkpoint.EpochBlock)
+	assert.Equal(t, []common.Address{validator}, checkpoint.Validators)
+
+	data, err := json.Marshal(checkpoint)
+	assert.Nil(t, err)
+	path := filepath.Join(t.TempDir(), "checkpoint.json")
+	assert.Nil(t, ioutil.WriteFile(path, data, 0644))
+	loaded, err := LoadTrustedCheckpoint(path)
+	assert.Nil(t, err)
+
+	// A fresh node knowing the headers from the checkpoint on only can't
+	// verify them without it
+	known := &testHeaderChain{config: &config, headers: make([]*types.Header, len(headers))}
+	copy(known.headers[6:], headers[6:])
+	fresh := New(config.Equality, rawdb.NewMemoryDatabase())
+	assert.NotNil(t, fresh.VerifyHeader(known, headers[7], true))
+
+	// With it the headers up to the checkpoint are trusted, the following ones
+	// verified from its snapshot
+	assert.Nil(t, fresh.SetTrustedCheckpoint(loaded))
+	for number := 1; number <= 9; number++ {
+		assert.Nil(t, fresh.VerifyHeader(known, headers[number], true), "block %d", number)
+		assert.Nil(t, fresh.VerifySeal(known, headers[number]), "block %d", number)
+	}
+	batch := New(config.Equality, rawdb.NewMemoryDatabase())
+	assert.Nil(t, batch.SetTrustedCheckpoint(loaded))
+	abort, results := batch.VerifyHeaders(known, headers[1:], make([]bool, 9))
+	defer close(abort)
+	for number := 1; number <= 9; number++ {
+		assert.Nil(t, <-results, "block %d", number)
+	}
+
+	// The block of another chain at the checkpoint doesn't connect to it
+	forked := types.CopyHeader(headers[6])
+	forked.Time++
+	err = fresh.VerifyHeader(known, forked, true)
+	assert.True(t, errors.Is(err, errTrustedCheckpointMismatch))
+	assert.True(t, IsPossibleFork(err))
+
+	// A checkpoint is trusted with the validators of its snapshot only
+	loaded.Validators = []common.Address{common.HexToAddress("0x01")}
+	err = New(config.Equality, rawdb.NewMemoryDatabase()).SetTrustedCheckpoint(loaded)
+	assert.True(t, errors.Is(err, errTrustedCheckpointMismatch))
+}
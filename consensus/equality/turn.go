@@ -0,0 +1,169 @@
+package equality
+
+import (
+	"fmt"
+	"math/big"
+	"math/rand"
+	"time"
+
+	"github.com/SecretBlockChain/go-secret/common"
+	"github.com/SecretBlockChain/go-secret/consensus"
+	"github.com/SecretBlockChain/go-secret/core/types"
+	"github.com/SecretBlockChain/go-secret/params"
+)
+
+// From the turn block on, any validator not sealing one of the recent blocks
+// may seal a block, not only the one of the timestamp slot. The validator in
+// turn at the block number seals at a higher difficulty than the others, so
+// the fork choice of the highest total difficulty prefers the blocks sealed in
+// turn over the ones of validators sealing out of turn at the same height.
+var (
+	diffInTurn = big.NewInt(2) // Block difficulty of the validator in turn
+	diffNoTurn = big.NewInt(1) // Block difficulty of the validators out of turn
+)
+
+// wiggleTime is the random delay per validator of an out of turn validator
+// sealing, letting the block of the validator in turn propagate first.
+const wiggleTime = 500 * time.Millisecond
+
+// turnValidator returns the validator in turn at block number among the
+// validators in sealing order.
+func turnValidator(validators []common.Address, number uint64) common.Address {
+	return validators[number%uint64(len(validators))]
+}
+
+// turnDifficulty returns the difficulty of block number sealed by signer.
+func turnDifficulty(validators []common.Address, number uint64, signer common.Address) *big.Int {
+	if len(validators) > 0 && turnValidator(validators, number) == signer {
+		return new(big.Int).Set(diffInTurn)
+	}
+	return new(big.Int).Set(diffNoTurn)
+}
+
+// recentLimit returns the number of blocks preceding a block none of which its
+// signer may have sealed. With the floor(N/2)+1 blocks window of clique, it is
+// derived from the validators of the block, so the window shrinks with them at
+// an epoch transition, and a single validator seals every block.
+func recentLimit(validators []common.Address) uint64 {
+	return uint64(len(validators) / 2)
+}
+
+// checkRecent returns errRecentlySigned if signer sealed one of the recent
+// blocks up to parent, from the turn or the recent block on. The window is
+// followed along the chain of headers rather than kept in the snapshot, so
+// the trie roots are unchanged by it. The parents, if given, are the
+// ancestors of parent not yet known by chain, in ascending order.
+func (e *Equality) checkRecent(chain consensus.ChainHeaderReader, config params.EqualityConfig,
+	parent *types.Header, parents []*types.Header, validators []common.Address, signer common.Address) error {
+
+	number := new(big.Int).Add(parent.Number, common.Big1)
+	if !config.IsTurn(number) && !config.IsRecent(number) {
+		return nil
+	}
+	recent, err := e.recentlySigned(chain, config, parent, parents, signer, recentLimit(validators))
+	if err != nil {
+		return err
+	}
+	if recent {
+		return errRecentlySigned
+	}
+	return nil
+}
+
+// checkSlotRecent checks the recent blocks for the signer of the timestamp
+// slot of the block after parent, before the turn block.
+func (e *Equality) checkSlotRecent(chain consensus.ChainHeaderReader, config params.EqualityConfig,
+	parent *types.Header, parents []*types.Header, signer common.Address) error {
+
+	if parent == nil || !config.IsRecent(new(big.Int).Add(parent.Number, common.Big1)) {
+		return nil
+	}
+	validators, err := e.sealingValidators(config, parent)
+	if err != nil {
+		return err
+	}
+	return e.checkRecent(chain, config, parent, parents, validators, signer)
+}
+
+// recentlySigned returns whether the validator signer sealed one of the limit
+// blocks up to parent. The parents, if given, are the ancestors of parent not
+// yet known by chain, in ascending order.
+func (e *Equality) recentlySigned(chain consensus.ChainHeaderReader, config params.EqualityConfig, parent *types.Header,
+	parents []*types.Header, signer common.Address, limit uint64) (bool, error) {
+
+	header := parent
+	for i := uint64(0); i < limit && header.Number.Uint64() > 0; i++ {
+		sealer, err := e.headerValidator(config, header)
+		if err != nil {
+			return false, err
+		}
+		if sealer == signer {
+			return true, nil
+		}
+		if i+1 == limit {
+			break
+		}
+
+		number, hash := header.Number.Uint64()-1, header.ParentHash
+		if len(parents) > 0 && parents[len(parents)-1].Hash() == hash {
+			header, parents = parents[len(parents)-1], parents[:len(parents)-1]
+		} else if header = chain.GetHeader(hash, number); header == nil {
+			return false, consensus.ErrUnknownAncestor
+		}
+	}
+	return false, nil
+}
+
+// checkValidator returns errUnauthorizedValidator with the recovered signer and
+// the number of validators if signer isn't one of the validators of the block.
+func checkValidator(validators []common.Address, signer common.Address) error {
+	if !addressesExist(validators, signer) {
+		return fmt.Errorf("%w: %s not among the %d validators of the epoch", errUnauthorizedValidator, signer.Hex(), len(validators))
+	}
+	return nil
+}
+
+// verifyTurn checks the seal of a header from the turn block on: a validator
+// not sealing one of the recent blocks signs it at the difficulty of its turn,
+// at least a period after its parent.
+func (e *Equality) verifyTurn(chain consensus.ChainHeaderReader, config params.EqualityConfig,
+	header, parent *types.Header, parents []*types.Header, signer common.Address) error {
+
+	if header.Time < earliestTime(config, parent) {
+		return ErrInvalidTimestamp
+	}
+	validators, err := e.sealingValidators(config, parent)
+	if err != nil {
+		return err
+	}
+	if err = checkValidator(validators, signer); err != nil {
+		return err
+	}
+	if err = e.checkRecent(chain, config, parent, parents, validators, signer); err != nil {
+		return err
+	}
+	if header.Difficulty == nil || header.Difficulty.Cmp(turnDifficulty(validators, header.Number.Uint64(), signer)) != 0 {
+		return errWrongDifficulty
+	}
+	e.notifyMissedTurn(header, validators, signer)
+	return nil
+}
+
+// maySeal returns whether signer may seal the block after parent from the turn
+// block on, and the delay of its seal after the block time if out of turn.
+func (e *Equality) maySeal(chain consensus.ChainHeaderReader, config params.EqualityConfig,
+	parent *types.Header, signer common.Address) (bool, time.Duration) {
+
+	validators, err := e.sealingValidators(config, parent)
+	if err != nil || !addressesExist(validators, signer) {
+		return false, 0
+	}
+	if err = e.checkRecent(chain, config, parent, nil, validators, signer); err != nil {
+		return false, 0
+	}
+	if turnValidator(validators, parent.Number.Uint64()+1) == signer {
+		return true, 0
+	}
+	wiggle := time.Duration(len(validators)/2+1) * wiggleTime
+	return true, time.Duration(rand.Int63n(int64(wiggle)))
+}
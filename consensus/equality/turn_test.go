@@ -0,0 +1,289 @@
+package equality
+
+import (
+	"crypto/ecdsa"
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/SecretBlockChain/go-secret/common"
+	"github.com/SecretBlockChain/go-secret/core/rawdb"
+	"github.com/SecretBlockChain/go-secret/core/types"
+	"github.com/SecretBlockChain/go-secret/crypto"
+	"github.com/SecretBlockChain/go-secret/ethdb"
+	"github.com/SecretBlockChain/go-secret/params"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestTurnConfig(turnBlock int64) params.EqualityConfig {
+	return params.EqualityConfig{
+		Period:             1,
+		Epoch:              12,
+		MaxValidatorsCount: 21,
+		GenesisTimestamp:   1623283200,
+		TurnBlock:          big.NewInt(turnBlock),
+	}
+}
+
+// newTestValidatorsRoot stores a snapshot of the validators in db.
+func newTestValidatorsRoot(t *testing.T, db ethdb.Database, validators []common.Address) Root {
+	snap, err := newSnapshot(db)
+	assert.Nil(t, err)
+	assert.Nil(t, snap.SetValidators(validators))
+	root, err := snap.Root()
+	assert.Nil(t, err)
+	assert.Nil(t, snap.Commit(root))
+	return root
+}
+
+// newTestTurnHeader returns the header after parent sealed by key.
+func newTestTurnHeader(parent *types.Header, headerExtra HeaderExtra, key *ecdsa.PrivateKey, difficulty int64) *types.Header {
+	header := newTestHeader(parent.Number.Uint64()+1, headerExtra)
+	header.ParentHash = parent.Hash()
+	header.Time = parent.Time + 1
+	header.Difficulty = big.NewInt(difficulty)
+	signature, err := crypto.Sign(SealHash(header).Bytes(), key)
+	if err != nil {
+		panic(err)
+	}
+	copy(header.Extra[len(header.Extra)-ExtraSeal:], signature)
+	return header
+}
+
+func TestCalcDifficultyEpochBoundary(t *testing.T) {
+	validatorA := common.HexToAddress("0xa000000000000000000000000000000000000000")
+	validatorB := common.HexToAddress("0xb000000000000000000000000000000000000000")
+	validatorC := common.HexToAddress("0xc000000000000000000000000000000000000000")
+
+	// The epoch transition at block 13 changes the order of the validators
+	db := rawdb.NewMemoryDatabase()
+	previous := newTestValidatorsRoot(t, db, []common.Address{validatorA, validatorB, validatorC})
+	next := newTestValidatorsRoot(t, db, []common.Address{validatorB, validatorC, validatorA})
+	parent := newTestHeader(12, HeaderExtra{Root: previous, Epoch: 1, EpochBlock: 1})
+	transition := newTestHeader(13, HeaderExtra{Root: next, Epoch: 2, EpochBlock: 13, CurrentEpochValidators: []common.Address{validatorB, validatorC, validatorA}})
+	transition.ParentHash = parent.Hash()
+
+	for _, test := range []struct {
+		turnBlock  int64
+		signer     common.Address
+		transition int64 // Difficulty of block 13 sealed by the validators of epoch 1
+		following  int64 // Difficulty of block 14 sealed by the validators of epoch 2
+	}{
+		{1, validatorA, 1, 2},
+		{1, validatorB, 2, 1},
+		{1, validatorC, 1, 1},
+		{14, validatorB, defaultDifficulty, 1},
+		{0, validatorA, defaultDifficulty, defaultDifficulty},
+	} {
+		config := newTestTurnConfig(test.turnBlock)
+		e := New(&config, db)
+		e.Authorize(test.signer, nil)
+		assert.Equal(t, test.transition, e.CalcDifficulty(nil, 0, parent).Int64(), "turn block %d, signer %s", test.turnBlock, test.signer.Hex())
+		assert.Equal(t, test.following, e.CalcDifficulty(nil, 0, transition).Int64(), "turn block %d, signer %s", test.turnBlock, test.signer.Hex())
+	}
+}
+
+func TestVerifyTurn(t *testing.T) {
+	keys := make([]*ecdsa.PrivateKey, 5)
+	validators := make([]common.Address, 4)
+	for idx := range keys {
+		keys[idx], _ = crypto.GenerateKey()
+		if idx < len(validators) {
+			validators[idx] = crypto.PubkeyToAddress(keys[idx].PublicKey)
+		}
+	}
+
+	db := rawdb.NewMemoryDatabase()
+	config := newTestTurnConfig(1)
+	e := New(&config, db)
+	headerExtra := HeaderExtra{Root: newTestValidatorsRoot(t, db, validators), Epoch: 1, EpochBlock: 1}
+
+	// Blocks 1 and 2 sealed by the first validators, only the first one known
+	genesis := &types.Header{Number: big.NewInt(0), Time: config.GenesisTimestamp}
+	first := newTestTurnHeader(genesis, headerExtra, keys[0], 1)
+	parent := newTestTurnHeader(first, headerExtra, keys[1], 1)
+	chain := &testHeaderChain{config: params.TestnetChainConfig, headers: []*types.Header{genesis, first}}
+
+	// Validator 3 is in turn at block 3, 4 validators keep 2 recent sealers out
+	for _, test := range []struct {
+		key        int
+		difficulty int64
+		err        error
+	}{
+		{3, 2, nil},
+		{2, 1, nil},
+		{3, 1, errWrongDifficulty},
+		{2, 2, errWrongDifficulty},
+		{1, 1, errRecentlySigned},
+		{0, 1, errRecentlySigned},
+		{4, 1, errUnauthorizedValidator},
+	} {
+		header := newTestTurnHeader(parent, headerExtra, keys[test.key], test.difficulty)
+		err := e.verifySeal(chain, config, header, parent, nil)
+		assert.True(t, errors.Is(err, test.err), "key %d: %v", test.key, err)
+	}
+
+	// Out of turn validators may seal at the period as well
+	header := newTestTurnHeader(parent, headerExtra, keys[3], 2)
+	header.Time = parent.Time
+	assert.Equal(t, ErrInvalidTimestamp, e.verifySeal(chain, config, header, parent, nil))
+
+	// Ancestors not known by the chain are looked up in the parents
+	unknown := &testHeaderChain{config: params.TestnetChainConfig, headers: []*types.Header{genesis}}
+	header = newTestTurnHeader(parent, headerExtra, keys[0], 1)
+	assert.Equal(t, errRecentlySigned, e.verifySeal(unknown, config, header, parent, []*types.Header{first}))
+
+	// Out of turn validators wait for the block in turn to propagate
+	ok, delay := e.maySeal(chain, config, parent, validators[3])
+	assert.True(t, ok)
+	assert.Zero(t, delay)
+	ok, delay = e.maySeal(chain, config, parent, validators[2])
+	assert.True(t, ok)
+	assert.True(t, delay < 3*wiggleTime)
+	ok, _ = e.maySeal(chain, config, parent, validators[1])
+	assert.False(t, ok)
+
+	// Before the turn block only the validator of the timestamp slot seals
+	config.TurnBlock = big.NewInt(4)
+	slot := (parent.Time + 1 - config.GenesisTimestamp) / config.Period % uint64(len(validators))
+	for idx := range validators {
+		header := newTestTurnHeader(parent, headerExtra, keys[idx], 1)
+		err := e.verifySeal(chain, config, header, parent, nil)
+		if uint64(idx) == slot {
+			assert.Nil(t, err)
+		} else {
+			assert.Equal(t, errUnauthorized, err)
+		}
+	}
+}
+
+func TestRecentWindow(t *testing.T) {
+	keys := make([]*ecdsa.PrivateKey, 4)
+	validators := make([]common.Address, len(keys))
+	for idx := range keys {
+		keys[idx], _ = crypto.GenerateKey()
+		validators[idx] = crypto.PubkeyToAddress(keys[idx].PublicKey)
+	}
+
+	// The epoch transition at block 13 shrinks the validators from 4 to 2
+	db := rawdb.NewMemoryDatabase()
+	config := newTestTurnConfig(1)
+	e := New(&config, db)
+	previous := HeaderExtra{Root: newTestValidatorsRoot(t, db, validators), Epoch: 1, EpochBlock: 1}
+	next := HeaderExtra{Root: newTestValidatorsRoot(t, db, validators[:2]), Epoch: 2, EpochBlock: 13, CurrentEpochValidators: validators[:2]}
+	start := newTestHeader(10, previous)
+	start.Time = config.GenesisTimestamp + 10
+	b11 := newTestTurnHeader(start, previous, keys[1], 1)
+	b12 := newTestTurnHeader(b11, previous, keys[0], 2)
+	b13 := newTestTurnHeader(b12, next, keys[2], 1)
+	chain := &testHeaderChain{config: params.TestnetChainConfig, headers: make([]*types.Header, 14)}
+	for _, header := range []*types.Header{start, b11, b12, b13} {
+		chain.headers[header.Number.Uint64()] = header
+	}
+
+	// Validator 0 sealed block 12, out of the window of a single block after
+	// the transition, while the window of 2 blocks before it covers block 12
+	assert.Nil(t, e.verifySeal(chain, config, newTestTurnHeader(b13, next, keys[0], 2), b13, nil))
+	assert.Equal(t, errRecentlySigned, e.verifySeal(chain, config, newTestTurnHeader(b12, previous, keys[0], 1), b12, nil))
+	assert.Equal(t, errRecentlySigned, e.verifySeal(chain, config, newTestTurnHeader(b12, previous, keys[1], 1), b12, nil))
+	assert.Nil(t, e.verifySeal(chain, config, newTestTurnHeader(b12, previous, keys[3], 1), b12, nil))
+
+	// A single validator seals every block
+	single := HeaderExtra{Root: newTestValidatorsRoot(t, db, validators[:1]), Epoch: 1, EpochBlock: 1}
+	singleStart := newTestHeader(10, single)
+	singleStart.Time = start.Time
+	chain = &testHeaderChain{config: params.TestnetChainConfig, headers: []*types.Header{singleStart}}
+	for number := 1; number <= 3; number++ {
+		parent := chain.headers[len(chain.headers)-1]
+		ok, _ := e.maySeal(chain, config, parent, validators[0])
+		assert.True(t, ok, "block %d", number)
+		header := newTestTurnHeader(parent, single, keys[0], 2)
+		assert.Nil(t, e.verifySeal(chain, config, header, parent, nil), "block %d", number)
+		chain.headers = append(chain.headers, header)
+	}
+
+	// Before the turn block the validator of the timestamp slot is rejected
+	// from the recent block on if it sealed the parent
+	config = newTestTurnConfig(0)
+	pair := HeaderExtra{Root: newTestValidatorsRoot(t, db, validators[:2]), Epoch: 1, EpochBlock: 1}
+	parent := newTestTurnHeader(start, pair, keys[0], 1)
+	for _, test := range []struct {
+		recentBlock int64
+		key         int
+		err         error
+	}{
+		{13, 0, nil},
+		{13, 1, nil},
+		{12, 0, errRecentlySigned},
+		{12, 1, nil},
+	} {
+		config.RecentBlock = big.NewInt(test.recentBlock)
+		header := newTestTurnHeader(parent, pair, keys[test.key], 1)
+		for (header.Time-config.GenesisTimestamp)/config.Period%2 != uint64(test.key) {
+			header.Time++
+		}
+		signature, err := crypto.Sign(SealHash(header).Bytes(), keys[test.key])
+		assert.Nil(t, err)
+		copy(header.Extra[len(header.Extra)-ExtraSeal:], signature)
+		assert.Equal(t, test.err, e.verifySeal(chain, config, header, parent, nil), "recent block %d, key %d", test.recentBlock, test.key)
+	}
+}
+
+func TestVerifyUnauthorizedValidator(t *testing.T) {
+	keys := make([]*ecdsa.PrivateKey, 4)
+	addresses := make([]common.Address, len(keys))
+	for idx := range keys {
+		keys[idx], _ = crypto.GenerateKey()
+		addresses[idx] = crypto.PubkeyToAddress(keys[idx].PublicKey)
+	}
+
+	// The epoch transition at block 13 drops validator 0, validator 3 is never
+	// a validator
+	db := rawdb.NewMemoryDatabase()
+	config := newTestTurnConfig(0)
+	e := New(&config, db)
+	previous := HeaderExtra{Root: newTestValidatorsRoot(t, db, addresses[:3]), Epoch: 1, EpochBlock: 1}
+	next := HeaderExtra{Root: newTestValidatorsRoot(t, db, addresses[1:3]), Epoch: 2, EpochBlock: 13, CurrentEpochValidators: addresses[1:3]}
+	start := newTestHeader(12, previous)
+	start.Time = config.GenesisTimestamp + 12
+	b13 := newTestTurnHeader(start, next, keys[1], 1)
+	chain := &testHeaderChain{config: params.TestnetChainConfig, headers: make([]*types.Header, 14)}
+	chain.headers[12], chain.headers[13] = start, b13
+
+	// seal signs the header after parent by key at the timestamp slot of idx
+	seal := func(parent *types.Header, headerExtra HeaderExtra, key *ecdsa.PrivateKey, idx, count uint64) *types.Header {
+		header := newTestTurnHeader(parent, headerExtra, key, 1)
+		for (header.Time-config.GenesisTimestamp)/config.Period%count != idx {
+			header.Time++
+		}
+		signature, err := crypto.Sign(SealHash(header).Bytes(), key)
+		assert.Nil(t, err)
+		copy(header.Extra[len(header.Extra)-ExtraSeal:], signature)
+		return header
+	}
+
+	// Validator 0 seals in its slot of epoch 1, not in epoch 2
+	assert.Nil(t, e.verifySeal(chain, config, seal(start, previous, keys[0], 0, 3), start, nil))
+	assert.Nil(t, e.verifySeal(chain, config, seal(b13, next, keys[1], 0, 2), b13, nil))
+	header := seal(b13, next, keys[0], 0, 2)
+	err := e.verifySeal(chain, config, header, b13, nil)
+	assert.True(t, errors.Is(err, errUnauthorizedValidator))
+	assert.Contains(t, err.Error(), addresses[0].Hex())
+	assert.Contains(t, err.Error(), "2 validators")
+	assert.True(t, e.signatures.Contains(header.Hash()))
+
+	// Non validators and forged signatures are reported with the recovered address
+	err = e.verifySeal(chain, config, seal(start, previous, keys[3], 0, 3), start, nil)
+	assert.True(t, errors.Is(err, errUnauthorizedValidator))
+	assert.Contains(t, err.Error(), addresses[3].Hex())
+	assert.Contains(t, err.Error(), "3 validators")
+
+	forged := seal(b13, next, keys[1], 0, 2)
+	forged.GasUsed++
+	signer, err := ecrecover(forged, e.signatures)
+	assert.Nil(t, err)
+	assert.NotEqual(t, addresses[1], signer)
+	err = e.verifySeal(chain, config, forged, b13, nil)
+	assert.True(t, errors.Is(err, errUnauthorizedValidator))
+	assert.Contains(t, err.Error(), signer.Hex())
+}
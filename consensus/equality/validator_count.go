@@ -0,0 +1,74 @@
+package equality
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/SecretBlockChain/go-secret/params"
+)
+
+// Names of the validator count formulas, sizing the validators elected at each
+// epoch transition by the number of candidates standing.
+const (
+	FixedValidatorCount  = "fixed"  // The max validators count, the default
+	LinearValidatorCount = "linear" // base + candidates/divisor
+	SqrtValidatorCount   = "sqrt"   // base + floor(sqrt(candidates))
+)
+
+// errInvalidValidatorCountFormula is returned if a chain config names a
+// validator count formula not supported or sets parameters it doesn't take.
+var errInvalidValidatorCountFormula = errors.New("invalid validator count formula")
+
+// checkValidatorCountFormula checks the validator count formula of config and
+// its parameters: a base of at least one validator, and a divisor for the
+// linear formula only.
+func checkValidatorCountFormula(config params.EqualityConfig) error {
+	switch config.ValidatorCountFormula {
+	case "", FixedValidatorCount:
+		if config.ValidatorCountBase != 0 || config.ValidatorCountDivisor != 0 {
+			return fmt.Errorf("%w: parameters without a formula", errInvalidValidatorCountFormula)
+		}
+		return nil
+	case LinearValidatorCount:
+		if config.ValidatorCountDivisor == 0 {
+			return fmt.Errorf("%w: linear without a divisor", errInvalidValidatorCountFormula)
+		}
+	case SqrtValidatorCount:
+		if config.ValidatorCountDivisor != 0 {
+			return fmt.Errorf("%w: sqrt takes no divisor", errInvalidValidatorCountFormula)
+		}
+	default:
+		return fmt.Errorf("%w: %q", errInvalidValidatorCountFormula, config.ValidatorCountFormula)
+	}
+	if config.ValidatorCountBase == 0 {
+		return fmt.Errorf("%w: %s without a base", errInvalidValidatorCountFormula, config.ValidatorCountFormula)
+	}
+	return nil
+}
+
+// validatorCount returns the number of validators an epoch transition elects
+// under config out of the given number of candidates: the max validators count
+// under the fixed formula, the result of the formula within the min and max
+// validators counts otherwise.
+func validatorCount(config params.EqualityConfig, candidates int) int {
+	if candidates < 0 {
+		candidates = 0
+	}
+	var count uint64
+	switch config.ValidatorCountFormula {
+	case LinearValidatorCount:
+		count = config.ValidatorCountBase + uint64(candidates)/config.ValidatorCountDivisor
+	case SqrtValidatorCount:
+		count = config.ValidatorCountBase + new(big.Int).Sqrt(big.NewInt(int64(candidates))).Uint64()
+	default:
+		return int(config.MaxValidatorsCount)
+	}
+	if count > config.MaxValidatorsCount {
+		count = config.MaxValidatorsCount
+	}
+	if count < config.MinValidatorsCount {
+		count = config.MinValidatorsCount
+	}
+	return int(count)
+}
@@ -0,0 +1,160 @@
+package equality
+
+import (
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/SecretBlockChain/go-secret/common"
+	"github.com/SecretBlockChain/go-secret/core/rawdb"
+	"github.com/SecretBlockChain/go-secret/core/types"
+	"github.com/SecretBlockChain/go-secret/crypto"
+	"github.com/SecretBlockChain/go-secret/params"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidatorCount(t *testing.T) {
+	linear := params.EqualityConfig{MaxValidatorsCount: 7, ValidatorCountFormula: LinearValidatorCount,
+		ValidatorCountBase: 3, ValidatorCountDivisor: 10}
+	sqrt := params.EqualityConfig{MaxValidatorsCount: 6, ValidatorCountFormula: SqrtValidatorCount, ValidatorCountBase: 1}
+	floored := linear
+	floored.MinValidatorsCount = 4
+
+	tests := []struct {
+		config     params.EqualityConfig
+		candidates int
+		count      int
+	}{
+		// The fixed count ignores the candidate pool
+		{params.EqualityConfig{MaxValidatorsCount: 21}, 0, 21},
+		{params.EqualityConfig{MaxValidatorsCount: 21, ValidatorCountFormula: FixedValidatorCount}, 1000, 21},
+
+		// A validator more every ten candidates, up to the max validators count
+		{linear, 0, 3},
+		{linear, 9, 3},
+		{linear, 10, 4},
+		{linear, 19, 4},
+		{linear, 20, 5},
+		{linear, 39, 6},
+		{linear, 40, 7},
+		{linear, 41, 7},
+		{linear, 1000, 7},
+
+		// A validator more at every square
+		{sqrt, 0, 1},
+		{sqrt, 1, 2},
+		{sqrt, 3, 2},
+		{sqrt, 4, 3},
+		{sqrt, 8, 3},
+		{sqrt, 9, 4},
+		{sqrt, 24, 5},
+		{sqrt, 25, 6},
+		{sqrt, 100, 6},
+
+		// The min validators count floors the formula
+		{floored, 0, 4},
+		{floored, 10, 4},
+		{floored, 20, 5},
+	}
+	for _, test := range tests {
+		assert.Equal(t, test.count, validatorCount(test.config, test.candidates),
+			"formula %q, %d candidates", test.config.ValidatorCountFormula, test.candidates)
+	}
+}
+
+func TestCheckValidatorCountFormula(t *testing.T) {
+	tests := []struct {
+		formula string
+		base    uint64
+		divisor uint64
+		valid   bool
+	}{
+		{"", 0, 0, true},
+		{FixedValidatorCount, 0, 0, true},
+		{LinearValidatorCount, 3, 10, true},
+		{SqrtValidatorCount, 1, 0, true},
+		{"", 3, 0, false},
+		{FixedValidatorCount, 0, 10, false},
+		{LinearValidatorCount, 3, 0, false},
+		{LinearValidatorCount, 0, 10, false},
+		{SqrtValidatorCount, 1, 2, false},
+		{SqrtValidatorCount, 0, 0, false},
+		{"log", 1, 0, false},
+	}
+	for _, test := range tests {
+		config := params.EqualityConfig{ValidatorCountFormula: test.formula, ValidatorCountBase: test.base,
+			ValidatorCountDivisor: test.divisor}
+		err := checkValidatorCountFormula(config)
+		if test.valid {
+			assert.Nil(t, err, "formula %q, base %d, divisor %d", test.formula, test.base, test.divisor)
+		} else {
+			assert.True(t, errors.Is(err, errInvalidValidatorCountFormula), "formula %q, base %d, divisor %d",
+				test.formula, test.base, test.divisor)
+		}
+	}
+
+	// A chain config proposed with an invalid formula is rejected
+	config := *params.TestnetEqualityConfig()
+	config.ValidatorCountFormula = LinearValidatorCount
+	assert.True(t, errors.Is(validateChainConfig(config), errInvalidChainConfig))
+}
+
+func TestElectValidatorCount(t *testing.T) {
+	config := params.EqualityConfig{Epoch: 12, MaxValidatorsCount: 7, ValidatorCountFormula: LinearValidatorCount,
+		ValidatorCountBase: 3, ValidatorCountDivisor: 10}
+	header := &types.Header{Number: big.NewInt(13), ParentHash: common.HexToHash("0x01")}
+	newSnap := func(count int) *Snapshot {
+		snap, err := newSnapshot(rawdb.NewMemoryDatabase())
+		assert.Nil(t, err)
+		assert.Nil(t, snap.SetValidators(nil))
+		for i := 0; i < count; i++ {
+			address := common.BytesToAddress(crypto.Keccak256(big.NewInt(int64(i)).Bytes()))
+			_, err = snap.BecomeCandidate(address, 1, big.NewInt(0))
+			assert.Nil(t, err)
+		}
+		return snap
+	}
+
+	// The transitions elect the validators the formula sizes out of the pool,
+	// across its breakpoints
+	for _, test := range []struct{ candidates, validators int }{
+		{2, 2}, {9, 3}, {10, 4}, {19, 4}, {20, 5}, {39, 6}, {40, 7}, {60, 7},
+	} {
+		e := New(&config, rawdb.NewMemoryDatabase())
+		headerExtra, trail := HeaderExtra{Epoch: 2, EpochBlock: 13}, new(electionTrail)
+		assert.Nil(t, e.elect(config, nil, header, newSnap(test.candidates), &headerExtra, nil, trail))
+		assert.Len(t, headerExtra.CurrentEpochValidators, test.validators, "%d candidates", test.candidates)
+		assert.Equal(t, validatorCount(config, test.candidates), trail.ValidatorCount)
+		assert.Nil(t, newSnap(test.candidates).applyElection(config, header, headerExtra))
+
+		// A transition electing more validators than the formula's result is
+		// rejected, even below the max validators count
+		if test.validators < int(config.MaxValidatorsCount) && test.candidates > test.validators {
+			forged := headerExtra
+			infos, err := newSnap(test.candidates).CandidateInfos()
+			assert.Nil(t, err)
+			extra := NewAddressSet(forged.CurrentEpochValidators...)
+			for _, info := range infos {
+				if !extra.Contains(info.Address) {
+					forged.CurrentEpochValidators = append(append([]common.Address{}, forged.CurrentEpochValidators...), info.Address)
+					break
+				}
+			}
+			err = newSnap(test.candidates).applyElection(config, header, forged)
+			assert.True(t, errors.Is(err, errTooManyValidators), "%d candidates: %v", test.candidates, err)
+		}
+	}
+
+	// The validators carried over are cut down to the formula's result
+	config.MinValidatorsCount = 3
+	snap := newSnap(2)
+	infos, err := snap.CandidateInfos()
+	assert.Nil(t, err)
+	previous := []common.Address{infos[0].Address, infos[1].Address,
+		common.HexToAddress("0xa1"), common.HexToAddress("0xa2"), common.HexToAddress("0xa3")}
+	assert.Nil(t, snap.SetValidators(previous))
+	headerExtra, trail := HeaderExtra{Epoch: 2, EpochBlock: 13}, new(electionTrail)
+	assert.Nil(t, New(&config, rawdb.NewMemoryDatabase()).elect(config, nil, header, snap, &headerExtra, nil, trail))
+	assert.True(t, trail.CarriedOver)
+	assert.Equal(t, previous[:3], headerExtra.CurrentEpochValidators)
+}
@@ -0,0 +1,104 @@
+package equality
+
+import (
+	"context"
+	"time"
+
+	"github.com/SecretBlockChain/go-secret/common"
+	"github.com/SecretBlockChain/go-secret/common/hexutil"
+	"github.com/SecretBlockChain/go-secret/core/types"
+	"github.com/SecretBlockChain/go-secret/log"
+	"github.com/SecretBlockChain/go-secret/rpc"
+)
+
+// missedTurnWindow is how recent to the local clock a block sealed out of turn
+// must be for the missed turn to be notified, so the blocks of a sync are not.
+const missedTurnWindow = 10 * time.Minute
+
+// ValidatorMissedEvent is posted to the event mux for every imported block
+// sealed out of turn, from the turn block on, by signer rather than the missed
+// validator in turn at its number.
+type ValidatorMissedEvent struct {
+	Number uint64
+	Hash   common.Hash
+	Missed common.Address
+	Signer common.Address
+}
+
+// notifyMissedTurn posts the ValidatorMissedEvent of a verified header if
+// sealed out of turn by signer among the validators. Each block is notified
+// once, however often it is verified.
+func (e *Equality) notifyMissedTurn(header *types.Header, validators []common.Address, signer common.Address) {
+	number := header.Number.Uint64()
+	missed := turnValidator(validators, number)
+	if missed == signer || time.Since(time.Unix(int64(header.Time), 0)) > missedTurnWindow {
+		return
+	}
+	hash := header.Hash()
+	if e.missedTurns.Contains(hash) {
+		return
+	}
+	e.missedTurns.Add(hash, struct{}{})
+	log.Debug("[equality] Validator missed its turn", "number", number, "hash", hash, "missed", missed, "signer", signer)
+
+	e.epochs.lock.Lock()
+	mux := e.epochs.mux
+	e.epochs.lock.Unlock()
+	if mux == nil {
+		return
+	}
+	ev := ValidatorMissedEvent{Number: number, Hash: hash, Missed: missed, Signer: signer}
+	if err := mux.Post(ev); err != nil {
+		log.Debug("[equality] Failed to post validator missed event", "number", number, "err", err)
+	}
+}
+
+// rpcValidatorMissedEvent is the json representation of ValidatorMissedEvent.
+type rpcValidatorMissedEvent struct {
+	Number hexutil.Uint64 `json:"number"`
+	Hash   common.Hash    `json:"hash"`
+	Missed common.Address `json:"missed"`
+	Signer common.Address `json:"signer"`
+}
+
+// EqualityValidatorMissed sends a notification for every recent block sealed
+// out of turn, subscribed as eth_subscribe("equalityValidatorMissed").
+func (api *EpochEventAPI) EqualityValidatorMissed(ctx context.Context) (*rpc.Subscription, error) {
+	notifier, supported := rpc.NotifierFromContext(ctx)
+	if !supported {
+		return &rpc.Subscription{}, rpc.ErrNotificationsUnsupported
+	}
+
+	api.equality.epochs.lock.Lock()
+	mux := api.equality.epochs.mux
+	api.equality.epochs.lock.Unlock()
+	if mux == nil {
+		return &rpc.Subscription{}, errEpochEventsUnavailable
+	}
+
+	rpcSub := notifier.CreateSubscription()
+	sub := mux.Subscribe(ValidatorMissedEvent{})
+	go func() {
+		defer sub.Unsubscribe()
+		for {
+			select {
+			case obj, ok := <-sub.Chan():
+				if !ok {
+					return
+				}
+				ev := obj.Data.(ValidatorMissedEvent)
+				notifier.Notify(rpcSub.ID, &rpcValidatorMissedEvent{
+					Number: hexutil.Uint64(ev.Number),
+					Hash:   ev.Hash,
+					Missed: ev.Missed,
+					Signer: ev.Signer,
+				})
+			case <-rpcSub.Err():
+				return
+			case <-notifier.Closed():
+				return
+			}
+		}
+	}()
+	return rpcSub, nil
+}
@@ -0,0 +1,75 @@
+package equality
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/SecretBlockChain/go-secret/common"
+	"github.com/SecretBlockChain/go-secret/common/hexutil"
+	"github.com/SecretBlockChain/go-secret/core/rawdb"
+	"github.com/SecretBlockChain/go-secret/core/types"
+	"github.com/SecretBlockChain/go-secret/crypto"
+	"github.com/SecretBlockChain/go-secret/event"
+	"github.com/SecretBlockChain/go-secret/params"
+	"github.com/SecretBlockChain/go-secret/rpc"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidatorMissedSubscription(t *testing.T) {
+	keys := make([]*ecdsa.PrivateKey, 4)
+	validators := make([]common.Address, len(keys))
+	for idx := range keys {
+		keys[idx], _ = crypto.GenerateKey()
+		validators[idx] = crypto.PubkeyToAddress(keys[idx].PublicKey)
+	}
+
+	db := rawdb.NewMemoryDatabase()
+	config := newTestTurnConfig(1)
+	e := New(&config, db)
+	e.SetEventMux(new(event.TypeMux))
+	headerExtra := HeaderExtra{Root: newTestValidatorsRoot(t, db, validators), Epoch: 1, EpochBlock: 1}
+
+	server := rpc.NewServer()
+	defer server.Stop()
+	assert.Nil(t, server.RegisterName("eth", &EpochEventAPI{equality: e}))
+	client := rpc.DialInProc(server)
+	defer client.Close()
+	events := make(chan rpcValidatorMissedEvent, 16)
+	sub, err := client.EthSubscribe(context.Background(), events, "equalityValidatorMissed")
+	assert.Nil(t, err)
+	defer sub.Unsubscribe()
+
+	// Validator 3 is in turn at block 3 of a chain sealed by the first ones
+	verify := func(genesisTime uint64, key int, difficulty int64) {
+		genesis := &types.Header{Number: big.NewInt(0), Time: genesisTime}
+		first := newTestTurnHeader(genesis, headerExtra, keys[0], 1)
+		parent := newTestTurnHeader(first, headerExtra, keys[1], 1)
+		chain := &testHeaderChain{config: params.TestnetChainConfig, headers: []*types.Header{genesis, first, parent}}
+		header := newTestTurnHeader(parent, headerExtra, keys[key], difficulty)
+		assert.Nil(t, e.verifySeal(chain, config, header, parent, nil))
+	}
+	recent := uint64(time.Now().Unix()) - 10
+	verify(recent, 3, 2)
+	verify(uint64(time.Now().Add(-missedTurnWindow).Unix())-10, 2, 1)
+	verify(recent, 2, 1)
+	verify(recent, 2, 1)
+
+	select {
+	case ev := <-events:
+		assert.Equal(t, hexutil.Uint64(3), ev.Number)
+		assert.Equal(t, validators[3], ev.Missed)
+		assert.Equal(t, validators[2], ev.Signer)
+	case err := <-sub.Err():
+		t.Fatalf("subscription failed: %v", err)
+	case <-time.After(time.Second):
+		t.Fatal("missed turn not notified")
+	}
+	select {
+	case ev := <-events:
+		t.Fatalf("unexpected notification of block %d", ev.Number)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
@@ -0,0 +1,83 @@
+package equality
+
+import "errors"
+
+// VerificationClass tells what a failure of the equality verification says of
+// the peer having sent the block.
+type VerificationClass int
+
+const (
+	// ProtocolViolation marks a block no honest peer sends on any chain: its
+	// header extra doesn't decode or its signer isn't authorized. The peer is
+	// to be dropped.
+	ProtocolViolation VerificationClass = iota + 1
+
+	// PossibleFork marks a block valid on a chain other than the local one,
+	// e.g. its trie roots differ from the ones computed locally. The peer may
+	// be deprioritized, not dropped, as the local node may be the one forked.
+	PossibleFork
+)
+
+// String implements fmt.Stringer.
+func (class VerificationClass) String() string {
+	switch class {
+	case ProtocolViolation:
+		return "protocol violation"
+	case PossibleFork:
+		return "possible fork"
+	default:
+		return "unknown"
+	}
+}
+
+// VerificationError is a failure of the equality verification classified for
+// the downloader and fetcher to act on the peer having sent the block. It
+// unwraps to the error of the failed check.
+type VerificationError struct {
+	Class VerificationClass
+	Err   error
+}
+
+// Error implements error.
+func (err *VerificationError) Error() string {
+	return err.Err.Error()
+}
+
+// Unwrap returns the error of the failed check.
+func (err *VerificationError) Unwrap() error {
+	return err.Err
+}
+
+// ProtocolViolation reports whether the peer having sent the block is to be
+// dropped.
+func (err *VerificationError) ProtocolViolation() bool {
+	return err.Class == ProtocolViolation
+}
+
+// PossibleFork reports whether the peer having sent the block may be on
+// another chain.
+func (err *VerificationError) PossibleFork() bool {
+	return err.Class == PossibleFork
+}
+
+// classify wraps err into a VerificationError of class, nil if err is nil.
+func classify(class VerificationClass, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &VerificationError{Class: class, Err: err}
+}
+
+// IsProtocolViolation reports whether err is a verification failure of class
+// ProtocolViolation.
+func IsProtocolViolation(err error) bool {
+	var verr *VerificationError
+	return errors.As(err, &verr) && verr.ProtocolViolation()
+}
+
+// IsPossibleFork reports whether err is a verification failure of class
+// PossibleFork.
+func IsPossibleFork(err error) bool {
+	var verr *VerificationError
+	return errors.As(err, &verr) && verr.PossibleFork()
+}
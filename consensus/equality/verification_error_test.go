@@ -0,0 +1,86 @@
+package equality
+
+import (
+	"crypto/ecdsa"
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/SecretBlockChain/go-secret/common"
+	"github.com/SecretBlockChain/go-secret/core/rawdb"
+	"github.com/SecretBlockChain/go-secret/core/types"
+	"github.com/SecretBlockChain/go-secret/crypto"
+	"github.com/SecretBlockChain/go-secret/params"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVerificationErrorClass(t *testing.T) {
+	key, _ := crypto.GenerateKey()
+	validator := crypto.PubkeyToAddress(key.PublicKey)
+	outsider, _ := crypto.GenerateKey()
+	config := *params.AllEthashProtocolChanges
+	config.Ethash = nil
+	config.Equality = &params.EqualityConfig{Epoch: 3, MaxValidatorsCount: 1, MinCandidateBalance: big.NewInt(0),
+		Validators: []common.Address{validator}}
+
+	chain, engine := newTestBlockChain(t, rawdb.NewMemoryDatabase(), &config, key)
+	_, err := chain.InsertChain(types.Blocks{sealTestBlock(t, chain, engine, key)})
+	assert.Nil(t, err)
+
+	// forge returns the next header with its header extra payload modified by
+	// update, sealed by signer
+	forge := func(update func(header *types.Header), signer *ecdsa.PrivateKey) *types.Header {
+		header := sealTestBlock(t, chain, engine, key).Header()
+		update(header)
+		signature, err := crypto.Sign(SealHash(header).Bytes(), signer)
+		assert.Nil(t, err)
+		copy(header.Extra[len(header.Extra)-ExtraSeal:], signature)
+		return header
+	}
+	reencode := func(update func(*HeaderExtra)) func(*types.Header) {
+		return func(header *types.Header) {
+			headerExtra, err := DecodeHeaderExtra(header)
+			assert.Nil(t, err)
+			update(&headerExtra)
+			header.Extra, err = EncodeHeaderExtra(header.Extra[:ExtraVanity], headerExtra)
+			assert.Nil(t, err)
+		}
+	}
+
+	tests := []struct {
+		name   string
+		header *types.Header
+		class  VerificationClass
+		cause  error
+	}{
+		{"undecodable header extra", forge(func(header *types.Header) {
+			garbage := append(append([]byte{}, header.Extra[:ExtraVanity]...), headerExtraVersion2, codecNone, 0xc3, 0x01)
+			header.Extra = append(garbage, make([]byte, ExtraSeal)...)
+		}, key), ProtocolViolation, errInvalidHeaderExtraRLP},
+		{"unauthorized signer", forge(reencode(func(*HeaderExtra) {}), outsider), ProtocolViolation, errUnauthorizedValidator},
+		{"root mismatch", forge(reencode(func(headerExtra *HeaderExtra) {
+			headerExtra.Root.MintCntHash = common.HexToHash("0x01")
+		}), key), PossibleFork, errInvalidRoot},
+	}
+	for _, test := range tests {
+		err := engine.VerifyHeader(chain, test.header, true)
+		var verr *VerificationError
+		if !assert.True(t, errors.As(err, &verr), "%s: %v", test.name, err) {
+			continue
+		}
+		assert.Equal(t, test.class, verr.Class, test.name)
+		assert.True(t, errors.Is(err, test.cause), "%s: %v", test.name, err)
+		assert.Equal(t, test.class == ProtocolViolation, IsProtocolViolation(err), test.name)
+		assert.Equal(t, test.class == PossibleFork, IsPossibleFork(err), test.name)
+	}
+
+	// Failures not telling of the peer are left unclassified
+	header := forge(func(header *types.Header) { header.MixDigest = common.HexToHash("0x01") }, key)
+	err = engine.VerifyHeader(chain, header, true)
+	assert.True(t, errors.Is(err, errInvalidMixDigest))
+	assert.False(t, IsProtocolViolation(err))
+	assert.False(t, IsPossibleFork(err))
+	assert.Nil(t, classify(PossibleFork, nil))
+	assert.Equal(t, "protocol violation", ProtocolViolation.String())
+	assert.Equal(t, "possible fork", PossibleFork.String())
+}
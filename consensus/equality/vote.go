@@ -0,0 +1,218 @@
+package equality
+
+import (
+	"bytes"
+	"fmt"
+	"math/big"
+	"sort"
+
+	"github.com/SecretBlockChain/go-secret/common"
+	"github.com/SecretBlockChain/go-secret/rlp"
+	"github.com/SecretBlockChain/go-secret/trie"
+)
+
+// delegatePrefix is the prefix of the delegate trie,
+// key: delegate-{delegatorAddr}:{Vote}
+var delegatePrefix = []byte("delegate-")
+
+// Vote is the delegation of a token holder to a candidate, weighted by the
+// balance of the delegator at the time of voting. The weight is locked out of
+// the balance until the vote is cancelled, the same coins count once whatever
+// accounts they move through.
+type Vote struct {
+	Delegator common.Address `json:"delegator"`
+	Candidate common.Address `json:"candidate"`
+	Weight    *big.Int       `json:"weight"`
+}
+
+// Equal compares two votes for equality.
+func (vote Vote) Equal(other Vote) bool {
+	if vote.Delegator != other.Delegator || vote.Candidate != other.Candidate {
+		return false
+	}
+	if vote.Weight == nil || other.Weight == nil {
+		return vote.Weight == other.Weight
+	}
+	return vote.Weight.Cmp(other.Weight) == 0
+}
+
+// String implements the fmt.Stringer interface.
+func (vote Vote) String() string {
+	return fmt.Sprintf("%s->%s:%v", vote.Delegator.String(), vote.Candidate.String(), vote.Weight)
+}
+
+// Vote records the vote of the delegator, replacing its previous vote.
+func (snap *Snapshot) Vote(vote Vote) error {
+	delegateTrie, err := snap.ensureTrie(delegatePrefix)
+	if err != nil {
+		return err
+	}
+
+	value, err := rlp.EncodeToBytes(vote)
+	if err != nil {
+		return err
+	}
+	return delegateTrie.TryUpdate(vote.Delegator.Bytes(), value)
+}
+
+// CancelVote removes the vote of the delegator, return a bool value means the
+// delegator has voted or not and the weight locked by its vote.
+func (snap *Snapshot) CancelVote(delegator common.Address) (bool, *big.Int, error) {
+	vote, err := snap.GetVote(delegator)
+	if err != nil || vote == nil {
+		return false, nil, err
+	}
+
+	delegateTrie, err := snap.ensureTrie(delegatePrefix)
+	if err != nil {
+		return false, nil, err
+	}
+	return true, vote.Weight, delegateTrie.TryDelete(delegator.Bytes())
+}
+
+// GetVote returns the vote of the delegator, nil if it has not voted.
+func (snap *Snapshot) GetVote(delegator common.Address) (*Vote, error) {
+	delegateTrie, err := snap.ensureTrie(delegatePrefix)
+	if err != nil {
+		return nil, err
+	}
+
+	value, err := delegateTrie.TryGet(delegator.Bytes())
+	if err != nil || value == nil {
+		return nil, err
+	}
+
+	var vote Vote
+	if err = rlp.DecodeBytes(value, &vote); err != nil {
+		return nil, err
+	}
+	return &vote, nil
+}
+
+// CountVotes returns the candidates weighted by the votes they received,
+// sorted in descending order by weight. Candidates without votes have zero
+// weight, votes for addresses not being candidates are ignored.
+func (snap *Snapshot) CountVotes() (SortableAddresses, error) {
+	candidates, err := snap.GetCandidates()
+	if err != nil {
+		return nil, err
+	}
+
+	weights := make(map[common.Address]*big.Int, len(candidates))
+	for address := range candidates {
+		weights[address] = new(big.Int)
+	}
+
+	delegateTrie, err := snap.ensureTrie(delegatePrefix)
+	if err != nil {
+		return nil, err
+	}
+	iter := trie.NewIterator(delegateTrie.NodeIterator(nil))
+	for iter.Next() {
+		var vote Vote
+		if err = rlp.DecodeBytes(iter.Value, &vote); err != nil {
+			return nil, err
+		}
+		if weight, ok := weights[vote.Candidate]; ok {
+			weight.Add(weight, vote.Weight)
+		}
+	}
+	if iter.Err != nil {
+		return nil, iter.Err
+	}
+
+	addresses := make(SortableAddresses, 0, len(weights))
+	for address, weight := range weights {
+		addresses = append(addresses, SortableAddress{Address: address, Weight: weight})
+	}
+	sort.Slice(addresses, func(i, j int) bool {
+		if cmp := addresses[i].Weight.Cmp(addresses[j].Weight); cmp != 0 {
+			return cmp > 0
+		}
+		return bytes.Compare(addresses[i].Address[:], addresses[j].Address[:]) < 0
+	})
+	return addresses, nil
+}
+
+// TopCandidates returns the n candidates with the most votes, ties are broken
+// by the lower address bytes.
+func (snap *Snapshot) TopCandidates(n int) ([]common.Address, error) {
+	return snap.topEligibleCandidates(n, nil)
+}
+
+// topEligibleCandidates returns the n candidates eligible with the most votes,
+// all of them if eligible is nil.
+func (snap *Snapshot) topEligibleCandidates(n int, eligible func(common.Address) bool) ([]common.Address, error) {
+	if n <= 0 {
+		return nil, nil
+	}
+
+	weighted, err := snap.CountVotes()
+	if err != nil {
+		return nil, err
+	}
+	if eligible != nil {
+		kept := weighted[:0]
+		for _, candidate := range weighted {
+			if eligible(candidate.Address) {
+				kept = append(kept, candidate)
+			}
+		}
+		weighted = kept
+	}
+	if len(weighted) > n {
+		weighted = weighted[:n]
+	}
+
+	candidates := make([]common.Address, 0, len(weighted))
+	for _, candidate := range weighted {
+		candidates = append(candidates, candidate.Address)
+	}
+	return candidates, nil
+}
+
+// Return a copy of a Vote slice sorted by delegator address bytes, the slice
+// itself if already sorted.
+func votesSort(slice []Vote) []Vote {
+	if votesSorted(slice) {
+		return slice
+	}
+
+	result := make([]Vote, len(slice))
+	copy(result, slice)
+	sort.Slice(result, func(i, j int) bool {
+		return bytes.Compare(result[i].Delegator[:], result[j].Delegator[:]) < 0
+	})
+	return result
+}
+
+// votesSorted returns whether a Vote slice is sorted by delegator address
+// bytes.
+func votesSorted(slice []Vote) bool {
+	for idx := 1; idx < len(slice); idx++ {
+		if bytes.Compare(slice[idx-1].Delegator[:], slice[idx].Delegator[:]) > 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// Returns the delegators of a Vote slice.
+func votesDelegators(slice []Vote) []common.Address {
+	delegators := make([]common.Address, 0, len(slice))
+	for _, vote := range slice {
+		delegators = append(delegators, vote.Delegator)
+	}
+	return delegators
+}
+
+// Return a copy of a Vote slice without the vote of the delegator.
+func votesRemove(slice []Vote, delegator common.Address) []Vote {
+	result := make([]Vote, 0, len(slice))
+	for _, vote := range slice {
+		if vote.Delegator != delegator {
+			result = append(result, vote)
+		}
+	}
+	return result
+}
@@ -0,0 +1,283 @@
+package equality
+
+import (
+	"crypto/ecdsa"
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/SecretBlockChain/go-secret/common"
+	"github.com/SecretBlockChain/go-secret/core/rawdb"
+	"github.com/SecretBlockChain/go-secret/core/state"
+	"github.com/SecretBlockChain/go-secret/core/types"
+	"github.com/SecretBlockChain/go-secret/crypto"
+	"github.com/SecretBlockChain/go-secret/params"
+	"github.com/SecretBlockChain/go-secret/rlp"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTopCandidates(t *testing.T) {
+	snap, err := newSnapshot(rawdb.NewMemoryDatabase())
+	assert.Nil(t, err)
+
+	candidate1 := common.HexToAddress("0x1000000000000000000000000000000000000001")
+	candidate2 := common.HexToAddress("0x2000000000000000000000000000000000000002")
+	candidate3 := common.HexToAddress("0x3000000000000000000000000000000000000003")
+	candidate4 := common.HexToAddress("0x4000000000000000000000000000000000000004")
+	for _, candidate := range []common.Address{candidate1, candidate2, candidate3, candidate4} {
+		_, err = snap.BecomeCandidate(candidate, 1, big.NewInt(0))
+		assert.Nil(t, err)
+	}
+
+	votes := []Vote{
+		{Delegator: common.HexToAddress("0xd1"), Candidate: candidate3, Weight: big.NewInt(10)},
+		{Delegator: common.HexToAddress("0xd2"), Candidate: candidate2, Weight: big.NewInt(10)},
+		{Delegator: common.HexToAddress("0xd3"), Candidate: candidate4, Weight: big.NewInt(5)},
+		{Delegator: common.HexToAddress("0xd4"), Candidate: candidate4, Weight: big.NewInt(4)},
+		// Votes for addresses not being candidates are ignored
+		{Delegator: common.HexToAddress("0xd5"), Candidate: common.HexToAddress("0x05"), Weight: big.NewInt(100)},
+	}
+	for _, vote := range votes {
+		assert.Nil(t, snap.Vote(vote))
+	}
+
+	// Ties are broken by address
+	candidates, err := snap.TopCandidates(3)
+	assert.Nil(t, err)
+	assert.Equal(t, []common.Address{candidate2, candidate3, candidate4}, candidates)
+
+	// Voting again replaces the previous vote
+	assert.Nil(t, snap.Vote(Vote{Delegator: common.HexToAddress("0xd1"), Candidate: candidate4, Weight: big.NewInt(10)}))
+	candidates, err = snap.TopCandidates(2)
+	assert.Nil(t, err)
+	assert.Equal(t, []common.Address{candidate4, candidate2}, candidates)
+
+	exist, _, err := snap.CancelVote(common.HexToAddress("0xd1"))
+	assert.Nil(t, err)
+	assert.True(t, exist)
+	exist, _, err = snap.CancelVote(common.HexToAddress("0xd1"))
+	assert.Nil(t, err)
+	assert.False(t, exist)
+
+	weighted, err := snap.CountVotes()
+	assert.Nil(t, err)
+	assert.Len(t, weighted, 4)
+	assert.Equal(t, SortableAddress{Address: candidate2, Weight: big.NewInt(10)}, weighted[0])
+	assert.Equal(t, SortableAddress{Address: candidate4, Weight: big.NewInt(9)}, weighted[1])
+	assert.Equal(t, SortableAddress{Address: candidate1, Weight: big.NewInt(0)}, weighted[2])
+	assert.Equal(t, SortableAddress{Address: candidate3, Weight: big.NewInt(0)}, weighted[3])
+}
+
+func TestHeaderExtraVotesEncoding(t *testing.T) {
+	// Without votes Root and HeaderExtra encode as before delegated voting
+	root := Root{
+		EpochHash:     common.HexToHash("0x01"),
+		CandidateHash: common.HexToHash("0x02"),
+		MintCntHash:   common.HexToHash("0x03"),
+		ConfigHash:    common.HexToHash("0x04"),
+	}
+	legacy := []common.Hash{root.EpochHash, root.CandidateHash, root.MintCntHash, root.ConfigHash}
+	have, err := rlp.EncodeToBytes(root)
+	assert.Nil(t, err)
+	want, err := rlp.EncodeToBytes(legacy)
+	assert.Nil(t, err)
+	assert.Equal(t, want, have)
+
+	type headerExtraLegacy struct {
+		Root                          []common.Hash
+		Epoch                         uint64
+		EpochBlock                    uint64
+		CurrentBlockCandidates        []common.Address
+		CurrentBlockKickOutCandidates []common.Address
+		CurrentBlockCancelCandidates  []common.Address
+		CurrentEpochValidators        []common.Address
+		ChainConfig                   []params.EqualityConfig
+	}
+	headerExtra := HeaderExtra{Root: root, Epoch: 2, EpochBlock: 180}
+	have, err = rlp.EncodeToBytes(headerExtra)
+	assert.Nil(t, err)
+	want, err = rlp.EncodeToBytes(headerExtraLegacy{Root: legacy, Epoch: 2, EpochBlock: 180})
+	assert.Nil(t, err)
+	assert.Equal(t, want, have)
+
+	// With votes the extension round trips
+	headerExtra.Root.DelegateHash = common.HexToHash("0x05")
+	headerExtra.CurrentBlockVotes = []Vote{
+		{Delegator: common.HexToAddress("0xd2"), Candidate: common.HexToAddress("0x02"), Weight: big.NewInt(2)},
+		{Delegator: common.HexToAddress("0xd1"), Candidate: common.HexToAddress("0x01"), Weight: big.NewInt(1)},
+	}
+	headerExtra.CurrentBlockCancelVotes = []common.Address{common.HexToAddress("0xd3")}
+	data, err := headerExtra.Encode()
+	assert.Nil(t, err)
+	decoded, err := NewHeaderExtra(data)
+	assert.Nil(t, err)
+	assert.True(t, decoded.Equal(headerExtra))
+	assert.Equal(t, common.HexToAddress("0xd1"), decoded.CurrentBlockVotes[0].Delegator)
+	assert.Nil(t, decoded.Validate(180, params.EqualityConfig{}))
+
+	headerExtra.CurrentBlockCancelVotes = append(headerExtra.CurrentBlockCancelVotes, common.HexToAddress("0xd1"))
+	assert.True(t, errors.Is(headerExtra.Validate(180, params.EqualityConfig{}), errDuplicateAddress))
+}
+
+// newVoteTestTransaction returns a custom transaction signed by key.
+func newVoteTestTransaction(t *testing.T, key *ecdsa.PrivateKey, data string) *types.Transaction {
+	tx := types.NewTransaction(1, common.Address{}, big.NewInt(0), 99999999, big.NewInt(1000), []byte(data))
+	tx, err := types.SignTx(tx, types.HomesteadSigner{}, key)
+	assert.Nil(t, err)
+	return tx
+}
+
+func TestProcessVoteTransactions(t *testing.T) {
+	candidate := common.HexToAddress("0x1000000000000000000000000000000000000001")
+	key1, _ := crypto.GenerateKey()
+	key2, _ := crypto.GenerateKey()
+	key3, _ := crypto.GenerateKey()
+	delegator1 := crypto.PubkeyToAddress(key1.PublicKey)
+	delegator2 := crypto.PubkeyToAddress(key2.PublicKey)
+	delegator3 := crypto.PubkeyToAddress(key3.PublicKey)
+
+	db := rawdb.NewMemoryDatabase()
+	statedb, err := state.New(common.Hash{}, state.NewDatabase(db), nil)
+	assert.Nil(t, err)
+	statedb.AddBalance(delegator1, big.NewInt(100))
+	statedb.AddBalance(delegator2, big.NewInt(200))
+
+	newParent := func() *Snapshot {
+		snap, err := newSnapshot(db)
+		assert.Nil(t, err)
+		_, err = snap.BecomeCandidate(candidate, 1, big.NewInt(0))
+		assert.Nil(t, err)
+		return snap
+	}
+	txs := []*types.Transaction{
+		newVoteTestTransaction(t, key1, "equality:1:event:vote:"+candidate.Hex()),
+		newVoteTestTransaction(t, key2, "equality:1:event:vote:"+candidate.Hex()),
+		newVoteTestTransaction(t, key2, "equality:1:event:unvote"),
+		// Without balance, or for an address not being a candidate
+		newVoteTestTransaction(t, key3, "equality:1:event:vote:"+candidate.Hex()),
+		newVoteTestTransaction(t, key1, "equality:1:event:vote:0x0000000000000000000000000000000000000005"),
+	}
+
+	config := params.EqualityConfig{Epoch: 30, MinCandidateBalance: big.NewInt(1), DelegatedVoting: true}
+	e := New(&config, db)
+	header := &types.Header{Number: big.NewInt(10)}
+	snap := newParent()
+	headerExtra := HeaderExtra{Epoch: 1, EpochBlock: 1}
+	e.processTransactions(config, statedb, header, snap, &headerExtra, txs)
+
+	assert.Equal(t, []Vote{{Delegator: delegator1, Candidate: candidate, Weight: big.NewInt(100)}}, headerExtra.CurrentBlockVotes)
+	assert.Equal(t, []common.Address{delegator2}, headerExtra.CurrentBlockCancelVotes)
+	assert.Zero(t, statedb.GetBalance(delegator1).Sign())
+	assert.Equal(t, big.NewInt(200), statedb.GetBalance(delegator2))
+	vote, err := snap.GetVote(delegator3)
+	assert.Nil(t, err)
+	assert.Nil(t, vote)
+
+	// Replaying the header extra reaches the same delegate trie
+	replayed := newParent()
+	assert.Nil(t, replayed.apply(config, header, headerExtra))
+	assert.Nil(t, snap.MintBlock(headerExtra.Epoch, 10, header.Coinbase))
+	have, err := replayed.Root()
+	assert.Nil(t, err)
+	want, err := snap.Root()
+	assert.Nil(t, err)
+	assert.Equal(t, want, have)
+	assert.NotEqual(t, common.Hash{}, have.DelegateHash)
+
+	// Votes are ignored without delegated voting
+	config.DelegatedVoting = false
+	snap = newParent()
+	headerExtra = HeaderExtra{Epoch: 1, EpochBlock: 1}
+	e.processTransactions(config, statedb, header, snap, &headerExtra, txs)
+	assert.Empty(t, headerExtra.CurrentBlockVotes)
+	assert.Empty(t, headerExtra.CurrentBlockCancelVotes)
+	root, err := snap.Root()
+	assert.Nil(t, err)
+	assert.Equal(t, common.Hash{}, root.DelegateHash)
+}
+
+func TestVoteWeightCountsOnce(t *testing.T) {
+	candidate := common.HexToAddress("0x1000000000000000000000000000000000000001")
+	key1, _ := crypto.GenerateKey()
+	key2, _ := crypto.GenerateKey()
+	delegator1 := crypto.PubkeyToAddress(key1.PublicKey)
+	delegator2 := crypto.PubkeyToAddress(key2.PublicKey)
+
+	db := rawdb.NewMemoryDatabase()
+	statedb, err := state.New(common.Hash{}, state.NewDatabase(db), nil)
+	assert.Nil(t, err)
+	statedb.AddBalance(delegator1, big.NewInt(100))
+	snap, err := newSnapshot(db)
+	assert.Nil(t, err)
+	_, err = snap.BecomeCandidate(candidate, 1, big.NewInt(0))
+	assert.Nil(t, err)
+
+	config := params.EqualityConfig{Epoch: 30, MinCandidateBalance: big.NewInt(1), DelegatedVoting: true}
+	e := New(&config, db)
+	process := func(number int64, txs ...*types.Transaction) {
+		headerExtra := HeaderExtra{Epoch: 1, EpochBlock: 1}
+		e.processTransactions(config, statedb, &types.Header{Number: big.NewInt(number)}, snap, &headerExtra, txs)
+	}
+	weight := func() *big.Int {
+		weighted, err := snap.CountVotes()
+		assert.Nil(t, err)
+		assert.Len(t, weighted, 1)
+		return weighted[0].Weight
+	}
+
+	// The balance voted with is locked, nothing is left to transfer and vote
+	// again with
+	process(10, newVoteTestTransaction(t, key1, "equality:1:event:vote:"+candidate.Hex()))
+	statedb.AddBalance(delegator2, statedb.GetBalance(delegator1))
+	statedb.SetBalance(delegator1, new(big.Int))
+	process(11, newVoteTestTransaction(t, key2, "equality:1:event:vote:"+candidate.Hex()))
+	assert.Equal(t, big.NewInt(100), weight())
+
+	// Once the vote is cancelled the balance moves on and counts for the
+	// other delegator only
+	process(12, newVoteTestTransaction(t, key1, "equality:1:event:unvote"))
+	assert.Equal(t, big.NewInt(100), statedb.GetBalance(delegator1))
+	statedb.AddBalance(delegator2, statedb.GetBalance(delegator1))
+	statedb.SetBalance(delegator1, new(big.Int))
+	process(13,
+		newVoteTestTransaction(t, key2, "equality:1:event:vote:"+candidate.Hex()),
+		newVoteTestTransaction(t, key1, "equality:1:event:vote:"+candidate.Hex()))
+	assert.Equal(t, big.NewInt(100), weight())
+	vote, err := snap.GetVote(delegator1)
+	assert.Nil(t, err)
+	assert.Nil(t, vote)
+
+	// Voting again adds the balance received since to the locked weight
+	statedb.AddBalance(delegator2, big.NewInt(50))
+	process(14, newVoteTestTransaction(t, key2, "equality:1:event:vote:"+candidate.Hex()))
+	assert.Equal(t, big.NewInt(150), weight())
+	assert.Zero(t, statedb.GetBalance(delegator2).Sign())
+}
+
+func TestTryElectDelegatedVoting(t *testing.T) {
+	snap, err := newSnapshot(rawdb.NewMemoryDatabase())
+	assert.Nil(t, err)
+
+	var candidates []common.Address
+	for i := 1; i <= 5; i++ {
+		candidate := common.BigToAddress(big.NewInt(int64(i)))
+		candidates = append(candidates, candidate)
+		_, err = snap.BecomeCandidate(candidate, 1, big.NewInt(0))
+		assert.Nil(t, err)
+		vote := Vote{Delegator: common.BigToAddress(big.NewInt(int64(100 + i))), Candidate: candidate, Weight: big.NewInt(int64(i))}
+		assert.Nil(t, snap.Vote(vote))
+	}
+
+	// The validators of the last epoch sealed enough blocks to stay
+	assert.Nil(t, snap.SetValidators(candidates[:3]))
+	for number := uint64(1); number <= 30; number++ {
+		assert.Nil(t, snap.MintBlock(1, number, candidates[number%3]))
+	}
+
+	config := params.EqualityConfig{Epoch: 30, MaxValidatorsCount: 3, DelegatedVoting: true}
+	e := New(&config, rawdb.NewMemoryDatabase())
+	header := &types.Header{Number: big.NewInt(31), ParentHash: common.HexToHash("0x01")}
+	headerExtra := HeaderExtra{Epoch: 2, EpochBlock: 31}
+	assert.Nil(t, e.tryElect(config, nil, header, snap, &headerExtra, nil))
+	assert.Equal(t, []common.Address{candidates[4], candidates[3], candidates[2]}, headerExtra.CurrentEpochValidators)
+}
@@ -214,6 +214,9 @@ func GenerateChain(config *params.ChainConfig, parent *types.Block, engine conse
 		if b.engine != nil {
 			// Finalize and seal the block
 			block, _ := b.engine.FinalizeAndAssemble(chainreader, b.header, statedb, b.txs, b.uncles, b.receipts)
+			if logs := statedb.GetLogs(common.Hash{}); len(logs) > 0 {
+				b.receipts = append(b.receipts, types.NewSystemReceipt(logs, block.GasUsed()))
+			}
 
 			// Write state changes to db
 			root, err := statedb.Commit(config.IsEIP158(b.header.Number))
@@ -78,6 +78,15 @@ func (p *StateProcessor) Process(block *types.Block, statedb *state.StateDB, cfg
 	// Finalize the block, applying any consensus engine specific extras (e.g. block rewards)
 	p.engine.Finalize(p.bc, header, statedb, block.Transactions(), block.Uncles())
 
+	// Collect the logs emitted by the engine while finalizing into a trailing receipt
+	if logs := statedb.GetLogs(common.Hash{}); len(logs) > 0 {
+		receipt := types.NewSystemReceipt(logs, *usedGas)
+		receipt.BlockHash = block.Hash()
+		receipt.BlockNumber = header.Number
+		receipt.TransactionIndex = uint(len(receipts))
+		receipts = append(receipts, receipt)
+		allLogs = append(allLogs, logs...)
+	}
 	return receipts, allLogs, *usedGas, nil
 }
 
@@ -124,6 +124,15 @@ func NewReceipt(root []byte, failed bool, cumulativeGasUsed uint64) *Receipt {
 	return r
 }
 
+// NewSystemReceipt creates a receipt for the logs a consensus engine emits while
+// finalizing a block. It follows the receipts of the block's transactions and
+// has no transaction of its own.
+func NewSystemReceipt(logs []*Log, cumulativeGasUsed uint64) *Receipt {
+	r := &Receipt{Status: ReceiptStatusSuccessful, CumulativeGasUsed: cumulativeGasUsed, Logs: logs}
+	r.Bloom = CreateBloom(Receipts{r})
+	return r
+}
+
 // EncodeRLP implements rlp.Encoder, and flattens the consensus fields of a receipt
 // into an RLP stream. If no post state is present, byzantium fork is assumed.
 func (r *Receipt) EncodeRLP(w io.Writer) error {
@@ -298,12 +307,15 @@ func (r Receipts) DeriveFields(config *params.ChainConfig, hash common.Hash, num
 	signer := MakeSigner(config, new(big.Int).SetUint64(number))
 
 	logIndex := uint(0)
-	if len(txs) != len(r) {
+	if len(txs) != len(r) && len(txs)+1 != len(r) {
 		return errors.New("transaction and receipt count mismatch")
 	}
 	for i := 0; i < len(r); i++ {
-		// The transaction hash can be retrieved from the transaction itself
-		r[i].TxHash = txs[i].Hash()
+		// The transaction hash can be retrieved from the transaction itself,
+		// a trailing system receipt has none
+		if i < len(txs) {
+			r[i].TxHash = txs[i].Hash()
+		}
 
 		// block location fields
 		r[i].BlockHash = hash
@@ -311,7 +323,7 @@ func (r Receipts) DeriveFields(config *params.ChainConfig, hash common.Hash, num
 		r[i].TransactionIndex = uint(i)
 
 		// The contract address can be derived from the transaction itself
-		if txs[i].To() == nil {
+		if i < len(txs) && txs[i].To() == nil {
 			// Deriving the signer is expensive, only do if it's actually needed
 			from, _ := Sender(signer, txs[i])
 			r[i].ContractAddress = crypto.CreateAddress(from, txs[i].Nonce())
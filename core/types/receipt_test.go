@@ -243,6 +243,37 @@ func TestDeriveFields(t *testing.T) {
 	}
 }
 
+func TestDeriveFieldsSystemReceipt(t *testing.T) {
+	txs := Transactions{
+		NewTransaction(1, common.HexToAddress("0x1"), big.NewInt(1), 1, big.NewInt(1), nil),
+	}
+	receipts := Receipts{
+		&Receipt{Status: ReceiptStatusSuccessful, CumulativeGasUsed: 1, Logs: []*Log{{Address: common.BytesToAddress([]byte{0x11})}}},
+		NewSystemReceipt([]*Log{{Address: common.BytesToAddress([]byte{0x22})}}, 1),
+	}
+	hash := common.BytesToHash([]byte{0x03, 0x14})
+	if err := receipts.DeriveFields(params.TestChainConfig, hash, 1, txs); err != nil {
+		t.Fatalf("DeriveFields(...) = %v, want <nil>", err)
+	}
+
+	system := receipts[1]
+	if system.TxHash != (common.Hash{}) || system.TransactionIndex != 1 || system.GasUsed != 0 {
+		t.Errorf("system receipt = %+v, want no transaction at index 1 using no gas", system)
+	}
+	if log := system.Logs[0]; log.BlockHash != hash || log.TxIndex != 1 || log.Index != 1 {
+		t.Errorf("system log = %+v, want block %s, index 1", log, hash.String())
+	}
+	if !system.Bloom.Test(common.BytesToAddress([]byte{0x22}).Bytes()) {
+		t.Errorf("system receipt bloom misses the log address")
+	}
+
+	// Only a single trailing receipt is allowed
+	receipts = append(receipts, NewSystemReceipt(nil, 1))
+	if err := receipts.DeriveFields(params.TestChainConfig, hash, 1, txs); err == nil {
+		t.Fatalf("DeriveFields(...) = <nil>, want count mismatch")
+	}
+}
+
 func clearComputedFieldsOnReceipts(t *testing.T, receipts Receipts) {
 	t.Helper()
 
@@ -30,6 +30,7 @@ import (
 
 	"github.com/SecretBlockChain/go-secret/common"
 	"github.com/SecretBlockChain/go-secret/common/hexutil"
+	"github.com/SecretBlockChain/go-secret/consensus/equality"
 	"github.com/SecretBlockChain/go-secret/core"
 	"github.com/SecretBlockChain/go-secret/core/rawdb"
 	"github.com/SecretBlockChain/go-secret/core/state"
@@ -125,6 +126,9 @@ func (api *PrivateMinerAPI) SetExtra(extra string) (bool, error) {
 	if err := api.e.Miner().SetExtra([]byte(extra)); err != nil {
 		return false, err
 	}
+	if engine, ok := api.e.engine.(*equality.Equality); ok {
+		engine.SetVanity([]byte(extra))
+	}
 	return true, nil
 }
 
@@ -66,6 +66,10 @@ func (b *EthAPIBackend) HeaderByNumber(ctx context.Context, number rpc.BlockNumb
 		block := b.eth.miner.PendingBlock()
 		return block.Header(), nil
 	}
+	// Finalized block is only known by engines tracking finality
+	if number == rpc.FinalizedBlockNumber {
+		return b.finalizedHeader()
+	}
 	// Otherwise resolve and return the block
 	if number == rpc.LatestBlockNumber {
 		return b.eth.blockchain.CurrentBlock().Header(), nil
@@ -73,6 +77,20 @@ func (b *EthAPIBackend) HeaderByNumber(ctx context.Context, number rpc.BlockNumb
 	return b.eth.blockchain.GetHeaderByNumber(uint64(number)), nil
 }
 
+// finalizedHeader returns the header of the finalized block of the consensus
+// engine.
+func (b *EthAPIBackend) finalizedHeader() (*types.Header, error) {
+	engine, ok := b.eth.engine.(consensus.Finality)
+	if !ok {
+		return nil, errors.New("finalized block not supported by the consensus engine")
+	}
+	header := engine.FinalizedHeader(b.eth.blockchain)
+	if header == nil {
+		return nil, errors.New("finalized block not found")
+	}
+	return header, nil
+}
+
 func (b *EthAPIBackend) HeaderByNumberOrHash(ctx context.Context, blockNrOrHash rpc.BlockNumberOrHash) (*types.Header, error) {
 	if blockNr, ok := blockNrOrHash.Number(); ok {
 		return b.HeaderByNumber(ctx, blockNr)
@@ -100,6 +118,13 @@ func (b *EthAPIBackend) BlockByNumber(ctx context.Context, number rpc.BlockNumbe
 		block := b.eth.miner.PendingBlock()
 		return block, nil
 	}
+	if number == rpc.FinalizedBlockNumber {
+		header, err := b.finalizedHeader()
+		if err != nil {
+			return nil, err
+		}
+		return b.eth.blockchain.GetBlock(header.Hash(), header.Number.Uint64()), nil
+	}
 	// Otherwise resolve and return the block
 	if number == rpc.LatestBlockNumber {
 		return b.eth.blockchain.CurrentBlock(), nil
@@ -303,6 +328,10 @@ func (b *EthAPIBackend) RPCTxFeeCap() float64 {
 	return b.eth.config.RPCTxFeeCap
 }
 
+func (b *EthAPIBackend) RPCEqualityBlocks() bool {
+	return b.eth.config.RPCEqualityBlocks
+}
+
 func (b *EthAPIBackend) BloomStatus() (uint64, uint64) {
 	sections, _, _ := b.eth.bloomIndexer.Sections()
 	return params.BloomBitsBlocks, sections
@@ -30,6 +30,7 @@ import (
 
 	"github.com/SecretBlockChain/go-secret/common"
 	"github.com/SecretBlockChain/go-secret/common/hexutil"
+	"github.com/SecretBlockChain/go-secret/consensus/equality"
 	"github.com/SecretBlockChain/go-secret/core"
 	"github.com/SecretBlockChain/go-secret/core/rawdb"
 	"github.com/SecretBlockChain/go-secret/core/state"
@@ -861,3 +862,62 @@ func (api *PrivateDebugAPI) computeTxEnv(block *types.Block, txIndex int, reexec
 	}
 	return nil, vm.Context{}, nil, fmt.Errorf("transaction index %d out of range for block %#x", txIndex, block.Hash())
 }
+
+// PrivateEqualityTracerAPI is the collection of tracing APIs exposed over the
+// private equality endpoint, tracing the state changes the equality engine
+// applies at the finalization of a block.
+type PrivateEqualityTracerAPI struct {
+	debug  *PrivateDebugAPI
+	engine *equality.Equality
+}
+
+// NewPrivateEqualityTracerAPI creates a new API definition for the equality
+// tracing methods of the Ethereum service.
+func NewPrivateEqualityTracerAPI(eth *Ethereum, engine *equality.Equality) *PrivateEqualityTracerAPI {
+	return &PrivateEqualityTracerAPI{debug: NewPrivateDebugAPI(eth), engine: engine}
+}
+
+// TraceBlock returns the system operations of the block of number, the
+// rewards, deposits, refunds and slashes the equality engine applied after
+// its transactions, each with the reason of the change.
+func (api *PrivateEqualityTracerAPI) TraceBlock(ctx context.Context, number rpc.BlockNumber, config *TraceConfig) ([]equality.SystemOperation, error) {
+	var block *types.Block
+	blockchain := api.debug.eth.blockchain
+	switch number {
+	case rpc.PendingBlockNumber:
+		block = api.debug.eth.miner.PendingBlock()
+	case rpc.LatestBlockNumber:
+		block = blockchain.CurrentBlock()
+	default:
+		block = blockchain.GetBlockByNumber(uint64(number))
+	}
+	if block == nil {
+		return nil, fmt.Errorf("block #%d not found", number)
+	}
+	parent := blockchain.GetBlock(block.ParentHash(), block.NumberU64()-1)
+	if parent == nil {
+		return nil, fmt.Errorf("parent %#x not found", block.ParentHash())
+	}
+	reexec := defaultTraceReexec
+	if config != nil && config.Reexec != nil {
+		reexec = *config.Reexec
+	}
+	statedb, err := api.debug.computeStateDB(parent, reexec)
+	if err != nil {
+		return nil, err
+	}
+
+	// Execute the transactions, the system operations follow them
+	var (
+		header  = block.Header()
+		usedGas = new(uint64)
+		gp      = new(core.GasPool).AddGas(block.GasLimit())
+	)
+	for idx, tx := range block.Transactions() {
+		statedb.Prepare(tx.Hash(), block.Hash(), idx)
+		if _, err := core.ApplyTransaction(blockchain.Config(), blockchain, nil, gp, statedb, header, tx, usedGas, vm.Config{}); err != nil {
+			return nil, fmt.Errorf("transaction %#x failed: %v", tx.Hash(), err)
+		}
+	}
+	return api.engine.TraceSystemOperations(blockchain, header, statedb, block.Transactions())
+}
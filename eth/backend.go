@@ -183,6 +183,21 @@ func New(stack *node.Node, config *Config) (*Ethereum, error) {
 		rawdb.WriteChainConfig(chainDb, genesisHash, chainConfig)
 	}
 	eth.bloomIndexer.Start(eth.blockchain)
+	if engine, ok := eth.engine.(*equality.Equality); ok {
+		if err := engine.VerifyGenesis(eth.blockchain.Genesis().Header()); err != nil {
+			return nil, fmt.Errorf("invalid equality genesis: %w", err)
+		}
+		if config.EqualityCheckpoint != "" {
+			checkpoint, err := equality.LoadTrustedCheckpoint(stack.ResolvePath(config.EqualityCheckpoint))
+			if err != nil {
+				return nil, err
+			}
+			if err = engine.SetTrustedCheckpoint(checkpoint); err != nil {
+				return nil, fmt.Errorf("invalid equality checkpoint: %w", err)
+			}
+		}
+		engine.SetEventMux(eth.eventMux)
+	}
 
 	if config.TxPool.Journal != "" {
 		config.TxPool.Journal = stack.ResolvePath(config.TxPool.Journal)
@@ -200,6 +215,19 @@ func New(stack *node.Node, config *Config) (*Ethereum, error) {
 	}
 	eth.miner = miner.New(eth, &config.Miner, chainConfig, eth.EventMux(), eth.engine, eth.isLocalBlock)
 	eth.miner.SetExtra(makeExtraData(config.Miner.ExtraData))
+	if engine, ok := eth.engine.(*equality.Equality); ok {
+		engine.SetVanity(makeExtraData(config.Miner.ExtraData))
+		engine.SetMaxClockSkew(config.Miner.MaxClockSkew)
+		engine.SetPendingHeader(func() *types.Header {
+			if !eth.miner.Mining() {
+				return nil
+			}
+			if block := eth.miner.PendingBlock(); block != nil {
+				return block.Header()
+			}
+			return nil
+		})
+	}
 
 	eth.APIBackend = &EthAPIBackend{stack.Config().ExtRPCEnabled(), eth, nil}
 	gpoParams := config.GPO
@@ -282,6 +310,13 @@ func (s *Ethereum) APIs() []rpc.API {
 
 	// Append any APIs exposed explicitly by the consensus engine
 	apis = append(apis, s.engine.APIs(s.BlockChain())...)
+	if engine, ok := s.engine.(*equality.Equality); ok {
+		apis = append(apis, rpc.API{
+			Namespace: "equality",
+			Version:   "1.0",
+			Service:   NewPrivateEqualityTracerAPI(s, engine),
+		})
+	}
 
 	// Append all the local APIs and return
 	return append(apis, []rpc.API{
@@ -439,6 +474,15 @@ func (s *Ethereum) SetEtherbase(etherbase common.Address) {
 	s.etherbase = etherbase
 	s.lock.Unlock()
 
+	// Switch the equality signer of a running miner to the new etherbase
+	if equality, ok := s.engine.(*equality.Equality); ok && s.IsMining() {
+		wallet, err := s.accountManager.Find(accounts.Account{Address: etherbase})
+		if wallet == nil || err != nil {
+			log.Error("Etherbase account unavailable locally", "err", err)
+		} else {
+			equality.Authorize(etherbase, wallet.SignData)
+		}
+	}
 	s.miner.SetEtherbase(etherbase)
 }
 
@@ -547,6 +591,13 @@ func (s *Ethereum) Start() error {
 	// Start the bloom bits servicing goroutines
 	s.startBloomHandlers(params.BloomBitsBlocks)
 
+	// Follow the epoch transitions of the equality engine
+	if engine, ok := s.engine.(*equality.Equality); ok {
+		heads := make(chan core.ChainHeadEvent, chainHeadChanSize)
+		sub := s.blockchain.SubscribeChainHeadEvent(heads)
+		go s.followEpochs(engine, heads, sub)
+	}
+
 	// Figure out a max peers count based on the server limits
 	maxPeers := s.p2pServer.MaxPeers
 	if s.config.LightServ > 0 {
@@ -560,6 +611,36 @@ func (s *Ethereum) Start() error {
 	return nil
 }
 
+// followEpochs forwards the canonical chain heads to the equality engine, which
+// notifies its epoch listeners and subscribers of the epoch transitions,
+// indexes the epoch transitions and the header extras of the ancient blocks
+// and tracks the finalized block.
+func (s *Ethereum) followEpochs(engine *equality.Equality, heads chan core.ChainHeadEvent, sub event.Subscription) {
+	defer sub.Unsubscribe()
+
+	follow := func(head *types.Header) {
+		engine.NewChainHead(s.blockchain, head)
+		if _, err := engine.IndexEpochs(s.blockchain, head); err != nil {
+			log.Warn("Failed to index equality epochs", "number", head.Number, "err", err)
+		}
+		if _, err := engine.IndexHeaderExtras(s.blockchain, head); err != nil {
+			log.Warn("Failed to index equality header extras", "number", head.Number, "err", err)
+		}
+		if err := engine.TrackFinality(s.blockchain, head); err != nil {
+			log.Warn("Failed to track equality finality", "number", head.Number, "err", err)
+		}
+	}
+	follow(s.blockchain.CurrentHeader())
+	for {
+		select {
+		case ev := <-heads:
+			follow(ev.Block.Header())
+		case <-sub.Err():
+			return
+		}
+	}
+}
+
 // Stop implements node.Lifecycle, terminating all internal goroutines used by the
 // Ethereum protocol.
 func (s *Ethereum) Stop() error {
@@ -181,6 +181,14 @@ type Config struct {
 	// send-transction variants. The unit is ether.
 	RPCTxFeeCap float64 `toml:",omitempty"`
 
+	// RPCEqualityBlocks augments the blocks returned over rpc with the fields
+	// decoded from their equality header extras.
+	RPCEqualityBlocks bool `toml:",omitempty"`
+
+	// EqualityCheckpoint is the json file of a trusted equality checkpoint,
+	// the headers up to which are not verified.
+	EqualityCheckpoint string `toml:",omitempty"`
+
 	// Checkpoint is a hardcoded checkpoint which can be nil.
 	Checkpoint *params.TrustedCheckpoint `toml:",omitempty"`
 
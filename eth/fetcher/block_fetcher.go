@@ -97,6 +97,28 @@ type chainInsertFn func(types.Blocks) (int, error)
 // peerDropFn is a callback type for dropping a peer detected as malicious.
 type peerDropFn func(id string)
 
+// verificationFault is implemented by the verification errors of the consensus
+// engines classifying their failures by what they tell of the peer having sent
+// the block, e.g. the ones of equality.
+type verificationFault interface {
+	ProtocolViolation() bool // No honest peer sends the block, the peer is dropped
+	PossibleFork() bool      // The block may be valid on another chain, the peer is kept
+}
+
+// isProtocolViolation reports whether err classifies the block as one no honest
+// peer sends.
+func isProtocolViolation(err error) bool {
+	var fault verificationFault
+	return errors.As(err, &fault) && fault.ProtocolViolation()
+}
+
+// isPossibleFork reports whether err classifies the block as one possibly valid
+// on a chain other than the local one.
+func isPossibleFork(err error) bool {
+	var fault verificationFault
+	return errors.As(err, &fault) && fault.PossibleFork()
+}
+
 // blockAnnounce is the hash notification of the availability of a new block in the
 // network.
 type blockAnnounce struct {
@@ -758,10 +780,13 @@ func (f *BlockFetcher) importHeaders(peer string, header *types.Header) {
 			log.Debug("Unknown parent of propagated header", "peer", peer, "number", header.Number, "hash", hash, "parent", header.ParentHash)
 			return
 		}
-		// Validate the header and if something went wrong, drop the peer
+		// Validate the header and if something went wrong, drop the peer unless
+		// it may be on another fork
 		if err := f.verifyHeader(header); err != nil && err != consensus.ErrFutureBlock {
 			log.Debug("Propagated header verification failed", "peer", peer, "number", header.Number, "hash", hash, "err", err)
-			f.dropPeer(peer)
+			if !isPossibleFork(err) {
+				f.dropPeer(peer)
+			}
 			return
 		}
 		// Run the actual import and log any issues
@@ -804,14 +829,21 @@ func (f *BlockFetcher) importBlocks(peer string, block *types.Block) {
 			// Weird future block, don't fail, but neither propagate
 
 		default:
-			// Something went very wrong, drop the peer
+			// Something went very wrong, drop the peer unless it may be on
+			// another fork
 			log.Debug("Propagated block verification failed", "peer", peer, "number", block.Number(), "hash", hash, "err", err)
-			f.dropPeer(peer)
+			if !isPossibleFork(err) {
+				f.dropPeer(peer)
+			}
 			return
 		}
-		// Run the actual import and log any issues
+		// Run the actual import and log any issues, dropping the peer if the
+		// block violates the consensus protocol
 		if _, err := f.insertChain(types.Blocks{block}); err != nil {
 			log.Debug("Propagated block import failed", "peer", peer, "number", block.Number(), "hash", hash, "err", err)
+			if isProtocolViolation(err) {
+				f.dropPeer(peer)
+			}
 			return
 		}
 		// If import succeeded, broadcast the block
@@ -25,6 +25,7 @@ import (
 	"time"
 
 	"github.com/SecretBlockChain/go-secret/common"
+	"github.com/SecretBlockChain/go-secret/consensus/equality"
 	"github.com/SecretBlockChain/go-secret/consensus/ethash"
 	"github.com/SecretBlockChain/go-secret/core"
 	"github.com/SecretBlockChain/go-secret/core/rawdb"
@@ -879,3 +880,52 @@ func TestBlockMemoryExhaustionAttack(t *testing.T) {
 	}
 	verifyImportDone(t, imported)
 }
+
+// Tests that the peers propagating blocks failing the consensus verification
+// are dropped on a protocol violation, and kept if the block may be valid on
+// another fork.
+func TestVerificationFaultPeerDrop(t *testing.T) {
+	hashes, blocks := makeChain(1, 0, genesis)
+	block := blocks[hashes[0]]
+
+	violation := &equality.VerificationError{Class: equality.ProtocolViolation, Err: errors.New("unauthorized")}
+	fork := &equality.VerificationError{Class: equality.PossibleFork, Err: errors.New("invalid trie root")}
+	tests := []struct {
+		verifyErr error
+		insertErr error
+		dropped   bool
+	}{
+		{nil, nil, false},
+		{errors.New("invalid mix digest"), nil, true},
+		{violation, nil, true},
+		{fork, nil, false},
+		{nil, errors.New("invalid merkle root"), false},
+		{nil, violation, true},
+		{nil, fork, false},
+	}
+	for i, tt := range tests {
+		// The fetcher isn't started, the test reads the done notifications of
+		// the imports itself
+		tester := &fetcherTester{
+			hashes:  []common.Hash{genesis.Hash()},
+			headers: map[common.Hash]*types.Header{genesis.Hash(): genesis.Header()},
+			blocks:  map[common.Hash]*types.Block{genesis.Hash(): genesis},
+			drops:   make(map[string]bool),
+		}
+		fetcher := NewBlockFetcher(false, tester.getHeader, tester.getBlock, tester.verifyHeader, tester.broadcastBlock, tester.chainHeight, tester.insertHeaders, tester.insertChain, tester.dropPeer)
+		fetcher.verifyHeader = func(*types.Header) error { return tt.verifyErr }
+		fetcher.insertChain = func(types.Blocks) (int, error) { return 0, tt.insertErr }
+
+		fetcher.importBlocks("peer", block)
+		<-fetcher.done
+		if dropped := tester.drops["peer"]; dropped != tt.dropped {
+			t.Errorf("test %d: peer dropped mismatch: have %v, want %v", i, dropped, tt.dropped)
+		}
+
+		fetcher.importHeaders("peer", block.Header())
+		<-fetcher.done
+		if dropped := tester.drops["peer"]; tt.insertErr == nil && dropped != tt.dropped {
+			t.Errorf("test %d: header peer dropped mismatch: have %v, want %v", i, dropped, tt.dropped)
+		}
+	}
+}
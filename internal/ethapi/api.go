@@ -1199,10 +1199,23 @@ func (s *PublicBlockChainAPI) rpcMarshalBlock(ctx context.Context, b *types.Bloc
 	}
 	if inclTx {
 		fields["totalDifficulty"] = (*hexutil.Big)(s.b.GetTd(ctx, b.Hash()))
+		if s.b.RPCEqualityBlocks() {
+			if marshaler, ok := s.b.Engine().(BlockFieldsMarshaler); ok {
+				if err := marshaler.RPCMarshalBlockFields(b.Header(), fields); err != nil {
+					log.Debug("Failed to marshal consensus block fields", "number", b.Number(), "hash", b.Hash(), "err", err)
+				}
+			}
+		}
 	}
 	return fields, err
 }
 
+// BlockFieldsMarshaler is implemented by the consensus engines adding the fields
+// decoded from the headers to the blocks returned over rpc.
+type BlockFieldsMarshaler interface {
+	RPCMarshalBlockFields(header *types.Header, fields map[string]interface{}) error
+}
+
 // RPCTransaction represents a transaction that will serialize to the RPC representation of a transaction
 type RPCTransaction struct {
 	BlockHash        *common.Hash    `json:"blockHash"`
@@ -46,8 +46,9 @@ type Backend interface {
 	ChainDb() ethdb.Database
 	AccountManager() *accounts.Manager
 	ExtRPCEnabled() bool
-	RPCGasCap() uint64    // global gas cap for eth_call over rpc: DoS protection
-	RPCTxFeeCap() float64 // global tx fee cap for all transaction related APIs
+	RPCGasCap() uint64       // global gas cap for eth_call over rpc: DoS protection
+	RPCTxFeeCap() float64    // global tx fee cap for all transaction related APIs
+	RPCEqualityBlocks() bool // whether to augment the blocks with their decoded equality fields
 
 	// Blockchain API
 	SetHead(number uint64)
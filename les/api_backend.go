@@ -62,6 +62,17 @@ func (b *LesApiBackend) HeaderByNumber(ctx context.Context, number rpc.BlockNumb
 	if number == rpc.LatestBlockNumber || number == rpc.PendingBlockNumber {
 		return b.eth.blockchain.CurrentHeader(), nil
 	}
+	if number == rpc.FinalizedBlockNumber {
+		engine, ok := b.eth.engine.(consensus.Finality)
+		if !ok {
+			return nil, errors.New("finalized block not supported by the consensus engine")
+		}
+		header := engine.FinalizedHeader(b.eth.blockchain)
+		if header == nil {
+			return nil, errors.New("finalized block not found")
+		}
+		return header, nil
+	}
 	return b.eth.blockchain.GetHeaderByNumberOdr(ctx, uint64(number))
 }
 
@@ -270,6 +281,10 @@ func (b *LesApiBackend) RPCTxFeeCap() float64 {
 	return b.eth.config.RPCTxFeeCap
 }
 
+func (b *LesApiBackend) RPCEqualityBlocks() bool {
+	return b.eth.config.RPCEqualityBlocks
+}
+
 func (b *LesApiBackend) BloomStatus() (uint64, uint64) {
 	if b.eth.bloomIndexer == nil {
 		return 0, 0
@@ -42,14 +42,15 @@ type Backend interface {
 
 // Config is the configuration parameters of mining.
 type Config struct {
-	Etherbase common.Address `toml:",omitempty"` // Public address for block mining rewards (default = first account)
-	Notify    []string       `toml:",omitempty"` // HTTP URL list to be notified of new work packages(only useful in ethash).
-	ExtraData hexutil.Bytes  `toml:",omitempty"` // Block extra data set by the miner
-	GasFloor  uint64         // Target gas floor for mined blocks.
-	GasCeil   uint64         // Target gas ceiling for mined blocks.
-	GasPrice  *big.Int       // Minimum gas price for mining a transaction
-	Recommit  time.Duration  // The time interval for miner to re-create mining work.
-	Noverify  bool           // Disable remote mining solution verification(only useful in ethash).
+	Etherbase    common.Address `toml:",omitempty"` // Public address for block mining rewards (default = first account)
+	Notify       []string       `toml:",omitempty"` // HTTP URL list to be notified of new work packages(only useful in ethash).
+	ExtraData    hexutil.Bytes  `toml:",omitempty"` // Block extra data set by the miner
+	GasFloor     uint64         // Target gas floor for mined blocks.
+	GasCeil      uint64         // Target gas ceiling for mined blocks.
+	GasPrice     *big.Int       // Minimum gas price for mining a transaction
+	Recommit     time.Duration  // The time interval for miner to re-create mining work.
+	Noverify     bool           // Disable remote mining solution verification(only useful in ethash).
+	MaxClockSkew time.Duration  // Local clock skew beyond which sealing is refused, 0 to only warn (only useful in equality).
 }
 
 // Miner creates blocks and searches for proof-of-work values.
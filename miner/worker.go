@@ -20,6 +20,7 @@ import (
 	"bytes"
 	"errors"
 	"math/big"
+	"sort"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -76,6 +77,11 @@ const (
 
 	// staleThreshold is the maximum depth of the acceptable stale block.
 	staleThreshold = 7
+
+	// reservedConsensusTxs is the number of equality consensus transactions, e.g.
+	// candidate registrations and cancels, committed ahead of the others in each
+	// block whatever their gas price.
+	reservedConsensusTxs = 2
 )
 
 // environment is the worker's current environment and holds all of the current state information.
@@ -514,6 +520,10 @@ func (w *worker) mainLoop() {
 				if w.chainConfig.Clique != nil && w.chainConfig.Clique.Period == 0 {
 					w.commitNewWork(nil, true, time.Now().Unix())
 				}
+				// Same for the equality dev mode, sealing on demand
+				if w.chainConfig.Equality != nil && w.chainConfig.Equality.IsDevMode() {
+					w.commitNewWork(nil, true, time.Now().Unix())
+				}
 			}
 			atomic.AddInt32(&w.newTxs, int32(len(ev.Txs)))
 
@@ -918,7 +928,7 @@ func (w *worker) commitNewWork(interrupt *int32, noempty bool, timestamp int64)
 	}
 
 	engine, ok := w.engine.(*equality.Equality)
-	if ok && !engine.InTurn(parent.Header(), uint64(tstart.Unix())) {
+	if ok && !engine.InTurn(w.chain, parent.Header(), uint64(tstart.Unix())) {
 		w.updateSnapshot()
 		return
 	}
@@ -972,6 +982,16 @@ func (w *worker) commitNewWork(interrupt *int32, noempty bool, timestamp int64)
 		w.updateSnapshot()
 		return
 	}
+	// Commit the reserved consensus transactions first, so they land even when
+	// higher priced transactions fill the block
+	if engine, ok := w.engine.(*equality.Equality); ok {
+		if reserved := reserveConsensusTransactions(pending, reservedConsensusTxs, engine.ConsensusTxGasFloor()); len(reserved) > 0 {
+			txs := types.NewTransactionsByPriceAndNonce(w.current.signer, reserved)
+			if w.commitTransactions(txs, w.coinbase, interrupt) {
+				return
+			}
+		}
+	}
 	// Split the pending transactions into locals and remotes
 	localTxs, remoteTxs := make(map[common.Address]types.Transactions), pending
 	for _, account := range w.eth.TxPool().Locals() {
@@ -995,6 +1015,39 @@ func (w *worker) commitNewWork(interrupt *int32, noempty bool, timestamp int64)
 	w.commit(uncles, w.fullTaskHook, true, tstart)
 }
 
+// reserveConsensusTransactions moves at most limit equality consensus
+// transactions priced at least floor out of pending, the highest priced ones
+// of those next in nonce order of their account.
+func reserveConsensusTransactions(pending map[common.Address]types.Transactions, limit int, floor *big.Int) map[common.Address]types.Transactions {
+	var candidates []*types.Transaction
+	accounts := make(map[common.Hash]common.Address)
+	for account, txs := range pending {
+		if len(txs) > 0 && txs[0].GasPrice().Cmp(floor) >= 0 && equality.IsConsensusTransaction(txs[0]) {
+			candidates = append(candidates, txs[0])
+			accounts[txs[0].Hash()] = account
+		}
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		if cmp := candidates[i].GasPriceCmp(candidates[j]); cmp != 0 {
+			return cmp > 0
+		}
+		return bytes.Compare(candidates[i].Hash().Bytes(), candidates[j].Hash().Bytes()) < 0
+	})
+	if len(candidates) > limit {
+		candidates = candidates[:limit]
+	}
+
+	reserved := make(map[common.Address]types.Transactions, len(candidates))
+	for _, tx := range candidates {
+		account := accounts[tx.Hash()]
+		reserved[account] = types.Transactions{tx}
+		if pending[account] = pending[account][1:]; len(pending[account]) == 0 {
+			delete(pending, account)
+		}
+	}
+	return reserved
+}
+
 // commit runs any post-transaction state modifications, assembles the final block
 // and commits new work if consensus engine is running.
 func (w *worker) commit(uncles []*types.Header, interval func(), update bool, start time.Time) error {
@@ -1005,6 +1058,10 @@ func (w *worker) commit(uncles []*types.Header, interval func(), update bool, st
 	if err != nil {
 		return err
 	}
+	// Keep the receipt of the logs emitted by the engine while finalizing
+	if logs := s.GetLogs(common.Hash{}); len(logs) > 0 {
+		receipts = append(receipts, types.NewSystemReceipt(logs, block.GasUsed()))
+	}
 	if w.isRunning() {
 		if interval != nil {
 			interval()
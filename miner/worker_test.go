@@ -27,6 +27,7 @@ import (
 	"github.com/SecretBlockChain/go-secret/common"
 	"github.com/SecretBlockChain/go-secret/consensus"
 	"github.com/SecretBlockChain/go-secret/consensus/clique"
+	"github.com/SecretBlockChain/go-secret/consensus/equality"
 	"github.com/SecretBlockChain/go-secret/consensus/ethash"
 	"github.com/SecretBlockChain/go-secret/core"
 	"github.com/SecretBlockChain/go-secret/core/rawdb"
@@ -111,6 +112,11 @@ func newTestWorkerBackend(t *testing.T, chainConfig *params.ChainConfig, engine
 		e.Authorize(testBankAddress, func(account accounts.Account, s string, data []byte) ([]byte, error) {
 			return crypto.Sign(crypto.Keccak256(data), testBankKey)
 		})
+	case *equality.Equality:
+		gspec.ExtraData = make([]byte, 32+crypto.SignatureLength)
+		e.Authorize(testBankAddress, func(account accounts.Account, s string, data []byte) ([]byte, error) {
+			return crypto.Sign(crypto.Keccak256(data), testBankKey)
+		})
 	case *ethash.Ethash:
 	default:
 		t.Fatalf("unexpected consensus engine type: %T", engine)
@@ -245,6 +251,240 @@ func testGenerateBlockAndImport(t *testing.T, isClique bool) {
 	}
 }
 
+func TestEqualityDevModeSealing(t *testing.T) {
+	chainConfig := *params.AllEthashProtocolChanges
+	chainConfig.Ethash = nil
+	chainConfig.Equality = params.DeveloperEqualityConfig(testBankAddress)
+	db := rawdb.NewMemoryDatabase()
+	engine := equality.New(chainConfig.Equality, db)
+
+	w, b := newTestWorker(t, &chainConfig, engine, db, 0)
+	defer w.close()
+
+	// This test chain imports the mined blocks.
+	db2 := rawdb.NewMemoryDatabase()
+	b.genesis.MustCommit(db2)
+	chain, _ := core.NewBlockChain(db2, nil, b.chain.Config(), equality.New(chainConfig.Equality, db2), vm.Config{}, nil, nil)
+	defer chain.Stop()
+
+	// Wait for mined blocks.
+	sub := w.mux.Subscribe(core.NewMinedBlockEvent{})
+	defer sub.Unsubscribe()
+
+	// The pending transaction is sealed at once, the following ones as soon
+	// as they arrive
+	w.start()
+	for i := 0; i < 3; i++ {
+		start := time.Now()
+		if i > 0 {
+			b.txPool.AddLocal(b.newRandomTx(false))
+		}
+		select {
+		case ev := <-sub.Chan():
+			block := ev.Data.(core.NewMinedBlockEvent).Block
+			if len(block.Transactions()) == 0 {
+				t.Fatalf("block %d sealed without transactions", block.NumberU64())
+			}
+			if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+				t.Fatalf("block %d sealed after %v", block.NumberU64(), elapsed)
+			}
+			if _, err := chain.InsertChain([]*types.Block{block}); err != nil {
+				t.Fatalf("failed to insert new mined block %d: %v", block.NumberU64(), err)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("timeout")
+		}
+	}
+}
+
+func TestEqualityReservedConsensusTransactions(t *testing.T) {
+	chainConfig := *params.AllEthashProtocolChanges
+	chainConfig.Ethash = nil
+	chainConfig.Equality = params.DeveloperEqualityConfig(testBankAddress)
+	db := rawdb.NewMemoryDatabase()
+	engine := equality.New(chainConfig.Equality, db)
+
+	w, b := newTestWorker(t, &chainConfig, engine, db, 0)
+	defer w.close()
+
+	// This test chain imports the mined blocks.
+	db2 := rawdb.NewMemoryDatabase()
+	b.genesis.MustCommit(db2)
+	chain, _ := core.NewBlockChain(db2, nil, b.chain.Config(), equality.New(chainConfig.Equality, db2), vm.Config{}, nil, nil)
+	defer chain.Stop()
+
+	// High priced transactions more than filling a block, and a cancel of the
+	// candidacy at no gas price
+	spam := int(params.GenesisGasLimit/params.TxGas) + 50
+	for i := 0; i < spam; i++ {
+		tx, _ := types.SignTx(types.NewTransaction(b.txPool.Nonce(testBankAddress), testUserAddress, big.NewInt(1), params.TxGas, big.NewInt(params.GWei), nil), types.HomesteadSigner{}, testBankKey)
+		if err := b.txPool.AddLocal(tx); err != nil {
+			t.Fatalf("failed to add spam transaction %d: %v", i, err)
+		}
+	}
+	cancel, _ := types.SignTx(types.NewTransaction(0, testUserAddress, big.NewInt(0), 30000, big.NewInt(0), []byte("equality:1:event:delegator")), types.HomesteadSigner{}, testUserKey)
+	if err := b.txPool.AddLocal(cancel); err != nil {
+		t.Fatalf("failed to add cancel transaction: %v", err)
+	}
+
+	sub := w.mux.Subscribe(core.NewMinedBlockEvent{})
+	defer sub.Unsubscribe()
+	w.start()
+
+	select {
+	case ev := <-sub.Chan():
+		block := ev.Data.(core.NewMinedBlockEvent).Block
+		if len(block.Transactions()) >= spam {
+			t.Fatalf("block %d not full: %d transactions", block.NumberU64(), len(block.Transactions()))
+		}
+		if block.Transaction(cancel.Hash()) == nil {
+			t.Fatalf("block %d sealed without the cancel transaction", block.NumberU64())
+		}
+		if _, err := chain.InsertChain([]*types.Block{block}); err != nil {
+			t.Fatalf("failed to insert new mined block %d: %v", block.NumberU64(), err)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatalf("timeout")
+	}
+}
+
+func TestReserveConsensusTransactionsGasFloor(t *testing.T) {
+	cheap, _ := types.SignTx(types.NewTransaction(0, testUserAddress, big.NewInt(0), 30000, big.NewInt(1), []byte("equality:1:event:delegator")), types.HomesteadSigner{}, testUserKey)
+	priced, _ := types.SignTx(types.NewTransaction(0, testUserAddress, big.NewInt(0), 30000, big.NewInt(params.GWei), []byte("equality:1:event:delegator")), types.HomesteadSigner{}, testBankKey)
+
+	// The consensus transactions priced below the floor are left to compete
+	// with the other transactions
+	for _, test := range []struct {
+		floor    *big.Int
+		reserved int
+	}{
+		{big.NewInt(0), 2},
+		{big.NewInt(1), 2},
+		{big.NewInt(2), 1},
+		{big.NewInt(2 * params.GWei), 0},
+	} {
+		pending := map[common.Address]types.Transactions{testUserAddress: {cheap}, testBankAddress: {priced}}
+		reserved := reserveConsensusTransactions(pending, reservedConsensusTxs, test.floor)
+		if len(reserved) != test.reserved {
+			t.Fatalf("floor %v: reserved %d transactions, want %d", test.floor, len(reserved), test.reserved)
+		}
+		if len(reserved)+len(pending) != 2 {
+			t.Fatalf("floor %v: %d transactions left pending, want %d", test.floor, len(pending), 2-len(reserved))
+		}
+		if test.reserved == 1 && reserved[testBankAddress] == nil {
+			t.Fatalf("floor %v: reserved the transaction below the floor", test.floor)
+		}
+	}
+}
+
+func TestEqualityCandidateReorg(t *testing.T) {
+	chainConfig := *params.AllEthashProtocolChanges
+	chainConfig.Ethash = nil
+	chainConfig.Equality = params.DeveloperEqualityConfig(testBankAddress)
+	chainConfig.Equality.MinCandidateBalance = big.NewInt(params.Ether / 10)
+	db := rawdb.NewMemoryDatabase()
+	engine := equality.New(chainConfig.Equality, db)
+	w, b := newTestWorker(t, &chainConfig, engine, db, 0)
+	defer w.close()
+
+	// The fork is sealed by another worker of the validator
+	forkDb := rawdb.NewMemoryDatabase()
+	fork, fb := newTestWorker(t, &chainConfig, equality.New(chainConfig.Equality, forkDb), forkDb, 0)
+	defer fork.close()
+
+	sub, forkSub := w.mux.Subscribe(core.NewMinedBlockEvent{}), fork.mux.Subscribe(core.NewMinedBlockEvent{})
+	defer sub.Unsubscribe()
+	defer forkSub.Unsubscribe()
+	mined := func(sub *event.TypeMuxSubscription) *types.Block {
+		select {
+		case ev := <-sub.Chan():
+			return ev.Data.(core.NewMinedBlockEvent).Block
+		case <-time.After(3 * time.Second):
+			t.Fatalf("timeout")
+		}
+		return nil
+	}
+	transfer := func(b *testWorkerBackend, value *big.Int) {
+		tx, _ := types.SignTx(types.NewTransaction(b.txPool.Nonce(testBankAddress), testUserAddress, value, params.TxGas, nil, nil), types.HomesteadSigner{}, testBankKey)
+		if err := b.txPool.AddLocal(tx); err != nil {
+			t.Fatalf("failed to add transfer: %v", err)
+		}
+	}
+	api := engine.APIs(b.chain)[0].Service.(*equality.API)
+	candidate := func() bool {
+		info, err := api.GetAddress(testUserAddress, nil)
+		if err != nil {
+			t.Fatalf("failed to retrieve candidate: %v", err)
+		}
+		return info.IsCandidate
+	}
+
+	// Both chains share the block funding the candidate
+	transfer(b, new(big.Int).Mul(chainConfig.Equality.MinCandidateBalance, big.NewInt(5)))
+	w.start()
+	shared := mined(sub)
+	if _, err := fb.chain.InsertChain([]*types.Block{shared}); err != nil {
+		t.Fatalf("failed to insert shared block: %v", err)
+	}
+
+	// The registration is sealed on one branch only
+	register, _ := types.SignTx(types.NewTransaction(0, testUserAddress, big.NewInt(0), 30000, nil, []byte("equality:1:event:candidate")), types.HomesteadSigner{}, testUserKey)
+	if err := b.txPool.AddLocal(register); err != nil {
+		t.Fatalf("failed to add registration: %v", err)
+	}
+	if block := mined(sub); block.Transaction(register.Hash()) == nil {
+		t.Fatalf("block %d sealed without the registration", block.NumberU64())
+	}
+	if !candidate() {
+		t.Fatalf("registration not applied")
+	}
+	w.stop()
+
+	// A longer branch without the registration reorgs it out, the candidate is
+	// absent with the deposit untouched
+	fork.start()
+	var blocks []*types.Block
+	for i := 0; i < 2; i++ {
+		transfer(fb, big.NewInt(1))
+		blocks = append(blocks, mined(forkSub))
+	}
+	if _, err := b.chain.InsertChain(blocks); err != nil {
+		t.Fatalf("failed to insert fork: %v", err)
+	}
+	if head := b.chain.CurrentBlock().Hash(); head != blocks[1].Hash() {
+		t.Fatalf("head mismatch: have %x, want %x", head, blocks[1].Hash())
+	}
+	if candidate() {
+		t.Fatalf("reorged out registration applied")
+	}
+	statedb, _ := b.chain.StateAt(shared.Root())
+	funded := new(big.Int).Add(statedb.GetBalance(testUserAddress), big.NewInt(2))
+	statedb, _ = b.chain.State()
+	if balance := statedb.GetBalance(testUserAddress); balance.Cmp(funded) != 0 {
+		t.Fatalf("balance mismatch: have %v, want %v", balance, funded)
+	}
+
+	// The transaction pool reinjects the registration, sealed again it takes
+	// the deposit once
+	for start := time.Now(); b.txPool.Get(register.Hash()) == nil; time.Sleep(10 * time.Millisecond) {
+		if time.Since(start) > 3*time.Second {
+			t.Fatalf("registration not reinjected")
+		}
+	}
+	w.start()
+	if block := mined(sub); block.Transaction(register.Hash()) == nil {
+		t.Fatalf("block %d sealed without the registration", block.NumberU64())
+	}
+	if !candidate() {
+		t.Fatalf("reinjected registration not applied")
+	}
+	statedb, _ = b.chain.State()
+	want := new(big.Int).Sub(funded, chainConfig.Equality.MinCandidateBalance)
+	if balance := statedb.GetBalance(testUserAddress); balance.Cmp(want) != 0 {
+		t.Fatalf("balance mismatch: have %v, want %v", balance, want)
+	}
+}
+
 func TestEmptyWorkEthash(t *testing.T) {
 	testEmptyWork(t, ethashChainConfig, ethash.NewFaker())
 }
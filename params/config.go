@@ -194,10 +194,14 @@ func (c *CliqueConfig) String() string {
 
 // EqualityReward is reward rule of mint block.
 type EqualityReward struct {
-	Number uint64   `json:"number"`                     // Block number
+	Number uint64   `json:"number"`                     // Last block number of the reward
 	Reward *big.Int `json:"reward" gencodec:"required"` // Token reward of mint block
 }
 
+// EqualityRewards is the reward schedule of mint blocks in ascending block
+// numbers, e.g. halving the reward at each rule. A block gets the reward of
+// the first rule whose number is not below its own, the blocks after the last
+// rule keep its reward.
 type EqualityRewards []EqualityReward
 
 // EqualityConfig is the consensus engine configs for proof-of-equality based sealing.
@@ -210,6 +214,45 @@ type EqualityConfig struct {
 	Validators          []common.Address `json:"validators"`                              // Genesis validator list
 	Pool                common.Address   `json:"pool"`                                    // Deposit pool address
 	Rewards             EqualityRewards  `json:"rewards"`                                 // Reward rule of mint block
+
+	// Fields below were appended after launch, they are optional in rlp and
+	// omitted from json when unset to keep existing encodings unchanged.
+	MaxHeaderExtraSize    uint64           `json:"maxHeaderExtraSize,omitempty" rlp:"optional"`    // Max decompressed size of header extra
+	Compression           string           `json:"compression,omitempty" rlp:"optional"`           // Compression codec of header extra, gzip (default) or deflate
+	CompressionLevel      uint64           `json:"compressionLevel,omitempty" rlp:"optional"`      // Compression level 1 (best speed) to 9 (best compression), 0 for default
+	KickOutRatio          uint64           `json:"kickOutRatio,omitempty" rlp:"optional"`          // Min percentage of scheduled blocks to seal, 0 for the min mint count rule
+	KickOutLockOut        uint64           `json:"kickOutLockOut,omitempty" rlp:"optional"`        // Blocks a kicked out candidate must wait before registering again
+	SlashRatio            uint64           `json:"slashRatio,omitempty" rlp:"optional"`            // Percentage of the security deposit slashed on kick out
+	SlashRecipient        *common.Address  `json:"slashRecipient,omitempty" rlp:"nil,optional"`    // Receiver of slashed deposits, burned if unset
+	DelegatedVoting       bool             `json:"delegatedVoting,omitempty" rlp:"optional"`       // Elect the candidates with the most votes instead of at random
+	ShuffleBlock          *big.Int         `json:"shuffleBlock,omitempty" rlp:"optional"`          // Block to shuffle the sealing order of each epoch from, nil or 0 for never
+	ActivationBlock       uint64           `json:"activationBlock,omitempty" rlp:"optional"`       // Block a config recorded in a header extra takes effect at, 0 for the next block
+	ConfigQuorum          uint64           `json:"configQuorum,omitempty" rlp:"optional"`          // Percentage of the validators approving a config change, 0 for two thirds
+	CandidateLogBlock     *big.Int         `json:"candidateLogBlock,omitempty" rlp:"optional"`     // Block to log candidate changes into receipts from, nil or 0 for never
+	CandidateExitBlock    *big.Int         `json:"candidateExitBlock,omitempty" rlp:"optional"`    // Block to defer cancels to the next epoch transition from, nil or 0 for never
+	CommunityRate         uint64           `json:"communityRate,omitempty" rlp:"optional"`         // Basis points of the sealer reward paid to the community fund
+	CommunityAddress      *common.Address  `json:"communityAddress,omitempty" rlp:"nil,optional"`  // Receiver of the community fund share of sealer rewards
+	TurnBlock             *big.Int         `json:"turnBlock,omitempty" rlp:"optional"`             // Block to let out of turn validators seal at a lower difficulty from, nil or 0 for never
+	RecentBlock           *big.Int         `json:"recentBlock,omitempty" rlp:"optional"`           // Block to reject validators sealing one of the recent blocks from, nil or 0 for never
+	TopUpBlock            *big.Int         `json:"topUpBlock,omitempty" rlp:"optional"`            // Block to let candidates top up their deposits from, nil or 0 for never
+	MetadataBlock         *big.Int         `json:"metadataBlock,omitempty" rlp:"optional"`         // Block to let candidates attach metadata to their registrations from, nil or 0 for never
+	MaxCandidateCount     uint64           `json:"maxCandidateCount,omitempty" rlp:"optional"`     // Max number of candidates, a higher deposit evicts the lowest one beyond it, 0 for unbounded
+	MinValidatorsCount    uint64           `json:"minValidatorsCount,omitempty" rlp:"optional"`    // Min number of validators an epoch transition keeps, sparing kick outs and carrying the validators over, 0 for none
+	CheckpointBlock       *big.Int         `json:"checkpointBlock,omitempty" rlp:"optional"`       // Block to let epoch transitions carry the attested checkpoint of the previous epoch from, nil or 0 for never
+	ElectionStrategy      string           `json:"electionStrategy,omitempty" rlp:"optional"`      // Strategy electing the validators at epoch transitions, random (default), stake or seniority
+	CandidateGuardBlock   *big.Int         `json:"candidateGuardBlock,omitempty" rlp:"optional"`   // Block to reject and never elect the zero address and contracts as candidates from, nil or 0 for never
+	RewardRecipientBlock  *big.Int         `json:"rewardRecipientBlock,omitempty" rlp:"optional"`  // Block to pay the sealer rewards to the recipients set by the candidates from, nil or 0 for never
+	MaturityBlocks        uint64           `json:"maturityBlocks,omitempty" rlp:"optional"`        // Blocks a registered candidate waits before it may be elected, 0 for none
+	ElectionCutoffBlock   *big.Int         `json:"electionCutoffBlock,omitempty" rlp:"optional"`   // Block to elect the validators out of the candidates ranked at a cutoff block before the epoch transitions from, nil or 0 for never
+	CandidateAllowList    []common.Address `json:"candidateAllowList,omitempty" rlp:"optional"`    // Only addresses allowed to register and be elected as candidates, empty for all
+	CandidateDenyList     []common.Address `json:"candidateDenyList,omitempty" rlp:"optional"`     // Addresses barred from registering and being elected as candidates
+	ElectionSeedBlock     *big.Int         `json:"electionSeedBlock,omitempty" rlp:"optional"`     // Block to seed the random election with the parent hash and the epoch from, nil or 0 for never
+	ValidatorCountFormula string           `json:"validatorCountFormula,omitempty" rlp:"optional"` // Formula sizing the validators of each epoch by the candidate pool, fixed (default), linear or sqrt
+	ValidatorCountBase    uint64           `json:"validatorCountBase,omitempty" rlp:"optional"`    // Validators the validator count formula elects out of any candidate pool
+	ValidatorCountDivisor uint64           `json:"validatorCountDivisor,omitempty" rlp:"optional"` // Candidates per additional validator of the linear formula
+	SealerKeyBlock        *big.Int         `json:"sealerKeyBlock,omitempty" rlp:"optional"`        // Block to let candidates seal with a key other than their own from, nil or 0 for never
+	MintCompactionBlock   *big.Int         `json:"mintCompactionBlock,omitempty" rlp:"optional"`   // Block to drop the mint counts of past epochs from the snapshot at the epoch transitions from, nil or 0 for never
+	MaxHeaderExtraBytes   uint64           `json:"maxHeaderExtraBytes,omitempty" rlp:"optional"`   // Max encoded size of header extra, as carried in the header, 0 for 32KB
 }
 
 type equalityRewardMarshaling struct {
@@ -218,14 +261,49 @@ type equalityRewardMarshaling struct {
 }
 
 type equalityConfigMarshaling struct {
-	Period              uint64
-	Epoch               uint64
-	MaxValidatorsCount  uint64
-	MinCandidateBalance *math.HexOrDecimal256
-	GenesisTimestamp    uint64
-	Validators          []common.Address
-	Pool                common.Address
-	Rewards             EqualityRewards
+	Period                uint64
+	Epoch                 uint64
+	MaxValidatorsCount    uint64
+	MinCandidateBalance   *math.HexOrDecimal256
+	GenesisTimestamp      uint64
+	Validators            []common.Address
+	Pool                  common.Address
+	Rewards               EqualityRewards
+	MaxHeaderExtraSize    uint64
+	Compression           string
+	CompressionLevel      uint64
+	KickOutRatio          uint64
+	KickOutLockOut        uint64
+	SlashRatio            uint64
+	SlashRecipient        *common.Address
+	DelegatedVoting       bool
+	ShuffleBlock          *math.HexOrDecimal256
+	ActivationBlock       uint64
+	ConfigQuorum          uint64
+	CandidateLogBlock     *math.HexOrDecimal256
+	CandidateExitBlock    *math.HexOrDecimal256
+	CommunityRate         uint64
+	CommunityAddress      *common.Address
+	TurnBlock             *math.HexOrDecimal256
+	RecentBlock           *math.HexOrDecimal256
+	TopUpBlock            *math.HexOrDecimal256
+	MetadataBlock         *math.HexOrDecimal256
+	MaxCandidateCount     uint64
+	CheckpointBlock       *math.HexOrDecimal256
+	ElectionStrategy      string
+	CandidateGuardBlock   *math.HexOrDecimal256
+	RewardRecipientBlock  *math.HexOrDecimal256
+	MaturityBlocks        uint64
+	ElectionCutoffBlock   *math.HexOrDecimal256
+	CandidateAllowList    []common.Address
+	CandidateDenyList     []common.Address
+	ElectionSeedBlock     *math.HexOrDecimal256
+	ValidatorCountFormula string
+	ValidatorCountBase    uint64
+	ValidatorCountDivisor uint64
+	SealerKeyBlock        *math.HexOrDecimal256
+	MintCompactionBlock   *math.HexOrDecimal256
+	MaxHeaderExtraBytes   uint64
 }
 
 // MainNetEqualityConfig returns mainnet config of equality consensus engine.
@@ -314,6 +392,122 @@ func TestnetEqualityConfig() *EqualityConfig {
 	}
 }
 
+// DeveloperEqualityConfig returns the config of a development chain sealed on
+// demand by its single validator.
+func DeveloperEqualityConfig(validator common.Address) *EqualityConfig {
+	return &EqualityConfig{
+		Period:              0,
+		Epoch:               28800,
+		MaxValidatorsCount:  1,
+		MinCandidateBalance: big.NewInt(0),
+		Validators:          []common.Address{validator},
+	}
+}
+
+// IsDevMode returns whether the config runs a development chain: with a zero
+// period, its single validator seals a block as soon as transactions arrive.
+func (c *EqualityConfig) IsDevMode() bool {
+	return c.Period == 0
+}
+
+// IsShuffle returns whether num is either equal to the shuffle block or greater.
+func (c *EqualityConfig) IsShuffle(num *big.Int) bool {
+	return isForked(equalityBlock(c.ShuffleBlock), num)
+}
+
+// IsCandidateLog returns whether num is either equal to the candidate log block or greater.
+func (c *EqualityConfig) IsCandidateLog(num *big.Int) bool {
+	return isForked(equalityBlock(c.CandidateLogBlock), num)
+}
+
+// IsCandidateExit returns whether num is either equal to the candidate exit block or greater.
+func (c *EqualityConfig) IsCandidateExit(num *big.Int) bool {
+	return isForked(equalityBlock(c.CandidateExitBlock), num)
+}
+
+// IsTurn returns whether num is either equal to the turn block or greater.
+func (c *EqualityConfig) IsTurn(num *big.Int) bool {
+	return isForked(equalityBlock(c.TurnBlock), num)
+}
+
+// IsRecent returns whether num is either equal to the recent block or greater.
+func (c *EqualityConfig) IsRecent(num *big.Int) bool {
+	return isForked(equalityBlock(c.RecentBlock), num)
+}
+
+// IsTopUp returns whether num is either equal to the top up block or greater.
+func (c *EqualityConfig) IsTopUp(num *big.Int) bool {
+	return isForked(equalityBlock(c.TopUpBlock), num)
+}
+
+// IsMetadata returns whether num is either equal to the metadata block or greater.
+func (c *EqualityConfig) IsMetadata(num *big.Int) bool {
+	return isForked(equalityBlock(c.MetadataBlock), num)
+}
+
+// IsCheckpoint returns whether num is either equal to the checkpoint block or greater.
+func (c *EqualityConfig) IsCheckpoint(num *big.Int) bool {
+	return isForked(equalityBlock(c.CheckpointBlock), num)
+}
+
+// IsCandidateGuard returns whether num is either equal to the candidate guard block or greater.
+func (c *EqualityConfig) IsCandidateGuard(num *big.Int) bool {
+	return isForked(equalityBlock(c.CandidateGuardBlock), num)
+}
+
+// IsRewardRecipient returns whether num is either equal to the reward recipient block or greater.
+func (c *EqualityConfig) IsRewardRecipient(num *big.Int) bool {
+	return isForked(equalityBlock(c.RewardRecipientBlock), num)
+}
+
+// IsElectionCutoff returns whether num is either equal to the election cutoff block or greater.
+func (c *EqualityConfig) IsElectionCutoff(num *big.Int) bool {
+	return isForked(equalityBlock(c.ElectionCutoffBlock), num)
+}
+
+// IsElectionSeed returns whether num is either equal to the election seed block or greater.
+func (c *EqualityConfig) IsElectionSeed(num *big.Int) bool {
+	return isForked(equalityBlock(c.ElectionSeedBlock), num)
+}
+
+// IsSealerKey returns whether num is either equal to the sealer key block or greater.
+func (c *EqualityConfig) IsSealerKey(num *big.Int) bool {
+	return isForked(equalityBlock(c.SealerKeyBlock), num)
+}
+
+// IsMintCompaction returns whether num is either equal to the mint compaction block or greater.
+func (c *EqualityConfig) IsMintCompaction(num *big.Int) bool {
+	return isForked(equalityBlock(c.MintCompactionBlock), num)
+}
+
+// equalityBlock returns the fork block, nil if unset. A zero fork block is
+// treated as unset since rlp decodes an unset one as zero.
+func equalityBlock(block *big.Int) *big.Int {
+	if block == nil || block.Sign() == 0 {
+		return nil
+	}
+	return block
+}
+
+// equalBlocks compares two fork blocks for equality, treating zero as unset.
+func equalBlocks(a, b *big.Int) bool {
+	a, b = equalityBlock(a), equalityBlock(b)
+	return (a == nil) == (b == nil) && (a == nil || a.Cmp(b) == 0)
+}
+
+// equalAddresses compares two address lists for equality, in order.
+func equalAddresses(a, b []common.Address) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for idx, address := range a {
+		if address != b[idx] {
+			return false
+		}
+	}
+	return true
+}
+
 // String implements the stringer interface, returning the consensus engine details.
 func (c *EqualityConfig) String() string {
 	return "equality"
@@ -339,14 +533,112 @@ func (c *EqualityConfig) Equal(other EqualityConfig) bool {
 	if c.GenesisTimestamp != other.GenesisTimestamp {
 		return false
 	}
+	if c.MaxHeaderExtraSize != other.MaxHeaderExtraSize || c.MaxHeaderExtraBytes != other.MaxHeaderExtraBytes {
+		return false
+	}
+	if c.Compression != other.Compression {
+		return false
+	}
+	if c.CompressionLevel != other.CompressionLevel {
+		return false
+	}
+	if c.KickOutRatio != other.KickOutRatio {
+		return false
+	}
+	if c.KickOutLockOut != other.KickOutLockOut {
+		return false
+	}
+	if c.SlashRatio != other.SlashRatio {
+		return false
+	}
+	if (c.SlashRecipient == nil) != (other.SlashRecipient == nil) ||
+		(c.SlashRecipient != nil && *c.SlashRecipient != *other.SlashRecipient) {
+		return false
+	}
+	if c.DelegatedVoting != other.DelegatedVoting {
+		return false
+	}
+	if !equalBlocks(c.ShuffleBlock, other.ShuffleBlock) {
+		return false
+	}
+	if c.ActivationBlock != other.ActivationBlock {
+		return false
+	}
+	if c.ConfigQuorum != other.ConfigQuorum {
+		return false
+	}
+	if !equalBlocks(c.CandidateLogBlock, other.CandidateLogBlock) {
+		return false
+	}
+	if !equalBlocks(c.CandidateExitBlock, other.CandidateExitBlock) {
+		return false
+	}
+	if c.CommunityRate != other.CommunityRate {
+		return false
+	}
+	if !equalBlocks(c.TurnBlock, other.TurnBlock) {
+		return false
+	}
+	if !equalBlocks(c.RecentBlock, other.RecentBlock) {
+		return false
+	}
+	if !equalBlocks(c.TopUpBlock, other.TopUpBlock) {
+		return false
+	}
+	if !equalBlocks(c.MetadataBlock, other.MetadataBlock) {
+		return false
+	}
+	if c.MaxCandidateCount != other.MaxCandidateCount {
+		return false
+	}
+	if c.MinValidatorsCount != other.MinValidatorsCount {
+		return false
+	}
+	if !equalBlocks(c.CheckpointBlock, other.CheckpointBlock) {
+		return false
+	}
+	if c.ElectionStrategy != other.ElectionStrategy {
+		return false
+	}
+	if !equalBlocks(c.CandidateGuardBlock, other.CandidateGuardBlock) {
+		return false
+	}
+	if !equalBlocks(c.RewardRecipientBlock, other.RewardRecipientBlock) {
+		return false
+	}
+	if c.MaturityBlocks != other.MaturityBlocks {
+		return false
+	}
+	if !equalBlocks(c.ElectionCutoffBlock, other.ElectionCutoffBlock) {
+		return false
+	}
+	if !equalBlocks(c.ElectionSeedBlock, other.ElectionSeedBlock) {
+		return false
+	}
+	if !equalBlocks(c.SealerKeyBlock, other.SealerKeyBlock) {
+		return false
+	}
+	if !equalBlocks(c.MintCompactionBlock, other.MintCompactionBlock) {
+		return false
+	}
+	if c.ValidatorCountFormula != other.ValidatorCountFormula || c.ValidatorCountBase != other.ValidatorCountBase ||
+		c.ValidatorCountDivisor != other.ValidatorCountDivisor {
+		return false
+	}
+	if (c.CommunityAddress == nil) != (other.CommunityAddress == nil) ||
+		(c.CommunityAddress != nil && *c.CommunityAddress != *other.CommunityAddress) {
+		return false
+	}
 
-	if len(c.Validators) != len(other.Validators) {
+	if !equalAddresses(c.Validators, other.Validators) {
 		return false
 	}
-	for idx, validator := range c.Validators {
-		if validator != other.Validators[idx] {
-			return false
-		}
+
+	if !equalAddresses(c.CandidateAllowList, other.CandidateAllowList) {
+		return false
+	}
+	if !equalAddresses(c.CandidateDenyList, other.CandidateDenyList) {
+		return false
 	}
 
 	if len(c.Rewards) != len(other.Rewards) {
@@ -363,6 +655,148 @@ func (c *EqualityConfig) Equal(other EqualityConfig) bool {
 	return true
 }
 
+// EqualityConfigError is returned by the validation of an EqualityConfig,
+// naming the offending field and its value.
+type EqualityConfigError struct {
+	Field  string
+	Value  interface{}
+	Reason string
+}
+
+func (err *EqualityConfigError) Error() string {
+	return fmt.Sprintf("invalid equality config %s %v: %s", err.Field, err.Value, err.Reason)
+}
+
+// Validate checks the ranges of the fields and the constraints between them.
+func (c *EqualityConfig) Validate() error {
+	if c.Epoch == 0 {
+		return &EqualityConfigError{"epoch", c.Epoch, "must be positive"}
+	}
+	if c.MaxValidatorsCount == 0 {
+		return &EqualityConfigError{"maxValidatorsCount", c.MaxValidatorsCount, "must be positive"}
+	}
+	if c.Period == 0 && (c.MaxValidatorsCount > 1 || len(c.Validators) > 1) {
+		return &EqualityConfigError{"period", c.Period, "must be positive with more than one validator"}
+	}
+	if c.Epoch < uint64(len(c.Validators)) {
+		return &EqualityConfigError{"epoch", c.Epoch, fmt.Sprintf("smaller than the %d validators", len(c.Validators))}
+	}
+	if c.MinCandidateBalance == nil || c.MinCandidateBalance.Sign() < 0 {
+		return &EqualityConfigError{"minCandidateBalance", c.MinCandidateBalance, "must not be negative"}
+	}
+
+	seen := make(map[common.Address]struct{}, len(c.Validators))
+	for _, validator := range c.Validators {
+		if validator == (common.Address{}) {
+			return &EqualityConfigError{"validators", validator.Hex(), "zero address"}
+		}
+		if _, ok := seen[validator]; ok {
+			return &EqualityConfigError{"validators", validator.Hex(), "duplicate address"}
+		}
+		seen[validator] = struct{}{}
+	}
+	allowed := make(map[common.Address]struct{}, len(c.CandidateAllowList))
+	for _, candidate := range c.CandidateAllowList {
+		if _, ok := allowed[candidate]; ok {
+			return &EqualityConfigError{"candidateAllowList", candidate.Hex(), "duplicate address"}
+		}
+		allowed[candidate] = struct{}{}
+	}
+	denied := make(map[common.Address]struct{}, len(c.CandidateDenyList))
+	for _, candidate := range c.CandidateDenyList {
+		if _, ok := denied[candidate]; ok {
+			return &EqualityConfigError{"candidateDenyList", candidate.Hex(), "duplicate address"}
+		}
+		if _, ok := allowed[candidate]; ok {
+			return &EqualityConfigError{"candidateDenyList", candidate.Hex(), "also allowed"}
+		}
+		denied[candidate] = struct{}{}
+	}
+	for idx, reward := range c.Rewards {
+		if reward.Reward == nil || reward.Reward.Sign() < 0 {
+			return &EqualityConfigError{"rewards", reward.Reward, "must not be negative"}
+		}
+		if idx > 0 && reward.Number <= c.Rewards[idx-1].Number {
+			return &EqualityConfigError{"rewards", reward.Number, "numbers must be ascending"}
+		}
+	}
+
+	if c.CompressionLevel > 9 {
+		return &EqualityConfigError{"compressionLevel", c.CompressionLevel, "must be at most 9"}
+	}
+	percentages := []struct {
+		field string
+		value uint64
+	}{
+		{"kickOutRatio", c.KickOutRatio},
+		{"slashRatio", c.SlashRatio},
+		{"configQuorum", c.ConfigQuorum},
+	}
+	for _, percentage := range percentages {
+		if percentage.value > 100 {
+			return &EqualityConfigError{percentage.field, percentage.value, "must be at most 100"}
+		}
+	}
+	if c.ShuffleBlock != nil && c.ShuffleBlock.Sign() < 0 {
+		return &EqualityConfigError{"shuffleBlock", c.ShuffleBlock, "must not be negative"}
+	}
+	if c.CandidateLogBlock != nil && c.CandidateLogBlock.Sign() < 0 {
+		return &EqualityConfigError{"candidateLogBlock", c.CandidateLogBlock, "must not be negative"}
+	}
+	if c.CandidateExitBlock != nil && c.CandidateExitBlock.Sign() < 0 {
+		return &EqualityConfigError{"candidateExitBlock", c.CandidateExitBlock, "must not be negative"}
+	}
+	if c.TurnBlock != nil && c.TurnBlock.Sign() < 0 {
+		return &EqualityConfigError{"turnBlock", c.TurnBlock, "must not be negative"}
+	}
+	if c.RecentBlock != nil && c.RecentBlock.Sign() < 0 {
+		return &EqualityConfigError{"recentBlock", c.RecentBlock, "must not be negative"}
+	}
+	if c.TopUpBlock != nil && c.TopUpBlock.Sign() < 0 {
+		return &EqualityConfigError{"topUpBlock", c.TopUpBlock, "must not be negative"}
+	}
+	if c.MetadataBlock != nil && c.MetadataBlock.Sign() < 0 {
+		return &EqualityConfigError{"metadataBlock", c.MetadataBlock, "must not be negative"}
+	}
+	if c.CheckpointBlock != nil && c.CheckpointBlock.Sign() < 0 {
+		return &EqualityConfigError{"checkpointBlock", c.CheckpointBlock, "must not be negative"}
+	}
+	if c.CandidateGuardBlock != nil && c.CandidateGuardBlock.Sign() < 0 {
+		return &EqualityConfigError{"candidateGuardBlock", c.CandidateGuardBlock, "must not be negative"}
+	}
+	if c.RewardRecipientBlock != nil && c.RewardRecipientBlock.Sign() < 0 {
+		return &EqualityConfigError{"rewardRecipientBlock", c.RewardRecipientBlock, "must not be negative"}
+	}
+	if c.ElectionCutoffBlock != nil && c.ElectionCutoffBlock.Sign() < 0 {
+		return &EqualityConfigError{"electionCutoffBlock", c.ElectionCutoffBlock, "must not be negative"}
+	}
+	if c.ElectionSeedBlock != nil && c.ElectionSeedBlock.Sign() < 0 {
+		return &EqualityConfigError{"electionSeedBlock", c.ElectionSeedBlock, "must not be negative"}
+	}
+	if c.SealerKeyBlock != nil && c.SealerKeyBlock.Sign() < 0 {
+		return &EqualityConfigError{"sealerKeyBlock", c.SealerKeyBlock, "must not be negative"}
+	}
+	if c.MintCompactionBlock != nil && c.MintCompactionBlock.Sign() < 0 {
+		return &EqualityConfigError{"mintCompactionBlock", c.MintCompactionBlock, "must not be negative"}
+	}
+	if c.MaxCandidateCount > 0 && c.MaxCandidateCount < c.MaxValidatorsCount {
+		return &EqualityConfigError{"maxCandidateCount", c.MaxCandidateCount, "must be at least maxValidatorsCount"}
+	}
+	if c.MinValidatorsCount > c.MaxValidatorsCount {
+		return &EqualityConfigError{"minValidatorsCount", c.MinValidatorsCount, "must be at most maxValidatorsCount"}
+	}
+	if c.ValidatorCountBase > c.MaxValidatorsCount {
+		return &EqualityConfigError{"validatorCountBase", c.ValidatorCountBase, "must be at most maxValidatorsCount"}
+	}
+	if c.CommunityRate > 10000 {
+		return &EqualityConfigError{"communityRate", c.CommunityRate, "must be at most 10000 basis points"}
+	}
+	if c.CommunityRate > 0 && c.CommunityAddress == nil {
+		return &EqualityConfigError{"communityAddress", nil, "must be set with a community rate"}
+	}
+	return nil
+}
+
 // String implements the fmt.Stringer interface.
 func (c *ChainConfig) String() string {
 	var engine interface{}
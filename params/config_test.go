@@ -17,9 +17,14 @@
 package params
 
 import (
+	"bytes"
+	"encoding/json"
 	"math/big"
 	"reflect"
 	"testing"
+
+	"github.com/SecretBlockChain/go-secret/common"
+	"github.com/SecretBlockChain/go-secret/rlp"
 )
 
 func TestCheckCompatible(t *testing.T) {
@@ -96,3 +101,142 @@ func TestCheckCompatible(t *testing.T) {
 		}
 	}
 }
+
+// legacyEqualityConfig is the layout of EqualityConfig at launch.
+type legacyEqualityConfig struct {
+	Period              uint64
+	Epoch               uint64
+	MaxValidatorsCount  uint64
+	MinCandidateBalance *big.Int
+	GenesisTimestamp    uint64
+	Validators          []common.Address
+	Pool                common.Address
+	Rewards             EqualityRewards
+}
+
+func TestEqualityConfigCompatible(t *testing.T) {
+	config := TestnetEqualityConfig()
+	legacy := legacyEqualityConfig{
+		Period:              config.Period,
+		Epoch:               config.Epoch,
+		MaxValidatorsCount:  config.MaxValidatorsCount,
+		MinCandidateBalance: config.MinCandidateBalance,
+		GenesisTimestamp:    config.GenesisTimestamp,
+		Validators:          config.Validators,
+		Pool:                config.Pool,
+		Rewards:             config.Rewards,
+	}
+
+	// Appended fields must not change the rlp encoding while unset
+	want, err := rlp.EncodeToBytes(legacy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	have, err := rlp.EncodeToBytes(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(have, want) {
+		t.Fatalf("rlp mismatch: have %x, want %x", have, want)
+	}
+	var decoded EqualityConfig
+	if err := rlp.DecodeBytes(want, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if !decoded.Equal(*config) {
+		t.Fatalf("decoded config mismatch: have %+v, want %+v", decoded, config)
+	}
+
+	// Nor the json encoding stored in the config trie
+	data, err := json.Marshal(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, field := range []string{"maxHeaderExtraSize", "compression", "compressionLevel", "kickOutRatio", "kickOutLockOut", "slashRatio", "slashRecipient", "delegatedVoting", "shuffleBlock", "activationBlock", "configQuorum", "candidateLogBlock", "candidateExitBlock", "communityRate", "communityAddress", "turnBlock", "recentBlock", "topUpBlock", "metadataBlock", "maxCandidateCount", "minValidatorsCount", "checkpointBlock", "electionStrategy", "candidateGuardBlock", "rewardRecipientBlock", "maturityBlocks", "electionCutoffBlock", "candidateAllowList", "candidateDenyList", "electionSeedBlock", "validatorCountFormula", "validatorCountBase", "validatorCountDivisor", "sealerKeyBlock", "mintCompactionBlock", "maxHeaderExtraBytes"} {
+		if bytes.Contains(data, []byte(field)) {
+			t.Fatalf("unset optional field %s encoded: %s", field, data)
+		}
+	}
+
+	// Unset pointers followed by set fields survive an rlp round trip
+	config.ConfigQuorum = 50
+	data, err = rlp.EncodeToBytes(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded = EqualityConfig{}
+	if err := rlp.DecodeBytes(data, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if !decoded.Equal(*config) || decoded.SlashRecipient != nil || decoded.CommunityAddress != nil || decoded.IsShuffle(common.Big1) {
+		t.Fatalf("decoded config mismatch: have %+v, want %+v", decoded, config)
+	}
+}
+
+func TestEqualityConfigValidate(t *testing.T) {
+	developer := DeveloperEqualityConfig(common.HexToAddress("0x6c4ab069affd856bb915ee93cb59370574f5331e"))
+	for _, config := range []*EqualityConfig{MainNetEqualityConfig(), TestnetEqualityConfig(), developer} {
+		if err := config.Validate(); err != nil {
+			t.Fatalf("valid config rejected: %v", err)
+		}
+	}
+
+	tests := []struct {
+		field  string
+		modify func(config *EqualityConfig)
+	}{
+		{"period", func(config *EqualityConfig) { config.Period = 0 }},
+		{"epoch", func(config *EqualityConfig) { config.Epoch = 0 }},
+		{"epoch", func(config *EqualityConfig) { config.Epoch = 1 }},
+		{"maxValidatorsCount", func(config *EqualityConfig) { config.MaxValidatorsCount = 0 }},
+		{"minCandidateBalance", func(config *EqualityConfig) { config.MinCandidateBalance = nil }},
+		{"minCandidateBalance", func(config *EqualityConfig) { config.MinCandidateBalance = big.NewInt(-1) }},
+		{"validators", func(config *EqualityConfig) { config.Validators = append(config.Validators, common.Address{}) }},
+		{"validators", func(config *EqualityConfig) { config.Validators = append(config.Validators, config.Validators[0]) }},
+		{"rewards", func(config *EqualityConfig) { config.Rewards[0].Reward = nil }},
+		{"rewards", func(config *EqualityConfig) { config.Rewards[1].Reward = big.NewInt(-1) }},
+		{"rewards", func(config *EqualityConfig) { config.Rewards[1].Number = config.Rewards[0].Number }},
+		{"rewards", func(config *EqualityConfig) { config.Rewards[0].Number = config.Rewards[1].Number + 1 }},
+		{"compressionLevel", func(config *EqualityConfig) { config.CompressionLevel = 10 }},
+		{"kickOutRatio", func(config *EqualityConfig) { config.KickOutRatio = 101 }},
+		{"slashRatio", func(config *EqualityConfig) { config.SlashRatio = 101 }},
+		{"configQuorum", func(config *EqualityConfig) { config.ConfigQuorum = 101 }},
+		{"shuffleBlock", func(config *EqualityConfig) { config.ShuffleBlock = big.NewInt(-1) }},
+		{"candidateLogBlock", func(config *EqualityConfig) { config.CandidateLogBlock = big.NewInt(-1) }},
+		{"candidateExitBlock", func(config *EqualityConfig) { config.CandidateExitBlock = big.NewInt(-1) }},
+		{"turnBlock", func(config *EqualityConfig) { config.TurnBlock = big.NewInt(-1) }},
+		{"recentBlock", func(config *EqualityConfig) { config.RecentBlock = big.NewInt(-1) }},
+		{"topUpBlock", func(config *EqualityConfig) { config.TopUpBlock = big.NewInt(-1) }},
+		{"metadataBlock", func(config *EqualityConfig) { config.MetadataBlock = big.NewInt(-1) }},
+		{"maxCandidateCount", func(config *EqualityConfig) { config.MaxCandidateCount = config.MaxValidatorsCount - 1 }},
+		{"minValidatorsCount", func(config *EqualityConfig) { config.MinValidatorsCount = config.MaxValidatorsCount + 1 }},
+		{"validatorCountBase", func(config *EqualityConfig) { config.ValidatorCountBase = config.MaxValidatorsCount + 1 }},
+		{"checkpointBlock", func(config *EqualityConfig) { config.CheckpointBlock = big.NewInt(-1) }},
+		{"candidateGuardBlock", func(config *EqualityConfig) { config.CandidateGuardBlock = big.NewInt(-1) }},
+		{"rewardRecipientBlock", func(config *EqualityConfig) { config.RewardRecipientBlock = big.NewInt(-1) }},
+		{"electionCutoffBlock", func(config *EqualityConfig) { config.ElectionCutoffBlock = big.NewInt(-1) }},
+		{"electionSeedBlock", func(config *EqualityConfig) { config.ElectionSeedBlock = big.NewInt(-1) }},
+		{"sealerKeyBlock", func(config *EqualityConfig) { config.SealerKeyBlock = big.NewInt(-1) }},
+		{"mintCompactionBlock", func(config *EqualityConfig) { config.MintCompactionBlock = big.NewInt(-1) }},
+		{"candidateAllowList", func(config *EqualityConfig) {
+			config.CandidateAllowList = []common.Address{common.HexToAddress("0x01"), common.HexToAddress("0x01")}
+		}},
+		{"candidateDenyList", func(config *EqualityConfig) {
+			config.CandidateAllowList = []common.Address{common.HexToAddress("0x01")}
+			config.CandidateDenyList = []common.Address{common.HexToAddress("0x01")}
+		}},
+		{"communityRate", func(config *EqualityConfig) { config.CommunityRate = 10001 }},
+		{"communityAddress", func(config *EqualityConfig) { config.CommunityRate = 100 }},
+	}
+	for idx, test := range tests {
+		config := TestnetEqualityConfig()
+		test.modify(config)
+		err, ok := config.Validate().(*EqualityConfigError)
+		if !ok {
+			t.Fatalf("test %d: invalid %s accepted", idx, test.field)
+		}
+		if err.Field != test.field {
+			t.Fatalf("test %d: field mismatch: have %s, want %s", idx, err.Field, test.field)
+		}
+	}
+}
@@ -16,14 +16,50 @@ var _ = (*equalityConfigMarshaling)(nil)
 // MarshalJSON marshals as JSON.
 func (e EqualityConfig) MarshalJSON() ([]byte, error) {
 	type EqualityConfig struct {
-		Period              uint64                `json:"period"`
-		Epoch               uint64                `json:"epoch"`
-		MaxValidatorsCount  uint64                `json:"maxValidatorsCount"`
-		MinCandidateBalance *math.HexOrDecimal256 `json:"minCandidateBalance" gencodec:"required"`
-		GenesisTimestamp    uint64                `json:"genesisTimestamp"`
-		Validators          []common.Address      `json:"validators"`
-		Pool                common.Address        `json:"pool"`
-		Rewards             EqualityRewards       `json:"rewards"`
+		Period                uint64                `json:"period"`
+		Epoch                 uint64                `json:"epoch"`
+		MaxValidatorsCount    uint64                `json:"maxValidatorsCount"`
+		MinCandidateBalance   *math.HexOrDecimal256 `json:"minCandidateBalance" gencodec:"required"`
+		GenesisTimestamp      uint64                `json:"genesisTimestamp"`
+		Validators            []common.Address      `json:"validators"`
+		Pool                  common.Address        `json:"pool"`
+		Rewards               EqualityRewards       `json:"rewards"`
+		MaxHeaderExtraSize    uint64                `json:"maxHeaderExtraSize,omitempty" rlp:"optional"`
+		Compression           string                `json:"compression,omitempty" rlp:"optional"`
+		CompressionLevel      uint64                `json:"compressionLevel,omitempty" rlp:"optional"`
+		KickOutRatio          uint64                `json:"kickOutRatio,omitempty" rlp:"optional"`
+		KickOutLockOut        uint64                `json:"kickOutLockOut,omitempty" rlp:"optional"`
+		SlashRatio            uint64                `json:"slashRatio,omitempty" rlp:"optional"`
+		SlashRecipient        *common.Address       `json:"slashRecipient,omitempty" rlp:"nil,optional"`
+		DelegatedVoting       bool                  `json:"delegatedVoting,omitempty" rlp:"optional"`
+		ShuffleBlock          *math.HexOrDecimal256 `json:"shuffleBlock,omitempty" rlp:"optional"`
+		ActivationBlock       uint64                `json:"activationBlock,omitempty" rlp:"optional"`
+		ConfigQuorum          uint64                `json:"configQuorum,omitempty" rlp:"optional"`
+		CandidateLogBlock     *math.HexOrDecimal256 `json:"candidateLogBlock,omitempty" rlp:"optional"`
+		CandidateExitBlock    *math.HexOrDecimal256 `json:"candidateExitBlock,omitempty" rlp:"optional"`
+		CommunityRate         uint64                `json:"communityRate,omitempty" rlp:"optional"`
+		CommunityAddress      *common.Address       `json:"communityAddress,omitempty" rlp:"nil,optional"`
+		TurnBlock             *math.HexOrDecimal256 `json:"turnBlock,omitempty" rlp:"optional"`
+		RecentBlock           *math.HexOrDecimal256 `json:"recentBlock,omitempty" rlp:"optional"`
+		TopUpBlock            *math.HexOrDecimal256 `json:"topUpBlock,omitempty" rlp:"optional"`
+		MetadataBlock         *math.HexOrDecimal256 `json:"metadataBlock,omitempty" rlp:"optional"`
+		MaxCandidateCount     uint64                `json:"maxCandidateCount,omitempty" rlp:"optional"`
+		MinValidatorsCount    uint64                `json:"minValidatorsCount,omitempty" rlp:"optional"`
+		CheckpointBlock       *math.HexOrDecimal256 `json:"checkpointBlock,omitempty" rlp:"optional"`
+		ElectionStrategy      string                `json:"electionStrategy,omitempty" rlp:"optional"`
+		CandidateGuardBlock   *math.HexOrDecimal256 `json:"candidateGuardBlock,omitempty" rlp:"optional"`
+		RewardRecipientBlock  *math.HexOrDecimal256 `json:"rewardRecipientBlock,omitempty" rlp:"optional"`
+		MaturityBlocks        uint64                `json:"maturityBlocks,omitempty" rlp:"optional"`
+		ElectionCutoffBlock   *math.HexOrDecimal256 `json:"electionCutoffBlock,omitempty" rlp:"optional"`
+		CandidateAllowList    []common.Address      `json:"candidateAllowList,omitempty" rlp:"optional"`
+		CandidateDenyList     []common.Address      `json:"candidateDenyList,omitempty" rlp:"optional"`
+		ElectionSeedBlock     *math.HexOrDecimal256 `json:"electionSeedBlock,omitempty" rlp:"optional"`
+		ValidatorCountFormula string                `json:"validatorCountFormula,omitempty" rlp:"optional"`
+		ValidatorCountBase    uint64                `json:"validatorCountBase,omitempty" rlp:"optional"`
+		ValidatorCountDivisor uint64                `json:"validatorCountDivisor,omitempty" rlp:"optional"`
+		SealerKeyBlock        *math.HexOrDecimal256 `json:"sealerKeyBlock,omitempty" rlp:"optional"`
+		MintCompactionBlock   *math.HexOrDecimal256 `json:"mintCompactionBlock,omitempty" rlp:"optional"`
+		MaxHeaderExtraBytes   uint64                `json:"maxHeaderExtraBytes,omitempty" rlp:"optional"`
 	}
 	var enc EqualityConfig
 	enc.Period = e.Period
@@ -34,20 +70,92 @@ func (e EqualityConfig) MarshalJSON() ([]byte, error) {
 	enc.Validators = e.Validators
 	enc.Pool = e.Pool
 	enc.Rewards = e.Rewards
+	enc.MaxHeaderExtraSize = e.MaxHeaderExtraSize
+	enc.Compression = e.Compression
+	enc.CompressionLevel = e.CompressionLevel
+	enc.KickOutRatio = e.KickOutRatio
+	enc.KickOutLockOut = e.KickOutLockOut
+	enc.SlashRatio = e.SlashRatio
+	enc.SlashRecipient = e.SlashRecipient
+	enc.DelegatedVoting = e.DelegatedVoting
+	enc.ShuffleBlock = (*math.HexOrDecimal256)(e.ShuffleBlock)
+	enc.ActivationBlock = e.ActivationBlock
+	enc.ConfigQuorum = e.ConfigQuorum
+	enc.CandidateLogBlock = (*math.HexOrDecimal256)(e.CandidateLogBlock)
+	enc.CandidateExitBlock = (*math.HexOrDecimal256)(e.CandidateExitBlock)
+	enc.CommunityRate = e.CommunityRate
+	enc.CommunityAddress = e.CommunityAddress
+	enc.TurnBlock = (*math.HexOrDecimal256)(e.TurnBlock)
+	enc.RecentBlock = (*math.HexOrDecimal256)(e.RecentBlock)
+	enc.TopUpBlock = (*math.HexOrDecimal256)(e.TopUpBlock)
+	enc.MetadataBlock = (*math.HexOrDecimal256)(e.MetadataBlock)
+	enc.MaxCandidateCount = e.MaxCandidateCount
+	enc.MinValidatorsCount = e.MinValidatorsCount
+	enc.CheckpointBlock = (*math.HexOrDecimal256)(e.CheckpointBlock)
+	enc.ElectionStrategy = e.ElectionStrategy
+	enc.CandidateGuardBlock = (*math.HexOrDecimal256)(e.CandidateGuardBlock)
+	enc.RewardRecipientBlock = (*math.HexOrDecimal256)(e.RewardRecipientBlock)
+	enc.MaturityBlocks = e.MaturityBlocks
+	enc.ElectionCutoffBlock = (*math.HexOrDecimal256)(e.ElectionCutoffBlock)
+	enc.CandidateAllowList = e.CandidateAllowList
+	enc.CandidateDenyList = e.CandidateDenyList
+	enc.ElectionSeedBlock = (*math.HexOrDecimal256)(e.ElectionSeedBlock)
+	enc.ValidatorCountFormula = e.ValidatorCountFormula
+	enc.ValidatorCountBase = e.ValidatorCountBase
+	enc.ValidatorCountDivisor = e.ValidatorCountDivisor
+	enc.SealerKeyBlock = (*math.HexOrDecimal256)(e.SealerKeyBlock)
+	enc.MintCompactionBlock = (*math.HexOrDecimal256)(e.MintCompactionBlock)
+	enc.MaxHeaderExtraBytes = e.MaxHeaderExtraBytes
 	return json.Marshal(&enc)
 }
 
 // UnmarshalJSON unmarshals from JSON.
 func (e *EqualityConfig) UnmarshalJSON(input []byte) error {
 	type EqualityConfig struct {
-		Period              *uint64               `json:"period"`
-		Epoch               *uint64               `json:"epoch"`
-		MaxValidatorsCount  *uint64               `json:"maxValidatorsCount"`
-		MinCandidateBalance *math.HexOrDecimal256 `json:"minCandidateBalance" gencodec:"required"`
-		GenesisTimestamp    *uint64               `json:"genesisTimestamp"`
-		Validators          []common.Address      `json:"validators"`
-		Pool                *common.Address       `json:"pool"`
-		Rewards             *EqualityRewards      `json:"rewards"`
+		Period                *uint64               `json:"period"`
+		Epoch                 *uint64               `json:"epoch"`
+		MaxValidatorsCount    *uint64               `json:"maxValidatorsCount"`
+		MinCandidateBalance   *math.HexOrDecimal256 `json:"minCandidateBalance" gencodec:"required"`
+		GenesisTimestamp      *uint64               `json:"genesisTimestamp"`
+		Validators            []common.Address      `json:"validators"`
+		Pool                  *common.Address       `json:"pool"`
+		Rewards               *EqualityRewards      `json:"rewards"`
+		MaxHeaderExtraSize    *uint64               `json:"maxHeaderExtraSize,omitempty" rlp:"optional"`
+		Compression           *string               `json:"compression,omitempty" rlp:"optional"`
+		CompressionLevel      *uint64               `json:"compressionLevel,omitempty" rlp:"optional"`
+		KickOutRatio          *uint64               `json:"kickOutRatio,omitempty" rlp:"optional"`
+		KickOutLockOut        *uint64               `json:"kickOutLockOut,omitempty" rlp:"optional"`
+		SlashRatio            *uint64               `json:"slashRatio,omitempty" rlp:"optional"`
+		SlashRecipient        *common.Address       `json:"slashRecipient,omitempty" rlp:"nil,optional"`
+		DelegatedVoting       *bool                 `json:"delegatedVoting,omitempty" rlp:"optional"`
+		ShuffleBlock          *math.HexOrDecimal256 `json:"shuffleBlock,omitempty" rlp:"optional"`
+		ActivationBlock       *uint64               `json:"activationBlock,omitempty" rlp:"optional"`
+		ConfigQuorum          *uint64               `json:"configQuorum,omitempty" rlp:"optional"`
+		CandidateLogBlock     *math.HexOrDecimal256 `json:"candidateLogBlock,omitempty" rlp:"optional"`
+		CandidateExitBlock    *math.HexOrDecimal256 `json:"candidateExitBlock,omitempty" rlp:"optional"`
+		CommunityRate         *uint64               `json:"communityRate,omitempty" rlp:"optional"`
+		CommunityAddress      *common.Address       `json:"communityAddress,omitempty" rlp:"nil,optional"`
+		TurnBlock             *math.HexOrDecimal256 `json:"turnBlock,omitempty" rlp:"optional"`
+		RecentBlock           *math.HexOrDecimal256 `json:"recentBlock,omitempty" rlp:"optional"`
+		TopUpBlock            *math.HexOrDecimal256 `json:"topUpBlock,omitempty" rlp:"optional"`
+		MetadataBlock         *math.HexOrDecimal256 `json:"metadataBlock,omitempty" rlp:"optional"`
+		MaxCandidateCount     *uint64               `json:"maxCandidateCount,omitempty" rlp:"optional"`
+		MinValidatorsCount    *uint64               `json:"minValidatorsCount,omitempty" rlp:"optional"`
+		CheckpointBlock       *math.HexOrDecimal256 `json:"checkpointBlock,omitempty" rlp:"optional"`
+		ElectionStrategy      *string               `json:"electionStrategy,omitempty" rlp:"optional"`
+		CandidateGuardBlock   *math.HexOrDecimal256 `json:"candidateGuardBlock,omitempty" rlp:"optional"`
+		RewardRecipientBlock  *math.HexOrDecimal256 `json:"rewardRecipientBlock,omitempty" rlp:"optional"`
+		MaturityBlocks        *uint64               `json:"maturityBlocks,omitempty" rlp:"optional"`
+		ElectionCutoffBlock   *math.HexOrDecimal256 `json:"electionCutoffBlock,omitempty" rlp:"optional"`
+		CandidateAllowList    []common.Address      `json:"candidateAllowList,omitempty" rlp:"optional"`
+		CandidateDenyList     []common.Address      `json:"candidateDenyList,omitempty" rlp:"optional"`
+		ElectionSeedBlock     *math.HexOrDecimal256 `json:"electionSeedBlock,omitempty" rlp:"optional"`
+		ValidatorCountFormula *string               `json:"validatorCountFormula,omitempty" rlp:"optional"`
+		ValidatorCountBase    *uint64               `json:"validatorCountBase,omitempty" rlp:"optional"`
+		ValidatorCountDivisor *uint64               `json:"validatorCountDivisor,omitempty" rlp:"optional"`
+		SealerKeyBlock        *math.HexOrDecimal256 `json:"sealerKeyBlock,omitempty" rlp:"optional"`
+		MintCompactionBlock   *math.HexOrDecimal256 `json:"mintCompactionBlock,omitempty" rlp:"optional"`
+		MaxHeaderExtraBytes   *uint64               `json:"maxHeaderExtraBytes,omitempty" rlp:"optional"`
 	}
 	var dec EqualityConfig
 	if err := json.Unmarshal(input, &dec); err != nil {
@@ -78,5 +186,113 @@ func (e *EqualityConfig) UnmarshalJSON(input []byte) error {
 	if dec.Rewards != nil {
 		e.Rewards = *dec.Rewards
 	}
+	if dec.MaxHeaderExtraSize != nil {
+		e.MaxHeaderExtraSize = *dec.MaxHeaderExtraSize
+	}
+	if dec.Compression != nil {
+		e.Compression = *dec.Compression
+	}
+	if dec.CompressionLevel != nil {
+		e.CompressionLevel = *dec.CompressionLevel
+	}
+	if dec.KickOutRatio != nil {
+		e.KickOutRatio = *dec.KickOutRatio
+	}
+	if dec.KickOutLockOut != nil {
+		e.KickOutLockOut = *dec.KickOutLockOut
+	}
+	if dec.SlashRatio != nil {
+		e.SlashRatio = *dec.SlashRatio
+	}
+	if dec.SlashRecipient != nil {
+		e.SlashRecipient = dec.SlashRecipient
+	}
+	if dec.DelegatedVoting != nil {
+		e.DelegatedVoting = *dec.DelegatedVoting
+	}
+	if dec.ShuffleBlock != nil {
+		e.ShuffleBlock = (*big.Int)(dec.ShuffleBlock)
+	}
+	if dec.ActivationBlock != nil {
+		e.ActivationBlock = *dec.ActivationBlock
+	}
+	if dec.ConfigQuorum != nil {
+		e.ConfigQuorum = *dec.ConfigQuorum
+	}
+	if dec.CandidateLogBlock != nil {
+		e.CandidateLogBlock = (*big.Int)(dec.CandidateLogBlock)
+	}
+	if dec.CandidateExitBlock != nil {
+		e.CandidateExitBlock = (*big.Int)(dec.CandidateExitBlock)
+	}
+	if dec.CommunityRate != nil {
+		e.CommunityRate = *dec.CommunityRate
+	}
+	if dec.CommunityAddress != nil {
+		e.CommunityAddress = dec.CommunityAddress
+	}
+	if dec.TurnBlock != nil {
+		e.TurnBlock = (*big.Int)(dec.TurnBlock)
+	}
+	if dec.RecentBlock != nil {
+		e.RecentBlock = (*big.Int)(dec.RecentBlock)
+	}
+	if dec.TopUpBlock != nil {
+		e.TopUpBlock = (*big.Int)(dec.TopUpBlock)
+	}
+	if dec.MetadataBlock != nil {
+		e.MetadataBlock = (*big.Int)(dec.MetadataBlock)
+	}
+	if dec.MaxCandidateCount != nil {
+		e.MaxCandidateCount = *dec.MaxCandidateCount
+	}
+	if dec.MinValidatorsCount != nil {
+		e.MinValidatorsCount = *dec.MinValidatorsCount
+	}
+	if dec.CheckpointBlock != nil {
+		e.CheckpointBlock = (*big.Int)(dec.CheckpointBlock)
+	}
+	if dec.ElectionStrategy != nil {
+		e.ElectionStrategy = *dec.ElectionStrategy
+	}
+	if dec.CandidateGuardBlock != nil {
+		e.CandidateGuardBlock = (*big.Int)(dec.CandidateGuardBlock)
+	}
+	if dec.RewardRecipientBlock != nil {
+		e.RewardRecipientBlock = (*big.Int)(dec.RewardRecipientBlock)
+	}
+	if dec.MaturityBlocks != nil {
+		e.MaturityBlocks = *dec.MaturityBlocks
+	}
+	if dec.ElectionCutoffBlock != nil {
+		e.ElectionCutoffBlock = (*big.Int)(dec.ElectionCutoffBlock)
+	}
+	if dec.CandidateAllowList != nil {
+		e.CandidateAllowList = dec.CandidateAllowList
+	}
+	if dec.CandidateDenyList != nil {
+		e.CandidateDenyList = dec.CandidateDenyList
+	}
+	if dec.ElectionSeedBlock != nil {
+		e.ElectionSeedBlock = (*big.Int)(dec.ElectionSeedBlock)
+	}
+	if dec.ValidatorCountFormula != nil {
+		e.ValidatorCountFormula = *dec.ValidatorCountFormula
+	}
+	if dec.ValidatorCountBase != nil {
+		e.ValidatorCountBase = *dec.ValidatorCountBase
+	}
+	if dec.ValidatorCountDivisor != nil {
+		e.ValidatorCountDivisor = *dec.ValidatorCountDivisor
+	}
+	if dec.SealerKeyBlock != nil {
+		e.SealerKeyBlock = (*big.Int)(dec.SealerKeyBlock)
+	}
+	if dec.MintCompactionBlock != nil {
+		e.MintCompactionBlock = (*big.Int)(dec.MintCompactionBlock)
+	}
+	if dec.MaxHeaderExtraBytes != nil {
+		e.MaxHeaderExtraBytes = *dec.MaxHeaderExtraBytes
+	}
 	return nil
 }
@@ -351,6 +351,29 @@ type tailUint struct {
 	Tail []uint `rlp:"tail"`
 }
 
+type optionalFields struct {
+	A uint
+	B uint `rlp:"optional"`
+	C uint `rlp:"optional"`
+}
+
+type optionalAndTailField struct {
+	A    uint
+	B    uint   `rlp:"optional"`
+	Tail []uint `rlp:"tail"`
+}
+
+type optionalBigIntField struct {
+	A uint
+	B *big.Int `rlp:"optional"`
+}
+
+type invalidOptional struct {
+	A uint
+	B uint `rlp:"optional"`
+	C uint
+}
+
 type tailPrivateFields struct {
 	A    uint
 	Tail []uint `rlp:"tail"`
@@ -548,6 +571,53 @@ var decodeTests = []decodeTest{
 		error: `rlp: invalid struct tag "tail" for rlp.invalidTail2.B (field type is not slice)`,
 	},
 
+	// struct tag "optional"
+	{
+		input: "C101",
+		ptr:   new(optionalFields),
+		value: optionalFields{1, 0, 0},
+	},
+	{
+		input: "C20102",
+		ptr:   new(optionalFields),
+		value: optionalFields{1, 2, 0},
+	},
+	{
+		input: "C3010203",
+		ptr:   new(optionalFields),
+		value: optionalFields{1, 2, 3},
+	},
+	{
+		input: "C401020304",
+		ptr:   new(optionalFields),
+		error: "rlp: input list has too many elements for rlp.optionalFields",
+	},
+	{
+		input: "C101",
+		ptr:   new(optionalAndTailField),
+		value: optionalAndTailField{A: 1},
+	},
+	{
+		input: "C3010203",
+		ptr:   new(optionalAndTailField),
+		value: optionalAndTailField{A: 1, B: 2, Tail: []uint{3}},
+	},
+	{
+		input: "C101",
+		ptr:   new(optionalBigIntField),
+		value: optionalBigIntField{A: 1, B: nil},
+	},
+	{
+		input: "C20102",
+		ptr:   new(optionalBigIntField),
+		value: optionalBigIntField{A: 1, B: big.NewInt(2)},
+	},
+	{
+		input: "C0",
+		ptr:   new(invalidOptional),
+		error: `rlp: struct field rlp.invalidOptional.C needs "optional" tag`,
+	},
+
 	// struct tag "-"
 	{
 		input: "C20102",
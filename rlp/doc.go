@@ -102,10 +102,27 @@ Signed integers, floating point numbers, maps, channels and functions cannot be
 
 Struct Tags
 
-Package rlp honours certain struct tags: "-", "tail", "nil", "nilList" and "nilString".
+Package rlp honours certain struct tags: "-", "tail", "optional", "nil", "nilList" and
+"nilString".
 
 The "-" tag ignores fields.
 
+The "optional" tag says that the field may be omitted if it is zero-valued. If this tag is
+used on a struct field, all subsequent public fields must also be declared optional.
+
+When encoding a struct with optional fields, the output RLP list contains all values up to
+the last non-zero optional field.
+
+When decoding into a struct, optional fields may be omitted from the end of the input
+list. For the example below, this means input lists of one, two, or three elements are
+accepted.
+
+   type StructWithOptionalFields struct {
+        Required  uint64
+        Optional1 uint64 `rlp:"optional"`
+        Optional2 uint64 `rlp:"optional"`
+   }
+
 The "tail" tag, which may only be used on the last exported struct field, allows slurping
 up any excess list elements into a slice. See examples for more details.
 
@@ -19,6 +19,7 @@ package core
 import (
 	"bytes"
 	"context"
+	"encoding/binary"
 	"errors"
 	"fmt"
 	"math/big"
@@ -58,6 +59,14 @@ var (
 		accounts.MimetypeClique,
 		0x02,
 	}
+	ApplicationEquality = SigFormat{
+		accounts.MimetypeEquality,
+		0x03,
+	}
+	ApplicationEqualityCheckpoint = SigFormat{
+		accounts.MimetypeEqualityCheckpoint,
+		0x04,
+	}
 	TextPlain = SigFormat{
 		accounts.MimetypeTextPlain,
 		0x45,
@@ -258,6 +267,59 @@ func (api *SignerAPI) determineSignatureFormat(ctx context.Context, contentType
 		// Clique uses V on the form 0 or 1
 		useEthereumV = false
 		req = &SignDataRequest{ContentType: mediaType, Rawdata: cliqueRlp, Messages: messages, Hash: sighash}
+	case ApplicationEquality.Mime:
+		// Equality seals the same way as clique, over the header without the signature
+		stringData, ok := data.(string)
+		if !ok {
+			return nil, useEthereumV, fmt.Errorf("input for %v must be an hex-encoded string", ApplicationEquality.Mime)
+		}
+		equalityData, err := hexutil.Decode(stringData)
+		if err != nil {
+			return nil, useEthereumV, err
+		}
+		header := &types.Header{}
+		if err := rlp.DecodeBytes(equalityData, header); err != nil {
+			return nil, useEthereumV, err
+		}
+		// Get back the rlp data, encoded by us
+		sighash, equalityRlp, err := equalityHeaderHashAndRlp(header)
+		if err != nil {
+			return nil, useEthereumV, err
+		}
+		messages := []*NameValueType{
+			{
+				Name:  "Equality header",
+				Typ:   "equality",
+				Value: fmt.Sprintf("equality header %d [0x%x]", header.Number, sighash),
+			},
+		}
+		// Equality uses V on the form 0 or 1
+		useEthereumV = false
+		req = &SignDataRequest{ContentType: mediaType, Rawdata: equalityRlp, Messages: messages, Hash: sighash}
+	case ApplicationEqualityCheckpoint.Mime:
+		// Equality validators attest the final block of an epoch as its checkpoint
+		stringData, ok := data.(string)
+		if !ok {
+			return nil, useEthereumV, fmt.Errorf("input for %v must be an hex-encoded string", ApplicationEqualityCheckpoint.Mime)
+		}
+		checkpointData, err := hexutil.Decode(stringData)
+		if err != nil {
+			return nil, useEthereumV, err
+		}
+		number, hash, err := equalityCheckpoint(checkpointData)
+		if err != nil {
+			return nil, useEthereumV, err
+		}
+		messages := []*NameValueType{
+			{
+				Name:  "Equality checkpoint",
+				Typ:   "equality",
+				Value: fmt.Sprintf("equality checkpoint %d [0x%x]", number, hash),
+			},
+		}
+		// Equality uses V on the form 0 or 1
+		useEthereumV = false
+		req = &SignDataRequest{ContentType: mediaType, Rawdata: checkpointData, Messages: messages, Hash: crypto.Keccak256(checkpointData)}
 	default: // also case TextPlain.Mime:
 		// Calculates an Ethereum ECDSA signature for:
 		// hash = keccak256("\x19${byteVersion}Ethereum Signed Message:\n${message length}${message}")
@@ -310,6 +372,34 @@ func cliqueHeaderHashAndRlp(header *types.Header) (hash, rlp []byte, err error)
 	return hash, rlp, err
 }
 
+// equalityHeaderHashAndRlp returns the hash which is used as input for the
+// proof-of-equality signing. The incoming equality header comes with the 65 byte
+// signature already truncated from the extra data, which makes its rlp the one
+// equality.EqualityRLP returns for the sealed header.
+//
+// The equality package can't be imported here without an import cycle, thus the
+// encoding is reproduced.
+func equalityHeaderHashAndRlp(header *types.Header) (hash, rlpData []byte, err error) {
+	if rlpData, err = rlp.EncodeToBytes(header); err != nil {
+		return nil, nil, err
+	}
+	return crypto.Keccak256(rlpData), rlpData, nil
+}
+
+// equalityCheckpointPrefix separates the equality checkpoint attestations from
+// the other data signed by the validators, as equality.CheckpointSigData does.
+var equalityCheckpointPrefix = []byte("equality-checkpoint")
+
+// equalityCheckpoint returns the block number and hash of the checkpoint data
+// signed by an equality validator, encoded as equality.CheckpointSigData does.
+func equalityCheckpoint(data []byte) (uint64, common.Hash, error) {
+	if len(data) != len(equalityCheckpointPrefix)+8+common.HashLength || !bytes.HasPrefix(data, equalityCheckpointPrefix) {
+		return 0, common.Hash{}, fmt.Errorf("invalid equality checkpoint data %x", data)
+	}
+	number := binary.BigEndian.Uint64(data[len(equalityCheckpointPrefix):])
+	return number, common.BytesToHash(data[len(equalityCheckpointPrefix)+8:]), nil
+}
+
 // SignTypedData signs EIP-712 conformant typed data
 // hash = keccak256("\x19${byteVersion}${domainSeparator}${hashStruct(message)}")
 // It returns
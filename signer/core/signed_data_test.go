@@ -22,15 +22,23 @@ import (
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
+	"math/big"
+	"net"
 	"path"
+	"path/filepath"
 	"strings"
 	"testing"
 
+	"github.com/SecretBlockChain/go-secret/accounts"
+	"github.com/SecretBlockChain/go-secret/accounts/external"
 	"github.com/SecretBlockChain/go-secret/accounts/keystore"
 	"github.com/SecretBlockChain/go-secret/common"
 	"github.com/SecretBlockChain/go-secret/common/hexutil"
 	"github.com/SecretBlockChain/go-secret/common/math"
+	"github.com/SecretBlockChain/go-secret/consensus/equality"
+	"github.com/SecretBlockChain/go-secret/core/types"
 	"github.com/SecretBlockChain/go-secret/crypto"
+	"github.com/SecretBlockChain/go-secret/rpc"
 	"github.com/SecretBlockChain/go-secret/signer/core"
 )
 
@@ -219,6 +227,24 @@ func TestSignData(t *testing.T) {
 	if signature == nil || len(signature) != 65 {
 		t.Errorf("Expected 65 byte signature (got %d bytes)", len(signature))
 	}
+	// application/x-equality-header
+	header := &types.Header{Number: big.NewInt(1), Difficulty: big.NewInt(2), Extra: make([]byte, 32+65)}
+	control.approveCh <- "Y"
+	control.inputCh <- "a_long_password"
+	signature, err = api.SignData(context.Background(), core.ApplicationEquality.Mime, a, hexutil.Encode(equality.EqualityRLP(header)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if signature == nil || len(signature) != 65 {
+		t.Fatalf("Expected 65 byte signature (got %d bytes)", len(signature))
+	}
+	pubkey, err := crypto.SigToPub(equality.SealHash(header).Bytes(), signature)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if signer := crypto.PubkeyToAddress(*pubkey); signer != a.Address() {
+		t.Errorf("Expected signer %x, got %x", a.Address(), signer)
+	}
 	// data/typed
 	control.approveCh <- "Y"
 	control.inputCh <- "a_long_password"
@@ -231,6 +257,59 @@ func TestSignData(t *testing.T) {
 	}
 }
 
+// TestSignEqualityCheckpointExternal signs an equality checkpoint through the
+// external signer backend connected to the signer over IPC.
+func TestSignEqualityCheckpointExternal(t *testing.T) {
+	api, control := setup(t)
+	createAccount(control, api, t)
+	control.approveCh <- "A"
+	list, err := api.List(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	account := accounts.Account{Address: list[0]}
+
+	server := rpc.NewServer()
+	defer server.Stop()
+	if err := server.RegisterName("account", api); err != nil {
+		t.Fatal(err)
+	}
+	endpoint := filepath.Join(tmpDirName(t), "clef.ipc")
+	listener, err := net.Listen("unix", endpoint)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	go server.ServeListener(listener)
+
+	signer, err := external.NewExternalSigner(endpoint)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hash := common.HexToHash("0x01")
+	control.approveCh <- "Y"
+	control.inputCh <- "a_long_password"
+	signature, err := signer.SignData(account, accounts.MimetypeEqualityCheckpoint, equality.CheckpointSigData(30, hash))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(signature) != 65 || signature[64] > 1 {
+		t.Fatalf("Expected 65 byte signature with V 0 or 1, got %x", signature)
+	}
+	pubkey, err := crypto.SigToPub(equality.CheckpointSigHash(30, hash).Bytes(), signature)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if recovered := crypto.PubkeyToAddress(*pubkey); recovered != account.Address {
+		t.Errorf("Expected signer %x, got %x", account.Address, recovered)
+	}
+
+	// Data other than a checkpoint is refused under its mime type
+	if _, err = signer.SignData(account, accounts.MimetypeEqualityCheckpoint, hash.Bytes()); err == nil {
+		t.Error("Expected invalid checkpoint data to be refused")
+	}
+}
+
 func TestDomainChainId(t *testing.T) {
 	withoutChainID := core.TypedData{
 		Types: core.Types{